@@ -0,0 +1,176 @@
+-- Tracking of all open buffers for cursortab.nvim
+--
+-- Every listed file buffer is attached with nvim_buf_attach, and its changes
+-- are sent to the daemon as they happen, with the b:changedtick they lead to.
+-- Changes to buffers other than the current one (formatters, workspace edits,
+-- other windows) become part of the buffer's diff history when it becomes
+-- current. Changes to the current one keep the daemon's copy of its lines up
+-- to date, so it only reads the buffer in full when a change was missed,
+-- are recorded as user actions (typed characters, newlines, pastes), and let
+-- it move a shown completion past edits made elsewhere in the file. Changes
+-- made by vim.paste are sent as pastes, for the behavior.paste_completion
+-- policy. When a buffer is detached the daemon is told, and reads it in full
+-- again.
+
+local daemon = require("cursortab.daemon")
+
+---@class BuffersModule
+local buffers = {}
+
+-- Buffers longer than this are not tracked
+local max_lines = 10000
+
+-- Buffers attached with nvim_buf_attach
+---@type table<integer, boolean>
+local attached = {}
+
+-- Path of each tracked buffer, relative to the cwd
+---@type table<integer, string>
+local paths = {}
+
+-- Whether vim.paste is inserting text, so its changes are sent as a paste
+local pasting = false
+
+-- vim.paste as it was before being wrapped
+---@type function|nil
+local original_paste = nil
+
+---@param buf integer
+---@return string|nil path Path relative to the cwd, nil when the buffer is not tracked
+local function buffer_path(buf)
+	if not vim.api.nvim_buf_is_loaded(buf) or not vim.bo[buf].buflisted or vim.bo[buf].buftype ~= "" then
+		return nil
+	end
+	local name = vim.api.nvim_buf_get_name(buf)
+	if name == "" then
+		return nil
+	end
+	return vim.fn.fnamemodify(name, ":.")
+end
+
+---@param buf integer
+local function send_content(buf)
+	local path = paths[buf]
+	if path then
+		local tick = vim.api.nvim_buf_get_changedtick(buf)
+		daemon.send_buffer_lines(path, 0, -1, vim.api.nvim_buf_get_lines(buf, 0, -1, false), tick)
+	end
+end
+
+---@param buf integer
+local function attach(buf)
+	if paths[buf] then
+		return
+	end
+	local path = buffer_path(buf)
+	if not path or vim.api.nvim_buf_line_count(buf) > max_lines then
+		return
+	end
+
+	if not attached[buf] then
+		attached[buf] = vim.api.nvim_buf_attach(buf, false, {
+			on_lines = function(_, b, tick, first, last, new_last)
+				local p = paths[b]
+				if not p then
+					return
+				end
+				local lines = vim.api.nvim_buf_get_lines(b, first, new_last, false)
+				-- Timestamped now, for the user actions recorded from it
+				local sec, usec = vim.uv.gettimeofday()
+				local time_ms = sec * 1000 + math.floor(usec / 1000)
+				local paste = pasting
+				vim.schedule(function()
+					daemon.send_buffer_lines(p, first, last, lines, tick, time_ms, paste)
+				end)
+			end,
+			on_reload = function(_, b)
+				vim.schedule(function()
+					send_content(b)
+				end)
+			end,
+			on_detach = function(_, b)
+				local p = paths[b]
+				attached[b] = nil
+				paths[b] = nil
+				if p then
+					vim.schedule(function()
+						daemon.send_buffer_closed(p)
+					end)
+				end
+			end,
+		})
+	end
+	if attached[buf] then
+		paths[buf] = path
+		send_content(buf)
+	end
+end
+
+---@param buf integer
+local function detach(buf)
+	local path = paths[buf]
+	if path then
+		paths[buf] = nil
+		daemon.send_buffer_closed(path)
+	end
+end
+
+-- Attach to all open buffers and send their content, for a newly started daemon
+function buffers.sync_all()
+	for _, buf in ipairs(vim.api.nvim_list_bufs()) do
+		if paths[buf] then
+			send_content(buf)
+		else
+			attach(buf)
+		end
+	end
+end
+
+-- Wrap vim.paste to mark the changes it makes, once
+local function wrap_paste()
+	if original_paste then
+		return
+	end
+	original_paste = vim.paste
+	vim.paste = function(lines, phase)
+		pasting = true
+		local ok, result = pcall(original_paste, lines, phase)
+		pasting = false
+		if not ok then
+			error(result, 0)
+		end
+		return result
+	end
+end
+
+-- Set up the autocommands attaching to buffers as they are opened
+function buffers.setup()
+	wrap_paste()
+
+	local group = vim.api.nvim_create_augroup("cursortab_buffers", { clear = true })
+
+	vim.api.nvim_create_autocmd({ "BufReadPost", "BufNewFile", "BufEnter" }, {
+		group = group,
+		callback = function(args)
+			attach(args.buf)
+		end,
+	})
+
+	vim.api.nvim_create_autocmd({ "BufDelete", "BufUnload" }, {
+		group = group,
+		callback = function(args)
+			detach(args.buf)
+		end,
+	})
+
+	-- A renamed buffer is tracked under its new path
+	vim.api.nvim_create_autocmd("BufFilePost", {
+		group = group,
+		callback = function(args)
+			detach(args.buf)
+			attach(args.buf)
+		end,
+	})
+end
+
+return buffers
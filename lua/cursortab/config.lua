@@ -16,19 +16,62 @@
 ---@class CursortabUIConfig
 ---@field colors CursortabUIColorsConfig
 ---@field jump CursortabUIJumpConfig
+---@field show_annotation boolean Show the provider and response latency next to completions
+---@field show_streamed_stages boolean Preview the stages of a streaming completion as they arrive
 
 ---@class CursortabCursorPredictionConfig
 ---@field enabled boolean
 ---@field auto_advance boolean
 ---@field proximity_threshold integer
+---@field cursor_only boolean Show jumps predicted without an edit
+---@field prefetch_depth integer Completions requested ahead along the predicted cursor targets
+
+---@class CursortabStagingConfig
+---@field order string Order of the stages of a completion: "cursor", "top_down" or "dependency"
+
+---@class CursortabRenamePropagationConfig
+---@field enabled boolean Offer to rename the other occurrences of an identifier renamed by a completion
+---@field workspace boolean Also rename them in other workspace files (needs ripgrep)
+
+---@class CursortabTestFailuresConfig
+---@field file string Test run output, relative to the project root ("" to disable)
+---@field command string Command printing the test run output, read instead of file ("" to disable)
 
 ---@class CursortabBehaviorConfig
 ---@field idle_completion_delay integer
 ---@field text_change_debounce integer
+---@field scan_delay integer Idle time in ms before requesting completions at errors and recent edits away from the cursor (0 to disable)
+---@field trigger_policy string Events that start a completion: "insert_change", "manual", "idle_only" or "normal_mode_too"
 ---@field max_visible_lines integer Max visible lines per completion (0 to disable)
+---@field max_completion_lines integer Completions larger than this are chunked or dropped (0 to disable)
+---@field oversized_completion string What to do with completions over max_completion_lines: "chunk" or "drop"
+---@field paste_completion string What to do after a paste: "skip", "delay", "clean_up" or "complete"
+---@field paste_delay integer Quiet time in ms before requesting a completion after a paste, under "delay"
+---@field sticky_lines integer Keep a completion, dimmed, while the cursor moves up to this many lines away in normal mode (0 to disable)
+---@field max_buffer_size integer Buffers larger than this many kilobytes get no completions (0 to disable)
+---@field display_ttl integer Auto-dismiss a shown completion after this many ms (0 to disable)
+---@field cache_ttl integer Reuse a provider response for an identical context for this many ms (0 to disable)
+---@field cache_max_entries integer Max cached provider responses (0 to disable)
+---@field persistent_cache boolean Keep cached responses and edit history across restarts
+---@field quality_log boolean Log requests and their outcomes locally for :CursortabQuality
+---@field telemetry boolean Send shown/accepted/rejected events to the provider backend
+---@field metrics_log boolean Append shown/accepted/rejected events to state_dir/metrics.jsonl
 ---@field cursor_prediction CursortabCursorPredictionConfig
+---@field staging CursortabStagingConfig
+---@field rename_propagation CursortabRenamePropagationConfig
+---@field test_failures CursortabTestFailuresConfig
+---@field placeholders boolean Cycle the accept keys through the variable parts of an accepted completion
+---@field auto_import boolean Offer the imports an accepted completion is missing as an extra stage
+---@field fix_diagnostics boolean Ask idle requests on a line with an LSP error to fix it
+---@field open_folds boolean Open closed folds hiding a stage instead of pointing at their first line
 ---@field ignore_paths string[] Glob patterns for files to skip (gitignore-style)
 ---@field ignore_gitignored boolean Skip files matched by .gitignore
+---@field root_markers string[] Files or directories marking the root of a project
+---@field redact_secrets boolean Replace credentials with placeholders before requests are sent
+---@field redact_patterns string[] Extra Go regular expressions for redact_secrets (first capture group only, if any)
+---@field word_diff boolean Highlight only the changed words of modified lines
+---@field inline_diff boolean Show the word edits of modified lines in place, removed words struck through and inserted words highlighted
+---@field column_unit string Unit of columns in rendering payloads: "byte", "char" or "cell"
 ---@field enabled_modes string[] Modes where completions are active ("insert", "normal")
 
 ---@class CursortabFIMTokensConfig
@@ -39,32 +82,72 @@
 ---@class CursortabProviderConfig
 ---@field type string
 ---@field url string
+---@field transport string
 ---@field api_key_env string|nil Environment variable name containing the API key (e.g., "OPENAI_API_KEY")
 ---@field model string
 ---@field temperature number
 ---@field max_tokens integer Max tokens to generate (also used to derive input context size)
 ---@field top_k integer
+---@field seed integer Sampling seed for local providers (0 = server default, -1 = random per request, logged at debug level)
 ---@field completion_timeout integer
 ---@field max_diff_history_tokens integer
 ---@field completion_path string API endpoint path (e.g., "/v1/completions")
 ---@field fim_tokens CursortabFIMTokensConfig|nil FIM tokens configuration (optional)
+---@field system_prompt string System prompt for the chat provider ({prefix}, {suffix} and {middle} expand to fim_tokens)
+---@field stop_sequences string[] Extra stop sequences for the chat provider
 ---@field privacy_mode boolean Enable privacy mode (don't send telemetry to provider)
+---@field eof_policy string Completions extending past the last line: "extend", "clamp", or "reject"
+---@field token_budget integer Estimated tokens per minute before auto-advance retriggers are held back (0 = unlimited)
+---@field max_requests_per_minute integer Requests per minute before completions queue and prefetches are skipped (0 = unlimited)
+---@field max_concurrent_requests integer Requests in flight at once (0 = unlimited)
+---@field circuit_breaker CursortabCircuitBreakerConfig Pausing of automatic requests to a provider that keeps failing
+---@field context_budget CursortabContextBudgetConfig Token budget shared by the context sources of each request
+---@field max_payload_bytes integer Cap on the size of each request; context is trimmed to fit (0 = no cap)
+---@field context_limits CursortabContextLimitsConfig Input and output limits replacing the provider's
+---@field tokenizer_vocab string tiktoken-format vocabulary counting the tokens context is trimmed to ("" = heuristic)
+---@field options table<string, any> Generation parameters passed through with each request: temperature, top_p, model, headers
+---@field race CursortabProviderConfig[] Additional providers raced against this one (fastest non-empty response wins)
+---@field fallback CursortabProviderConfig[] Providers to fail over to, in order, when this one times out or keeps failing
+
+---@class CursortabCircuitBreakerConfig
+---@field failures integer Consecutive failed requests that pause automatic requests (0 = never)
+---@field cooldown integer Milliseconds requests are paused before a probe is sent
+
+---@class CursortabContextBudgetConfig
+---@field max_tokens integer Tokens for the current file and its context (0 = no budget)
+---@field weights table<string, number> Share of the budget per source: diff_history, snapshots, diagnostics, git_diff, git_history, lsp, retrieval
+
+---@class CursortabContextLimitsConfig
+---@field max_input_lines integer Lines of the current file sent (0 = provider default, else >= 20)
+---@field max_input_bytes integer Bytes of the current file and its context sent (0 = provider default, else >= 1024)
+---@field max_output_tokens integer Tokens to generate, leaving max_tokens to size the input (0 = max_tokens, else >= 16)
 
 ---@class CursortabDebugConfig
 ---@field immediate_shutdown boolean
 
 ---@class CursortabKeymapsConfig
 ---@field accept string|false Accept keymap (e.g., "<Tab>"), or false to disable
----@field partial_accept string|false Partial accept keymap (e.g., "<S-Tab>"), or false to disable
+---@field partial_accept string|false Partial accept keymap accepting the next word (e.g., "<S-Tab>"), or false to disable
+---@field partial_accept_line string|false Partial accept keymap accepting the rest of the line (e.g., "<M-l>"), or false to disable
+---@field accept_in_place string|false Accept without moving the cursor (e.g., "<M-Tab>"), or false to disable
+---@field reject_stage string|false Skip the current stage and show the next one (e.g., "<C-x>"), or false to disable
+---@field next_suggestion string|false Show the next alternative completion (e.g., "<M-]>"), or false to disable
+---@field prev_suggestion string|false Show the previous alternative completion (e.g., "<M-[>"), or false to disable
 ---@field trigger string|false Trigger completion keymap (e.g., "<C-Space>"), or false to disable
 
 ---@class CursortabBlinkConfig
 ---@field enabled boolean
 ---@field ghost_text boolean
 
+---@class CursortabLogRotationConfig
+---@field max_size_mb integer Rotate the log past this size (0 keeps the last lines instead)
+---@field max_files integer Rotated log files kept
+---@field max_age_days integer Remove rotated log files older than this (0 to disable)
+
 ---@class CursortabConfig
 ---@field enabled boolean
 ---@field log_level string
+---@field log_rotation CursortabLogRotationConfig
 ---@field state_dir string Directory for runtime files (log, socket, pid)
 ---@field keymaps CursortabKeymapsConfig
 ---@field ui CursortabUIConfig
@@ -78,11 +161,21 @@
 local default_config = {
 	enabled = true,
 	log_level = "info",
+	log_rotation = {
+		max_size_mb = 10, -- Rotate cursortab.log past this size (0 to keep the last lines instead)
+		max_files = 3, -- Rotated files kept as cursortab.log.1 to .N
+		max_age_days = 14, -- Remove rotated files older than this (0 to disable)
+	},
 	state_dir = vim.fn.stdpath("state") .. "/cursortab",
 
 	keymaps = {
 		accept = "<Tab>", -- Keymap to accept completion, or false to disable
-		partial_accept = "<S-Tab>", -- Keymap to partially accept completion, or false to disable
+		partial_accept = "<S-Tab>", -- Keymap to accept the next word of the completion, or false to disable
+		partial_accept_line = false, -- Keymap to accept the rest of the suggested line, or false to disable (default: false)
+		accept_in_place = false, -- Keymap to accept without moving the cursor, or false to disable (default: false)
+		reject_stage = false, -- Keymap to skip the current stage and show the next one, or false to disable (default: false)
+		next_suggestion = false, -- Keymap to show the next alternative completion, or false to disable (default: false)
+		prev_suggestion = false, -- Keymap to show the previous alternative completion, or false to disable (default: false)
 		trigger = false, -- Keymap to manually trigger completion, or false to disable (default: false)
 	},
 
@@ -100,17 +193,51 @@ local default_config = {
 			bg_color = "#373b45",
 			fg_color = "#bac1d1",
 		},
+		show_annotation = false, -- Show the provider and response latency next to completions, e.g. "[sweep 230ms]"
+		show_streamed_stages = true, -- Preview the rest of a streaming completion, dimmed, as its stages arrive
 	},
 
 	behavior = {
 		idle_completion_delay = 50, -- Delay in ms after being idle in normal mode to trigger completion (-1 to disable)
 		text_change_debounce = 50, -- Debounce in ms after text changed to trigger completion
+		scan_delay = 0, -- Idle time in ms in normal mode before also requesting completions at LSP errors and recent edits away from the cursor, shown as jumps (0 to disable)
+		trigger_policy = "insert_change", -- "insert_change" (typing and idle), "manual" (only :CursortabTrigger or keymaps.trigger), "idle_only" (idle in normal mode) or "normal_mode_too" (as insert_change, also in normal mode)
 		max_visible_lines = 12, -- Max visible lines per completion (0 to disable)
+		max_completion_lines = 100, -- Completions larger than this many lines are chunked or dropped (0 to disable)
+		oversized_completion = "chunk", -- "chunk" (split into stages of at most max_completion_lines, whatever the proximity) or "drop" (discard, and cancel the stream once it grows past the limit)
+		paste_completion = "skip", -- After pasting (from the terminal, or a single change of 5+ lines): "skip" (no completion until the next edit), "delay" (wait for paste_delay without changes), "clean_up" (ask to fit the pasted code to the code around it) or "complete" (as for typing)
+		paste_delay = 1000, -- Quiet time in ms before requesting a completion after a paste, when paste_completion is "delay"
+		sticky_lines = 0, -- Keep a completion, dimmed, while the cursor moves up to this many lines away from it in normal mode (0 to disable)
+		max_buffer_size = 1024, -- Buffers larger than this many kilobytes get no completions, like help, terminal and nomodifiable buffers (0 to disable)
+		display_ttl = 0, -- Auto-dismiss a shown completion after this many ms, paused while the cursor is on it (0 to disable)
+		cache_ttl = 30000, -- Reuse a provider response for an identical context (undo/redo, reject and retrigger) for this many ms (0 to disable)
+		cache_max_entries = 32, -- Max cached provider responses (0 to disable)
+		persistent_cache = false, -- Save cached responses and edit history per workspace, restored on restart
+		quality_log = false, -- Log each request's context, latency and outcome to state_dir/quality.jsonl (no prompts stored)
+		telemetry = true, -- Send shown/accepted/rejected events to providers that collect them (sweepapi, mercuryapi, gemini, anthropic)
+		metrics_log = false, -- Append the same events to state_dir/metrics.jsonl instead of (or as well as) sending them
 		cursor_prediction = {
 			enabled = true, -- Show jump indicators after completions
 			auto_advance = true, -- When completion has no changes, show cursor jump to last line
 			proximity_threshold = 2, -- Min lines apart to show cursor jump between completions (0 to disable)
+			cursor_only = true, -- Show jumps from providers that predict the next cursor line without an edit
+			prefetch_depth = 1, -- Completions requested ahead along the predicted cursor targets while reviewing the current one
+		},
+		staging = {
+			order = "cursor", -- Order of the stages of a completion: "cursor" (nearest first), "top_down" (file order) or "dependency" (definitions before uses)
+		},
+		rename_propagation = {
+			enabled = true, -- After accepting a rename of an identifier, offer to rename its other occurrences in the buffer
+			workspace = false, -- Also rename them in other workspace files found with ripgrep
+		},
+		test_failures = {
+			file = ".cursortab/test-output.txt", -- Output of the latest test run, relative to the project root, whose failures are sent as context ("" to disable)
+			command = "", -- Command printing the latest test run output, read instead of file; it should not run the tests itself
 		},
+		placeholders = true, -- After accepting, jump between new parameters, TODOs and string literals with the accept and partial accept keys
+		auto_import = true, -- After accepting, offer the imports the completion is missing (from the language server, or guessed for Go, Python and TS/JS)
+		fix_diagnostics = true, -- When the cursor rests on a line with an LSP error, ask the provider for a fix of that error
+		open_folds = false, -- Open closed folds hiding a stage when the completion arrives (otherwise the jump indicator sits on the fold)
 		enabled_modes = { "insert", "normal" }, -- Modes where completions are active
 		ignore_paths = { -- Glob patterns for files to skip completions
 			"*.min.js",
@@ -124,16 +251,24 @@ local default_config = {
 			"*.log",
 		},
 		ignore_gitignored = true, -- Skip files matched by .gitignore
+		root_markers = { ".git", "go.mod", "package.json" }, -- Files marking a project root, searched upward from each buffer
+		redact_secrets = true, -- Replace API keys, tokens and private keys with placeholders before requests are sent
+		redact_patterns = {}, -- Extra Go regular expressions to redact (only the first capture group, if any)
+		word_diff = false, -- Highlight only the changed words of modified lines instead of the whole line
+		inline_diff = false, -- Show modified lines as in-place word edits (removed words struck through, inserted words highlighted) instead of beside the line; needs Neovim 0.10
+		column_unit = "byte", -- Unit of columns in rendering payloads: "byte", "char" (code points) or "cell" (display width)
 	},
 
 	provider = {
-		type = "inline", -- "inline", "fim", "sweep", "sweepapi", "zeta", "copilot", or "mercuryapi"
+		type = "inline", -- "inline", "fim", "sweep", "sweepapi", "zeta", "copilot", "mercuryapi", "ollama", "chat", "gemini", or "anthropic"
 		url = "http://localhost:8000", -- URL of the provider server
+		transport = "http", -- "http", "grpc" (sweepapi) or "websocket" (inline, fim, sweep, zeta), for self-hosted gateways
 		api_key_env = "", -- Environment variable name for API key (e.g., "OPENAI_API_KEY")
 		model = "", -- Model name
 		temperature = 0.0, -- Sampling temperature
 		max_tokens = 512, -- Max tokens to generate
 		top_k = 50, -- Top-k sampling
+		seed = 0, -- Sampling seed (0 = server default, -1 = random per request)
 		completion_timeout = 5000, -- Timeout in ms for completion requests
 		max_diff_history_tokens = 512, -- Max tokens for diff history (0 = no limit)
 		completion_path = "/v1/completions", -- API endpoint path
@@ -142,7 +277,39 @@ local default_config = {
 			suffix = "<|fim_suffix|>",
 			middle = "<|fim_middle|>",
 		},
+		system_prompt = "You are a code completion engine. The user message is a file excerpt where {prefix} starts the code before the cursor, {suffix} starts the code after the cursor, and {middle} marks the cursor. Reply with only the code to insert at the cursor, without explanations and without markdown fences.", -- System prompt (for chat provider)
+		stop_sequences = {}, -- Extra stop sequences (for chat provider)
 		privacy_mode = true, -- Don't send telemetry to provider
+		eof_policy = "extend", -- Completions extending past the last line: "extend", "clamp", or "reject"
+		token_budget = 0, -- Estimated tokens per minute before retriggers are held back (0 = unlimited)
+		max_requests_per_minute = 0, -- Requests per minute before completions queue (0 = unlimited)
+		max_concurrent_requests = 0, -- Requests in flight at once (0 = unlimited)
+		circuit_breaker = {
+			failures = 5, -- Consecutive failed requests that pause automatic requests (0 = never)
+			cooldown = 30000, -- Milliseconds requests are paused before a probe is sent
+		},
+		context_budget = {
+			max_tokens = 0, -- Tokens for the current file and its context per request (0 = no budget)
+			weights = { -- Share of what the current file leaves of the budget, per context source
+				diff_history = 3,
+				snapshots = 2,
+				diagnostics = 2,
+				git_diff = 1,
+				git_history = 1,
+				lsp = 1,
+				retrieval = 1,
+			},
+		},
+		max_payload_bytes = 0, -- Cap on the size of each request; context is trimmed to fit (0 = no cap)
+		context_limits = {
+			max_input_lines = 0, -- Lines of the current file sent (0 = provider default)
+			max_input_bytes = 0, -- Bytes of the current file and its context sent (0 = provider default)
+			max_output_tokens = 0, -- Tokens to generate, leaving max_tokens to size the input (0 = max_tokens)
+		},
+		tokenizer_vocab = "", -- tiktoken-format vocabulary file for token-accurate trimming ("" = estimate from characters)
+		options = {}, -- Generation parameters passed through with each request (temperature, top_p, model, headers)
+		race = {}, -- Additional providers to race against this one (fields default to the values above)
+		fallback = {}, -- Providers to fail over to, in order, when this one times out or returns repeated 5xx
 	},
 
 	blink = {
@@ -265,8 +432,16 @@ local function migrate_deprecated_config(user_config)
 end
 
 -- Valid values for enum-like config options
-local valid_provider_types = { inline = true, fim = true, sweep = true, sweepapi = true, zeta = true, copilot = true, mercuryapi = true }
+local valid_provider_types = { inline = true, fim = true, sweep = true, sweepapi = true, zeta = true, copilot = true, mercuryapi = true, ollama = true, chat = true, gemini = true, anthropic = true }
+local valid_eof_policies = { extend = true, clamp = true, reject = true }
+local valid_transports = { http = true, grpc = true, websocket = true }
+local websocket_provider_types = { inline = true, fim = true, sweep = true, zeta = true }
 local valid_log_levels = { trace = true, debug = true, info = true, warn = true, error = true }
+local valid_column_units = { byte = true, char = true, cell = true }
+local valid_stage_orders = { cursor = true, top_down = true, dependency = true }
+local valid_trigger_policies = { insert_change = true, manual = true, idle_only = true, normal_mode_too = true }
+local valid_oversized_completions = { chunk = true, drop = true }
+local valid_paste_completions = { skip = true, delay = true, clean_up = true, complete = true }
 
 -- Validate that all keys in user config exist in default config
 ---@param user_cfg table User configuration
@@ -277,8 +452,8 @@ local function validate_config_keys(user_cfg, default_cfg, path)
 		if default_cfg[key] == nil then
 			error(string.format("[cursortab.nvim] Unknown config option: %s%s", path, key))
 		end
-		-- Recursively validate nested tables
-		if type(value) == "table" and type(default_cfg[key]) == "table" then
+		-- Recursively validate nested tables (list contents are validated in validate_config)
+		if type(value) == "table" and type(default_cfg[key]) == "table" and not vim.islist(default_cfg[key]) then
 			validate_config_keys(value, default_cfg[key], path .. key .. ".")
 		end
 	end
@@ -304,7 +479,7 @@ local function validate_config(cfg)
 	if cfg.provider and cfg.provider.type then
 		if not valid_provider_types[cfg.provider.type] then
 			error(string.format(
-				"[cursortab.nvim] Invalid provider.type '%s'. Must be one of: inline, fim, sweep, sweepapi, zeta, copilot, mercuryapi",
+				"[cursortab.nvim] Invalid provider.type '%s'. Must be one of: inline, fim, sweep, sweepapi, zeta, copilot, mercuryapi, ollama, chat, gemini, anthropic",
 				cfg.provider.type
 			))
 		end
@@ -318,7 +493,59 @@ local function validate_config(cfg)
 		))
 	end
 
+	if cfg.behavior and cfg.behavior.column_unit and not valid_column_units[cfg.behavior.column_unit] then
+		error(string.format(
+			"[cursortab.nvim] Invalid behavior.column_unit '%s'. Must be one of: byte, char, cell",
+			cfg.behavior.column_unit
+		))
+	end
+
+	if cfg.behavior and cfg.behavior.trigger_policy and not valid_trigger_policies[cfg.behavior.trigger_policy] then
+		error(string.format(
+			"[cursortab.nvim] Invalid behavior.trigger_policy '%s'. Must be one of: insert_change, manual, idle_only, normal_mode_too",
+			cfg.behavior.trigger_policy
+		))
+	end
+
+	if
+		cfg.behavior
+		and cfg.behavior.oversized_completion
+		and not valid_oversized_completions[cfg.behavior.oversized_completion]
+	then
+		error(string.format(
+			"[cursortab.nvim] Invalid behavior.oversized_completion '%s'. Must be one of: chunk, drop",
+			cfg.behavior.oversized_completion
+		))
+	end
+
+	if
+		cfg.behavior
+		and cfg.behavior.paste_completion
+		and not valid_paste_completions[cfg.behavior.paste_completion]
+	then
+		error(string.format(
+			"[cursortab.nvim] Invalid behavior.paste_completion '%s'. Must be one of: skip, delay, clean_up, complete",
+			cfg.behavior.paste_completion
+		))
+	end
+
+	if cfg.behavior and cfg.behavior.staging and cfg.behavior.staging.order then
+		if not valid_stage_orders[cfg.behavior.staging.order] then
+			error(string.format(
+				"[cursortab.nvim] Invalid behavior.staging.order '%s'. Must be one of: cursor, top_down, dependency",
+				cfg.behavior.staging.order
+			))
+		end
+	end
+
 	-- Validate numeric ranges
+	if cfg.log_rotation then
+		for _, field in ipairs({ "max_size_mb", "max_files", "max_age_days" }) do
+			if cfg.log_rotation[field] and cfg.log_rotation[field] < 0 then
+				error(string.format("[cursortab.nvim] log_rotation.%s must be >= 0", field))
+			end
+		end
+	end
 	if cfg.behavior then
 		if cfg.behavior.idle_completion_delay and cfg.behavior.idle_completion_delay < -1 then
 			error("[cursortab.nvim] behavior.idle_completion_delay must be >= -1")
@@ -326,9 +553,37 @@ local function validate_config(cfg)
 		if cfg.behavior.text_change_debounce and cfg.behavior.text_change_debounce < -1 then
 			error("[cursortab.nvim] behavior.text_change_debounce must be >= -1 (-1 to disable)")
 		end
+		if cfg.behavior.scan_delay and cfg.behavior.scan_delay < 0 then
+			error("[cursortab.nvim] behavior.scan_delay must be >= 0 (0 to disable)")
+		end
 		if cfg.behavior.max_visible_lines and cfg.behavior.max_visible_lines < 0 then
 			error("[cursortab.nvim] behavior.max_visible_lines must be >= 0 (0 to disable)")
 		end
+		if cfg.behavior.max_completion_lines and cfg.behavior.max_completion_lines < 0 then
+			error("[cursortab.nvim] behavior.max_completion_lines must be >= 0 (0 to disable)")
+		end
+		if cfg.behavior.paste_delay and cfg.behavior.paste_delay < 0 then
+			error("[cursortab.nvim] behavior.paste_delay must be >= 0")
+		end
+		local prefetch_depth = cfg.behavior.cursor_prediction and cfg.behavior.cursor_prediction.prefetch_depth
+		if prefetch_depth and (type(prefetch_depth) ~= "number" or prefetch_depth < 1) then
+			error("[cursortab.nvim] behavior.cursor_prediction.prefetch_depth must be >= 1")
+		end
+		if cfg.behavior.sticky_lines and cfg.behavior.sticky_lines < 0 then
+			error("[cursortab.nvim] behavior.sticky_lines must be >= 0 (0 to disable)")
+		end
+		if cfg.behavior.max_buffer_size and cfg.behavior.max_buffer_size < 0 then
+			error("[cursortab.nvim] behavior.max_buffer_size must be >= 0 (0 to disable)")
+		end
+		if cfg.behavior.display_ttl and cfg.behavior.display_ttl < 0 then
+			error("[cursortab.nvim] behavior.display_ttl must be >= 0 (0 to disable)")
+		end
+		if cfg.behavior.cache_ttl and cfg.behavior.cache_ttl < 0 then
+			error("[cursortab.nvim] behavior.cache_ttl must be >= 0 (0 to disable)")
+		end
+		if cfg.behavior.cache_max_entries and cfg.behavior.cache_max_entries < 0 then
+			error("[cursortab.nvim] behavior.cache_max_entries must be >= 0 (0 to disable)")
+		end
 		if cfg.behavior.enabled_modes ~= nil then
 			if type(cfg.behavior.enabled_modes) ~= "table" then
 				error("[cursortab.nvim] behavior.enabled_modes must be a list (e.g., { \"insert\", \"normal\" })")
@@ -354,9 +609,29 @@ local function validate_config(cfg)
 				end
 			end
 		end
+		if cfg.behavior.root_markers ~= nil then
+			if type(cfg.behavior.root_markers) ~= "table" or #cfg.behavior.root_markers == 0 then
+				error("[cursortab.nvim] behavior.root_markers must be a non-empty list of file names")
+			end
+			for i, marker in ipairs(cfg.behavior.root_markers) do
+				if type(marker) ~= "string" then
+					error(string.format("[cursortab.nvim] behavior.root_markers[%d] must be a string", i))
+				end
+			end
+		end
 		if cfg.behavior.ignore_gitignored ~= nil and type(cfg.behavior.ignore_gitignored) ~= "boolean" then
 			error("[cursortab.nvim] behavior.ignore_gitignored must be a boolean")
 		end
+		if cfg.behavior.redact_patterns ~= nil then
+			if type(cfg.behavior.redact_patterns) ~= "table" then
+				error("[cursortab.nvim] behavior.redact_patterns must be a list of regular expression strings")
+			end
+			for i, pattern in ipairs(cfg.behavior.redact_patterns) do
+				if type(pattern) ~= "string" then
+					error(string.format("[cursortab.nvim] behavior.redact_patterns[%d] must be a string", i))
+				end
+			end
+		end
 	end
 
 	if cfg.provider then
@@ -369,9 +644,180 @@ local function validate_config(cfg)
 		if cfg.provider.max_diff_history_tokens and cfg.provider.max_diff_history_tokens < 0 then
 			error("[cursortab.nvim] provider.max_diff_history_tokens must be >= 0")
 		end
+		if cfg.provider.seed and cfg.provider.seed < -1 then
+			error("[cursortab.nvim] provider.seed must be >= -1")
+		end
+		if cfg.provider.token_budget and cfg.provider.token_budget < 0 then
+			error("[cursortab.nvim] provider.token_budget must be >= 0")
+		end
+		if cfg.provider.max_requests_per_minute and cfg.provider.max_requests_per_minute < 0 then
+			error("[cursortab.nvim] provider.max_requests_per_minute must be >= 0")
+		end
+		if cfg.provider.max_concurrent_requests and cfg.provider.max_concurrent_requests < 0 then
+			error("[cursortab.nvim] provider.max_concurrent_requests must be >= 0")
+		end
+		local breaker = cfg.provider.circuit_breaker
+		if breaker then
+			if breaker.failures and breaker.failures < 0 then
+				error("[cursortab.nvim] provider.circuit_breaker.failures must be >= 0")
+			end
+			if breaker.cooldown and breaker.cooldown < 0 then
+				error("[cursortab.nvim] provider.circuit_breaker.cooldown must be >= 0")
+			end
+		end
+		local budget = cfg.provider.context_budget
+		if budget then
+			if budget.max_tokens and budget.max_tokens < 0 then
+				error("[cursortab.nvim] provider.context_budget.max_tokens must be >= 0")
+			end
+			local sources = { diff_history = true, snapshots = true, diagnostics = true, git_diff = true, git_history = true, lsp = true, retrieval = true }
+			for source, weight in pairs(budget.weights or {}) do
+				if not sources[source] then
+					error(
+						string.format(
+							"[cursortab.nvim] provider.context_budget.weights.%s is not a context source (diff_history, snapshots, diagnostics, git_diff, git_history, lsp, retrieval)",
+							source
+						)
+					)
+				end
+				if type(weight) ~= "number" or weight < 0 then
+					error(string.format("[cursortab.nvim] provider.context_budget.weights.%s must be a number >= 0", source))
+				end
+			end
+		end
+		if cfg.provider.max_payload_bytes and cfg.provider.max_payload_bytes < 0 then
+			error("[cursortab.nvim] provider.max_payload_bytes must be >= 0")
+		end
+		local limits = cfg.provider.context_limits
+		if limits ~= nil then
+			if type(limits) ~= "table" then
+				error("[cursortab.nvim] provider.context_limits must be a table")
+			end
+			local minimums = { max_input_lines = 20, max_input_bytes = 1024, max_output_tokens = 16 }
+			for name, minimum in pairs(minimums) do
+				local value = limits[name]
+				if value ~= nil and (type(value) ~= "number" or (value ~= 0 and value < minimum)) then
+					error(string.format("[cursortab.nvim] provider.context_limits.%s must be 0 or >= %d", name, minimum))
+				end
+			end
+		end
 		if cfg.provider.completion_path and not cfg.provider.completion_path:match("^/") then
 			error("[cursortab.nvim] provider.completion_path must start with '/'")
 		end
+		if cfg.provider.race ~= nil then
+			if type(cfg.provider.race) ~= "table" then
+				error("[cursortab.nvim] provider.race must be a list of provider tables")
+			end
+			for i, race in ipairs(cfg.provider.race) do
+				local path = string.format("provider.race[%d]", i)
+				if type(race) ~= "table" then
+					error(string.format("[cursortab.nvim] %s must be a table", path))
+				end
+				if race.race ~= nil then
+					error(string.format("[cursortab.nvim] %s.race is not allowed: racing providers cannot be nested", path))
+				end
+				if race.eof_policy ~= nil then
+					error(string.format(
+						"[cursortab.nvim] %s.eof_policy is not allowed: racing providers use provider.eof_policy",
+						path
+					))
+				end
+				validate_config_keys(race, default_config.provider, path .. ".")
+				if race.type ~= nil and not valid_provider_types[race.type] then
+					error(string.format(
+						"[cursortab.nvim] Invalid %s.type '%s'. Must be one of: inline, fim, sweep, sweepapi, zeta, copilot, mercuryapi, ollama, chat, gemini, anthropic",
+						path,
+						race.type
+					))
+				end
+			end
+		end
+		if cfg.provider.fallback ~= nil then
+			if type(cfg.provider.fallback) ~= "table" then
+				error("[cursortab.nvim] provider.fallback must be a list of provider tables")
+			end
+			for i, fallback in ipairs(cfg.provider.fallback) do
+				local path = string.format("provider.fallback[%d]", i)
+				if type(fallback) ~= "table" then
+					error(string.format("[cursortab.nvim] %s must be a table", path))
+				end
+				if fallback.race ~= nil or fallback.fallback ~= nil then
+					error(string.format("[cursortab.nvim] %s cannot race or fall back", path))
+				end
+				if fallback.eof_policy ~= nil then
+					error(string.format(
+						"[cursortab.nvim] %s.eof_policy is not allowed: fallback providers use provider.eof_policy",
+						path
+					))
+				end
+				validate_config_keys(fallback, default_config.provider, path .. ".")
+				if fallback.type ~= nil and not valid_provider_types[fallback.type] then
+					error(string.format(
+						"[cursortab.nvim] Invalid %s.type '%s'. Must be one of: inline, fim, sweep, sweepapi, zeta, copilot, mercuryapi, ollama, chat, gemini, anthropic",
+						path,
+						fallback.type
+					))
+				end
+			end
+		end
+		if cfg.provider.transport ~= nil and not valid_transports[cfg.provider.transport] then
+			error(string.format(
+				"[cursortab.nvim] Invalid provider.transport '%s'. Must be one of: http, grpc, websocket",
+				tostring(cfg.provider.transport)
+			))
+		end
+		if cfg.provider.transport == "grpc" and cfg.provider.type ~= "sweepapi" then
+			error("[cursortab.nvim] provider.transport 'grpc' is only supported by the sweepapi provider")
+		end
+		if cfg.provider.transport == "websocket" and not websocket_provider_types[cfg.provider.type] then
+			error("[cursortab.nvim] provider.transport 'websocket' is only supported by the inline, fim, sweep and zeta providers")
+		end
+		if cfg.provider.eof_policy ~= nil and not valid_eof_policies[cfg.provider.eof_policy] then
+			error(string.format(
+				"[cursortab.nvim] Invalid provider.eof_policy '%s'. Must be one of: extend, clamp, reject",
+				tostring(cfg.provider.eof_policy)
+			))
+		end
+		if cfg.provider.tokenizer_vocab ~= nil and type(cfg.provider.tokenizer_vocab) ~= "string" then
+			error("[cursortab.nvim] provider.tokenizer_vocab must be a string")
+		end
+		local options = cfg.provider.options
+		if options ~= nil then
+			if type(options) ~= "table" then
+				error("[cursortab.nvim] provider.options must be a table")
+			end
+			for _, key in ipairs({ "temperature", "top_p" }) do
+				if options[key] ~= nil and (type(options[key]) ~= "number" or options[key] < 0) then
+					error(string.format("[cursortab.nvim] provider.options.%s must be a number >= 0", key))
+				end
+			end
+			if options.model ~= nil and type(options.model) ~= "string" then
+				error("[cursortab.nvim] provider.options.model must be a string")
+			end
+			if options.headers ~= nil then
+				if type(options.headers) ~= "table" then
+					error("[cursortab.nvim] provider.options.headers must be a table of strings")
+				end
+				for name, value in pairs(options.headers) do
+					if type(name) ~= "string" or type(value) ~= "string" then
+						error("[cursortab.nvim] provider.options.headers must map header names to strings")
+					end
+				end
+			end
+		end
+		if cfg.provider.system_prompt ~= nil and type(cfg.provider.system_prompt) ~= "string" then
+			error("[cursortab.nvim] provider.system_prompt must be a string")
+		end
+		if cfg.provider.stop_sequences ~= nil then
+			if type(cfg.provider.stop_sequences) ~= "table" then
+				error("[cursortab.nvim] provider.stop_sequences must be a list of strings")
+			end
+			for i, stop in ipairs(cfg.provider.stop_sequences) do
+				if type(stop) ~= "string" or stop == "" then
+					error(string.format("[cursortab.nvim] provider.stop_sequences[%d] must be a non-empty string", i))
+				end
+			end
+		end
 		if cfg.provider.fim_tokens ~= nil then
 			if type(cfg.provider.fim_tokens) ~= "table" then
 				error("[cursortab.nvim] provider.fim_tokens must be a table with prefix, suffix, and middle fields")
@@ -408,6 +854,16 @@ function config.setup(user_config)
 	local migrated = migrate_deprecated_config(user_config or {})
 	validate_config(migrated)
 	current_config = vim.tbl_deep_extend("force", vim.deepcopy(default_config), migrated)
+	-- Racing and fallback providers inherit any field they don't set from the provider defaults
+	local member_defaults = vim.deepcopy(default_config.provider)
+	member_defaults.race = nil
+	member_defaults.fallback = nil
+	member_defaults.eof_policy = nil -- Completions are fitted with the provider's policy whichever member served them
+	local function with_defaults(member)
+		return vim.tbl_deep_extend("force", vim.deepcopy(member_defaults), member)
+	end
+	current_config.provider.race = vim.tbl_map(with_defaults, current_config.provider.race)
+	current_config.provider.fallback = vim.tbl_map(with_defaults, current_config.provider.fallback)
 	return current_config
 end
 
@@ -422,6 +878,13 @@ function config.setup_highlights()
 		bold = false,
 	})
 
+	vim.api.nvim_set_hl(0, "cursortabhl_deleted_line", {
+		ctermbg = "DarkRed",
+		bg = cfg.ui.colors.deletion,
+		strikethrough = true,
+		bold = false,
+	})
+
 	vim.api.nvim_set_hl(0, "cursortabhl_addition", {
 		ctermbg = "DarkGreen",
 		bg = cfg.ui.colors.addition,
@@ -453,6 +916,10 @@ function config.setup_highlights()
 		fg = cfg.ui.jump.fg_color,
 		bold = false,
 	})
+
+	vim.api.nvim_set_hl(0, "cursortabhl_annotation", { link = "Comment", default = true })
+	vim.api.nvim_set_hl(0, "cursortabhl_placeholder", { link = "Visual", default = true })
+	vim.api.nvim_set_hl(0, "cursortabhl_dimmed", { link = "Comment", default = true })
 end
 
 return config
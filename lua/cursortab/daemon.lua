@@ -36,6 +36,55 @@ local function read_daemon_pid(pid_path)
 	return pid, is_process_running(pid)
 end
 
+-- Build the provider section of the daemon config
+---@param provider CursortabProviderConfig
+---@return table
+local function provider_json(provider)
+	-- Omitted when empty: an empty Lua table would encode as a JSON object
+	local race = nil
+	if provider.race and #provider.race > 0 then
+		race = vim.tbl_map(provider_json, provider.race)
+	end
+	local fallback = nil
+	if provider.fallback and #provider.fallback > 0 then
+		fallback = vim.tbl_map(provider_json, provider.fallback)
+	end
+	local stop_sequences = nil
+	if provider.stop_sequences and #provider.stop_sequences > 0 then
+		stop_sequences = provider.stop_sequences
+	end
+	return {
+		type = provider.type,
+		url = provider.url,
+		transport = provider.transport,
+		api_key_env = provider.api_key_env,
+		model = provider.model,
+		temperature = provider.temperature,
+		max_tokens = provider.max_tokens,
+		top_k = provider.top_k,
+		seed = provider.seed,
+		completion_timeout = provider.completion_timeout,
+		max_diff_history_tokens = provider.max_diff_history_tokens,
+		completion_path = provider.completion_path,
+		fim_tokens = provider.fim_tokens,
+		system_prompt = provider.system_prompt,
+		stop_sequences = stop_sequences,
+		privacy_mode = provider.privacy_mode,
+		eof_policy = provider.eof_policy,
+		token_budget = provider.token_budget,
+		max_requests_per_minute = provider.max_requests_per_minute,
+		max_concurrent_requests = provider.max_concurrent_requests,
+		circuit_breaker = provider.circuit_breaker,
+		context_budget = provider.context_budget,
+		max_payload_bytes = provider.max_payload_bytes,
+		context_limits = provider.context_limits,
+		tokenizer_vocab = provider.tokenizer_vocab and vim.fn.expand(provider.tokenizer_vocab),
+		options = provider.options,
+		race = race,
+		fallback = fallback,
+	}
+end
+
 -- Start the daemon process
 local function start_daemon()
 	local cfg = config.get()
@@ -73,35 +122,64 @@ local function start_daemon()
 	local json_config = vim.json.encode({
 		ns_id = ns_id,
 		log_level = cfg.log_level,
+		log_rotation = cfg.log_rotation,
 		state_dir = state_dir,
 		editor_version = string.format("%d.%d.%d", v.major, v.minor, v.patch),
 		editor_os = vim.uv.os_uname().sysname, ---@diagnostic disable-line: undefined-field
 		behavior = {
 			idle_completion_delay = cfg.behavior.idle_completion_delay,
 			text_change_debounce = cfg.behavior.text_change_debounce,
+			scan_delay = cfg.behavior.scan_delay,
+			trigger_policy = cfg.behavior.trigger_policy,
 			max_visible_lines = cfg.behavior.max_visible_lines,
+			max_completion_lines = cfg.behavior.max_completion_lines,
+			oversized_completion = cfg.behavior.oversized_completion,
+			paste_completion = cfg.behavior.paste_completion,
+			paste_delay = cfg.behavior.paste_delay,
+			sticky_lines = cfg.behavior.sticky_lines,
+			max_buffer_size = cfg.behavior.max_buffer_size,
+			display_ttl = cfg.behavior.display_ttl,
+			cache_ttl = cfg.behavior.cache_ttl,
+			cache_max_entries = cfg.behavior.cache_max_entries,
+			persistent_cache = cfg.behavior.persistent_cache,
+			quality_log = cfg.behavior.quality_log,
+			telemetry = cfg.behavior.telemetry,
+			metrics_log = cfg.behavior.metrics_log,
+			-- An empty table would encode as a JSON object
+			ignore_paths = #cfg.behavior.ignore_paths > 0 and cfg.behavior.ignore_paths or nil,
+			ignore_gitignored = cfg.behavior.ignore_gitignored,
+			root_markers = cfg.behavior.root_markers,
+			redact_secrets = cfg.behavior.redact_secrets,
+			redact_patterns = #cfg.behavior.redact_patterns > 0 and cfg.behavior.redact_patterns or nil,
+			word_diff = cfg.behavior.word_diff,
+			inline_diff = cfg.behavior.inline_diff,
+			column_unit = cfg.behavior.column_unit,
 			complete_in_insert = vim.tbl_contains(cfg.behavior.enabled_modes, "insert"),
 			complete_in_normal = vim.tbl_contains(cfg.behavior.enabled_modes, "normal"),
 			cursor_prediction = {
 				enabled = cfg.behavior.cursor_prediction.enabled,
 				auto_advance = cfg.behavior.cursor_prediction.auto_advance,
 				proximity_threshold = cfg.behavior.cursor_prediction.proximity_threshold,
+				cursor_only = cfg.behavior.cursor_prediction.cursor_only,
+				prefetch_depth = cfg.behavior.cursor_prediction.prefetch_depth,
 			},
+			staging = {
+				order = cfg.behavior.staging.order,
+			},
+			rename_propagation = {
+				enabled = cfg.behavior.rename_propagation.enabled,
+				workspace = cfg.behavior.rename_propagation.workspace,
+			},
+			test_failures = {
+				file = cfg.behavior.test_failures.file,
+				command = cfg.behavior.test_failures.command,
+			},
+			placeholders = cfg.behavior.placeholders,
+			auto_import = cfg.behavior.auto_import,
+			fix_diagnostics = cfg.behavior.fix_diagnostics,
+			open_folds = cfg.behavior.open_folds,
 		},
-		provider = {
-			type = cfg.provider.type,
-			url = cfg.provider.url,
-			api_key_env = cfg.provider.api_key_env,
-			model = cfg.provider.model,
-			temperature = cfg.provider.temperature,
-			max_tokens = cfg.provider.max_tokens,
-			top_k = cfg.provider.top_k,
-			completion_timeout = cfg.provider.completion_timeout,
-			max_diff_history_tokens = cfg.provider.max_diff_history_tokens,
-			completion_path = cfg.provider.completion_path,
-			fim_tokens = cfg.provider.fim_tokens,
-			privacy_mode = cfg.provider.privacy_mode,
-		},
+		provider = provider_json(cfg.provider),
 		debug = {
 			immediate_shutdown = cfg.debug.immediate_shutdown,
 		},
@@ -230,6 +308,166 @@ function daemon.send_event_immediate(event_name)
 	send_rpc_event(event_name)
 end
 
+-- Send a change to an open buffer: lines first to last (0-indexed, end
+-- exclusive) were replaced with lines, or the whole content when last is -1
+---@param path string
+---@param first integer
+---@param last integer
+---@param lines string[]
+---@param tick integer b:changedtick once the change was made
+---@param time_ms integer|nil Unix epoch milliseconds when the change was made
+---@param paste boolean|nil The change was made by vim.paste
+function daemon.send_buffer_lines(path, first, last, lines, tick, time_ms, paste)
+	if chan and chan > 0 then
+		pcall(vim.fn.rpcnotify, chan, "cursortab_buffer_lines", path, first, last, lines, tick, time_ms or 0, paste or false)
+	end
+end
+
+-- Tell the daemon an open buffer was closed
+---@param path string
+function daemon.send_buffer_closed(path)
+	if chan and chan > 0 then
+		pcall(vim.fn.rpcnotify, chan, "cursortab_buffer_closed", path)
+	end
+end
+
+-- Save the session (edit history, recent files and actions) before exiting,
+-- waiting for the daemon so it is written before Neovim goes away
+function daemon.save_session()
+	if chan and chan > 0 then
+		pcall(vim.fn.rpcrequest, chan, "cursortab_save_session")
+	end
+end
+
+-- Call a daemon RPC that returns a workspace trust status
+---@param method string
+---@return string|nil status
+---@return string|nil error
+local function trust_request(method)
+	if not chan or chan <= 0 then
+		return nil, "daemon not connected"
+	end
+	local ok, result = pcall(vim.fn.rpcrequest, chan, method)
+	if not ok then
+		return nil, tostring(result)
+	end
+	return result, nil
+end
+
+-- Persist trust for the daemon's workspace
+---@return string|nil status "trusted" or "not_required"
+---@return string|nil error
+function daemon.trust_workspace()
+	return trust_request("cursortab_trust")
+end
+
+-- Get the daemon's workspace trust status
+---@return string|nil status "trusted", "untrusted" or "not_required"
+---@return string|nil error
+function daemon.get_trust_status()
+	return trust_request("cursortab_trust_status")
+end
+
+-- Get the name of the provider currently serving completions
+---@return string|nil name
+---@return string|nil error
+function daemon.get_active_provider()
+	if not chan or chan <= 0 then
+		return nil, "daemon not connected"
+	end
+	local ok, result = pcall(vim.fn.rpcrequest, chan, "cursortab_active_provider")
+	if not ok then
+		return nil, tostring(result)
+	end
+	return result, nil
+end
+
+-- Get what the accept key will do, as a CursortabProgress table
+---@return table|nil progress
+---@return string|nil error
+function daemon.get_progress()
+	if not chan or chan <= 0 then
+		return nil, "daemon not connected"
+	end
+	local ok, result = pcall(vim.fn.rpcrequest, chan, "cursortab_progress")
+	if not ok then
+		return nil, tostring(result)
+	end
+	return vim.json.decode(result), nil
+end
+
+-- Get the completion statistics of this daemon session
+---@return table|nil stats
+---@return string|nil error
+function daemon.get_stats()
+	if not chan or chan <= 0 then
+		return nil, "daemon not connected"
+	end
+	local ok, result = pcall(vim.fn.rpcrequest, chan, "cursortab_stats")
+	if not ok then
+		return nil, tostring(result)
+	end
+	return vim.json.decode(result), nil
+end
+
+-- Get the pending stages of the shown completion, current stage first
+---@return table[]|nil stages
+---@return string|nil error
+function daemon.get_preview()
+	if not chan or chan <= 0 then
+		return nil, "daemon not connected"
+	end
+	local ok, result = pcall(vim.fn.rpcrequest, chan, "cursortab_preview")
+	if not ok then
+		return nil, tostring(result)
+	end
+	return vim.json.decode(result), nil
+end
+
+-- Get the pending stages of the shown completion as a unified diff
+---@return string|nil diff Empty when no completion is shown
+---@return string|nil error
+function daemon.get_diff()
+	if not chan or chan <= 0 then
+		return nil, "daemon not connected"
+	end
+	local ok, result = pcall(vim.fn.rpcrequest, chan, "cursortab_diff")
+	if not ok then
+		return nil, tostring(result)
+	end
+	return result, nil
+end
+
+-- Summarize the quality log
+---@param query table { since, provider, limit }
+---@return table|nil report
+---@return string|nil error
+function daemon.get_quality_report(query)
+	if not chan or chan <= 0 then
+		return nil, "daemon not connected"
+	end
+	local ok, result = pcall(vim.fn.rpcrequest, chan, "cursortab_quality", vim.json.encode(query))
+	if not ok then
+		return nil, tostring(result)
+	end
+	return vim.json.decode(result), nil
+end
+
+-- Re-stage the last shown completion under alternative staging options
+---@param options table[] List of { proximity_threshold, max_visible_lines, similarity }
+---@return table[]|nil layouts
+---@return string|nil error
+function daemon.tune_staging(options)
+	if not chan or chan <= 0 then
+		return nil, "daemon not connected"
+	end
+	local ok, result = pcall(vim.fn.rpcrequest, chan, "cursortab_tune_staging", vim.json.encode(options))
+	if not ok then
+		return nil, tostring(result)
+	end
+	return vim.json.decode(result), nil
+end
+
 -- Check daemon process status
 function daemon.check_daemon_status()
 	local cfg = config.get()
@@ -3,6 +3,7 @@
 local buffer = require("cursortab.buffer")
 local config = require("cursortab.config")
 local daemon = require("cursortab.daemon")
+local placeholders = require("cursortab.placeholders")
 local ui = require("cursortab.ui")
 
 ---@class EventsModule
@@ -12,7 +13,11 @@ local events = {}
 ---@param mode string "insert" or "normal"
 ---@return boolean
 local function is_mode_enabled(mode)
-	local modes = config.get().behavior.enabled_modes
+	local behavior = config.get().behavior
+	if mode == "normal" and behavior.trigger_policy == "normal_mode_too" then
+		return true
+	end
+	local modes = behavior.enabled_modes
 	for _, m in ipairs(modes) do
 		if m == mode then
 			return true
@@ -25,8 +30,17 @@ end
 local autocommands_setup_done = false
 
 -- Track currently bound keys so we can clean them up on re-setup
----@type {accept: string|nil, partial_accept: string|nil, trigger: string|nil}
-local current_keymaps = { accept = nil, partial_accept = nil, trigger = nil }
+---@type {accept: string|nil, partial_accept: string|nil, partial_accept_line: string|nil, accept_in_place: string|nil, reject_stage: string|nil, next_suggestion: string|nil, prev_suggestion: string|nil, trigger: string|nil}
+local current_keymaps = {
+	accept = nil,
+	partial_accept = nil,
+	partial_accept_line = nil,
+	accept_in_place = nil,
+	reject_stage = nil,
+	next_suggestion = nil,
+	prev_suggestion = nil,
+	trigger = nil,
+}
 
 -- Skip exactly one TextChanged after accepting a completion
 ---@type boolean
@@ -58,6 +72,8 @@ local function on_accept()
 		end
 		daemon.send_event("accept")
 		return ""
+	elseif placeholders.jump(1) then
+		return ""
 	else
 		return "\t"
 	end
@@ -70,25 +86,123 @@ local function on_escape()
 	return "\27"
 end
 
--- Partial accept handler (Shift-Tab by default)
+-- Partially accept the shown completion
+---@param event string "partial_accept_word" or "partial_accept_line"
+---@return boolean accepted
+local function partial_accept(event)
+	if not ui.has_completion() then
+		return false
+	end
+	-- Suppress the immediate text change and cursor movement caused by partial accept
+	skip_next_text_changed = true
+	skip_next_cursor_moved = true
+	daemon.send_event(event)
+	return true
+end
+
+-- Partial accept handler (Shift-Tab by default): accepts the next word, or
+-- moves back to the previous placeholder of an accepted completion
 ---@return string
 local function on_partial_accept()
-	if ui.has_completion() then
-		-- Suppress the immediate text change and cursor movement caused by partial accept
-		skip_next_text_changed = true
-		skip_next_cursor_moved = true
-		daemon.send_event("partial_accept")
+	if partial_accept("partial_accept_word") or placeholders.jump(-1) then
+		return ""
+	end
+	-- Pass through configured key
+	local cfg = config.get()
+	return vim.api.nvim_replace_termcodes(cfg.keymaps.partial_accept, true, true, true)
+end
+
+-- Line partial accept handler: accepts the rest of the suggested line
+---@return string
+local function on_partial_accept_line()
+	if partial_accept("partial_accept_line") then
+		return ""
+	end
+	-- Pass through configured key
+	local cfg = config.get()
+	return vim.api.nvim_replace_termcodes(cfg.keymaps.partial_accept_line, true, true, true)
+end
+
+-- Apply the shown or targeted stage without moving the cursor
+---@return boolean accepted
+local function accept_in_place()
+	if not (ui.has_cursor_prediction() or ui.has_completion()) then
+		return false
+	end
+	-- Suppress the text change and any cursor shift caused by applying the stage
+	skip_next_text_changed = true
+	skip_next_cursor_moved = true
+	daemon.send_event("accept_in_place")
+	return true
+end
+
+-- Accept-in-place key handler
+---@return string
+local function on_accept_in_place()
+	if accept_in_place() then
+		return ""
+	end
+	-- Pass through configured key
+	local cfg = config.get()
+	return vim.api.nvim_replace_termcodes(cfg.keymaps.accept_in_place, true, true, true)
+end
+
+-- Skip the shown or targeted stage and move on to the next one
+---@return boolean rejected
+local function reject_stage()
+	if not (ui.has_cursor_prediction() or ui.has_completion()) then
+		return false
+	end
+	daemon.send_event("reject_stage")
+	return true
+end
+
+-- Reject-stage key handler
+---@return string
+local function on_reject_stage()
+	if reject_stage() then
+		return ""
+	end
+	-- Pass through configured key
+	local cfg = config.get()
+	return vim.api.nvim_replace_termcodes(cfg.keymaps.reject_stage, true, true, true)
+end
+
+-- Show another candidate of the shown completion
+---@param event string "next_suggestion" or "prev_suggestion"
+---@return boolean cycled
+local function cycle_suggestion(event)
+	if not ui.has_completion() then
+		return false
+	end
+	daemon.send_event(event)
+	return true
+end
+
+-- Next/previous suggestion key handlers
+---@return string
+local function on_next_suggestion()
+	if cycle_suggestion("next_suggestion") then
+		return ""
+	end
+	-- Pass through configured key
+	local cfg = config.get()
+	return vim.api.nvim_replace_termcodes(cfg.keymaps.next_suggestion, true, true, true)
+end
+
+---@return string
+local function on_prev_suggestion()
+	if cycle_suggestion("prev_suggestion") then
 		return ""
-	else
-		-- Pass through configured key
-		local cfg = config.get()
-		return vim.api.nvim_replace_termcodes(cfg.keymaps.partial_accept, true, true, true)
 	end
+	-- Pass through configured key
+	local cfg = config.get()
+	return vim.api.nvim_replace_termcodes(cfg.keymaps.prev_suggestion, true, true, true)
 end
 
 -- Manual trigger handler
 local function on_trigger()
-	daemon.send_event_immediate("trigger_completion")
+	daemon.send_event_immediate("manual_trigger")
 end
 
 -- Update a single keymap slot: clear old binding if changed, set new one
@@ -113,6 +227,11 @@ local function setup_keymaps()
 
 	update_keymap("accept", cfg.keymaps.accept, on_accept, expr_opts)
 	update_keymap("partial_accept", cfg.keymaps.partial_accept, on_partial_accept, expr_opts)
+	update_keymap("partial_accept_line", cfg.keymaps.partial_accept_line, on_partial_accept_line, expr_opts)
+	update_keymap("accept_in_place", cfg.keymaps.accept_in_place, on_accept_in_place, expr_opts)
+	update_keymap("reject_stage", cfg.keymaps.reject_stage, on_reject_stage, expr_opts)
+	update_keymap("next_suggestion", cfg.keymaps.next_suggestion, on_next_suggestion, expr_opts)
+	update_keymap("prev_suggestion", cfg.keymaps.prev_suggestion, on_prev_suggestion, expr_opts)
 	update_keymap("trigger", cfg.keymaps.trigger, on_trigger, plain_opts)
 
 	vim.keymap.set("n", "<Esc>", on_escape, expr_opts)
@@ -193,6 +312,10 @@ local function setup_autocommands()
 		if awaiting_completion_after_jump then
 			return true
 		end
+		-- Sticky completions stay shown in normal mode until the daemon rejects them
+		if not is_insert and ui.has_completion() and config.get().behavior.sticky_lines > 0 then
+			return false
+		end
 		if ui.has_cursor_prediction() or ui.has_completion() then
 			ui.ensure_close_all()
 		end
@@ -212,6 +335,17 @@ local function setup_autocommands()
 		end,
 	})
 
+	-- Scrolling the current window can move a jump target into or out of view;
+	-- the daemon re-renders the indicator only when that happens
+	vim.api.nvim_create_autocmd({ "WinScrolled" }, {
+		callback = function(args)
+			if tonumber(args.match) ~= vim.api.nvim_get_current_win() or not ui.has_cursor_prediction() then
+				return
+			end
+			daemon.send_event("scrolled")
+		end,
+	})
+
 	-- Cursor movement events (insert mode - e.g., arrow keys)
 	vim.api.nvim_create_autocmd({ "CursorMovedI" }, {
 		callback = function()
@@ -267,6 +401,12 @@ local function setup_autocommands()
 			daemon.send_reject()
 		end,
 	})
+
+	if config.get().behavior.persistent_cache then
+		vim.api.nvim_create_autocmd("VimLeavePre", {
+			callback = daemon.save_session,
+		})
+	end
 end
 
 -- Set up all autocommands and keymaps
@@ -293,4 +433,46 @@ function events.accept()
 	return on_accept() == ""
 end
 
+---Apply the current completion, or the stage a jump indicator points to,
+---without moving the cursor.
+---@return boolean accepted
+function events.accept_in_place()
+	return accept_in_place()
+end
+
+---Accept the next word of the current completion.
+---@return boolean accepted
+function events.partial_accept_word()
+	return partial_accept("partial_accept_word")
+end
+
+---Accept the rest of the current suggested line.
+---@return boolean accepted
+function events.partial_accept_line()
+	return partial_accept("partial_accept_line")
+end
+
+---Show the next candidate of the current completion.
+---@return boolean cycled
+function events.next_suggestion()
+	return cycle_suggestion("next_suggestion")
+end
+
+---Show the previous candidate of the current completion.
+---@return boolean cycled
+function events.prev_suggestion()
+	return cycle_suggestion("prev_suggestion")
+end
+
+---Request a completion at the cursor, whatever the trigger policy and enabled modes.
+function events.trigger()
+	on_trigger()
+end
+
+---Skip the current stage of a staged completion and show the next one.
+---@return boolean rejected
+function events.reject_stage()
+	return reject_stage()
+end
+
 return events
@@ -28,11 +28,55 @@ function M.check()
 	vim.health.info("api_key_env: " .. (cfg.provider.api_key_env ~= "" and cfg.provider.api_key_env or "-"))
 	vim.health.info("timeout: " .. cfg.provider.completion_timeout .. "ms")
 	vim.health.info("max_tokens: " .. cfg.provider.max_tokens)
+	if cfg.provider.tokenizer_vocab ~= "" then
+		if vim.fn.filereadable(vim.fn.expand(cfg.provider.tokenizer_vocab)) == 1 then
+			vim.health.info("tokenizer_vocab: " .. cfg.provider.tokenizer_vocab)
+		else
+			vim.health.error("tokenizer_vocab not readable: " .. cfg.provider.tokenizer_vocab)
+		end
+	end
+	local limits = cfg.provider.context_limits
+	if limits.max_input_lines ~= 0 or limits.max_input_bytes ~= 0 or limits.max_output_tokens ~= 0 then
+		vim.health.info(
+			string.format(
+				"context_limits: input %d lines, %d bytes, output %d tokens (0 = provider default)",
+				limits.max_input_lines,
+				limits.max_input_bytes,
+				limits.max_output_tokens
+			)
+		)
+	end
 	vim.health.info("temperature: " .. cfg.provider.temperature)
 	vim.health.info("top_k: " .. cfg.provider.top_k)
+	if cfg.provider.seed ~= 0 then
+		vim.health.info("seed: " .. cfg.provider.seed)
+	end
+	if not vim.tbl_isempty(cfg.provider.options) then
+		local keys = vim.tbl_keys(cfg.provider.options)
+		table.sort(keys)
+		vim.health.info("options: " .. table.concat(keys, ", "))
+	end
 	vim.health.info("max_diff_history_tokens: " .. cfg.provider.max_diff_history_tokens)
 	vim.health.info("completion_path: " .. cfg.provider.completion_path)
 	vim.health.info("privacy_mode: " .. (cfg.provider.privacy_mode and "yes" or "no"))
+	if #cfg.provider.fallback > 0 then
+		local chain = { cfg.provider.type }
+		for _, fallback in ipairs(cfg.provider.fallback) do
+			table.insert(chain, fallback.type)
+		end
+		vim.health.info("failover chain: " .. table.concat(chain, " -> "))
+		local active = daemon.get_active_provider()
+		if active then
+			vim.health.info("active provider: " .. active)
+		end
+	end
+
+	local trust = daemon.get_trust_status()
+	if trust == "untrusted" then
+		vim.health.warn("Workspace is untrusted: hosted provider disabled", { "Run :CursortabTrust to allow it" })
+	elseif trust then
+		vim.health.info("workspace trust: " .. trust)
+	end
 
 	if cfg.provider.api_key_env ~= "" then
 		local key = vim.fn.getenv(cfg.provider.api_key_env)
@@ -49,19 +93,68 @@ function M.check()
 	-- Behavior
 	vim.health.start("Behavior")
 	vim.health.info("idle_delay: " .. cfg.behavior.idle_completion_delay .. "ms")
+	vim.health.info("scan_delay: " .. cfg.behavior.scan_delay .. "ms")
 	vim.health.info("debounce: " .. cfg.behavior.text_change_debounce .. "ms")
+	vim.health.info("trigger_policy: " .. cfg.behavior.trigger_policy)
 	vim.health.info("max_visible_lines: " .. cfg.behavior.max_visible_lines)
+	vim.health.info(
+		"max_completion_lines: " .. cfg.behavior.max_completion_lines .. " (" .. cfg.behavior.oversized_completion .. ")"
+	)
+	local paste = cfg.behavior.paste_completion
+	if paste == "delay" then
+		paste = paste .. " " .. cfg.behavior.paste_delay .. "ms"
+	end
+	vim.health.info("paste_completion: " .. paste)
+	vim.health.info("sticky_lines: " .. cfg.behavior.sticky_lines)
+	vim.health.info("max_buffer_size: " .. cfg.behavior.max_buffer_size .. "KB")
+	vim.health.info("cache: " .. cfg.behavior.cache_max_entries .. " entries, " .. cfg.behavior.cache_ttl .. "ms")
+	vim.health.info("persistent_cache: " .. (cfg.behavior.persistent_cache and "yes" or "no"))
+	vim.health.info("quality_log: " .. (cfg.behavior.quality_log and "yes" or "no"))
+	vim.health.info("telemetry: " .. (cfg.behavior.telemetry and "yes" or "no"))
+	vim.health.info("metrics_log: " .. (cfg.behavior.metrics_log and "yes" or "no"))
 	vim.health.info("cursor_prediction: " .. (cfg.behavior.cursor_prediction.enabled and "yes" or "no"))
 	vim.health.info("auto_advance: " .. (cfg.behavior.cursor_prediction.auto_advance and "yes" or "no"))
 	vim.health.info("proximity_threshold: " .. cfg.behavior.cursor_prediction.proximity_threshold)
+	vim.health.info("cursor_only: " .. (cfg.behavior.cursor_prediction.cursor_only and "yes" or "no"))
+	vim.health.info("prefetch_depth: " .. cfg.behavior.cursor_prediction.prefetch_depth)
+	vim.health.info("staging.order: " .. cfg.behavior.staging.order)
+	vim.health.info("rename_propagation: " .. (cfg.behavior.rename_propagation.enabled and "yes" or "no"))
+	vim.health.info("rename_propagation.workspace: " .. (cfg.behavior.rename_propagation.workspace and "yes" or "no"))
+	local test_failures = cfg.behavior.test_failures
+	if test_failures.command ~= "" then
+		vim.health.info("test_failures: " .. test_failures.command)
+	elseif test_failures.file ~= "" then
+		vim.health.info("test_failures: " .. test_failures.file)
+	else
+		vim.health.info("test_failures: no")
+	end
+	vim.health.info("placeholders: " .. (cfg.behavior.placeholders and "yes" or "no"))
+	vim.health.info("auto_import: " .. (cfg.behavior.auto_import and "yes" or "no"))
+	vim.health.info("fix_diagnostics: " .. (cfg.behavior.fix_diagnostics and "yes" or "no"))
+	vim.health.info("open_folds: " .. (cfg.behavior.open_folds and "yes" or "no"))
 	vim.health.info("enabled_modes: " .. table.concat(cfg.behavior.enabled_modes, ", "))
 	vim.health.info("ignore_paths: " .. #cfg.behavior.ignore_paths .. " patterns")
 	vim.health.info("ignore_gitignored: " .. (cfg.behavior.ignore_gitignored and "yes" or "no"))
+	vim.health.info("root_markers: " .. table.concat(cfg.behavior.root_markers, ", "))
+	vim.health.info(
+		"redact_secrets: "
+			.. (cfg.behavior.redact_secrets and "yes" or "no")
+			.. " ("
+			.. #cfg.behavior.redact_patterns
+			.. " extra patterns)"
+	)
+	vim.health.info("word_diff: " .. (cfg.behavior.word_diff and "yes" or "no"))
+	vim.health.info("inline_diff: " .. (cfg.behavior.inline_diff and "yes" or "no"))
+	vim.health.info("column_unit: " .. cfg.behavior.column_unit)
 
 	-- Keymaps
 	vim.health.start("Keymaps")
 	vim.health.info("accept: " .. (cfg.keymaps.accept or "disabled"))
 	vim.health.info("partial_accept: " .. (cfg.keymaps.partial_accept or "disabled"))
+	vim.health.info("partial_accept_line: " .. (cfg.keymaps.partial_accept_line or "disabled"))
+	vim.health.info("reject_stage: " .. (cfg.keymaps.reject_stage or "disabled"))
+	vim.health.info("next_suggestion: " .. (cfg.keymaps.next_suggestion or "disabled"))
+	vim.health.info("prev_suggestion: " .. (cfg.keymaps.prev_suggestion or "disabled"))
 	vim.health.info("trigger: " .. (cfg.keymaps.trigger or "disabled"))
 
 	-- Blink
@@ -73,6 +166,14 @@ function M.check()
 	vim.health.start("Paths")
 	vim.health.info("state_dir: " .. cfg.state_dir)
 	vim.health.info("log_level: " .. cfg.log_level)
+	vim.health.info(
+		string.format(
+			"log_rotation: max_size_mb = %d, max_files = %d, max_age_days = %d",
+			cfg.log_rotation.max_size_mb,
+			cfg.log_rotation.max_files,
+			cfg.log_rotation.max_age_days
+		)
+	)
 end
 
 return M
@@ -1,13 +1,57 @@
 -- Main entry point for cursortab.nvim
 -- Import all modules
+local buffers = require("cursortab.buffers")
 local config = require("cursortab.config")
 local daemon = require("cursortab.daemon")
 local events = require("cursortab.events")
+local placeholders = require("cursortab.placeholders")
 local ui = require("cursortab.ui")
 
 ---@class CursortabModule
 local M = {}
 
+-- Provider serving completions, as last reported by the daemon
+local active_provider = nil
+
+-- What the accept key will do, as last reported by the daemon
+---@class CursortabProgress
+---@field action string "accept", "jump" or "none"
+---@field stage integer Current stage, 1-indexed (0 without a completion)
+---@field stages integer Stages in the completion (0 without a completion)
+---@field lines_remaining integer Lines in the current and later stages
+---@field provider string Provider serving completions
+---@field degraded boolean The provider keeps failing and automatic requests are paused
+---@field offline boolean The provider is unreachable and idle completions are paused
+local progress = nil
+
+-- Completion that could not be applied, as reported by the daemon
+---@class CursortabApplyFailure
+---@field trace_id string ID of the failure in the log
+---@field reason string What went wrong
+---@field file_path string? File the completion was applied to
+---@field start_line integer? First line the completion replaces (1-indexed)
+---@field end_line integer? Last line the completion replaces (1-indexed)
+---@field stage integer? Stage that failed (1-indexed)
+---@field stages integer? Stages in the completion
+---@field rolled_back boolean The buffer was restored to its content before the apply
+
+-- Engine event reported by the daemon; fields that do not apply are nil
+---@class CursortabEvent
+---@field event string "completion_shown", "completion_accepted", "completion_rejected", "completion_ignored", "stage_advanced", "cursor_target_shown", "prefetch_ready", "provider_degraded", "provider_recovered", "offline" or "online"
+---@field file_path string|nil
+---@field line integer|nil 1-indexed first line of the stage or target
+---@field lines integer|nil New lines of the stage or prefetched completion
+---@field stage integer|nil Current stage, 1-indexed
+---@field stages integer|nil Stages in the completion
+---@field cursor_only boolean|nil The outcome is for a jump without an edit
+---@field provider string|nil
+---@field model string|nil
+
+-- Callbacks registered with M.subscribe, by id
+---@type table<integer, { event: string, callback: fun(ev: CursortabEvent) }>
+local subscribers = {}
+local next_subscriber = 1
+
 -- RPC callback functions (called from Go daemon)
 -- These must remain globally accessible for the RPC interface
 
@@ -18,12 +62,56 @@ function M.on_reject()
 	ui.close_all()
 end
 
----Accept current completion/prediction if available.
+---Accept current completion/prediction if available, or move to the next
+---placeholder of the completion accepted last.
 ---@return boolean accepted
 function M.accept()
 	return events.accept()
 end
 
+---Apply current completion, or the stage a jump indicator points to, without
+---moving the cursor.
+---@return boolean accepted
+function M.accept_in_place()
+	return events.accept_in_place()
+end
+
+---Accept the next word of the current completion.
+---@return boolean accepted
+function M.partial_accept_word()
+	return events.partial_accept_word()
+end
+
+---Accept the rest of the current suggested line.
+---@return boolean accepted
+function M.partial_accept_line()
+	return events.partial_accept_line()
+end
+
+---Show the next alternative the provider returned for the current completion.
+---@return boolean cycled
+function M.next_suggestion()
+	return events.next_suggestion()
+end
+
+---Show the previous alternative the provider returned for the current completion.
+---@return boolean cycled
+function M.prev_suggestion()
+	return events.prev_suggestion()
+end
+
+---Skip the current stage of a staged completion, or the stage a jump indicator
+---points to, and show the next one. The last stage rejects the completion.
+---@return boolean rejected
+function M.reject_stage()
+	return events.reject_stage()
+end
+
+---Request a completion at the cursor, whatever the trigger policy and enabled modes.
+function M.trigger()
+	events.trigger()
+end
+
 ---RPC callback: called when completion is ready
 ---@param diff_result DiffResult Completion diff result from Go daemon
 function M.on_completion_ready(diff_result)
@@ -32,14 +120,146 @@ function M.on_completion_ready(diff_result)
 	ui.show_completion(diff_result)
 end
 
+---RPC callback: called for each stage of a streaming completion as soon as it is final
+---@param diff_result StreamedStage Stage diff result from Go daemon
+function M.on_stage_streamed(diff_result)
+	if not diff_result.shown and config.get().ui.show_streamed_stages then
+		ui.show_streamed_stage(diff_result)
+	end
+	vim.schedule(function()
+		vim.api.nvim_exec_autocmds("User", { pattern = "CursortabStageStreamed", data = diff_result })
+	end)
+end
+
+---RPC callback: called when the cursor moves off a sticky completion, or back onto it
+---@param dimmed boolean
+function M.on_completion_dimmed(dimmed)
+	ui.set_dimmed(dimmed)
+end
+
 ---RPC callback: called when cursor prediction is ready
 ---@param line_num integer Predicted line number (1-indexed)
 function M.on_cursor_prediction_ready(line_num)
 	ui.show_cursor_prediction(line_num)
 end
 
+---RPC callback: called with the placeholders of an accepted completion
+---@param list Placeholder[]
+function M.on_placeholders_ready(list)
+	placeholders.set(list)
+end
+
+---RPC callback: called when the next stage of a multi-file completion is in another file
+---@param path string Workspace-relative file path
+---@param line_num integer Target line in that file (1-indexed)
+---@param summary MultiFileSummary Overview of every file the completion edits
+function M.on_file_target_ready(path, line_num, summary)
+	ui.show_file_target(path, line_num, summary)
+end
+
+---RPC callback: called when a hosted provider is blocked in an untrusted workspace
+---@param workspace string Workspace path
+function M.on_untrusted(workspace)
+	vim.schedule(function()
+		vim.notify(
+			"Cursortab: completions are disabled in untrusted workspace "
+				.. workspace
+				.. ". The configured provider sends code to a hosted service; run :CursortabTrust to allow it.",
+			vim.log.levels.WARN
+		)
+	end)
+end
+
+---RPC callback: called when applying a completion failed and the buffer was restored
+---@param failure_json string JSON-encoded CursortabApplyFailure
+function M.on_apply_failed(failure_json)
+	local ok, failure = pcall(vim.json.decode, failure_json)
+	if not ok then
+		return
+	end
+	vim.schedule(function()
+		local where = ""
+		if failure.stage then
+			where = string.format(" at stage %d/%d", failure.stage, failure.stages)
+		end
+		local outcome = failure.rolled_back and "was rolled back" or "could not be rolled back"
+		vim.notify(
+			string.format(
+				"Cursortab: applying the completion%s failed and %s (%s): %s",
+				where,
+				outcome,
+				failure.trace_id,
+				failure.reason
+			),
+			vim.log.levels.ERROR
+		)
+		vim.api.nvim_exec_autocmds("User", { pattern = "CursortabApplyFailed", data = failure })
+	end)
+end
+
+---RPC callback: called when a failover chain switches to another provider
+---@param name string Provider type now serving completions
+function M.on_provider_changed(name)
+	active_provider = name
+	vim.schedule(function()
+		vim.notify("Cursortab: completions now served by " .. name, vim.log.levels.INFO)
+		vim.cmd.redrawstatus()
+	end)
+end
+
+---RPC callback: called when what the accept key will do changes
+---@param progress_json string JSON-encoded CursortabProgress
+function M.on_progress(progress_json)
+	local ok, decoded = pcall(vim.json.decode, progress_json)
+	if not ok then
+		return
+	end
+	progress = decoded
+	vim.schedule(function()
+		vim.api.nvim_exec_autocmds("User", { pattern = "CursortabProgress", data = decoded })
+		vim.cmd.redrawstatus()
+	end)
+end
+
+---RPC callback: called for every engine event
+---@param event_json string JSON-encoded CursortabEvent
+function M.on_event(event_json)
+	local ok, decoded = pcall(vim.json.decode, event_json)
+	if not ok then
+		return
+	end
+	vim.schedule(function()
+		for _, sub in pairs(subscribers) do
+			if sub.event == "*" or sub.event == decoded.event then
+				local cb_ok, err = pcall(sub.callback, decoded)
+				if not cb_ok then
+					vim.notify("Cursortab: event subscriber failed: " .. tostring(err), vim.log.levels.WARN)
+				end
+			end
+		end
+		-- completion_shown -> CursortabCompletionShown
+		local pattern = "Cursortab" .. (decoded.event:gsub("_?(%l)(%w*)", function(first, rest)
+			return first:upper() .. rest
+		end))
+		vim.api.nvim_exec_autocmds("User", { pattern = pattern, data = decoded })
+	end)
+end
+
 -- Public API functions for users
 
+---Call callback on every engine event named event ("*" for all of them)
+---@param event string Event name, such as "completion_shown"
+---@param callback fun(ev: CursortabEvent)
+---@return fun() unsubscribe
+function M.subscribe(event, callback)
+	local id = next_subscriber
+	next_subscriber = next_subscriber + 1
+	subscribers[id] = { event = event, callback = callback }
+	return function()
+		subscribers[id] = nil
+	end
+end
+
 ---Toggle cursortab functionality on/off
 function M.toggle()
 	local enabled = not daemon.is_enabled()
@@ -95,17 +315,346 @@ function M.clear_log()
 	vim.notify("Cursortab log cleared", vim.log.levels.INFO)
 end
 
+---Override for the current buffer whether it gets completions: "enable" even
+---if it is a special, unmodifiable or large buffer, "disable" always, or
+---"auto" to decide from its options again. Without a mode, report the override.
+---@param mode string|nil
+function M.buffer(mode)
+	if mode == nil or mode == "" then
+		local override = vim.b.cursortab_override or "auto"
+		vim.notify("Cursortab: completions for this buffer: " .. override, vim.log.levels.INFO)
+		return
+	end
+	if mode ~= "enable" and mode ~= "disable" and mode ~= "auto" then
+		vim.notify("Cursortab: expected enable, disable or auto, got " .. mode, vim.log.levels.ERROR)
+		return
+	end
+	vim.b.cursortab_override = mode ~= "auto" and mode or nil
+	if mode == "disable" then
+		events.clear_all_completions()
+	end
+	vim.notify("Cursortab: completions for this buffer: " .. mode, vim.log.levels.INFO)
+end
+
 ---Show cursortab status via checkhealth
 function M.status()
 	vim.cmd("checkhealth cursortab")
 end
 
+---Name of the provider serving completions, for use in a statusline
+---@return string
+function M.active_provider()
+	return active_provider or config.get().provider.type
+end
+
+---What the accept key will do and how much of a staged completion is left,
+---for use in a statusline. Cheap: returns the last state pushed by the daemon.
+---@return CursortabProgress
+function M.progress()
+	return progress or {
+		action = "none",
+		stage = 0,
+		stages = 0,
+		lines_remaining = 0,
+		provider = M.active_provider(),
+		degraded = false,
+		offline = false,
+	}
+end
+
+---Trust the current workspace, allowing hosted providers to receive its content
+function M.trust()
+	local status, err = daemon.trust_workspace()
+	if not status then
+		vim.notify("Failed to trust workspace: " .. err, vim.log.levels.ERROR)
+	elseif status == "not_required" then
+		vim.notify("Cursortab: the configured provider is local, no trust needed", vim.log.levels.INFO)
+	else
+		vim.notify("Cursortab: workspace trusted", vim.log.levels.INFO)
+	end
+end
+
+---Preview how the last shown completion stages under alternative settings
+---@param thresholds integer[] Proximity thresholds to try (defaults to a small sweep)
+function M.tune(thresholds)
+	local cfg = config.get()
+	if #thresholds == 0 then
+		thresholds = { 1, 2, 3, 5, 8 }
+	end
+
+	local options = {}
+	for _, threshold in ipairs(thresholds) do
+		for _, similarity in ipairs({ 0.2, 0.3, 0.5 }) do
+			table.insert(options, {
+				proximity_threshold = threshold,
+				max_visible_lines = cfg.behavior.max_visible_lines,
+				similarity = similarity,
+			})
+		end
+	end
+
+	local layouts, err = daemon.tune_staging(options)
+	if not layouts then
+		vim.notify("Cursortab: tuning failed: " .. err, vim.log.levels.WARN)
+		return
+	end
+
+	local lines = {
+		string.format(
+			"Current: proximity_threshold = %d, max_visible_lines = %d",
+			cfg.behavior.cursor_prediction.proximity_threshold,
+			cfg.behavior.max_visible_lines
+		),
+		"",
+	}
+	for _, layout in ipairs(layouts) do
+		local spans = {}
+		for _, stage in ipairs(layout.stages) do
+			table.insert(spans, string.format("%d-%d (%d changes)", stage.buffer_start, stage.buffer_end, stage.changes))
+		end
+		table.insert(
+			lines,
+			string.format(
+				"proximity=%d similarity=%.2f: %d stage(s)%s  %s",
+				layout.option.proximity_threshold,
+				layout.option.similarity,
+				#layout.stages,
+				layout.first_needs_navigation and " [jump]" or "",
+				table.concat(spans, ", ")
+			)
+		)
+	end
+
+	ui.create_scratch_window("Cursortab Tune", lines, {})
+end
+
+---Pending stages of the shown completion, current stage first, or nil when the
+---daemon is not connected. Each stage is { file_path, buffer_start, buffer_end,
+---old_lines, lines, groups, current }; groups are { type, buffer_line, lines }.
+---@return table[]|nil
+function M.get_preview()
+	local stages = daemon.get_preview()
+	return stages
+end
+
+---List the pending stages of the shown completion in the quickfix window
+function M.preview()
+	local stages, err = daemon.get_preview()
+	if not stages then
+		vim.notify("Cursortab: preview failed: " .. err, vim.log.levels.WARN)
+		return
+	end
+	if #stages == 0 then
+		vim.notify("Cursortab: no completion shown", vim.log.levels.INFO)
+		return
+	end
+
+	local items = {}
+	for _, stage in ipairs(stages) do
+		local added, removed = #stage.lines, #stage.old_lines
+		local first = stage.lines[1] or stage.old_lines[1] or ""
+		table.insert(items, {
+			filename = stage.file_path,
+			lnum = stage.buffer_start,
+			end_lnum = stage.buffer_end,
+			text = string.format("%s+%d/-%d %s", stage.current and "[current] " or "", added, removed, vim.trim(first)),
+		})
+	end
+	vim.fn.setqflist({}, " ", { title = "Cursortab pending edits", items = items })
+	vim.cmd("copen")
+end
+
+---Pending stages of the shown completion as a unified diff, "" when none is
+---shown, or nil when the daemon is not connected
+---@return string|nil
+function M.get_diff()
+	local diff = daemon.get_diff()
+	return diff
+end
+
+---Show the pending stages of the shown completion as a unified diff, and yank
+---it to the unnamed register
+function M.diff()
+	local diff, err = daemon.get_diff()
+	if not diff then
+		vim.notify("Cursortab: diff failed: " .. err, vim.log.levels.WARN)
+		return
+	end
+	if diff == "" then
+		vim.notify("Cursortab: no completion shown", vim.log.levels.INFO)
+		return
+	end
+
+	vim.fn.setreg('"', diff)
+	ui.create_scratch_window("Cursortab Diff", vim.split(diff, "\n", { trimempty = true }), { filetype = "diff" })
+end
+
+---Completion statistics of the running daemon, or nil when it is not connected
+---@return table|nil
+function M.get_stats()
+	local stats = daemon.get_stats()
+	return stats
+end
+
+---Show completion outcomes, tokens sent and latency per provider, and outcomes per model for this session
+function M.stats()
+	local stats, err = daemon.get_stats()
+	if not stats then
+		vim.notify("Cursortab: stats failed: " .. err, vim.log.levels.WARN)
+		return
+	end
+
+	local decided = stats.accepted + stats.partially_accepted + stats.rejected + stats.ignored
+	local lines = {
+		string.format(
+			"Completions: %d shown, %d accepted, %d partially accepted, %d rejected, %d ignored",
+			stats.shown,
+			stats.accepted,
+			stats.partially_accepted,
+			stats.rejected,
+			stats.ignored
+		),
+		string.format("Acceptance rate: %.0f%%", decided > 0 and stats.accepted / decided * 100 or 0),
+		string.format(
+			"Accepted edits: +%d/-%d lines, +%d/-%d bytes",
+			stats.added_lines,
+			stats.deleted_lines,
+			stats.added_bytes,
+			stats.deleted_bytes
+		),
+		string.format(
+			"Jumps: %d shown, %d accepted, %d rejected, %d ignored",
+			stats.jumps.shown,
+			stats.jumps.accepted,
+			stats.jumps.rejected,
+			stats.jumps.ignored
+		),
+		string.format("Tokens sent: ~%d", stats.tokens_sent),
+	}
+	local limit = stats.rate_limit
+	if limit and (limit.per_minute > 0 or limit.max_concurrent > 0) then
+		table.insert(
+			lines,
+			string.format(
+				"Rate limit: %d in flight, %d queued, %d coalesced, %d prefetches skipped",
+				limit.in_flight,
+				limit.queued,
+				limit.coalesced,
+				limit.skipped_prefetches
+			)
+		)
+	end
+	local payload = stats.payload
+	if payload and payload.limit > 0 then
+		local sources = {}
+		for name, bytes in pairs(type(payload.sources) == "table" and payload.sources or {}) do
+			table.insert(sources, string.format("%s=%d", name, bytes))
+		end
+		table.sort(sources)
+		table.insert(
+			lines,
+			string.format(
+				"Payload: %d/%d bytes, %d truncated, %d skipped (%s)",
+				payload.last_bytes,
+				payload.limit,
+				payload.truncated,
+				payload.skipped,
+				table.concat(sources, " ")
+			)
+		)
+	end
+	table.insert(lines, "")
+	local names = vim.tbl_keys(stats.providers or {})
+	table.sort(names)
+	for _, name in ipairs(names) do
+		local p = stats.providers[name]
+		table.insert(
+			lines,
+			string.format(
+				"%s: %d requests, %d errors, ~%d tokens, latency p50 %dms p90 %dms p99 %dms",
+				name,
+				p.requests,
+				p.errors,
+				p.tokens_sent,
+				p.latency_p50_ms,
+				p.latency_p90_ms,
+				p.latency_p99_ms
+			)
+		)
+	end
+	local models = vim.tbl_keys(stats.models or {})
+	table.sort(models)
+	if #models > 0 then
+		table.insert(lines, "")
+	end
+	for _, name in ipairs(models) do
+		local m = stats.models[name]
+		table.insert(
+			lines,
+			string.format(
+				"%s: %d shown, %d accepted, %d partially accepted, %d rejected, %d ignored",
+				name,
+				m.shown,
+				m.accepted,
+				m.partially_accepted,
+				m.rejected,
+				m.ignored
+			)
+		)
+	end
+
+	ui.create_scratch_window("Cursortab Stats", lines, {})
+end
+
+---Show accept rates and latency per provider and context from the quality log
+---@param days integer|nil Only include requests from the last this many days
+function M.quality(days)
+	local query = vim.empty_dict()
+	if days then
+		query = { since = os.date("!%Y-%m-%dT%H:%M:%SZ", os.time() - days * 86400) }
+	end
+
+	local report, err = daemon.get_quality_report(query)
+	if not report then
+		vim.notify("Cursortab: quality report failed: " .. err, vim.log.levels.WARN)
+		return
+	end
+
+	local lines = {
+		string.format("%d request(s)%s", report.total, days and string.format(" in the last %d day(s)", days) or ""),
+		"",
+	}
+	for _, group in ipairs(report.groups) do
+		table.insert(
+			lines,
+			string.format(
+				"%s [%s]: %d requests, %.0f%% accepted (%d/%d/%d accepted/rejected/ignored), %d empty, %d cancelled, %d errors, %dms avg",
+				group.provider,
+				group.context,
+				group.requests,
+				group.accept_rate * 100,
+				group.accepted,
+				group.rejected,
+				group.ignored,
+				group.empty,
+				group.cancelled,
+				group.errors,
+				group.avg_latency_ms
+			)
+		)
+	end
+
+	ui.create_scratch_window("Cursortab Quality", lines, {})
+end
+
 ---Restart cursortab daemon
 function M.restart()
 	vim.notify("Restarting cursortab daemon...", vim.log.levels.INFO)
 
 	-- Clear any existing completions first
 	events.clear_all_completions()
+	active_provider = nil
+	progress = nil
 
 	-- Stop existing daemon (this now handles all cleanup reliably)
 	local _, stop_message = daemon.stop_daemon()
@@ -117,6 +666,7 @@ function M.restart()
 		local start_success = daemon.force_start()
 
 		if start_success then
+			buffers.sync_all()
 			vim.notify("Cursortab daemon restarted successfully", vim.log.levels.INFO)
 		else
 			vim.notify("Failed to start cursortab daemon", vim.log.levels.ERROR)
@@ -144,10 +694,59 @@ function M.setup(user_config)
 		M.clear_log()
 	end, { desc = "Clear cursortab log file" })
 
+	vim.api.nvim_create_user_command("CursortabBuffer", function(opts)
+		M.buffer(opts.args)
+	end, {
+		nargs = "?",
+		complete = function()
+			return { "enable", "disable", "auto" }
+		end,
+		desc = "Enable or disable completions for the current buffer, overriding its options",
+	})
+
 	vim.api.nvim_create_user_command("CursortabStatus", function()
 		M.status()
 	end, { desc = "Show cursortab status information" })
 
+	vim.api.nvim_create_user_command("CursortabTrust", function()
+		M.trust()
+	end, { desc = "Trust the current workspace for hosted providers" })
+
+	vim.api.nvim_create_user_command("CursortabTrigger", function()
+		M.trigger()
+	end, { desc = "Request a completion at the cursor" })
+
+	vim.api.nvim_create_user_command("CursortabRejectStage", function()
+		M.reject_stage()
+	end, { desc = "Skip the current stage of a completion and show the next one" })
+
+	vim.api.nvim_create_user_command("CursortabTune", function(opts)
+		local thresholds = {}
+		for _, arg in ipairs(opts.fargs) do
+			local n = tonumber(arg)
+			if n then
+				table.insert(thresholds, n)
+			end
+		end
+		M.tune(thresholds)
+	end, { nargs = "*", desc = "Preview staging of the last completion under alternative settings" })
+
+	vim.api.nvim_create_user_command("CursortabPreview", function()
+		M.preview()
+	end, { desc = "List the pending stages of the shown completion in the quickfix window" })
+
+	vim.api.nvim_create_user_command("CursortabDiff", function()
+		M.diff()
+	end, { desc = "Show the pending stages of the shown completion as a unified diff" })
+
+	vim.api.nvim_create_user_command("CursortabStats", function()
+		M.stats()
+	end, { desc = "Show completion outcomes and provider latency for this session" })
+
+	vim.api.nvim_create_user_command("CursortabQuality", function(opts)
+		M.quality(tonumber(opts.args))
+	end, { nargs = "?", desc = "Show accept rates per provider and context from the quality log" })
+
 	vim.api.nvim_create_user_command("CursortabRestart", function()
 		M.restart()
 	end, { desc = "Restart cursortab daemon" })
@@ -160,10 +759,14 @@ function M.setup(user_config)
 
 	-- Setup events and autocommands
 	events.setup()
+	buffers.setup()
+	placeholders.setup()
 
 	-- Start the daemon (non-blocking)
 	vim.defer_fn(function()
-		daemon.force_start()
+		if daemon.force_start() then
+			buffers.sync_all()
+		end
 	end, 0)
 end
 
@@ -0,0 +1,247 @@
+local M = {}
+
+local max_lines = 10 -- Lines kept of each hover text and definition
+local context_rows = 2 -- Rows above and below the cursor searched for identifiers
+
+-- Code action kinds that add missing imports, preferred first
+local import_action_kinds = { "source.addMissingImports", "source.organizeImports" }
+
+---Collect identifiers around the cursor, nearest first.
+---@param bufnr integer
+---@param row integer 0-indexed cursor row
+---@param col integer 0-indexed cursor column
+---@param max_symbols integer
+---@return table[] { name, row, col }
+local function nearby_identifiers(bufnr, row, col, max_symbols)
+	local first = math.max(row - context_rows, 0)
+	local lines = vim.api.nvim_buf_get_lines(bufnr, first, row + context_rows + 1, false)
+
+	local candidates = {}
+	for i, line in ipairs(lines) do
+		local r = first + i - 1
+		local init = 1
+		while true do
+			local s, e = line:find("[%a_][%w_]*", init)
+			if not s then
+				break
+			end
+			init = e + 1
+			-- Positions are sent as UTF-16 offsets; byte columns only match them on ASCII prefixes
+			if e - s >= 1 and not line:sub(1, s - 1):find("[\128-\255]") then
+				table.insert(candidates, { name = line:sub(s, e), row = r, col = s - 1 })
+			end
+		end
+	end
+
+	table.sort(candidates, function(a, b)
+		local da, db = math.abs(a.row - row), math.abs(b.row - row)
+		if da ~= db then
+			return da < db
+		end
+		return math.abs(a.col - col) < math.abs(b.col - col)
+	end)
+
+	local seen, result = {}, {}
+	for _, c in ipairs(candidates) do
+		if not seen[c.name] then
+			seen[c.name] = true
+			table.insert(result, c)
+			if #result >= max_symbols then
+				break
+			end
+		end
+	end
+	return result
+end
+
+---Plain text of a hover response, without markdown fences.
+---@param result table|nil
+---@return string
+local function hover_text(result)
+	if not result or not result.contents then
+		return ""
+	end
+	local text = {}
+	for _, line in ipairs(vim.lsp.util.convert_input_to_markdown_lines(result.contents)) do
+		if not line:match("^```") and line:match("%S") then
+			table.insert(text, line)
+			if #text >= max_lines then
+				break
+			end
+		end
+	end
+	return table.concat(text, "\n")
+end
+
+---First location of a definition response.
+---@param result table|nil
+---@return string|nil uri, integer|nil start_row, integer|nil end_row (0-indexed)
+local function definition_location(result)
+	if not result then
+		return nil
+	end
+	local loc = result.uri and result or result.targetUri and result or result[1]
+	if not loc then
+		return nil
+	end
+	local range = loc.targetRange or loc.range
+	if not range then
+		return nil
+	end
+	return loc.uri or loc.targetUri, range.start.line, range["end"].line
+end
+
+---Read lines of a file, from its buffer if loaded.
+---@param fname string
+---@param start_row integer 0-indexed
+---@param end_row integer 0-indexed, inclusive
+---@return string[]
+local function read_lines(fname, start_row, end_row)
+	local bufnr = vim.fn.bufnr(fname)
+	if bufnr ~= -1 and vim.api.nvim_buf_is_loaded(bufnr) then
+		return vim.api.nvim_buf_get_lines(bufnr, start_row, end_row + 1, false)
+	end
+	local ok, lines = pcall(vim.fn.readfile, fname, "", end_row + 1)
+	if not ok then
+		return {}
+	end
+	return vim.list_slice(lines, start_row + 1, end_row + 1)
+end
+
+---Get hover text and definitions of identifiers around the cursor.
+---@param bufnr integer Buffer number
+---@param row integer 1-indexed cursor row
+---@param col integer 0-indexed cursor column
+---@param max_symbols integer Maximum identifiers to look up
+---@param timeout_ms integer Time to wait for the language servers
+---@return table[]
+function M.get_context(bufnr, row, col, max_symbols, timeout_ms)
+	if #vim.lsp.get_clients({ bufnr = bufnr }) == 0 then
+		return {}
+	end
+
+	local uri = vim.uri_from_bufnr(bufnr)
+	local symbols = nearby_identifiers(bufnr, row - 1, col, max_symbols)
+	local pending = 0
+
+	local function request(symbol, method, key)
+		pending = pending + 1
+		local params = {
+			textDocument = { uri = uri },
+			position = { line = symbol.row, character = symbol.col },
+		}
+		vim.lsp.buf_request_all(bufnr, method, params, function(results)
+			pending = pending - 1
+			for _, res in pairs(results or {}) do
+				if res.result and not vim.tbl_isempty(res.result) then
+					symbol[key] = res.result
+					return
+				end
+			end
+		end)
+	end
+
+	for _, symbol in ipairs(symbols) do
+		request(symbol, "textDocument/hover", "hover_result")
+		request(symbol, "textDocument/definition", "definition_result")
+	end
+	vim.wait(timeout_ms, function()
+		return pending == 0
+	end, 5)
+
+	local result = {}
+	for _, symbol in ipairs(symbols) do
+		local entry = { name = symbol.name, hover = hover_text(symbol.hover_result) }
+		local def_uri, start_row, end_row = definition_location(symbol.definition_result)
+		if def_uri and def_uri ~= uri then
+			local fname = vim.uri_to_fname(def_uri)
+			entry.definition_path = vim.fn.fnamemodify(fname, ":.")
+			entry.definition_line = start_row + 1
+			entry.definition = read_lines(fname, start_row, math.min(end_row, start_row + max_lines - 1))
+		end
+		if entry.hover ~= "" or entry.definition then
+			table.insert(result, entry)
+		end
+	end
+	return result
+end
+
+---Edits of a workspace edit to one document.
+---@param edit table|nil WorkspaceEdit
+---@param uri string
+---@return table[] TextEdit[]
+local function document_edits(edit, uri)
+	if not edit then
+		return {}
+	end
+	if edit.changes and edit.changes[uri] then
+		return edit.changes[uri]
+	end
+	for _, change in ipairs(edit.documentChanges or {}) do
+		if change.textDocument and change.textDocument.uri == uri and change.edits then
+			return change.edits
+		end
+	end
+	return {}
+end
+
+---Get the edits of the code action adding the imports a range of lines needs.
+---@param bufnr integer Buffer number
+---@param first integer 1-indexed first line
+---@param last integer 1-indexed last line, inclusive
+---@param timeout_ms integer Time to wait for each request to the language servers
+---@return table { encoding = string, edits = table[] } Edits with 0-indexed positions
+function M.import_edits(bufnr, first, last, timeout_ms)
+	if #vim.lsp.get_clients({ bufnr = bufnr }) == 0 then
+		return { edits = {} }
+	end
+
+	local uri = vim.uri_from_bufnr(bufnr)
+	local params = {
+		textDocument = { uri = uri },
+		range = { start = { line = first - 1, character = 0 }, ["end"] = { line = last, character = 0 } },
+		context = { diagnostics = {}, only = import_action_kinds, triggerKind = 2 },
+	}
+	local results = vim.lsp.buf_request_sync(bufnr, "textDocument/codeAction", params, timeout_ms) or {}
+
+	local action, action_rank, client_id
+	for id, res in pairs(results) do
+		for _, candidate in ipairs(res.result or {}) do
+			for rank, kind in ipairs(import_action_kinds) do
+				if
+					type(candidate.kind) == "string"
+					and vim.startswith(candidate.kind, kind)
+					and (not action_rank or rank < action_rank)
+				then
+					action, action_rank, client_id = candidate, rank, id
+				end
+			end
+		end
+	end
+	if not action then
+		return { edits = {} }
+	end
+
+	-- Servers may leave the edit out until the action is resolved
+	if not action.edit and action.data then
+		local resolved = vim.lsp.buf_request_sync(bufnr, "codeAction/resolve", action, timeout_ms) or {}
+		if resolved[client_id] and resolved[client_id].result then
+			action = resolved[client_id].result
+		end
+	end
+
+	local edits = {}
+	for _, e in ipairs(document_edits(action.edit, uri)) do
+		table.insert(edits, {
+			start_line = e.range.start.line,
+			start_col = e.range.start.character,
+			end_line = e.range["end"].line,
+			end_col = e.range["end"].character,
+			new_text = e.newText,
+		})
+	end
+	local client = vim.lsp.get_client_by_id(client_id)
+	return { encoding = client and client.offset_encoding or "utf-16", edits = edits }
+end
+
+return M
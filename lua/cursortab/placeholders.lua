@@ -0,0 +1,103 @@
+-- Placeholders of an accepted completion for cursortab.nvim
+--
+-- After a completion is accepted, the daemon sends the parts of it the user is
+-- likely to replace: new parameters, TODO markers and string literals. They
+-- are kept as extmarks, so they follow edits, and the accept and partial
+-- accept keys move the cursor through them like snippet tabstops while no
+-- completion or jump indicator is shown.
+
+---@class Placeholder
+---@field line integer 1-indexed buffer line
+---@field col_start integer 0-indexed byte column
+---@field col_end integer 0-indexed byte column, exclusive
+
+---@class PlaceholdersModule
+local placeholders = {}
+
+local ns = vim.api.nvim_create_namespace("cursortab_placeholders")
+
+-- Buffer holding the placeholders
+---@type integer|nil
+local placeholder_buf = nil
+
+-- Extmark ids of the placeholders, in buffer order
+---@type integer[]
+local marks = {}
+
+-- Index in marks of the placeholder the cursor was last moved to (0 before the first jump)
+local current = 0
+
+---Forget the placeholders.
+function placeholders.clear()
+	if placeholder_buf and vim.api.nvim_buf_is_valid(placeholder_buf) then
+		vim.api.nvim_buf_clear_namespace(placeholder_buf, ns, 0, -1)
+	end
+	placeholder_buf = nil
+	marks = {}
+	current = 0
+end
+
+---Replace the placeholders with those of the completion accepted in the current buffer.
+---@param list Placeholder[]
+function placeholders.set(list)
+	placeholders.clear()
+	local buf = vim.api.nvim_get_current_buf()
+	for _, p in ipairs(list) do
+		local ok, id = pcall(vim.api.nvim_buf_set_extmark, buf, ns, p.line - 1, p.col_start, {
+			end_row = p.line - 1,
+			end_col = p.col_end,
+			hl_group = "cursortabhl_placeholder",
+			right_gravity = false,
+			end_right_gravity = true,
+		})
+		if ok then
+			table.insert(marks, id)
+		end
+	end
+	if #marks > 0 then
+		placeholder_buf = buf
+	end
+end
+
+---@return boolean
+function placeholders.active()
+	return placeholder_buf ~= nil and placeholder_buf == vim.api.nvim_get_current_buf()
+end
+
+---Move the cursor to the next or previous placeholder, wrapping around. The
+---cursor is moved on the next tick, so this can be called from expr mappings.
+---@param step integer 1 for the next placeholder, -1 for the previous one
+---@return boolean moved
+function placeholders.jump(step)
+	if not placeholders.active() then
+		return false
+	end
+	if current == 0 then
+		current = step > 0 and 1 or #marks
+	else
+		current = (current - 1 + step) % #marks + 1
+	end
+
+	local buf, mark = placeholder_buf, marks[current]
+	vim.schedule(function()
+		if buf ~= vim.api.nvim_get_current_buf() then
+			return
+		end
+		local pos = vim.api.nvim_buf_get_extmark_by_id(buf, ns, mark, {})
+		if pos[1] then
+			pcall(vim.api.nvim_win_set_cursor, 0, { pos[1] + 1, pos[2] })
+		end
+	end)
+	return true
+end
+
+function placeholders.setup()
+	local group = vim.api.nvim_create_augroup("cursortab_placeholders", { clear = true })
+
+	vim.api.nvim_create_autocmd({ "InsertLeave", "BufLeave" }, {
+		group = group,
+		callback = placeholders.clear,
+	})
+end
+
+return placeholders
@@ -55,10 +55,12 @@ function M.get_context(bufnr, row, col, max_siblings)
 	end
 
 	local enclosing_sig = ""
+	local enclosing_start, enclosing_end = 0, 0
 	if enclosing then
-		local start_row = enclosing:start()
+		local start_row, _, end_row = enclosing:range()
 		local line = vim.api.nvim_buf_get_lines(bufnr, start_row, start_row + 1, false)[1] or ""
 		enclosing_sig = line
+		enclosing_start, enclosing_end = start_row + 1, end_row + 1
 	end
 
 	-- Get sibling scope nodes from the enclosing scope's parent
@@ -67,14 +69,14 @@ function M.get_context(bufnr, row, col, max_siblings)
 	if parent then
 		for child in parent:iter_children() do
 			if scope_types[child:type()] and child ~= enclosing then
-				local s_row = child:start()
+				local s_row, _, e_row = child:range()
 				local line = vim.api.nvim_buf_get_lines(bufnr, s_row, s_row + 1, false)[1] or ""
 				local name = ""
 				local name_node = child:field("name")[1]
 				if name_node then
 					name = vim.treesitter.get_node_text(name_node, bufnr)
 				end
-				table.insert(siblings, { name = name, signature = line, line = s_row + 1 })
+				table.insert(siblings, { name = name, signature = line, line = s_row + 1, end_line = e_row + 1 })
 			end
 		end
 		if #siblings > max_siblings then
@@ -102,6 +104,8 @@ function M.get_context(bufnr, row, col, max_siblings)
 
 	return {
 		enclosing_signature = enclosing_sig,
+		enclosing_start = enclosing_start,
+		enclosing_end = enclosing_end,
 		siblings = siblings,
 		imports = imports,
 	}
@@ -54,6 +54,20 @@ local absolute_jump_buf = nil
 local completion_extmarks = {} -- Array of {buf, extmark_id} for cleanup
 ---@type WindowInfo[]
 local completion_windows = {} -- Array of {win_id, buf_id} for overlay window cleanup
+---@type DiffResult|nil
+local shown_diff_result = nil -- Untouched copy of the shown completion, for re-rendering it dimmed
+local dimmed = false -- Whether the shown completion is dimmed (sticky, cursor moved off it)
+local has_inline_virt_text = vim.fn.has("nvim-0.10") == 1
+
+-- Highlight group to render a completion with, honoring dimming
+---@param name string
+---@return string
+local function hl(name)
+	if dimmed then
+		return "cursortabhl_dimmed"
+	end
+	return name
+end
 
 ---@class Group
 ---@field type string "modification" | "addition" | "deletion"
@@ -61,16 +75,50 @@ local completion_windows = {} -- Array of {win_id, buf_id} for overlay window cl
 ---@field end_line integer 1-indexed, inclusive
 ---@field buffer_line integer 1-indexed absolute buffer position for rendering
 ---@field lines string[] New content
----@field old_lines string[] Old content (modifications only)
+---@field old_lines string[] Old content (modifications and deletions)
 ---@field render_hint string|nil "append_chars" | "replace_chars" | "delete_chars" | nil
----@field col_start integer|nil For character-level hints
----@field col_end integer|nil For character-level hints
+---@field col_start integer|nil For character-level hints, in behavior.column_unit
+---@field col_end integer|nil For character-level hints, in behavior.column_unit
+---@field old_spans integer[][][]|nil Word diff: per old line, {start, end} ranges removed
+---@field spans integer[][][]|nil Word diff: per new line, {start, end} ranges inserted
+---@field collisions VirtText[]|nil Virtual text other namespaces show on buffer_line
+---@field edits WordEdit[][]|nil Inline diff: per line, edits turning old_lines[i] into lines[i]
+
+---@class WordEdit
+---@field old_start integer Start of the replaced columns of the old line, in behavior.column_unit
+---@field old_end integer End (exclusive) of the replaced columns; equal to old_start for an insertion
+---@field text string Inserted text
+
+---@class VirtText
+---@field col integer 0-indexed byte column it is anchored at
+---@field pos string "eol" | "overlay" | "inline" | "right_align"
+---@field width integer Display width
+
+---@class CompletionAnnotation
+---@field provider string Provider that produced the completion
+---@field model string Model that produced the completion (empty if not configured)
+---@field latency_ms integer Response time (0 for cached and prefetched responses)
 
 ---@class DiffResult
 ---@field groups Group[] Array of groups for rendering
 ---@field startLine integer Start line of the buffer range (1-indexed, used for apply operation)
 ---@field cursor_line integer Cursor position (1-indexed, relative to content)
 ---@field cursor_col integer Cursor column (0-indexed)
+---@field annotation CompletionAnnotation|nil Source of the completion
+
+---@class StreamedStage: DiffResult
+---@field stage integer Position of the stage in the stream (1-indexed)
+---@field shown boolean Whether the stage is the one shown as the completion
+
+---@class FileSummary
+---@field path string Workspace-relative file path
+---@field stages integer Number of stages in the file
+---@field additions integer Lines added
+---@field deletions integer Lines deleted or replaced
+
+---@class MultiFileSummary
+---@field files FileSummary[] Files edited by the completion, in visiting order
+---@field current_file integer File the next stage is in (1-indexed into files)
 
 -- Helper function to close cursor prediction jump text
 local function ensure_close_cursor_prediction()
@@ -286,6 +334,11 @@ local function create_overlay_window(parent_win, buffer_line, col, content, synt
 		end
 	end
 
+	-- Let the buffer show through a dimmed completion
+	if dimmed then
+		vim.api.nvim_set_option_value("winblend", 50, { win = overlay_win })
+	end
+
 	return overlay_win, overlay_buf, bytes_trimmed_first_line
 end
 
@@ -299,6 +352,36 @@ local function clear_expected_line_state()
 	append_chars_state = nil
 end
 
+-- Display columns the virtual text at the end of a group's line takes, so an
+-- overlay placed after the line can be pushed past it
+---@param group Group
+---@return integer
+local function eol_padding(group)
+	local padding = 0
+	for _, collision in ipairs(group.collisions or {}) do
+		if collision.pos == "eol" then
+			padding = padding + collision.width + 1
+		elseif collision.pos == "inline" then
+			padding = padding + collision.width
+		end
+	end
+	return padding
+end
+
+-- Whether virtual text is drawn at or after col on a group's line, where
+-- ghost text overlaid from col would be drawn over it
+---@param group Group
+---@param col integer 0-indexed byte column
+---@return boolean
+local function collides_after(group, col)
+	for _, collision in ipairs(group.collisions or {}) do
+		if collision.pos == "eol" or (collision.pos == "inline" and collision.col >= col) then
+			return true
+		end
+	end
+	return false
+end
+
 -- Render append_chars: show only the appended part as ghost text
 ---@param group Group
 ---@param nvim_line integer 0-indexed line number
@@ -336,9 +419,10 @@ local function render_append_chars(group, nvim_line, current_buf, is_first_appen
 		local line_length = #line_content
 		local virt_col = math.min(col_start, line_length)
 
+		-- Inline ghost text pushes diagnostics and inlay hints aside instead of covering them
 		local extmark_id = vim.api.nvim_buf_set_extmark(current_buf, daemon.get_namespace_id(), nvim_line, virt_col, {
-			virt_text = { { appended_text, "cursortabhl_completion" } },
-			virt_text_pos = "overlay",
+			virt_text = { { appended_text, hl("cursortabhl_completion") } },
+			virt_text_pos = (has_inline_virt_text and collides_after(group, virt_col)) and "inline" or "overlay",
 			hl_mode = "combine",
 		})
 		table.insert(completion_extmarks, { buf = current_buf, extmark_id = extmark_id })
@@ -366,7 +450,7 @@ local function render_delete_chars(group, nvim_line, current_buf)
 	if col_end > col_start then
 		local extmark_id = vim.api.nvim_buf_set_extmark(current_buf, daemon.get_namespace_id(), nvim_line, col_start, {
 			end_col = col_end,
-			hl_group = "cursortabhl_deletion",
+			hl_group = hl("cursortabhl_deletion"),
 			hl_mode = "combine",
 		})
 		table.insert(completion_extmarks, { buf = current_buf, extmark_id = extmark_id })
@@ -397,8 +481,57 @@ local function render_replace_chars(group, nvim_line, current_win, current_buf)
 		if end_col > start_col then
 			vim.api.nvim_buf_set_extmark(overlay_buf, daemon.get_namespace_id(), 0, start_col, {
 				end_col = end_col,
-				hl_group = "cursortabhl_addition",
+				hl_group = hl("cursortabhl_addition"),
+			})
+		end
+	end
+end
+
+-- Highlight an old line of a modification: only the removed words with word
+-- diff spans, otherwise the whole line
+---@param group Group
+---@param index integer 1-indexed line within the group
+---@param line_nvim integer 0-indexed buffer line
+---@param line_content string
+---@param current_buf integer
+local function highlight_old_line(group, index, line_nvim, line_content, current_buf)
+	local ranges = { { 0, #line_content } }
+	if group.old_spans then
+		ranges = group.old_spans[index] or {}
+	end
+	for _, range in ipairs(ranges) do
+		local col_start = math.min(range[1], #line_content)
+		local col_end = math.min(range[2], #line_content)
+		if col_end > col_start then
+			local extmark_id = vim.api.nvim_buf_set_extmark(current_buf, daemon.get_namespace_id(), line_nvim, col_start, {
+				end_col = col_end,
+				hl_group = hl("cursortabhl_deletion"),
+				hl_mode = "combine",
 			})
+			table.insert(completion_extmarks, { buf = current_buf, extmark_id = extmark_id })
+		end
+	end
+end
+
+-- Highlight the inserted words of a modification in its overlay. Lines trimmed
+-- by horizontal scrolling are left as they are.
+---@param group Group
+---@param overlay_buf integer
+local function highlight_new_spans(group, overlay_buf)
+	if not group.spans then
+		return
+	end
+	local overlay_lines = vim.api.nvim_buf_get_lines(overlay_buf, 0, -1, false)
+	for i, ranges in ipairs(group.spans) do
+		if overlay_lines[i] == group.lines[i] then
+			for _, range in ipairs(ranges) do
+				if range[2] > range[1] then
+					vim.api.nvim_buf_set_extmark(overlay_buf, daemon.get_namespace_id(), i - 1, range[1], {
+						end_col = math.min(range[2], #overlay_lines[i]),
+						hl_group = hl("cursortabhl_addition"),
+					})
+				end
+			end
 		end
 	end
 end
@@ -415,21 +548,46 @@ local function render_single_modification(group, nvim_line, virt_line_offset, cu
 	local content = group.lines[1] or ""
 
 	-- Highlight existing line with deletion background
-	if line_content ~= "" then
-		local extmark_id = vim.api.nvim_buf_set_extmark(current_buf, daemon.get_namespace_id(), nvim_line, 0, {
-			end_col = #line_content,
-			hl_group = "cursortabhl_deletion",
-			hl_mode = "combine",
-		})
-		table.insert(completion_extmarks, { buf = current_buf, extmark_id = extmark_id })
-	end
+	highlight_old_line(group, 1, nvim_line, line_content, current_buf)
 
 	-- Create side-by-side overlay window to the right (offset by virtual lines)
 	if content ~= "" then
-		local line_width = vim.fn.strdisplaywidth(line_content)
+		local line_width = vim.fn.strdisplaywidth(line_content) + eol_padding(group)
 		local overlay_win, overlay_buf, _ =
-			create_overlay_window(current_win, nvim_line + virt_line_offset, line_width + 2, content, syntax_ft, "cursortabhl_modification", nil)
+			create_overlay_window(current_win, nvim_line + virt_line_offset, line_width + 2, content, syntax_ft, hl("cursortabhl_modification"), nil)
 		table.insert(completion_windows, { win_id = overlay_win, buf_id = overlay_buf })
+		highlight_new_spans(group, overlay_buf)
+	end
+end
+
+-- Render a modification as word edits in place: removed words struck through,
+-- inserted words as virtual text where they go
+---@param group Group
+---@param current_buf integer
+local function render_inline_modification(group, current_buf)
+	for i, edits in ipairs(group.edits) do
+		local line_nvim = group.buffer_line + i - 2 -- 0-indexed
+		local line_content = vim.api.nvim_buf_get_lines(current_buf, line_nvim, line_nvim + 1, false)[1] or ""
+		for _, edit in ipairs(edits) do
+			local old_start = math.min(edit.old_start, #line_content)
+			local old_end = math.min(edit.old_end, #line_content)
+			if old_end > old_start then
+				local extmark_id = vim.api.nvim_buf_set_extmark(current_buf, daemon.get_namespace_id(), line_nvim, old_start, {
+					end_col = old_end,
+					hl_group = hl("cursortabhl_deleted_line"),
+					hl_mode = "combine",
+				})
+				table.insert(completion_extmarks, { buf = current_buf, extmark_id = extmark_id })
+			end
+			if edit.text ~= "" then
+				local extmark_id = vim.api.nvim_buf_set_extmark(current_buf, daemon.get_namespace_id(), line_nvim, old_end, {
+					virt_text = { { edit.text, hl("cursortabhl_addition") } },
+					virt_text_pos = "inline",
+					hl_mode = "combine",
+				})
+				table.insert(completion_extmarks, { buf = current_buf, extmark_id = extmark_id })
+			end
+		end
 	end
 end
 
@@ -448,6 +606,9 @@ local function render_modification_group(group, virt_line_offset, current_win, c
 		local line_nvim = group.buffer_line + i - 2 -- 0-indexed
 		local line_content = vim.api.nvim_buf_get_lines(current_buf, line_nvim, line_nvim + 1, false)[1] or ""
 		local width = vim.fn.strdisplaywidth(line_content)
+		if i == 1 then
+			width = width + eol_padding(group)
+		end
 		if width > max_old_width then
 			max_old_width = width
 		end
@@ -457,15 +618,7 @@ local function render_modification_group(group, virt_line_offset, current_win, c
 	for i = 1, line_count do
 		local line_nvim = group.buffer_line + i - 2 -- 0-indexed
 		local line_content = vim.api.nvim_buf_get_lines(current_buf, line_nvim, line_nvim + 1, false)[1] or ""
-
-		if line_content ~= "" then
-			local extmark_id = vim.api.nvim_buf_set_extmark(current_buf, daemon.get_namespace_id(), line_nvim, 0, {
-				end_col = #line_content,
-				hl_group = "cursortabhl_deletion",
-				hl_mode = "combine",
-			})
-			table.insert(completion_extmarks, { buf = current_buf, extmark_id = extmark_id })
-		end
+		highlight_old_line(group, i, line_nvim, line_content, current_buf)
 	end
 
 	-- Create single overlay window to the right with all new lines
@@ -477,10 +630,11 @@ local function render_modification_group(group, virt_line_offset, current_win, c
 			max_old_width + 2,
 			group.lines,
 			syntax_ft,
-			"cursortabhl_modification",
+			hl("cursortabhl_modification"),
 			nil
 		)
 		table.insert(completion_windows, { win_id = overlay_win, buf_id = overlay_buf })
+		highlight_new_spans(group, overlay_buf)
 	end
 end
 
@@ -515,7 +669,7 @@ local function render_single_addition(group, nvim_line, virt_line_offset, curren
 
 	if content ~= "" then
 		local overlay_win, overlay_buf, _ =
-			create_overlay_window(current_win, overlay_line, 0, content, syntax_ft, "cursortabhl_addition", nil)
+			create_overlay_window(current_win, overlay_line, 0, content, syntax_ft, hl("cursortabhl_addition"), nil)
 		table.insert(completion_windows, { win_id = overlay_win, buf_id = overlay_buf })
 	end
 end
@@ -561,12 +715,12 @@ local function render_addition_group(group, virt_line_offset, current_win, curre
 	-- Create overlay window for syntax-highlighted content
 	if #group.lines > 0 then
 		local overlay_win, overlay_buf, _ =
-			create_overlay_window(current_win, overlay_line, 0, group.lines, syntax_ft, "cursortabhl_addition", nil)
+			create_overlay_window(current_win, overlay_line, 0, group.lines, syntax_ft, hl("cursortabhl_addition"), nil)
 		table.insert(completion_windows, { win_id = overlay_win, buf_id = overlay_buf })
 	end
 end
 
--- Render line deletion: highlight the entire line
+-- Render line deletion: strike through the entire line
 ---@param nvim_line integer 0-indexed line number
 ---@param current_buf integer
 local function render_deletion(nvim_line, current_buf)
@@ -575,13 +729,13 @@ local function render_deletion(nvim_line, current_buf)
 	if line_content ~= "" then
 		local extmark_id = vim.api.nvim_buf_set_extmark(current_buf, daemon.get_namespace_id(), nvim_line, 0, {
 			end_col = #line_content,
-			hl_group = "cursortabhl_deletion",
+			hl_group = hl("cursortabhl_deleted_line"),
 			hl_mode = "combine",
 		})
 		table.insert(completion_extmarks, { buf = current_buf, extmark_id = extmark_id })
 	else
 		local extmark_id = vim.api.nvim_buf_set_extmark(current_buf, daemon.get_namespace_id(), nvim_line, 0, {
-			virt_text = { { "~", "cursortabhl_deletion" } },
+			virt_text = { { "~", hl("cursortabhl_deletion") } },
 			virt_text_pos = "overlay",
 			hl_mode = "combine",
 		})
@@ -589,6 +743,76 @@ local function render_deletion(nvim_line, current_buf)
 	end
 end
 
+-- Convert a column sent by the daemon in behavior.column_unit to a byte column of line
+---@param line string
+---@param col integer
+---@return integer
+local function to_byte_col(line, col)
+	local unit = config.get().behavior.column_unit
+	if unit == "byte" or col <= 0 then
+		return col
+	end
+	local pos, count = 0, 0
+	for char in line:gmatch("[%z\1-\127\194-\244][\128-\191]*") do
+		if count >= col then
+			return pos
+		end
+		count = count + (unit == "cell" and vim.fn.strdisplaywidth(char) or 1)
+		pos = pos + #char
+	end
+	return pos + (col - count)
+end
+
+-- Convert the columns of a group to bytes, which the rendering below works in
+---@param group Group
+local function normalize_columns(group)
+	if group.render_hint and group.render_hint ~= "" then
+		local lines = group.render_hint == "delete_chars" and group.old_lines or group.lines
+		local line = (lines and lines[1]) or ""
+		group.col_start = to_byte_col(line, group.col_start or 0)
+		group.col_end = to_byte_col(line, group.col_end or 0)
+	end
+	for i, edits in ipairs(group.edits or {}) do
+		local line = (group.old_lines and group.old_lines[i]) or ""
+		for _, edit in ipairs(edits) do
+			edit.old_start = to_byte_col(line, edit.old_start)
+			edit.old_end = to_byte_col(line, edit.old_end)
+		end
+	end
+	for key, lines in pairs({ old_spans = group.old_lines, spans = group.lines }) do
+		for i, ranges in ipairs(group[key] or {}) do
+			local line = (lines and lines[i]) or ""
+			for _, range in ipairs(ranges) do
+				range[1] = to_byte_col(line, range[1])
+				range[2] = to_byte_col(line, range[2])
+			end
+		end
+	end
+end
+
+-- Show the provider and latency of a completion at the right of its first line
+---@param diff_result DiffResult
+---@param current_buf integer
+local function render_annotation(diff_result, current_buf)
+	local annotation = diff_result.annotation
+	local first = (diff_result.groups or {})[1]
+	if not config.get().ui.show_annotation or not annotation or not first then
+		return
+	end
+
+	local label = annotation.provider
+	if annotation.latency_ms > 0 then
+		label = string.format("%s %dms", label, annotation.latency_ms)
+	end
+	local nvim_line = math.min(first.buffer_line, vim.api.nvim_buf_line_count(current_buf)) - 1
+	local extmark_id = vim.api.nvim_buf_set_extmark(current_buf, daemon.get_namespace_id(), nvim_line, 0, {
+		virt_text = { { "[" .. label .. "]", "cursortabhl_annotation" } },
+		virt_text_pos = "right_align",
+		hl_mode = "combine",
+	})
+	table.insert(completion_extmarks, { buf = current_buf, extmark_id = extmark_id })
+end
+
 -- Function to show completion diff highlighting (called from Go)
 ---@param diff_result DiffResult Completion diff result from Go daemon
 local function show_completion(diff_result)
@@ -608,6 +832,7 @@ local function show_completion(diff_result)
 
 	-- Process each group in order (groups are already sorted by start_line from Go)
 	for _, group in ipairs(diff_result.groups or {}) do
+		normalize_columns(group)
 		local is_single_line = group.start_line == group.end_line
 
 		-- Use buffer_line directly (1-indexed absolute buffer position computed by Go)
@@ -627,7 +852,9 @@ local function show_completion(diff_result)
 				render_delete_chars(group, nvim_line, current_buf)
 			end
 		elseif group.type == "modification" then
-			if is_single_line then
+			if group.edits and has_inline_virt_text then
+				render_inline_modification(group, current_buf)
+			elseif is_single_line then
 				render_single_modification(group, nvim_line, virt_line_offset, current_win, current_buf)
 			else
 				render_modification_group(group, virt_line_offset, current_win, current_buf)
@@ -643,16 +870,59 @@ local function show_completion(diff_result)
 			virt_line_offset = virt_line_offset + line_count
 		elseif group.type == "deletion" then
 			-- Deletions are always rendered per-line within the group
-			for i = 1, (group.end_line - group.start_line + 1) do
+			for i = 1, #group.old_lines do
 				local del_nvim_line = nvim_line + i - 1
 				render_deletion(del_nvim_line, current_buf)
 			end
 		end
 	end
+
+	render_annotation(diff_result, current_buf)
 end
 
 -- Function to show cursor prediction jump text (called from Go)
 ---@param line_num integer Predicted line number (1-indexed)
+-- Show a one-line indicator floating at the top or bottom of a window
+---@param win integer Window to position the indicator in
+---@param display_text string Indicator text
+---@param at_bottom boolean Show at the bottom instead of the top
+local function show_jump_float(win, display_text, at_bottom)
+	---@type integer
+	local win_width = vim.api.nvim_win_get_width(win)
+	---@type integer
+	local win_height = vim.api.nvim_win_get_height(win)
+
+	-- Create a scratch buffer for the indicator
+	absolute_jump_buf = vim.api.nvim_create_buf(false, true)
+	vim.api.nvim_buf_set_lines(absolute_jump_buf, 0, -1, false, { display_text })
+	vim.api.nvim_set_option_value("modifiable", false, { buf = absolute_jump_buf })
+
+	-- Calculate position - center horizontally, top or bottom vertically
+	---@type integer
+	local text_width = vim.fn.strdisplaywidth(display_text)
+	---@type integer
+	local col = math.max(0, math.floor((win_width - text_width) / 2))
+	---@type integer
+	local row = at_bottom and (win_height - 2) or 1 -- Bottom or top with some padding
+
+	-- Create floating window for absolute positioning
+	absolute_jump_win = vim.api.nvim_open_win(absolute_jump_buf, false, {
+		relative = "win",
+		win = win,
+		row = row,
+		col = col,
+		width = text_width,
+		height = 1,
+		style = "minimal",
+		border = "none",
+		zindex = 1,
+		focusable = false,
+	})
+
+	-- Set window background to match cursortabhl_jump_text highlight
+	vim.api.nvim_set_option_value("winhighlight", "Normal:cursortabhl_jump_text", { win = absolute_jump_win })
+end
+
 local function show_cursor_prediction(line_num)
 	-- Get current buffer and window info
 	---@type integer
@@ -708,11 +978,6 @@ local function show_cursor_prediction(line_num)
 		jump_text_buf = current_buf
 	else
 		-- Line is not visible - show directional arrow with distance
-		---@type integer
-		local win_width = vim.api.nvim_win_get_width(current_win)
-		---@type integer
-		local win_height = vim.api.nvim_win_get_height(current_win)
-
 		-- Determine direction and calculate distance
 		---@type boolean
 		local is_below = nvim_line_num > last_visible_line
@@ -726,35 +991,7 @@ local function show_cursor_prediction(line_num)
 			display_text = display_text .. "(" .. distance .. " lines) "
 		end
 
-		-- Create a scratch buffer for the arrow indicator
-		absolute_jump_buf = vim.api.nvim_create_buf(false, true)
-		vim.api.nvim_buf_set_lines(absolute_jump_buf, 0, -1, false, { display_text })
-		vim.api.nvim_set_option_value("modifiable", false, { buf = absolute_jump_buf })
-
-		-- Calculate position - center horizontally, top or bottom vertically
-		---@type integer
-		local text_width = vim.fn.strdisplaywidth(display_text)
-		---@type integer
-		local col = math.max(0, math.floor((win_width - text_width) / 2))
-		---@type integer
-		local row = is_below and (win_height - 2) or 1 -- Bottom or top with some padding
-
-		-- Create floating window for absolute positioning
-		absolute_jump_win = vim.api.nvim_open_win(absolute_jump_buf, false, {
-			relative = "win",
-			win = current_win,
-			row = row,
-			col = col,
-			width = text_width,
-			height = 1,
-			style = "minimal",
-			border = "none",
-			zindex = 1,
-			focusable = false,
-		})
-
-		-- Set window background to match cursortabhl_jump_text highlight
-		vim.api.nvim_set_option_value("winhighlight", "Normal:cursortabhl_jump_text", { win = absolute_jump_win })
+		show_jump_float(current_win, display_text, is_below)
 	end
 end
 
@@ -767,14 +1004,88 @@ function ui.ensure_close_all()
 	clear_expected_line_state()
 end
 
+-- Virtual text other namespaces show on each of lines, for the daemon to
+-- attach to the groups rendered there (called from Go)
+---@param buf integer
+---@param lines integer[] 1-indexed buffer lines
+---@return VirtText[][]
+function ui.virt_text_on_lines(buf, lines)
+	local own = daemon.get_namespace_id()
+	local line_count = vim.api.nvim_buf_line_count(buf)
+	local result = {}
+	for i, line in ipairs(lines) do
+		result[i] = {}
+		if line >= 1 and line <= line_count then
+			local marks = vim.api.nvim_buf_get_extmarks(buf, -1, { line - 1, 0 }, { line - 1, -1 }, { details = true })
+			for _, mark in ipairs(marks) do
+				local details = mark[4]
+				if details.ns_id ~= own and details.virt_text then
+					local width = 0
+					for _, chunk in ipairs(details.virt_text) do
+						width = width + vim.fn.strdisplaywidth(chunk[1])
+					end
+					table.insert(result[i], { col = mark[3], pos = details.virt_text_pos or "eol", width = width })
+				end
+			end
+		end
+	end
+	return result
+end
+
 -- Show completion diff highlighting
 ---@param diff_result DiffResult Completion diff result from Go daemon
 function ui.show_completion(diff_result)
 	has_completion = true
+	dimmed = false
+	shown_diff_result = vim.deepcopy(diff_result)
 	ui.ensure_close_all()
 	show_completion(diff_result)
 end
 
+-- Preview a stage of a completion that is still streaming: its new lines are
+-- shown dimmed below the lines they replace, next to whatever is shown
+---@param diff_result StreamedStage
+function ui.show_streamed_stage(diff_result)
+	local current_buf = vim.api.nvim_get_current_buf()
+	if vim.api.nvim_win_get_config(0).relative ~= "" then
+		return
+	end
+	local line_count = vim.api.nvim_buf_line_count(current_buf)
+	for _, group in ipairs(diff_result.groups or {}) do
+		local virt_lines = {}
+		for _, line in ipairs(group.lines or {}) do
+			table.insert(virt_lines, { { line, "cursortabhl_dimmed" } })
+		end
+		if #virt_lines > 0 then
+			-- Additions go before buffer_line, other groups after the lines they replace
+			local above = group.type == "addition"
+			local nvim_line = group.buffer_line - 1
+			if not above then
+				nvim_line = nvim_line + group.end_line - group.start_line
+			end
+			if nvim_line >= line_count then
+				nvim_line, above = line_count - 1, false
+			end
+			local extmark_id = vim.api.nvim_buf_set_extmark(current_buf, daemon.get_namespace_id(), nvim_line, 0, {
+				virt_lines = virt_lines,
+				virt_lines_above = above,
+			})
+			table.insert(completion_extmarks, { buf = current_buf, extmark_id = extmark_id })
+		end
+	end
+end
+
+-- Dim the shown completion, or restore it, without losing it
+---@param dim boolean
+function ui.set_dimmed(dim)
+	if dim == dimmed or not has_completion or not shown_diff_result then
+		return
+	end
+	dimmed = dim
+	ui.ensure_close_all()
+	show_completion(vim.deepcopy(shown_diff_result))
+end
+
 -- Show cursor prediction jump text
 ---@param line_num integer Predicted line number (1-indexed)
 function ui.show_cursor_prediction(line_num)
@@ -783,10 +1094,36 @@ function ui.show_cursor_prediction(line_num)
 	show_cursor_prediction(line_num)
 end
 
+-- Show the jump indicator for a multi-file completion stage in another file
+---@param path string Workspace-relative file path
+---@param line_num integer Target line in that file (1-indexed)
+---@param summary MultiFileSummary Overview of every file the completion edits
+function ui.show_file_target(path, line_num, summary)
+	has_cursor_prediction = true
+	ui.ensure_close_all()
+
+	---@type integer
+	local current_win = vim.api.nvim_get_current_win()
+	if vim.api.nvim_win_get_config(current_win).relative ~= "" then
+		return
+	end
+
+	---@type CursortabConfig
+	local cfg = config.get()
+	---@type string
+	local display_text = " " .. cfg.ui.jump.symbol .. cfg.ui.jump.text .. path .. ":" .. line_num
+	if #summary.files > 1 then
+		display_text = display_text .. " (file " .. summary.current_file .. "/" .. #summary.files .. ") "
+	end
+	show_jump_float(current_win, display_text, true)
+end
+
 -- Close all UI elements and reset state (for on_reject)
 function ui.close_all()
 	ui.ensure_close_all()
 	has_completion = false
+	shown_diff_result = nil
+	dimmed = false
 	has_cursor_prediction = false
 end
 
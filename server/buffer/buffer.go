@@ -1,36 +1,44 @@
 package buffer
 
 import (
+	"cursortab/imports"
 	"cursortab/logger"
 	"cursortab/text"
 	"cursortab/types"
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/neovim/go-client/nvim"
-	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
 type Config struct {
-	NsID int
+	NsID       int
+	WordDiff   bool            // Send word diff spans of modified lines for rendering
+	InlineDiff bool            // Send in-place word edits of modified lines for rendering
+	ColumnUnit text.ColumnUnit // Unit of the columns sent for rendering (default: bytes)
+	MaxSize    int             // Buffers larger than this many bytes get no completions (0 to disable)
 }
 
 type NvimBuffer struct {
 	client *nvim.Nvim // stored internally, set via SetClient
 
 	// Private state
-	lines         []string
-	row           int // 1-indexed
-	col           int // 0-indexed
+	lines         []string // Replaced, never modified in place, so snapshots can share it
+	row           int      // 1-indexed
+	col           int      // 0-indexed
 	path          string
+	absPath       string
 	version       int
 	diffHistories []*types.DiffEntry // Structured diff history for provider consumption
 	previousLines []string           // Buffer content before the most recent edit (for sweep provider)
 
 	originalLines    []string // Original file content when editing session started
 	lastModifiedLine int      // Track which line was last modified
+	undoSeq          int      // Undo sequence number of the buffer state (changenr())
 	id               nvim.Buffer
 	scrollOffsetX    int // Horizontal scroll offset (leftcol)
 
@@ -42,6 +50,17 @@ type NvimBuffer struct {
 
 	// Pending completion state (committed only on accept)
 	pending *PendingEdit
+
+	annotation *types.Annotation // Provider and model of the completions being prepared
+
+	anchorNs int // Namespace of the extmarks anchoring the prepared completion, 0 until created
+
+	ineligible string // Why the buffer gets no completions, empty when it does
+
+	// Incremental sync (see ApplyLines)
+	tick       int   // b:changedtick the lines are current at, untracked when they must be read in full
+	edited     *span // Lines changed since the originalLines checkpoint, nil when none
+	editsKnown bool  // Every change since the checkpoint is in edited
 }
 
 // PendingEdit holds pending completion state committed only on accept
@@ -65,6 +84,7 @@ func New(config Config) *NvimBuffer {
 		id:               nvim.Buffer(0),
 		scrollOffsetX:    0,
 		config:           config,
+		tick:             untracked,
 	}
 }
 
@@ -83,6 +103,8 @@ func (b *NvimBuffer) Col() int { return b.col }
 
 func (b *NvimBuffer) Path() string { return b.path }
 
+func (b *NvimBuffer) AbsolutePath() string { return b.absPath }
+
 func (b *NvimBuffer) Version() int { return b.version }
 
 func (b *NvimBuffer) ViewportBounds() (top, bottom int) {
@@ -95,6 +117,9 @@ func (b *NvimBuffer) OriginalLines() []string { return b.originalLines }
 
 func (b *NvimBuffer) DiffHistories() []*types.DiffEntry { return b.diffHistories }
 
+// Ineligible returns why the buffer of the last sync gets no completions, or ""
+func (b *NvimBuffer) Ineligible() string { return b.ineligible }
+
 // SetFileContext restores file-specific state when switching back to a previously edited file.
 // This is called by the engine after detecting a file switch.
 func (b *NvimBuffer) SetFileContext(previousLines, originalLines []string, diffHistories []*types.DiffEntry) {
@@ -112,8 +137,16 @@ func (b *NvimBuffer) SetFileContext(previousLines, originalLines []string, diffH
 	}
 
 	if diffHistories != nil {
-		b.diffHistories = make([]*types.DiffEntry, len(diffHistories))
-		copy(b.diffHistories, diffHistories)
+		// Sequence numbers from another undo tree (e.g. the file was reloaded)
+		// can't be compared with this one's
+		restored := make([]*types.DiffEntry, len(diffHistories))
+		for i, entry := range diffHistories {
+			if entry.UndoSeq > b.undoSeq {
+				entry = &types.DiffEntry{Original: entry.Original, Updated: entry.Updated}
+			}
+			restored[i] = entry
+		}
+		b.diffHistories = compressDiffEntries(restored)
 	} else {
 		b.diffHistories = []*types.DiffEntry{}
 	}
@@ -121,6 +154,7 @@ func (b *NvimBuffer) SetFileContext(previousLines, originalLines []string, diffH
 	if originalLines != nil {
 		b.originalLines = make([]string, len(originalLines))
 		copy(b.originalLines, originalLines)
+		b.editsKnown = false
 	}
 }
 
@@ -136,22 +170,49 @@ func (b *NvimBuffer) Sync(workspacePath string) (*SyncResult, error) {
 
 	var currentBuf nvim.Buffer
 	var path string
-	var lines [][]byte
+	var content struct {
+		Tick  int      `msgpack:"tick"`
+		Read  bool     `msgpack:"read"`  // The lines of the last sync are out of date
+		Lines []string `msgpack:"lines"` // Set when Read
+	}
 	var window nvim.Window
 	var cursor [2]int
 	var scrollOffset int
 	var viewportBounds [2]int
 	var nvimCwd string
+	var undoSeq int
+	var options bufferOptions
 
 	batch.CurrentBuffer(&currentBuf)
 	batch.BufferName(nvim.Buffer(0), &path) // Use 0 for current buffer
-	batch.BufferLines(nvim.Buffer(0), 0, -1, false, &lines)
+	// Read the lines only when the changes applied since the last sync don't
+	// bring them up to date
+	batch.ExecLua(`
+		local buf, tick = ...
+		local current = vim.api.nvim_buf_get_changedtick(0)
+		if buf == vim.api.nvim_get_current_buf() and current == tick then
+			return { tick = current }
+		end
+		return { tick = current, read = true, lines = vim.api.nvim_buf_get_lines(0, 0, -1, false) }
+	`, &content, int(b.id), b.tick)
 	batch.CurrentWindow(&window)
 	batch.WindowCursor(nvim.Window(0), &cursor) // Use 0 for current window
 
 	// Get Neovim's current working directory
 	batch.ExecLua(`return vim.fn.getcwd()`, &nvimCwd, nil)
 
+	// Get the undo sequence number, which drops when changes are undone
+	batch.ExecLua(`return vim.fn.changenr()`, &undoSeq, nil)
+
+	// Get the options deciding whether the buffer gets completions
+	batch.ExecLua(`
+		return {
+			buftype = vim.bo.buftype,
+			modifiable = vim.bo.modifiable,
+			override = vim.b.cursortab_override or "",
+		}
+	`, &options, nil)
+
 	// Get horizontal scroll offset (leftcol) from current window
 	batch.ExecLua(`
 		local view = vim.fn.winsaveview()
@@ -168,19 +229,26 @@ func (b *NvimBuffer) Sync(workspacePath string) (*SyncResult, error) {
 		return nil, err
 	}
 
-	linesStr := make([]string, len(lines))
-	for i, line := range lines {
-		linesStr[i] = string(line[:])
+	if content.Read {
+		// Edits since the checkpoint are only known if none were missed
+		if !slices.Equal(content.Lines, b.lines) {
+			b.editsKnown = false
+		}
+		b.lines = content.Lines
+		if b.lines == nil {
+			b.lines = []string{}
+		}
 	}
+	b.tick = content.Tick
 
 	// Store old path before updating
 	oldPath := b.path
 
 	// Update buffer state
-	b.lines = linesStr
 	b.row = cursor[0]              // Line (vertical position, 1-based in nvim cursor)
 	b.col = cursor[1]              // Column (horizontal position, 0-based in nvim cursor)
 	b.scrollOffsetX = scrollOffset // Horizontal scroll offset
+	b.ineligible = ineligibleReason(options, b.lines, b.config.MaxSize)
 
 	// Update viewport bounds (1-indexed)
 	b.viewportTop = viewportBounds[0]
@@ -189,6 +257,10 @@ func (b *NvimBuffer) Sync(workspacePath string) (*SyncResult, error) {
 	// Convert absolute path to relative workspace path using Neovim's actual cwd
 	relativePath := makeRelativeToWorkspace(path, nvimCwd)
 	b.path = relativePath
+	b.absPath = ""
+	if path != "" {
+		b.absPath = filepath.Clean(path)
+	}
 
 	// Handle buffer change
 	if b.id != currentBuf {
@@ -198,6 +270,7 @@ func (b *NvimBuffer) Sync(workspacePath string) (*SyncResult, error) {
 		b.id = currentBuf
 		b.lastModifiedLine = -1
 		b.version = 0
+		b.undoSeq = undoSeq
 
 		return &SyncResult{
 			BufferChanged: true,
@@ -206,6 +279,11 @@ func (b *NvimBuffer) Sync(workspacePath string) (*SyncResult, error) {
 		}, nil
 	}
 
+	if undoSeq < b.undoSeq {
+		b.dropUndoneDiffs(undoSeq)
+	}
+	b.undoSeq = undoSeq
+
 	// Same buffer - no change
 	return &SyncResult{
 		BufferChanged: false,
@@ -214,6 +292,44 @@ func (b *NvimBuffer) Sync(workspacePath string) (*SyncResult, error) {
 	}, nil
 }
 
+// bufferOptions are the options of a buffer that decide whether it gets
+// completions
+type bufferOptions struct {
+	Buftype    string `msgpack:"buftype"`
+	Modifiable bool   `msgpack:"modifiable"`
+	Override   string `msgpack:"override"` // "enable" or "disable" from :CursortabBuffer, "" otherwise
+}
+
+// ineligibleReason returns why a buffer with options and lines gets no
+// completions, or "" when it does. Help, terminal, quickfix and other special
+// buffers, unmodifiable buffers and buffers over maxSize bytes are skipped,
+// unless the user overrode it for the buffer.
+func ineligibleReason(options bufferOptions, lines []string, maxSize int) string {
+	switch options.Override {
+	case "enable":
+		return ""
+	case "disable":
+		return "disabled for this buffer"
+	}
+	// acwrite buffers are written by an autocmd but otherwise regular files
+	if options.Buftype != "" && options.Buftype != "acwrite" {
+		return fmt.Sprintf("buftype is %s", options.Buftype)
+	}
+	if !options.Modifiable {
+		return "not modifiable"
+	}
+	if maxSize > 0 {
+		size := 0
+		for _, line := range lines {
+			size += len(line) + 1
+			if size > maxSize {
+				return fmt.Sprintf("larger than %d bytes", maxSize)
+			}
+		}
+	}
+	return ""
+}
+
 // Helper function to convert absolute path to relative workspace path
 func makeRelativeToWorkspace(absolutePath, workspacePath string) string {
 	absolutePath = filepath.Clean(absolutePath)
@@ -260,22 +376,132 @@ func (b *NvimBuffer) HasChanges(startLine, endLineInclusive int, lines []string)
 	return false
 }
 
+// undoJoin joins the changes after it with the previous undo block. It fails
+// right after an undo, when there is no block to join.
+const undoJoin = "pcall(vim.cmd.undojoin)"
+
 // nvimBatch wraps nvim.Batch to implement the Batch interface
 type nvimBatch struct {
-	batch *nvim.Batch
+	batch  *nvim.Batch
+	buf    *NvimBuffer
+	anchor *anchor // Nil when the extmarks could not be placed
+	lines  []string
+	diff   *text.DiffResult
 }
 
+// Execute applies the completion at the lines its anchor follows, rebuilding
+// the batch when the buffer shifted since the completion was prepared. The
+// pending edit moves with it, so that accepting verifies and commits it where
+// it was applied.
 func (nb *nvimBatch) Execute() error {
 	if nb.batch == nil {
 		return nil
 	}
+	if nb.anchor != nil {
+		start, end, err := nb.buf.resolveAnchor(nb.anchor)
+		if err != nil {
+			return err
+		}
+		if start != nb.anchor.startLine {
+			logger.Debug("anchor: completion moved from line %d to %d", nb.anchor.startLine, start)
+			nb.batch = nb.buf.getApplyBatch(start, end, nb.lines, nb.diff)
+			nb.buf.movePending(start, end)
+		}
+	}
 	return nb.batch.Execute()
 }
 
+// movePending moves the pending edit to the lines it is applied at.
+func (b *NvimBuffer) movePending(start, end int) {
+	if b.pending != nil {
+		b.pending.StartLine, b.pending.EndLineInclusive = start, end
+	}
+}
+
+// anchor holds the extmarks placed on the first and last line a prepared
+// completion replaces. Extmarks move with the text, so the completion is
+// applied where those lines are at accept time even if a formatter or a
+// linter autofix added or removed lines above them in the meantime.
+type anchor struct {
+	startMark, endMark int // Extmark IDs, endMark is 0 when no line is replaced
+	startLine, endLine int // Lines the extmarks were placed on
+}
+
+// placeAnchor replaces the anchor of the previously prepared completion with
+// extmarks on startLine and endLineInc. Returns nil when they could not be
+// placed, as for completions appending past the last line.
+func (b *NvimBuffer) placeAnchor(startLine, endLineInc int) *anchor {
+	if startLine < 1 || startLine > len(b.lines) || endLineInc > len(b.lines) {
+		return nil
+	}
+	ns, err := b.anchorNamespace()
+	if err != nil {
+		logger.Warn("anchor: %v", err)
+		return nil
+	}
+	a := &anchor{startLine: startLine, endLine: endLineInc}
+	batch := b.client.NewBatch()
+	b.clearNamespace(batch, ns)
+	batch.SetBufferExtmark(b.id, ns, startLine-1, 0, map[string]any{}, &a.startMark)
+	if endLineInc >= startLine {
+		batch.SetBufferExtmark(b.id, ns, endLineInc-1, 0, map[string]any{}, &a.endMark)
+	}
+	if err := batch.Execute(); err != nil {
+		logger.Warn("anchor: placing extmarks: %v", err)
+		return nil
+	}
+	return a
+}
+
+// resolveAnchor returns the lines the completion anchored by a replaces now.
+func (b *NvimBuffer) resolveAnchor(a *anchor) (start, end int, err error) {
+	var startPos, endPos []int
+	batch := b.client.NewBatch()
+	batch.BufferExtmarkByID(b.id, b.anchorNs, a.startMark, map[string]any{}, &startPos)
+	if a.endMark != 0 {
+		batch.BufferExtmarkByID(b.id, b.anchorNs, a.endMark, map[string]any{}, &endPos)
+	}
+	if err := batch.Execute(); err != nil {
+		return 0, 0, fmt.Errorf("reading anchor: %w", err)
+	}
+	return shiftedRange(a, startPos, endPos)
+}
+
+// shiftedRange converts the positions of the extmarks of a (0-indexed, empty
+// when the mark is gone) into the range of lines to replace. It fails when
+// the marks are gone, or when lines were added or removed inside the range,
+// which the completion was not computed for.
+func shiftedRange(a *anchor, startPos, endPos []int) (start, end int, err error) {
+	if len(startPos) < 2 || (a.endMark != 0 && len(endPos) < 2) {
+		return 0, 0, fmt.Errorf("anchor of lines %d-%d is gone", a.startLine, a.endLine)
+	}
+	start = startPos[0] + 1
+	end = start + a.endLine - a.startLine
+	if a.endMark != 0 && endPos[0]+1 != end {
+		return 0, 0, fmt.Errorf("lines %d-%d of the completion changed to %d-%d since it was shown",
+			a.startLine, a.endLine, start, endPos[0]+1)
+	}
+	return start, end, nil
+}
+
+// anchorNamespace returns the namespace of the anchor extmarks, creating it
+// on first use.
+func (b *NvimBuffer) anchorNamespace() (int, error) {
+	if b.anchorNs != 0 {
+		return b.anchorNs, nil
+	}
+	ns, err := b.client.CreateNamespace("cursortab_anchor")
+	if err != nil {
+		return 0, fmt.Errorf("creating namespace: %w", err)
+	}
+	b.anchorNs = ns
+	return ns, nil
+}
+
 // PrepareCompletion prepares a completion for display and returns a batch to apply it
 func (b *NvimBuffer) PrepareCompletion(startLine, endLineInc int, lines []string, groups []*text.Group) Batch {
 	if b.client == nil {
-		return &nvimBatch{batch: nil}
+		return &nvimBatch{}
 	}
 
 	// Compute diff
@@ -288,11 +514,26 @@ func (b *NvimBuffer) PrepareCompletion(startLine, endLineInc int, lines []string
 	}
 
 	// Groups are pre-computed by staging with BufferLine already set
+	if b.config.WordDiff {
+		text.AddWordSpans(groups)
+	}
+	if b.config.InlineDiff {
+		text.AddWordEdits(groups)
+	}
+	b.setCollisions(groups)
 
 	applyBatch := b.getApplyBatch(startLine, endLineInc, lines, diffResult)
+	anchor := b.placeAnchor(startLine, endLineInc)
 
 	// Convert to Lua format
-	luaDiffResult := diffResultToLuaFormat(diffResult, groups, lines, startLine)
+	luaDiffResult := diffResultToLuaFormat(diffResult, groups, lines, startLine, b.config.ColumnUnit)
+	if b.annotation != nil {
+		luaDiffResult["annotation"] = map[string]any{
+			"provider":   b.annotation.Provider,
+			"model":      b.annotation.Model,
+			"latency_ms": b.annotation.Latency.Milliseconds(),
+		}
+	}
 
 	// Debug logging for data sent to Lua
 	if jsonData, err := json.Marshal(luaDiffResult); err == nil {
@@ -302,7 +543,56 @@ func (b *NvimBuffer) PrepareCompletion(startLine, endLineInc int, lines []string
 
 	b.executeLuaFunction("require('cursortab').on_completion_ready(...)", luaDiffResult)
 
-	return &nvimBatch{batch: applyBatch}
+	return &nvimBatch{batch: applyBatch, buf: b, anchor: anchor, lines: lines, diff: diffResult}
+}
+
+// setCollisions sets the Collisions of each group to the virtual text other
+// namespaces show on its BufferLine.
+func (b *NvimBuffer) setCollisions(groups []*text.Group) {
+	if len(groups) == 0 {
+		return
+	}
+	lines := make([]int, len(groups))
+	for i, g := range groups {
+		lines[i] = g.BufferLine
+	}
+	var raw []any
+	if err := b.client.ExecLua(`return require('cursortab.ui').virt_text_on_lines(...)`, &raw, int(b.id), lines); err != nil {
+		logger.Warn("virtual text collisions: %v", err)
+		return
+	}
+	for i, virtText := range parseVirtText(raw) {
+		if i < len(groups) {
+			groups[i].Collisions = virtText
+		}
+	}
+}
+
+// parseVirtText converts the virtual text found on each line by
+// virt_text_on_lines.
+func parseVirtText(raw []any) [][]text.VirtText {
+	result := make([][]text.VirtText, len(raw))
+	for i, line := range raw {
+		marks, _ := line.([]any)
+		for _, mark := range marks {
+			m, ok := mark.(map[string]any)
+			if !ok {
+				continue
+			}
+			result[i] = append(result[i], text.VirtText{
+				Col:   getNumber(m, "col"),
+				Pos:   getString(m, "pos"),
+				Width: getNumber(m, "width"),
+			})
+		}
+	}
+	return result
+}
+
+// SetAnnotation sets the provider and model sent with the completions
+// prepared from now on, for the annotation shown next to them.
+func (b *NvimBuffer) SetAnnotation(a *types.Annotation) {
+	b.annotation = a
 }
 
 // CommitPending applies the pending edit to buffer state, increments version,
@@ -324,10 +614,37 @@ func (b *NvimBuffer) CommitPending() {
 
 	// Extract granular diffs - one DiffEntry per contiguous changed region
 	diffEntries := extractGranularDiffs(originalRangeLines, lines)
+	b.undoSeq = b.readUndoSeq()
+	for _, entry := range diffEntries {
+		entry.UndoSeq = b.undoSeq
+	}
 	b.diffHistories = append(b.diffHistories, diffEntries...)
 
-	// Compute the final buffer state after applying the completion
-	newLines := make([]string, 0, len(b.lines)-((endLineInclusive-startLine)+1)+len(lines))
+	newLines := b.pendingResult()
+
+	// Reset checkpoint to current state for next working diff
+	b.originalLines = newLines
+
+	// Save current lines as previous state BEFORE updating (for sweep provider)
+	b.previousLines = b.lines
+
+	// Commit the new content and bump version. The changes the apply made
+	// are already in it, so the next sync reads it in full instead.
+	b.lines = newLines
+	b.version++
+	b.DetachLines()
+	b.resetEdits()
+
+	b.pending = nil
+}
+
+// pendingResult returns the buffer content expected once the pending edit is applied.
+func (b *NvimBuffer) pendingResult() []string {
+	startLine := b.pending.StartLine
+	endLineInclusive := b.pending.EndLineInclusive
+	lines := b.pending.Lines
+
+	newLines := make([]string, 0, max(len(b.lines)-((endLineInclusive-startLine)+1)+len(lines), 0))
 	if startLine-1 > 0 && startLine-1 <= len(b.lines) {
 		newLines = append(newLines, b.lines[:startLine-1]...)
 	}
@@ -335,21 +652,94 @@ func (b *NvimBuffer) CommitPending() {
 	if endLineInclusive < len(b.lines) {
 		newLines = append(newLines, b.lines[endLineInclusive:]...)
 	}
+	return newLines
+}
 
-	// Reset checkpoint to current state for next working diff
-	b.originalLines = make([]string, len(newLines))
-	copy(b.originalLines, newLines)
+// VerifyPending reads the buffer back and returns an error describing the
+// first difference when it does not hold the result of the pending edit.
+func (b *NvimBuffer) VerifyPending() error {
+	if b.pending == nil {
+		return nil
+	}
+	actual, err := b.readLines()
+	if err != nil {
+		return err
+	}
+	return compareLines(b.pendingResult(), actual)
+}
 
-	// Save current lines as previous state BEFORE updating (for sweep provider)
-	b.previousLines = make([]string, len(b.lines))
-	copy(b.previousLines, b.lines)
+// Rollback restores the content the buffer held at the last sync, undoing an
+// edit that was only partly applied, and drops the pending edit.
+func (b *NvimBuffer) Rollback() error {
+	b.pending = nil
+	b.DetachLines()
+	if b.client == nil {
+		return fmt.Errorf("nvim client not set")
+	}
+	actual, err := b.readLines()
+	if err != nil {
+		return err
+	}
+	start, end, lines, changed := restoreRange(actual, b.lines)
+	if !changed {
+		return nil
+	}
 
-	// Commit the new content and bump version
-	b.lines = make([]string, len(newLines))
-	copy(b.lines, newLines)
-	b.version++
+	replacement := make([][]byte, len(lines))
+	for i, line := range lines {
+		replacement[i] = []byte(line)
+	}
+	batch := b.client.NewBatch()
+	b.clearNamespace(batch, b.config.NsID)
+	batch.ExecLua(undoJoin, nil, nil)
+	batch.SetBufferLines(b.id, start, end, false, replacement)
+	return batch.Execute()
+}
 
-	b.pending = nil
+// readLines returns the current content of the buffer.
+func (b *NvimBuffer) readLines() ([]string, error) {
+	if b.client == nil {
+		return nil, fmt.Errorf("nvim client not set")
+	}
+	raw, err := b.client.BufferLines(b.id, 0, -1, false)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, len(raw))
+	for i, line := range raw {
+		lines[i] = string(line)
+	}
+	return lines, nil
+}
+
+// compareLines returns an error naming the first line where actual differs from expected.
+func compareLines(expected, actual []string) error {
+	for i := 0; i < min(len(expected), len(actual)); i++ {
+		if expected[i] != actual[i] {
+			return fmt.Errorf("line %d is %q, expected %q", i+1, actual[i], expected[i])
+		}
+	}
+	if len(expected) != len(actual) {
+		return fmt.Errorf("buffer has %d lines, expected %d", len(actual), len(expected))
+	}
+	return nil
+}
+
+// restoreRange finds the smallest edit turning actual back into original:
+// actual[start:end] (0-indexed, end exclusive) is replaced by lines.
+func restoreRange(actual, original []string) (start, end int, lines []string, changed bool) {
+	for start < len(actual) && start < len(original) && actual[start] == original[start] {
+		start++
+	}
+	if start == len(actual) && start == len(original) {
+		return 0, 0, nil, false
+	}
+	suffix := 0
+	for suffix < len(actual)-start && suffix < len(original)-start &&
+		actual[len(actual)-1-suffix] == original[len(original)-1-suffix] {
+		suffix++
+	}
+	return start, len(actual) - suffix, original[start : len(original)-suffix], true
 }
 
 // CommitUserEdits extracts diffs between originalLines checkpoint and current lines,
@@ -357,42 +747,92 @@ func (b *NvimBuffer) CommitPending() {
 // Call this when leaving insert mode to capture manual edits.
 // Returns true if any changes were committed, false if no changes.
 func (b *NvimBuffer) CommitUserEdits() bool {
+	// The changes applied since the checkpoint tell what was edited
+	if original, current, ok := b.editedRanges(); ok {
+		if slices.Equal(original, current) {
+			return false
+		}
+		return b.commitUserEditsInternal(original, current)
+	}
+
 	// Quick check: if lengths differ, there are changes
 	if len(b.lines) != len(b.originalLines) {
-		return b.commitUserEditsInternal()
+		return b.commitUserEditsInternal(b.originalLines, b.lines)
 	}
 
 	// Check for content differences
 	for i := range b.lines {
 		if b.lines[i] != b.originalLines[i] {
-			return b.commitUserEditsInternal()
+			return b.commitUserEditsInternal(b.originalLines, b.lines)
 		}
 	}
 
 	return false // No changes
 }
 
-func (b *NvimBuffer) commitUserEditsInternal() bool {
+// commitUserEditsInternal commits the edits turning original into current,
+// the parts of the checkpoint and the current lines that differ.
+func (b *NvimBuffer) commitUserEditsInternal(original, current []string) bool {
 	// Extract granular diffs between checkpoint and current state
-	diffEntries := extractGranularDiffs(b.originalLines, b.lines)
+	diffEntries := extractGranularDiffs(original, current)
 	if len(diffEntries) == 0 {
 		return false
 	}
 
+	for _, entry := range diffEntries {
+		entry.UndoSeq = b.undoSeq
+	}
 	b.diffHistories = append(b.diffHistories, diffEntries...)
 
-	// Save checkpoint as previous state (for sweep provider)
-	b.previousLines = make([]string, len(b.originalLines))
-	copy(b.previousLines, b.originalLines)
+	// Save checkpoint as previous state (for sweep provider). Neither is
+	// modified in place, so they are shared rather than copied.
+	b.previousLines = b.originalLines
 
 	// Reset checkpoint to current state
-	b.originalLines = make([]string, len(b.lines))
-	copy(b.originalLines, b.lines)
+	b.originalLines = b.lines
+	b.resetEdits()
 
 	b.version++
 	return true
 }
 
+// readUndoSeq returns the current undo sequence number, or the last synced one
+// when the editor can't be asked.
+func (b *NvimBuffer) readUndoSeq() int {
+	if b.client == nil {
+		return b.undoSeq
+	}
+	var seq int
+	if err := b.client.ExecLua(`return vim.fn.changenr()`, &seq); err != nil {
+		logger.Error("error reading undo sequence: %v", err)
+		return b.undoSeq
+	}
+	return seq
+}
+
+// dropUndoneDiffs removes the diff entries for changes undone back to undoSeq,
+// so reverted edits don't linger in the history sent to providers. The
+// checkpoint moves to the current content, since the diff against the old
+// one would only restate the undo.
+func (b *NvimBuffer) dropUndoneDiffs(undoSeq int) {
+	kept := b.diffHistories[:0:0]
+	for _, entry := range b.diffHistories {
+		if entry.UndoSeq <= undoSeq {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == len(b.diffHistories) {
+		return
+	}
+	logger.Debug("undo to %d reverted %d diff entries", undoSeq, len(b.diffHistories)-len(kept))
+	b.diffHistories = kept
+
+	b.previousLines = b.originalLines
+	b.originalLines = b.lines
+	b.resetEdits()
+	b.version++
+}
+
 // ShowCursorTarget displays a cursor prediction indicator at the given line
 func (b *NvimBuffer) ShowCursorTarget(line int) error {
 	if b.client == nil {
@@ -403,6 +843,165 @@ func (b *NvimBuffer) ShowCursorTarget(line int) error {
 	return nil
 }
 
+// ShowFileTarget displays a jump indicator for a stage in another file, with a
+// summary of every file the completion edits
+func (b *NvimBuffer) ShowFileTarget(path string, line int, summary *text.MultiFileSummary) error {
+	if b.client == nil {
+		return fmt.Errorf("nvim client not set")
+	}
+	var files []map[string]any
+	for _, f := range summary.Files {
+		files = append(files, map[string]any{
+			"path":      f.Path,
+			"stages":    f.Stages,
+			"additions": f.Additions,
+			"deletions": f.Deletions,
+		})
+	}
+	luaSummary := map[string]any{
+		"files":        files,
+		"current_file": summary.CurrentFile + 1,
+	}
+	logger.Debug("sending to lua on_file_target_ready: path=%s line=%d", path, line)
+	b.executeLuaFunction("require('cursortab').on_file_target_ready(...)", path, line, luaSummary)
+	return nil
+}
+
+// ShowPlaceholders hands the placeholders of an accepted completion to the
+// editor. Columns are byte offsets, as extmarks take them.
+func (b *NvimBuffer) ShowPlaceholders(placeholders []text.Placeholder) error {
+	if b.client == nil {
+		return fmt.Errorf("nvim client not set")
+	}
+	luaPlaceholders := make([]map[string]any, len(placeholders))
+	for i, p := range placeholders {
+		luaPlaceholders[i] = map[string]any{
+			"line":      p.Line,
+			"col_start": p.Start,
+			"col_end":   p.End,
+		}
+	}
+	logger.Debug("sending to lua on_placeholders_ready: %d placeholders", len(placeholders))
+	b.executeLuaFunction("require('cursortab').on_placeholders_ready(...)", luaPlaceholders)
+	return nil
+}
+
+// DimCompletion dims the shown completion, or restores it.
+func (b *NvimBuffer) DimCompletion(dimmed bool) error {
+	if b.client == nil {
+		return fmt.Errorf("nvim client not set")
+	}
+	logger.Debug("sending to lua on_completion_dimmed: %v", dimmed)
+	b.executeLuaFunction("require('cursortab').on_completion_dimmed(...)", dimmed)
+	return nil
+}
+
+// StreamStage pushes a stage finalized while the completion is still
+// streaming, in the render format of PrepareCompletion plus its 1-indexed
+// position in the stream and whether it is the stage shown as the completion.
+func (b *NvimBuffer) StreamStage(stage *text.Stage, index int, shown bool) error {
+	if b.client == nil {
+		return fmt.Errorf("nvim client not set")
+	}
+	diffResult := b.getDiffResult(stage.BufferStart, stage.BufferEnd, stage.Lines)
+	payload := diffResultToLuaFormat(diffResult, stage.Groups, stage.Lines, stage.BufferStart, b.config.ColumnUnit)
+	payload["stage"] = index
+	payload["shown"] = shown
+	logger.Debug("sending to lua on_stage_streamed: stage %d, lines %d-%d", index, stage.BufferStart, stage.BufferEnd)
+	b.executeLuaFunction("require('cursortab').on_stage_streamed(...)", payload)
+	return nil
+}
+
+// ImportEdits asks the language servers attached to the buffer for the code
+// action adding the imports lines first to last need, waiting at most timeout.
+// Returns its edits to the buffer and the position encoding of their columns,
+// or nil if no server offered one.
+func (b *NvimBuffer) ImportEdits(first, last int, timeout time.Duration) ([]imports.TextEdit, string) {
+	if b.client == nil {
+		return nil, ""
+	}
+
+	var result map[string]any
+	if err := b.client.ExecLua(
+		`return require('cursortab.lsp').import_edits(...)`,
+		&result, int(b.id), first, last, int(timeout.Milliseconds()),
+	); err != nil {
+		logger.Error("error getting import edits: %v", err)
+		return nil, ""
+	}
+
+	var edits []imports.TextEdit
+	list, _ := result["edits"].([]any)
+	for _, item := range list {
+		em, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		edits = append(edits, imports.TextEdit{
+			StartLine: getNumber(em, "start_line"),
+			StartCol:  getNumber(em, "start_col"),
+			EndLine:   getNumber(em, "end_line"),
+			EndCol:    getNumber(em, "end_col"),
+			NewText:   getString(em, "new_text"),
+		})
+	}
+	return edits, getString(result, "encoding")
+}
+
+// OpenFile opens the file at path in the current window and moves the cursor to line
+func (b *NvimBuffer) OpenFile(path string, line int) error {
+	if b.client == nil {
+		return fmt.Errorf("nvim client not set")
+	}
+	return b.client.ExecLua(`
+		local path, line = ...
+		vim.cmd.edit(vim.fn.fnameescape(path))
+		line = math.min(line, vim.api.nvim_buf_line_count(0))
+		vim.api.nvim_win_set_cursor(0, { line, 0 })
+	`, nil, path, line)
+}
+
+// NotifyUntrusted tells the editor that completions are blocked until the workspace is trusted
+func (b *NvimBuffer) NotifyUntrusted(workspacePath string) {
+	if b.client == nil {
+		return
+	}
+	b.executeLuaFunction("require('cursortab').on_untrusted(...)", workspacePath)
+}
+
+// NotifyProviderChanged tells the editor which provider now serves completions
+func (b *NvimBuffer) NotifyProviderChanged(name string) {
+	if b.client == nil {
+		return
+	}
+	b.executeLuaFunction("require('cursortab').on_provider_changed(...)", name)
+}
+
+// NotifyApplyFailed sends the JSON-encoded failure of a completion that could
+// not be applied, with the trace ID to look up in the log
+func (b *NvimBuffer) NotifyApplyFailed(failureJSON string) {
+	if b.client == nil {
+		return
+	}
+	b.executeLuaFunction("require('cursortab').on_apply_failed(...)", failureJSON)
+}
+
+// NotifyProgress sends the JSON-encoded statusline progress to the editor
+func (b *NvimBuffer) NotifyProgress(progressJSON string) {
+	if b.client == nil {
+		return
+	}
+	b.executeLuaFunction("require('cursortab').on_progress(...)", progressJSON)
+}
+
+// NotifyEvent sends a JSON-encoded engine notification to the editor
+func (b *NvimBuffer) NotifyEvent(notificationJSON string) {
+	if b.client == nil {
+		return
+	}
+	b.executeLuaFunction("require('cursortab').on_event(...)", notificationJSON)
+}
+
 // ClearUI clears the completion UI
 func (b *NvimBuffer) ClearUI() error {
 	if b.client == nil {
@@ -417,18 +1016,52 @@ func (b *NvimBuffer) ClearUI() error {
 	return nil
 }
 
-// MoveCursor moves the cursor to the start of the specified line
-func (b *NvimBuffer) MoveCursor(line int, center bool, mark bool) error {
+// MoveCursor moves the cursor to the 0-indexed byte col of the specified
+// line, or to the first non-blank character of the line when col < 0
+func (b *NvimBuffer) MoveCursor(line, col int, center bool, mark bool) error {
 	if b.client == nil {
 		return fmt.Errorf("nvim client not set")
 	}
 
 	batch := b.client.NewBatch()
-	applyCursorMove(batch, line, 0, center, mark)
-	batch.ExecLua("vim.cmd('normal! ^')", nil, nil) // Move cursor to start of line
+	applyCursorMove(batch, line, max(col, 0), center, mark)
+	if col < 0 {
+		batch.ExecLua("vim.cmd('normal! ^')", nil, nil) // Move cursor to start of line
+	}
 	return batch.Execute()
 }
 
+// ClosedFold returns the first and last line of the closed fold hiding line in
+// the current window, or 0, 0 when line is not folded
+func (b *NvimBuffer) ClosedFold(line int) (start, end int) {
+	if b.client == nil {
+		return 0, 0
+	}
+	var fold [2]int
+	if err := b.client.ExecLua(`
+		local line = ...
+		return { vim.fn.foldclosed(line), vim.fn.foldclosedend(line) }
+	`, &fold, line); err != nil {
+		logger.Error("error reading fold state: %v", err)
+		return 0, 0
+	}
+	if fold[0] < 1 {
+		return 0, 0
+	}
+	return fold[0], fold[1]
+}
+
+// OpenFold opens the closed folds hiding line in the current window
+func (b *NvimBuffer) OpenFold(line int) error {
+	if b.client == nil {
+		return fmt.Errorf("nvim client not set")
+	}
+	return b.client.ExecLua(`
+		local line = ...
+		vim.cmd(line .. "foldopen!")
+	`, nil, line)
+}
+
 // InsertText inserts text at the specified position (1-indexed line, 0-indexed col)
 func (b *NvimBuffer) InsertText(line, col int, text string) error {
 	if b.client == nil {
@@ -483,6 +1116,43 @@ func (b *NvimBuffer) ReplaceLine(line int, content string) error {
 	return batch.Execute()
 }
 
+// ApplyInPlace replaces lines startLine..endLineInclusive (1-indexed) without
+// moving the cursor or scrolling: the cursor and the top of the window stay on
+// the same text when lines above them are added or removed. Marks the edit as
+// pending, like an accepted completion.
+func (b *NvimBuffer) ApplyInPlace(startLine, endLineInclusive int, lines []string) error {
+	if b.client == nil {
+		return fmt.Errorf("nvim client not set")
+	}
+
+	batch := b.client.NewBatch()
+	b.clearNamespace(batch, b.config.NsID)
+	batch.ExecLua(`
+		local buf, first, last, lines = ...
+		local view = vim.fn.winsaveview()
+		vim.api.nvim_buf_set_lines(buf, first - 1, last, false, lines)
+		local delta = #lines - (last - first + 1)
+		if view.lnum > last then
+			view.lnum = view.lnum + delta
+		end
+		if view.topline > last then
+			view.topline = view.topline + delta
+		end
+		view.lnum = math.max(1, math.min(view.lnum, vim.api.nvim_buf_line_count(buf)))
+		vim.fn.winrestview(view)
+	`, nil, int(b.id), startLine, endLineInclusive, lines)
+	if err := batch.Execute(); err != nil {
+		return err
+	}
+
+	b.pending = &PendingEdit{
+		StartLine:        startLine,
+		EndLineInclusive: endLineInclusive,
+		Lines:            append([]string{}, lines...),
+	}
+	return nil
+}
+
 // InsertLine inserts a new line at the given position (1-indexed), pushing existing lines down
 func (b *NvimBuffer) InsertLine(line int, content string) error {
 	if b.client == nil {
@@ -645,6 +1315,8 @@ func (b *NvimBuffer) TreesitterSymbols(row, col, maxSiblings int) *types.Treesit
 
 	ctx := &types.TreesitterContext{
 		EnclosingSignature: getString(result, "enclosing_signature"),
+		EnclosingStart:     getNumber(result, "enclosing_start"),
+		EnclosingEnd:       getNumber(result, "enclosing_end"),
 	}
 
 	// Parse siblings
@@ -655,6 +1327,7 @@ func (b *NvimBuffer) TreesitterSymbols(row, col, maxSiblings int) *types.Treesit
 					Name:      getString(sm, "name"),
 					Signature: getString(sm, "signature"),
 					Line:      getNumber(sm, "line"),
+					EndLine:   getNumber(sm, "end_line"),
 				})
 			}
 		}
@@ -677,6 +1350,53 @@ func (b *NvimBuffer) TreesitterSymbols(row, col, maxSiblings int) *types.Treesit
 	return ctx
 }
 
+// LSPSymbols asks the language servers attached to the buffer for the hover
+// text and definition of up to maxSymbols identifiers around the cursor,
+// waiting at most timeout for their answers. Definitions in the buffer itself
+// are left out. Returns nil if no server answered.
+func (b *NvimBuffer) LSPSymbols(row, col, maxSymbols int, timeout time.Duration) *types.LSPContext {
+	if b.client == nil {
+		return nil
+	}
+
+	var result []map[string]any
+	batch := b.client.NewBatch()
+	batch.ExecLua(
+		`return require('cursortab.lsp').get_context(...)`,
+		&result, int(b.id), row, col, maxSymbols, int(timeout.Milliseconds()),
+	)
+
+	if err := batch.Execute(); err != nil {
+		logger.Error("error getting lsp symbols: %v", err)
+		return nil
+	}
+
+	ctx := &types.LSPContext{}
+	for _, sm := range result {
+		symbol := &types.LSPSymbol{
+			Name:           getString(sm, "name"),
+			Hover:          getString(sm, "hover"),
+			DefinitionPath: getString(sm, "definition_path"),
+			DefinitionLine: getNumber(sm, "definition_line"),
+		}
+		if lines, ok := sm["definition"].([]any); ok {
+			for _, line := range lines {
+				if s, ok := line.(string); ok {
+					symbol.Definition = append(symbol.Definition, s)
+				}
+			}
+		}
+		if symbol.Hover != "" || len(symbol.Definition) > 0 {
+			ctx.Symbols = append(ctx.Symbols, symbol)
+		}
+	}
+
+	if len(ctx.Symbols) == 0 {
+		return nil
+	}
+	return ctx
+}
+
 // RegisterEventHandler registers a handler for nvim RPC events
 func (b *NvimBuffer) RegisterEventHandler(handler func(event string)) error {
 	if b.client == nil {
@@ -741,6 +1461,8 @@ func (b *NvimBuffer) getApplyBatch(startLine, endLineInclusive int, lines []stri
 	// execute lua to actually clear the lines within the range beforehand
 	applyBatch.ExecLua(fmt.Sprintf("vim.cmd('normal! %v,%vd')", startLine, endLineInclusive), nil, nil)
 
+	// One undo step for the whole stage, which a rollback joins as well
+	applyBatch.ExecLua(undoJoin, nil, nil)
 	applyBatch.SetBufferLines(b.id, startLine-1, endLineInclusive, false, placeBytes)
 
 	// Apply cursor positioning from diff changes
@@ -765,10 +1487,14 @@ func (b *NvimBuffer) clearNamespace(batch *nvim.Batch, nsID int) {
 	batch.ClearBufferNamespace(b.id, nsID, 0, -1)
 }
 
-// diffResultToLuaFormat converts diff result and groups to a format suitable for Lua rendering
-func diffResultToLuaFormat(diffResult *text.DiffResult, groups []*text.Group, newLines []string, startLine int) map[string]any {
+// diffResultToLuaFormat converts diff result and groups to a format suitable for Lua rendering.
+// Columns are converted from bytes to unit.
+func diffResultToLuaFormat(diffResult *text.DiffResult, groups []*text.Group, newLines []string, startLine int, unit text.ColumnUnit) map[string]any {
 	// Compute cursor position
 	cursorLine, cursorCol := text.CalculateCursorPosition(diffResult.Changes, newLines)
+	if cursorLine >= 1 && cursorLine <= len(newLines) {
+		cursorCol = text.ConvertColumn(newLines[cursorLine-1], cursorCol, unit)
+	}
 
 	// Build groups array for Lua
 	var luaGroups []map[string]any
@@ -784,9 +1510,31 @@ func diffResultToLuaFormat(diffResult *text.DiffResult, groups []*text.Group, ne
 
 		// Add render hint for character-level optimizations
 		if g.RenderHint != "" {
+			// delete_chars columns point into the old line, the others into the new one
+			line := firstLine(g.Lines)
+			if g.RenderHint == "delete_chars" {
+				line = firstLine(g.OldLines)
+			}
 			luaGroup["render_hint"] = g.RenderHint
-			luaGroup["col_start"] = g.ColStart
-			luaGroup["col_end"] = g.ColEnd
+			luaGroup["col_start"] = text.ConvertColumn(line, g.ColStart, unit)
+			luaGroup["col_end"] = text.ConvertColumn(line, g.ColEnd, unit)
+		}
+
+		if g.Spans != nil {
+			luaGroup["old_spans"] = spansToLuaFormat(g.OldSpans, g.OldLines, unit)
+			luaGroup["spans"] = spansToLuaFormat(g.Spans, g.Lines, unit)
+		}
+
+		if g.Edits != nil {
+			luaGroup["edits"] = editsToLuaFormat(g.Edits, g.OldLines, unit)
+		}
+
+		if len(g.Collisions) > 0 {
+			collisions := make([]map[string]any, len(g.Collisions))
+			for i, c := range g.Collisions {
+				collisions[i] = map[string]any{"col": c.Col, "pos": c.Pos, "width": c.Width}
+			}
+			luaGroup["collisions"] = collisions
 		}
 
 		luaGroups = append(luaGroups, luaGroup)
@@ -800,6 +1548,50 @@ func diffResultToLuaFormat(diffResult *text.DiffResult, groups []*text.Group, ne
 	}
 }
 
+// editsToLuaFormat converts the word edits of each line to lists of
+// {old_start, old_end, text}, with the columns in unit.
+func editsToLuaFormat(editsPerLine [][]text.WordEdit, oldLines []string, unit text.ColumnUnit) [][]map[string]any {
+	out := make([][]map[string]any, len(editsPerLine))
+	for i, edits := range editsPerLine {
+		out[i] = make([]map[string]any, len(edits))
+		line := ""
+		if i < len(oldLines) {
+			line = oldLines[i]
+		}
+		for j, e := range edits {
+			out[i][j] = map[string]any{
+				"old_start": text.ConvertColumn(line, e.OldStart, unit),
+				"old_end":   text.ConvertColumn(line, e.OldEnd, unit),
+				"text":      e.Text,
+			}
+		}
+	}
+	return out
+}
+
+// spansToLuaFormat converts the spans of each of lines to lists of {start, end} pairs in unit.
+func spansToLuaFormat(spansPerLine [][]text.ColSpan, lines []string, unit text.ColumnUnit) [][][2]int {
+	out := make([][][2]int, len(spansPerLine))
+	for i, spans := range spansPerLine {
+		out[i] = make([][2]int, len(spans))
+		for j, s := range spans {
+			line := ""
+			if i < len(lines) {
+				line = lines[i]
+			}
+			out[i][j] = [2]int{text.ConvertColumn(line, s.Start, unit), text.ConvertColumn(line, s.End, unit)}
+		}
+	}
+	return out
+}
+
+func firstLine(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return lines[0]
+}
+
 // CopilotClientInfo contains information about an attached Copilot LSP client
 type CopilotClientInfo struct {
 	ID             int
@@ -940,58 +1732,57 @@ func (b *NvimBuffer) RegisterCopilotHandler(handler func(reqID int64, editsJSON
 	})
 }
 
+// diffContextLines is how many unchanged lines compressDiffEntries keeps
+// around each changed hunk.
+const diffContextLines = 2
+
 // extractGranularDiffs analyzes old and new lines and returns DiffEntry records
 // for each contiguous region that changed.
 func extractGranularDiffs(oldLines, newLines []string) []*types.DiffEntry {
-	oldText := text.JoinLines(oldLines)
-	newText := text.JoinLines(newLines)
-
-	if oldText == newText {
-		return nil
-	}
-
-	dmp := diffmatchpatch.New()
-	chars1, chars2, lineArray := dmp.DiffLinesToChars(oldText, newText)
-	diffs := dmp.DiffMain(chars1, chars2, false)
-	lineDiffs := dmp.DiffCharsToLines(diffs, lineArray)
-
 	var entries []*types.DiffEntry
+	for _, hunk := range text.DiffHunks(oldLines, newLines, 0) {
+		entries = append(entries, &types.DiffEntry{
+			Original: strings.Join(hunk.OldLines, "\n"),
+			Updated:  strings.Join(hunk.NewLines, "\n"),
+		})
+	}
+	return entries
+}
 
-	for i := 0; i < len(lineDiffs); i++ {
-		diff := lineDiffs[i]
-
-		switch diff.Type {
-		case diffmatchpatch.DiffEqual:
-			// No change, skip
-			continue
-
-		case diffmatchpatch.DiffDelete:
-			// Get the deleted content (trim trailing newline from diff output)
-			deletedText := strings.TrimSuffix(diff.Text, "\n")
-			insertedText := ""
-
-			// Check if followed by an insert (modification pattern)
-			if i+1 < len(lineDiffs) && lineDiffs[i+1].Type == diffmatchpatch.DiffInsert {
-				insertedText = strings.TrimSuffix(lineDiffs[i+1].Text, "\n")
-				i++ // Skip the insert in next iteration
+// compressDiffEntries replaces each entry that spans unchanged lines with an
+// entry per changed hunk and diffContextLines of context, so whole-file
+// before/after blobs don't fill the prompt. Other entries are kept as is.
+func compressDiffEntries(entries []*types.DiffEntry) []*types.DiffEntry {
+	var result []*types.DiffEntry
+	for _, entry := range entries {
+		hunks := text.DiffHunks(entryLines(entry.Original), entryLines(entry.Updated), diffContextLines)
+		compressed := make([]*types.DiffEntry, 0, len(hunks))
+		size := 0
+		for _, hunk := range hunks {
+			c := &types.DiffEntry{
+				Original: strings.Join(hunk.OldLines, "\n"),
+				Updated:  strings.Join(hunk.NewLines, "\n"),
+				UndoSeq:  entry.UndoSeq,
 			}
-
-			entries = append(entries, &types.DiffEntry{
-				Original: deletedText,
-				Updated:  insertedText,
-			})
-
-		case diffmatchpatch.DiffInsert:
-			// Pure insertion (no preceding delete)
-			insertedText := strings.TrimSuffix(diff.Text, "\n")
-			entries = append(entries, &types.DiffEntry{
-				Original: "",
-				Updated:  insertedText,
-			})
+			compressed = append(compressed, c)
+			size += len(c.Original) + len(c.Updated)
+		}
+		if len(hunks) == 0 || size >= len(entry.Original)+len(entry.Updated) {
+			result = append(result, entry)
+			continue
 		}
+		result = append(result, compressed...)
 	}
+	return result
+}
 
-	return entries
+// entryLines splits the content of a diff entry into lines. Empty content
+// has no lines.
+func entryLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
 }
 
 // Helper function to safely get string from map
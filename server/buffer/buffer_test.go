@@ -2,7 +2,10 @@ package buffer
 
 import (
 	"cursortab/assert"
+	"cursortab/text"
 	"cursortab/types"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -156,6 +159,62 @@ func TestSetFileContext_AllNil(t *testing.T) {
 	assert.Equal(t, 0, len(buf.diffHistories), "diffHistories empty")
 }
 
+func TestSetFileContext_ForgetsUndoSeqFromOtherTree(t *testing.T) {
+	buf := New(Config{NsID: 1})
+	buf.undoSeq = 5
+	diffs := []*types.DiffEntry{{Original: "a", Updated: "b", UndoSeq: 3}, {Original: "b", Updated: "c", UndoSeq: 9}}
+
+	buf.SetFileContext(nil, nil, diffs)
+
+	assert.Equal(t, 3, buf.diffHistories[0].UndoSeq, "comparable seq kept")
+	assert.Equal(t, 0, buf.diffHistories[1].UndoSeq, "seq past current cleared")
+	assert.Equal(t, 9, diffs[1].UndoSeq, "caller's entry untouched")
+}
+
+// --- Undo Tests ---
+
+func TestCommitUserEdits_TagsUndoSeq(t *testing.T) {
+	buf := New(Config{NsID: 1})
+	buf.undoSeq = 4
+	buf.lines = []string{"changed"}
+	buf.originalLines = []string{"original"}
+
+	buf.CommitUserEdits()
+
+	assert.Equal(t, 4, buf.diffHistories[0].UndoSeq, "entry tagged with undo seq")
+}
+
+func TestDropUndoneDiffs(t *testing.T) {
+	buf := New(Config{NsID: 1})
+	buf.diffHistories = []*types.DiffEntry{
+		{Original: "a", Updated: "b", UndoSeq: 2},
+		{Original: "b", Updated: "c", UndoSeq: 5},
+		{Original: "x", Updated: "y", UndoSeq: 0},
+	}
+	buf.lines = []string{"b"}
+	buf.originalLines = []string{"c"}
+
+	buf.dropUndoneDiffs(3)
+
+	assert.Len(t, 2, buf.diffHistories, "undone entry dropped")
+	assert.Equal(t, "b", buf.diffHistories[0].Updated, "earlier entry kept")
+	assert.Equal(t, "y", buf.diffHistories[1].Updated, "untagged entry kept")
+	assert.Equal(t, "b", buf.originalLines[0], "checkpoint moved to undone content")
+	assert.False(t, buf.CommitUserEdits(), "undo not recorded as a new edit")
+}
+
+func TestDropUndoneDiffs_NothingUndone(t *testing.T) {
+	buf := New(Config{NsID: 1})
+	buf.diffHistories = []*types.DiffEntry{{Original: "a", Updated: "b", UndoSeq: 2}}
+	buf.lines = []string{"b", "typing"}
+	buf.originalLines = []string{"b"}
+
+	buf.dropUndoneDiffs(2)
+
+	assert.Len(t, 1, buf.diffHistories, "entry kept")
+	assert.Equal(t, 1, len(buf.originalLines), "checkpoint unchanged")
+}
+
 // --- extractGranularDiffs Tests ---
 
 func TestExtractGranularDiffs_NoChanges(t *testing.T) {
@@ -203,6 +262,27 @@ func TestExtractGranularDiffs_Deletion(t *testing.T) {
 	assert.True(t, len(result) > 0, "should have diffs for deletion")
 }
 
+func TestCompressDiffEntries(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 1; i <= 30; i++ {
+		oldLines = append(oldLines, fmt.Sprintf("line %d", i))
+		newLines = append(newLines, fmt.Sprintf("line %d", i))
+	}
+	newLines[9] = "changed 10"
+	granular := &types.DiffEntry{Original: "original", Updated: "modified", UndoSeq: 3}
+	blob := &types.DiffEntry{Original: strings.Join(oldLines, "\n"), Updated: strings.Join(newLines, "\n"), UndoSeq: 4}
+
+	result := compressDiffEntries([]*types.DiffEntry{granular, blob})
+
+	assert.Len(t, 2, result, "entries")
+	assert.True(t, result[0] == granular, "entry without unchanged lines kept")
+	assert.Equal(t, &types.DiffEntry{
+		Original: "line 8\nline 9\nline 10\nline 11\nline 12",
+		Updated:  "line 8\nline 9\nchanged 10\nline 11\nline 12",
+		UndoSeq:  4,
+	}, result[1], "blob reduced to its hunk")
+}
+
 func TestMakeRelativeToWorkspace(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -237,3 +317,152 @@ func TestMakeRelativeToWorkspace(t *testing.T) {
 		})
 	}
 }
+
+func TestIneligibleReason(t *testing.T) {
+	regular := bufferOptions{Modifiable: true}
+	lines := []string{"package main", ""}
+
+	tests := []struct {
+		name    string
+		options bufferOptions
+		maxSize int
+		want    string
+	}{
+		{"regular file", regular, 0, ""},
+		{"acwrite", bufferOptions{Buftype: "acwrite", Modifiable: true}, 0, ""},
+		{"help", bufferOptions{Buftype: "help", Modifiable: true}, 0, "buftype is help"},
+		{"terminal", bufferOptions{Buftype: "terminal", Modifiable: true}, 0, "buftype is terminal"},
+		{"nomodifiable", bufferOptions{}, 0, "not modifiable"},
+		{"within size cap", regular, 14, ""},
+		{"over size cap", regular, 13, "larger than 13 bytes"},
+		{"enabled by override", bufferOptions{Buftype: "help", Override: "enable"}, 1, ""},
+		{"disabled by override", bufferOptions{Modifiable: true, Override: "disable"}, 0, "disabled for this buffer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ineligibleReason(tt.options, lines, tt.maxSize), "reason")
+		})
+	}
+}
+
+func TestCompareLines(t *testing.T) {
+	assert.NoError(t, compareLines([]string{"a", "b"}, []string{"a", "b"}), "equal")
+	assert.Error(t, compareLines([]string{"a", "b"}, []string{"a", "c"}), "line differs")
+	assert.Error(t, compareLines([]string{"a", "b"}, []string{"a"}), "line count differs")
+}
+
+func TestRestoreRange_PartialApply(t *testing.T) {
+	original := []string{"a", "b", "c", "d"}
+	actual := []string{"a", "x", "y", "z", "d"}
+
+	start, end, lines, changed := restoreRange(actual, original)
+
+	assert.True(t, changed, "changed")
+	assert.Equal(t, 1, start, "start")
+	assert.Equal(t, 4, end, "end")
+	assert.Equal(t, []string{"b", "c"}, lines, "lines")
+}
+
+func TestRestoreRange_DeletedLines(t *testing.T) {
+	start, end, lines, changed := restoreRange([]string{"a"}, []string{"a", "b", "a"})
+
+	assert.True(t, changed, "changed")
+	assert.Equal(t, 1, start, "start")
+	assert.Equal(t, 1, end, "end")
+	assert.Equal(t, []string{"b", "a"}, lines, "lines")
+}
+
+func TestRestoreRange_Unchanged(t *testing.T) {
+	_, _, _, changed := restoreRange([]string{"a", "b"}, []string{"a", "b"})
+	assert.False(t, changed, "unchanged")
+}
+
+func TestParseVirtText(t *testing.T) {
+	raw := []any{
+		[]any{
+			map[string]any{"col": int64(12), "pos": "eol", "width": int64(20)},
+			map[string]any{"col": int64(4), "pos": "inline", "width": int64(5)},
+		},
+		[]any{},
+	}
+
+	lines := parseVirtText(raw)
+
+	assert.Len(t, 2, lines, "lines")
+	assert.Equal(t, []text.VirtText{{Col: 12, Pos: "eol", Width: 20}, {Col: 4, Pos: "inline", Width: 5}}, lines[0], "first line")
+	assert.Len(t, 0, lines[1], "second line")
+}
+
+func TestDiffResultToLuaFormat_Collisions(t *testing.T) {
+	groups := []*text.Group{
+		{Type: "modification", StartLine: 1, EndLine: 1, BufferLine: 3, Lines: []string{"b"}, OldLines: []string{"a"},
+			Collisions: []text.VirtText{{Col: 1, Pos: "eol", Width: 8}}},
+		{Type: "addition", StartLine: 2, EndLine: 2, BufferLine: 4, Lines: []string{"c"}},
+	}
+
+	payload := diffResultToLuaFormat(text.ComputeDiff("a\n", "b\nc\n"), groups, []string{"b", "c"}, 3, text.ColumnBytes)
+
+	luaGroups := payload["groups"].([]map[string]any)
+	assert.Equal(t, []map[string]any{{"col": 1, "pos": "eol", "width": 8}}, luaGroups[0]["collisions"], "collisions sent")
+	_, ok := luaGroups[1]["collisions"]
+	assert.False(t, ok, "omitted without collisions")
+}
+
+func TestEditsToLuaFormat_ConvertsColumns(t *testing.T) {
+	edits := [][]text.WordEdit{{{OldStart: 8, OldEnd: 9, Text: "2"}}, {}}
+
+	out := editsToLuaFormat(edits, []string{"café = 1", "same"}, text.ColumnChars)
+
+	assert.Equal(t, []map[string]any{{"old_start": 7, "old_end": 8, "text": "2"}}, out[0], "columns in chars")
+	assert.Len(t, 0, out[1], "unchanged line")
+}
+
+func TestMovePending_CommitsAtMovedLines(t *testing.T) {
+	buf := New(Config{NsID: 1})
+	// Two lines were added above the completion since it was prepared
+	buf.lines = []string{"added 1", "added 2", "a", "b", "c"}
+	buf.originalLines = buf.lines
+	buf.pending = &PendingEdit{StartLine: 2, EndLineInclusive: 2, Lines: []string{"B"}}
+
+	buf.movePending(4, 4)
+
+	assert.Equal(t, []string{"added 1", "added 2", "a", "B", "c"}, buf.pendingResult(), "result at the moved lines")
+	buf.CommitPending()
+	assert.Equal(t, []string{"added 1", "added 2", "a", "B", "c"}, buf.lines, "committed lines")
+}
+
+func TestShiftedRange(t *testing.T) {
+	replacing := &anchor{startMark: 1, endMark: 2, startLine: 10, endLine: 12}
+	inserting := &anchor{startMark: 1, startLine: 10, endLine: 9}
+
+	tests := []struct {
+		name             string
+		anchor           *anchor
+		startPos, endPos []int
+		wantStart        int
+		wantEnd          int
+		wantErr          bool
+	}{
+		{"unchanged", replacing, []int{9, 0}, []int{11, 0}, 10, 12, false},
+		{"lines added above", replacing, []int{12, 0}, []int{14, 0}, 13, 15, false},
+		{"lines removed above", replacing, []int{6, 0}, []int{8, 0}, 7, 9, false},
+		{"line added inside", replacing, []int{9, 0}, []int{12, 0}, 0, 0, true},
+		{"marks gone", replacing, nil, nil, 0, 0, true},
+		{"end mark gone", replacing, []int{9, 0}, nil, 0, 0, true},
+		{"insertion moved", inserting, []int{14, 0}, nil, 15, 14, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := shiftedRange(tt.anchor, tt.startPos, tt.endPos)
+			if tt.wantErr {
+				assert.Error(t, err, "range changed")
+				return
+			}
+			assert.NoError(t, err, "shiftedRange")
+			assert.Equal(t, tt.wantStart, start, "start")
+			assert.Equal(t, tt.wantEnd, end, "end")
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package buffer
+
+import (
+	"slices"
+
+	"cursortab/logger"
+)
+
+// untracked is the tick of lines that must be read in full on the next sync.
+const untracked = -1
+
+// span is a range of lines, 0-indexed and end exclusive.
+type span struct {
+	first, last int
+}
+
+// ApplyLines updates the lines with a change reported by nvim_buf_attach:
+// lines first to last (0-indexed, end exclusive) were replaced with lines, or
+// the whole content when last is -1. tick is the b:changedtick once the change
+// was made. Changes the lines already hold are skipped, and one that does not
+// fit them drops them, so that the next sync reads the buffer in full. Returns
+// true when the change was applied: it is new, and made after the last sync
+// or edit of the daemon's own.
+//
+// The lines are replaced rather than modified, so the slices handed out by
+// Lines, PreviousLines and OriginalLines stay as they were.
+func (b *NvimBuffer) ApplyLines(first, last int, lines []string, tick int) bool {
+	if tick <= b.tick {
+		return false
+	}
+	if last < 0 {
+		b.lines = slices.Clone(lines)
+		b.tick = tick
+		b.editsKnown = false
+		return true
+	}
+	if b.tick == untracked {
+		return false
+	}
+	if first < 0 || first > last || last > len(b.lines) {
+		logger.Debug("buffer: change to lines %d-%d out of range, reading it in full", first, last)
+		b.DetachLines()
+		return false
+	}
+
+	b.lines = slices.Concat(b.lines[:first], lines, b.lines[last:])
+	b.tick = tick
+	b.edited = growEdited(b.edited, first, last, len(lines))
+	return true
+}
+
+// DetachLines stops tracking changes; the next sync reads the buffer in full.
+func (b *NvimBuffer) DetachLines() {
+	b.tick = untracked
+	b.editsKnown = false
+}
+
+// resetEdits makes the current lines the content edits are tracked against.
+func (b *NvimBuffer) resetEdits() {
+	b.edited = nil
+	b.editsKnown = true
+}
+
+// growEdited returns the lines changed so far once lines first to last were
+// replaced with count lines. Lines before first keep their position, lines
+// from last on move by the difference in line count.
+func growEdited(edited *span, first, last, count int) *span {
+	grown := &span{first: first, last: first + count}
+	if edited == nil {
+		return grown
+	}
+	grown.first = min(edited.first, first)
+	if edited.last >= last {
+		grown.last = max(grown.last, edited.last+count-(last-first))
+	}
+	return grown
+}
+
+// editedRanges returns the parts of the checkpoint and the current lines that
+// differ, as known from the changes applied since the checkpoint. ok is false
+// when some change was not seen and the whole content must be compared.
+func (b *NvimBuffer) editedRanges() (original, current []string, ok bool) {
+	if !b.editsKnown {
+		return nil, nil, false
+	}
+	if b.edited == nil {
+		return nil, nil, true
+	}
+	delta := len(b.lines) - len(b.originalLines)
+	first, last := b.edited.first, b.edited.last
+	if last > len(b.lines) || last-delta > len(b.originalLines) || last-delta < first {
+		return nil, nil, false
+	}
+	return b.originalLines[first : last-delta], b.lines[first:last], true
+}
@@ -0,0 +1,99 @@
+package buffer
+
+import (
+	"cursortab/assert"
+	"testing"
+)
+
+// trackedBuffer returns a buffer whose lines were last read at tick 10.
+func trackedBuffer(lines ...string) *NvimBuffer {
+	b := New(Config{})
+	b.lines = lines
+	b.originalLines = lines
+	b.tick = 10
+	b.resetEdits()
+	return b
+}
+
+func TestApplyLines_KeepsLinesUpToDate(t *testing.T) {
+	b := trackedBuffer("a", "b", "c")
+	snapshot := b.Lines()
+
+	assert.True(t, b.ApplyLines(1, 2, []string{"B1", "B2"}, 11), "applied")
+	b.ApplyLines(3, 4, nil, 12)
+
+	assert.Equal(t, []string{"a", "B1", "B2"}, b.Lines(), "lines")
+	assert.Equal(t, 12, b.tick, "tick")
+	assert.Equal(t, []string{"a", "b", "c"}, snapshot, "earlier snapshot untouched")
+}
+
+func TestApplyLines_SkipsChangesAlreadyRead(t *testing.T) {
+	b := trackedBuffer("a", "b")
+
+	assert.False(t, b.ApplyLines(0, 1, []string{"x"}, 10), "skipped")
+
+	assert.Equal(t, []string{"a", "b"}, b.Lines(), "change of the read tick skipped")
+}
+
+func TestApplyLines_OutOfRangeDetaches(t *testing.T) {
+	b := trackedBuffer("a", "b")
+
+	b.ApplyLines(1, 5, []string{"x"}, 11)
+	assert.Equal(t, untracked, b.tick, "read in full on next sync")
+
+	assert.False(t, b.ApplyLines(0, 1, []string{"y"}, 12), "ignored until then")
+	assert.Equal(t, []string{"a", "b"}, b.Lines(), "lines kept")
+	assert.False(t, b.editsKnown, "edits no longer known")
+}
+
+func TestApplyLines_FullContent(t *testing.T) {
+	b := New(Config{})
+
+	b.ApplyLines(0, -1, []string{"a", "b"}, 4)
+
+	assert.Equal(t, []string{"a", "b"}, b.Lines(), "lines")
+	assert.Equal(t, 4, b.tick, "tracked from the content's tick")
+}
+
+func TestCommitUserEdits_FromAppliedChanges(t *testing.T) {
+	b := trackedBuffer("a", "b", "c", "d", "e")
+
+	b.ApplyLines(1, 2, []string{"B"}, 11)
+	b.ApplyLines(3, 5, []string{"D"}, 12)
+
+	original, current, ok := b.editedRanges()
+	assert.True(t, ok, "edits known")
+	assert.Equal(t, []string{"b", "c", "d", "e"}, original, "original range")
+	assert.Equal(t, []string{"B", "c", "D"}, current, "current range")
+
+	assert.True(t, b.CommitUserEdits(), "committed")
+	assert.Len(t, 2, b.diffHistories, "one entry per hunk")
+	assert.Equal(t, "b", b.diffHistories[0].Original, "first original")
+	assert.Equal(t, "d\ne", b.diffHistories[1].Original, "second original")
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, b.PreviousLines(), "previous lines")
+	assert.Equal(t, []string{"a", "B", "c", "D"}, b.OriginalLines(), "checkpoint moved")
+
+	assert.False(t, b.CommitUserEdits(), "nothing edited since")
+}
+
+func TestCommitUserEdits_RevertedEditNotCommitted(t *testing.T) {
+	b := trackedBuffer("a", "b")
+
+	b.ApplyLines(1, 2, []string{"x"}, 11)
+	b.ApplyLines(1, 2, []string{"b"}, 12)
+
+	assert.False(t, b.CommitUserEdits(), "typed and deleted")
+}
+
+func TestGrowEdited(t *testing.T) {
+	edited := growEdited(nil, 2, 3, 1)
+	assert.Equal(t, span{2, 3}, *edited, "first change")
+
+	// Two lines inserted above shift the edited lines down
+	edited = growEdited(edited, 0, 0, 2)
+	assert.Equal(t, span{0, 5}, *edited, "covers both")
+
+	// Lines after the edited ones deleted
+	edited = growEdited(edited, 6, 8, 0)
+	assert.Equal(t, span{0, 6}, *edited, "reaches the deletion")
+}
@@ -0,0 +1,159 @@
+// Package anthropic implements a client for the Anthropic Messages API.
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"cursortab/logger"
+)
+
+// BaseURL is the Anthropic API base URL
+const BaseURL = "https://api.anthropic.com"
+
+// APIVersion is sent as the anthropic-version header
+const APIVersion = "2023-06-01"
+
+// DefaultModel is used when no model is configured
+const DefaultModel = "claude-3-5-haiku-latest"
+
+// CacheControl marks the end of a prompt prefix to cache
+type CacheControl struct {
+	Type string `json:"type"`
+}
+
+// Ephemeral is the cache control type for the default 5 minute prompt cache
+var Ephemeral = &CacheControl{Type: "ephemeral"}
+
+// ContentBlock is a text block of a message or system prompt
+type ContentBlock struct {
+	Type         string        `json:"type"`
+	Text         string        `json:"text"`
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// TextBlock returns a text content block
+func TextBlock(text string) ContentBlock {
+	return ContentBlock{Type: "text", Text: text}
+}
+
+// CachedTextBlock returns a text content block that ends a cached prompt prefix
+func CachedTextBlock(text string) ContentBlock {
+	return ContentBlock{Type: "text", Text: text, CacheControl: Ephemeral}
+}
+
+// Message is a conversation turn
+type Message struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+// Request is the Messages API request body
+type Request struct {
+	Model         string         `json:"model"`
+	MaxTokens     int            `json:"max_tokens"`
+	System        []ContentBlock `json:"system,omitempty"`
+	Messages      []Message      `json:"messages"`
+	Temperature   float64        `json:"temperature"`
+	TopK          int            `json:"top_k,omitempty"`
+	TopP          float64        `json:"top_p,omitempty"`
+	StopSequences []string       `json:"stop_sequences,omitempty"`
+
+	Headers map[string]string `json:"-"` // Extra HTTP headers sent with the request
+}
+
+// Usage reports token counts, including prompt cache hits and writes
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// Response is the Messages API response body
+type Response struct {
+	ID         string         `json:"id"`
+	Content    []ContentBlock `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      Usage          `json:"usage"`
+}
+
+// Text returns the concatenated text blocks of the response
+func (r *Response) Text() string {
+	var sb strings.Builder
+	for _, block := range r.Content {
+		if block.Type == "text" {
+			sb.WriteString(block.Text)
+		}
+	}
+	return sb.String()
+}
+
+// Client sends requests to the Messages API
+type Client struct {
+	HTTPClient *http.Client
+	URL        string
+	APIKey     string
+}
+
+// NewClient creates a new Messages API client for the given base URL
+func NewClient(baseURL, apiKey string, timeoutMs int) *Client {
+	timeout := time.Duration(0)
+	if timeoutMs > 0 {
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+	return &Client{
+		HTTPClient: &http.Client{Timeout: timeout},
+		URL:        strings.TrimSuffix(baseURL, "/") + "/v1/messages",
+		APIKey:     apiKey,
+	}
+}
+
+// CreateMessage sends a non-streaming Messages API request
+func (c *Client) CreateMessage(ctx context.Context, req *Request) (*Response, error) {
+	defer logger.Trace("anthropic.CreateMessage")()
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("anthropic-version", APIVersion)
+	httpReq.Header.Set("x-api-key", c.APIKey)
+	for name, value := range req.Headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var apiResp Response
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &apiResp, nil
+}
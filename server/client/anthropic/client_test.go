@@ -0,0 +1,60 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestCreateMessage(t *testing.T) {
+	var gotPath, gotKey, gotVersion string
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotKey = r.Header.Get("x-api-key")
+		gotVersion = r.Header.Get("anthropic-version")
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, `{"id":"msg_1","content":[{"type":"text","text":"foo"},{"type":"text","text":"bar"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":2,"cache_read_input_tokens":2048}}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/", "secret", 0)
+	resp, err := client.CreateMessage(context.Background(), &Request{
+		Model:     DefaultModel,
+		MaxTokens: 64,
+		System:    []ContentBlock{CachedTextBlock("system")},
+		Messages:  []Message{{Role: "user", Content: []ContentBlock{TextBlock("hi")}}},
+	})
+
+	assert.NoError(t, err, "CreateMessage")
+	assert.Equal(t, "/v1/messages", gotPath, "path")
+	assert.Equal(t, "secret", gotKey, "api key header")
+	assert.Equal(t, APIVersion, gotVersion, "version header")
+
+	system := got["system"].([]any)[0].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "ephemeral"}, system["cache_control"], "cache_control on cached block")
+	message := got["messages"].([]any)[0].(map[string]any)
+	block := message["content"].([]any)[0].(map[string]any)
+	assert.Nil(t, block["cache_control"], "no cache_control on plain block")
+
+	assert.Equal(t, "foobar", resp.Text(), "text joins blocks")
+	assert.Equal(t, "msg_1", resp.ID, "id")
+	assert.Equal(t, 2048, resp.Usage.CacheReadInputTokens, "cache read tokens")
+}
+
+func TestCreateMessage_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"type":"error"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, "k", 0).CreateMessage(context.Background(), &Request{})
+
+	assert.Error(t, err, "error status")
+	assert.Contains(t, err.Error(), "401", "status in error")
+}
@@ -0,0 +1,183 @@
+// Package gemini implements a client for the Gemini generateContent API, served
+// either by the Gemini Developer API (API-key auth) or by Vertex AI
+// (service-account auth).
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"cursortab/logger"
+)
+
+// DeveloperURL is the Gemini Developer API base URL
+const DeveloperURL = "https://generativelanguage.googleapis.com"
+
+// DefaultModel is used when no model is configured
+const DefaultModel = "gemini-2.0-flash"
+
+// Part is a piece of message content
+type Part struct {
+	Text string `json:"text"`
+}
+
+// Content is a message in a conversation
+type Content struct {
+	Role  string `json:"role,omitempty"`
+	Parts []Part `json:"parts"`
+}
+
+// GenerationConfig holds sampling parameters
+type GenerationConfig struct {
+	Temperature     float64  `json:"temperature"`
+	TopK            int      `json:"topK,omitempty"`
+	TopP            float64  `json:"topP,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+}
+
+// Request is the generateContent request body
+type Request struct {
+	SystemInstruction *Content         `json:"systemInstruction,omitempty"`
+	Contents          []Content        `json:"contents"`
+	GenerationConfig  GenerationConfig `json:"generationConfig"`
+
+	Headers map[string]string `json:"-"` // Extra HTTP headers sent with the request
+}
+
+// Candidate is one generated response
+type Candidate struct {
+	Content      Content `json:"content"`
+	FinishReason string  `json:"finishReason"`
+}
+
+// Response is the generateContent response body
+type Response struct {
+	ResponseID string      `json:"responseId"`
+	Candidates []Candidate `json:"candidates"`
+}
+
+// Text returns the concatenated text of the first candidate
+func (r *Response) Text() string {
+	if len(r.Candidates) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, part := range r.Candidates[0].Content.Parts {
+		sb.WriteString(part.Text)
+	}
+	return sb.String()
+}
+
+// FinishReason returns the finish reason of the first candidate
+func (r *Response) FinishReason() string {
+	if len(r.Candidates) == 0 {
+		return ""
+	}
+	return r.Candidates[0].FinishReason
+}
+
+// TokenSource provides OAuth2 access tokens
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// Client sends generateContent requests to a single model endpoint
+type Client struct {
+	HTTPClient *http.Client
+	URL        string      // Full generateContent endpoint
+	APIKey     string      // Sent as x-goog-api-key when set
+	Tokens     TokenSource // Bearer tokens, used when APIKey is empty
+}
+
+// NewDeveloperClient creates a client for the Gemini Developer API authenticated with an API key
+func NewDeveloperClient(baseURL, model, apiKey string, timeoutMs int) *Client {
+	return &Client{
+		HTTPClient: newHTTPClient(timeoutMs),
+		URL:        fmt.Sprintf("%s/v1beta/models/%s:generateContent", strings.TrimSuffix(baseURL, "/"), model),
+		APIKey:     apiKey,
+	}
+}
+
+// NewVertexClient creates a client for a Vertex AI publisher model authenticated with tokens
+func NewVertexClient(baseURL, project, location, model string, tokens TokenSource, timeoutMs int) *Client {
+	return &Client{
+		HTTPClient: newHTTPClient(timeoutMs),
+		URL: fmt.Sprintf("%s/v1/projects/%s/locations/%s/publishers/google/models/%s:generateContent",
+			strings.TrimSuffix(baseURL, "/"), project, location, model),
+		Tokens: tokens,
+	}
+}
+
+// VertexURL returns the regional Vertex AI base URL for location
+func VertexURL(location string) string {
+	if location == "global" {
+		return "https://aiplatform.googleapis.com"
+	}
+	return fmt.Sprintf("https://%s-aiplatform.googleapis.com", location)
+}
+
+func newHTTPClient(timeoutMs int) *http.Client {
+	timeout := time.Duration(0)
+	if timeoutMs > 0 {
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// GenerateContent sends a non-streaming generateContent request
+func (c *Client) GenerateContent(ctx context.Context, req *Request) (*Response, error) {
+	defer logger.Trace("gemini.GenerateContent")()
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	if c.APIKey != "" {
+		httpReq.Header.Set("x-goog-api-key", c.APIKey)
+	} else if c.Tokens != nil {
+		token, err := c.Tokens.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get access token: %w", err)
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, value := range req.Headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var apiResp Response
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &apiResp, nil
+}
@@ -0,0 +1,138 @@
+package gemini
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestDeveloperClient_GenerateContent(t *testing.T) {
+	var gotPath, gotKey string
+	var got Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotKey = r.Header.Get("x-goog-api-key")
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, `{"responseId":"r1","candidates":[{"content":{"role":"model","parts":[{"text":"foo"},{"text":"bar"}]},"finishReason":"STOP"}]}`)
+	}))
+	defer server.Close()
+
+	client := NewDeveloperClient(server.URL, "gemini-2.0-flash", "secret", 0)
+	resp, err := client.GenerateContent(context.Background(), &Request{
+		Contents:         []Content{{Role: "user", Parts: []Part{{Text: "hi"}}}},
+		GenerationConfig: GenerationConfig{MaxOutputTokens: 64},
+	})
+
+	assert.NoError(t, err, "GenerateContent")
+	assert.Equal(t, "/v1beta/models/gemini-2.0-flash:generateContent", gotPath, "path")
+	assert.Equal(t, "secret", gotKey, "api key header")
+	assert.Equal(t, 64, got.GenerationConfig.MaxOutputTokens, "maxOutputTokens")
+	assert.Equal(t, "foobar", resp.Text(), "text joins parts")
+	assert.Equal(t, "STOP", resp.FinishReason(), "finish reason")
+	assert.Equal(t, "r1", resp.ResponseID, "response id")
+}
+
+func TestGenerateContent_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	_, err := NewDeveloperClient(server.URL, "m", "k", 0).GenerateContent(context.Background(), &Request{})
+
+	assert.Error(t, err, "error status")
+	assert.Contains(t, err.Error(), "429", "status in error")
+}
+
+func writeServiceAccount(t *testing.T, tokenURI string) (string, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err, "GenerateKey")
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err, "MarshalPKCS8PrivateKey")
+
+	data, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "my-project",
+		"private_key_id": "kid-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "bot@my-project.iam.gserviceaccount.com",
+		"token_uri":      tokenURI,
+	})
+	path := filepath.Join(t.TempDir(), "key.json")
+	assert.NoError(t, os.WriteFile(path, data, 0600), "write key file")
+	return path, key
+}
+
+func TestVertexClient_ServiceAccountAuth(t *testing.T) {
+	tokenRequests := 0
+	var key *rsa.PrivateKey
+	var gotPath, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests++
+			r.ParseForm()
+			parts := strings.Split(r.PostForm.Get("assertion"), ".")
+			assert.Len(t, 3, parts, "JWT parts")
+			sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig), "assertion signature")
+
+			claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			assert.Contains(t, string(claims), "bot@my-project.iam.gserviceaccount.com", "issuer claim")
+			fmt.Fprint(w, `{"access_token":"tok-1","expires_in":3600}`)
+			return
+		}
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}`)
+	}))
+	defer server.Close()
+
+	path, k := writeServiceAccount(t, server.URL+"/token")
+	key = k
+
+	account, err := LoadServiceAccount(path)
+	assert.NoError(t, err, "LoadServiceAccount")
+	assert.Equal(t, "my-project", account.ProjectID, "project id")
+
+	tokens, err := NewServiceAccountTokens(account)
+	assert.NoError(t, err, "NewServiceAccountTokens")
+
+	client := NewVertexClient(server.URL, account.ProjectID, "us-central1", "gemini-2.0-flash", tokens, 0)
+	for range 2 {
+		_, err = client.GenerateContent(context.Background(), &Request{})
+		assert.NoError(t, err, "GenerateContent")
+	}
+
+	assert.Equal(t, "/v1/projects/my-project/locations/us-central1/publishers/google/models/gemini-2.0-flash:generateContent", gotPath, "vertex path")
+	assert.Equal(t, "Bearer tok-1", gotAuth, "bearer token")
+	assert.Equal(t, 1, tokenRequests, "token cached across requests")
+}
+
+func TestLoadServiceAccount_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	os.WriteFile(path, []byte(`{"project_id":"p"}`), 0600)
+
+	_, err := LoadServiceAccount(path)
+	assert.Error(t, err, "missing fields")
+}
+
+func TestVertexURL(t *testing.T) {
+	assert.Equal(t, "https://europe-west4-aiplatform.googleapis.com", VertexURL("europe-west4"), "regional")
+	assert.Equal(t, "https://aiplatform.googleapis.com", VertexURL("global"), "global")
+}
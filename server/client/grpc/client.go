@@ -0,0 +1,220 @@
+// Package grpc is a gRPC client for self-hosted completion gateways, used by
+// the sweepapi provider instead of HTTP+ndjson to save latency on LAN setups.
+//
+// It calls the cursortab.v1.Autocomplete service described in cursortab.proto
+// over HTTP/2, in cleartext for http:// URLs and over TLS for https:// URLs.
+// The request and response messages are those of the Sweep API.
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cursortab/client/sweepapi"
+	"cursortab/logger"
+)
+
+const (
+	servicePath    = "/cursortab.v1.Autocomplete/"
+	maxMessageSize = 16 << 20 // Largest response message accepted
+)
+
+// StatusError is a call that ended with a non-OK gRPC status.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", e.Code, e.Message)
+}
+
+// Client calls the completion gateway at URL.
+type Client struct {
+	HTTPClient *http.Client
+	URL        string // Base URL of the gateway (e.g., "http://10.0.0.2:50051")
+	AuthToken  string
+	UserAgent  string
+}
+
+// NewClient creates a client for the gateway at baseURL.
+func NewClient(baseURL, apiKey string, timeoutMs int) *Client {
+	timeout := time.Duration(0)
+	if timeoutMs > 0 {
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	return &Client{
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{Protocols: protocols},
+			Timeout:   timeout,
+		},
+		URL:       strings.TrimSuffix(baseURL, "/"),
+		AuthToken: apiKey,
+	}
+}
+
+// DoCompletion calls Completion and returns the edits of the suggestion.
+func (c *Client) DoCompletion(ctx context.Context, req *sweepapi.AutocompleteRequest) ([]*sweepapi.AutocompleteResponse, error) {
+	defer logger.Trace("grpc.DoCompletion")()
+
+	msg, err := c.unary(ctx, "Completion", encodeAutocompleteRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	return decodeCompletionResponse(msg)
+}
+
+// DoCompletionStream calls StreamCompletion and returns the lines of
+// fileContents with the edits applied, emitted as the edits arrive.
+func (c *Client) DoCompletionStream(ctx context.Context, req *sweepapi.AutocompleteRequest, fileContents string) *sweepapi.LineStream {
+	var resp *http.Response
+	return sweepapi.StreamEdits(ctx, fileContents, func(ctx context.Context) (*sweepapi.AutocompleteResponse, error) {
+		if resp == nil {
+			var err error
+			if resp, err = c.call(ctx, "StreamCompletion", encodeAutocompleteRequest(req)); err != nil {
+				return nil, err
+			}
+			context.AfterFunc(ctx, func() { resp.Body.Close() })
+		}
+		msg, err := readMessage(resp.Body)
+		if errors.Is(err, io.EOF) {
+			resp.Body.Close()
+			if err := status(resp.Trailer); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		return decodeEdit(msg)
+	})
+}
+
+// TrackMetrics calls TrackMetrics.
+func (c *Client) TrackMetrics(ctx context.Context, req *sweepapi.MetricsRequest) error {
+	defer logger.Trace("grpc.TrackMetrics")()
+
+	_, err := c.unary(ctx, "TrackMetrics", encodeMetricsRequest(req))
+	return err
+}
+
+// unary calls method with msg and returns its single response message.
+func (c *Client) unary(ctx context.Context, method string, msg []byte) ([]byte, error) {
+	resp, err := c.call(ctx, method, msg)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	reply, err := readMessage(resp.Body)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = fmt.Errorf("%s: no response message", method)
+		}
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if err := status(resp.Trailer); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// call sends msg to method and returns the response once its headers are in.
+func (c *Client) call(ctx context.Context, method string, msg []byte) (*http.Response, error) {
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	body = append(body, msg...)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+servicePath+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	httpReq.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		httpReq.Header.Set("Grpc-Timeout", fmt.Sprintf("%dm", max(time.Until(deadline).Milliseconds(), 1)))
+	}
+	if c.UserAgent != "" {
+		httpReq.Header.Set("User-Agent", c.UserAgent)
+	}
+	if c.AuthToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	}
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	// A call failing before any message answers with its status in the headers
+	if err := status(resp.Header); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// readMessage reads one length-prefixed message. Returns io.EOF at the end
+// of the stream.
+func readMessage(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errTruncated
+		}
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, errors.New("compressed grpc messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("grpc message of %d bytes exceeds the %d byte limit", size, maxMessageSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, errTruncated
+	}
+	return msg, nil
+}
+
+// status returns the error of a non-OK grpc-status in h, nil when it is OK
+// or absent.
+func status(h http.Header) error {
+	value := h.Get("Grpc-Status")
+	if value == "" || value == "0" {
+		return nil
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid grpc-status %q", value)
+	}
+	message, err := url.PathUnescape(h.Get("Grpc-Message"))
+	if err != nil {
+		message = h.Get("Grpc-Message")
+	}
+	return &StatusError{Code: code, Message: message}
+}
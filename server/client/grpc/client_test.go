@@ -0,0 +1,183 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/client/sweepapi"
+)
+
+// newTestServer starts a cleartext HTTP/2 server answering with handler.
+func newTestServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetHTTP1(true)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func writeMessage(w http.ResponseWriter, msg []byte) {
+	frame := []byte{0, 0, 0, 0, byte(len(msg))}
+	w.Write(append(frame, msg...))
+	w.(http.Flusher).Flush()
+}
+
+func encodeEdit(e *encoder, edit sweepapi.AutocompleteResponse) {
+	e.string(1, edit.AutocompleteID)
+	e.int(2, int64(edit.StartIndex))
+	e.int(3, int64(edit.EndIndex))
+	e.string(4, edit.Completion)
+}
+
+func TestClientCompletion(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, 2, r.ProtoMajor, "HTTP/2")
+		assert.Equal(t, "/cursortab.v1.Autocomplete/Completion", r.URL.Path, "path")
+		assert.Equal(t, "application/grpc", r.Header.Get("Content-Type"), "content type")
+		assert.Equal(t, "Bearer my-token", r.Header.Get("Authorization"), "Authorization header")
+
+		body, _ := io.ReadAll(r.Body)
+		msg, err := readMessage(bytes.NewReader(body))
+		assert.NoError(t, err, "request frame")
+		var filePath, fileContents string
+		var cursor uint64
+		decode(msg, func(field int, value uint64, data []byte) error {
+			switch field {
+			case 2:
+				filePath = string(data)
+			case 3:
+				fileContents = string(data)
+			case 5:
+				cursor = value
+			}
+			return nil
+		})
+		assert.Equal(t, "test.go", filePath, "file_path")
+		assert.Equal(t, "hello world", fileContents, "file_contents")
+		assert.Equal(t, uint64(6), cursor, "cursor_position")
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		var e encoder
+		e.message(1, func(m *encoder) {
+			encodeEdit(m, sweepapi.AutocompleteResponse{AutocompleteID: "id-1", StartIndex: 0, EndIndex: 5, Completion: "HELLO"})
+		})
+		e.message(1, func(m *encoder) {
+			encodeEdit(m, sweepapi.AutocompleteResponse{AutocompleteID: "id-2", StartIndex: 6, EndIndex: 11})
+		})
+		writeMessage(w, e.buf)
+		w.Header().Set("Grpc-Status", "0")
+	})
+
+	client := NewClient(server.URL, "my-token", 30000)
+	results, err := client.DoCompletion(context.Background(), &sweepapi.AutocompleteRequest{
+		FilePath:       "test.go",
+		FileContents:   "hello world",
+		CursorPosition: 6,
+	})
+
+	assert.NoError(t, err, "DoCompletion")
+	assert.Equal(t, 2, len(results), "edits")
+	assert.Equal(t, "id-1", results[0].AutocompleteID, "first ID")
+	assert.Equal(t, 5, results[0].EndIndex, "first end index")
+	assert.Equal(t, "HELLO", results[0].Completion, "first completion")
+	assert.Equal(t, "", results[1].Completion, "deletion has no completion")
+	assert.Equal(t, 11, results[1].EndIndex, "second end index")
+}
+
+func TestClientStreamCompletion(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/cursortab.v1.Autocomplete/StreamCompletion", r.URL.Path, "path")
+		io.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		for _, edit := range []sweepapi.AutocompleteResponse{
+			{AutocompleteID: "id-1", StartIndex: 2, EndIndex: 3, Completion: "B"},
+			{AutocompleteID: "id-1", StartIndex: 6, EndIndex: 7, Completion: "D"},
+		} {
+			var e encoder
+			encodeEdit(&e, edit)
+			writeMessage(w, e.buf)
+		}
+		w.Header().Set("Grpc-Status", "0")
+	})
+
+	client := NewClient(server.URL, "", 30000)
+	stream := client.DoCompletionStream(context.Background(), &sweepapi.AutocompleteRequest{}, "a\nb\nc\nd")
+	var got []string
+	for line := range stream.LinesChan() {
+		got = append(got, line)
+	}
+
+	assert.Equal(t, []string{"a", "B", "c", "D"}, got, "lines")
+	assert.Equal(t, "id-1", stream.AutocompleteID, "autocomplete ID")
+}
+
+func TestClientTrackMetrics(t *testing.T) {
+	var eventType, autocompleteID string
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/cursortab.v1.Autocomplete/TrackMetrics", r.URL.Path, "path")
+		body, _ := io.ReadAll(r.Body)
+		msg, err := readMessage(bytes.NewReader(body))
+		assert.NoError(t, err, "request frame")
+		decode(msg, func(field int, value uint64, data []byte) error {
+			switch field {
+			case 1:
+				eventType = string(data)
+			case 5:
+				autocompleteID = string(data)
+			}
+			return nil
+		})
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		writeMessage(w, nil)
+		w.Header().Set("Grpc-Status", "0")
+	})
+
+	client := NewClient(server.URL, "", 30000)
+	err := client.TrackMetrics(context.Background(), &sweepapi.MetricsRequest{
+		EventType:      sweepapi.EventAccepted,
+		AutocompleteID: "id-1",
+	})
+
+	assert.NoError(t, err, "TrackMetrics")
+	assert.Equal(t, string(sweepapi.EventAccepted), eventType, "event_type")
+	assert.Equal(t, "id-1", autocompleteID, "autocomplete_id")
+}
+
+func TestClientStatusError(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "14")
+		w.Header().Set("Grpc-Message", "model%20loading")
+	})
+
+	client := NewClient(server.URL, "", 30000)
+	_, err := client.DoCompletion(context.Background(), &sweepapi.AutocompleteRequest{})
+
+	statusErr, ok := err.(*StatusError)
+	if !ok {
+		t.Fatalf("expected a *StatusError, got %v", err)
+	}
+	assert.Equal(t, 14, statusErr.Code, "code")
+	assert.Equal(t, "model loading", statusErr.Message, "message")
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	var e encoder
+	e.string(4, "completion")
+	_, err := decodeEdit(e.buf[:len(e.buf)-1])
+	assert.Error(t, err, "truncated message")
+}
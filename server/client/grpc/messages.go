@@ -0,0 +1,101 @@
+package grpc
+
+import (
+	"cursortab/client/sweepapi"
+)
+
+// Encoding of the messages of cursortab.proto
+
+func encodeAutocompleteRequest(req *sweepapi.AutocompleteRequest) []byte {
+	var e encoder
+	e.string(1, req.RepoName)
+	e.string(2, req.FilePath)
+	e.string(3, req.FileContents)
+	e.string(4, req.OriginalFileContents)
+	e.int(5, int64(req.CursorPosition))
+	e.string(6, req.RecentChanges)
+	e.bool(7, req.ChangesAboveCursor)
+	e.bool(8, req.MultipleSuggestions)
+	e.bool(9, req.UseBytes)
+	e.bool(10, req.PrivacyModeEnabled)
+	for _, c := range req.FileChunks {
+		e.message(11, func(m *encoder) { encodeFileChunk(m, c) })
+	}
+	for _, a := range req.RecentUserActions {
+		e.message(12, func(m *encoder) {
+			m.string(1, a.ActionType)
+			m.string(2, a.FilePath)
+			m.int(3, int64(a.LineNumber))
+			m.int(4, int64(a.Offset))
+			m.int(5, a.Timestamp)
+		})
+	}
+	for _, c := range req.RetrievalChunks {
+		e.message(13, func(m *encoder) { encodeFileChunk(m, c) })
+	}
+	return e.buf
+}
+
+func encodeFileChunk(e *encoder, c sweepapi.FileChunk) {
+	e.string(1, c.FilePath)
+	e.string(2, c.Content)
+	e.int(3, int64(c.StartLine))
+	e.int(4, int64(c.EndLine))
+	if c.Timestamp != nil {
+		ts := int64(*c.Timestamp)
+		e.optionalInt(5, &ts)
+	}
+}
+
+func encodeMetricsRequest(req *sweepapi.MetricsRequest) []byte {
+	var e encoder
+	e.string(1, string(req.EventType))
+	e.string(2, string(req.SuggestionType))
+	e.int(3, int64(req.Additions))
+	e.int(4, int64(req.Deletions))
+	e.string(5, req.AutocompleteID)
+	e.string(6, req.EditTracking)
+	if req.EditTrackingLine != nil {
+		line := int64(*req.EditTrackingLine)
+		e.optionalInt(7, &line)
+	}
+	e.optionalInt(8, req.Lifespan)
+	e.string(9, req.DebugInfo)
+	e.string(10, req.DeviceID)
+	e.bool(11, req.PrivacyModeEnabled)
+	return e.buf
+}
+
+func decodeEdit(buf []byte) (*sweepapi.AutocompleteResponse, error) {
+	edit := &sweepapi.AutocompleteResponse{}
+	err := decode(buf, func(field int, value uint64, data []byte) error {
+		switch field {
+		case 1:
+			edit.AutocompleteID = string(data)
+		case 2:
+			edit.StartIndex = int(int64(value))
+		case 3:
+			edit.EndIndex = int(int64(value))
+		case 4:
+			edit.Completion = string(data)
+		}
+		return nil
+	})
+	return edit, err
+}
+
+func decodeCompletionResponse(buf []byte) ([]*sweepapi.AutocompleteResponse, error) {
+	var edits []*sweepapi.AutocompleteResponse
+	err := decode(buf, func(field int, value uint64, data []byte) error {
+		if field != 1 {
+			return nil
+		}
+		edit, err := decodeEdit(data)
+		if err != nil {
+			return err
+		}
+		edits = append(edits, edit)
+		return nil
+	})
+	return edits, err
+}
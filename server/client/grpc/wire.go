@@ -0,0 +1,120 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Protocol buffer wire types
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireBytes  = 2
+	wireI32    = 5
+)
+
+// encoder writes protocol buffer fields. Fields holding their zero value are
+// skipped, as proto3 does.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) tag(field, wireType int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (e *encoder) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	e.tag(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) int(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.buf = binary.AppendUvarint(e.buf, uint64(v))
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if !v {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.buf = append(e.buf, 1)
+}
+
+// optionalInt writes v unless it is nil, even when it points to zero.
+func (e *encoder) optionalInt(field int, v *int64) {
+	if v == nil {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.buf = binary.AppendUvarint(e.buf, uint64(*v))
+}
+
+// message writes the embedded message built by fn. Empty messages are still
+// written, so repeated fields keep their length.
+func (e *encoder) message(field int, fn func(*encoder)) {
+	var m encoder
+	fn(&m)
+	e.tag(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(m.buf)))
+	e.buf = append(e.buf, m.buf...)
+}
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// decode calls fn with each field of the message in buf. For varint fields
+// value is the number and data is nil; for length-delimited fields data
+// holds the bytes. Fixed-size fields are skipped.
+func decode(buf []byte, fn func(field int, value uint64, data []byte) error) error {
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errTruncated
+		}
+		buf = buf[n:]
+		field := int(key >> 3)
+
+		switch wireType := int(key & 7); wireType {
+		case wireVarint:
+			v, n := binary.Uvarint(buf)
+			if n <= 0 {
+				return errTruncated
+			}
+			buf = buf[n:]
+			if err := fn(field, v, nil); err != nil {
+				return err
+			}
+		case wireBytes:
+			size, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < size {
+				return errTruncated
+			}
+			data := buf[n : n+int(size)]
+			buf = buf[n+int(size):]
+			if err := fn(field, 0, data); err != nil {
+				return err
+			}
+		case wireI64:
+			if len(buf) < 8 {
+				return errTruncated
+			}
+			buf = buf[8:]
+		case wireI32:
+			if len(buf) < 4 {
+				return errTruncated
+			}
+			buf = buf[4:]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", wireType)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package mercuryapi
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -52,6 +53,18 @@ type MessageContent struct {
 	Content string `json:"content"`
 }
 
+// StreamChunk is one server-sent event of a streaming response
+type StreamChunk struct {
+	ID      string        `json:"id"`
+	Choices []StreamDelta `json:"choices"`
+}
+
+// StreamDelta carries the incremental content of a streamed choice
+type StreamDelta struct {
+	Delta        MessageContent `json:"delta"`
+	FinishReason string         `json:"finish_reason"`
+}
+
 // FeedbackAction represents the user action for feedback
 type FeedbackAction string
 
@@ -147,6 +160,150 @@ func (c *Client) DoCompletion(ctx context.Context, req *Request) (*Response, err
 	return &apiResp, nil
 }
 
+// LineStream provides line-by-line streaming of a completion.
+// Code fences and a lone "None" (no prediction) are dropped from the output.
+type LineStream struct {
+	lines  chan string
+	cancel context.CancelFunc
+	// ID of the response (for feedback), set before the lines channel closes
+	ID string
+}
+
+// LinesChan returns the channel that emits complete lines.
+func (s *LineStream) LinesChan() <-chan string {
+	return s.lines
+}
+
+// Cancel stops the stream.
+func (s *LineStream) Cancel() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// DoCompletionStream sends a streaming completion request and returns a
+// LineStream that emits lines of the rewritten editable region as they arrive.
+func (c *Client) DoCompletionStream(ctx context.Context, req *Request) *LineStream {
+	linesChan := make(chan string, 100)
+	ctx, cancel := context.WithCancel(ctx)
+	ls := &LineStream{lines: linesChan, cancel: cancel}
+
+	go func() {
+		defer close(linesChan)
+
+		streamReq := *req
+		streamReq.Stream = true
+		if err := c.runStream(ctx, &streamReq, ls); err != nil && ctx.Err() == nil {
+			logger.Warn("mercuryapi: stream error: %v", err)
+		}
+	}()
+
+	return ls
+}
+
+// runStream reads SSE events and emits lines one behind, so the closing code
+// fence and a "None" reply can be recognized once the stream ends.
+func (c *Client) runStream(ctx context.Context, req *Request, ls *LineStream) error {
+	defer logger.Trace("mercuryapi.runStream")()
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if c.AuthToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	}
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var partial strings.Builder
+	var pending []string
+	emitted := 0
+
+	// emit forwards pending lines until keep remain, dropping an opening fence
+	emit := func(keep int) bool {
+		for len(pending) > keep {
+			line := pending[0]
+			pending = pending[1:]
+			if emitted == 0 && line == "```" {
+				continue
+			}
+			select {
+			case ls.lines <- line:
+				emitted++
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "data: [DONE]" {
+			break
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var chunk StreamChunk
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+			logger.Debug("mercuryapi: failed to parse stream chunk: %v", err)
+			continue
+		}
+		if chunk.ID != "" {
+			ls.ID = chunk.ID
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		partial.WriteString(chunk.Choices[0].Delta.Content)
+		text := partial.String()
+		complete := strings.Split(text, "\n")
+		partial.Reset()
+		partial.WriteString(complete[len(complete)-1])
+		pending = append(pending, complete[:len(complete)-1]...)
+		if !emit(1) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	if partial.Len() > 0 {
+		pending = append(pending, partial.String())
+	}
+	if n := len(pending); n > 0 && pending[n-1] == "```" {
+		pending = pending[:n-1]
+	}
+	if emitted == 0 && len(pending) == 1 && pending[0] == "None" {
+		return nil
+	}
+	emit(0)
+	return nil
+}
+
 // SendFeedback sends feedback about a completion to the Mercury API
 func (c *Client) SendFeedback(ctx context.Context, req *FeedbackRequest) error {
 	defer logger.Trace("mercuryapi.SendFeedback")()
@@ -161,3 +161,71 @@ func TestClientErrorResponse(t *testing.T) {
 	assert.Error(t, err, "expected error")
 	assert.Contains(t, err.Error(), "400", "error message should contain status code")
 }
+
+// newStreamServer replies with an SSE stream of the given content deltas.
+func newStreamServer(t *testing.T, deltas ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.True(t, req.Stream, "stream requested")
+		assert.Equal(t, "text/event-stream", r.Header.Get("Accept"), "Accept header")
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for _, delta := range deltas {
+			data, _ := json.Marshal(StreamChunk{
+				ID:      "stream-id",
+				Choices: []StreamDelta{{Delta: MessageContent{Content: delta}}},
+			})
+			w.Write([]byte("data: " + string(data) + "\n\n"))
+			flusher.Flush()
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+		flusher.Flush()
+	}))
+}
+
+func collectLines(stream *LineStream) []string {
+	var lines []string
+	for line := range stream.LinesChan() {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestClientDoCompletionStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		deltas []string
+		want   []string
+	}{
+		{
+			name:   "lines split across chunks",
+			deltas: []string{"func a", "() {\n\tre", "turn\n}"},
+			want:   []string{"func a() {", "\treturn", "}"},
+		},
+		{
+			name:   "code fences stripped",
+			deltas: []string{"```\nx := 1\n", "y := 2\n```"},
+			want:   []string{"x := 1", "y := 2"},
+		},
+		{
+			name:   "none response",
+			deltas: []string{"No", "ne"},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newStreamServer(t, tt.deltas...)
+			defer server.Close()
+
+			client := NewClient(server.URL, "", 30000)
+			stream := client.DoCompletionStream(context.Background(), &Request{Model: Model})
+
+			assert.Equal(t, tt.want, collectLines(stream), "lines")
+			assert.Equal(t, "stream-id", stream.ID, "stream ID")
+		})
+	}
+}
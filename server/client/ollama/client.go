@@ -0,0 +1,177 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"cursortab/logger"
+)
+
+// API endpoint paths
+const (
+	GeneratePath = "/api/generate"
+	ChatPath     = "/api/chat"
+)
+
+// Options holds the model parameters sent with every request
+type Options struct {
+	Temperature float64  `json:"temperature"`
+	TopK        int      `json:"top_k,omitempty"`
+	TopP        float64  `json:"top_p,omitempty"`
+	Seed        int      `json:"seed,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// GenerateRequest is the request format for /api/generate.
+// When Suffix is set, Ollama applies the model's fill-in-the-middle template.
+type GenerateRequest struct {
+	Model   string  `json:"model"`
+	Prompt  string  `json:"prompt"`
+	Suffix  string  `json:"suffix,omitempty"`
+	Stream  bool    `json:"stream"`
+	Options Options `json:"options"`
+
+	Headers map[string]string `json:"-"` // Extra HTTP headers sent with the request
+}
+
+// Message is a single chat message
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatRequest is the request format for /api/chat
+type ChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+	Options  Options   `json:"options"`
+
+	Headers map[string]string `json:"-"` // Extra HTTP headers sent with the request
+}
+
+// Chunk is one line of an ndjson response. /api/generate fills Response,
+// /api/chat fills Message.
+type Chunk struct {
+	Response   string   `json:"response"`
+	Message    *Message `json:"message"`
+	Done       bool     `json:"done"`
+	DoneReason string   `json:"done_reason"`
+	Error      string   `json:"error"`
+}
+
+// Text returns the generated text carried by the chunk
+func (c *Chunk) Text() string {
+	if c.Message != nil {
+		return c.Message.Content
+	}
+	return c.Response
+}
+
+// Result is the outcome of a request
+type Result struct {
+	Text       string
+	DoneReason string
+}
+
+// Client is the HTTP client for a local Ollama server
+type Client struct {
+	HTTPClient *http.Client
+	URL        string
+}
+
+// NewClient creates a new Ollama client
+func NewClient(url string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{},
+		URL:        strings.TrimSuffix(url, "/"),
+	}
+}
+
+// Generate sends a request to /api/generate
+func (c *Client) Generate(ctx context.Context, req *GenerateRequest, onText func(text string)) (*Result, error) {
+	defer logger.Trace("ollama.Generate")()
+	req.Stream = onText != nil
+	return c.do(ctx, GeneratePath, req, req.Headers, onText)
+}
+
+// Chat sends a request to /api/chat
+func (c *Client) Chat(ctx context.Context, req *ChatRequest, onText func(text string)) (*Result, error) {
+	defer logger.Trace("ollama.Chat")()
+	req.Stream = onText != nil
+	return c.do(ctx, ChatPath, req, req.Headers, onText)
+}
+
+// do posts the request with the extra headers and reads the ndjson response.
+// A non-streaming response is a single ndjson line, so both modes share the
+// same reader. onText, if set, receives each text delta as it arrives.
+func (c *Client) do(ctx context.Context, path string, req any, headers map[string]string, onText func(text string)) (*Result, error) {
+	var reqBodyBuf bytes.Buffer
+	encoder := json.NewEncoder(&reqBodyBuf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.URL+path, &reqBodyBuf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var text strings.Builder
+	result := &Result{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // 1MB max line
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var chunk Chunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to parse response line: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, errors.New(chunk.Error)
+		}
+		if delta := chunk.Text(); delta != "" {
+			text.WriteString(delta)
+			if onText != nil {
+				onText(delta)
+			}
+		}
+		if chunk.Done {
+			result.DoneReason = chunk.DoneReason
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	result.Text = text.String()
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestGenerateStreamsDeltas(t *testing.T) {
+	var got GenerateRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, GeneratePath, r.URL.Path, "path")
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprintln(w, `{"response":"foo","done":false}`)
+		fmt.Fprintln(w, `{"response":"bar","done":false}`)
+		fmt.Fprintln(w, `{"response":"","done":true,"done_reason":"stop"}`)
+	}))
+	defer server.Close()
+
+	var deltas []string
+	result, err := NewClient(server.URL).Generate(context.Background(), &GenerateRequest{
+		Model:  "qwen2.5-coder",
+		Prompt: "before",
+		Suffix: "after",
+	}, func(text string) { deltas = append(deltas, text) })
+
+	assert.NoError(t, err, "Generate")
+	assert.True(t, got.Stream, "stream requested when a callback is given")
+	assert.Equal(t, "after", got.Suffix, "suffix")
+	assert.Equal(t, []string{"foo", "bar"}, deltas, "deltas")
+	assert.Equal(t, "foobar", result.Text, "text")
+	assert.Equal(t, "stop", result.DoneReason, "done reason")
+}
+
+func TestChatNonStreaming(t *testing.T) {
+	var got ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, ChatPath, r.URL.Path, "path")
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"x := 1"},"done":true,"done_reason":"stop"}`)
+	}))
+	defer server.Close()
+
+	result, err := NewClient(server.URL).Chat(context.Background(), &ChatRequest{
+		Model:    "llama3",
+		Messages: []Message{{Role: "user", Content: "hi"}},
+	}, nil)
+
+	assert.NoError(t, err, "Chat")
+	assert.False(t, got.Stream, "no stream without callback")
+	assert.Equal(t, "x := 1", result.Text, "text")
+}
+
+func TestErrorResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == ChatPath {
+			fmt.Fprintln(w, `{"error":"model not found"}`)
+			return
+		}
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	_, err := client.Chat(context.Background(), &ChatRequest{}, nil)
+	assert.Error(t, err, "error chunk")
+	assert.Contains(t, err.Error(), "model not found", "error message")
+
+	_, err = client.Generate(context.Background(), &GenerateRequest{}, nil)
+	assert.Error(t, err, "bad status")
+	assert.Contains(t, err.Error(), "500", "status in error")
+}
@@ -20,10 +20,14 @@ type CompletionRequest struct {
 	Temperature float64  `json:"temperature"`
 	MaxTokens   int      `json:"max_tokens"`
 	TopK        int      `json:"top_k,omitempty"`
+	TopP        float64  `json:"top_p,omitempty"`
+	Seed        int      `json:"seed,omitempty"`
 	Stop        []string `json:"stop,omitempty"`
 	N           int      `json:"n"`
 	Echo        bool     `json:"echo"`
 	Stream      bool     `json:"stream"`
+
+	Headers map[string]string `json:"-"` // Extra HTTP headers sent with the request
 }
 
 // CompletionResponse matches the OpenAI Completion API response format
@@ -45,19 +49,62 @@ type CompletionResponse struct {
 	} `json:"usage"`
 }
 
-// StreamChunk represents a single SSE chunk from streaming response
+// ChatMessage is a single message of a chat completion request
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatCompletionRequest matches the OpenAI Chat Completions API format
+type ChatCompletionRequest struct {
+	Model       string        `json:"model"`
+	Messages    []ChatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+	MaxTokens   int           `json:"max_tokens"`
+	TopK        int           `json:"top_k,omitempty"`
+	TopP        float64       `json:"top_p,omitempty"`
+	Seed        int           `json:"seed,omitempty"`
+	Stop        []string      `json:"stop,omitempty"`
+	N           int           `json:"n"`
+	Stream      bool          `json:"stream"`
+}
+
+// ChatCompletionResponse matches the OpenAI Chat Completions API response format
+type ChatCompletionResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index        int         `json:"index"`
+		Message      ChatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// StreamChunk represents a single SSE chunk from streaming response.
+// Completion chunks carry Text, chat completion chunks carry Delta.
 type StreamChunk struct {
 	ID      string `json:"id"`
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	Model   string `json:"model"`
 	Choices []struct {
-		Index        int    `json:"index"`
-		Text         string `json:"text"`
+		Index int    `json:"index"`
+		Text  string `json:"text"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
 }
 
+// text returns the generated text of the first choice
+func (c *StreamChunk) text() string {
+	if c.Choices[0].Text != "" {
+		return c.Choices[0].Text
+	}
+	return c.Choices[0].Delta.Content
+}
+
 // StreamResult contains the result of a streaming completion
 type StreamResult struct {
 	Text         string
@@ -97,12 +144,20 @@ func (s *LineStream) Cancel() {
 // DefaultCompletionPath is the default API endpoint path
 const DefaultCompletionPath = "/v1/completions"
 
+// DefaultChatCompletionPath is the default chat API endpoint path
+const DefaultChatCompletionPath = "/v1/chat/completions"
+
 // Client is a reusable OpenAI-compatible API client
 type Client struct {
 	HTTPClient     *http.Client
 	URL            string
 	CompletionPath string
 	APIKey         string
+
+	// Chat sends requests in the Chat Completions format: the prompt becomes the
+	// user message, preceded by SystemPrompt when set.
+	Chat         bool
+	SystemPrompt string
 }
 
 // NewClient creates a new OpenAI-compatible client
@@ -115,21 +170,72 @@ func NewClient(url, completionPath, apiKey string) *Client {
 	}
 }
 
+// NewChatClient creates a new OpenAI-compatible Chat Completions client
+func NewChatClient(url, completionPath, apiKey, systemPrompt string) *Client {
+	c := NewClient(url, completionPath, apiKey)
+	c.Chat = true
+	c.SystemPrompt = systemPrompt
+	return c
+}
+
+// requestBody returns the JSON body for req in the client's API format
+func (c *Client) requestBody(req *CompletionRequest, stream bool) any {
+	req.Stream = stream
+	if !c.Chat {
+		return req
+	}
+
+	var messages []ChatMessage
+	if c.SystemPrompt != "" {
+		messages = append(messages, ChatMessage{Role: "system", Content: c.SystemPrompt})
+	}
+	messages = append(messages, ChatMessage{Role: "user", Content: req.Prompt})
+
+	return &ChatCompletionRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		TopK:        req.TopK,
+		TopP:        req.TopP,
+		Seed:        req.Seed,
+		Stop:        req.Stop,
+		N:           req.N,
+		Stream:      stream,
+	}
+}
+
 // DoCompletion sends a non-streaming completion request
 func (c *Client) DoCompletion(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
 	defer logger.Trace("openai.DoCompletion")()
-	req.Stream = false
 
-	body, err := c.doRequest(ctx, req)
+	body, err := c.doRequest(ctx, c.requestBody(req, false), req.Headers)
 	if err != nil {
 		return nil, err
 	}
 
 	var resp CompletionResponse
-	if err := json.Unmarshal(body, &resp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if !c.Chat {
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return &resp, nil
 	}
 
+	var chatResp ChatCompletionResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	resp.ID = chatResp.ID
+	resp.Model = chatResp.Model
+	for _, choice := range chatResp.Choices {
+		resp.Choices = append(resp.Choices, struct {
+			Index        int    `json:"index"`
+			Text         string `json:"text"`
+			Logprobs     any    `json:"logprobs"`
+			FinishReason string `json:"finish_reason"`
+		}{Index: choice.Index, Text: choice.Message.Content, FinishReason: choice.FinishReason})
+	}
 	return &resp, nil
 }
 
@@ -137,6 +243,15 @@ func (c *Client) DoCompletion(ctx context.Context, req *CompletionRequest) (*Com
 // Lines are emitted when a newline is encountered. Stop tokens trigger stream completion.
 // maxLines: stop after receiving this many lines (0 = no limit)
 func (c *Client) DoLineStream(ctx context.Context, req *CompletionRequest, maxLines int, stopTokens []string) *LineStream {
+	return StreamLines(ctx, func(ctx context.Context) (io.ReadCloser, error) {
+		return c.openStream(ctx, req)
+	}, maxLines, stopTokens)
+}
+
+// StreamLines emits the lines of the SSE completion stream returned by open,
+// the same way DoLineStream does. It lets other transports reuse the stream
+// handling by presenting their responses as SSE.
+func StreamLines(ctx context.Context, open func(ctx context.Context) (io.ReadCloser, error), maxLines int, stopTokens []string) *LineStream {
 	linesChan := make(chan string, 100)
 	doneChan := make(chan StreamResult, 1)
 
@@ -152,62 +267,31 @@ func (c *Client) DoLineStream(ctx context.Context, req *CompletionRequest, maxLi
 		defer close(linesChan)
 		defer close(doneChan)
 
-		result := c.runLineStream(ctx, req, linesChan, maxLines, stopTokens)
+		result := runLineStream(ctx, open, linesChan, maxLines, stopTokens)
 		doneChan <- result
 	}()
 
 	return stream
 }
 
-// runLineStream executes the streaming request and sends lines to the channel
-func (c *Client) runLineStream(ctx context.Context, req *CompletionRequest, lines chan<- string, maxLines int, stopTokens []string) StreamResult {
+// runLineStream opens the stream and sends lines to the channel
+func runLineStream(ctx context.Context, open func(ctx context.Context) (io.ReadCloser, error), lines chan<- string, maxLines int, stopTokens []string) StreamResult {
 	defer logger.Trace("openai.runLineStream")()
-	req.Stream = true
-
-	// Marshal the request without HTML escaping
-	var reqBodyBuf bytes.Buffer
-	encoder := json.NewEncoder(&reqBodyBuf)
-	encoder.SetEscapeHTML(false)
-	if err := encoder.Encode(req); err != nil {
-		logger.Error("line stream: failed to marshal request: %v", err)
-		return StreamResult{FinishReason: "error"}
-	}
-
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.URL+c.CompletionPath, &reqBodyBuf)
-	if err != nil {
-		logger.Error("line stream: failed to create request: %v", err)
-		return StreamResult{FinishReason: "error"}
-	}
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Accept", "text/event-stream")
-	if c.APIKey != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
-	}
-
-	// Send the request
-	resp, err := c.HTTPClient.Do(httpReq)
+	body, err := open(ctx)
 	if err != nil {
 		if ctx.Err() != nil {
 			return StreamResult{FinishReason: "cancelled"}
 		}
-		logger.Error("line stream: failed to send request: %v", err)
+		logger.Error("line stream: %v", err)
 		return StreamResult{FinishReason: "error"}
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		logger.Error("line stream: request failed with status %d: %s", resp.StatusCode, string(body))
-		return StreamResult{FinishReason: "error"}
-	}
-
-	return c.processLineStream(ctx, resp.Body, lines, maxLines, stopTokens)
+	return processLineStream(ctx, body, lines, maxLines, stopTokens)
 }
 
 // processLineStream reads SSE events and emits complete lines
-func (c *Client) processLineStream(ctx context.Context, body io.Reader, lines chan<- string, maxLines int, stopTokens []string) StreamResult {
+func processLineStream(ctx context.Context, body io.Reader, lines chan<- string, maxLines int, stopTokens []string) StreamResult {
 	var textBuilder strings.Builder
 	var lineBuffer strings.Builder
 	var finishReason string
@@ -259,7 +343,7 @@ func (c *Client) processLineStream(ctx context.Context, body io.Reader, lines ch
 
 		// Extract text from chunk
 		if len(chunk.Choices) > 0 {
-			text := chunk.Choices[0].Text
+			text := chunk.text()
 
 			// Check for stop tokens in the text
 			for token := range stopTokenSet {
@@ -349,6 +433,14 @@ func (c *Client) processLineStream(ctx context.Context, body io.Reader, lines ch
 // maxChars: stop after receiving this many characters (0 = no limit)
 // stopTokens: stop tokens that terminate the stream (e.g., "\n" for inline completion)
 func (c *Client) DoTokenStream(ctx context.Context, req *CompletionRequest, maxChars int, stopTokens []string) *LineStream {
+	return StreamTokens(ctx, func(ctx context.Context) (io.ReadCloser, error) {
+		return c.openStream(ctx, req)
+	}, maxChars, stopTokens)
+}
+
+// StreamTokens emits the cumulative text of the SSE completion stream returned
+// by open, the same way DoTokenStream does.
+func StreamTokens(ctx context.Context, open func(ctx context.Context) (io.ReadCloser, error), maxChars int, stopTokens []string) *LineStream {
 	linesChan := make(chan string, 100)
 	doneChan := make(chan StreamResult, 1)
 
@@ -364,62 +456,71 @@ func (c *Client) DoTokenStream(ctx context.Context, req *CompletionRequest, maxC
 		defer close(linesChan)
 		defer close(doneChan)
 
-		result := c.runTokenStream(ctx, req, linesChan, maxChars, stopTokens)
+		result := runTokenStream(ctx, open, linesChan, maxChars, stopTokens)
 		doneChan <- result
 	}()
 
 	return stream
 }
 
-// runTokenStream executes the streaming request and sends cumulative text to the channel
-func (c *Client) runTokenStream(ctx context.Context, req *CompletionRequest, textChan chan<- string, maxChars int, stopTokens []string) StreamResult {
+// runTokenStream opens the stream and sends cumulative text to the channel
+func runTokenStream(ctx context.Context, open func(ctx context.Context) (io.ReadCloser, error), textChan chan<- string, maxChars int, stopTokens []string) StreamResult {
 	defer logger.Trace("openai.runTokenStream")()
-	req.Stream = true
+	body, err := open(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return StreamResult{FinishReason: "cancelled"}
+		}
+		logger.Error("token stream: %v", err)
+		return StreamResult{FinishReason: "error"}
+	}
+	defer body.Close()
+
+	return processTokenStream(ctx, body, textChan, maxChars, stopTokens)
+}
 
+// openStream sends a streaming request and returns the SSE response body
+func (c *Client) openStream(ctx context.Context, req *CompletionRequest) (io.ReadCloser, error) {
 	// Marshal the request without HTML escaping
 	var reqBodyBuf bytes.Buffer
 	encoder := json.NewEncoder(&reqBodyBuf)
 	encoder.SetEscapeHTML(false)
-	if err := encoder.Encode(req); err != nil {
-		logger.Error("token stream: failed to marshal request: %v", err)
-		return StreamResult{FinishReason: "error"}
+	if err := encoder.Encode(c.requestBody(req, true)); err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Create HTTP request
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.URL+c.CompletionPath, &reqBodyBuf)
 	if err != nil {
-		logger.Error("token stream: failed to create request: %v", err)
-		return StreamResult{FinishReason: "error"}
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Accept", "text/event-stream")
 	if c.APIKey != "" {
 		httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
 	}
+	for name, value := range req.Headers {
+		httpReq.Header.Set(name, value)
+	}
 
 	// Send the request
 	resp, err := c.HTTPClient.Do(httpReq)
 	if err != nil {
-		if ctx.Err() != nil {
-			return StreamResult{FinishReason: "cancelled"}
-		}
-		logger.Error("token stream: failed to send request: %v", err)
-		return StreamResult{FinishReason: "error"}
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
-	defer resp.Body.Close()
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		logger.Error("token stream: request failed with status %d: %s", resp.StatusCode, string(body))
-		return StreamResult{FinishReason: "error"}
+		resp.Body.Close()
+		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	return c.processTokenStream(ctx, resp.Body, textChan, maxChars, stopTokens)
+	return resp.Body, nil
 }
 
 // processTokenStream reads SSE events and emits cumulative text after each chunk
-func (c *Client) processTokenStream(ctx context.Context, body io.Reader, textChan chan<- string, maxChars int, stopTokens []string) StreamResult {
+func processTokenStream(ctx context.Context, body io.Reader, textChan chan<- string, maxChars int, stopTokens []string) StreamResult {
 	var textBuilder strings.Builder
 	var finishReason string
 	stoppedEarly := false
@@ -469,7 +570,7 @@ func (c *Client) processTokenStream(ctx context.Context, body io.Reader, textCha
 
 		// Extract text from chunk
 		if len(chunk.Choices) > 0 {
-			text := chunk.Choices[0].Text
+			text := chunk.text()
 
 			// Check for stop tokens in the text
 			for token := range stopTokenSet {
@@ -537,8 +638,9 @@ func (c *Client) processTokenStream(ctx context.Context, body io.Reader, textCha
 	}
 }
 
-// doRequest sends an HTTP request and returns the response body
-func (c *Client) doRequest(ctx context.Context, req *CompletionRequest) ([]byte, error) {
+// doRequest sends an HTTP request with the extra headers and returns the
+// response body
+func (c *Client) doRequest(ctx context.Context, req any, headers map[string]string) ([]byte, error) {
 	// Marshal the request without HTML escaping
 	var reqBodyBuf bytes.Buffer
 	encoder := json.NewEncoder(&reqBodyBuf)
@@ -556,6 +658,9 @@ func (c *Client) doRequest(ctx context.Context, req *CompletionRequest) ([]byte,
 	if c.APIKey != "" {
 		httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
 	}
+	for name, value := range headers {
+		httpReq.Header.Set(name, value)
+	}
 
 	// Send the request
 	resp, err := c.HTTPClient.Do(httpReq)
@@ -120,6 +120,30 @@ func TestDoCompletion_WithAPIKey(t *testing.T) {
 	assert.Equal(t, "Bearer sk-test-api-key", capturedAuth, "Authorization header")
 }
 
+func TestDoCompletion_SendsHeadersAndTopP(t *testing.T) {
+	var capturedHeader string
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedHeader = r.Header.Get("X-Team")
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(CompletionResponse{})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", "")
+	_, err := client.DoCompletion(context.Background(), &CompletionRequest{
+		Prompt:  "hello",
+		TopP:    0.9,
+		Headers: map[string]string{"X-Team": "editor"},
+	})
+
+	assert.NoError(t, err, "DoCompletion")
+	assert.Equal(t, "editor", capturedHeader, "extra header")
+	assert.Equal(t, 0.9, body["top_p"], "top_p")
+	_, hasHeaders := body["Headers"]
+	assert.False(t, hasHeaders, "headers kept out of the body")
+}
+
 func TestDoCompletion_WithoutAPIKey(t *testing.T) {
 	var hasAuthHeader bool
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -559,3 +583,66 @@ func TestDoTokenStream_WithAPIKey(t *testing.T) {
 
 	assert.Equal(t, "Bearer sk-token-stream-key", capturedAuth, "Authorization header")
 }
+
+func TestChatClient_DoCompletion(t *testing.T) {
+	var req ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, DefaultChatCompletionPath, r.URL.Path, "path")
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Write([]byte(`{"id":"chat-1","choices":[{"index":0,"message":{"role":"assistant","content":"x := 1"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewChatClient(server.URL, DefaultChatCompletionPath, "", "be terse")
+	resp, err := client.DoCompletion(context.Background(), &CompletionRequest{
+		Model:  "test-model",
+		Prompt: "hello",
+		Stop:   []string{"\n\n"},
+	})
+
+	assert.NoError(t, err, "DoCompletion")
+	assert.Equal(t, []ChatMessage{{Role: "system", Content: "be terse"}, {Role: "user", Content: "hello"}}, req.Messages, "messages")
+	assert.Equal(t, []string{"\n\n"}, req.Stop, "stop")
+	assert.False(t, req.Stream, "Stream should be false")
+	assert.Equal(t, "chat-1", resp.ID, "ID")
+	assert.Len(t, 1, resp.Choices, "choices")
+	assert.Equal(t, "x := 1", resp.Choices[0].Text, "Text")
+	assert.Equal(t, "stop", resp.Choices[0].FinishReason, "FinishReason")
+}
+
+func TestChatClient_DoLineStreamReadsDeltas(t *testing.T) {
+	var req ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		flusher := w.(http.Flusher)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		events := []string{
+			`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"content":"line 1\nli"}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"content":"ne 2\n"},"finish_reason":"stop"}]}`,
+		}
+		for _, evt := range events {
+			w.Write([]byte("data: " + evt + "\n\n"))
+			flusher.Flush()
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+		flusher.Flush()
+	}))
+	defer server.Close()
+
+	client := NewChatClient(server.URL, "", "", "")
+	stream := client.DoLineStream(context.Background(), &CompletionRequest{Prompt: "hello"}, 0, nil)
+
+	var lines []string
+	for line := range stream.LinesChan() {
+		lines = append(lines, line)
+	}
+	result := <-stream.DoneChan()
+
+	assert.True(t, req.Stream, "Stream should be true")
+	assert.Equal(t, []ChatMessage{{Role: "user", Content: "hello"}}, req.Messages, "no system message when prompt is empty")
+	assert.Equal(t, []string{"line 1", "line 2"}, lines, "lines")
+	assert.Equal(t, "line 1\nline 2\n", result.Text, "result text")
+}
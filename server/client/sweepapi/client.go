@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -231,6 +232,31 @@ func (s *LineStream) Cancel() {
 // The stream reads ndjson responses, applies all byte-range edits to fileContents,
 // and emits the resulting lines of the modified file.
 func (c *Client) DoCompletionStream(ctx context.Context, req *AutocompleteRequest, fileContents string) *LineStream {
+	var responses []*AutocompleteResponse
+	sent := false
+	return StreamEdits(ctx, fileContents, func(ctx context.Context) (*AutocompleteResponse, error) {
+		if !sent {
+			var err error
+			if responses, err = c.DoCompletion(ctx, req); err != nil {
+				return nil, err
+			}
+			sent = true
+		}
+		if len(responses) == 0 {
+			return nil, io.EOF
+		}
+		next := responses[0]
+		responses = responses[1:]
+		return next, nil
+	})
+}
+
+// StreamEdits returns a LineStream of the lines of fileContents with the
+// edits returned by next applied. next returns io.EOF after the last edit.
+// Edits come in ascending order, so the lines before the end of an edit are
+// emitted as soon as it arrives. Edits without completion text are skipped,
+// and nothing is emitted when no edit is left.
+func StreamEdits(ctx context.Context, fileContents string, next func(ctx context.Context) (*AutocompleteResponse, error)) *LineStream {
 	linesChan := make(chan string, 100)
 	ctx, cancel := context.WithCancel(ctx)
 	ls := &LineStream{lines: linesChan, cancel: cancel}
@@ -238,33 +264,63 @@ func (c *Client) DoCompletionStream(ctx context.Context, req *AutocompleteReques
 	go func() {
 		defer close(linesChan)
 
-		responses, err := c.DoCompletion(ctx, req)
-		if err != nil {
-			logger.Warn("sweepapi: stream error: %v", err)
-			return
+		emit := func(line string) bool {
+			select {
+			case linesChan <- line:
+				return true
+			case <-ctx.Done():
+				return false
+			}
 		}
 
-		// Filter non-empty edits and capture autocomplete ID
-		var edits []*AutocompleteResponse
-		for _, r := range responses {
-			if r.Completion != "" {
-				edits = append(edits, r)
+		text := fileContents
+		applied := false
+		offset := 0  // Length change of the edits applied so far
+		emitted := 0 // Bytes of text already emitted, up to a line start
+		for {
+			edit, err := next(ctx)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				logger.Warn("sweepapi: stream error: %v", err)
+				return
+			}
+			if edit.Completion == "" {
+				continue
+			}
+			start := min(max(edit.StartIndex+offset, 0), len(text))
+			end := min(max(edit.EndIndex+offset, start), len(text))
+			if start < emitted {
+				logger.Warn("sweepapi: skipping edit at %d, before the lines already emitted", edit.StartIndex)
+				continue
+			}
+			if !applied {
+				ls.AutocompleteID = edit.AutocompleteID
+				applied = true
+			}
+			text = text[:start] + edit.Completion + text[end:]
+			offset += len(edit.Completion) - (edit.EndIndex - edit.StartIndex)
+
+			// Later edits start after this one, so the lines ending before it are final
+			editEnd := start + len(edit.Completion)
+			for {
+				newline := strings.IndexByte(text[emitted:], '\n')
+				if newline < 0 || emitted+newline >= editEnd {
+					break
+				}
+				if !emit(text[emitted : emitted+newline]) {
+					return
+				}
+				emitted += newline + 1
 			}
 		}
-		if len(edits) == 0 {
+		if !applied {
 			return
 		}
 
-		ls.AutocompleteID = edits[0].AutocompleteID
-
-		// Apply all byte-range edits to produce the modified text
-		modifiedText := ApplyByteRangeEdits(fileContents, edits)
-
-		// Emit lines of the modified file
-		for line := range strings.SplitSeq(modifiedText, "\n") {
-			select {
-			case linesChan <- line:
-			case <-ctx.Done():
+		for line := range strings.SplitSeq(text[emitted:], "\n") {
+			if !emit(line) {
 				return
 			}
 		}
@@ -224,3 +224,59 @@ func TestApplyByteRangeEdits(t *testing.T) {
 		})
 	}
 }
+
+func TestStreamEdits(t *testing.T) {
+	fileContents := "a\nb\nc\nd"
+	edits := []*AutocompleteResponse{
+		{AutocompleteID: "id-1", StartIndex: 2, EndIndex: 3, Completion: "B\nB2"},
+		{AutocompleteID: "id-2", StartIndex: 6, EndIndex: 7, Completion: "D"},
+	}
+	pending := edits
+	stream := StreamEdits(context.Background(), fileContents, func(ctx context.Context) (*AutocompleteResponse, error) {
+		if len(pending) == 0 {
+			return nil, io.EOF
+		}
+		next := pending[0]
+		pending = pending[1:]
+		return next, nil
+	})
+	var got []string
+	for line := range stream.LinesChan() {
+		got = append(got, line)
+	}
+
+	assert.Equal(t, []string{"a", "B", "B2", "c", "D"}, got, "lines")
+	assert.Equal(t, "id-1", stream.AutocompleteID, "id of the first edit")
+}
+
+func TestStreamEdits_EmitsLinesBeforeLaterEdits(t *testing.T) {
+	release := make(chan struct{})
+	calls := 0
+	stream := StreamEdits(context.Background(), "a\nb\nc", func(ctx context.Context) (*AutocompleteResponse, error) {
+		calls++
+		switch calls {
+		case 1:
+			return &AutocompleteResponse{StartIndex: 0, EndIndex: 2, Completion: "A\n"}, nil
+		case 2:
+			<-release
+			return &AutocompleteResponse{StartIndex: 4, EndIndex: 5, Completion: "C"}, nil
+		}
+		return nil, io.EOF
+	})
+
+	assert.Equal(t, "A", <-stream.LinesChan(), "first line before the second edit arrives")
+	close(release)
+	var rest []string
+	for line := range stream.LinesChan() {
+		rest = append(rest, line)
+	}
+	assert.Equal(t, []string{"b", "C"}, rest, "remaining lines")
+}
+
+func TestStreamEdits_NoEdits(t *testing.T) {
+	stream := StreamEdits(context.Background(), "a\nb", func(ctx context.Context) (*AutocompleteResponse, error) {
+		return nil, io.EOF
+	})
+	_, ok := <-stream.LinesChan()
+	assert.False(t, ok, "nothing emitted")
+}
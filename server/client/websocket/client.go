@@ -0,0 +1,427 @@
+// Package websocket is a completion client for self-hosted gateways that
+// stream tokens over a WebSocket, used by the OpenAI-compatible providers
+// instead of HTTP+SSE to cut connection setup from every request.
+//
+// One connection is kept open and shared by all requests. Each request is a
+// text message holding an OpenAI completion request with a "request_id":
+//
+//	{"request_id": 7, "prompt": "...", "stream": true, ...}
+//
+// The gateway answers with text messages carrying the same request_id: one
+// OpenAI completion chunk per message while streaming, then {"done": true}.
+// Non-streaming requests get a single completion response instead. Failures
+// are reported as {"request_id": 7, "error": "..."}, and {"cancel": true}
+// tells the gateway to stop generating for a request.
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"cursortab/client/openai"
+	"cursortab/logger"
+)
+
+const (
+	// Redials after a failed dial wait minReconnectDelay, doubling up to
+	// maxReconnectDelay while the gateway stays unreachable.
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 5 * time.Second
+
+	// Messages buffered per request before reading from the connection stops
+	// until the consumer catches up.
+	streamBuffer = 64
+)
+
+// envelope is the part of every gateway message the client routes on.
+type envelope struct {
+	RequestID uint64 `json:"request_id"`
+	Done      bool   `json:"done,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// request is a completion request sent to the gateway.
+type request struct {
+	RequestID uint64 `json:"request_id"`
+	*openai.CompletionRequest
+}
+
+// Client sends completion requests to the gateway at URL.
+type Client struct {
+	URL    string // ws:// or wss:// URL of the completion endpoint
+	APIKey string
+
+	mu        sync.Mutex
+	session   *session // nil until the first request, or after it broke
+	nextID    uint64
+	failures  int       // Consecutive failed dials
+	retryAt   time.Time // No redial before this after a failed dial
+	lastError error     // Error of the last failed dial
+}
+
+// NewClient creates a client for the gateway at url.
+func NewClient(url, apiKey string) *Client {
+	return &Client{URL: url, APIKey: apiKey}
+}
+
+// DoCompletion sends a non-streaming completion request.
+func (c *Client) DoCompletion(ctx context.Context, req *openai.CompletionRequest) (*openai.CompletionResponse, error) {
+	defer logger.Trace("websocket.DoCompletion")()
+
+	req.Stream = false
+	sub, msg, _, err := c.roundTrip(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	sub.finish()
+
+	var resp openai.CompletionResponse
+	if err := json.Unmarshal(msg, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &resp, nil
+}
+
+// DoLineStream sends a streaming completion request and returns lines as they
+// complete, with the same semantics as openai.Client.DoLineStream.
+func (c *Client) DoLineStream(ctx context.Context, req *openai.CompletionRequest, maxLines int, stopTokens []string) *openai.LineStream {
+	return openai.StreamLines(ctx, func(ctx context.Context) (io.ReadCloser, error) {
+		return c.openStream(ctx, req)
+	}, maxLines, stopTokens)
+}
+
+// DoTokenStream sends a streaming completion request and emits cumulative
+// text, with the same semantics as openai.Client.DoTokenStream.
+func (c *Client) DoTokenStream(ctx context.Context, req *openai.CompletionRequest, maxChars int, stopTokens []string) *openai.LineStream {
+	return openai.StreamTokens(ctx, func(ctx context.Context) (io.ReadCloser, error) {
+		return c.openStream(ctx, req)
+	}, maxChars, stopTokens)
+}
+
+// openStream sends a streaming request and returns its chunks as an SSE body
+// once the first one arrived, so that a request the gateway rejects fails
+// here like an HTTP error status would. Reads from the body drive reads from
+// the connection: a slow consumer holds the gateway back instead of piling
+// up chunks in memory.
+func (c *Client) openStream(ctx context.Context, req *openai.CompletionRequest) (io.ReadCloser, error) {
+	req.Stream = true
+	sub, msg, done, err := c.roundTrip(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, w := io.Pipe()
+	go func() {
+		w.CloseWithError(pump(ctx, sub, msg, done, w))
+	}()
+	return body, nil
+}
+
+// pump writes the chunks of sub to w as SSE events until the stream ends,
+// starting with the already received msg.
+func pump(ctx context.Context, sub *subscription, msg []byte, done bool, w io.Writer) error {
+	for {
+		if done {
+			sub.finish()
+			_, err := io.WriteString(w, "data: [DONE]\n\n")
+			return err
+		}
+
+		// SSE data must fit on one line
+		var event bytes.Buffer
+		event.WriteString("data: ")
+		if err := json.Compact(&event, msg); err != nil {
+			sub.close()
+			return fmt.Errorf("failed to decode message: %w", err)
+		}
+		event.WriteString("\n\n")
+		if _, err := w.Write(event.Bytes()); err != nil {
+			// The consumer closed the body: the stream was cancelled
+			sub.close()
+			return err
+		}
+
+		var err error
+		if msg, done, err = sub.next(ctx); err != nil {
+			sub.close()
+			return err
+		}
+	}
+}
+
+// roundTrip sends req and waits for the first message answering it. When
+// the connection breaks before that, which happens when it went stale while
+// idle, the request is sent once more on a new connection.
+func (c *Client) roundTrip(ctx context.Context, req *openai.CompletionRequest) (*subscription, []byte, bool, error) {
+	sub, err := c.send(ctx, req)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	msg, done, err := sub.next(ctx)
+	if errors.Is(err, errConnectionLost) {
+		logger.Debug("websocket: connection lost before the first response, resending")
+		sub.close()
+		if sub, err = c.send(ctx, req); err != nil {
+			return nil, nil, false, err
+		}
+		msg, done, err = sub.next(ctx)
+	}
+	if err != nil {
+		sub.close()
+		return nil, nil, false, err
+	}
+	return sub, msg, done, nil
+}
+
+// send sends req on the current connection, connecting first if needed, and
+// subscribes to its responses. A connection that fails the write is replaced
+// once.
+func (c *Client) send(ctx context.Context, req *openai.CompletionRequest) (*subscription, error) {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.mu.Unlock()
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(request{RequestID: id, CompletionRequest: req}); err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	msg := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+
+	for attempt := 0; ; attempt++ {
+		s, err := c.connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sub := s.subscribe(id)
+		err = s.conn.writeText(msg)
+		if err == nil {
+			return sub, nil
+		}
+		s.fail(err)
+		sub.finish()
+		if attempt > 0 {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+	}
+}
+
+// connect returns the open connection, dialing a new one when there is none.
+// After a failed dial, requests fail fast with the dial error until the
+// reconnect delay has passed.
+func (c *Client) connect(ctx context.Context) (*session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session != nil && !c.session.broken() {
+		return c.session, nil
+	}
+	if time.Now().Before(c.retryAt) {
+		return nil, c.lastError
+	}
+
+	header := http.Header{}
+	if c.APIKey != "" {
+		header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	conn, err := dial(ctx, c.URL, header)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		c.failures++
+		c.retryAt = time.Now().Add(reconnectDelay(c.failures))
+		c.lastError = fmt.Errorf("failed to connect: %w", err)
+		return nil, c.lastError
+	}
+	if c.failures > 0 {
+		logger.Info("websocket: reconnected to %s after %d failed attempts", c.URL, c.failures)
+	}
+	c.failures = 0
+	c.retryAt = time.Time{}
+	c.session = newSession(conn)
+	return c.session, nil
+}
+
+// reconnectDelay returns how long to wait before redialing after failures
+// consecutive failed dials.
+func reconnectDelay(failures int) time.Duration {
+	delay := minReconnectDelay
+	for i := 1; i < failures && delay < maxReconnectDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxReconnectDelay)
+}
+
+var errConnectionLost = errors.New("websocket connection lost")
+
+// session is one open connection and the requests waiting on it.
+type session struct {
+	conn *conn
+
+	mu   sync.Mutex
+	subs map[uint64]*subscription
+	err  error         // Why the connection broke
+	done chan struct{} // Closed once the connection broke
+	once sync.Once
+}
+
+func newSession(conn *conn) *session {
+	s := &session{
+		conn: conn,
+		subs: make(map[uint64]*subscription),
+		done: make(chan struct{}),
+	}
+	go s.readLoop()
+	return s
+}
+
+func (s *session) broken() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// fail marks the connection as broken and closes it.
+func (s *session) fail(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		close(s.done)
+		s.conn.close()
+	})
+}
+
+// readLoop routes each message to the request it answers. Messages for
+// requests that are gone are dropped.
+func (s *session) readLoop() {
+	for {
+		msg, err := s.conn.readMessage()
+		if err != nil {
+			if !s.broken() {
+				logger.Debug("websocket: connection closed: %v", err)
+			}
+			s.fail(err)
+			return
+		}
+
+		var env envelope
+		if err := json.Unmarshal(msg, &env); err != nil {
+			logger.Debug("websocket: dropping undecodable message: %v", err)
+			continue
+		}
+		s.mu.Lock()
+		sub := s.subs[env.RequestID]
+		s.mu.Unlock()
+		if sub == nil {
+			continue
+		}
+		// Blocks while the request's buffer is full, which holds back the
+		// gateway through TCP flow control
+		select {
+		case sub.messages <- msg:
+		case <-sub.closed:
+		}
+	}
+}
+
+func (s *session) subscribe(id uint64) *subscription {
+	sub := &subscription{
+		id:       id,
+		session:  s,
+		messages: make(chan []byte, streamBuffer),
+		closed:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.subs[id] = sub
+	s.mu.Unlock()
+	return sub
+}
+
+// subscription receives the messages answering one request.
+type subscription struct {
+	id       uint64
+	session  *session
+	messages chan []byte
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// next returns the next message for the request and whether it ends the
+// stream, or the error the gateway reported. Messages already received are
+// returned before a broken connection is reported as errConnectionLost.
+func (sub *subscription) next(ctx context.Context) ([]byte, bool, error) {
+	var msg []byte
+	select {
+	case msg = <-sub.messages:
+	default:
+		select {
+		case msg = <-sub.messages:
+		case <-sub.session.done:
+			select {
+			case msg = <-sub.messages:
+			default:
+				sub.session.mu.Lock()
+				err := sub.session.err
+				sub.session.mu.Unlock()
+				return nil, false, fmt.Errorf("%w: %v", errConnectionLost, err)
+			}
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+
+	var env envelope
+	if err := json.Unmarshal(msg, &env); err != nil {
+		return nil, false, fmt.Errorf("failed to decode message: %w", err)
+	}
+	if env.Error != "" {
+		sub.finish()
+		return nil, false, fmt.Errorf("gateway error: %s", env.Error)
+	}
+	return msg, env.Done, nil
+}
+
+// finish stops routing messages to the request once it ended.
+func (sub *subscription) finish() {
+	sub.once.Do(func() {
+		close(sub.closed)
+		sub.session.mu.Lock()
+		delete(sub.session.subs, sub.id)
+		sub.session.mu.Unlock()
+	})
+}
+
+// close ends the request, telling the gateway to stop generating when the
+// request had not finished yet.
+func (sub *subscription) close() {
+	select {
+	case <-sub.closed:
+		return
+	default:
+	}
+	sub.finish()
+	if sub.session.broken() {
+		return
+	}
+	msg, _ := json.Marshal(struct {
+		RequestID uint64 `json:"request_id"`
+		Cancel    bool   `json:"cancel"`
+	}{sub.id, true})
+	if err := sub.session.conn.writeText(msg); err != nil {
+		sub.session.fail(err)
+	}
+}
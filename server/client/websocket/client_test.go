@@ -0,0 +1,263 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/client/openai"
+)
+
+// upgrade performs the server side of the opening handshake.
+func upgrade(t *testing.T, w http.ResponseWriter, r *http.Request) *conn {
+	t.Helper()
+	netConn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Fatalf("hijack: %v", err)
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		acceptKey(r.Header.Get("Sec-WebSocket-Key")))
+	rw.Flush()
+	return &conn{netConn: netConn, br: rw.Reader}
+}
+
+type gatewayRequest struct {
+	RequestID uint64 `json:"request_id"`
+	Prompt    string `json:"prompt"`
+	Stream    bool   `json:"stream"`
+	Cancel    bool   `json:"cancel"`
+}
+
+// newGateway starts a gateway calling handle with each request it receives.
+// It returns the URL of the gateway and a counter of its connections.
+func newGateway(t *testing.T, handle func(c *conn, req gatewayRequest)) (string, *atomic.Int32) {
+	t.Helper()
+	var connections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connections.Add(1)
+		c := upgrade(t, w, r)
+		defer c.netConn.Close()
+		for {
+			msg, err := c.readMessage()
+			if err != nil {
+				return
+			}
+			var req gatewayRequest
+			json.Unmarshal(msg, &req)
+			handle(c, req)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return strings.Replace(server.URL, "http://", "ws://", 1), &connections
+}
+
+func sendJSON(c *conn, v any) {
+	msg, _ := json.Marshal(v)
+	c.writeText(msg)
+}
+
+func chunk(id uint64, text string) map[string]any {
+	return map[string]any{
+		"request_id": id,
+		"choices":    []map[string]any{{"text": text}},
+	}
+}
+
+func done(id uint64) map[string]any {
+	return map[string]any{"request_id": id, "done": true}
+}
+
+func collectLines(stream *openai.LineStream) ([]string, openai.StreamResult) {
+	var lines []string
+	for line := range stream.LinesChan() {
+		lines = append(lines, line)
+	}
+	return lines, <-stream.DoneChan()
+}
+
+func TestClientLineStream(t *testing.T) {
+	url, _ := newGateway(t, func(c *conn, req gatewayRequest) {
+		if req.Cancel {
+			return
+		}
+		sendJSON(c, chunk(req.RequestID, "hello\nwor"))
+		sendJSON(c, chunk(req.RequestID, "ld\n"))
+		sendJSON(c, chunk(req.RequestID, "end"))
+		sendJSON(c, done(req.RequestID))
+	})
+
+	client := NewClient(url, "")
+	stream := client.DoLineStream(context.Background(), &openai.CompletionRequest{Prompt: "p"}, 0, nil)
+	lines, result := collectLines(stream)
+
+	assert.Equal(t, []string{"hello", "world", "end"}, lines, "lines")
+	assert.Equal(t, "hello\nworld\nend", result.Text, "text")
+}
+
+func TestClientTokenStream(t *testing.T) {
+	url, _ := newGateway(t, func(c *conn, req gatewayRequest) {
+		if req.Cancel {
+			return
+		}
+		sendJSON(c, chunk(req.RequestID, "foo"))
+		sendJSON(c, chunk(req.RequestID, "bar"))
+		sendJSON(c, done(req.RequestID))
+	})
+
+	client := NewClient(url, "")
+	stream := client.DoTokenStream(context.Background(), &openai.CompletionRequest{Prompt: "p"}, 0, nil)
+	texts, result := collectLines(stream)
+
+	assert.Equal(t, []string{"foo", "foobar"}, texts, "cumulative text")
+	assert.Equal(t, "foobar", result.Text, "text")
+}
+
+func TestClientSharesConnection(t *testing.T) {
+	url, connections := newGateway(t, func(c *conn, req gatewayRequest) {
+		if req.Cancel {
+			return
+		}
+		sendJSON(c, chunk(req.RequestID, req.Prompt))
+		sendJSON(c, done(req.RequestID))
+	})
+
+	client := NewClient(url, "")
+	for _, prompt := range []string{"one", "two", "three"} {
+		_, result := collectLines(client.DoLineStream(context.Background(), &openai.CompletionRequest{Prompt: prompt}, 0, nil))
+		assert.Equal(t, prompt, result.Text, "response to "+prompt)
+	}
+	assert.Equal(t, int32(1), connections.Load(), "connections")
+}
+
+func TestClientAuthorizationHeader(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	client := NewClient(strings.Replace(server.URL, "http://", "ws://", 1), "secret")
+	_, err := client.DoCompletion(context.Background(), &openai.CompletionRequest{})
+
+	assert.Error(t, err, "handshake rejected")
+	assert.Contains(t, err.Error(), "status 403", "error message")
+	assert.Equal(t, "Bearer secret", authorization, "Authorization header")
+}
+
+func TestClientReconnects(t *testing.T) {
+	var requests atomic.Int32
+	url, connections := newGateway(t, func(c *conn, req gatewayRequest) {
+		if req.Cancel {
+			return
+		}
+		// The first connection drops without answering
+		if requests.Add(1) == 1 {
+			c.netConn.Close()
+			return
+		}
+		sendJSON(c, chunk(req.RequestID, "ok"))
+		sendJSON(c, done(req.RequestID))
+	})
+
+	client := NewClient(url, "")
+	_, result := collectLines(client.DoLineStream(context.Background(), &openai.CompletionRequest{}, 0, nil))
+
+	assert.Equal(t, "ok", result.Text, "resent on a new connection")
+	assert.Equal(t, int32(2), connections.Load(), "connections")
+}
+
+func TestClientCancelsStream(t *testing.T) {
+	cancelled := make(chan uint64, 1)
+	url, _ := newGateway(t, func(c *conn, req gatewayRequest) {
+		if req.Cancel {
+			cancelled <- req.RequestID
+			return
+		}
+		sendJSON(c, chunk(req.RequestID, "first\n"))
+	})
+
+	client := NewClient(url, "")
+	stream := client.DoLineStream(context.Background(), &openai.CompletionRequest{}, 0, nil)
+	assert.Equal(t, "first", <-stream.LinesChan(), "first line")
+	stream.Cancel()
+
+	select {
+	case id := <-cancelled:
+		assert.Equal(t, uint64(1), id, "cancelled request")
+	case <-time.After(time.Second):
+		t.Fatal("gateway was not told to cancel")
+	}
+}
+
+func TestClientGatewayError(t *testing.T) {
+	url, _ := newGateway(t, func(c *conn, req gatewayRequest) {
+		sendJSON(c, map[string]any{"request_id": req.RequestID, "error": "model not loaded"})
+	})
+
+	client := NewClient(url, "")
+	_, result := collectLines(client.DoLineStream(context.Background(), &openai.CompletionRequest{}, 0, nil))
+	assert.Equal(t, "error", result.FinishReason, "finish reason")
+
+	_, err := client.DoCompletion(context.Background(), &openai.CompletionRequest{})
+	assert.Error(t, err, "DoCompletion")
+	assert.Contains(t, err.Error(), "model not loaded", "error message")
+}
+
+func TestClientDoCompletion(t *testing.T) {
+	url, _ := newGateway(t, func(c *conn, req gatewayRequest) {
+		assert.False(t, req.Stream, "stream")
+		sendJSON(c, map[string]any{
+			"request_id": req.RequestID,
+			"choices":    []map[string]any{{"text": "done", "finish_reason": "stop"}},
+		})
+	})
+
+	client := NewClient(url, "")
+	resp, err := client.DoCompletion(context.Background(), &openai.CompletionRequest{Prompt: "p"})
+
+	assert.NoError(t, err, "DoCompletion")
+	assert.Equal(t, "done", resp.Choices[0].Text, "text")
+	assert.Equal(t, "stop", resp.Choices[0].FinishReason, "finish reason")
+}
+
+func TestClientFailsFastWhileReconnecting(t *testing.T) {
+	client := NewClient("ws://127.0.0.1:1", "")
+
+	_, err := client.DoCompletion(context.Background(), &openai.CompletionRequest{})
+	assert.Error(t, err, "first dial")
+	retryAt := client.retryAt
+	_, err = client.DoCompletion(context.Background(), &openai.CompletionRequest{})
+	assert.Error(t, err, "during the reconnect delay")
+	assert.Equal(t, retryAt, client.retryAt, "no redial before the delay")
+}
+
+func TestReconnectDelay(t *testing.T) {
+	assert.Equal(t, minReconnectDelay, reconnectDelay(1), "first failure")
+	assert.Equal(t, 4*minReconnectDelay, reconnectDelay(3), "doubles")
+	assert.Equal(t, maxReconnectDelay, reconnectDelay(20), "capped")
+}
+
+func TestFrameSizes(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 65535, 65536} {
+		url, _ := newGateway(t, func(c *conn, req gatewayRequest) {
+			sendJSON(c, map[string]any{
+				"request_id": req.RequestID,
+				"choices":    []map[string]any{{"text": req.Prompt}},
+			})
+		})
+		prompt := strings.Repeat("x", size)
+
+		resp, err := NewClient(url, "").DoCompletion(context.Background(), &openai.CompletionRequest{Prompt: prompt})
+
+		assert.NoError(t, err, fmt.Sprintf("DoCompletion with %d bytes", size))
+		assert.Equal(t, size, len(resp.Choices[0].Text), "echoed prompt length")
+	}
+}
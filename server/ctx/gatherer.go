@@ -18,9 +18,13 @@ type SourceRequest struct {
 	CursorRow         int // 1-indexed
 	CursorCol         int // 0-indexed
 	WorkspacePath     string
-	MaxDiffBytes      int // Git diff byte threshold (0 = default 4096)
-	MaxChangedSymbols int // Max symbols from large diffs (0 = default 50)
-	MaxSiblings       int // Max treesitter siblings (0 = default 50)
+	ProjectRoot       string // Root of the project holding the file
+	MaxDiffBytes      int    // Git diff byte threshold (0 = default 4096)
+	MaxChangedSymbols int    // Max symbols from large diffs (0 = default 50)
+	MaxSiblings       int    // Max treesitter siblings (0 = default 50)
+	MaxLSPSymbols     int    // Max identifiers looked up with LSP (<= 0 = disabled)
+	MaxGitCommits     int    // Max commits of the file in its git history (<= 0 = disabled)
+	LineCount         int    // Lines of the file
 }
 
 // NewGatherer creates a Gatherer with all built-in context sources.
@@ -30,6 +34,8 @@ func NewGatherer(buf *buffer.NvimBuffer) *Gatherer {
 			&diagnostics{buffer: buf},
 			&treesitter{buffer: buf},
 			&gitDiff{},
+			&gitHistory{},
+			&lsp{buffer: buf},
 		},
 	}
 }
@@ -84,6 +90,12 @@ func (g *Gatherer) Gather(ctx context.Context, req *SourceRequest) *types.Contex
 		if r.GitDiff != nil {
 			merged.GitDiff = r.GitDiff
 		}
+		if r.GitHistory != nil {
+			merged.GitHistory = r.GitHistory
+		}
+		if r.LSP != nil {
+			merged.LSP = r.LSP
+		}
 	}
 
 	return merged
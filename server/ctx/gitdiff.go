@@ -2,6 +2,7 @@ package ctx
 
 import (
 	"bufio"
+	"cmp"
 	"context"
 	"os/exec"
 	"strings"
@@ -18,7 +19,7 @@ func (g *gitDiff) Gather(ctx context.Context, req *SourceRequest) *types.Context
 		return nil
 	}
 
-	workDir := req.WorkspacePath
+	workDir := cmp.Or(req.ProjectRoot, req.WorkspacePath)
 	if workDir == "" {
 		return nil
 	}
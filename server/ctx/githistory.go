@@ -0,0 +1,98 @@
+package ctx
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"cursortab/types"
+)
+
+// blameRadius is how many lines above and below the cursor are blamed.
+const blameRadius = 10
+
+// gitHistory gathers the latest commits of the current file and the blame
+// of the lines around the cursor, telling the model why the code changed.
+type gitHistory struct{}
+
+func (g *gitHistory) Gather(ctx context.Context, req *SourceRequest) *types.ContextResult {
+	if req.MaxGitCommits <= 0 || req.FilePath == "" || strings.HasSuffix(req.FilePath, "COMMIT_EDITMSG") {
+		return nil
+	}
+
+	dir, path := req.WorkspacePath, req.FilePath
+	if filepath.IsAbs(path) {
+		dir, path = filepath.Dir(path), filepath.Base(path)
+	}
+	if dir == "" {
+		return nil
+	}
+
+	commits := parseGitLog(runGit(ctx, dir, "log", fmt.Sprintf("-n%d", req.MaxGitCommits), "--format=%h %s", "--", path))
+	if len(commits) == 0 {
+		return nil
+	}
+
+	history := &types.GitHistoryContext{Commits: commits}
+	start := max(req.CursorRow-blameRadius, 1)
+	end := min(req.CursorRow+blameRadius, req.LineCount)
+	if start <= end {
+		history.Blame = parseBlame(runGit(ctx, dir, "blame", "--porcelain", "-L", fmt.Sprintf("%d,%d", start, end), "--", path))
+	}
+	return &types.ContextResult{GitHistory: history}
+}
+
+// parseGitLog returns the non-empty lines of git log output.
+func parseGitLog(out string) []string {
+	var commits []string
+	for line := range strings.SplitSeq(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			commits = append(commits, line)
+		}
+	}
+	return commits
+}
+
+// parseBlame parses git blame --porcelain output into runs of lines last
+// changed by the same commit. Uncommitted lines are left out.
+func parseBlame(out string) []*types.BlameEntry {
+	type commitInfo struct{ author, summary string }
+	commits := map[string]*commitInfo{}
+	var entries []*types.BlameEntry
+	var current *commitInfo
+	var hash string
+	line := 0
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, "\t"):
+			if strings.Trim(hash, "0") == "" {
+				continue
+			}
+			if last := len(entries) - 1; last >= 0 && entries[last].Commit == hash[:7] && entries[last].EndLine == line-1 {
+				entries[last].EndLine = line
+				continue
+			}
+			entries = append(entries, &types.BlameEntry{StartLine: line, EndLine: line, Commit: hash[:7], Author: current.author, Summary: current.summary})
+		case strings.HasPrefix(text, "author ") && current != nil:
+			current.author = strings.TrimPrefix(text, "author ")
+		case strings.HasPrefix(text, "summary ") && current != nil:
+			current.summary = strings.TrimPrefix(text, "summary ")
+		default:
+			var origLine, finalLine int
+			var h string
+			if n, _ := fmt.Sscanf(text, "%s %d %d", &h, &origLine, &finalLine); n == 3 && len(h) >= 40 {
+				hash, line = h, finalLine
+				if commits[hash] == nil {
+					commits[hash] = &commitInfo{}
+				}
+				current = commits[hash]
+			}
+		}
+	}
+	return entries
+}
@@ -0,0 +1,83 @@
+package ctx
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestParseBlame_MergesRunsOfOneCommit(t *testing.T) {
+	out := `1111111111111111111111111111111111111111 1 1 2
+author Ada
+author-mail <ada@example.com>
+summary Add loader
+filename main.go
+	func load() {
+1111111111111111111111111111111111111111 2 2
+	}
+2222222222222222222222222222222222222222 3 3 1
+author Grace
+summary Rename fetch to load
+filename main.go
+	load()
+0000000000000000000000000000000000000000 4 4 1
+author Not Committed Yet
+summary Version of main.go from main.go
+filename main.go
+	wip()
+1111111111111111111111111111111111111111 5 5 1
+filename main.go
+	// loaded
+`
+
+	entries := parseBlame(out)
+
+	assert.Len(t, 3, entries, "entries")
+	assert.Equal(t, types.BlameEntry{StartLine: 1, EndLine: 2, Commit: "1111111", Author: "Ada", Summary: "Add loader"}, *entries[0], "run of lines")
+	assert.Equal(t, "Rename fetch to load", entries[1].Summary, "second commit")
+	assert.Equal(t, 5, entries[2].StartLine, "uncommitted line skipped")
+	assert.Equal(t, "Ada", entries[2].Author, "repeated commit reuses its details")
+}
+
+func TestGitHistory_Gather(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Ada", "-c", "user.email=ada@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+	git("init", "-q")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc fetch() {}\n"), 0o644), "write")
+	git("add", "main.go")
+	git("commit", "-q", "-m", "Add fetch")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc load() {}\n"), 0o644), "write")
+	git("commit", "-q", "-am", "Rename fetch to load")
+
+	result := (&gitHistory{}).Gather(context.Background(), &SourceRequest{
+		FilePath:      "main.go",
+		WorkspacePath: dir,
+		CursorRow:     3,
+		LineCount:     3,
+		MaxGitCommits: 5,
+	})
+
+	assert.NotNil(t, result, "result")
+	history := result.GitHistory
+	assert.Len(t, 2, history.Commits, "commits")
+	assert.Contains(t, history.Commits[0], "Rename fetch to load", "newest first")
+	assert.Len(t, 2, history.Blame, "blame runs")
+	assert.Equal(t, 3, history.Blame[1].StartLine, "renamed line")
+	assert.Equal(t, "Rename fetch to load", history.Blame[1].Summary, "renamed line summary")
+}
+
+func TestGitHistory_Disabled(t *testing.T) {
+	result := (&gitHistory{}).Gather(context.Background(), &SourceRequest{FilePath: "main.go", WorkspacePath: t.TempDir()})
+
+	assert.Nil(t, result, "disabled")
+}
@@ -0,0 +1,29 @@
+package ctx
+
+import (
+	"context"
+
+	"cursortab/buffer"
+	"cursortab/types"
+)
+
+// lspTimeout bounds the hover and definition requests, leaving the rest of
+// GatherTimeout for the round trip to Neovim.
+const lspTimeout = GatherTimeout * 3 / 4
+
+// lsp gathers hover text and definitions of identifiers near the cursor from
+// the language servers attached to the buffer.
+type lsp struct {
+	buffer *buffer.NvimBuffer
+}
+
+func (l *lsp) Gather(_ context.Context, req *SourceRequest) *types.ContextResult {
+	if req.MaxLSPSymbols <= 0 {
+		return nil
+	}
+	symbols := l.buffer.LSPSymbols(req.CursorRow, req.CursorCol, req.MaxLSPSymbols, lspTimeout)
+	if symbols == nil {
+		return nil
+	}
+	return &types.ContextResult{LSP: symbols}
+}
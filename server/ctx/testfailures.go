@@ -0,0 +1,172 @@
+package ctx
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"cursortab/logger"
+	"cursortab/types"
+)
+
+const (
+	maxTestFailures        = 10               // Failing tests kept from one run
+	maxFailureMessageLines = 5                // Assertion lines kept per failing test
+	testCommandInterval    = 30 * time.Second // Minimum time between two runs of the command
+)
+
+// TestFailures is a context injector passing the failing tests of the latest
+// test run, with their assertion messages, to the provider. The run output
+// is read from a file or printed by a command, relative to the project root.
+type TestFailures struct {
+	file    string
+	command string
+
+	mu      sync.Mutex
+	path    string    // File, or command directory, the cached lines were parsed from
+	modTime time.Time // Modification time of the file, or run time of the command, when parsed
+	lines   []string
+}
+
+// NewTestFailures returns a test failure injector reading file, or the
+// output of command when set. The command runs at most every
+// testCommandInterval and should print the output of the last run rather
+// than run the tests, as it gets the injector timeout.
+func NewTestFailures(file, command string) *TestFailures {
+	return &TestFailures{file: file, command: command}
+}
+
+func (t *TestFailures) Name() string {
+	return "test failures"
+}
+
+func (t *TestFailures) Collect(ctx context.Context, req *types.CompletionRequest) types.ContextChunk {
+	dir := cmp.Or(req.ProjectRoot, req.WorkspacePath)
+	if dir == "" {
+		return types.ContextChunk{}
+	}
+	if t.command != "" {
+		return types.ContextChunk{Lines: t.commandFailures(ctx, dir)}
+	}
+	return types.ContextChunk{Title: t.file, Lines: t.fileFailures(filepath.Join(dir, t.file))}
+}
+
+// commandFailures returns the failures in the output of the command run in
+// dir, running it again only when the last run is testCommandInterval old.
+func (t *TestFailures) commandFailures(ctx context.Context, dir string) []string {
+	t.mu.Lock()
+	if dir == t.path && time.Since(t.modTime) < testCommandInterval {
+		defer t.mu.Unlock()
+		return t.lines
+	}
+	t.mu.Unlock()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", t.command)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	var lines []string
+	if err != nil && len(out) == 0 {
+		logger.Debug("test failures: %s: %v", t.command, err)
+	} else {
+		lines = parseTestFailures(string(out))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.path, t.modTime, t.lines = dir, time.Now(), lines
+	return lines
+}
+
+// fileFailures returns the failures in the output file at path, parsing it
+// again only when it was modified since the last call.
+func (t *TestFailures) fileFailures(path string) []string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if path == t.path && info.ModTime().Equal(t.modTime) {
+		return t.lines
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Debug("test failures: %v", err)
+		return nil
+	}
+	t.path, t.modTime, t.lines = path, info.ModTime(), parseTestFailures(string(data))
+	return t.lines
+}
+
+// failureFormat recognises the failures of one test runner.
+type failureFormat struct {
+	header *regexp.Regexp         // Line naming a failing test in group 1, with an optional message in group 2
+	body   func(line string) bool // Whether line continues the message of the failure above (nil for none)
+}
+
+var failureFormats = []failureFormat{
+	// go test: "--- FAIL: TestName (0.00s)" followed by indented log lines
+	{regexp.MustCompile(`^\s*--- FAIL: (\S+)`), func(line string) bool {
+		trimmed := strings.TrimSpace(line)
+		return (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) &&
+			!strings.HasPrefix(trimmed, "--- ") && !strings.HasPrefix(trimmed, "=== ")
+	}},
+	// pytest short summary: "FAILED tests/test_x.py::test_y - AssertionError: ..."
+	{regexp.MustCompile(`^FAILED (\S+)(?: - (.*))?$`), nil},
+	// cargo test: "---- tests::name stdout ----" followed by the panic message
+	{regexp.MustCompile(`^---- (\S+) stdout ----$`), func(line string) bool { return line != "" }},
+	// jest: "● Suite › test name" followed by the assertion message
+	{regexp.MustCompile(`^\s*● (.+)$`), func(line string) bool { return line != "" }},
+}
+
+// parseTestFailures extracts the failing tests of a test run output as
+// "FAIL name" lines, each followed by its indented assertion messages.
+func parseTestFailures(output string) []string {
+	var lines []string
+	failures := 0
+	var body func(string) bool
+	messages := 0
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if body != nil {
+			if messages == 0 && line == "" {
+				continue
+			}
+			if body(line) {
+				if messages < maxFailureMessageLines {
+					lines = append(lines, "  "+strings.TrimSpace(line))
+				}
+				messages++
+				continue
+			}
+			body = nil
+		}
+		for _, format := range failureFormats {
+			m := format.header.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			if failures == maxTestFailures {
+				return lines
+			}
+			failures++
+			lines = append(lines, "FAIL "+m[1])
+			if len(m) > 2 && m[2] != "" {
+				lines = append(lines, "  "+m[2])
+			}
+			body, messages = format.body, 0
+			break
+		}
+	}
+	return lines
+}
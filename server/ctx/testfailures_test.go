@@ -0,0 +1,133 @@
+package ctx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestParseTestFailures_GoTest(t *testing.T) {
+	output := `=== RUN   TestParse
+    parse_test.go:12: got 3, want 4
+--- FAIL: TestParse (0.00s)
+    parse_test.go:12: got 3, want 4
+=== RUN   TestOK
+--- PASS: TestOK (0.00s)
+FAIL
+FAIL	example.com/parse	0.003s`
+
+	lines := parseTestFailures(output)
+
+	assert.Equal(t, []string{"FAIL TestParse", "  parse_test.go:12: got 3, want 4"}, lines, "lines")
+}
+
+func TestParseTestFailures_GoSubtests(t *testing.T) {
+	output := `--- FAIL: TestParse (0.00s)
+    --- FAIL: TestParse/empty (0.00s)
+        parse_test.go:20: unexpected error`
+
+	lines := parseTestFailures(output)
+
+	assert.Equal(t, []string{"FAIL TestParse", "FAIL TestParse/empty", "  parse_test.go:20: unexpected error"}, lines, "lines")
+}
+
+func TestParseTestFailures_Pytest(t *testing.T) {
+	output := `=========================== short test summary info ============================
+FAILED tests/test_user.py::test_name - AssertionError: assert 'bob' == 'alice'
+FAILED tests/test_user.py::test_age
+========================= 2 failed, 3 passed in 0.12s =========================`
+
+	lines := parseTestFailures(output)
+
+	assert.Equal(t, []string{
+		"FAIL tests/test_user.py::test_name",
+		"  AssertionError: assert 'bob' == 'alice'",
+		"FAIL tests/test_user.py::test_age",
+	}, lines, "lines")
+}
+
+func TestParseTestFailures_CargoAndJest(t *testing.T) {
+	output := `---- tests::adds stdout ----
+thread 'tests::adds' panicked at src/lib.rs:10:9:
+assertion failed: left == right
+
+  ● math › adds numbers
+
+    expect(received).toBe(expected)
+
+    Expected: 4
+`
+
+	lines := parseTestFailures(output)
+
+	assert.Equal(t, []string{
+		"FAIL tests::adds",
+		"  thread 'tests::adds' panicked at src/lib.rs:10:9:",
+		"  assertion failed: left == right",
+		"FAIL math › adds numbers",
+		"  expect(received).toBe(expected)",
+	}, lines, "lines")
+}
+
+func TestParseTestFailures_Limits(t *testing.T) {
+	output := "--- FAIL: TestA\n"
+	for range maxFailureMessageLines + 3 {
+		output += "    a_test.go:1: message\n"
+	}
+	for range maxTestFailures {
+		output += "--- FAIL: TestMore\n"
+	}
+
+	lines := parseTestFailures(output)
+
+	assert.Len(t, 1+maxFailureMessageLines+maxTestFailures-1, lines, "lines")
+}
+
+func TestParseTestFailures_Passing(t *testing.T) {
+	assert.Len(t, 0, parseTestFailures("ok  \texample.com/parse\t0.003s"), "lines")
+}
+
+func TestTestFailures_CollectFromFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test-output.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("--- FAIL: TestParse (0.00s)\n"), 0o644), "write")
+	injector := NewTestFailures("test-output.txt", "")
+
+	chunk := injector.Collect(context.Background(), &types.CompletionRequest{ProjectRoot: dir})
+
+	assert.Equal(t, "test-output.txt", chunk.Title, "title")
+	assert.Equal(t, []string{"FAIL TestParse"}, chunk.Lines, "lines")
+}
+
+func TestTestFailures_CollectFromCommand(t *testing.T) {
+	injector := NewTestFailures("", "echo 'FAILED test_x.py::test_y'")
+
+	chunk := injector.Collect(context.Background(), &types.CompletionRequest{ProjectRoot: t.TempDir()})
+
+	assert.Equal(t, []string{"FAIL test_x.py::test_y"}, chunk.Lines, "lines")
+}
+
+func TestTestFailures_CommandOutputCached(t *testing.T) {
+	dir := t.TempDir()
+	injector := NewTestFailures("", "echo run >> runs.txt; echo 'FAILED test_x.py::test_y'")
+
+	injector.Collect(context.Background(), &types.CompletionRequest{ProjectRoot: dir})
+	chunk := injector.Collect(context.Background(), &types.CompletionRequest{ProjectRoot: dir})
+
+	assert.Equal(t, []string{"FAIL test_x.py::test_y"}, chunk.Lines, "cached lines")
+	runs, err := os.ReadFile(filepath.Join(dir, "runs.txt"))
+	assert.NoError(t, err, "read runs")
+	assert.Equal(t, "run\n", string(runs), "command ran once")
+}
+
+func TestTestFailures_MissingFile(t *testing.T) {
+	injector := NewTestFailures("test-output.txt", "")
+
+	chunk := injector.Collect(context.Background(), &types.CompletionRequest{ProjectRoot: t.TempDir()})
+
+	assert.Len(t, 0, chunk.Lines, "lines")
+}
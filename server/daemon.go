@@ -2,12 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -15,24 +19,45 @@ import (
 	"cursortab/buffer"
 	"cursortab/ctx"
 	"cursortab/engine"
+	"cursortab/ignore"
 	"cursortab/logger"
+	"cursortab/metrics"
+	"cursortab/provider/anthropic"
+	"cursortab/provider/chat"
 	"cursortab/provider/copilot"
 	"cursortab/provider/fim"
+	"cursortab/provider/gemini"
 	"cursortab/provider/inline"
 	"cursortab/provider/mercuryapi"
+	"cursortab/provider/ollama"
 	"cursortab/provider/sweep"
 	"cursortab/provider/sweepapi"
 	"cursortab/provider/zeta"
+	"cursortab/quality"
+	"cursortab/redact"
+	"cursortab/text"
+	"cursortab/tokenizer"
 	"cursortab/types"
+	"cursortab/watcher"
 
 	"github.com/neovim/go-client/nvim"
 )
 
+// notificationQueueSize is the number of engine notifications buffered for the editor
+const notificationQueueSize = 64
+
 type Daemon struct {
 	config      Config
 	provider    engine.Provider
+	failover    *engine.FailoverProvider // nil unless fallback providers are configured
+	qualityLog  *quality.Log             // nil unless the quality log is enabled
+	progress    chan engine.Progress     // Latest progress not yet pushed to the editor
+	events      chan engine.Notification // Engine notifications not yet pushed to the editor
 	buffer      *buffer.NvimBuffer
 	engine      *engine.Engine
+	watcher     *watcher.Watcher
+	reloadMu    sync.Mutex
+	trustMu     sync.Mutex
 	listener    net.Listener
 	socketPath  string
 	pidPath     string
@@ -43,24 +68,177 @@ type Daemon struct {
 }
 
 func NewDaemon(config Config) (*Daemon, error) {
+	buf := buffer.New(buffer.Config{
+		NsID:       config.NsID,
+		WordDiff:   config.Behavior.WordDiff,
+		InlineDiff: config.Behavior.InlineDiff,
+		ColumnUnit: text.ColumnUnit(config.Behavior.ColumnUnit),
+		MaxSize:    config.Behavior.MaxBufferSize * 1024,
+	})
+
+	prov, err := newProvider(config, config.Provider, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Provider.Race) > 0 {
+		racers := []engine.Provider{prov}
+		for _, race := range config.Provider.Race {
+			p, err := newProvider(config, race, buf)
+			if err != nil {
+				return nil, err
+			}
+			racers = append(racers, p)
+		}
+		logger.Info("racing %d providers", len(racers))
+		prov = engine.NewRaceProvider(racers...)
+	}
+
+	var failover *engine.FailoverProvider
+	if len(config.Provider.Fallback) > 0 {
+		members := []engine.FailoverMember{{
+			Name:     config.Provider.Type,
+			Model:    config.Provider.Model,
+			Provider: prov,
+			Check:    httpHealthCheck(config.Provider.URL),
+		}}
+		for _, fallback := range config.Provider.Fallback {
+			p, err := newProvider(config, fallback, buf)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, engine.FailoverMember{
+				Name:     fallback.Type,
+				Model:    fallback.Model,
+				Provider: p,
+				Check:    httpHealthCheck(fallback.URL),
+			})
+		}
+		logger.Info("failing over across %d providers", len(members))
+		failover = engine.NewFailoverProvider(engine.SystemClock, func(name string) {
+			go buf.NotifyProviderChanged(name)
+		}, members...)
+		prov = failover
+	}
+
+	engineCfg := engineConfig(config)
+	if engineCfg.Tokenizer, err = loadTokenizer(config.Provider.TokenizerVocab); err != nil {
+		return nil, err
+	}
+	eng, err := engine.NewEngine(prov, buf, engineCfg, engine.SystemClock, ctx.NewGatherer(buf))
+	if err != nil {
+		return nil, err
+	}
+	eng.SetConnectivityProbe(httpHealthCheck(config.Provider.URL))
+	if tf := config.Behavior.TestFailures; tf.File != "" || tf.Command != "" {
+		eng.RegisterInjector(ctx.NewTestFailures(tf.File, tf.Command))
+	}
+	eng.SetIgnoreRules(ignore.Load(eng.WorkspacePath, config.Behavior.IgnorePaths, config.Behavior.IgnoreGitignored))
+	if config.Behavior.RedactSecrets {
+		eng.SetRedactor(redact.New(config.Behavior.RedactPatterns))
+	}
+	if config.Behavior.PersistentCache {
+		if dir, err := os.UserCacheDir(); err != nil {
+			logger.Warn("persistent cache disabled: %v", err)
+		} else {
+			path := engine.CacheStorePath(filepath.Join(dir, "cursortab"), eng.WorkspacePath)
+			eng.SetCacheStore(engine.NewJSONLCacheStore(path, engine.CacheStoreMaxAge, engine.CacheStoreMaxBytes, engine.SystemClock))
+		}
+	}
+	if config.Behavior.MetricsLog {
+		eng.AddMetricsSink(metrics.NewFileSink(filepath.Join(config.StateDir, "metrics.jsonl")))
+	}
+	eng.SetProviderName(func() string {
+		if failover != nil {
+			return failover.ActiveName()
+		}
+		return config.Provider.Type
+	})
+	eng.SetModelName(func() string {
+		if failover != nil {
+			return failover.ActiveModel()
+		}
+		return config.Provider.Model
+	})
+	var qualityLog *quality.Log
+	if config.Behavior.QualityLog {
+		qualityLog = quality.NewLog(filepath.Join(config.StateDir, "quality.jsonl"))
+		eng.SetQualityLog(qualityLog)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Daemon{
+		config:     config,
+		provider:   prov,
+		failover:   failover,
+		qualityLog: qualityLog,
+		buffer:     buf,
+		engine:     eng,
+		socketPath: getSocketPath(config.StateDir),
+		pidPath:    getPidPath(config.StateDir),
+		shutdown:   make(chan bool, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+	}, nil
+}
+
+// httpHealthCheck pings a provider's server with a HEAD request. Any response
+// below 500 counts as healthy. Providers without a URL get no health check.
+func httpHealthCheck(url string) engine.HealthCheck {
+	if url == "" {
+		return nil
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("health check failed with status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// newProvider creates the provider described by providerConfig.
+func newProvider(config Config, providerConfig ProviderConfig, buf *buffer.NvimBuffer) (engine.Provider, error) {
 	apiKey := ""
-	if config.Provider.ApiKeyEnv != "" {
-		apiKey = os.Getenv(config.Provider.ApiKeyEnv)
+	if providerConfig.ApiKeyEnv != "" {
+		apiKey = os.Getenv(providerConfig.ApiKeyEnv)
 		if apiKey == "" {
-			logger.Warn("api_key_env is set to %q but environment variable is not defined", config.Provider.ApiKeyEnv)
+			logger.Warn("api_key_env is set to %q but environment variable is not defined", providerConfig.ApiKeyEnv)
 		}
 	}
 
-	providerConfig := &types.ProviderConfig{
-		ProviderURL:         config.Provider.URL,
+	tok, err := loadTokenizer(providerConfig.TokenizerVocab)
+	if err != nil {
+		return nil, err
+	}
+
+	typesConfig := &types.ProviderConfig{
+		ProviderURL:         providerConfig.URL,
 		APIKey:              apiKey,
-		ProviderModel:       config.Provider.Model,
-		ProviderTemperature: config.Provider.Temperature,
-		ProviderMaxTokens:   config.Provider.MaxTokens,
-		ProviderTopK:        config.Provider.TopK,
-		CompletionPath:      config.Provider.CompletionPath,
-		CompletionTimeout:   config.Provider.CompletionTimeout,
-		PrivacyMode:         config.Provider.PrivacyMode,
+		ProviderModel:       providerConfig.Model,
+		ProviderTemperature: providerConfig.Temperature,
+		ProviderMaxTokens:   providerConfig.MaxTokens,
+		MaxOutputTokens:     providerConfig.ContextLimits.MaxOutputTokens,
+		MaxInputLines:       providerConfig.ContextLimits.MaxInputLines,
+		MaxInputBytes:       providerConfig.ContextLimits.MaxInputBytes,
+		Tokenizer:           tok,
+		ProviderTopK:        providerConfig.TopK,
+		ProviderSeed:        providerConfig.Seed,
+		CompletionPath:      providerConfig.CompletionPath,
+		SystemPrompt:        providerConfig.SystemPrompt,
+		StopSequences:       providerConfig.StopSequences,
+		CompletionTimeout:   providerConfig.CompletionTimeout,
+		Transport:           providerConfig.Transport,
+		PrivacyMode:         providerConfig.PrivacyMode,
 		Version:             "0.5.1-beta", // AUTO-UPDATED by release workflow
 		EditorVersion:       config.EditorVersion,
 		EditorOS:            config.EditorOS,
@@ -68,68 +246,119 @@ func NewDaemon(config Config) (*Daemon, error) {
 		DeviceID:            loadOrCreateDeviceID(config.StateDir),
 	}
 
-	providerConfig.FIMTokens = types.FIMTokenConfig{
-		Prefix: config.Provider.FIMTokens.Prefix,
-		Suffix: config.Provider.FIMTokens.Suffix,
-		Middle: config.Provider.FIMTokens.Middle,
+	typesConfig.FIMTokens = types.FIMTokenConfig{
+		Prefix: providerConfig.FIMTokens.Prefix,
+		Suffix: providerConfig.FIMTokens.Suffix,
+		Middle: providerConfig.FIMTokens.Middle,
 	}
 
-	buf := buffer.New(buffer.Config{
-		NsID: config.NsID,
-	})
-
-	var prov engine.Provider
-	switch types.ProviderType(config.Provider.Type) {
+	switch types.ProviderType(providerConfig.Type) {
 	case types.ProviderTypeInline:
-		prov = inline.NewProvider(providerConfig)
+		return inline.NewProvider(typesConfig), nil
 	case types.ProviderTypeFIM:
-		prov = fim.NewProvider(providerConfig)
+		return fim.NewProvider(typesConfig), nil
 	case types.ProviderTypeSweep:
-		prov = sweep.NewProvider(providerConfig)
+		return sweep.NewProvider(typesConfig), nil
 	case types.ProviderTypeSweepAPI:
-		prov = sweepapi.NewProvider(providerConfig)
+		return sweepapi.NewProvider(typesConfig), nil
 	case types.ProviderTypeZeta:
-		prov = zeta.NewProvider(providerConfig)
+		return zeta.NewProvider(typesConfig), nil
 	case types.ProviderTypeCopilot:
-		prov = copilot.NewProvider(buf)
+		return copilot.NewProvider(buf), nil
 	case types.ProviderTypeMercuryAPI:
-		prov = mercuryapi.NewProvider(providerConfig)
+		return mercuryapi.NewProvider(typesConfig), nil
+	case types.ProviderTypeOllama:
+		return ollama.NewProvider(typesConfig), nil
+	case types.ProviderTypeChat:
+		return chat.NewProvider(typesConfig), nil
+	case types.ProviderTypeGemini:
+		return gemini.NewProvider(typesConfig)
+	case types.ProviderTypeAnthropic:
+		return anthropic.NewProvider(typesConfig)
 	default:
-		return nil, fmt.Errorf("unsupported provider type: %s", config.Provider.Type)
+		return nil, fmt.Errorf("unsupported provider type: %s", providerConfig.Type)
+	}
+}
+
+// loadTokenizer returns the BPE tokenizer of the vocabulary at path, or nil
+// for the heuristic when path is empty.
+func loadTokenizer(path string) (tokenizer.Tokenizer, error) {
+	if path == "" {
+		return nil, nil
 	}
+	bpe, err := tokenizer.LoadBPE(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading tokenizer_vocab: %w", err)
+	}
+	logger.Info("counting tokens with the vocabulary at %s", path)
+	return bpe, nil
+}
 
-	eng, err := engine.NewEngine(prov, buf, engine.EngineConfig{
-		NsID:                config.NsID,
-		CompletionTimeout:   time.Duration(config.Provider.CompletionTimeout) * time.Millisecond,
-		IdleCompletionDelay: time.Duration(config.Behavior.IdleCompletionDelay) * time.Millisecond,
-		TextChangeDebounce:  time.Duration(config.Behavior.TextChangeDebounce) * time.Millisecond,
+// engineConfig derives the engine configuration from the daemon config.
+func engineConfig(config Config) engine.EngineConfig {
+	return engine.EngineConfig{
+		NsID:                  config.NsID,
+		CompletionTimeout:     time.Duration(config.Provider.CompletionTimeout) * time.Millisecond,
+		IdleCompletionDelay:   time.Duration(config.Behavior.IdleCompletionDelay) * time.Millisecond,
+		ScanDelay:             time.Duration(config.Behavior.ScanDelay) * time.Millisecond,
+		TextChangeDebounce:    time.Duration(config.Behavior.TextChangeDebounce) * time.Millisecond,
+		TriggerPolicy:         engine.TriggerPolicy(config.Behavior.TriggerPolicy),
+		DisplayTTL:            time.Duration(config.Behavior.DisplayTTL) * time.Millisecond,
+		CacheTTL:              time.Duration(config.Behavior.CacheTTL) * time.Millisecond,
+		CacheMaxEntries:       config.Behavior.CacheMaxEntries,
+		DisableTelemetry:      !config.Behavior.Telemetry,
+		EOFPolicy:             engine.EOFPolicy(config.Provider.EOFPolicy),
+		TokenBudget:           config.Provider.TokenBudget,
+		MaxRequestsPerMinute:  config.Provider.MaxRequestsPerMinute,
+		MaxConcurrentRequests: config.Provider.MaxConcurrent,
+		CircuitBreaker: engine.CircuitBreakerConfig{
+			Failures: config.Provider.CircuitBreaker.Failures,
+			Cooldown: time.Duration(config.Provider.CircuitBreaker.Cooldown) * time.Millisecond,
+		},
+		ContextBudget:   contextBudgeter(config.Provider.ContextBudget),
+		MaxPayloadBytes: config.Provider.MaxPayloadBytes,
+		ContextLimits: engine.ContextLimits{
+			MaxInputLines:   config.Provider.ContextLimits.MaxInputLines,
+			MaxInputBytes:   config.Provider.ContextLimits.MaxInputBytes,
+			MaxOutputTokens: config.Provider.ContextLimits.MaxOutputTokens,
+		},
+		ProviderOptions: config.Provider.Options,
 		CursorPrediction: engine.CursorPredictionConfig{
 			Enabled:            config.Behavior.CursorPrediction.Enabled,
 			AutoAdvance:        config.Behavior.CursorPrediction.AutoAdvance,
 			ProximityThreshold: config.Behavior.CursorPrediction.ProximityThreshold,
+			CursorOnly:         config.Behavior.CursorPrediction.CursorOnly,
+			PrefetchDepth:      config.Behavior.CursorPrediction.PrefetchDepth,
 		},
-		MaxDiffTokens:    config.Provider.MaxDiffHistoryTokens,
-		MaxVisibleLines:  config.Behavior.MaxVisibleLines,
-		CompleteInInsert: config.Behavior.CompleteInInsert,
-		CompleteInNormal: config.Behavior.CompleteInNormal,
-	}, engine.SystemClock, ctx.NewGatherer(buf))
-	if err != nil {
-		return nil, err
+		StageOrder: text.StageOrder(config.Behavior.Staging.Order),
+		RenamePropagation: engine.RenamePropagationConfig{
+			Enabled:   config.Behavior.RenamePropagation.Enabled,
+			Workspace: config.Behavior.RenamePropagation.Workspace,
+		},
+		Placeholders:       config.Behavior.Placeholders,
+		AutoImport:         config.Behavior.AutoImport,
+		FixDiagnostics:     config.Behavior.FixDiagnostics,
+		OpenFolds:          config.Behavior.OpenFolds,
+		MaxDiffTokens:      config.Provider.MaxDiffHistoryTokens,
+		MaxVisibleLines:    config.Behavior.MaxVisibleLines,
+		MaxCompletionLines: config.Behavior.MaxCompletionLines,
+		OversizedPolicy:    engine.OversizedPolicy(config.Behavior.OversizedCompletion),
+		PastePolicy:        engine.PastePolicy(config.Behavior.PasteCompletion),
+		PasteDelay:         time.Duration(config.Behavior.PasteDelay) * time.Millisecond,
+		StickyLines:        config.Behavior.StickyLines,
+		RootMarkers:        config.Behavior.RootMarkers,
+		CompleteInInsert:   config.Behavior.CompleteInInsert,
+		CompleteInNormal:   config.Behavior.CompleteInNormal,
 	}
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-
-	return &Daemon{
-		config:     config,
-		provider:   prov,
-		buffer:     buf,
-		engine:     eng,
-		socketPath: getSocketPath(config.StateDir),
-		pidPath:    getPidPath(config.StateDir),
-		shutdown:   make(chan bool, 1),
-		ctx:        ctx,
-		cancel:     cancel,
-	}, nil
+// contextBudgeter converts the context budget config to the engine's budgeter.
+func contextBudgeter(config ContextBudgetConfig) engine.ContextBudgeter {
+	weights := make(map[engine.ContextSource]float64, len(config.Weights))
+	for source, weight := range config.Weights {
+		weights[engine.ContextSource(source)] = weight
+	}
+	return engine.ContextBudgeter{MaxTokens: config.MaxTokens, Weights: weights}
 }
 
 func (d *Daemon) Start() error {
@@ -146,8 +375,26 @@ func (d *Daemon) Start() error {
 	logger.Info("daemon listening on socket: %s", d.socketPath)
 
 	// Start engine
+	d.progress = make(chan engine.Progress, 1)
+	d.engine.SetProgressListener(d.queueProgress)
+	go d.pushProgress()
+	d.events = make(chan engine.Notification, notificationQueueSize)
+	d.engine.SetNotificationListener(d.queueNotification)
+	go d.pushNotifications()
 	d.engine.Start(d.ctx)
 
+	// Keep hosted providers blocked until the workspace is trusted
+	d.applyTrust()
+
+	// Ping failover providers so the chain fails back once the primary recovers
+	if d.failover != nil {
+		go d.failover.RunHealthChecks(d.ctx)
+	}
+
+	// Watch config files and kill switch for runtime changes
+	d.startWatcher()
+	defer d.stopWatcher()
+
 	// Setup shutdown handling
 	d.setupShutdownHandling()
 
@@ -222,6 +469,16 @@ func (d *Daemon) handleConnection(conn net.Conn) {
 	// Set nvim client on the buffer and register event handler
 	d.buffer.SetClient(n)
 	d.engine.RegisterEventHandler()
+	d.registerTrustHandlers(n)
+	d.registerTuningHandler(n)
+	d.registerProviderHandler(n)
+	d.registerQualityHandler(n)
+	d.registerProgressHandler(n)
+	d.registerStatsHandler(n)
+	d.registerPreviewHandler(n)
+	d.registerDiffHandler(n)
+	d.registerBufferHandlers(n)
+	d.registerSessionHandler(n)
 
 	// Serve this connection until it closes or context is done
 	select {
@@ -234,6 +491,202 @@ func (d *Daemon) handleConnection(conn net.Conn) {
 	}
 }
 
+// registerTuningHandler exposes the staging tuning RPC, which previews the last
+// shown completion under alternative staging options. Both the options and the
+// resulting layouts are exchanged as JSON.
+func (d *Daemon) registerTuningHandler(n *nvim.Nvim) {
+	if err := n.RegisterHandler("cursortab_tune_staging", func(_ *nvim.Nvim, optionsJSON string) (string, error) {
+		var options []engine.TuningOption
+		if err := json.Unmarshal([]byte(optionsJSON), &options); err != nil {
+			return "", fmt.Errorf("invalid tuning options: %w", err)
+		}
+		layouts, err := d.engine.TuneStaging(options)
+		if err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(layouts)
+		return string(data), err
+	}); err != nil {
+		logger.Error("error registering tune staging handler: %v", err)
+	}
+}
+
+// registerProviderHandler exposes the name of the provider serving completions,
+// which changes when a failover chain switches backends.
+func (d *Daemon) registerProviderHandler(n *nvim.Nvim) {
+	if err := n.RegisterHandler("cursortab_active_provider", func(_ *nvim.Nvim) (string, error) {
+		return d.activeProvider(), nil
+	}); err != nil {
+		logger.Error("error registering active provider handler: %v", err)
+	}
+}
+
+func (d *Daemon) activeProvider() string {
+	if d.failover != nil {
+		return d.failover.ActiveName()
+	}
+	return d.config.Provider.Type
+}
+
+// registerProgressHandler exposes what the accept key will do, for statusline
+// components that poll instead of listening for progress notifications.
+func (d *Daemon) registerProgressHandler(n *nvim.Nvim) {
+	if err := n.RegisterHandler("cursortab_progress", func(_ *nvim.Nvim) (string, error) {
+		p := d.engine.Progress()
+		p.Provider = d.activeProvider()
+		data, err := json.Marshal(p)
+		return string(data), err
+	}); err != nil {
+		logger.Error("error registering progress handler: %v", err)
+	}
+}
+
+// queueProgress keeps only the latest progress for pushProgress. It is called
+// with the engine locked, so it never blocks.
+func (d *Daemon) queueProgress(p engine.Progress) {
+	for {
+		select {
+		case d.progress <- p:
+			return
+		default:
+		}
+		select {
+		case <-d.progress:
+		default:
+		}
+	}
+}
+
+// pushProgress sends queued progress to the editor in order.
+func (d *Daemon) pushProgress() {
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case p := <-d.progress:
+			p.Provider = d.activeProvider()
+			data, err := json.Marshal(p)
+			if err != nil {
+				continue
+			}
+			d.buffer.NotifyProgress(string(data))
+		}
+	}
+}
+
+// queueNotification queues n for pushNotifications. It is called with the
+// engine locked, so notifications are dropped while the queue is full.
+func (d *Daemon) queueNotification(n engine.Notification) {
+	select {
+	case d.events <- n:
+	default:
+		logger.Warn("notification queue full, dropping %s", n.Event)
+	}
+}
+
+// pushNotifications sends queued notifications to the editor in order.
+func (d *Daemon) pushNotifications() {
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case n := <-d.events:
+			data, err := json.Marshal(n)
+			if err != nil {
+				continue
+			}
+			d.buffer.NotifyEvent(string(data))
+		}
+	}
+}
+
+// registerQualityHandler exposes the quality log query RPC. The query and the
+// resulting report are exchanged as JSON.
+func (d *Daemon) registerQualityHandler(n *nvim.Nvim) {
+	if err := n.RegisterHandler("cursortab_quality", func(_ *nvim.Nvim, queryJSON string) (string, error) {
+		if d.qualityLog == nil {
+			return "", fmt.Errorf("quality log is disabled (set behavior.quality_log = true)")
+		}
+		var q quality.Query
+		if err := json.Unmarshal([]byte(queryJSON), &q); err != nil {
+			return "", fmt.Errorf("invalid quality query: %w", err)
+		}
+		report, err := d.qualityLog.Query(q)
+		if err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(report)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}); err != nil {
+		logger.Error("error registering quality handler: %v", err)
+	}
+}
+
+// registerStatsHandler exposes the completion statistics of this session as JSON.
+func (d *Daemon) registerStatsHandler(n *nvim.Nvim) {
+	if err := n.RegisterHandler("cursortab_stats", func(_ *nvim.Nvim) (string, error) {
+		data, err := json.Marshal(d.engine.Stats())
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}); err != nil {
+		logger.Error("error registering stats handler: %v", err)
+	}
+}
+
+// registerPreviewHandler exposes the pending stages of the shown completion as
+// JSON, for a panel listing all upcoming edits.
+func (d *Daemon) registerPreviewHandler(n *nvim.Nvim) {
+	if err := n.RegisterHandler("cursortab_preview", func(_ *nvim.Nvim) (string, error) {
+		data, err := json.Marshal(d.engine.Preview())
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}); err != nil {
+		logger.Error("error registering preview handler: %v", err)
+	}
+}
+
+// registerDiffHandler exposes the pending stages of the shown completion as a
+// unified diff, empty when no completion is shown.
+func (d *Daemon) registerDiffHandler(n *nvim.Nvim) {
+	if err := n.RegisterHandler("cursortab_diff", func(_ *nvim.Nvim) (string, error) {
+		return d.engine.PendingDiff(), nil
+	}); err != nil {
+		logger.Error("error registering diff handler: %v", err)
+	}
+}
+
+// registerBufferHandlers receives the changes to open buffers reported by the
+// editor's buffer manager.
+func (d *Daemon) registerBufferHandlers(n *nvim.Nvim) {
+	if err := n.RegisterHandler("cursortab_buffer_lines", func(_ *nvim.Nvim, path string, firstLine, lastLine int, lines []string, tick int, timeMs int64, paste bool) {
+		d.engine.UpdateBuffer(engine.BufferLines{Path: path, FirstLine: firstLine, LastLine: lastLine, Lines: lines, Tick: tick, TimeMs: timeMs, Paste: paste})
+	}); err != nil {
+		logger.Error("error registering buffer lines handler: %v", err)
+	}
+	if err := n.RegisterHandler("cursortab_buffer_closed", func(_ *nvim.Nvim, path string) {
+		d.engine.CloseBuffer(path)
+	}); err != nil {
+		logger.Error("error registering buffer closed handler: %v", err)
+	}
+}
+
+// registerSessionHandler lets the editor save the session before it exits,
+// since the daemon may outlive it for other clients.
+func (d *Daemon) registerSessionHandler(n *nvim.Nvim) {
+	if err := n.RegisterHandler("cursortab_save_session", func(_ *nvim.Nvim) error {
+		return d.engine.SaveSession()
+	}); err != nil {
+		logger.Error("error registering save session handler: %v", err)
+	}
+}
+
 func (d *Daemon) monitorIdleShutdown() {
 	// In debug mode, shut down immediately when no clients are connected
 	if d.config.Debug.ImmediateShutdown {
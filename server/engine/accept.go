@@ -1,6 +1,9 @@
 package engine
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"cursortab/logger"
 	"cursortab/metrics"
 	"cursortab/text"
@@ -20,6 +23,41 @@ func (e *Engine) reject() {
 	e.state = stateIdle
 }
 
+// rejectStage skips the shown or targeted stage of a staged completion and
+// moves on to the next one. Without further stages or files the whole
+// completion is rejected.
+func (e *Engine) rejectStage() {
+	// A jump to another file skips all of that file's stages
+	fileTarget := e.state == stateHasCursorTarget && e.multiFile != nil &&
+		e.multiFile.Current().Staged.SourcePath != e.buffer.Path()
+	if e.stagedCompletion == nil && !fileTarget {
+		if !e.skipTarget() {
+			e.reject()
+		}
+		return
+	}
+
+	e.buffer.ClearUI()
+	if e.awaitingOutcome() {
+		e.sendMetric(metrics.EventRejected)
+	}
+	e.clearState(ClearOptions{ClearCursorTarget: true})
+
+	if !fileTarget {
+		e.stagedCompletion.CurrentIdx++
+		if e.hasMoreStages() {
+			e.syncBuffer()
+			e.showOrNavigateToNextStage()
+			return
+		}
+	}
+
+	e.stagedCompletion = nil
+	if !e.navigateToNextFile() {
+		e.reject()
+	}
+}
+
 // acceptCompletion handles Tab key acceptance of completions.
 func (e *Engine) acceptCompletion() {
 	// Sync buffer first to detect file switches
@@ -34,14 +72,24 @@ func (e *Engine) acceptCompletion() {
 		return
 	}
 
-	// 1. Apply and commit
-	if err := e.applyBatch.Execute(); err != nil {
-		logger.Error("acceptCompletion: batch execution failed: %v", err)
-		e.clearAll()
+	// 1. Apply, verify and commit
+	apply := e.applyBatch.Execute
+	if e.inlineInsertion {
+		apply = e.insertInline
+	}
+	if err := apply(); err != nil {
+		e.recoverFailedApply(e.shownCompletion(), fmt.Errorf("batch execution failed: %w", err))
+		return
+	}
+	if err := e.buffer.VerifyPending(); err != nil {
+		e.recoverFailedApply(e.shownCompletion(), fmt.Errorf("buffer does not match the completion: %w", err))
 		return
 	}
 	e.buffer.CommitPending()
 	e.saveCurrentFileState()
+	e.recordRename()
+	e.recordImportSpan()
+	e.recordPlaceholders()
 
 	// Send accept metric
 	e.sendMetric(metrics.EventAccepted)
@@ -53,7 +101,7 @@ func (e *Engine) acceptCompletion() {
 	// Must try BEFORE advanceStagedCompletion which may clear the prefetch
 	isLastStage := e.stagedCompletion != nil &&
 		e.stagedCompletion.CurrentIdx == len(e.stagedCompletion.Stages)-1
-	if isLastStage && e.cursorTarget != nil && e.cursorTarget.ShouldRetrigger {
+	if isLastStage && !e.hasMoreFiles() && e.acceptedRename == nil && e.importSpan == nil && e.cursorTarget != nil && e.cursorTarget.ShouldRetrigger {
 		if e.prefetchState == prefetchReady && len(e.prefetchedCompletions) > 0 {
 			currentStage := e.getStage(e.stagedCompletion.CurrentIdx)
 			prefetch := e.prefetchedCompletions[0]
@@ -82,8 +130,21 @@ func (e *Engine) acceptCompletion() {
 		return
 	}
 
-	// 6. No more stages - handle cursor target
+	// 6. No more stages - move on to the next file of a multi-file completion
 	e.syncBuffer()
+	e.showPlaceholders()
+	e.stripInstruction()
+	if e.navigateToNextFile() {
+		return
+	}
+
+	// 7. Offer to rename the other occurrences of a renamed identifier, then
+	// the imports the completion is missing
+	if e.proposeRename() || e.proposeImports() {
+		return
+	}
+
+	// 8. No more files - handle cursor target
 	if e.cursorTarget != nil && e.cursorTarget.ShouldRetrigger {
 		// If prefetch is ready, use it
 		if e.prefetchState == prefetchReady && len(e.prefetchedCompletions) > 0 {
@@ -103,6 +164,117 @@ func (e *Engine) acceptCompletion() {
 	e.transitionAfterAccept()
 }
 
+// acceptInPlace applies the shown stage, or the stage a jump indicator points
+// to, without moving the cursor or scrolling, so the user keeps typing where
+// they are. Remaining stages, prefetching and jump indicators carry on as after
+// a regular accept.
+func (e *Engine) acceptInPlace() {
+	result, _ := e.buffer.Sync(e.WorkspacePath)
+	if result != nil && result.BufferChanged {
+		e.reject()
+		return
+	}
+
+	completion := e.inPlaceCompletion()
+	if completion == nil {
+		return
+	}
+
+	if err := e.buffer.ApplyInPlace(completion.StartLine, completion.EndLineInc, completion.Lines); err != nil {
+		e.recoverFailedApply(completion, fmt.Errorf("apply failed: %w", err))
+		return
+	}
+	if err := e.buffer.VerifyPending(); err != nil {
+		e.recoverFailedApply(completion, fmt.Errorf("buffer does not match the completion: %w", err))
+		return
+	}
+	e.buffer.CommitPending()
+	e.saveCurrentFileState()
+	e.recordRename()
+	e.recordImportSpan()
+	e.recordPlaceholders()
+	e.sendMetric(metrics.EventAccepted)
+	e.clearState(ClearOptions{})
+
+	if e.stagedCompletion != nil {
+		e.advanceStagedCompletion()
+	}
+	e.syncBuffer()
+	if e.hasMoreStages() {
+		e.prefetchAtNMinusOne()
+		e.showOrNavigateToNextStage()
+		return
+	}
+	e.showPlaceholders()
+	e.stripInstruction()
+	if e.proposeRename() || e.proposeImports() {
+		return
+	}
+	e.prefetchAtCursorTarget()
+	e.transitionAfterAccept()
+}
+
+// inPlaceCompletion returns what acceptInPlace applies: the completion on
+// screen, or the stage a jump indicator in this file points to. Cursor-only
+// targets have nothing to apply.
+func (e *Engine) inPlaceCompletion() *types.Completion {
+	if e.state == stateHasCompletion {
+		if len(e.completions) == 0 {
+			return nil
+		}
+		return e.completions[0]
+	}
+
+	if !e.hasMoreStages() || (e.cursorTarget != nil && e.cursorTarget.RelativePath != "" && e.cursorTarget.RelativePath != e.buffer.Path()) {
+		return nil
+	}
+	stage := e.getStage(e.stagedCompletion.CurrentIdx)
+	if stage == nil {
+		return nil
+	}
+	e.cursorTarget = stage.CursorTarget
+	return &types.Completion{StartLine: stage.BufferStart, EndLineInc: stage.BufferEnd, Lines: stage.Lines}
+}
+
+// recoverFailedApply rolls the buffer back to its content before comp was
+// applied, clears all state and reports an ApplyFailure to the editor. The
+// trace ID shown to the user is logged with the cause.
+func (e *Engine) recoverFailedApply(comp *types.Completion, cause error) {
+	failure := ApplyFailure{TraceID: e.currentMetrics.ID, Reason: cause.Error(), FilePath: e.buffer.Path(), RolledBack: true}
+	if failure.TraceID == "" {
+		failure.TraceID = fmt.Sprintf("apply-%x", e.clock.Now().UnixNano())
+	}
+	if comp != nil {
+		failure.StartLine, failure.EndLine = comp.StartLine, comp.EndLineInc
+	}
+	if sc := e.stagedCompletion; sc != nil && sc.CurrentIdx < len(sc.Stages) {
+		failure.Stage, failure.Stages = sc.CurrentIdx+1, len(sc.Stages)
+	}
+
+	logger.Error("apply %s: %v", failure.TraceID, cause)
+	if err := e.buffer.Rollback(); err != nil {
+		logger.Error("apply %s: rollback failed: %v", failure.TraceID, err)
+		failure.RolledBack = false
+	}
+	e.clearAll()
+	e.state = stateIdle
+
+	data, err := json.Marshal(failure)
+	if err != nil {
+		logger.Error("apply %s: encoding failure: %v", failure.TraceID, err)
+		return
+	}
+	e.buffer.NotifyApplyFailed(string(data))
+}
+
+// shownCompletion returns the completion on screen, or nil.
+func (e *Engine) shownCompletion() *types.Completion {
+	if len(e.completions) == 0 {
+		return nil
+	}
+	return e.completions[0]
+}
+
 // acceptCursorTarget handles Tab key from HasCursorTarget state.
 // Moves cursor to target and shows next stage or handles prefetch.
 func (e *Engine) acceptCursorTarget() {
@@ -110,11 +282,26 @@ func (e *Engine) acceptCursorTarget() {
 		return
 	}
 
-	// 1. Move cursor to target line
+	// Targets in another file belong to a multi-file completion, or were
+	// predicted by the provider on their own
+	if e.isOtherFile(e.cursorTarget) {
+		if e.multiFile != nil {
+			e.acceptFileTarget()
+		} else {
+			e.acceptCrossFileTarget()
+		}
+		return
+	}
+
+	// 1. Move cursor to target line, where the change on it begins
 	targetLine := int(e.cursorTarget.LineNumber)
-	if err := e.buffer.MoveCursor(targetLine, true, true); err != nil {
+	if err := e.buffer.MoveCursor(targetLine, e.targetColumn(targetLine), true, true); err != nil {
 		logger.Error("acceptCursorTarget: move cursor failed: %v", err)
 	}
+	e.openFold(targetLine)
+	if e.currentMetrics.CursorOnly {
+		e.sendMetric(metrics.EventAccepted)
+	}
 
 	// 2. If more staged completions, show current stage
 	if e.hasMoreStages() {
@@ -125,6 +312,9 @@ func (e *Engine) acceptCursorTarget() {
 
 	// 3. No staged completions - handle prefetch/retrigger logic
 	e.syncBuffer()
+	if e.showTargetCompletion() {
+		return
+	}
 
 	// 3a. Try to use prefetched completion
 	if e.prefetchState == prefetchReady && len(e.prefetchedCompletions) > 0 {
@@ -140,18 +330,68 @@ func (e *Engine) acceptCursorTarget() {
 	}
 
 	// 3c. If should retrigger, request new completion
-	if e.cursorTarget.ShouldRetrigger {
-		e.requestCompletion(types.CompletionSourceTyping)
+	if e.cursorTarget.ShouldRetrigger && e.retriggerCompletion() {
 		e.cursorTarget = nil
 		return
 	}
 
-	// 3d. Otherwise, clear and go idle
-	e.buffer.ClearUI()
+	// 3d. Otherwise, move on to the next predicted location or go idle
 	e.cursorTarget = nil
+	if e.showNextTarget() {
+		return
+	}
+	e.buffer.ClearUI()
 	e.state = stateIdle
 }
 
+// targetColumn returns the byte column of line where the edit about to be
+// shown there begins: the next stage, or else the completion prefetched for
+// the target. Returns -1 when that is unknown, or the edit does not begin on
+// line.
+func (e *Engine) targetColumn(line int) int {
+	lines := e.buffer.Lines()
+	if e.hasMoreStages() {
+		stage := e.getStage(e.stagedCompletion.CurrentIdx)
+		if stage == nil || replacedLineCount(stage) == 0 {
+			return -1
+		}
+		return changeColumn(&types.Completion{StartLine: stage.BufferStart, EndLineInc: stage.BufferEnd, Lines: stage.Lines}, lines, line)
+	}
+
+	var comps []*types.Completion
+	var regions []regionHash
+	if len(e.targetQueue) > 0 && e.targetQueue[0].target == e.cursorTarget && e.targetQueue[0].completion != nil {
+		comps, regions = []*types.Completion{e.targetQueue[0].completion}, []regionHash{e.targetQueue[0].region}
+	} else if e.prefetchState == prefetchReady && len(e.prefetchedCompletions) > 0 {
+		comps, regions = e.prefetchedCompletions[:1], e.prefetchRegions[:min(len(e.prefetchRegions), 1)]
+	}
+	if len(comps) == 0 {
+		return -1
+	}
+	comps, _, ok := rebaseCompletions(comps, regions, lines)
+	if !ok {
+		return -1
+	}
+	return changeColumn(comps[0], lines, line)
+}
+
+// changeColumn returns the byte column of line where comp first changes
+// lines, or -1 when its first change is on another line or adds a line.
+func changeColumn(comp *types.Completion, lines []string, line int) int {
+	var oldLines []string
+	for i := comp.StartLine; i <= comp.EndLineInc && i-1 < len(lines); i++ {
+		oldLines = append(oldLines, lines[i-1])
+	}
+	if text.FindFirstChangedLine(oldLines, comp.Lines, comp.StartLine-1) != line {
+		return -1
+	}
+	i := line - comp.StartLine
+	if i >= len(oldLines) || i >= len(comp.Lines) {
+		return -1
+	}
+	return text.FirstChangedColumn(oldLines[i], comp.Lines[i])
+}
+
 // advanceStagedCompletion advances to the next stage and applies line offset
 // to remaining stages when line counts change.
 func (e *Engine) advanceStagedCompletion() {
@@ -162,25 +402,8 @@ func (e *Engine) advanceStagedCompletion() {
 	// Calculate cumulative offset from current stage
 	currentStage := e.getStage(e.stagedCompletion.CurrentIdx)
 	if currentStage != nil {
-		// For pure addition stages (all groups are "addition" type), we're inserting
-		// new lines, not replacing existing ones. So oldLineCount should be 0.
-		// For other stages, oldLineCount is the range being replaced.
-		isPureAddition := len(currentStage.Groups) > 0
-		for _, g := range currentStage.Groups {
-			if g.Type != "addition" {
-				isPureAddition = false
-				break
-			}
-		}
-
-		var oldLineCount int
-		if isPureAddition {
-			oldLineCount = 0 // Pure additions insert, they don't replace
-		} else {
-			oldLineCount = currentStage.BufferEnd - currentStage.BufferStart + 1
-		}
 		newLineCount := len(currentStage.Lines)
-		e.stagedCompletion.CumulativeOffset += newLineCount - oldLineCount
+		e.stagedCompletion.CumulativeOffset += newLineCount - replacedLineCount(currentStage)
 	}
 
 	// Advance to next stage
@@ -223,6 +446,22 @@ func (e *Engine) advanceStagedCompletion() {
 		}
 		e.stagedCompletion.CumulativeOffset = 0
 	}
+	e.notifyStage(NotifyStageAdvanced)
+}
+
+// replacedLineCount returns the number of buffer lines stage replaces. Pure
+// addition stages (all groups are "addition" type) insert their lines before
+// BufferStart instead of replacing the range.
+func replacedLineCount(stage *text.Stage) int {
+	for _, g := range stage.Groups {
+		if g.Type != "addition" {
+			return stage.BufferEnd - stage.BufferStart + 1
+		}
+	}
+	if len(stage.Groups) == 0 {
+		return stage.BufferEnd - stage.BufferStart + 1
+	}
+	return 0
 }
 
 // hasMoreStages returns true if there are more stages to process.
@@ -263,11 +502,16 @@ func (e *Engine) showOrNavigateToNextStage() {
 		ShouldRetrigger: false,
 	}
 	e.state = stateHasCursorTarget
-	e.buffer.ShowCursorTarget(nextStage.BufferStart)
+	e.showCursorTarget(nextStage.BufferStart)
 }
 
 // transitionAfterAccept handles state transition after accept based on cursor target.
 func (e *Engine) transitionAfterAccept() {
+	// Without a cursor target, move on to the next predicted location
+	if e.cursorTarget == nil && e.showNextTarget() {
+		return
+	}
+
 	// If no cursor target or prediction disabled, go idle
 	if e.cursorTarget == nil || !e.config.CursorPrediction.Enabled {
 		e.buffer.ClearUI()
@@ -275,23 +519,28 @@ func (e *Engine) transitionAfterAccept() {
 		return
 	}
 
-	// Never show cursor target within proximity threshold
+	// Never show cursor target within proximity threshold, but move on to
+	// the next predicted location if there is one
 	cursorRow := e.buffer.Row()
 	targetLine := int(e.cursorTarget.LineNumber)
 	distance := utils.Abs(targetLine - cursorRow)
 	if distance <= e.config.CursorPrediction.ProximityThreshold {
-		e.buffer.ClearUI()
 		e.cursorTarget = nil
+		if e.showNextTarget() {
+			return
+		}
+		e.buffer.ClearUI()
 		e.state = stateIdle
 		return
 	}
 
 	// Show cursor target indicator
-	e.buffer.ShowCursorTarget(targetLine)
+	e.showCursorTarget(targetLine)
 	e.state = stateHasCursorTarget
 }
 
-// partialAcceptCompletion handles Ctrl+Right partial acceptance.
+// partialAcceptCompletion accepts the next word of the suggestion, or the
+// next line where words don't apply.
 func (e *Engine) partialAcceptCompletion() {
 	if len(e.completions) == 0 {
 		return
@@ -306,14 +555,64 @@ func (e *Engine) partialAcceptCompletion() {
 	}
 
 	firstGroup := groups[0]
+	e.currentMetrics.PartiallyAccepted = true
 
-	if firstGroup.RenderHint == "append_chars" {
+	switch {
+	case firstGroup.RenderHint == "append_chars":
 		e.partialAcceptAppendChars(firstGroup)
-	} else {
+	case acceptsByWord(firstGroup) && firstGroup.BufferLine == e.completions[0].StartLine:
+		e.partialAcceptWord()
+	default:
 		e.partialAcceptNextLine()
 	}
 }
 
+// partialAcceptLine accepts the rest of the first suggested line.
+func (e *Engine) partialAcceptLine() {
+	if len(e.completions) == 0 || len(e.currentGroups) == 0 {
+		return
+	}
+	e.currentMetrics.PartiallyAccepted = true
+	e.partialAcceptNextLine()
+}
+
+// acceptsByWord reports whether partial accept of group goes word by word
+// within its first line: replaced characters and modified lines do.
+func acceptsByWord(group *text.Group) bool {
+	return group.RenderHint == "replace_chars" || (group.Type == "modification" && group.RenderHint == "")
+}
+
+// partialAcceptWord accepts the next word of the first completion line in
+// place of the buffer line, moving to the next line once it matches.
+func (e *Engine) partialAcceptWord() {
+	if len(e.completions) == 0 || len(e.completions[0].Lines) == 0 {
+		return
+	}
+
+	e.syncBuffer()
+	bufferLines := e.buffer.Lines()
+	completion := e.completions[0]
+	lineIdx := completion.StartLine - 1
+
+	if lineIdx < 0 || lineIdx >= len(bufferLines) {
+		logger.Error("partialAcceptWord: buffer line out of range: %d", completion.StartLine)
+		return
+	}
+
+	targetLine := completion.Lines[0]
+	newLine := text.AcceptNextSpan(bufferLines[lineIdx], targetLine)
+	if err := e.buffer.ReplaceLine(completion.StartLine, newLine); err != nil {
+		logger.Error("partialAcceptWord: replace line failed: %v", err)
+		return
+	}
+
+	if newLine == targetLine {
+		e.advanceToNextLineOrFinalize()
+	} else {
+		e.rerenderPartial()
+	}
+}
+
 // partialAcceptAppendChars accepts word-by-word for append_chars hint.
 func (e *Engine) partialAcceptAppendChars(group *text.Group) {
 	if group == nil || len(e.completions) == 0 || len(e.completions[0].Lines) == 0 {
@@ -431,6 +730,9 @@ func (e *Engine) finalizePartialAccept() {
 
 	e.buffer.CommitPending()
 	e.saveCurrentFileState()
+	e.recordRename()
+	e.currentMetrics.PartiallyAccepted = false
+	e.sendMetric(metrics.EventAccepted)
 	e.clearState(ClearOptions{})
 
 	if e.stagedCompletion != nil {
@@ -445,6 +747,9 @@ func (e *Engine) finalizePartialAccept() {
 	}
 
 	e.syncBuffer()
+	if e.proposeRename() {
+		return
+	}
 	if e.cursorTarget != nil && e.cursorTarget.ShouldRetrigger {
 		if e.prefetchState == prefetchReady && len(e.prefetchedCompletions) > 0 {
 			if e.tryShowPrefetchedCompletion() {
@@ -1,6 +1,9 @@
 package engine
 
 import (
+	"errors"
+	"fmt"
+
 	"cursortab/assert"
 	"cursortab/text"
 	"cursortab/types"
@@ -25,6 +28,101 @@ func TestReject(t *testing.T) {
 	assert.Greater(t, buf.clearUICalls, 0, "ClearUI should have been called")
 }
 
+func TestRejectStage_SkipsToNextStage(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = make([]string, 30)
+	for i := range buf.lines {
+		buf.lines[i] = "line"
+	}
+	buf.row = 2
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	stage1 := &text.Stage{BufferStart: 2, BufferEnd: 2, Lines: []string{"new 2", "extra"},
+		Groups: []*text.Group{{Type: "modification", BufferLine: 2}}}
+	stage2 := &text.Stage{BufferStart: 20, BufferEnd: 20, Lines: []string{"new 20"},
+		Groups: []*text.Group{{Type: "modification", BufferLine: 20}}}
+	eng.stagedCompletion = &text.StagedCompletion{Stages: []*text.Stage{stage1, stage2}}
+	eng.completions = []*types.Completion{{StartLine: 2, EndLineInc: 2, Lines: stage1.Lines}}
+	eng.currentMetrics.ShownAt = eng.clock.Now()
+	eng.state = stateHasCompletion
+
+	eng.handleEvent(Event{Type: EventRejectStage})
+
+	assert.Equal(t, "line", buf.lines[1], "stage not applied")
+	assert.Equal(t, 1, eng.Stats().Rejected, "stage counted as rejected")
+	assert.Equal(t, stateHasCursorTarget, eng.state, "jump to the next stage")
+	assert.Equal(t, 20, buf.showCursorTargetLine, "next stage not shifted")
+	assert.Equal(t, 1, eng.stagedCompletion.CurrentIdx, "next stage is current")
+}
+
+func TestRejectStage_LastStageRejectsCompletion(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b"}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	stage := &text.Stage{BufferStart: 1, BufferEnd: 1, Lines: []string{"A"}}
+	eng.stagedCompletion = &text.StagedCompletion{Stages: []*text.Stage{stage}}
+	eng.completions = []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"A"}}}
+	eng.state = stateHasCompletion
+
+	eng.handleEvent(Event{Type: EventRejectStage})
+
+	assert.Equal(t, stateIdle, eng.state, "idle")
+	assert.Nil(t, eng.stagedCompletion, "staged completion dropped")
+	assert.Equal(t, "a", buf.lines[0], "nothing applied")
+}
+
+func TestAcceptCompletion_MismatchRollsBack(t *testing.T) {
+	buf := newMockBuffer()
+	buf.verifyErr = errors.New("buffer has 1 lines, expected 2")
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	eng.state = stateHasCompletion
+	eng.completions = []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"a", "b"}}}
+	eng.applyBatch = &mockBatch{}
+	eng.currentMetrics.ID = "cmpl-1"
+	eng.currentMetrics.ShownAt = eng.clock.Now()
+
+	eng.acceptCompletion()
+
+	assert.Equal(t, 1, buf.rollbackCalls, "rolled back")
+	assert.Equal(t, 0, buf.commitPendingCalls, "not committed")
+	assert.Equal(t, "cmpl-1", buf.applyFailure.TraceID, "user told with trace ID")
+	assert.Equal(t, "buffer does not match the completion: buffer has 1 lines, expected 2", buf.applyFailure.Reason, "reason")
+	assert.Equal(t, 1, buf.applyFailure.StartLine, "start line")
+	assert.Equal(t, 1, buf.applyFailure.EndLine, "end line")
+	assert.True(t, buf.applyFailure.RolledBack, "rolled back")
+	assert.Equal(t, stateIdle, eng.state, "idle")
+	assert.Equal(t, 1, eng.Stats().Rejected, "counted as rejected")
+}
+
+func TestAcceptCompletion_FailedStageReported(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b", "c", "d"}
+	buf.path = "main.go"
+	buf.rollbackErr = errors.New("buffer is not modifiable")
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	stage1 := &text.Stage{BufferStart: 2, BufferEnd: 2, Lines: []string{"B"}}
+	stage2 := &text.Stage{BufferStart: 4, BufferEnd: 4, Lines: []string{"D"}}
+	eng.stagedCompletion = &text.StagedCompletion{Stages: []*text.Stage{stage1, stage2}}
+	eng.showCurrentStage()
+	eng.applyBatch = &mockBatch{err: errors.New("E21: Cannot make changes, 'modifiable' is off")}
+
+	eng.acceptCompletion()
+
+	failure := buf.applyFailure
+	assert.NotNil(t, failure, "failure reported")
+	assert.Equal(t, "main.go", failure.FilePath, "file")
+	assert.Equal(t, 2, failure.StartLine, "start line")
+	assert.Equal(t, 1, failure.Stage, "stage")
+	assert.Equal(t, 2, failure.Stages, "stages")
+	assert.False(t, failure.RolledBack, "rollback failed too")
+	assert.Equal(t, 0, buf.commitPendingCalls, "not committed")
+	assert.Nil(t, eng.stagedCompletion, "staged completion dropped")
+	assert.Equal(t, stateIdle, eng.state, "idle")
+}
+
 func TestClearState_Options(t *testing.T) {
 	buf := newMockBuffer()
 	prov := newMockProvider()
@@ -72,7 +170,7 @@ func TestPartialAccept_AppendChars_SingleWord(t *testing.T) {
 		Lines:      []string{"function foo()"},
 	}}
 
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	assert.Equal(t, "tion ", buf.lastInsertedText, "inserted text")
 	assert.Equal(t, stateHasCompletion, eng.state, "state after partial accept")
@@ -102,7 +200,7 @@ func TestPartialAccept_AppendChars_Punctuation(t *testing.T) {
 		Lines:      []string{"foo.bar.baz"},
 	}}
 
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	assert.Equal(t, ".", buf.lastInsertedText, "inserted text at punctuation")
 	assert.Equal(t, stateHasCompletion, eng.state, "state after partial accept")
@@ -132,7 +230,7 @@ func TestPartialAccept_AppendChars_NoRemaining(t *testing.T) {
 		Lines:      []string{"hello!"},
 	}}
 
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	assert.Equal(t, "!", buf.lastInsertedText, "inserted text")
 	assert.Equal(t, stateIdle, eng.state, "state when nothing remaining")
@@ -159,7 +257,7 @@ func TestPartialAccept_MultiLine_FirstLine(t *testing.T) {
 		Lines:      []string{"new line 1", "new line 2", "new line 3"},
 	}}
 
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	assert.Equal(t, 1, buf.lastReplacedLine, "replaced line number")
 	assert.Equal(t, "new line 1", buf.lastReplacedContent, "replaced content")
@@ -169,6 +267,52 @@ func TestPartialAccept_MultiLine_FirstLine(t *testing.T) {
 	assert.Equal(t, 3, eng.completions[0].EndLineInc, "end line unchanged for equal line count")
 }
 
+func TestPartialAccept_Modification_ByWord(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"foo(a, b)", "next"}
+	buf.row = 1
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	eng.state = stateHasCompletion
+	eng.completions = []*types.Completion{{StartLine: 1, EndLineInc: 2, Lines: []string{"foo(x, y)", "next line"}}}
+	eng.currentGroups = []*text.Group{{Type: "modification", BufferLine: 1, Lines: []string{"foo(x, y)"}}}
+
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
+
+	assert.Equal(t, "foo(x, b)", buf.lines[0], "first edit accepted")
+	assert.Equal(t, 1, eng.completions[0].StartLine, "still on the first line")
+	assert.Equal(t, stateHasCompletion, eng.state, "completion still shown")
+
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
+
+	assert.Equal(t, "foo(x, y)", buf.lines[0], "line completed")
+	assert.Equal(t, 2, eng.completions[0].StartLine, "moved to the next line")
+}
+
+func TestPartialAcceptLine_AfterWord(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"foo(a, b)", "next"}
+	buf.row = 1
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	eng.state = stateHasCompletion
+	eng.completions = []*types.Completion{{StartLine: 1, EndLineInc: 2, Lines: []string{"foo(x, y)", "next line"}}}
+	eng.currentGroups = []*text.Group{{Type: "modification", BufferLine: 1, Lines: []string{"foo(x, y)"}}}
+
+	eng.handleEvent(Event{Type: EventPartialAcceptWord})
+	assert.Equal(t, "foo(x, b)", buf.lines[0], "first edit accepted")
+
+	eng.handleEvent(Event{Type: EventPartialAcceptLine})
+	assert.Equal(t, "foo(x, y)", buf.lines[0], "rest of the line accepted")
+	assert.Equal(t, 2, eng.completions[0].StartLine, "moved to the next line")
+	assert.Equal(t, []string{"next line"}, eng.completions[0].Lines, "remaining suggestion")
+	assert.Equal(t, stateHasCompletion, eng.state, "completion still shown")
+
+	eng.handleEvent(Event{Type: EventPartialAcceptLine})
+	assert.Equal(t, "next line", buf.lines[1], "last line accepted")
+	assert.Equal(t, stateIdle, eng.state, "completion finished")
+}
+
 func TestPartialAccept_MultiLine_LastLine(t *testing.T) {
 	buf := newMockBuffer()
 	buf.lines = []string{"old line"}
@@ -190,7 +334,7 @@ func TestPartialAccept_MultiLine_LastLine(t *testing.T) {
 		Lines:      []string{"new line"},
 	}}
 
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	assert.Equal(t, "new line", buf.lastReplacedContent, "replaced content")
 	assert.Equal(t, stateIdle, eng.state, "state after accepting last line")
@@ -220,7 +364,7 @@ func TestPartialAccept_WithUserTyping(t *testing.T) {
 		Lines:      []string{"function foo()"},
 	}}
 
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	assert.Equal(t, "on ", buf.lastInsertedText, "inserted text after user typing")
 }
@@ -234,7 +378,7 @@ func TestPartialAccept_NoCompletions(t *testing.T) {
 	eng.state = stateHasCompletion
 	eng.completions = nil
 
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	assert.Equal(t, stateHasCompletion, eng.state, "state unchanged when no completions")
 }
@@ -253,7 +397,7 @@ func TestPartialAccept_NoGroups(t *testing.T) {
 	}}
 	eng.currentGroups = nil
 
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	assert.Equal(t, stateHasCompletion, eng.state, "state unchanged when no groups")
 }
@@ -281,7 +425,7 @@ func TestPartialAccept_AdditionGroup(t *testing.T) {
 		Lines:      []string{"    fmt.Println(\"hello\")"},
 	}}
 
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	assert.Equal(t, 1, buf.lastReplacedLine, "replaced line number")
 	assert.Equal(t, "func main() {", buf.lastReplacedContent, "replaced content")
@@ -337,7 +481,7 @@ func TestPartialAccept_AppendCharsWithAddition(t *testing.T) {
 
 	// When append_chars line is already complete, partial accept should
 	// transition to the next line (the addition), NOT finalize the stage
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	// After partial accept, the completion should now point to the addition line
 	assert.Equal(t, stateHasCompletion, eng.state, "should still be in HasCompletion")
@@ -424,7 +568,7 @@ func TestPartialAccept_StagedCompletion_UsesCurrentGroups(t *testing.T) {
 
 	// This is the key: partial accept should use currentGroups (addition),
 	// NOT the staged completion's groups (which have stale append_chars first)
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	// Verify the addition line was inserted
 	assert.Equal(t, 4, len(buf.lines), "buffer should have 4 lines after insert")
@@ -459,7 +603,7 @@ func TestPartialAccept_FinishSyncsBuffer_NonStaged(t *testing.T) {
 
 	initialSyncCalls := buf.syncCalls
 
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	assert.True(t, buf.syncCalls > initialSyncCalls, "buffer should be synced after finish")
 	assert.Equal(t, stateIdle, eng.state, "should be idle after finish")
@@ -536,20 +680,20 @@ func TestPartialAccept_MultiLineCompletion_CursorTargetConsistency(t *testing.T)
 		}
 		eng.stagedCompletion = nil
 
-		eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+		eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 		assert.Equal(t, stateHasCompletion, eng.state, "should stay in HasCompletion after partial accept")
 		assert.Equal(t, 3, len(eng.completions[0].Lines), "remaining lines")
 		assert.Equal(t, 2, eng.completions[0].StartLine, "start line increments")
 
-		eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+		eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 		assert.Equal(t, 2, len(eng.completions[0].Lines), "remaining lines")
 		assert.Equal(t, 3, eng.completions[0].StartLine, "start line increments")
 
-		eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+		eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 		assert.Equal(t, 1, len(eng.completions[0].Lines), "remaining lines")
 		assert.Equal(t, 4, eng.completions[0].StartLine, "start line increments")
 
-		eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+		eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 		assert.Equal(t, int(expectedCursorTarget), buf.showCursorTargetLine, "cursor target should be preserved through partial accepts")
 	})
@@ -585,13 +729,13 @@ func TestPartialAccept_MultiLineCompletion_CursorTargetConsistency(t *testing.T)
 		eng.stagedCompletion = nil
 
 		for i := 0; i < 3; i++ {
-			eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+			eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 			if i < 2 {
 				assert.Equal(t, cursorTarget, eng.cursorTarget.LineNumber, "cursor target should be unchanged")
 			}
 		}
 
-		eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+		eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 		assert.Equal(t, int(cursorTarget), buf.showCursorTargetLine, "final cursor target should be original value")
 	})
@@ -648,8 +792,137 @@ func TestPartialAccept_MultiLineCompletion_CursorTargetConsistency(t *testing.T)
 		eng.applyBatch = &mockBatch{}
 		eng.cursorTarget = stage1.CursorTarget
 
-		eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+		eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 		assert.Equal(t, int32(3), eng.cursorTarget.LineNumber, "cursor target should be preserved from stage 1")
 	})
 }
+
+func TestAcceptInPlace_KeepsCursorAndShowsNextTarget(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = make([]string, 30)
+	for i := range buf.lines {
+		buf.lines[i] = "line"
+	}
+	buf.row = 25
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	stage1 := &text.Stage{BufferStart: 2, BufferEnd: 2, Lines: []string{"new 2", "extra"},
+		Groups: []*text.Group{{Type: "modification", BufferLine: 2}}}
+	stage2 := &text.Stage{BufferStart: 10, BufferEnd: 10, Lines: []string{"new 10"},
+		Groups: []*text.Group{{Type: "modification", BufferLine: 10}}}
+	eng.stagedCompletion = &text.StagedCompletion{Stages: []*text.Stage{stage1, stage2}}
+	eng.cursorTarget = &types.CursorPredictionTarget{LineNumber: 2}
+	eng.state = stateHasCursorTarget
+
+	eng.handleEvent(Event{Type: EventAcceptInPlace})
+
+	assert.Equal(t, 1, buf.applyInPlaceCalls, "stage applied in place")
+	assert.Equal(t, "new 2", buf.lines[1], "stage content")
+	assert.Equal(t, "extra", buf.lines[2], "added line")
+	assert.Equal(t, 26, buf.row, "cursor follows its text")
+	assert.Equal(t, 1, buf.commitPendingCalls, "diff history updated")
+	assert.Equal(t, stateHasCursorTarget, eng.state, "next stage is far away")
+	assert.Equal(t, 11, buf.showCursorTargetLine, "next stage shifted by the added line")
+}
+
+func TestAcceptInPlace_ShownCompletion(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b", "c"}
+	buf.row = 3
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.completions = []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"A"}}}
+	eng.state = stateHasCompletion
+
+	eng.handleEvent(Event{Type: EventAcceptInPlace})
+
+	assert.Equal(t, "A", buf.lines[0], "completion applied")
+	assert.Equal(t, 3, buf.row, "cursor unchanged")
+	assert.Equal(t, stateIdle, eng.state, "nothing left to show")
+}
+
+func TestAcceptInPlace_CursorOnlyTargetIsNoop(t *testing.T) {
+	buf := newMockBuffer()
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.cursorTarget = &types.CursorPredictionTarget{LineNumber: 3}
+	eng.state = stateHasCursorTarget
+
+	eng.handleEvent(Event{Type: EventAcceptInPlace})
+
+	assert.Equal(t, 0, buf.applyInPlaceCalls, "nothing applied")
+	assert.Equal(t, stateHasCursorTarget, eng.state, "target kept")
+}
+
+func TestAcceptCursorTarget_LandsOnChangeColumn(t *testing.T) {
+	newEngine := func() (*Engine, *mockBuffer) {
+		buf := newMockBuffer()
+		buf.lines = make([]string, 30)
+		for i := range buf.lines {
+			buf.lines[i] = fmt.Sprintf("\tline %d", i+1)
+		}
+		buf.row = 1
+		return createTestEngine(buf, newMockProvider(), newMockClock()), buf
+	}
+
+	t.Run("next stage", func(t *testing.T) {
+		eng, buf := newEngine()
+		stage := &text.Stage{BufferStart: 20, BufferEnd: 20, Lines: []string{"\tline 20 // done"},
+			Groups: []*text.Group{{Type: "modification", BufferLine: 20}}}
+		eng.stagedCompletion = &text.StagedCompletion{Stages: []*text.Stage{stage}}
+		eng.cursorTarget = &types.CursorPredictionTarget{LineNumber: 20}
+		eng.state = stateHasCursorTarget
+
+		eng.acceptCursorTarget()
+
+		assert.Equal(t, 20, buf.row, "row")
+		assert.Equal(t, 8, buf.col, "column where the stage begins")
+	})
+
+	t.Run("prefetched completion", func(t *testing.T) {
+		eng, buf := newEngine()
+		eng.setPrefetched(&types.CompletionResponse{Completions: []*types.Completion{
+			{StartLine: 19, EndLineInc: 20, Lines: []string{"\tline 19", "\tline two"}},
+		}}, buf.lines)
+		eng.prefetchState = prefetchReady
+		eng.cursorTarget = &types.CursorPredictionTarget{LineNumber: 20}
+		eng.state = stateHasCursorTarget
+
+		eng.acceptCursorTarget()
+
+		assert.Equal(t, 20, buf.row, "row")
+		assert.Equal(t, 6, buf.col, "column where the completion begins")
+	})
+
+	t.Run("unknown edit", func(t *testing.T) {
+		eng, buf := newEngine()
+		buf.col = 4
+		eng.cursorTarget = &types.CursorPredictionTarget{LineNumber: 20}
+		eng.state = stateHasCursorTarget
+
+		eng.acceptCursorTarget()
+
+		assert.Equal(t, 20, buf.row, "row")
+		assert.Equal(t, 0, buf.col, "start of line")
+	})
+}
+
+func TestChangeColumn(t *testing.T) {
+	lines := []string{"a := 1", "b := 2", "c := 3"}
+	tests := []struct {
+		name string
+		comp *types.Completion
+		line int
+		want int
+	}{
+		{"change on the line", &types.Completion{StartLine: 2, EndLineInc: 2, Lines: []string{"b := 20"}}, 2, 6},
+		{"first change on another line", &types.Completion{StartLine: 1, EndLineInc: 2, Lines: []string{"a = 1", "b = 2"}}, 2, -1},
+		{"added line", &types.Completion{StartLine: 3, EndLineInc: 3, Lines: []string{"c := 3", "d := 4"}}, 4, -1},
+		{"no change", &types.Completion{StartLine: 2, EndLineInc: 2, Lines: []string{"b := 2"}}, 2, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, changeColumn(tt.comp, lines, tt.line), "column")
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cursortab/types"
+)
+
+// recordEditAction records the user action a change to the current buffer
+// was, as reported by nvim_buf_attach. old is the content the change was
+// made to. The action sits where the edited text starts, and is stamped with
+// the time the editor reported for the change. Returns the type of the action
+// recorded, empty when the change edited nothing.
+func (e *Engine) recordEditAction(change BufferLines, old []string) types.UserActionType {
+	if change.FirstLine < 0 || change.LastLine > len(old) || change.FirstLine > change.LastLine {
+		return ""
+	}
+	prefix, deleted, inserted := editedText(old[change.FirstLine:change.LastLine], change.Lines)
+	actionType := classifyEdit(deleted, inserted)
+	if actionType == "" {
+		return ""
+	}
+
+	at := e.clock.Now()
+	if change.TimeMs > 0 {
+		at = time.UnixMilli(change.TimeMs)
+	}
+	e.recordUserAction(&types.UserAction{
+		ActionType:  actionType,
+		FilePath:    change.Path,
+		LineNumber:  change.FirstLine + 1 + strings.Count(prefix, "\n"),
+		Offset:      calculateOffset(old, change.FirstLine+1, 0) + len(prefix),
+		TimestampMs: at.UnixMilli(),
+	})
+	return actionType
+}
+
+// editedText returns the text a change replacing the lines old with the lines
+// new deleted and inserted, and the unchanged text before them. Every line
+// counts with its newline, so that whole lines added or removed show as text.
+func editedText(old, new []string) (prefix, deleted, inserted string) {
+	before := joinLines(old)
+	after := joinLines(new)
+
+	start := 0
+	for start < len(before) && start < len(after) && before[start] == after[start] {
+		start++
+	}
+	// Keep multi-byte characters whole
+	for start > 0 && start < len(after) && !utf8.RuneStart(after[start]) {
+		start--
+	}
+	end := 0
+	for end < len(before)-start && end < len(after)-start &&
+		before[len(before)-1-end] == after[len(after)-1-end] {
+		end++
+	}
+	for end > 0 && !utf8.RuneStart(before[len(before)-end]) {
+		end--
+	}
+	return before[:start], before[start : len(before)-end], after[start : len(after)-end]
+}
+
+// joinLines returns lines as text, each with its newline.
+func joinLines(lines []string) string {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// classifyEdit names the action that deleted and inserted the given text.
+// Several characters inserted at once come from a paste, a completion menu
+// or a snippet rather than from typing.
+func classifyEdit(deleted, inserted string) types.UserActionType {
+	insertedChars := utf8.RuneCountInString(inserted)
+	deletedChars := utf8.RuneCountInString(deleted)
+
+	switch {
+	case insertedChars == 0 && deletedChars == 0:
+		return ""
+	case deletedChars == 0 && isNewline(inserted):
+		return types.ActionNewline
+	case deletedChars == 0 && insertedChars == 1:
+		return types.ActionInsertChar
+	case deletedChars == 0:
+		return types.ActionPaste
+	case insertedChars == 0 && deletedChars == 1:
+		return types.ActionDeleteChar
+	case insertedChars == 0:
+		return types.ActionDeleteSelection
+	case insertedChars == 1:
+		return types.ActionInsertChar // Replace mode, or typing over a selection
+	default:
+		return types.ActionInsertSelection
+	}
+}
+
+// isNewline reports whether text is a line break, with the indentation the
+// editor added to the new line.
+func isNewline(text string) bool {
+	rest, ok := strings.CutPrefix(text, "\n")
+	if !ok {
+		// Opening a line below the cursor inserts the indentation first
+		indent, found := strings.CutSuffix(text, "\n")
+		return found && strings.TrimLeft(indent, " \t") == ""
+	}
+	return strings.TrimLeft(rest, " \t") == ""
+}
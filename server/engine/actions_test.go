@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestClassifyEdit(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new []string
+		want     types.UserActionType
+	}{
+		{"typed character", []string{"foo"}, []string{"fooa"}, types.ActionInsertChar},
+		{"multi-byte character", []string{"café"}, []string{"cafés"}, types.ActionInsertChar},
+		{"character before a multi-byte one", []string{"é"}, []string{"aé"}, types.ActionInsertChar},
+		{"enter with indent", []string{"\tfoo()"}, []string{"\tfoo()", "\t"}, types.ActionNewline},
+		{"enter mid-line", []string{"foobar"}, []string{"foo", "bar"}, types.ActionNewline},
+		{"paste", []string{"x"}, []string{"xhello world"}, types.ActionPaste},
+		{"pasted lines", []string{"a"}, []string{"a", "b", "c"}, types.ActionPaste},
+		{"backspace", []string{"foo"}, []string{"fo"}, types.ActionDeleteChar},
+		{"backspace joining lines", []string{"foo", "bar"}, []string{"foobar"}, types.ActionDeleteChar},
+		{"deleted word", []string{"foo bar"}, []string{"foo "}, types.ActionDeleteSelection},
+		{"replace mode", []string{"foo"}, []string{"fxo"}, types.ActionInsertChar},
+		{"replaced word", []string{"foo bar"}, []string{"foo baz qux"}, types.ActionInsertSelection},
+		{"no change", []string{"foo"}, []string{"foo"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, deleted, inserted := editedText(tt.old, tt.new)
+			assert.Equal(t, tt.want, classifyEdit(deleted, inserted), "action type")
+		})
+	}
+}
+
+func TestEditedText_PrefixAndText(t *testing.T) {
+	prefix, deleted, inserted := editedText([]string{"foo", "bar"}, []string{"foo", "baXr"})
+
+	assert.Equal(t, "foo\nba", prefix, "prefix")
+	assert.Equal(t, "", deleted, "deleted")
+	assert.Equal(t, "X", inserted, "inserted")
+}
+
+func TestUpdateBuffer_RecordsEditActions(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"package main", "func f() {", "}"}
+	clock := newMockClock()
+	eng := createTestEngine(buf, newMockProvider(), clock)
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{
+		Path: "test.go", FirstLine: 1, LastLine: 2, Lines: []string{"func fx() {"}, Tick: 2, TimeMs: 1234,
+	}})
+
+	actions := eng.getUserActionsForFile("test.go")
+	assert.Len(t, 1, actions, "actions")
+	assert.Equal(t, types.ActionInsertChar, actions[0].ActionType, "type")
+	assert.Equal(t, 2, actions[0].LineNumber, "line")
+	assert.Equal(t, len("package main\nfunc f"), actions[0].Offset, "offset")
+	assert.Equal(t, int64(1234), actions[0].TimestampMs, "timestamp from the editor")
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{
+		Path: "test.go", FirstLine: 2, LastLine: 2, Lines: []string{"\treturn", "\tnil"}, Tick: 3,
+	}})
+
+	actions = eng.getUserActionsForFile("test.go")
+	assert.Len(t, 2, actions, "actions")
+	assert.Equal(t, types.ActionPaste, actions[1].ActionType, "type")
+	assert.Equal(t, 3, actions[1].LineNumber, "line")
+	assert.Equal(t, clock.Now().UnixMilli(), actions[1].TimestampMs, "timestamp from the clock")
+}
+
+func TestUpdateBuffer_EditActionsCapped(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{""}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.contextLimits.MaxUserActions = 3
+
+	for i := range 5 {
+		eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{
+			Path: "test.go", FirstLine: 0, LastLine: 1, Lines: []string{"x"}, Tick: i + 2,
+		}})
+	}
+
+	assert.Len(t, 3, eng.getUserActionsForFile("test.go"), "actions")
+}
+
+func TestUpdateBuffer_SkipsFullContentAndOtherBuffers(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "test.go", LastLine: -1, Lines: []string{"a"}, Tick: 2}})
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", LastLine: -1, Lines: []string{"a"}}})
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", FirstLine: 0, LastLine: 1, Lines: []string{"ab"}}})
+
+	assert.Len(t, 0, eng.getUserActionsForFile("test.go"), "current buffer")
+	assert.Len(t, 0, eng.getUserActionsForFile("util.go"), "other buffer")
+}
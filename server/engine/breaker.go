@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cursortab/logger"
+)
+
+// circuitState is the state of the circuit breaker guarding the provider.
+type circuitState int
+
+const (
+	circuitClosed   circuitState = iota // Requests are sent
+	circuitOpen                         // Requests are skipped until the cool-down ends
+	circuitHalfOpen                     // A probe request decides whether to close again
+)
+
+// circuitBreaker stops requests to a provider that keeps failing, so idle
+// and retriggered completions do not hammer an endpoint that is down. After
+// threshold consecutive failures it opens for cooldown, then lets a single
+// probe request through: success closes it, failure opens it again.
+type circuitBreaker struct {
+	threshold int // Consecutive failures that open the circuit (0 = never)
+	cooldown  time.Duration
+	state     circuitState
+	failures  int
+	retryAt   time.Time // When the next probe may be sent
+}
+
+// allow reports whether a request may be sent at now. Once the cool-down has
+// passed, the request allowed is the probe; should it be cancelled before
+// reporting back, another probe is allowed a cool-down later.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	if b.state == circuitClosed {
+		return true
+	}
+	if now.Before(b.retryAt) {
+		return false
+	}
+	b.state = circuitHalfOpen
+	b.retryAt = now.Add(b.cooldown)
+	return true
+}
+
+// success records a response. Returns true when it closed the circuit.
+func (b *circuitBreaker) success() bool {
+	b.failures = 0
+	if b.state == circuitClosed {
+		return false
+	}
+	b.state = circuitClosed
+	return true
+}
+
+// configure replaces the threshold and cool-down. Disabling the breaker
+// closes it.
+func (b *circuitBreaker) configure(threshold int, cooldown time.Duration) {
+	b.threshold = threshold
+	b.cooldown = cooldown
+	if threshold <= 0 {
+		b.state = circuitClosed
+		b.failures = 0
+	}
+}
+
+// failure records a failed request at now. Returns true when it opened the circuit.
+func (b *circuitBreaker) failure(now time.Time) bool {
+	if b.threshold <= 0 {
+		return false
+	}
+	b.failures++
+	if b.state == circuitClosed && b.failures < b.threshold {
+		return false
+	}
+	opened := b.state == circuitClosed
+	b.state = circuitOpen
+	b.retryAt = now.Add(b.cooldown)
+	return opened
+}
+
+// degraded reports whether the provider is considered down.
+func (b *circuitBreaker) degraded() bool {
+	return b.state != circuitClosed
+}
+
+// breakerAllows reports whether a request may be sent to the provider.
+// Manually triggered completions are always sent, and count as probes.
+func (e *Engine) breakerAllows() bool {
+	if e.manuallyTriggered || e.breaker.allow(e.clock.Now()) {
+		return true
+	}
+	logger.Debug("circuit breaker: provider degraded, skipping request")
+	return false
+}
+
+// breakerSucceeded records a response from the provider.
+func (e *Engine) breakerSucceeded() {
+	if e.breaker.success() {
+		logger.Info("circuit breaker: provider recovered")
+		e.notify(Notification{Event: NotifyProviderRecovered, Provider: e.providerName()})
+	}
+}
+
+// breakerFailed records a failed request. Cancelled requests say nothing
+// about the provider and are not counted.
+func (e *Engine) breakerFailed(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if e.breaker.failure(e.clock.Now()) {
+		logger.Warn("circuit breaker: %d failures in a row, pausing requests for %s", e.breaker.failures, e.breaker.cooldown)
+		e.notify(Notification{Event: NotifyProviderDegraded, Provider: e.providerName()})
+	}
+}
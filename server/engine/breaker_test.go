@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestCircuitBreaker_OpensAfterFailures(t *testing.T) {
+	now := time.Now()
+	b := &circuitBreaker{threshold: 3, cooldown: 30 * time.Second}
+
+	assert.False(t, b.failure(now), "first failure")
+	assert.False(t, b.failure(now), "second failure")
+	assert.True(t, b.allow(now), "closed below the threshold")
+	assert.True(t, b.failure(now), "third failure opens")
+	assert.True(t, b.degraded(), "degraded")
+	assert.False(t, b.allow(now.Add(10*time.Second)), "skipped during cool-down")
+
+	assert.True(t, b.allow(now.Add(30*time.Second)), "probe after cool-down")
+	assert.False(t, b.allow(now.Add(31*time.Second)), "one probe at a time")
+
+	assert.False(t, b.failure(now.Add(32*time.Second)), "failed probe reopens without reporting again")
+	assert.False(t, b.allow(now.Add(40*time.Second)), "skipped during second cool-down")
+
+	assert.True(t, b.allow(now.Add(62*time.Second)), "second probe")
+	assert.True(t, b.success(), "successful probe closes")
+	assert.False(t, b.degraded(), "recovered")
+}
+
+func TestCircuitBreaker_SuccessResetsFailures(t *testing.T) {
+	now := time.Now()
+	b := &circuitBreaker{threshold: 2, cooldown: time.Minute}
+
+	b.failure(now)
+	assert.False(t, b.success(), "already closed")
+	assert.False(t, b.failure(now), "count restarted")
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	b := &circuitBreaker{}
+	for range 10 {
+		b.failure(time.Now())
+	}
+	assert.True(t, b.allow(time.Now()), "zero threshold never opens")
+}
+
+func TestCircuitBreaker_SkipsRequestsWhileDegraded(t *testing.T) {
+	buf := newMockBuffer()
+	clock := newMockClock()
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), clock)
+	defer cancel()
+	eng.breaker = &circuitBreaker{threshold: 2, cooldown: 30 * time.Second}
+	var events []string
+	eng.onNotification = func(n Notification) { events = append(events, n.Event) }
+
+	failure := errors.New("status 503")
+	eng.handleEvent(Event{Type: EventCompletionError, Data: failure})
+	eng.handleEvent(Event{Type: EventCompletionError, Data: context.Canceled})
+	assert.False(t, eng.Progress().Degraded, "cancellations are not failures")
+	eng.handleEvent(Event{Type: EventCompletionError, Data: failure})
+
+	assert.True(t, eng.Progress().Degraded, "degraded after failures")
+	assert.Equal(t, []string{NotifyProviderDegraded}, events, "degraded notification")
+
+	req := &types.CompletionRequest{FilePath: "a.go", Lines: []string{"a"}}
+	assert.False(t, eng.sendCompletionRequest(req), "request skipped")
+	assert.False(t, eng.requestPrefetch(types.CompletionSourceTyping, 1, 0), "prefetch skipped")
+
+	eng.manuallyTriggered = true
+	assert.True(t, eng.sendCompletionRequest(req), "manual trigger sent")
+	eng.manuallyTriggered = false
+
+	clock.Advance(30 * time.Second)
+	assert.True(t, eng.sendCompletionRequest(req), "probe sent after cool-down")
+
+	eng.handleEvent(Event{Type: EventCompletionReady, Data: &types.CompletionResponse{}})
+
+	assert.False(t, eng.Progress().Degraded, "recovered")
+	assert.Equal(t, []string{NotifyProviderDegraded, NotifyProviderRecovered}, events, "recovered notification")
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"cursortab/logger"
+	"cursortab/metrics"
+	"cursortab/types"
+	"cursortab/utils"
+)
+
+// budgetWindow is the sliding window the token budget applies to
+const budgetWindow = time.Minute
+
+// tokenBudget tracks the estimated tokens sent to the provider over the last
+// minute. User-triggered requests are always sent and counted; retriggers are
+// downscaled or skipped when they would exceed the limit.
+type tokenBudget struct {
+	mu         sync.Mutex
+	limit      int
+	spends     []tokenSpend
+	skipped    int
+	downscaled int
+}
+
+type tokenSpend struct {
+	at     time.Time
+	tokens int
+}
+
+// setLimit replaces the limit, keeping the spends already counted.
+func (b *tokenBudget) setLimit(limit int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit = limit
+}
+
+// record counts tokens sent at now.
+func (b *tokenBudget) record(now time.Time, tokens int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spends = append(b.spends, tokenSpend{at: now, tokens: tokens})
+}
+
+// usedLocked drops spends older than the window and returns the remaining total.
+func (b *tokenBudget) usedLocked(now time.Time) int {
+	cutoff := now.Add(-budgetWindow)
+	b.spends = slices.DeleteFunc(b.spends, func(s tokenSpend) bool {
+		return !s.at.After(cutoff)
+	})
+	used := 0
+	for _, s := range b.spends {
+		used += s.tokens
+	}
+	return used
+}
+
+// fits reports whether tokens more can be sent at now without exceeding the limit.
+func (b *tokenBudget) fits(now time.Time, tokens int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limit <= 0 || b.usedLocked(now)+tokens <= b.limit
+}
+
+func (b *tokenBudget) noteSkipped() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.skipped++
+}
+
+func (b *tokenBudget) noteDownscaled() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.downscaled++
+}
+
+func (b *tokenBudget) status(now time.Time) metrics.BudgetStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return metrics.BudgetStatus{
+		Limit:      b.limit,
+		Used:       b.usedLocked(now),
+		Skipped:    b.skipped,
+		Downscaled: b.downscaled,
+	}
+}
+
+// fitToBudget returns the request to send for a retrigger: req itself when it
+// fits the budget, a downscaled copy when only that fits, or false when the
+// retrigger should be skipped.
+func (e *Engine) fitToBudget(req *types.CompletionRequest) (*types.CompletionRequest, bool) {
+	now := e.clock.Now()
+	cost := estimateRequestTokens(req)
+	if e.budget.fits(now, cost) {
+		return req, true
+	}
+
+	reduced := downscaleRequest(req)
+	if reducedCost := estimateRequestTokens(reduced); e.budget.fits(now, reducedCost) {
+		e.budget.noteDownscaled()
+		logger.Debug("budget: downscaling retrigger from %d to %d tokens", cost, reducedCost)
+		return reduced, true
+	}
+
+	e.budget.noteSkipped()
+	logger.Info("budget: skipping retrigger of ~%d tokens, per-minute budget of %d reached", cost, e.budget.limit)
+	return nil, false
+}
+
+// estimateRequestTokens estimates the prompt size of req from the buffer and
+// all the context gathered for it.
+func estimateRequestTokens(req *types.CompletionRequest) int {
+	chars := linesChars(req.Lines) + totalContextChars(req)
+	if ts := req.GetTreesitter(); ts != nil {
+		chars += treesitterChars(ts)
+	}
+	return utils.EstimateTokensFromChars(chars)
+}
+
+func treesitterChars(ts *types.TreesitterContext) int {
+	chars := len(ts.EnclosingSignature) + linesChars(ts.Imports)
+	for _, s := range ts.Siblings {
+		chars += len(s.Signature) + 1
+	}
+	return chars
+}
+
+// downscaleRequest returns a copy of req reduced to the current buffer and its
+// own diff history.
+func downscaleRequest(req *types.CompletionRequest) *types.CompletionRequest {
+	reduced := *req
+	reduced.FileDiffHistories = nil
+	for _, h := range req.FileDiffHistories {
+		if h.FileName == req.FilePath {
+			reduced.FileDiffHistories = []*types.FileDiffHistory{h}
+		}
+	}
+	reduced.RecentBufferSnapshots = nil
+	reduced.UserActions = nil
+	reduced.AdditionalContext = nil
+	reduced.RetrievalChunks = nil
+	return &reduced
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestTokenBudget_SlidingWindow(t *testing.T) {
+	now := time.Now()
+	b := &tokenBudget{limit: 100}
+
+	b.record(now, 60)
+	assert.True(t, b.fits(now, 40), "exactly at limit")
+	assert.False(t, b.fits(now, 41), "over limit")
+
+	later := now.Add(budgetWindow + time.Second)
+	assert.True(t, b.fits(later, 100), "old spends expire")
+	assert.Equal(t, 0, b.status(later).Used, "used after window")
+}
+
+func TestTokenBudget_Unlimited(t *testing.T) {
+	b := &tokenBudget{}
+	b.record(time.Now(), 1_000_000)
+
+	assert.True(t, b.fits(time.Now(), 1_000_000), "zero limit never blocks")
+}
+
+func TestFitToBudget_Downscales(t *testing.T) {
+	buf := newMockBuffer()
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.budget = &tokenBudget{limit: 50}
+
+	req := &types.CompletionRequest{
+		FilePath: "test.go",
+		Lines:    []string{"func main() {", "}"},
+		FileDiffHistories: []*types.FileDiffHistory{
+			{FileName: "test.go", DiffHistory: []*types.DiffEntry{{Original: "a", Updated: "b"}}},
+			{FileName: "other.go", DiffHistory: []*types.DiffEntry{{Updated: strings.Repeat("x", 200)}}},
+		},
+		RecentBufferSnapshots: []*types.RecentBufferSnapshot{{FilePath: "util.go", Lines: []string{strings.Repeat("y", 200)}}},
+	}
+
+	got, ok := eng.fitToBudget(req)
+
+	assert.True(t, ok, "downscaled request fits")
+	assert.NotEqual(t, req, got, "request was copied")
+	assert.Len(t, 1, got.FileDiffHistories, "only current file history")
+	assert.Equal(t, "test.go", got.FileDiffHistories[0].FileName, "current file history kept")
+	assert.Nil(t, got.RecentBufferSnapshots, "snapshots dropped")
+	assert.Len(t, 2, req.FileDiffHistories, "original request untouched")
+	assert.Equal(t, 1, eng.Stats().Budget.Downscaled, "downscaled count")
+}
+
+func TestEstimateRequestTokens_CountsGatheredContext(t *testing.T) {
+	req := &types.CompletionRequest{Lines: []string{"x := 1"}}
+	base := estimateRequestTokens(req)
+
+	req.AdditionalContext = &types.ContextResult{
+		Diagnostics: &types.LinterErrors{Errors: []*types.LinterError{{Message: strings.Repeat("d", 100)}}},
+		Treesitter:  &types.TreesitterContext{Imports: []string{strings.Repeat("i", 100)}},
+		GitDiff:     &types.GitDiffContext{Diff: strings.Repeat("g", 100)},
+	}
+	req.RetrievalChunks = []*types.RetrievalChunk{{FilePath: "util.go", Lines: []string{strings.Repeat("r", 100)}}}
+	full := estimateRequestTokens(req)
+
+	assert.True(t, full > base+80, "context and retrieval counted")
+	assert.Equal(t, base, estimateRequestTokens(downscaleRequest(req)), "downscaling drops them")
+}
+
+func TestRetrigger_SkippedWhenBudgetExhausted(t *testing.T) {
+	buf := newMockBuffer()
+	clock := newMockClock()
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), clock)
+	defer cancel()
+	eng.budget = &tokenBudget{limit: 100}
+	eng.budget.record(clock.Now(), 100)
+
+	assert.False(t, eng.retriggerCompletion(), "retrigger skipped")
+	assert.Equal(t, stateIdle, eng.state, "no request pending")
+
+	budget := eng.Stats().Budget
+	assert.Equal(t, 1, budget.Skipped, "skipped count")
+	assert.Equal(t, 100, budget.Used, "used tokens")
+	assert.Equal(t, 100, budget.Limit, "limit")
+
+	clock.Advance(budgetWindow + time.Second)
+
+	assert.True(t, eng.retriggerCompletion(), "retrigger sent once the window passes")
+	assert.Equal(t, estimateRequestTokens(&types.CompletionRequest{Lines: buf.lines}), eng.Stats().Budget.Used, "request counted")
+}
+
+func TestRequestCompletion_IgnoresBudget(t *testing.T) {
+	buf := newMockBuffer()
+	clock := newMockClock()
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), clock)
+	defer cancel()
+	eng.budget = &tokenBudget{limit: 1}
+	eng.budget.record(clock.Now(), 1)
+
+	eng.requestCompletion(types.CompletionSourceTyping)
+
+	assert.Equal(t, statePendingCompletion, eng.state, "user-triggered request sent")
+	assert.Equal(t, 0, eng.Stats().Budget.Skipped, "nothing skipped")
+}
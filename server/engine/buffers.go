@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+
+	"cursortab/logger"
+	"cursortab/types"
+)
+
+// BufferLines is a change to a buffer open in the editor, as reported by
+// nvim_buf_attach: lines FirstLine to LastLine (0-indexed, end exclusive) of
+// its previous content were replaced with Lines. A LastLine of -1 replaces the
+// whole content, which is how a buffer reports what it holds when attached.
+type BufferLines struct {
+	Path      string // Workspace-relative
+	FirstLine int
+	LastLine  int
+	Lines     []string
+	Tick      int   // b:changedtick once the change was made
+	TimeMs    int64 // Unix epoch milliseconds when the change was made, 0 if unknown
+	Paste     bool  // Made by a paste in the editor (vim.paste), whatever its size
+}
+
+// openBuffer is the engine's copy of a buffer open in the editor.
+type openBuffer struct {
+	lines    []string
+	accessNs int64 // When the buffer was last attached, left or changed
+}
+
+// UpdateBuffer applies a change to an open buffer. Changes to buffers other
+// than the current one are recorded in their diff history, so edits made by
+// formatters, workspace edits or other windows are known when switching to
+// them. Changes to the current one keep its lines up to date, so syncing it
+// does not read it in full.
+func (e *Engine) UpdateBuffer(change BufferLines) {
+	e.post(Event{Type: EventBufferLines, Data: change})
+}
+
+// CloseBuffer forgets the lines of a buffer closed or detached in the editor.
+// Its diff history is kept like that of any file left.
+func (e *Engine) CloseBuffer(path string) {
+	e.post(Event{Type: EventBufferClosed, Data: path})
+}
+
+// handleBufferEvent keeps the copies of open buffers up to date. They are
+// tracked even while completions are blocked.
+func (e *Engine) handleBufferEvent(event Event) bool {
+	switch event.Type {
+	case EventBufferLines:
+		if change, ok := event.Data.(BufferLines); ok {
+			e.applyBufferLines(change)
+		}
+		return true
+
+	case EventBufferClosed:
+		if path, ok := event.Data.(string); ok {
+			delete(e.openBuffers, path)
+			// Without changes to apply, the current buffer is read in full
+			if path == e.buffer.Path() {
+				e.buffer.DetachLines()
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (e *Engine) applyBufferLines(change BufferLines) {
+	if change.Path == "" || e.ignore.Match(change.Path) {
+		return
+	}
+	if change.Path == e.buffer.Path() {
+		// The current buffer's lines are kept up to date between syncs. Changes
+		// it skips were made by the daemon itself or already synced.
+		old := e.buffer.Lines()
+		applied := e.buffer.ApplyLines(change.FirstLine, change.LastLine, change.Lines, change.Tick)
+		if change.LastLine >= 0 {
+			if applied {
+				e.trackPaste(change, e.recordEditAction(change, old))
+			}
+			e.rebasePending(change)
+		}
+	}
+	now := e.clock.Now().UnixNano()
+
+	buf, ok := e.openBuffers[change.Path]
+	if change.LastLine < 0 {
+		e.openBuffers[change.Path] = &openBuffer{lines: copyLines(change.Lines), accessNs: now}
+		return
+	}
+	if !ok {
+		return
+	}
+	if change.FirstLine < 0 || change.FirstLine > change.LastLine || change.LastLine > len(buf.lines) {
+		// The copy missed a change; wait for the next full content
+		logger.Debug("buffers: change to lines %d-%d of %s out of range, dropping its copy",
+			change.FirstLine, change.LastLine, change.Path)
+		delete(e.openBuffers, change.Path)
+		return
+	}
+
+	old := buf.lines
+	buf.lines = slices.Concat(old[:change.FirstLine], change.Lines, old[change.LastLine:])
+	buf.accessNs = now
+
+	// The current buffer keeps its own history, committed on InsertLeave
+	if change.Path != e.buffer.Path() {
+		e.recordBackgroundEdit(change, old, buf.lines)
+	}
+}
+
+// recordBackgroundEdit appends a change to a buffer that is not the current
+// one to its file state, and moves its checkpoint past it so the edit is not
+// counted again when the buffer becomes current.
+func (e *Engine) recordBackgroundEdit(change BufferLines, old, updated []string) {
+	entry := &types.DiffEntry{
+		Original: strings.Join(old[change.FirstLine:change.LastLine], "\n"),
+		Updated:  strings.Join(change.Lines, "\n"),
+	}
+	if entry.Original == entry.Updated {
+		return
+	}
+
+	state, ok := e.fileStateStore[change.Path]
+	if !ok {
+		state = &FileState{}
+		e.fileStateStore[change.Path] = state
+	}
+	state.DiffHistories = append(state.DiffHistories, entry)
+	state.PreviousLines = old
+	state.OriginalLines = copyLines(updated)
+	state.FirstLines = copyFirstN(updated, e.contextLimits.FileChunkLines)
+	state.LastAccessNs = e.clock.Now().UnixNano()
+	state.Version++
+}
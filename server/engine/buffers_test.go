@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/ignore"
+)
+
+func TestUpdateBuffer_AppliesChanges(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", LastLine: -1, Lines: []string{"a", "b", "c"}}})
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", FirstLine: 1, LastLine: 2, Lines: []string{"B1", "B2"}}})
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", FirstLine: 3, LastLine: 4}})
+
+	assert.Equal(t, []string{"a", "B1", "B2"}, eng.openBuffers["util.go"].lines, "lines")
+}
+
+func TestUpdateBuffer_RecordsBackgroundEdits(t *testing.T) {
+	buf := newMockBuffer()
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", LastLine: -1, Lines: []string{"package util", "var x = 1"}}})
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", FirstLine: 1, LastLine: 2, Lines: []string{"var x = 2"}}})
+
+	state := eng.fileStateStore["util.go"]
+	assert.NotNil(t, state, "file state")
+	assert.Len(t, 1, state.DiffHistories, "diff entries")
+	assert.Equal(t, "var x = 1", state.DiffHistories[0].Original, "original")
+	assert.Equal(t, "var x = 2", state.DiffHistories[0].Updated, "updated")
+	assert.Equal(t, []string{"package util", "var x = 1"}, state.PreviousLines, "previous lines")
+
+	eng.handleFileSwitch("test.go", "util.go", []string{"package util", "var x = 2"})
+
+	assert.Len(t, 1, buf.diffHistories, "history restored on switch")
+	assert.Equal(t, []string{"package util", "var x = 2"}, buf.originalLines, "edit not counted again")
+}
+
+func TestUpdateBuffer_CurrentBufferKeepsItsHistory(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "test.go", LastLine: -1, Lines: []string{"a"}}})
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "test.go", FirstLine: 0, LastLine: 1, Lines: []string{"b"}}})
+
+	assert.Nil(t, eng.fileStateStore["test.go"], "no state recorded")
+	assert.Equal(t, []string{"b"}, eng.openBuffers["test.go"].lines, "lines")
+}
+
+func TestUpdateBuffer_OutOfRangeDropsCopy(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", FirstLine: 0, LastLine: 1, Lines: []string{"x"}}})
+	assert.Nil(t, eng.openBuffers["util.go"], "change to an unknown buffer")
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", LastLine: -1, Lines: []string{"a"}}})
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", FirstLine: 2, LastLine: 5, Lines: []string{"x"}}})
+	assert.Nil(t, eng.openBuffers["util.go"], "copy dropped")
+	assert.Nil(t, eng.fileStateStore["util.go"], "no state recorded")
+}
+
+func TestUpdateBuffer_IgnoredPath(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+	eng.SetIgnoreRules(ignore.Load(t.TempDir(), []string{".env"}, false))
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: ".env", LastLine: -1, Lines: []string{"KEY=x"}}})
+
+	assert.Nil(t, eng.openBuffers[".env"], "not tracked")
+}
+
+func TestRecentBufferSnapshots_UseOpenBuffers(t *testing.T) {
+	clock := newMockClock()
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), clock)
+	eng.fileStateStore["util.go"] = &FileState{FirstLines: []string{"stale"}, LastAccessNs: clock.Now().UnixNano()}
+
+	clock.Advance(time.Second)
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", LastLine: -1, Lines: []string{"fresh"}}})
+	clock.Advance(time.Second)
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "other.go", LastLine: -1, Lines: []string{"package other"}}})
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "test.go", LastLine: -1, Lines: []string{"current"}}})
+
+	snapshots := eng.getRecentBufferSnapshots("test.go", 5)
+
+	assert.Len(t, 2, snapshots, "snapshots")
+	assert.Equal(t, "other.go", snapshots[0].FilePath, "most recent first")
+	assert.Equal(t, "util.go", snapshots[1].FilePath, "visited file")
+	assert.Equal(t, []string{"fresh"}, snapshots[1].Lines, "current content of the open buffer")
+
+	eng.handleEvent(Event{Type: EventBufferClosed, Data: "other.go"})
+	assert.Len(t, 1, eng.getRecentBufferSnapshots("test.go", 5), "closed buffer dropped")
+}
+
+func TestUpdateBuffer_CurrentBufferLinesTracked(t *testing.T) {
+	buf := newMockBuffer()
+	buf.path = "main.go"
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "main.go", FirstLine: 0, LastLine: 1, Lines: []string{"x"}, Tick: 3}})
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", LastLine: -1, Lines: []string{"a"}, Tick: 1}})
+	assert.Equal(t, 1, buf.appliedLines, "only changes to the current buffer applied to it")
+
+	eng.handleEvent(Event{Type: EventBufferClosed, Data: "util.go"})
+	assert.False(t, buf.detached, "other buffer closed")
+	eng.handleEvent(Event{Type: EventBufferClosed, Data: "main.go"})
+	assert.True(t, buf.detached, "read in full once detached")
+}
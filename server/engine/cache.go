@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"cursortab/types"
+)
+
+// cacheRegionLines is how many lines above and below the cursor are part of
+// a response cache key
+const cacheRegionLines = 20
+
+// responseCache remembers recent provider responses by request context, so an
+// undo and redo, or a reject followed by a retrigger, is answered without
+// another provider request. Entries expire after the configured TTL and the
+// least recently stored entry is evicted once the cache is full. Entries
+// restored from a CacheStore do not expire within the session.
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[uint64]cacheEntry
+	order   []uint64 // Keys, oldest first
+	hits    int
+}
+
+type cacheEntry struct {
+	resp     *types.CompletionResponse
+	storedAt time.Time
+	restored bool // Loaded from a CacheStore: exempt from the TTL, bounded by the store's max age
+}
+
+func newResponseCache() *responseCache {
+	return &responseCache{entries: make(map[uint64]cacheEntry)}
+}
+
+// get returns the response stored under key if it is younger than ttl.
+func (c *responseCache) get(key uint64, now time.Time, ttl time.Duration) *types.CompletionResponse {
+	if ttl <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || (!entry.restored && now.Sub(entry.storedAt) > ttl) {
+		return nil
+	}
+	c.hits++
+	return entry.resp
+}
+
+// put stores resp under key, evicting the oldest entries beyond maxEntries.
+func (c *responseCache) put(key uint64, resp *types.CompletionResponse, now time.Time, maxEntries int) {
+	if maxEntries <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; ok {
+		c.removeLocked(key)
+	}
+	c.entries[key] = cacheEntry{resp: resp, storedAt: now}
+	c.order = append(c.order, key)
+	for len(c.order) > maxEntries {
+		c.removeLocked(c.order[0])
+	}
+}
+
+// snapshot returns the entries oldest first. Metrics IDs are dropped, since
+// they belong to the session that received the response.
+func (c *responseCache) snapshot() []CachedResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]CachedResponse, 0, len(c.order))
+	for _, key := range c.order {
+		entry := c.entries[key]
+		resp := *entry.resp
+		resp.MetricsInfo = nil
+		entries = append(entries, CachedResponse{Key: key, Response: &resp, StoredAt: entry.storedAt})
+	}
+	return entries
+}
+
+// restore adds persisted entries, oldest first, keeping at most maxEntries.
+func (c *responseCache) restore(entries []CachedResponse, maxEntries int) {
+	if maxEntries <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range entries {
+		if e.Response == nil {
+			continue
+		}
+		if _, ok := c.entries[e.Key]; ok {
+			c.removeLocked(e.Key)
+		}
+		c.entries[e.Key] = cacheEntry{resp: e.Response, storedAt: e.StoredAt, restored: true}
+		c.order = append(c.order, e.Key)
+	}
+	for len(c.order) > maxEntries {
+		c.removeLocked(c.order[0])
+	}
+}
+
+func (c *responseCache) removeLocked(key uint64) {
+	delete(c.entries, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// cacheKey hashes the parts of a request that determine the response: the
+// file, the cursor position, the instruction, the lines around it and the
+// latest edit.
+func cacheKey(req *types.CompletionRequest) uint64 {
+	h := fnv.New64a()
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	write(req.FilePath)
+	write(strconv.Itoa(req.CursorRow))
+	write(strconv.Itoa(req.CursorCol))
+	write(req.Instruction)
+
+	start := max(req.CursorRow-1-cacheRegionLines, 0)
+	end := min(req.CursorRow+cacheRegionLines, len(req.Lines))
+	for i := start; i < end; i++ {
+		write(req.Lines[i])
+	}
+
+	for _, fh := range req.FileDiffHistories {
+		if fh.FileName != req.FilePath || len(fh.DiffHistory) == 0 {
+			continue
+		}
+		last := fh.DiffHistory[len(fh.DiffHistory)-1]
+		write(last.Original)
+		write(last.Updated)
+	}
+
+	return h.Sum64()
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestResponseCache_ExpiresAfterTTL(t *testing.T) {
+	c := newResponseCache()
+	now := time.Now()
+	resp := completionWith("cached")
+
+	c.put(1, resp, now, 4)
+
+	assert.Equal(t, resp, c.get(1, now.Add(time.Second), 2*time.Second), "within ttl")
+	assert.Nil(t, c.get(1, now.Add(3*time.Second), 2*time.Second), "after ttl")
+	assert.Nil(t, c.get(1, now, 0), "ttl 0 disables the cache")
+}
+
+func TestResponseCache_EvictsOldest(t *testing.T) {
+	c := newResponseCache()
+	now := time.Now()
+
+	c.put(1, completionWith("one"), now, 2)
+	c.put(2, completionWith("two"), now, 2)
+	c.put(1, completionWith("one again"), now, 2)
+	c.put(3, completionWith("three"), now, 2)
+
+	assert.Nil(t, c.get(2, now, time.Minute), "oldest entry evicted")
+	assert.Equal(t, "one again", c.get(1, now, time.Minute).Completions[0].Lines[0], "re-stored entry kept")
+	assert.NotNil(t, c.get(3, now, time.Minute), "newest entry kept")
+}
+
+func TestCacheKey(t *testing.T) {
+	base := func() *types.CompletionRequest {
+		lines := make([]string, 60)
+		for i := range lines {
+			lines[i] = "line"
+		}
+		return &types.CompletionRequest{
+			FilePath:  "main.go",
+			Lines:     lines,
+			CursorRow: 30,
+			CursorCol: 2,
+			FileDiffHistories: []*types.FileDiffHistory{{
+				FileName:    "main.go",
+				DiffHistory: []*types.DiffEntry{{Original: "a", Updated: "b"}},
+			}},
+		}
+	}
+	key := cacheKey(base())
+
+	farEdit := base()
+	farEdit.Lines[0] = "changed far above the cursor"
+	assert.Equal(t, key, cacheKey(farEdit), "lines outside the cursor region are ignored")
+
+	tests := []struct {
+		name   string
+		modify func(*types.CompletionRequest)
+	}{
+		{"file", func(r *types.CompletionRequest) { r.FilePath = "other.go" }},
+		{"cursor row", func(r *types.CompletionRequest) { r.CursorRow = 31 }},
+		{"cursor col", func(r *types.CompletionRequest) { r.CursorCol = 3 }},
+		{"region line", func(r *types.CompletionRequest) { r.Lines[35] = "edited" }},
+		{"diff tail", func(r *types.CompletionRequest) {
+			h := r.FileDiffHistories[0]
+			h.DiffHistory = append(h.DiffHistory, &types.DiffEntry{Original: "b", Updated: "c"})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := base()
+			tt.modify(req)
+			assert.NotEqual(t, key, cacheKey(req), "key changes")
+		})
+	}
+}
+
+func TestSendCompletionRequest_ServesRepeatFromCache(t *testing.T) {
+	buf := newMockBuffer()
+	prov := newMockProvider()
+	eng, cancel := createTestEngineWithContext(buf, prov, newMockClock())
+	defer cancel()
+	eng.config.CacheTTL = time.Minute
+	eng.config.CacheMaxEntries = 4
+
+	receive := func() *types.CompletionResponse {
+		select {
+		case event := <-eng.eventChan:
+			assert.Equal(t, EventCompletionReady, event.Type, "event type")
+			return event.Data.(*types.CompletionResponse)
+		case <-time.After(time.Second):
+			t.Fatal("no completion event")
+			return nil
+		}
+	}
+
+	eng.sendCompletionRequest(eng.buildCompletionRequest(types.CompletionSourceTyping))
+	first := receive()
+
+	eng.state = stateIdle
+	eng.sendCompletionRequest(eng.buildCompletionRequest(types.CompletionSourceTyping))
+	second := receive()
+
+	assert.Equal(t, statePendingCompletion, eng.state, "cached response awaited like a request")
+	assert.Equal(t, first, second, "cached response")
+	assert.Equal(t, 1, prov.completionCalls, "provider calls")
+}
+
+func TestSendCompletionRequest_CacheDisabled(t *testing.T) {
+	buf := newMockBuffer()
+	prov := newMockProvider()
+	eng, cancel := createTestEngineWithContext(buf, prov, newMockClock())
+	defer cancel()
+
+	for range 2 {
+		eng.sendCompletionRequest(eng.buildCompletionRequest(types.CompletionSourceTyping))
+		select {
+		case <-eng.eventChan:
+		case <-time.After(time.Second):
+			t.Fatal("no completion event")
+		}
+	}
+
+	assert.Equal(t, 2, prov.completionCalls, "provider calls")
+}
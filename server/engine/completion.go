@@ -1,8 +1,12 @@
 package engine
 
 import (
+	"path/filepath"
+	"slices"
+
 	"cursortab/logger"
 	"cursortab/metrics"
+	"cursortab/quality"
 	"cursortab/text"
 	"cursortab/types"
 	"cursortab/utils"
@@ -11,23 +15,139 @@ import (
 // handleCompletionReadyImpl processes a successful completion response.
 func (e *Engine) handleCompletionReadyImpl(response *types.CompletionResponse) {
 	e.syncBuffer()
+	e.multiFile = nil
+	response.Annotation = e.responseAnnotation()
+	e.showAnnotation(response.Annotation)
+	e.qualityResponse(response)
+
+	current, others := e.splitByFile(response.Completions)
+	otherFiles := e.stageOtherFiles(others)
 
-	if len(response.Completions) == 0 {
+	if len(current) == 0 {
+		if e.showOtherFiles(otherFiles) {
+			e.recordMetricsShown(response.MetricsInfo)
+			return
+		}
+		if e.showCursorOnlyPrediction(response) {
+			return
+		}
+		e.finishQuality(quality.OutcomeEmpty)
 		e.handleCursorTarget()
 		return
 	}
 
-	completion := response.Completions[0]
+	completion := current[0]
 
 	if e.processCompletion(completion) {
+		if len(otherFiles) > 0 {
+			currentFile := &text.FileStages{Staged: e.stagedCompletion}
+			e.multiFile = text.NewMultiFileStagedCompletion(append([]*text.FileStages{currentFile}, otherFiles...)...)
+		}
+		e.setCandidates(current)
+		// The next locations are offered once this completion is accepted
+		if len(response.NextTargets) > 0 {
+			e.queueTargets(response.NextTargets)
+		}
 		// Completion was shown - record metrics
 		e.recordMetricsShown(response.MetricsInfo)
 		return
 	}
 
+	if e.showOtherFiles(otherFiles) {
+		e.recordMetricsShown(response.MetricsInfo)
+		return
+	}
+	e.finishQuality(quality.OutcomeEmpty)
 	e.handleCompletionNoChanges(completion)
 }
 
+// showCursorOnlyPrediction shows the jump indicator for a response that predicts
+// where the cursor goes next without proposing an edit. Returns false when such
+// predictions are disabled, or the target is out of range, in an ignored file,
+// or close enough to the cursor to be pointless.
+func (e *Engine) showCursorOnlyPrediction(response *types.CompletionResponse) bool {
+	target := response.CursorTarget
+	cp := e.config.CursorPrediction
+	if target == nil || !cp.Enabled || !cp.CursorOnly {
+		return false
+	}
+	if e.isOtherFile(target) {
+		if target.LineNumber < 1 || !filepath.IsLocal(target.RelativePath) || e.ignore.Match(target.RelativePath) {
+			return false
+		}
+		e.dropTargets()
+		e.cursorTarget = target
+		e.state = stateHasCursorTarget
+		e.targetView = targetView{}
+		e.buffer.ShowFileTarget(target.RelativePath, int(target.LineNumber), &text.MultiFileSummary{
+			Files: []text.FileSummary{{Path: target.RelativePath}},
+		})
+		e.notify(Notification{Event: NotifyCursorTargetShown, FilePath: target.RelativePath, Line: int(target.LineNumber)})
+		e.recordJumpShown(response.MetricsInfo)
+		return true
+	}
+
+	line := int(target.LineNumber)
+	if line < 1 || line > len(e.buffer.Lines()) {
+		return false
+	}
+	if utils.Abs(line-e.buffer.Row()) <= cp.ProximityThreshold {
+		return false
+	}
+
+	e.cursorTarget = target
+	e.state = stateHasCursorTarget
+	e.showCursorTarget(line)
+	e.queueTargets(response.Targets())
+	e.recordJumpShown(response.MetricsInfo)
+	return true
+}
+
+// targetVisibility is where a cursor target sits relative to the viewport,
+// which decides how its jump indicator is drawn.
+type targetVisibility int
+
+const (
+	targetVisible targetVisibility = iota
+	targetAbove
+	targetBelow
+)
+
+// targetView is the cursor target line last rendered, and its visibility then.
+type targetView struct {
+	line       int
+	visibility targetVisibility
+}
+
+// targetVisibilityOf places line relative to the viewport top..bottom
+// (1-indexed, inclusive). An unknown viewport counts as visible.
+func targetVisibilityOf(line, top, bottom int) targetVisibility {
+	switch {
+	case top <= 0 || bottom <= 0:
+		return targetVisible
+	case line < top:
+		return targetAbove
+	case line > bottom:
+		return targetBelow
+	default:
+		return targetVisible
+	}
+}
+
+// showCursorTarget renders the jump indicator for line and remembers the
+// viewport side it was drawn for.
+func (e *Engine) showCursorTarget(line int) {
+	e.renderCursorTarget(line)
+	e.notify(Notification{Event: NotifyCursorTargetShown, FilePath: e.buffer.Path(), Line: line})
+}
+
+// renderCursorTarget draws the jump indicator for line without reporting it.
+func (e *Engine) renderCursorTarget(line int) {
+	top, bottom := e.buffer.ViewportBounds()
+	e.targetView = targetView{line: line, visibility: targetVisibilityOf(line, top, bottom)}
+	e.buffer.ShowCursorTarget(e.foldHeader(line))
+}
+
 // handleCompletionNoChanges handles the case where completion has no changes.
 func (e *Engine) handleCompletionNoChanges(completion *types.Completion) {
 	if e.config.CursorPrediction.AutoAdvance && e.config.CursorPrediction.Enabled {
@@ -49,10 +169,20 @@ func (e *Engine) handleTextChangeImpl() {
 
 	e.syncBuffer()
 
+	// An edit elsewhere in the buffer leaves the re-based completion valid
+	if e.editedOutside {
+		e.editedOutside = false
+		if e.completionRegionUnchanged() {
+			e.rerenderPartial()
+			return
+		}
+	}
+
 	matches, hasRemaining := e.checkTypingMatchesPrediction()
 	if matches {
 		if hasRemaining {
 			// Typing matches - keep completion state
+			e.consumeTypedText()
 			return
 		}
 		// User typed everything - completion fully typed
@@ -66,6 +196,31 @@ func (e *Engine) handleTextChangeImpl() {
 	e.rejectAndRearmTimer()
 }
 
+// consumeTypedText shrinks the shown completion to what is left to type after
+// the user typed part of it, without a new request. A lone append_chars group
+// is shrunk by the editor as the user types, so it is left alone. The
+// original lines are kept so later keystrokes, backspaces included, are still
+// matched against the lines the completion was made for.
+func (e *Engine) consumeTypedText() {
+	if len(e.currentGroups) == 1 && e.currentGroups[0].RenderHint == "append_chars" {
+		return
+	}
+	original := e.completionOriginalLines
+	e.rerenderPartial()
+	e.completionOriginalLines = original
+}
+
+// completionRegionUnchanged reports whether the buffer lines the shown
+// completion replaces are still the lines it was shown against.
+func (e *Engine) completionRegionUnchanged() bool {
+	comp := e.completions[0]
+	lines := e.buffer.Lines()
+	if comp.StartLine < 1 || comp.EndLineInc > len(lines) {
+		return false
+	}
+	return slices.Equal(lines[comp.StartLine-1:max(comp.EndLineInc, comp.StartLine-1)], e.completionOriginalLines)
+}
+
 // rejectAndRearmTimer rejects the current completion and restarts the text change timer.
 func (e *Engine) rejectAndRearmTimer() {
 	e.reject()
@@ -195,7 +350,7 @@ func (e *Engine) handleCursorTarget() {
 				ShouldRetrigger: false,
 			}
 			e.state = stateHasCursorTarget
-			e.buffer.ShowCursorTarget(stageStart)
+			e.showCursorTarget(stageStart)
 			return
 		}
 
@@ -211,12 +366,12 @@ func (e *Engine) handleCursorTarget() {
 
 	// Far away - show cursor prediction to the target line
 	e.state = stateHasCursorTarget
-	e.buffer.ShowCursorTarget(int(e.cursorTarget.LineNumber))
+	e.showCursorTarget(int(e.cursorTarget.LineNumber))
 }
 
 // clearCompletionUIOnly clears completion state but preserves prefetch.
 func (e *Engine) clearCompletionUIOnly() {
-	if len(e.completions) > 0 {
+	if e.awaitingOutcome() {
 		e.sendMetric(metrics.EventIgnored)
 	}
 	e.clearState(ClearOptions{CancelCurrent: true, CancelPrefetch: false, ClearStaged: true, CallOnReject: false})
@@ -231,7 +386,7 @@ func (e *Engine) showCurrentStage() {
 	}
 
 	stage := e.getStage(e.stagedCompletion.CurrentIdx)
-	if stage == nil {
+	if stage == nil || e.showFoldedStage(stage.BufferStart) {
 		return
 	}
 
@@ -267,6 +422,45 @@ func (e *Engine) getStage(idx int) *text.Stage {
 	return e.stagedCompletion.Stages[idx]
 }
 
+// fitToBuffer rewrites a completion whose range ends past the last buffer line
+// so that it only replaces existing lines, according to policy.
+// Returns false when the completion must be discarded.
+func fitToBuffer(completion *types.Completion, bufferLines []string, policy EOFPolicy) (*types.Completion, bool) {
+	lineCount := len(bufferLines)
+	if completion.EndLineInc <= lineCount || lineCount == 0 {
+		return completion, true
+	}
+
+	fitted := *completion
+	switch policy {
+	case EOFReject:
+		return nil, false
+
+	case EOFClamp:
+		keep := len(completion.Lines) - (completion.EndLineInc - lineCount)
+		if completion.StartLine > lineCount || keep < 0 {
+			return nil, false
+		}
+		fitted.EndLineInc = lineCount
+		fitted.Lines = completion.Lines[:keep]
+		return &fitted, true
+
+	default:
+		if completion.StartLine <= lineCount {
+			fitted.EndLineInc = lineCount
+			return &fitted, true
+		}
+		if completion.StartLine > lineCount+1 {
+			return nil, false
+		}
+		// Appending right after the last line: anchor on it so the range stays in the buffer
+		fitted.StartLine = lineCount
+		fitted.EndLineInc = lineCount
+		fitted.Lines = append([]string{bufferLines[lineCount-1]}, completion.Lines...)
+		return &fitted, true
+	}
+}
+
 // processCompletion is the SINGLE ENTRY POINT for processing all completions.
 func (e *Engine) processCompletion(completion *types.Completion) bool {
 	defer logger.Trace("engine.processCompletion")()
@@ -274,10 +468,29 @@ func (e *Engine) processCompletion(completion *types.Completion) bool {
 		return false
 	}
 
+	completion, ok := fitToBuffer(completion, e.buffer.Lines(), e.config.EOFPolicy)
+	if !ok {
+		logger.Debug("completion past end of buffer rejected")
+		return false
+	}
+	if e.oversized(completion, e.buffer.Lines()) {
+		return false
+	}
+
+	// Renames are proposed across the whole document, code and prose alike
+	if !e.propagatingRename && !withinFences(e.buffer.Path(), e.buffer.Lines(), completion) {
+		logger.Debug("completion crossing a code fence rejected")
+		return false
+	}
+
 	if !e.buffer.HasChanges(completion.StartLine, completion.EndLineInc, completion.Lines) {
 		return false
 	}
 
+	if e.showInlineInsertion(completion) {
+		return true
+	}
+
 	bufferLines := e.buffer.Lines()
 	var originalLines []string
 	for i := completion.StartLine; i <= completion.EndLineInc && i-1 < len(bufferLines); i++ {
@@ -297,18 +510,33 @@ func (e *Engine) processCompletion(completion *types.Completion) bool {
 		ViewportBottom:     viewportBottom,
 		BaseLineOffset:     completion.StartLine,
 		ProximityThreshold: e.config.CursorPrediction.ProximityThreshold,
-		MaxLines:           e.config.MaxVisibleLines,
+		MaxLines:           e.stageLineLimit(e.config.MaxVisibleLines),
 		FilePath:           e.buffer.Path(),
 		NewLines:           completion.Lines,
 		OldLines:           originalLines,
+		Scopes:             e.scopes,
+		Order:              e.config.StageOrder,
 	})
 
 	if stagingResult != nil && len(stagingResult.Stages) > 0 {
+		e.lastStaging = &stagingInput{
+			oldLines:       originalLines,
+			newLines:       completion.Lines,
+			baseLineOffset: completion.StartLine,
+			cursorRow:      e.buffer.Row(),
+			cursorCol:      e.buffer.Col(),
+			viewportTop:    viewportTop,
+			viewportBottom: viewportBottom,
+			filePath:       e.buffer.Path(),
+			scopes:         e.scopes,
+			order:          e.config.StageOrder,
+		}
 		e.stagedCompletion = &text.StagedCompletion{
 			Stages:     stagingResult.Stages,
 			CurrentIdx: 0,
 			SourcePath: e.buffer.Path(),
 		}
+		e.revealFolds()
 
 		if stagingResult.FirstNeedsNavigation {
 			firstStage := stagingResult.Stages[0]
@@ -318,7 +546,7 @@ func (e *Engine) processCompletion(completion *types.Completion) bool {
 				ShouldRetrigger: false,
 			}
 			e.state = stateHasCursorTarget
-			e.buffer.ShowCursorTarget(firstStage.BufferStart)
+			e.showCursorTarget(firstStage.BufferStart)
 			return true
 		}
 
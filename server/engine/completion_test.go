@@ -2,6 +2,7 @@ package engine
 
 import (
 	"cursortab/assert"
+	"cursortab/text"
 	"cursortab/types"
 	"testing"
 )
@@ -158,3 +159,355 @@ func TestHandleCursorTarget_FarAway(t *testing.T) {
 	assert.Equal(t, stateHasCursorTarget, eng.state, "state when far away")
 	assert.Equal(t, 10, buf.showCursorTargetLine, "showCursorTargetLine")
 }
+
+func TestFitToBuffer(t *testing.T) {
+	bufferLines := []string{"a", "b", "c"}
+
+	tests := []struct {
+		name       string
+		completion *types.Completion
+		policy     EOFPolicy
+		wantOK     bool
+		want       *types.Completion
+	}{
+		{
+			name:       "within buffer is untouched",
+			completion: &types.Completion{StartLine: 2, EndLineInc: 3, Lines: []string{"B", "C"}},
+			policy:     EOFReject,
+			wantOK:     true,
+			want:       &types.Completion{StartLine: 2, EndLineInc: 3, Lines: []string{"B", "C"}},
+		},
+		{
+			name:       "extend keeps lines past the end",
+			completion: &types.Completion{StartLine: 2, EndLineInc: 5, Lines: []string{"b", "c", "d", "e"}},
+			policy:     EOFExtend,
+			wantOK:     true,
+			want:       &types.Completion{StartLine: 2, EndLineInc: 3, Lines: []string{"b", "c", "d", "e"}},
+		},
+		{
+			name:       "extend is the default",
+			completion: &types.Completion{StartLine: 3, EndLineInc: 4, Lines: []string{"c", "d"}},
+			policy:     "",
+			wantOK:     true,
+			want:       &types.Completion{StartLine: 3, EndLineInc: 3, Lines: []string{"c", "d"}},
+		},
+		{
+			name:       "extend anchors an append after the last line",
+			completion: &types.Completion{StartLine: 4, EndLineInc: 5, Lines: []string{"d", "e"}},
+			policy:     EOFExtend,
+			wantOK:     true,
+			want:       &types.Completion{StartLine: 3, EndLineInc: 3, Lines: []string{"c", "d", "e"}},
+		},
+		{
+			name:       "other file keeps its path",
+			completion: &types.Completion{FilePath: "other.go", StartLine: 2, EndLineInc: 5, Lines: []string{"b", "c", "d", "e"}},
+			policy:     EOFClamp,
+			wantOK:     true,
+			want:       &types.Completion{FilePath: "other.go", StartLine: 2, EndLineInc: 3, Lines: []string{"b", "c"}},
+		},
+		{
+			name:       "extend rejects a gap after the last line",
+			completion: &types.Completion{StartLine: 6, EndLineInc: 6, Lines: []string{"f"}},
+			policy:     EOFExtend,
+			wantOK:     false,
+		},
+		{
+			name:       "clamp drops lines mapped past the end",
+			completion: &types.Completion{StartLine: 2, EndLineInc: 5, Lines: []string{"B", "C", "d", "e"}},
+			policy:     EOFClamp,
+			wantOK:     true,
+			want:       &types.Completion{StartLine: 2, EndLineInc: 3, Lines: []string{"B", "C"}},
+		},
+		{
+			name:       "clamp rejects an append after the last line",
+			completion: &types.Completion{StartLine: 4, EndLineInc: 4, Lines: []string{"d"}},
+			policy:     EOFClamp,
+			wantOK:     false,
+		},
+		{
+			name:       "reject discards completions past the end",
+			completion: &types.Completion{StartLine: 3, EndLineInc: 4, Lines: []string{"c", "d"}},
+			policy:     EOFReject,
+			wantOK:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := fitToBuffer(tt.completion, bufferLines, tt.policy)
+			assert.Equal(t, tt.wantOK, ok, "ok")
+			if tt.wantOK {
+				assert.Equal(t, tt.want, got, "completion")
+			}
+		})
+	}
+}
+
+func TestProcessCompletion_PastEOFStaysInBuffer(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"func f() {", "}"}
+	buf.row = 2
+	prov := newMockProvider()
+	clock := newMockClock()
+	eng := createTestEngine(buf, prov, clock)
+
+	shown := eng.processCompletion(&types.Completion{
+		StartLine:  2,
+		EndLineInc: 4,
+		Lines:      []string{"}", "", "func g() {}"},
+	})
+
+	assert.True(t, shown, "completion shown")
+	assert.NotNil(t, eng.stagedCompletion, "staged completion")
+	assert.Len(t, 1, eng.stagedCompletion.Stages, "stages")
+	stage := eng.stagedCompletion.Stages[0]
+	// Pure additions stage at their insertion point, right after the last line
+	assert.Equal(t, len(buf.lines)+1, stage.BufferStart, "stage BufferStart")
+	assert.Equal(t, len(buf.lines)+1, stage.BufferEnd, "stage BufferEnd")
+	assert.Equal(t, []string{"", "func g() {}"}, buf.lastPreparedCompletion.lines, "appended lines")
+}
+
+func TestProcessCompletion_PastEOFRejectedByPolicy(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"func f() {", "}"}
+	buf.row = 2
+	prov := newMockProvider()
+	clock := newMockClock()
+	eng := createTestEngine(buf, prov, clock)
+	eng.config.EOFPolicy = EOFReject
+
+	shown := eng.processCompletion(&types.Completion{
+		StartLine:  2,
+		EndLineInc: 3,
+		Lines:      []string{"}", "x"},
+	})
+
+	assert.False(t, shown, "completion not shown")
+	assert.Equal(t, 0, buf.prepareCompletionCalls, "nothing prepared")
+}
+
+func TestProcessCompletion_CrossingCodeFenceRejected(t *testing.T) {
+	buf := newMockBuffer()
+	buf.path = "README.md"
+	buf.lines = []string{"Intro.", "```go", "x := 1", "```", "Outro."}
+	buf.row = 3
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	shown := eng.processCompletion(&types.Completion{
+		StartLine:  3,
+		EndLineInc: 5,
+		Lines:      []string{"x := 2", "```", "More prose."},
+	})
+
+	assert.False(t, shown, "completion not shown")
+	assert.Equal(t, 0, buf.prepareCompletionCalls, "nothing prepared")
+
+	shown = eng.processCompletion(&types.Completion{
+		StartLine:  3,
+		EndLineInc: 3,
+		Lines:      []string{"x := 2"},
+	})
+
+	assert.True(t, shown, "completion inside fence shown")
+}
+
+func TestFenceLanguage(t *testing.T) {
+	lines := []string{"Intro.", "```{python}", "x = 1", "```"}
+	assert.Equal(t, "python", fenceLanguage("notes.qmd", lines, 3), "inside fence")
+	assert.Equal(t, "", fenceLanguage("notes.qmd", lines, 1), "prose")
+	assert.Equal(t, "", fenceLanguage("notes.txt", lines, 3), "not markdown")
+}
+
+func TestProcessCompletion_EmptyReplacementDeletesRange(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"keep", "drop 1", "drop 2", "keep"}
+	buf.row = 2
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	shown := eng.processCompletion(&types.Completion{
+		StartLine:  2,
+		EndLineInc: 3,
+		Lines:      []string{},
+	})
+
+	assert.True(t, shown, "completion shown")
+	assert.Equal(t, 2, buf.lastPreparedCompletion.startLine, "prepared start")
+	assert.Equal(t, 3, buf.lastPreparedCompletion.endLineInc, "prepared end")
+	assert.Len(t, 0, buf.lastPreparedCompletion.lines, "prepared lines")
+	assert.Len(t, 1, eng.currentGroups, "groups")
+	assert.Equal(t, "deletion", eng.currentGroups[0].Type, "group type")
+	assert.Equal(t, 2, eng.currentGroups[0].BufferLine, "group buffer line")
+}
+
+func newCursorOnlyEngine(t *testing.T) (*Engine, *mockBuffer) {
+	t.Helper()
+	buf := newMockBuffer()
+	buf.lines = make([]string, 20)
+	buf.row = 1
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), newMockClock())
+	t.Cleanup(cancel)
+	eng.config.CursorPrediction.CursorOnly = true
+	return eng, buf
+}
+
+func TestCursorOnlyPrediction_ShownFromIdle(t *testing.T) {
+	eng, buf := newCursorOnlyEngine(t)
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{
+		CursorTarget: &types.CursorPredictionTarget{LineNumber: 15},
+		MetricsInfo:  &types.MetricsInfo{ID: "jump-1"},
+	})
+
+	assert.Equal(t, stateHasCursorTarget, eng.state, "state")
+	assert.Equal(t, 15, buf.showCursorTargetLine, "jump indicator line")
+	assert.Equal(t, 1, eng.Stats().Jumps.Shown, "jump shown")
+	assert.Equal(t, 0, eng.Stats().Shown, "not counted as completion")
+
+	eng.acceptCursorTarget()
+
+	assert.Equal(t, 15, buf.row, "cursor moved")
+	assert.Equal(t, stateIdle, eng.state, "idle after jump")
+	assert.Equal(t, 1, eng.Stats().Jumps.Accepted, "jump accepted")
+}
+
+func TestCursorOnlyPrediction_RejectCounted(t *testing.T) {
+	eng, _ := newCursorOnlyEngine(t)
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{
+		CursorTarget: &types.CursorPredictionTarget{LineNumber: 15},
+		MetricsInfo:  &types.MetricsInfo{ID: "jump-1"},
+	})
+	eng.reject()
+
+	assert.Equal(t, 1, eng.Stats().Jumps.Rejected, "jump rejected")
+	assert.Equal(t, 0, eng.Stats().Rejected, "not counted as completion")
+}
+
+func TestCursorOnlyPrediction_OtherFile(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = make([]string, 20)
+	buf.row = 1
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), newMockClock())
+	defer cancel()
+	eng.config.CursorPrediction.CursorOnly = true
+	buf.files = map[string][]string{"other.go": {"package other", "", "func f() {}"}}
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{
+		CursorTarget: &types.CursorPredictionTarget{LineNumber: 3, RelativePath: "other.go"},
+		MetricsInfo:  &types.MetricsInfo{ID: "jump-1"},
+	})
+
+	assert.Equal(t, stateHasCursorTarget, eng.state, "state")
+	assert.Equal(t, "other.go", buf.showFileTargetPath, "jump target file")
+	assert.Equal(t, 3, buf.showFileTargetLine, "jump target line")
+	assert.Equal(t, 1, eng.Stats().Jumps.Shown, "jump shown")
+
+	eng.acceptCursorTarget()
+
+	assert.Equal(t, "other.go", buf.path, "file opened")
+	assert.Equal(t, 3, buf.row, "cursor on target line")
+	assert.Equal(t, 1, eng.Stats().Jumps.Accepted, "jump accepted")
+	assert.Equal(t, statePendingCompletion, eng.state, "completion requested in the new file")
+}
+
+func TestCursorOnlyPrediction_OtherFileMissing(t *testing.T) {
+	eng, buf := newCursorOnlyEngine(t)
+	buf.files = map[string][]string{}
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{
+		CursorTarget: &types.CursorPredictionTarget{LineNumber: 3, RelativePath: "gone.go"},
+	})
+	eng.acceptCursorTarget()
+
+	assert.Equal(t, stateIdle, eng.state, "state")
+	assert.Nil(t, eng.cursorTarget, "target cleared")
+}
+
+func TestCursorOnlyPrediction_OtherFileOutsideWorkspace(t *testing.T) {
+	eng, buf := newCursorOnlyEngine(t)
+	buf.files = map[string][]string{"../secrets.env": {"a", "b", "c"}}
+	eng.cursorTarget = &types.CursorPredictionTarget{LineNumber: 3, RelativePath: "../secrets.env"}
+	eng.state = stateHasCursorTarget
+
+	eng.acceptCrossFileTarget()
+
+	assert.Equal(t, "test.go", buf.path, "file not opened")
+	assert.Equal(t, stateIdle, eng.state, "state")
+}
+
+func TestCursorOnlyPrediction_Ignored(t *testing.T) {
+	tests := []struct {
+		name       string
+		cursorOnly bool
+		target     types.CursorPredictionTarget
+	}{
+		{"disabled", false, types.CursorPredictionTarget{LineNumber: 15}},
+		{"within proximity", true, types.CursorPredictionTarget{LineNumber: 3}},
+		{"past end of buffer", true, types.CursorPredictionTarget{LineNumber: 40}},
+		{"other file without line", true, types.CursorPredictionTarget{RelativePath: "other.go"}},
+		{"other file outside the workspace", true, types.CursorPredictionTarget{RelativePath: "../secrets.env", LineNumber: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng, buf := newCursorOnlyEngine(t)
+			eng.config.CursorPrediction.CursorOnly = tt.cursorOnly
+
+			eng.handleCompletionReadyImpl(&types.CompletionResponse{CursorTarget: &tt.target})
+
+			assert.Equal(t, stateIdle, eng.state, "state")
+			assert.Equal(t, 0, buf.showCursorTargetLine, "no jump indicator")
+		})
+	}
+}
+
+func TestTypedAsSuggested_ShrinksCompletionInPlace(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"foo(", ""}
+	prov := newMockProvider()
+	clock := newMockClock()
+	eng := createTestEngine(buf, prov, clock)
+
+	eng.state = stateHasCompletion
+	eng.completions = []*types.Completion{{
+		StartLine:  1,
+		EndLineInc: 2,
+		Lines:      []string{"foo(a, b)", "bar()"},
+	}}
+	eng.completionOriginalLines = []string{"foo", ""}
+	eng.currentGroups = []*text.Group{{Type: "modification", StartLine: 1, EndLine: 2, BufferLine: 1}}
+
+	eng.handleEvent(Event{Type: EventTextChanged})
+
+	assert.Equal(t, stateHasCompletion, eng.state, "completion kept")
+	assert.Equal(t, 0, prov.completionCalls, "no new request")
+	assert.Equal(t, 1, buf.prepareCompletionCalls, "completion re-rendered")
+	assert.Equal(t, []string{"foo", ""}, eng.completionOriginalLines, "original lines kept")
+	assert.Greater(t, len(eng.currentGroups), 0, "groups of the remaining text")
+
+	buf.lines = []string{"fo", ""}
+	eng.handleEvent(Event{Type: EventTextChanged})
+	assert.Equal(t, stateIdle, eng.state, "backspacing past the original rejects")
+}
+
+func TestTypedAsSuggested_AppendCharsLeftToEditor(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"hello wo"}
+	prov := newMockProvider()
+	clock := newMockClock()
+	eng := createTestEngine(buf, prov, clock)
+
+	eng.state = stateHasCompletion
+	eng.completions = []*types.Completion{{
+		StartLine:  1,
+		EndLineInc: 1,
+		Lines:      []string{"hello world"},
+	}}
+	eng.completionOriginalLines = []string{"hello "}
+	eng.currentGroups = []*text.Group{{Type: "modification", StartLine: 1, EndLine: 1, BufferLine: 1, RenderHint: "append_chars"}}
+
+	eng.handleEvent(Event{Type: EventTextChanged})
+
+	assert.Equal(t, stateHasCompletion, eng.state, "completion kept")
+	assert.Equal(t, 0, buf.prepareCompletionCalls, "editor shrinks append_chars ghost text")
+}
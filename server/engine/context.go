@@ -3,6 +3,7 @@ package engine
 import (
 	"sort"
 
+	"cursortab/ignore"
 	"cursortab/logger"
 	"cursortab/types"
 	"cursortab/utils"
@@ -32,9 +33,22 @@ func (e *Engine) newFileStateFromBuffer() *FileState {
 	}
 }
 
+// SetIgnoreRules keeps files matched by rules out of the context sent to
+// providers: their edit history and contents are never stored or sent.
+func (e *Engine) SetIgnoreRules(rules *ignore.Rules) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ignore = rules
+	for path := range e.fileStateStore {
+		if rules.Match(path) {
+			delete(e.fileStateStore, path)
+		}
+	}
+}
+
 // saveCurrentFileState saves the current buffer state to the file state store
 func (e *Engine) saveCurrentFileState() {
-	if e.buffer.Path() == "" {
+	if e.buffer.Path() == "" || e.ignore.Match(e.buffer.Path()) {
 		return
 	}
 
@@ -42,7 +56,7 @@ func (e *Engine) saveCurrentFileState() {
 	// Capture first lines for FileChunks context
 	state.FirstLines = copyFirstN(e.buffer.Lines(), e.contextLimits.FileChunkLines)
 	e.fileStateStore[e.buffer.Path()] = state
-	e.trimFileStateStore(3) // Keep at most 3 files for FileChunks
+	e.trimFileStateStore(3) // Keep at most 3 files per project for FileChunks
 }
 
 // handleFileSwitch manages file state when switching between files.
@@ -51,7 +65,7 @@ func (e *Engine) handleFileSwitch(oldPath, newPath string, currentLines []string
 		return false
 	}
 
-	if oldPath != "" {
+	if oldPath != "" && !e.ignore.Match(oldPath) {
 		state := e.newFileStateFromBuffer()
 		// Capture first lines for FileChunks context
 		state.FirstLines = copyFirstN(currentLines, e.contextLimits.FileChunkLines)
@@ -107,7 +121,8 @@ func (e *Engine) isFileStateValid(state *FileState, currentLines []string) bool
 	return mismatches <= len(checkIndices)/2
 }
 
-// trimFileStateStore keeps only the most recently accessed maxFiles files
+// trimFileStateStore keeps only the most recently accessed maxFiles files of
+// each project
 func (e *Engine) trimFileStateStore(maxFiles int) {
 	if len(e.fileStateStore) <= maxFiles {
 		return
@@ -127,22 +142,28 @@ func (e *Engine) trimFileStateStore(maxFiles int) {
 		return entries[i].state.LastAccessNs > entries[j].state.LastAccessNs
 	})
 
+	// Each project keeps its own most recent files
+	kept := make(map[string]int)
 	e.fileStateStore = make(map[string]*FileState)
-	for i := 0; i < maxFiles && i < len(entries); i++ {
-		e.fileStateStore[entries[i].path] = entries[i].state
+	for _, entry := range entries {
+		root := e.rootOf(entry.path)
+		if kept[root] < maxFiles {
+			e.fileStateStore[entry.path] = entry.state
+			kept[root]++
+		}
 	}
 }
 
 // getAllFileDiffHistories returns diff history for the current file only.
 func (e *Engine) getAllFileDiffHistories() []*types.FileDiffHistory {
-	if e.buffer.Path() == "" || len(e.buffer.DiffHistories()) == 0 {
+	if e.buffer.Path() == "" || len(e.buffer.DiffHistories()) == 0 || e.ignore.Match(e.buffer.Path()) {
 		return nil
 	}
 
 	diffs := copyDiffs(e.buffer.DiffHistories())
 
 	if e.config.MaxDiffTokens > 0 {
-		diffs = utils.TrimDiffEntries(diffs, e.config.MaxDiffTokens)
+		diffs = utils.TrimDiffEntries(diffs, e.config.MaxDiffTokens, e.config.Tokenizer)
 	}
 
 	if len(diffs) == 0 {
@@ -187,31 +208,43 @@ func copyFirstN(lines []string, n int) []string {
 }
 
 // getRecentBufferSnapshots returns up to limit recent buffer snapshots
-// excluding the current file, sorted by most recently accessed
+// excluding the current file, sorted by most recently accessed. Buffers still
+// open in the editor are snapshotted from their current content.
 func (e *Engine) getRecentBufferSnapshots(excludePath string, limit int) []*types.RecentBufferSnapshot {
 	type entry struct {
-		path  string
-		state *FileState
+		lines    []string
+		accessNs int64
 	}
 
-	var entries []entry
+	entries := make(map[string]entry)
 	for path, state := range e.fileStateStore {
-		if path != excludePath && len(state.FirstLines) > 0 {
-			entries = append(entries, entry{path, state})
+		entries[path] = entry{state.FirstLines, state.LastAccessNs}
+	}
+	for path, buf := range e.openBuffers {
+		accessNs := max(buf.accessNs, entries[path].accessNs)
+		entries[path] = entry{copyFirstN(buf.lines, e.contextLimits.FileChunkLines), accessNs}
+	}
+
+	// Only files of the current buffer's project are relevant
+	root := e.projectRoot()
+	var paths []string
+	for path, entry := range entries {
+		if path != excludePath && len(entry.lines) > 0 && !e.ignore.Match(path) && e.rootOf(path) == root {
+			paths = append(paths, path)
 		}
 	}
 
-	// Sort by LastAccessNs descending (most recent first)
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].state.LastAccessNs > entries[j].state.LastAccessNs
+	// Sort by access time descending (most recent first)
+	sort.Slice(paths, func(i, j int) bool {
+		return entries[paths[i]].accessNs > entries[paths[j]].accessNs
 	})
 
 	var result []*types.RecentBufferSnapshot
-	for i := 0; i < limit && i < len(entries); i++ {
+	for i := 0; i < limit && i < len(paths); i++ {
 		result = append(result, &types.RecentBufferSnapshot{
-			FilePath:    entries[i].path,
-			Lines:       entries[i].state.FirstLines,
-			TimestampMs: entries[i].state.LastAccessNs / 1e6, // ns to ms
+			FilePath:    paths[i],
+			Lines:       entries[paths[i]].lines,
+			TimestampMs: entries[paths[i]].accessNs / 1e6, // ns to ms
 		})
 	}
 	return result
@@ -2,6 +2,10 @@ package engine
 
 import (
 	"cursortab/assert"
+	"cursortab/ignore"
+	"cursortab/types"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -74,3 +78,38 @@ func TestTrimFileStateStore(t *testing.T) {
 	_, existsE := eng.fileStateStore["e.go"]
 	assert.True(t, existsE, "should keep e.go (most recent)")
 }
+
+func TestIgnoreRules_KeepFilesOutOfContext(t *testing.T) {
+	buf := newMockBuffer()
+	buf.path = ".env"
+	buf.diffHistories = []*types.DiffEntry{{Original: "KEY=a", Updated: "KEY=b"}}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.fileStateStore["secrets/prod.yaml"] = &FileState{FirstLines: []string{"password: x"}}
+	eng.fileStateStore["main.go"] = &FileState{FirstLines: []string{"package main"}, OriginalLines: []string{"package main"}}
+
+	eng.SetIgnoreRules(ignore.Load(t.TempDir(), []string{".env", "secrets/"}, false))
+
+	assert.Nil(t, eng.fileStateStore["secrets/prod.yaml"], "stored ignored file dropped")
+	assert.Nil(t, eng.getAllFileDiffHistories(), "ignored file's diff history not sent")
+
+	eng.saveCurrentFileState()
+	assert.Nil(t, eng.fileStateStore[".env"], "ignored file state not stored")
+
+	eng.handleFileSwitch(".env", "main.go", []string{"package main"})
+	assert.Nil(t, eng.fileStateStore[".env"], "ignored file state not stored on switch")
+
+	snapshots := eng.getRecentBufferSnapshots("other.go", 5)
+	assert.Len(t, 1, snapshots, "only non-ignored snapshots")
+	assert.Equal(t, "main.go", snapshots[0].FilePath, "snapshot path")
+}
+
+func TestIgnoreRules_GitignoreFromWorkspace(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, ".gitignore"), []byte("vendor/\n"), 0o644), "write .gitignore")
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+	eng.fileStateStore["vendor/lib/lib.go"] = &FileState{FirstLines: []string{"package lib"}}
+
+	eng.SetIgnoreRules(ignore.Load(root, nil, true))
+
+	assert.Len(t, 0, eng.getRecentBufferSnapshots("test.go", 5), "gitignored snapshot excluded")
+}
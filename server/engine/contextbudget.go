@@ -0,0 +1,371 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+
+	"cursortab/types"
+	"cursortab/utils"
+)
+
+// ContextSource names a part of a request's context that the ContextBudgeter trims.
+type ContextSource string
+
+const (
+	ContextDiffHistory ContextSource = "diff_history" // Recent edits across files
+	ContextSnapshots   ContextSource = "snapshots"    // Recently visited files
+	ContextDiagnostics ContextSource = "diagnostics"  // LSP diagnostics of the current file
+	ContextGitDiff     ContextSource = "git_diff"     // Staged diff when writing a commit message
+	ContextGitHistory  ContextSource = "git_history"  // Latest commits of the current file and blame of the cursor region
+	ContextLSP         ContextSource = "lsp"          // Hover text and definitions of identifiers near the cursor
+	ContextRetrieval   ContextSource = "retrieval"    // Chunks of visited files sharing identifiers with the cursor context
+)
+
+// contextSources lists the sources in the order leftover budget is shared out.
+var contextSources = []ContextSource{ContextDiffHistory, ContextSnapshots, ContextDiagnostics, ContextGitDiff, ContextGitHistory, ContextLSP, ContextRetrieval}
+
+// DefaultContextWeights returns the share of the context budget each source
+// gets when the budget is too small for all of them.
+func DefaultContextWeights() map[ContextSource]float64 {
+	return map[ContextSource]float64{
+		ContextDiffHistory: 3,
+		ContextSnapshots:   2,
+		ContextDiagnostics: 2,
+		ContextGitDiff:     1,
+		ContextGitHistory:  1,
+		ContextLSP:         1,
+		ContextRetrieval:   1,
+	}
+}
+
+// ContextBudgeter shares a request-wide token budget across the context
+// sources by weight. The current file is never trimmed: the sources share
+// what it leaves of the budget, so a large git diff cannot crowd it out.
+// Sources needing less than their share give the rest to the others.
+type ContextBudgeter struct {
+	MaxTokens int                       // Tokens for the current file and its context (0 = no budget)
+	Weights   map[ContextSource]float64 // Sources missing here use DefaultContextWeights
+}
+
+// Apply returns req trimmed to the budget, or req itself when it fits.
+func (b ContextBudgeter) Apply(req *types.CompletionRequest) *types.CompletionRequest {
+	if b.MaxTokens <= 0 {
+		return req
+	}
+
+	return b.trim(req, max(utils.EstimateCharsFromTokens(b.MaxTokens)-linesChars(req.Lines), 0))
+}
+
+// trim returns req with its context sources sharing at most available chars
+// by weight, or req itself when they fit.
+func (b ContextBudgeter) trim(req *types.CompletionRequest, available int) *types.CompletionRequest {
+	sizes := make(map[ContextSource]int, len(contextSources))
+	total := 0
+	for _, src := range contextSources {
+		sizes[src] = contextChars(req, src)
+		total += sizes[src]
+	}
+	if total <= available {
+		return req
+	}
+
+	alloc := allocateContext(available, sizes, b.weights())
+	trimmed := *req
+	if req.AdditionalContext != nil {
+		additional := *req.AdditionalContext
+		trimmed.AdditionalContext = &additional
+	}
+	for _, src := range contextSources {
+		if alloc[src] < sizes[src] {
+			trimContext(&trimmed, src, alloc[src])
+		}
+	}
+	return &trimmed
+}
+
+func (b ContextBudgeter) weights() map[ContextSource]float64 {
+	weights := DefaultContextWeights()
+	for src, w := range b.Weights {
+		weights[src] = w
+	}
+	return weights
+}
+
+// allocateContext splits available chars across sources in proportion to
+// their weights. A source whose share exceeds its size gets its size, and the
+// remainder is split again among the others.
+func allocateContext(available int, sizes map[ContextSource]int, weights map[ContextSource]float64) map[ContextSource]int {
+	alloc := make(map[ContextSource]int, len(sizes))
+	var pending []ContextSource
+	for _, src := range contextSources {
+		if sizes[src] > 0 && weights[src] > 0 {
+			pending = append(pending, src)
+		}
+	}
+
+	for len(pending) > 0 {
+		totalWeight := 0.0
+		for _, src := range pending {
+			totalWeight += weights[src]
+		}
+		share := func(src ContextSource) int {
+			return int(float64(available) * weights[src] / totalWeight)
+		}
+
+		fits := slices.DeleteFunc(slices.Clone(pending), func(src ContextSource) bool {
+			return sizes[src] > share(src)
+		})
+		if len(fits) == 0 {
+			for _, src := range pending {
+				alloc[src] = share(src)
+			}
+			break
+		}
+		for _, src := range fits {
+			alloc[src] = sizes[src]
+			available -= sizes[src]
+		}
+		pending = slices.DeleteFunc(pending, func(src ContextSource) bool {
+			return slices.Contains(fits, src)
+		})
+	}
+	return alloc
+}
+
+// contextChars returns the size of a source in req.
+func contextChars(req *types.CompletionRequest, src ContextSource) int {
+	chars := 0
+	switch src {
+	case ContextDiffHistory:
+		for _, h := range req.FileDiffHistories {
+			for _, entry := range h.DiffHistory {
+				chars += diffEntryChars(entry)
+			}
+		}
+	case ContextSnapshots:
+		for _, s := range req.RecentBufferSnapshots {
+			chars += linesChars(s.Lines)
+		}
+	case ContextDiagnostics:
+		if diag := req.GetDiagnostics(); diag != nil {
+			for _, d := range diag.Errors {
+				chars += diagnosticChars(d)
+			}
+		}
+	case ContextGitDiff:
+		if req.AdditionalContext != nil && req.AdditionalContext.GitDiff != nil {
+			chars = len(req.AdditionalContext.GitDiff.Diff)
+		}
+	case ContextGitHistory:
+		if h := req.GetGitHistory(); h != nil {
+			chars = gitHistoryChars(h)
+		}
+	case ContextLSP:
+		if l := req.GetLSP(); l != nil {
+			for _, s := range l.Symbols {
+				chars += lspSymbolChars(s)
+			}
+		}
+	case ContextRetrieval:
+		for _, c := range req.RetrievalChunks {
+			chars += linesChars(c.Lines)
+		}
+	}
+	return chars
+}
+
+// trimContext reduces a source of req to at most budget chars.
+func trimContext(req *types.CompletionRequest, src ContextSource, budget int) {
+	switch src {
+	case ContextDiffHistory:
+		req.FileDiffHistories = trimDiffHistories(req.FileDiffHistories, req.FilePath, budget)
+	case ContextSnapshots:
+		req.RecentBufferSnapshots = trimSnapshots(req.RecentBufferSnapshots, budget)
+	case ContextDiagnostics:
+		diag := *req.AdditionalContext.Diagnostics
+		diag.Errors = trimDiagnostics(diag.Errors, req.CursorRow, budget)
+		req.AdditionalContext.Diagnostics = &diag
+	case ContextGitDiff:
+		req.AdditionalContext.GitDiff = &types.GitDiffContext{Diff: truncateAtLine(req.AdditionalContext.GitDiff.Diff, budget)}
+	case ContextGitHistory:
+		req.AdditionalContext.GitHistory = trimGitHistory(req.AdditionalContext.GitHistory, budget)
+	case ContextLSP:
+		req.AdditionalContext.LSP = &types.LSPContext{Symbols: trimLSPSymbols(req.AdditionalContext.LSP.Symbols, budget)}
+	case ContextRetrieval:
+		req.RetrievalChunks = trimRetrievalChunks(req.RetrievalChunks, budget)
+	}
+}
+
+// trimDiffHistories keeps the newest entries within budget, the current
+// file's history first.
+func trimDiffHistories(histories []*types.FileDiffHistory, currentFile string, budget int) []*types.FileDiffHistory {
+	order := slices.Clone(histories)
+	slices.SortStableFunc(order, func(a, b *types.FileDiffHistory) int {
+		if (a.FileName == currentFile) == (b.FileName == currentFile) {
+			return 0
+		}
+		if a.FileName == currentFile {
+			return -1
+		}
+		return 1
+	})
+
+	kept := make(map[*types.FileDiffHistory][]*types.DiffEntry, len(histories))
+	for _, h := range order {
+		start := len(h.DiffHistory)
+		for start > 0 && diffEntryChars(h.DiffHistory[start-1]) <= budget {
+			start--
+			budget -= diffEntryChars(h.DiffHistory[start])
+		}
+		kept[h] = h.DiffHistory[start:]
+	}
+
+	var result []*types.FileDiffHistory
+	for _, h := range histories {
+		if len(kept[h]) > 0 {
+			result = append(result, &types.FileDiffHistory{FileName: h.FileName, DiffHistory: kept[h]})
+		}
+	}
+	return result
+}
+
+// trimSnapshots keeps the most recent snapshots within budget, cutting the
+// lines of the last one that partly fits.
+func trimSnapshots(snapshots []*types.RecentBufferSnapshot, budget int) []*types.RecentBufferSnapshot {
+	var result []*types.RecentBufferSnapshot
+	for _, s := range snapshots {
+		n := 0
+		for n < len(s.Lines) && len(s.Lines[n])+1 <= budget {
+			budget -= len(s.Lines[n]) + 1
+			n++
+		}
+		if n == 0 {
+			break
+		}
+		snapshot := *s
+		snapshot.Lines = s.Lines[:n]
+		result = append(result, &snapshot)
+		if n < len(s.Lines) {
+			break
+		}
+	}
+	return result
+}
+
+// trimDiagnostics keeps the diagnostics nearest to cursorRow within budget,
+// in their original order.
+func trimDiagnostics(diags []*types.LinterError, cursorRow int, budget int) []*types.LinterError {
+	nearest := slices.Clone(diags)
+	slices.SortStableFunc(nearest, func(a, b *types.LinterError) int {
+		return diagnosticDistance(a, cursorRow) - diagnosticDistance(b, cursorRow)
+	})
+
+	keep := make(map[*types.LinterError]bool, len(diags))
+	for _, d := range nearest {
+		if diagnosticChars(d) > budget {
+			break
+		}
+		budget -= diagnosticChars(d)
+		keep[d] = true
+	}
+	return slices.DeleteFunc(slices.Clone(diags), func(d *types.LinterError) bool {
+		return !keep[d]
+	})
+}
+
+func diagnosticDistance(d *types.LinterError, cursorRow int) int {
+	if d.Range == nil {
+		return 0
+	}
+	return utils.Abs(d.Range.StartLine - cursorRow)
+}
+
+// truncateAtLine cuts s to at most budget bytes, at the end of a line.
+func truncateAtLine(s string, budget int) string {
+	if len(s) <= budget {
+		return s
+	}
+	cut := strings.LastIndexByte(s[:budget], '\n')
+	if cut < 0 {
+		return ""
+	}
+	return s[:cut+1]
+}
+
+// trimLSPSymbols keeps the symbols nearest the cursor within budget. Symbols
+// come nearest first.
+func trimLSPSymbols(symbols []*types.LSPSymbol, budget int) []*types.LSPSymbol {
+	n := 0
+	for n < len(symbols) && lspSymbolChars(symbols[n]) <= budget {
+		budget -= lspSymbolChars(symbols[n])
+		n++
+	}
+	return symbols[:n]
+}
+
+// trimRetrievalChunks keeps the best ranked chunks within budget. Chunks come
+// best first.
+func trimRetrievalChunks(chunks []*types.RetrievalChunk, budget int) []*types.RetrievalChunk {
+	n := 0
+	for n < len(chunks) && linesChars(chunks[n].Lines) <= budget {
+		budget -= linesChars(chunks[n].Lines)
+		n++
+	}
+	return chunks[:n]
+}
+
+// trimGitHistory keeps the blame of the cursor region within budget, then
+// the newest commits with what is left.
+func trimGitHistory(history *types.GitHistoryContext, budget int) *types.GitHistoryContext {
+	trimmed := &types.GitHistoryContext{}
+	for _, entry := range history.Blame {
+		if blameEntryChars(entry) > budget {
+			break
+		}
+		budget -= blameEntryChars(entry)
+		trimmed.Blame = append(trimmed.Blame, entry)
+	}
+	for _, commit := range history.Commits {
+		if len(commit) > budget {
+			break
+		}
+		budget -= len(commit)
+		trimmed.Commits = append(trimmed.Commits, commit)
+	}
+	return trimmed
+}
+
+func gitHistoryChars(history *types.GitHistoryContext) int {
+	chars := 0
+	for _, entry := range history.Blame {
+		chars += blameEntryChars(entry)
+	}
+	for _, commit := range history.Commits {
+		chars += len(commit)
+	}
+	return chars
+}
+
+func blameEntryChars(entry *types.BlameEntry) int {
+	return len(entry.Commit) + len(entry.Author) + len(entry.Summary)
+}
+
+func lspSymbolChars(s *types.LSPSymbol) int {
+	return len(s.Hover) + linesChars(s.Definition)
+}
+
+func diffEntryChars(entry *types.DiffEntry) int {
+	return len(entry.Original) + len(entry.Updated)
+}
+
+func diagnosticChars(d *types.LinterError) int {
+	return len(d.Message) + len(d.Source) + len(d.Severity)
+}
+
+func linesChars(lines []string) int {
+	chars := 0
+	for _, line := range lines {
+		chars += len(line) + 1
+	}
+	return chars
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestContextBudgeter_FitsUnchanged(t *testing.T) {
+	req := &types.CompletionRequest{
+		Lines:             []string{"package main"},
+		FileDiffHistories: []*types.FileDiffHistory{{FileName: "main.go", DiffHistory: []*types.DiffEntry{{Original: "a", Updated: "b"}}}},
+	}
+
+	assert.True(t, ContextBudgeter{}.Apply(req) == req, "no budget")
+	assert.True(t, ContextBudgeter{MaxTokens: 100}.Apply(req) == req, "within budget")
+}
+
+func TestContextBudgeter_LargeGitDiffDoesNotCrowdOutOthers(t *testing.T) {
+	diff := strings.Repeat("+added line\n", 1000)
+	history := []*types.DiffEntry{{Original: "x := 1", Updated: "x := 2"}}
+	req := &types.CompletionRequest{
+		FilePath:          "main.go",
+		Lines:             []string{strings.Repeat("a", 99)},
+		FileDiffHistories: []*types.FileDiffHistory{{FileName: "main.go", DiffHistory: history}},
+		AdditionalContext: &types.ContextResult{GitDiff: &types.GitDiffContext{Diff: diff}},
+	}
+
+	trimmed := ContextBudgeter{MaxTokens: 500}.Apply(req)
+
+	assert.Len(t, 1, trimmed.FileDiffHistories, "diff history kept")
+	gitDiff := trimmed.AdditionalContext.GitDiff.Diff
+	assert.LessOrEqual(t, len(gitDiff), 1000-100-12, "git diff gets what the file and history leave")
+	assert.True(t, strings.HasSuffix(gitDiff, "\n"), "cut at a line end")
+	assert.Equal(t, diff, req.AdditionalContext.GitDiff.Diff, "original request untouched")
+}
+
+func TestContextBudgeter_CurrentFileLeavesNoRoom(t *testing.T) {
+	req := &types.CompletionRequest{
+		FilePath:              "main.go",
+		Lines:                 []string{strings.Repeat("a", 200)},
+		RecentBufferSnapshots: []*types.RecentBufferSnapshot{{FilePath: "util.go", Lines: []string{"package util"}}},
+	}
+
+	trimmed := ContextBudgeter{MaxTokens: 50}.Apply(req)
+
+	assert.Equal(t, req.Lines, trimmed.Lines, "current file kept")
+	assert.Len(t, 0, trimmed.RecentBufferSnapshots, "snapshots dropped")
+}
+
+func TestAllocateContext(t *testing.T) {
+	weights := DefaultContextWeights()
+
+	alloc := allocateContext(600, map[ContextSource]int{
+		ContextDiffHistory: 1000,
+		ContextSnapshots:   1000,
+		ContextDiagnostics: 50,
+		ContextGitDiff:     1000,
+	}, weights)
+
+	assert.Equal(t, 50, alloc[ContextDiagnostics], "small source gets its size")
+	assert.Equal(t, 275, alloc[ContextDiffHistory], "diff history share of the rest")
+	assert.Equal(t, 183, alloc[ContextSnapshots], "snapshots share of the rest")
+	assert.Equal(t, 91, alloc[ContextGitDiff], "git diff share of the rest")
+}
+
+func TestAllocateContext_ZeroWeightDropsSource(t *testing.T) {
+	alloc := allocateContext(100, map[ContextSource]int{ContextDiffHistory: 500, ContextGitDiff: 500},
+		map[ContextSource]float64{ContextDiffHistory: 1, ContextGitDiff: 0})
+
+	assert.Equal(t, 100, alloc[ContextDiffHistory], "weighted source")
+	assert.Equal(t, 0, alloc[ContextGitDiff], "zero weight")
+}
+
+func TestTrimDiffHistories_KeepsNewestOfCurrentFileFirst(t *testing.T) {
+	histories := []*types.FileDiffHistory{
+		{FileName: "other.go", DiffHistory: []*types.DiffEntry{{Original: "o1", Updated: "o2"}}},
+		{FileName: "main.go", DiffHistory: []*types.DiffEntry{
+			{Original: "old", Updated: "er"},
+			{Original: "new", Updated: "er"},
+		}},
+	}
+
+	trimmed := trimDiffHistories(histories, "main.go", 6)
+
+	assert.Len(t, 1, trimmed, "only the current file fits")
+	assert.Equal(t, "main.go", trimmed[0].FileName, "file")
+	assert.Len(t, 1, trimmed[0].DiffHistory, "entries")
+	assert.Equal(t, "new", trimmed[0].DiffHistory[0].Original, "newest entry kept")
+}
+
+func TestTrimDiagnostics_KeepsNearestInOrder(t *testing.T) {
+	diag := func(line int) *types.LinterError {
+		return &types.LinterError{Message: "unused", Range: &types.CursorRange{StartLine: line}}
+	}
+	diags := []*types.LinterError{diag(1), diag(40), diag(12), diag(9)}
+
+	kept := trimDiagnostics(diags, 10, 12)
+
+	assert.Equal(t, []*types.LinterError{diags[2], diags[3]}, kept, "two nearest, original order")
+}
+
+func TestTrimLSPSymbols_KeepsNearest(t *testing.T) {
+	symbols := []*types.LSPSymbol{
+		{Name: "near", Hover: "func near()"},
+		{Name: "far", Hover: "func far(a, b int)"},
+	}
+
+	kept := trimLSPSymbols(symbols, 15)
+
+	assert.Len(t, 1, kept, "kept")
+	assert.Equal(t, "near", kept[0].Name, "nearest first")
+}
+
+func TestTrimRetrievalChunks_KeepsBestRanked(t *testing.T) {
+	chunks := []*types.RetrievalChunk{
+		{FilePath: "best.go", Lines: []string{"func best() {}"}},
+		{FilePath: "next.go", Lines: []string{"func next() {}"}},
+	}
+
+	kept := trimRetrievalChunks(chunks, 20)
+
+	assert.Len(t, 1, kept, "kept")
+	assert.Equal(t, "best.go", kept[0].FilePath, "best first")
+}
+
+func TestTrimGitHistory_KeepsBlameThenNewestCommits(t *testing.T) {
+	history := &types.GitHistoryContext{
+		Commits: []string{"a1b2c3d Rename fetch to load", "e4f5a6b Add loader"},
+		Blame:   []*types.BlameEntry{{StartLine: 4, EndLine: 6, Commit: "a1b2c3d", Author: "Ada", Summary: "Rename fetch to load"}},
+	}
+
+	kept := trimGitHistory(history, 60)
+
+	assert.Len(t, 1, kept.Blame, "blame kept first")
+	assert.Equal(t, []string{"a1b2c3d Rename fetch to load"}, kept.Commits, "newest commit in what is left")
+	assert.Len(t, 2, history.Commits, "original untouched")
+}
@@ -0,0 +1,33 @@
+package engine
+
+import "cursortab/types"
+
+// cycleSuggestion replaces the shown completion with the next (step 1) or
+// previous (step -1) candidate of the same response, skipping candidates
+// without changes. Completions spanning several files are not cycled.
+func (e *Engine) cycleSuggestion(step int) {
+	if len(e.candidates) < 2 || e.multiFile != nil {
+		return
+	}
+
+	candidates := e.candidates
+	n := len(candidates)
+	for i := 1; i <= n; i++ {
+		idx := ((e.candidateIdx+step*i)%n + n) % n
+		e.buffer.ClearUI()
+		e.clearState(ClearOptions{ClearStaged: true, ClearCursorTarget: true})
+		if e.processCompletion(candidates[idx]) {
+			e.candidates = candidates
+			e.candidateIdx = idx
+			return
+		}
+	}
+	e.state = stateIdle
+}
+
+// setCandidates records the completions of a response for cycling, with the
+// first one shown.
+func (e *Engine) setCandidates(completions []*types.Completion) {
+	e.candidates = completions
+	e.candidateIdx = 0
+}
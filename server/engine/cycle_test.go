@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestCycleSuggestion(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"x := 1", "y := 2"}
+	buf.row = 1
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 1, EndLineInc: 1, Lines: []string{"x := 10"}},
+		{StartLine: 1, EndLineInc: 1, Lines: []string{"x := 1"}}, // no change, skipped
+		{StartLine: 1, EndLineInc: 1, Lines: []string{"x := 30"}},
+	}})
+	assert.Equal(t, "x := 10", eng.completions[0].Lines[0], "first candidate shown")
+
+	eng.handleEvent(Event{Type: EventNextSuggestion})
+	assert.Equal(t, stateHasCompletion, eng.state, "still showing")
+	assert.Equal(t, "x := 30", eng.completions[0].Lines[0], "next candidate with changes")
+
+	eng.handleEvent(Event{Type: EventNextSuggestion})
+	assert.Equal(t, "x := 10", eng.completions[0].Lines[0], "wraps around")
+
+	eng.handleEvent(Event{Type: EventPrevSuggestion})
+	assert.Equal(t, "x := 30", eng.completions[0].Lines[0], "previous wraps around")
+
+	eng.handleEvent(Event{Type: EventEsc})
+	assert.Nil(t, eng.candidates, "candidates dropped on reject")
+}
+
+func TestCycleSuggestion_SingleCandidate(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"x := 1"}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 1, EndLineInc: 1, Lines: []string{"x := 10"}},
+	}})
+	eng.handleEvent(Event{Type: EventNextSuggestion})
+
+	assert.Equal(t, stateHasCompletion, eng.state, "completion kept")
+	assert.Equal(t, "x := 10", eng.completions[0].Lines[0], "same completion")
+}
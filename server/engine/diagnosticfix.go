@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"fmt"
+
+	"cursortab/types"
+	"cursortab/utils"
+)
+
+// errorSeverity is the severity of LSP errors in LinterError.
+const errorSeverity = "DIAGNOSTIC_SEVERITY_ERROR"
+
+// errorAtCursor returns the LSP error on the cursor line of req nearest to
+// the cursor column, or nil if there is none.
+func errorAtCursor(req *types.CompletionRequest) *types.LinterError {
+	diags := req.GetDiagnostics()
+	if diags == nil {
+		return nil
+	}
+	var nearest *types.LinterError
+	for _, d := range diags.Errors {
+		if d.Severity != errorSeverity || d.Range == nil || d.Range.StartLine > req.CursorRow || d.Range.EndLine < req.CursorRow {
+			continue
+		}
+		if nearest == nil || utils.Abs(d.Range.StartCharacter-req.CursorCol) < utils.Abs(nearest.Range.StartCharacter-req.CursorCol) {
+			nearest = d
+		}
+	}
+	return nearest
+}
+
+// fixDiagnostic turns req into a quick fix of the LSP error on its cursor
+// line, if any: the error becomes the instruction of the request and its
+// cursor moves to where the error starts.
+func fixDiagnostic(req *types.CompletionRequest) {
+	diag := errorAtCursor(req)
+	if diag == nil || diag.Range.StartLine < 1 || diag.Range.StartLine > len(req.Lines) {
+		return
+	}
+
+	req.Source = types.CompletionSourceDiagnostics
+	req.Instruction = fmt.Sprintf("Fix the error on line %d: %s", diag.Range.StartLine, diag.Message)
+	if diag.Source != "" {
+		req.Instruction += fmt.Sprintf(" (%s)", diag.Source)
+	}
+	req.CursorRow = diag.Range.StartLine
+	req.CursorCol = min(diag.Range.StartCharacter, len(req.Lines[req.CursorRow-1]))
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func diagnostic(severity string, line, startCol int, message string) *types.LinterError {
+	return &types.LinterError{
+		Message:  message,
+		Source:   "gopls",
+		Severity: severity,
+		Range:    &types.CursorRange{StartLine: line, StartCharacter: startCol, EndLine: line, EndCharacter: startCol + 3},
+	}
+}
+
+func TestFixDiagnostic_ErrorOnCursorLine(t *testing.T) {
+	req := &types.CompletionRequest{
+		Source:    types.CompletionSourceIdle,
+		Lines:     []string{"package main", "", "x := fooo()", "y := 1"},
+		CursorRow: 3,
+		CursorCol: 0,
+		AdditionalContext: &types.ContextResult{Diagnostics: &types.LinterErrors{Errors: []*types.LinterError{
+			diagnostic("DIAGNOSTIC_SEVERITY_WARNING", 3, 0, "x declared and not used"),
+			diagnostic(errorSeverity, 4, 0, "y declared and not used"),
+			diagnostic(errorSeverity, 3, 5, "undefined: fooo"),
+		}}},
+	}
+
+	fixDiagnostic(req)
+
+	assert.Equal(t, types.CompletionSourceDiagnostics, req.Source, "source")
+	assert.Equal(t, "Fix the error on line 3: undefined: fooo (gopls)", req.Instruction, "instruction")
+	assert.Equal(t, 3, req.CursorRow, "row")
+	assert.Equal(t, 5, req.CursorCol, "cursor moved to the error")
+}
+
+func TestFixDiagnostic_NearestErrorToCursor(t *testing.T) {
+	req := &types.CompletionRequest{
+		Lines:     []string{"a := fooo(barr)"},
+		CursorRow: 1,
+		CursorCol: 12,
+		AdditionalContext: &types.ContextResult{Diagnostics: &types.LinterErrors{Errors: []*types.LinterError{
+			diagnostic(errorSeverity, 1, 5, "undefined: fooo"),
+			diagnostic(errorSeverity, 1, 10, "undefined: barr"),
+		}}},
+	}
+
+	fixDiagnostic(req)
+
+	assert.Contains(t, req.Instruction, "undefined: barr", "nearest error")
+	assert.Equal(t, 10, req.CursorCol, "cursor col")
+}
+
+func TestFixDiagnostic_NoErrorOnCursorLine(t *testing.T) {
+	req := &types.CompletionRequest{
+		Source:    types.CompletionSourceIdle,
+		Lines:     []string{"x := 1", "y := fooo()"},
+		CursorRow: 1,
+		CursorCol: 2,
+		AdditionalContext: &types.ContextResult{Diagnostics: &types.LinterErrors{Errors: []*types.LinterError{
+			diagnostic(errorSeverity, 2, 5, "undefined: fooo"),
+		}}},
+	}
+
+	fixDiagnostic(req)
+
+	assert.Equal(t, types.CompletionSourceIdle, req.Source, "source unchanged")
+	assert.Equal(t, "", req.Instruction, "no instruction")
+	assert.Equal(t, 2, req.CursorCol, "cursor unchanged")
+}
@@ -0,0 +1,44 @@
+package engine
+
+import "cursortab/logger"
+
+// pipelineEvents are the events that lead to a request or show a completion.
+var pipelineEvents = map[EventType]bool{
+	EventTextChanged:       true,
+	EventTextChangeTimeout: true,
+	EventManualTrigger:     true,
+	EventCursorMoved:       true,
+	EventInsertEnter:       true,
+	EventIdleTimeout:       true,
+	EventScanTimeout:       true,
+}
+
+// skipIneligibleBuffer swallows pipeline events while the current buffer gets
+// no completions (help, terminal and unmodifiable buffers, or one over the
+// size cap). The buffer is synced again first, so the events go through as
+// soon as the user switches to a buffer that gets completions.
+func (e *Engine) skipIneligibleBuffer(event Event) bool {
+	if !pipelineEvents[event.Type] || e.buffer.Ineligible() == "" {
+		return false
+	}
+	e.syncBuffer()
+	if !e.bufferIneligible() {
+		return false
+	}
+	if e.state != stateIdle {
+		e.suspend()
+	}
+	return true
+}
+
+// bufferIneligible reports whether the buffer of the last sync gets no
+// completions. Requests check it after syncing, which catches a switch to
+// such a buffer before any event was swallowed.
+func (e *Engine) bufferIneligible() bool {
+	reason := e.buffer.Ineligible()
+	if reason == "" {
+		return false
+	}
+	logger.Debug("no completions for %q: %s", e.buffer.Path(), reason)
+	return true
+}
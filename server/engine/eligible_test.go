@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"cursortab/assert"
+	"cursortab/types"
+	"testing"
+)
+
+func TestIneligibleBuffer_SwallowsPipelineEvents(t *testing.T) {
+	buf := newMockBuffer()
+	buf.ineligible = "buftype is help"
+	prov := newMockProvider()
+	eng := createTestEngine(buf, prov, newMockClock())
+	eng.state = stateHasCompletion
+	eng.completions = []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"test"}}}
+
+	eng.handleEvent(Event{Type: EventManualTrigger})
+
+	assert.Equal(t, stateIdle, eng.state, "shown completion dropped")
+	assert.Nil(t, eng.completions, "completions cleared")
+	assert.Equal(t, 0, prov.completionCalls, "no request")
+	assert.Equal(t, 1, buf.syncCalls, "synced again in case the buffer changed")
+}
+
+func TestIneligibleBuffer_EventsPassOnceEligible(t *testing.T) {
+	buf := newMockBuffer()
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	assert.False(t, eng.skipIneligibleBuffer(Event{Type: EventManualTrigger}), "eligible buffer")
+	assert.Equal(t, 0, buf.syncCalls, "no sync for an eligible buffer")
+
+	buf.ineligible = "not modifiable"
+	assert.True(t, eng.skipIneligibleBuffer(Event{Type: EventTextChanged}), "ineligible buffer")
+	assert.False(t, eng.skipIneligibleBuffer(Event{Type: EventEsc}), "other events pass")
+
+	buf.ineligible = ""
+	assert.False(t, eng.skipIneligibleBuffer(Event{Type: EventTextChanged}), "passes after switching")
+}
+
+func TestIneligibleBuffer_RequestSkipped(t *testing.T) {
+	buf := newMockBuffer()
+	buf.ineligible = "larger than 1024 bytes"
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	assert.False(t, eng.sendCompletionRequest(&types.CompletionRequest{}), "request skipped")
+	assert.False(t, eng.requestPrefetch(types.CompletionSourceTyping, 2, 0), "prefetch skipped")
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
 	"cursortab/buffer"
 	"cursortab/ctx"
+	"cursortab/ignore"
 	"cursortab/logger"
 	"cursortab/metrics"
+	"cursortab/quality"
+	"cursortab/redact"
+	"cursortab/retrieval"
 	"cursortab/text"
 	"cursortab/types"
 )
@@ -40,7 +45,7 @@ func (systemClock) Now() time.Time {
 }
 
 type Engine struct {
-	WorkspacePath string
+	WorkspacePath string // Directory the daemon was started in; buffer paths are relative to it
 	WorkspaceID   string
 
 	provider        Provider
@@ -51,7 +56,9 @@ type Engine struct {
 	currentCancel   context.CancelFunc
 	prefetchCancel  context.CancelFunc
 	idleTimer       Timer
+	scanTimer       Timer
 	textChangeTimer Timer
+	displayTimer    Timer
 	mu              sync.RWMutex
 	eventChan       chan Event
 
@@ -63,11 +70,55 @@ type Engine struct {
 
 	// Completion state
 	completions  []*types.Completion
+	candidates   []*types.Completion // Alternatives of the shown completion, for cycling
+	candidateIdx int                 // Index of the shown completion in candidates
 	applyBatch   buffer.Batch
 	cursorTarget *types.CursorPredictionTarget
+	targetView   targetView      // Jump indicator last rendered, for scroll handling
+	targetQueue  []*queuedTarget // Next-edit locations predicted by the provider, the shown one first
 
 	// Staged completion state (for multi-stage completions)
 	stagedCompletion *text.StagedCompletion
+	multiFile        *text.MultiFileStagedCompletion // Set while a completion spans several files
+
+	// Rename propagation state
+	acceptedRename    *text.Rename // Identifier renamed by the stages accepted so far
+	propagatingRename bool         // The staged completion renames the other occurrences
+	renameSearch      *text.Rename // Rename whose workspace search is in flight
+
+	// Placeholders of the stage accepted last, in buffer coordinates
+	placeholders []text.Placeholder
+
+	// The shown completion is dimmed because the cursor moved off it (see StickyLines)
+	completionDimmed bool
+
+	// The shown completion only appends text at the cursor, and is accepted by
+	// inserting it (see showInlineInsertion)
+	inlineInsertion bool
+
+	// The buffer was only edited outside the shown completion, which was
+	// re-based past the edit (see rebasePending)
+	editedOutside bool
+
+	// Auto-import state
+	importSpan    *text.LineRange // Lines of the stages accepted so far, checked for missing imports
+	addingImports bool            // The staged completion adds missing imports
+
+	// Inputs the last shown completion was staged from (for TuneStaging)
+	lastStaging *stagingInput
+
+	// Idle scan in flight, with the cancel func of its requests
+	scan       *idleScan
+	scanCancel context.CancelFunc
+
+	// Custom context sources added with RegisterInjector, the chunks of their
+	// last collection and whether one is running
+	injectors []ContextInjector
+	injected  injectedChunks
+	injecting bool
+
+	// Treesitter scopes of the last request, kept whole when staging
+	scopes []text.LineRange
 
 	// Original buffer lines when completion was shown (for partial typing optimization)
 	completionOriginalLines []string
@@ -79,6 +130,11 @@ type Engine struct {
 	prefetchedCompletions  []*types.Completion
 	prefetchedCursorTarget *types.CursorPredictionTarget
 	prefetchState          prefetchState
+	prefetchLines          []string                  // Buffer content the prefetch was requested against
+	prefetchRegions        []regionHash              // Regions of prefetchLines the prefetched completions replace
+	prefetchResp           *types.CompletionResponse // Last prefetch response, where speculation starts
+	speculative            []*speculativePrefetch    // Completions beyond the prefetch, up to PrefetchDepth-1
+	speculativeCancel      context.CancelFunc
 
 	// Streaming state (line-by-line)
 	streamingState          *StreamingState
@@ -98,6 +154,22 @@ type Engine struct {
 	inInsertMode      bool
 	manuallyTriggered bool
 
+	// Offline mode: set while the provider is unreachable, idle completions pause
+	offline           bool
+	offlineTimer      Timer       // Runs the next connectivity probe
+	connectivityProbe HealthCheck // nil: only a successful request ends offline mode
+
+	// Kill switch: when set, all user and timer events are dropped
+	disabled bool
+
+	// Workspace trust: when set, events are dropped like with the kill switch
+	untrusted bool
+
+	// Display TTL: displayedItem identifies what the running displayTimer was armed for,
+	// displayGen invalidates expiry events from timers that were since replaced
+	displayedItem any
+	displayGen    int
+
 	// Config options
 	config        EngineConfig
 	contextLimits ContextLimits
@@ -105,15 +177,54 @@ type Engine struct {
 	// Per-file state that persists across file switches (for context restoration)
 	fileStateStore map[string]*FileState
 
+	// Copies of the buffers open in the editor, kept by UpdateBuffer
+	openBuffers map[string]*openBuffer
+
+	// Instruction comment of the last request, removed once its completion is accepted
+	instruction *instructionComment
+
+	// The last paste, until the paste policy made its request or a typed edit followed it
+	pasted *pastedLines
+
 	// User action tracking for RecentUserActions
-	userActions      []*types.UserAction // Ring buffer of last MaxUserActions actions
-	lastBufferLines  []string            // For detecting text changes
-	lastCursorOffset int                 // For cursor movement detection
+	userActions      map[string][]*types.UserAction // Per project root, a ring buffer of its last MaxUserActions actions
+	lastCursorOffset int                            // For cursor movement detection
 
-	// Metrics tracking (engine owns state, provider implements Sender)
-	metricSender   metrics.Sender
+	// Metrics tracking (engine owns state; the provider backend and local sinks implement Sender)
+	metricsBackend metrics.Sender   // The provider backend, nil if it takes no metrics
+	metricSinks    []metrics.Sender // Local sinks, sent every event
 	currentMetrics metrics.CompletionInfo
-	metricsCh      chan metrics.Event
+	metricsCh      chan metricsDelivery
+	stats          *metrics.Stats
+	budget         *tokenBudget
+	limiter        *rateLimiter
+	breaker        *circuitBreaker
+	payload        *payloadStats
+	queued         *queuedRequest // Completion request held back by the rate limiter
+	queueTimer     Timer          // Retries the queued request once the rate allows
+	cache          *responseCache
+	store          CacheStore       // nil unless the cache persists between sessions
+	roots          *rootFinder      // Project roots of the buffers' directories
+	ignore         *ignore.Rules    // Files never used as context (nil ignores nothing)
+	redactor       *redact.Redactor // Secrets redacted from outgoing requests (nil sends content as is)
+	retrieval      *retrieval.Index // Chunks of visited files, ranked against the cursor context
+
+	// Quality log (nil unless enabled)
+	qualityLog *quality.Log
+	quality    *pendingQuality
+
+	// Provider request stats
+	providerNameFn func() string
+	modelNameFn    func() string
+	statsPending   *pendingStats
+	annotation     *types.Annotation // Provider, model and latency of the shown completion
+
+	// Statusline progress
+	onProgress   func(Progress)
+	lastProgress Progress
+
+	// Subscriber of engine notifications
+	onNotification func(Notification)
 }
 
 // NewEngine creates a new Engine instance.
@@ -136,7 +247,7 @@ func NewEngine(provider Provider, buf Buffer, config EngineConfig, clock Clock,
 		ctx:                    nil,
 		eventChan:              make(chan Event, 100),
 		config:                 config,
-		contextLimits:          provider.GetContextLimits(),
+		contextLimits:          provider.GetContextLimits().Override(config.ContextLimits),
 		idleTimer:              nil,
 		textChangeTimer:        nil,
 		mu:                     sync.RWMutex{},
@@ -147,15 +258,28 @@ func NewEngine(provider Provider, buf Buffer, config EngineConfig, clock Clock,
 		prefetchState:          prefetchNone,
 		stopped:                false,
 		fileStateStore:         make(map[string]*FileState),
-	}
-
-	// Initialize metrics if provider implements Sender
+		openBuffers:            make(map[string]*openBuffer),
+		userActions:            make(map[string][]*types.UserAction),
+		stats:                  metrics.NewStats(),
+		budget:                 &tokenBudget{limit: config.TokenBudget},
+		limiter:                &rateLimiter{},
+		breaker:                &circuitBreaker{threshold: config.CircuitBreaker.Failures, cooldown: config.CircuitBreaker.Cooldown},
+		payload:                &payloadStats{},
+		cache:                  newResponseCache(),
+		retrieval:              retrieval.NewIndex(),
+		roots:                  newRootFinder(config.RootMarkers),
+		lastProgress:           Progress{Action: ProgressNone},
+	}
+
+	// Report to the provider backend if it implements Sender
 	if sender, ok := provider.(metrics.Sender); ok {
-		e.metricSender = sender
-		e.metricsCh = make(chan metrics.Event, 64)
-		go e.metricsWorker()
+		e.metricsBackend = sender
 	}
+	e.limiter.setLimits(config.MaxRequestsPerMinute, config.MaxConcurrentRequests, e.requestSlotFree)
+	e.metricsCh = make(chan metricsDelivery, 64)
+	go e.metricsWorker()
 
+	logger.Info("context limits: %s", e.contextLimits)
 	return e, nil
 }
 
@@ -183,6 +307,9 @@ func (e *Engine) Stop() {
 		logger.Info("stopping engine...")
 
 		e.stopped = true
+		if err := e.saveSession(); err != nil {
+			logger.Warn("cache store: save failed: %v", err)
+		}
 		if e.currentCancel != nil {
 			e.currentCancel()
 			e.currentCancel = nil
@@ -191,21 +318,24 @@ func (e *Engine) Stop() {
 			e.prefetchCancel()
 			e.prefetchCancel = nil
 		}
+		e.dropSpeculation()
+		e.dropTargets()
 		e.stopIdleTimer()
 		e.stopTextChangeTimer()
+		e.stopDisplayTimer()
+		e.stopOfflineTimer()
 		e.state = stateIdle
 		e.cursorTarget = nil
 		e.completions = nil
 		e.applyBatch = nil
 		e.stagedCompletion = nil
+		e.multiFile = nil
 		e.prefetchedCompletions = nil
 		e.prefetchedCursorTarget = nil
 		e.prefetchState = prefetchNone
 		e.completionOriginalLines = nil
 		close(e.eventChan)
-		if e.metricsCh != nil {
-			close(e.metricsCh)
-		}
+		close(e.metricsCh)
 		if e.mainCancel != nil {
 			e.mainCancel()
 		}
@@ -236,20 +366,39 @@ func (e *Engine) clearState(opts ClearOptions) {
 		e.prefetchedCompletions = nil
 		e.prefetchedCursorTarget = nil
 	}
+	if opts.CancelPrefetch {
+		e.prefetchLines = nil
+		e.prefetchRegions = nil
+		e.prefetchResp = nil
+		e.dropSpeculation()
+	}
 	if opts.ClearCursorTarget {
 		e.cursorTarget = nil
+		e.targetView = targetView{}
 	}
 	if opts.CallOnReject {
+		e.dropTargets()
 		e.buffer.ClearUI()
-		// Send reject metric if a completion was shown
-		if len(e.completions) > 0 {
+		// Send reject metric if a completion or jump was shown
+		if e.awaitingOutcome() {
 			e.sendMetric(metrics.EventRejected)
 		}
 	}
 	e.completions = nil
+	e.candidates = nil
 	e.applyBatch = nil
+	e.completionDimmed = false
+	e.editedOutside = false
+	e.inlineInsertion = false
 	if opts.ClearStaged {
 		e.stagedCompletion = nil
+		e.multiFile = nil
+		e.acceptedRename = nil
+		e.propagatingRename = false
+		e.renameSearch = nil
+		e.placeholders = nil
+		e.importSpan = nil
+		e.addingImports = false
 	}
 	e.completionOriginalLines = nil
 	e.currentGroups = nil
@@ -292,17 +441,79 @@ func (e *Engine) RegisterEventHandler() {
 	}
 }
 
+// Reload replaces the engine configuration at runtime.
+// The change is applied on the event loop so it never races an in-flight transition.
+func (e *Engine) Reload(config EngineConfig) {
+	e.post(Event{Type: EventConfigReload, Data: config})
+}
+
+// applyConfig replaces the configuration and rebuilds the state derived from
+// it. The counts of the budget, rate limiter and circuit breaker carry over.
+func (e *Engine) applyConfig(config EngineConfig) {
+	e.config = config
+	e.refreshContextLimits()
+	e.budget.setLimit(config.TokenBudget)
+	e.limiter.setLimits(config.MaxRequestsPerMinute, config.MaxConcurrentRequests, e.requestSlotFree)
+	e.breaker.configure(config.CircuitBreaker.Failures, config.CircuitBreaker.Cooldown)
+	if roots := newRootFinder(config.RootMarkers); !slices.Equal(roots.markers, e.roots.markers) {
+		e.roots = roots
+	}
+	e.stopIdleTimer()
+	e.stopTextChangeTimer()
+}
+
+// refreshContextLimits takes the limits of the provider serving requests,
+// which changes when a failover chain switches to another member.
+func (e *Engine) refreshContextLimits() {
+	e.contextLimits = e.provider.GetContextLimits().Override(e.config.ContextLimits)
+}
+
+// requestSlotFree retries the queued request once a request leaves flight.
+func (e *Engine) requestSlotFree() {
+	go e.post(Event{Type: EventRequestSlotFree})
+}
+
+// SetDisabled engages or releases the kill switch.
+// While disabled, any visible completion is rejected and no new requests are made.
+func (e *Engine) SetDisabled(disabled bool) {
+	e.post(Event{Type: EventKillSwitch, Data: disabled})
+}
+
+// SetTrusted marks whether the workspace is trusted to use the provider.
+// Untrusted workspaces behave as if the kill switch were engaged.
+func (e *Engine) SetTrusted(trusted bool) {
+	e.post(Event{Type: EventTrust, Data: trusted})
+}
+
+// post delivers an event to the event loop unless the engine is stopped.
+func (e *Engine) post(event Event) {
+	e.mu.RLock()
+	stopped := e.stopped
+	mainCtx := e.mainCtx
+	e.mu.RUnlock()
+
+	if stopped || mainCtx == nil {
+		return
+	}
+
+	select {
+	case e.eventChan <- event:
+	case <-mainCtx.Done():
+	}
+}
+
 // Timer management
 
 func (e *Engine) startIdleTimer() {
-	// When delay is -1, idle completions are disabled
-	if e.config.IdleCompletionDelay < 0 {
+	// When delay is -1 or only explicit triggers are allowed, idle completions are disabled
+	if e.config.IdleCompletionDelay < 0 || e.config.TriggerPolicy == TriggerManual {
 		return
 	}
 	if !e.isModeEnabled() {
 		return
 	}
 	e.stopIdleTimer()
+	e.startScanTimer()
 	e.idleTimer = e.clock.AfterFunc(e.config.IdleCompletionDelay, func() {
 		e.mu.RLock()
 		stopped := e.stopped
@@ -325,6 +536,7 @@ func (e *Engine) stopIdleTimer() {
 		e.idleTimer.Stop()
 		e.idleTimer = nil
 	}
+	e.stopScan()
 }
 
 func (e *Engine) resetIdleTimer() {
@@ -337,11 +549,20 @@ func (e *Engine) startTextChangeTimer() {
 	if e.config.TextChangeDebounce < 0 {
 		return
 	}
+	// Text changes do not trigger completions under these policies
+	if e.config.TriggerPolicy == TriggerManual || e.config.TriggerPolicy == TriggerIdleOnly {
+		return
+	}
 	if !e.isModeEnabled() {
 		return
 	}
+	e.armTextChangeTimer(e.config.TextChangeDebounce)
+}
+
+// armTextChangeTimer requests a completion for the text changes once d passes.
+func (e *Engine) armTextChangeTimer(d time.Duration) {
 	e.stopTextChangeTimer()
-	e.textChangeTimer = e.clock.AfterFunc(e.config.TextChangeDebounce, func() {
+	e.textChangeTimer = e.clock.AfterFunc(d, func() {
 		e.mu.RLock()
 		stopped := e.stopped
 		mainCtx := e.mainCtx
@@ -365,6 +586,61 @@ func (e *Engine) stopTextChangeTimer() {
 	}
 }
 
+// updateDisplayTimer arms the display TTL when a new completion or cursor target
+// becomes visible and stops it once nothing is shown. Called after every event.
+func (e *Engine) updateDisplayTimer() {
+	var item any
+	switch {
+	case e.config.DisplayTTL <= 0:
+	case e.state == stateHasCompletion && len(e.completions) > 0:
+		item = e.completions[0]
+	case e.state == stateHasCursorTarget && e.cursorTarget != nil:
+		item = e.cursorTarget
+	}
+
+	if item == nil {
+		e.stopDisplayTimer()
+		e.displayedItem = nil
+		return
+	}
+	if item == e.displayedItem {
+		return
+	}
+	e.startDisplayTimer()
+	e.displayedItem = item
+}
+
+func (e *Engine) startDisplayTimer() {
+	e.stopDisplayTimer()
+	e.displayGen++
+	gen := e.displayGen
+	e.displayTimer = e.clock.AfterFunc(e.config.DisplayTTL, func() {
+		e.post(Event{Type: EventDisplayExpired, Data: gen})
+	})
+}
+
+func (e *Engine) stopDisplayTimer() {
+	if e.displayTimer != nil {
+		e.displayTimer.Stop()
+		e.displayTimer = nil
+	}
+}
+
+// cursorInDisplayedRange reports whether the cursor is on the lines covered by
+// the visible completion or cursor target.
+func (e *Engine) cursorInDisplayedRange() bool {
+	row := e.buffer.Row()
+	if e.state == stateHasCursorTarget && e.cursorTarget != nil {
+		return row == int(e.cursorTarget.LineNumber)
+	}
+	if len(e.completions) == 0 {
+		return false
+	}
+	c := e.completions[0]
+	end := max(c.EndLineInc, c.StartLine+len(c.Lines)-1)
+	return row >= c.StartLine && row <= end
+}
+
 // isModeEnabled returns true if completions are enabled for the current mode
 // or if the completion was manually triggered.
 func (e *Engine) isModeEnabled() bool {
@@ -374,24 +650,27 @@ func (e *Engine) isModeEnabled() bool {
 	if e.inInsertMode {
 		return e.config.CompleteInInsert
 	}
-	return e.config.CompleteInNormal
+	return e.config.CompleteInNormal || e.config.TriggerPolicy == TriggerNormalModeToo
 }
 
-// recordUserAction adds an action to the ring buffer, evicting oldest if full
+// recordUserAction adds an action to the ring buffer of its project, evicting
+// the oldest if full, so activity in one project never pushes out another's
 func (e *Engine) recordUserAction(action *types.UserAction) {
 	if e.contextLimits.MaxUserActions < 0 {
 		return
 	}
-	if len(e.userActions) >= e.contextLimits.MaxUserActions {
-		e.userActions = e.userActions[1:] // Evict oldest
+	root := e.rootOf(action.FilePath)
+	actions := e.userActions[root]
+	if len(actions) >= e.contextLimits.MaxUserActions {
+		actions = actions[1:] // Evict oldest
 	}
-	e.userActions = append(e.userActions, action)
+	e.userActions[root] = append(actions, action)
 }
 
 // getUserActionsForFile returns all tracked actions for the given file path
 func (e *Engine) getUserActionsForFile(filePath string) []*types.UserAction {
 	var result []*types.UserAction
-	for _, a := range e.userActions {
+	for _, a := range e.userActions[e.rootOf(filePath)] {
 		if a.FilePath == filePath {
 			result = append(result, a)
 		}
@@ -399,33 +678,6 @@ func (e *Engine) getUserActionsForFile(filePath string) []*types.UserAction {
 	return result
 }
 
-// recordTextChangeAction classifies and records a text change action
-func (e *Engine) recordTextChangeAction() {
-	currentLines := e.buffer.Lines()
-
-	if e.lastBufferLines == nil {
-		e.lastBufferLines = copyLines(currentLines)
-		return
-	}
-
-	// Classify the action based on diff
-	actionType := classifyEdit(e.lastBufferLines, currentLines)
-	if actionType == "" {
-		e.lastBufferLines = copyLines(currentLines)
-		return
-	}
-
-	e.recordUserAction(&types.UserAction{
-		ActionType:  actionType,
-		FilePath:    e.buffer.Path(),
-		LineNumber:  e.buffer.Row(),
-		Offset:      calculateOffset(currentLines, e.buffer.Row(), e.buffer.Col()),
-		TimestampMs: e.clock.Now().UnixMilli(),
-	})
-
-	e.lastBufferLines = copyLines(currentLines)
-}
-
 // recordCursorMovementAction records a cursor movement if position changed
 func (e *Engine) recordCursorMovementAction() {
 	currentOffset := calculateOffset(e.buffer.Lines(), e.buffer.Row(), e.buffer.Col())
@@ -441,30 +693,6 @@ func (e *Engine) recordCursorMovementAction() {
 	}
 }
 
-// classifyEdit determines the action type based on character count changes
-func classifyEdit(oldLines, newLines []string) types.UserActionType {
-	oldLen := totalChars(oldLines)
-	newLen := totalChars(newLines)
-
-	inserted := max(0, newLen-oldLen)
-	deleted := max(0, oldLen-newLen)
-
-	switch {
-	case deleted == 0 && inserted == 1:
-		return types.ActionInsertChar
-	case deleted == 0 && inserted > 1:
-		return types.ActionInsertSelection
-	case deleted == 1 && inserted == 0:
-		return types.ActionDeleteChar
-	case deleted > 1 && inserted == 0:
-		return types.ActionDeleteSelection
-	case inserted > 0:
-		return types.ActionInsertSelection // Replace = delete + insert
-	default:
-		return ""
-	}
-}
-
 // calculateOffset computes byte offset from line/column position
 func calculateOffset(lines []string, row, col int) int {
 	offset := 0
@@ -477,57 +705,115 @@ func calculateOffset(lines []string, row, col int) int {
 	return offset
 }
 
-// totalChars counts total characters including newlines
-func totalChars(lines []string) int {
-	total := 0
-	for _, line := range lines {
-		total += len(line) + 1
-	}
-	return total
-}
-
 // Metrics tracking
 
 // recordMetricsShown records that a completion was shown to the user.
-// Called when displaying a completion with metrics info from the provider.
+// info carries the provider's metrics ID and sizes, when it has them.
 func (e *Engine) recordMetricsShown(info *types.MetricsInfo) {
-	if info == nil || info.ID == "" {
-		e.currentMetrics = metrics.CompletionInfo{}
-		return
+	e.currentMetrics = metrics.CompletionInfo{ShownAt: e.clock.Now()}
+	if e.annotation != nil {
+		e.currentMetrics.Provider = e.annotation.Provider
+		e.currentMetrics.Model = e.annotation.Model
+	}
+	if info != nil {
+		e.currentMetrics.ID = info.ID
+		e.currentMetrics.Additions = info.Additions
+		e.currentMetrics.Deletions = info.Deletions
+		e.currentMetrics.AddedBytes = info.AddedBytes
+		e.currentMetrics.DeletedBytes = info.DeletedBytes
 	}
-	e.currentMetrics = metrics.CompletionInfo{
-		ID:        info.ID,
-		Additions: info.Additions,
-		Deletions: info.Deletions,
-		ShownAt:   e.clock.Now(),
+	e.sendMetric(metrics.EventShown)
+	e.notifyStage(NotifyCompletionShown)
+}
+
+// recordJumpShown records metrics for a shown cursor-only prediction.
+func (e *Engine) recordJumpShown(info *types.MetricsInfo) {
+	e.currentMetrics = metrics.CompletionInfo{ShownAt: e.clock.Now(), CursorOnly: true}
+	if info != nil {
+		e.currentMetrics.ID = info.ID
 	}
 	e.sendMetric(metrics.EventShown)
 }
 
-// sendMetric queues a metric event for async sending.
+// awaitingOutcome reports whether a shown completion or cursor-only
+// prediction still needs its accept/reject/ignore metric.
+func (e *Engine) awaitingOutcome() bool {
+	return len(e.completions) > 0 || e.currentMetrics.CursorOnly
+}
+
+// sendMetric records a metric event in the local stats and, when the
+// provider gave the completion an ID, queues it for async sending.
 // Clears currentMetrics after sending accept/reject/ignored events.
 func (e *Engine) sendMetric(eventType metrics.EventType) {
-	if e.metricSender == nil || e.currentMetrics.ID == "" {
+	if eventType != metrics.EventShown {
+		e.qualityOutcome(eventType)
+		e.notifyOutcome(eventType)
+	}
+	if e.currentMetrics.ShownAt.IsZero() {
 		return
 	}
 
 	event := metrics.Event{Type: eventType, Info: e.currentMetrics}
+	e.stats.Record(event)
 
 	// Clear metrics after outcome events (not after shown)
 	if eventType != metrics.EventShown {
 		e.currentMetrics = metrics.CompletionInfo{}
 	}
 
+	senders := e.metricSenders(event)
+	if len(senders) == 0 {
+		return
+	}
+
 	select {
-	case e.metricsCh <- event:
+	case e.metricsCh <- metricsDelivery{event: event, senders: senders}:
 	default:
 		logger.Warn("metrics: event queue full, dropping %s event for %s", eventType, event.Info.ID)
 	}
 }
 
+// Stats returns the locally aggregated completion statistics.
+func (e *Engine) Stats() metrics.Summary {
+	summary := e.stats.Summary()
+	summary.Budget = e.budget.status(e.clock.Now())
+	summary.RateLimit = e.limiter.status()
+	summary.Payload = e.payload.status()
+	summary.Payload.Limit = e.config.MaxPayloadBytes
+	return summary
+}
+
+// metricsDelivery is a metrics event and the senders it goes to.
+type metricsDelivery struct {
+	event   metrics.Event
+	senders []metrics.Sender
+}
+
+// metricSenders returns the senders event goes to: the local sinks, and the
+// provider backend when telemetry is enabled and the provider identified the
+// completion. Telemetry is checked on every event, so reloading the config
+// turns it on or off.
+func (e *Engine) metricSenders(event metrics.Event) []metrics.Sender {
+	senders := slices.Clone(e.metricSinks)
+	if e.metricsBackend != nil && !e.config.DisableTelemetry && event.Info.ID != "" {
+		senders = append(senders, e.metricsBackend)
+	}
+	return senders
+}
+
 // metricsWorker processes metrics events asynchronously.
 func (e *Engine) metricsWorker() {
-	for event := range e.metricsCh {
-		e.metricSender.SendMetric(e.mainCtx, event)
+	for delivery := range e.metricsCh {
+		for _, sender := range delivery.senders {
+			sender.SendMetric(e.mainCtx, delivery.event)
+		}
 	}
 }
+
+// AddMetricsSink sends every metrics event to sink, whether or not telemetry
+// is enabled. Must be called before Start.
+func (e *Engine) AddMetricsSink(sink metrics.Sender) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.metricSinks = append(e.metricSinks, sink)
+}
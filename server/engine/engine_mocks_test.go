@@ -3,8 +3,14 @@ package engine
 import (
 	"context"
 	"cursortab/buffer"
+	"cursortab/imports"
 	"cursortab/text"
 	"cursortab/types"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,18 +24,38 @@ type mockBuffer struct {
 	row            int
 	col            int
 	path           string
+	absPath        string
 	version        int
 	viewportTop    int
 	viewportBottom int
 	previousLines  []string
 	originalLines  []string
 	diffHistories  []*types.DiffEntry
+	ineligible     string
+	appliedLines   int  // ApplyLines calls
+	detached       bool // DetachLines was called
 	// Track method calls
 	syncCalls              int
 	clearUICalls           int
 	commitPendingCalls     int
 	showCursorTargetLine   int
+	showCursorTargetCalls  int
+	showFileTargetPath     string
+	showFileTargetLine     int
+	lastFileSummary        *text.MultiFileSummary
+	placeholders           []text.Placeholder  // Last ShowPlaceholders argument
+	dimmed                 bool                // Last DimCompletion argument
+	streamedStages         []streamedStage     // StreamStage arguments, in order
+	importEdits            []imports.TextEdit  // Returned by ImportEdits
+	files                  map[string][]string // Contents of files OpenFile can switch to
+	folds                  []text.LineRange    // Closed folds
+	openFoldCalls          int
 	prepareCompletionCalls int
+	verifyErr              error // Returned by VerifyPending
+	rollbackCalls          int
+	rollbackErr            error         // Returned by Rollback
+	applyFailure           *ApplyFailure // Last NotifyApplyFailed argument
+	annotation             *types.Annotation
 	lastPreparedCompletion struct {
 		startLine  int
 		endLineInc int
@@ -42,6 +68,14 @@ type mockBuffer struct {
 	lastInsertCol       int
 	lastReplacedLine    int
 	lastReplacedContent string
+	applyInPlaceCalls   int
+}
+
+// streamedStage records a StreamStage call.
+type streamedStage struct {
+	stage *text.Stage
+	index int
+	shown bool
 }
 
 func newMockBuffer() *mockBuffer {
@@ -87,12 +121,37 @@ func (b *mockBuffer) Path() string {
 	return b.path
 }
 
+func (b *mockBuffer) AbsolutePath() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.absPath
+}
+
 func (b *mockBuffer) Version() int {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	return b.version
 }
 
+func (b *mockBuffer) Ineligible() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ineligible
+}
+
+func (b *mockBuffer) ApplyLines(first, last int, lines []string, tick int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.appliedLines++
+	return true
+}
+
+func (b *mockBuffer) DetachLines() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.detached = true
+}
+
 func (b *mockBuffer) ViewportBounds() (top, bottom int) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -150,6 +209,12 @@ func (b *mockBuffer) PrepareCompletion(startLine, endLineInc int, lines []string
 	return &mockBatch{}
 }
 
+func (b *mockBuffer) SetAnnotation(a *types.Annotation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.annotation = a
+}
+
 func (b *mockBuffer) CommitPending() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -160,13 +225,82 @@ func (b *mockBuffer) CommitUserEdits() bool {
 	return false
 }
 
+func (b *mockBuffer) VerifyPending() error {
+	return b.verifyErr
+}
+
+func (b *mockBuffer) Rollback() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollbackCalls++
+	return b.rollbackErr
+}
+
+func (b *mockBuffer) NotifyApplyFailed(failureJSON string) {
+	b.applyFailure = &ApplyFailure{}
+	json.Unmarshal([]byte(failureJSON), b.applyFailure)
+}
+
 func (b *mockBuffer) ShowCursorTarget(line int) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	b.showCursorTargetLine = line
+	b.showCursorTargetCalls++
+	return nil
+}
+
+func (b *mockBuffer) ShowFileTarget(path string, line int, summary *text.MultiFileSummary) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.showFileTargetPath = path
+	b.showFileTargetLine = line
+	b.lastFileSummary = summary
+	return nil
+}
+
+func (b *mockBuffer) ShowPlaceholders(placeholders []text.Placeholder) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.placeholders = placeholders
+	return nil
+}
+
+func (b *mockBuffer) DimCompletion(dimmed bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dimmed = dimmed
+	return nil
+}
+
+func (b *mockBuffer) StreamStage(stage *text.Stage, index int, shown bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.streamedStages = append(b.streamedStages, streamedStage{stage: stage, index: index, shown: shown})
 	return nil
 }
 
+func (b *mockBuffer) ImportEdits(first, last int, timeout time.Duration) ([]imports.TextEdit, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.importEdits, "utf-16"
+}
+
+// OpenFile opens the file of files whose workspace-relative key path ends
+// with, as the engine joins it with the workspace.
+func (b *mockBuffer) OpenFile(path string, line int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for rel, lines := range b.files {
+		if path == rel || strings.HasSuffix(path, string(filepath.Separator)+rel) {
+			b.path = rel
+			b.lines = lines
+			b.row = line
+			return nil
+		}
+	}
+	return fmt.Errorf("no such file: %s", path)
+}
+
 func (b *mockBuffer) ClearUI() error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -174,10 +308,32 @@ func (b *mockBuffer) ClearUI() error {
 	return nil
 }
 
-func (b *mockBuffer) MoveCursor(line int, center, mark bool) error {
+func (b *mockBuffer) MoveCursor(line, col int, center, mark bool) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	b.row = line
+	b.col = max(col, 0)
+	return nil
+}
+
+func (b *mockBuffer) ClosedFold(line int) (start, end int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, fold := range b.folds {
+		if line >= fold.Start && line <= fold.End {
+			return fold.Start, fold.End
+		}
+	}
+	return 0, 0
+}
+
+func (b *mockBuffer) OpenFold(line int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.folds = slices.DeleteFunc(b.folds, func(fold text.LineRange) bool {
+		return line >= fold.Start && line <= fold.End
+	})
+	b.openFoldCalls++
 	return nil
 }
 
@@ -227,14 +383,28 @@ func (b *mockBuffer) InsertLine(line int, content string) error {
 	return nil
 }
 
+func (b *mockBuffer) ApplyInPlace(startLine, endLineInc int, lines []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.applyInPlaceCalls++
+	newLines := append([]string{}, b.lines[:startLine-1]...)
+	newLines = append(newLines, lines...)
+	b.lines = append(newLines, b.lines[min(endLineInc, len(b.lines)):]...)
+	if b.row > endLineInc {
+		b.row += len(lines) - (endLineInc - startLine + 1)
+	}
+	return nil
+}
+
 // mockBatch implements buffer.Batch
 type mockBatch struct {
 	executed bool
+	err      error // Returned by Execute
 }
 
 func (b *mockBatch) Execute() error {
 	b.executed = true
-	return nil
+	return b.err
 }
 
 // mockProvider implements the Provider interface for testing
@@ -244,10 +414,12 @@ type mockProvider struct {
 	completionErr   error
 	completionCalls int
 	lastRequest     *types.CompletionRequest
+	limits          ContextLimits
 }
 
 func newMockProvider() *mockProvider {
 	return &mockProvider{
+		limits: DefaultContextLimits(),
 		completionResp: &types.CompletionResponse{
 			Completions: []*types.Completion{{
 				StartLine:  1,
@@ -259,7 +431,7 @@ func newMockProvider() *mockProvider {
 }
 
 func (p *mockProvider) GetContextLimits() ContextLimits {
-	return DefaultContextLimits()
+	return p.limits
 }
 
 func (p *mockProvider) GetCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
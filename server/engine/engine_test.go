@@ -2,7 +2,11 @@ package engine
 
 import (
 	"cursortab/assert"
+	"cursortab/metrics"
+	"cursortab/text"
+	"cursortab/types"
 	"testing"
+	"time"
 )
 
 func TestEngineCreation(t *testing.T) {
@@ -15,3 +19,335 @@ func TestEngineCreation(t *testing.T) {
 	assert.NotNil(t, eng, "NewEngine")
 	assert.Equal(t, stateIdle, eng.state, "initial state")
 }
+
+func TestKillSwitch_RejectsAndBlocksEvents(t *testing.T) {
+	buf := newMockBuffer()
+	prov := newMockProvider()
+	clock := newMockClock()
+	eng := createTestEngine(buf, prov, clock)
+
+	eng.state = stateHasCompletion
+	eng.completions = []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"test"}}}
+
+	eng.handleEvent(Event{Type: EventKillSwitch, Data: true})
+
+	assert.Equal(t, stateIdle, eng.state, "state after kill switch")
+	assert.Nil(t, eng.completions, "completions after kill switch")
+	assert.Greater(t, buf.clearUICalls, 0, "ClearUI should have been called")
+
+	eng.handleEvent(Event{Type: EventManualTrigger})
+	assert.Equal(t, stateIdle, eng.state, "trigger ignored while disabled")
+	assert.Equal(t, 0, prov.completionCalls, "no completion requests while disabled")
+
+	eng.handleEvent(Event{Type: EventKillSwitch, Data: false})
+	assert.False(t, eng.handleControlEvent(Event{Type: EventManualTrigger}), "trigger passes through after release")
+}
+
+func TestTrust_UntrustedBlocksIndependentlyOfKillSwitch(t *testing.T) {
+	buf := newMockBuffer()
+	prov := newMockProvider()
+	clock := newMockClock()
+	eng := createTestEngine(buf, prov, clock)
+
+	eng.state = stateHasCompletion
+	eng.completions = []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"test"}}}
+
+	eng.handleEvent(Event{Type: EventTrust, Data: false})
+
+	assert.Equal(t, stateIdle, eng.state, "state after untrust")
+	assert.Nil(t, eng.completions, "completions after untrust")
+	assert.True(t, eng.handleControlEvent(Event{Type: EventManualTrigger}), "trigger blocked while untrusted")
+
+	eng.handleEvent(Event{Type: EventKillSwitch, Data: true})
+	eng.handleEvent(Event{Type: EventKillSwitch, Data: false})
+	assert.True(t, eng.handleControlEvent(Event{Type: EventManualTrigger}), "kill switch release keeps untrusted workspace blocked")
+
+	eng.handleEvent(Event{Type: EventTrust, Data: true})
+	assert.False(t, eng.handleControlEvent(Event{Type: EventManualTrigger}), "trigger passes through once trusted")
+}
+
+func TestConfigReload_ReplacesConfig(t *testing.T) {
+	buf := newMockBuffer()
+	prov := newMockProvider()
+	clock := newMockClock()
+	eng := createTestEngine(buf, prov, clock)
+
+	config := eng.config
+	config.TextChangeDebounce = -1
+	config.CompleteInNormal = false
+
+	eng.handleEvent(Event{Type: EventConfigReload, Data: config})
+
+	assert.Equal(t, config, eng.config, "config after reload")
+
+	eng.handleEvent(Event{Type: EventTextChanged})
+	assert.Nil(t, eng.textChangeTimer, "text change timer disabled by reloaded config")
+}
+
+func TestConfigReload_RebuildsDerivedState(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+	now := eng.clock.Now()
+	eng.budget.record(now, 100)
+
+	config := eng.config
+	config.ContextLimits.MaxInputLines = 3
+	config.TokenBudget = 50
+	config.MaxRequestsPerMinute = 7
+	config.MaxConcurrentRequests = 2
+	config.CircuitBreaker.Failures = 4
+	config.RootMarkers = []string{"go.mod"}
+
+	eng.handleEvent(Event{Type: EventConfigReload, Data: config})
+
+	assert.Equal(t, 3, eng.contextLimits.MaxInputLines, "context limits")
+	assert.False(t, eng.budget.fits(now, 1), "budget limit applied to the tokens already spent")
+	assert.Equal(t, 7, eng.limiter.status().PerMinute, "requests per minute")
+	assert.Equal(t, 2, eng.limiter.status().MaxConcurrent, "concurrent requests")
+	assert.NotNil(t, eng.limiter.onRelease, "queued requests retried once a slot frees up")
+	assert.Equal(t, 4, eng.breaker.threshold, "breaker threshold")
+	assert.Equal(t, []string{"go.mod"}, eng.roots.markers, "root markers")
+}
+
+func TestTriggerPolicy_GatesAutomaticTriggers(t *testing.T) {
+	cases := []struct {
+		policy     TriggerPolicy
+		textChange bool
+		idle       bool
+	}{
+		{TriggerInsertChange, true, true},
+		{TriggerManual, false, false},
+		{TriggerIdleOnly, false, true},
+		{TriggerNormalModeToo, true, true},
+	}
+	for _, c := range cases {
+		t.Run(string(c.policy), func(t *testing.T) {
+			eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+			eng.config.TriggerPolicy = c.policy
+
+			eng.handleEvent(Event{Type: EventTextChanged})
+			assert.Equal(t, c.textChange, eng.textChangeTimer != nil, "text change timer")
+
+			eng.handleEvent(Event{Type: EventCursorMoved})
+			assert.Equal(t, c.idle, eng.idleTimer != nil, "idle timer")
+		})
+	}
+}
+
+func TestTriggerPolicy_NormalModeTooOverridesDisabledNormalMode(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+	eng.config.CompleteInNormal = false
+
+	assert.False(t, eng.isModeEnabled(), "normal mode disabled")
+
+	eng.config.TriggerPolicy = TriggerNormalModeToo
+	assert.True(t, eng.isModeEnabled(), "normal mode enabled by policy")
+}
+
+func TestTriggerPolicy_ManualTriggerRequestsCompletion(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"hello"}
+	buf.row = 1
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), newMockClock())
+	defer cancel()
+	eng.config.TriggerPolicy = TriggerManual
+	eng.config.CompleteInNormal = false
+
+	eng.handleEvent(Event{Type: EventManualTrigger})
+
+	assert.Equal(t, statePendingCompletion, eng.state, "state after manual trigger")
+	assert.True(t, eng.manuallyTriggered, "request marked as manual")
+}
+
+func TestDisplayTTL_DismissesWhenCursorAway(t *testing.T) {
+	buf := newMockBuffer()
+	buf.row = 3
+	prov := newMockProvider()
+	clock := newMockClock()
+	eng := createTestEngine(buf, prov, clock)
+	eng.config.DisplayTTL = time.Second
+
+	eng.state = stateHasCompletion
+	eng.completions = []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"test"}}}
+	eng.updateDisplayTimer()
+	assert.NotNil(t, eng.displayTimer, "timer armed for shown completion")
+
+	eng.handleEvent(Event{Type: EventDisplayExpired, Data: eng.displayGen - 1})
+	assert.Equal(t, stateHasCompletion, eng.state, "stale expiry ignored")
+
+	eng.handleEvent(Event{Type: EventDisplayExpired, Data: eng.displayGen})
+	assert.Equal(t, stateIdle, eng.state, "state after expiry")
+	assert.Nil(t, eng.completions, "completions after expiry")
+	assert.Greater(t, buf.clearUICalls, 0, "ClearUI should have been called")
+	assert.Nil(t, eng.displayTimer, "timer stopped once nothing is shown")
+}
+
+func TestDisplayTTL_PausedWhileCursorOnSuggestion(t *testing.T) {
+	buf := newMockBuffer()
+	buf.row = 2
+	prov := newMockProvider()
+	clock := newMockClock()
+	eng := createTestEngine(buf, prov, clock)
+	eng.config.DisplayTTL = time.Second
+
+	eng.state = stateHasCompletion
+	eng.completions = []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"a", "b"}}}
+	eng.updateDisplayTimer()
+	gen := eng.displayGen
+
+	eng.handleEvent(Event{Type: EventDisplayExpired, Data: gen})
+	assert.Equal(t, stateHasCompletion, eng.state, "completion kept while cursor is on it")
+	assert.Equal(t, gen+1, eng.displayGen, "timer re-armed once")
+	assert.NotNil(t, eng.displayTimer, "timer running")
+}
+
+func TestTargetVisibilityOf(t *testing.T) {
+	cases := []struct {
+		name string
+		line int
+		want targetVisibility
+	}{
+		{"first visible line", 10, targetVisible},
+		{"last visible line", 20, targetVisible},
+		{"just above", 9, targetAbove},
+		{"just below", 21, targetBelow},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, targetVisibilityOf(c.line, 10, 20), c.name)
+	}
+	assert.Equal(t, targetVisible, targetVisibilityOf(100, 0, 0), "unknown viewport")
+}
+
+func TestScrolled_RerendersOnlyWhenTargetVisibilityChanges(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = make([]string, 200)
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	scroll := func(top, bottom int) {
+		buf.viewportTop, buf.viewportBottom = top, bottom
+		eng.handleEvent(Event{Type: EventScrolled})
+	}
+
+	eng.state = stateHasCursorTarget
+	eng.showCursorTarget(40)
+	assert.Equal(t, 1, buf.showCursorTargetCalls, "initial render")
+
+	scroll(5, 54)
+	assert.Equal(t, 1, buf.showCursorTargetCalls, "still visible")
+
+	scroll(41, 90)
+	assert.Equal(t, 2, buf.showCursorTargetCalls, "scrolled out above")
+
+	scroll(60, 109)
+	assert.Equal(t, 2, buf.showCursorTargetCalls, "still above")
+
+	scroll(40, 89)
+	assert.Equal(t, 3, buf.showCursorTargetCalls, "back on the top line")
+	assert.Equal(t, 40, buf.showCursorTargetLine, "same target")
+	assert.Equal(t, stateHasCursorTarget, eng.state, "state unchanged")
+}
+
+func TestScrolled_ShowsStageScrolledIntoView(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = make([]string, 200)
+	buf.viewportTop, buf.viewportBottom = 1, 50
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	stage := &text.Stage{BufferStart: 120, BufferEnd: 120, Lines: []string{"new 120"},
+		Groups: []*text.Group{{Type: "modification", BufferLine: 120}}}
+	eng.stagedCompletion = &text.StagedCompletion{Stages: []*text.Stage{stage}}
+	eng.cursorTarget = &types.CursorPredictionTarget{LineNumber: 120}
+	eng.state = stateHasCursorTarget
+	eng.showCursorTarget(120)
+
+	buf.viewportTop, buf.viewportBottom = 30, 79
+	eng.handleEvent(Event{Type: EventScrolled})
+	assert.Equal(t, stateHasCursorTarget, eng.state, "stage still out of view")
+
+	buf.viewportTop, buf.viewportBottom = 100, 149
+	eng.handleEvent(Event{Type: EventScrolled})
+
+	assert.Equal(t, stateHasCompletion, eng.state, "stage shown")
+	assert.Equal(t, 120, buf.lastPreparedCompletion.startLine, "stage rendered")
+	assert.Equal(t, 1, buf.showCursorTargetCalls, "indicator not re-rendered")
+}
+
+func TestScrolled_KeepsIndicatorOfCursorOnlyTarget(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = make([]string, 200)
+	buf.viewportTop, buf.viewportBottom = 1, 50
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.cursorTarget = &types.CursorPredictionTarget{LineNumber: 120}
+	eng.state = stateHasCursorTarget
+	eng.showCursorTarget(120)
+
+	buf.viewportTop, buf.viewportBottom = 100, 149
+	eng.handleEvent(Event{Type: EventScrolled})
+
+	assert.Equal(t, stateHasCursorTarget, eng.state, "nothing to show but the target")
+	assert.Equal(t, 2, buf.showCursorTargetCalls, "indicator re-rendered")
+}
+
+func TestScrolled_IgnoredWithoutCursorTarget(t *testing.T) {
+	buf := newMockBuffer()
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	buf.viewportTop, buf.viewportBottom = 100, 150
+	eng.handleEvent(Event{Type: EventScrolled})
+
+	assert.Equal(t, 0, buf.showCursorTargetCalls, "no render")
+	assert.Equal(t, 0, buf.clearUICalls, "no clear")
+}
+
+func TestScrolled_IgnoresClearedTarget(t *testing.T) {
+	buf := newMockBuffer()
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.state = stateHasCursorTarget
+	eng.showCursorTarget(40)
+	eng.clearState(ClearOptions{ClearCursorTarget: true})
+
+	buf.viewportTop, buf.viewportBottom = 100, 150
+	eng.handleEvent(Event{Type: EventScrolled})
+
+	assert.Equal(t, 1, buf.showCursorTargetCalls, "cleared target not re-rendered")
+}
+
+func TestMetricSenders_DisableTelemetryKeepsLocalSinks(t *testing.T) {
+	prov := &metricsProvider{id: "p-1"}
+	sink := &metricsProvider{}
+	identified := metrics.Event{Type: metrics.EventShown, Info: metrics.CompletionInfo{ID: "p-1"}}
+
+	eng, err := NewEngine(prov, newMockBuffer(), EngineConfig{DisableTelemetry: true}, newMockClock(), nil)
+	assert.NoError(t, err, "NewEngine")
+	eng.AddMetricsSink(sink)
+
+	senders := eng.metricSenders(identified)
+	assert.Len(t, 1, senders, "only the local sink")
+	assert.True(t, senders[0] == metrics.Sender(sink), "local sink")
+
+	eng.handleEvent(Event{Type: EventConfigReload, Data: EngineConfig{}})
+	assert.Len(t, 2, eng.metricSenders(identified), "backend once telemetry is reloaded on")
+}
+
+func TestMetricSenders_LocalSinksGetUnidentifiedEvents(t *testing.T) {
+	prov := &metricsProvider{id: "p-1"}
+	sink := &metricsProvider{}
+	eng, err := NewEngine(prov, newMockBuffer(), EngineConfig{}, newMockClock(), nil)
+	assert.NoError(t, err, "NewEngine")
+	eng.AddMetricsSink(sink)
+
+	senders := eng.metricSenders(metrics.Event{Type: metrics.EventShown})
+
+	assert.Len(t, 1, senders, "provider without a completion ID skipped")
+	assert.True(t, senders[0] == metrics.Sender(sink), "local sink")
+}
+
+func TestNewEngine_ContextLimitOverrides(t *testing.T) {
+	eng, err := NewEngine(newMockProvider(), newMockBuffer(), EngineConfig{
+		ContextLimits: ContextLimits{MaxInputLines: 500, MaxOutputTokens: 64},
+	}, newMockClock(), nil)
+	assert.NoError(t, err, "NewEngine")
+
+	defaults := DefaultContextLimits()
+	assert.Equal(t, 500, eng.contextLimits.MaxInputLines, "overridden input lines")
+	assert.Equal(t, 64, eng.contextLimits.MaxOutputTokens, "overridden output tokens")
+	assert.Equal(t, defaults.MaxInputBytes, eng.contextLimits.MaxInputBytes, "input bytes kept")
+	assert.Equal(t, defaults.MaxUserActions, eng.contextLimits.MaxUserActions, "other limits kept")
+}
@@ -7,6 +7,8 @@ import (
 	"sync/atomic"
 
 	"cursortab/logger"
+	"cursortab/metrics"
+	"cursortab/quality"
 	"cursortab/types"
 )
 
@@ -15,20 +17,42 @@ type EventType string
 
 // Event type constants
 const (
-	EventEsc               EventType = "esc"
-	EventTextChanged       EventType = "text_changed"
-	EventTextChangeTimeout EventType = "text_change_timeout"
-	EventTrigger           EventType = "trigger_completion"
-	EventCursorMoved       EventType = "cursor_moved"
-	EventInsertEnter       EventType = "insert_enter"
-	EventInsertLeave       EventType = "insert_leave"
-	EventAccept            EventType = "accept"
-	EventPartialAccept     EventType = "partial_accept"
-	EventIdleTimeout       EventType = "idle_timeout"
-	EventCompletionReady   EventType = "completion_ready"
-	EventCompletionError   EventType = "completion_error"
-	EventPrefetchReady     EventType = "prefetch_ready"
-	EventPrefetchError     EventType = "prefetch_error"
+	EventEsc                 EventType = "esc"
+	EventTextChanged         EventType = "text_changed"
+	EventTextChangeTimeout   EventType = "text_change_timeout"
+	EventManualTrigger       EventType = "manual_trigger"
+	EventCursorMoved         EventType = "cursor_moved"
+	EventInsertEnter         EventType = "insert_enter"
+	EventInsertLeave         EventType = "insert_leave"
+	EventAccept              EventType = "accept"
+	EventPartialAcceptWord   EventType = "partial_accept_word"
+	EventPartialAcceptLine   EventType = "partial_accept_line"
+	EventAcceptInPlace       EventType = "accept_in_place"
+	EventRejectStage         EventType = "reject_stage"
+	EventNextSuggestion      EventType = "next_suggestion"
+	EventPrevSuggestion      EventType = "prev_suggestion"
+	EventIdleTimeout         EventType = "idle_timeout"
+	EventScanTimeout         EventType = "scan_timeout"
+	EventScanReady           EventType = "scan_ready"
+	EventTargetPrefetchReady EventType = "target_prefetch_ready"
+	EventRenameFilesReady    EventType = "rename_files_ready"
+	EventCompletionReady     EventType = "completion_ready"
+	EventCompletionError     EventType = "completion_error"
+	EventPrefetchReady       EventType = "prefetch_ready"
+	EventPrefetchError       EventType = "prefetch_error"
+	EventSpeculativeReady    EventType = "speculative_ready"
+	EventSpeculativeError    EventType = "speculative_error"
+	EventConfigReload        EventType = "config_reload"
+	EventKillSwitch          EventType = "kill_switch"
+	EventTrust               EventType = "trust"
+	EventDisplayExpired      EventType = "display_expired"
+	EventScrolled            EventType = "scrolled"
+	EventRequestSlotFree     EventType = "request_slot_free"
+	EventConnectivityProbe   EventType = "connectivity_probe"
+	EventConnectivityChecked EventType = "connectivity_checked"
+	EventContextInjected     EventType = "context_injected"
+	EventBufferLines         EventType = "buffer_lines"
+	EventBufferClosed        EventType = "buffer_closed"
 
 	// Streaming events (handled directly via channel selection, not through eventChan)
 	EventStreamLine     EventType = "stream_line"     // A line was received from the stream
@@ -62,17 +86,39 @@ func buildEventTypeMap() map[string]EventType {
 		EventEsc,
 		EventTextChanged,
 		EventTextChangeTimeout,
-		EventTrigger,
+		EventManualTrigger,
 		EventCursorMoved,
 		EventInsertEnter,
 		EventInsertLeave,
 		EventAccept,
-		EventPartialAccept,
+		EventPartialAcceptWord,
+		EventPartialAcceptLine,
+		EventAcceptInPlace,
+		EventRejectStage,
+		EventNextSuggestion,
+		EventPrevSuggestion,
 		EventIdleTimeout,
+		EventScanTimeout,
+		EventScanReady,
+		EventTargetPrefetchReady,
+		EventRenameFilesReady,
 		EventCompletionReady,
 		EventCompletionError,
 		EventPrefetchReady,
 		EventPrefetchError,
+		EventSpeculativeReady,
+		EventSpeculativeError,
+		EventConfigReload,
+		EventKillSwitch,
+		EventTrust,
+		EventDisplayExpired,
+		EventScrolled,
+		EventRequestSlotFree,
+		EventConnectivityProbe,
+		EventConnectivityChecked,
+		EventContextInjected,
+		EventBufferLines,
+		EventBufferClosed,
 		EventStreamLine,
 		EventStreamComplete,
 		EventStreamError,
@@ -126,12 +172,20 @@ type Transition struct {
 //	                                     (prefetch?) --> HasCompl. or Pending
 //
 //	Rejection (any -> Idle): Esc, InsertLeave, TextChanged mismatch
+//	Salvage (Streaming): TextChanged typing the streamed lines keeps a line stream alive
+//	Expiry (HasCompl./HasCursorTgt -> Idle): DisplayExpired with cursor outside the suggestion
+//	AcceptInPlace (HasCompl./HasCursorTgt): applies the stage without moving the cursor
+//	RejectStage (HasCompl./HasCursorTgt): skips the stage and shows the next one, or rejects
+//	Next/PrevSuggestion (HasCompl.): shows another candidate of the same response
+//	Scrolled (HasCursorTgt): re-renders the jump indicator if the target entered or left the viewport,
+//	                         or shows the stage it points to once scrolled into view
 //	CursorMoved: resets idle timer (any state)
 var transitions = []Transition{
 	// From stateIdle
 	{stateIdle, EventTextChangeTimeout, (*Engine).doRequestCompletion},
-	{stateIdle, EventTrigger, (*Engine).doManualTrigger},
+	{stateIdle, EventManualTrigger, (*Engine).doManualTrigger},
 	{stateIdle, EventIdleTimeout, (*Engine).doRequestIdleCompletion},
+	{stateIdle, EventScanTimeout, (*Engine).doScan},
 	{stateIdle, EventCursorMoved, (*Engine).doResetIdleTimer},
 	{stateIdle, EventInsertEnter, (*Engine).doStopIdleTimer},
 	{stateIdle, EventInsertLeave, (*Engine).doStartIdleTimer},
@@ -146,23 +200,34 @@ var transitions = []Transition{
 
 	// From stateHasCompletion
 	{stateHasCompletion, EventAccept, (*Engine).doAcceptCompletion},
-	{stateHasCompletion, EventPartialAccept, (*Engine).doPartialAcceptCompletion},
+	{stateHasCompletion, EventPartialAcceptWord, (*Engine).doPartialAcceptWord},
+	{stateHasCompletion, EventPartialAcceptLine, (*Engine).doPartialAcceptLine},
+	{stateHasCompletion, EventAcceptInPlace, (*Engine).doAcceptInPlace},
+	{stateHasCompletion, EventRejectStage, (*Engine).doRejectStage},
+	{stateHasCompletion, EventNextSuggestion, (*Engine).doNextSuggestion},
+	{stateHasCompletion, EventPrevSuggestion, (*Engine).doPrevSuggestion},
 	{stateHasCompletion, EventEsc, (*Engine).doReject},
 	{stateHasCompletion, EventTextChanged, (*Engine).doTextChangeWithCompletion},
 	{stateHasCompletion, EventInsertLeave, (*Engine).doRejectAndStartIdleTimer},
-	{stateHasCompletion, EventCursorMoved, (*Engine).doResetIdleTimer},
+	{stateHasCompletion, EventCursorMoved, (*Engine).doCursorMovedWithCompletion},
+	{stateHasCompletion, EventDisplayExpired, (*Engine).doDisplayExpired},
 
 	// From stateHasCursorTarget
 	{stateHasCursorTarget, EventAccept, (*Engine).doAcceptCursorTarget},
+	{stateHasCursorTarget, EventAcceptInPlace, (*Engine).doAcceptInPlace},
+	{stateHasCursorTarget, EventRejectStage, (*Engine).doRejectStage},
 	{stateHasCursorTarget, EventEsc, (*Engine).doReject},
 	{stateHasCursorTarget, EventTextChanged, (*Engine).doRejectAndDebounce},
 	{stateHasCursorTarget, EventInsertLeave, (*Engine).doRejectAndStartIdleTimer},
 	{stateHasCursorTarget, EventCursorMoved, (*Engine).doResetIdleTimer},
+	{stateHasCursorTarget, EventDisplayExpired, (*Engine).doDisplayExpired},
+	{stateHasCursorTarget, EventScrolled, (*Engine).doScrolled},
 
 	// From stateStreamingCompletion
 	{stateStreamingCompletion, EventAccept, (*Engine).doAcceptStreamingCompletion},
 	{stateStreamingCompletion, EventEsc, (*Engine).doRejectStreaming},
-	{stateStreamingCompletion, EventPartialAccept, (*Engine).doPartialAcceptStreaming},
+	{stateStreamingCompletion, EventPartialAcceptWord, (*Engine).doPartialAcceptWordStreaming},
+	{stateStreamingCompletion, EventPartialAcceptLine, (*Engine).doPartialAcceptLineStreaming},
 	{stateStreamingCompletion, EventTextChanged, (*Engine).doRejectStreamingAndDebounce},
 	{stateStreamingCompletion, EventInsertLeave, (*Engine).doRejectStreamingAndStartIdleTimer},
 	{stateStreamingCompletion, EventCursorMoved, (*Engine).doResetIdleTimer},
@@ -191,11 +256,9 @@ func (e *Engine) dispatch(event Event) bool {
 		t.Action(e, event)
 	}
 
-	// Post-dispatch: Record user actions for RecentUserActions
-	switch event.Type {
-	case EventTextChanged:
-		e.recordTextChangeAction()
-	case EventCursorMoved:
+	// Post-dispatch: Record cursor movements for RecentUserActions. Edits are
+	// recorded as the editor reports them (see recordEditAction).
+	if event.Type == EventCursorMoved {
 		e.recordCursorMovementAction()
 	}
 
@@ -255,11 +318,14 @@ func (e *Engine) eventLoop(ctx context.Context) {
 			}
 			if !ok {
 				e.handleStreamCompleteSimple()
+				e.updateDisplayTimer()
+				e.publishProgress()
 				e.mu.Unlock()
 				continue
 			}
 			e.streamLineNum++
 			e.handleStreamLine(line)
+			e.publishProgress()
 			e.mu.Unlock()
 
 		case text, ok := <-tokenChan:
@@ -274,10 +340,13 @@ func (e *Engine) eventLoop(ctx context.Context) {
 			}
 			if !ok {
 				e.handleTokenStreamComplete()
+				e.updateDisplayTimer()
+				e.publishProgress()
 				e.mu.Unlock()
 				continue
 			}
 			e.handleTokenChunk(text)
+			e.publishProgress()
 			e.mu.Unlock()
 
 		case event, ok := <-e.eventChan:
@@ -312,6 +381,8 @@ func (e *Engine) handleEvent(event Event) {
 	if e.stopped {
 		return
 	}
+	defer e.publishProgress()
+	defer e.updateDisplayTimer()
 
 	logger.Debug("handle event: %v (state=%s)", event.Type, e.state)
 	defer func() {
@@ -326,6 +397,21 @@ func (e *Engine) handleEvent(event Event) {
 		e.inInsertMode = false
 	}
 
+	// Open buffers are tracked whatever the state
+	if e.handleBufferEvent(event) {
+		return
+	}
+
+	// Layer 0: Runtime control (config reload, kill switch)
+	if e.handleControlEvent(event) {
+		return
+	}
+
+	// Help, terminal and unmodifiable buffers get no completions
+	if e.skipIneligibleBuffer(event) {
+		return
+	}
+
 	// Layer 1: Background/async results
 	if e.handleBackgroundEvent(event) {
 		return
@@ -343,10 +429,69 @@ func (e *Engine) handleEvent(event Event) {
 	}
 }
 
+// handleControlEvent applies runtime control events and swallows every other
+// event while the kill switch is engaged.
+func (e *Engine) handleControlEvent(event Event) bool {
+	switch event.Type {
+	case EventConfigReload:
+		config, ok := event.Data.(EngineConfig)
+		if !ok {
+			return true
+		}
+		e.applyConfig(config)
+		logger.Debug("engine config reloaded")
+		return true
+
+	case EventKillSwitch:
+		disabled, ok := event.Data.(bool)
+		if !ok || disabled == e.disabled {
+			return true
+		}
+		e.disabled = disabled
+		if disabled {
+			e.suspend()
+			logger.Info("kill switch engaged, completions disabled")
+		} else {
+			logger.Info("kill switch released, completions enabled")
+		}
+		return true
+
+	case EventTrust:
+		trusted, ok := event.Data.(bool)
+		if !ok || trusted != e.untrusted {
+			return true
+		}
+		e.untrusted = !trusted
+		if e.untrusted {
+			e.suspend()
+			logger.Info("workspace untrusted, completions disabled")
+		} else {
+			logger.Info("workspace trusted, completions enabled")
+		}
+		return true
+
+	case EventContextInjected:
+		// Kept while completions are blocked, so collections resume after
+		e.handleContextInjected(event.Data.(injectedChunks))
+		return true
+	}
+	return e.disabled || e.untrusted
+}
+
+// suspend drops all completion state and timers when completions get blocked.
+func (e *Engine) suspend() {
+	e.cancelStreaming()
+	e.clearAll()
+	e.stopIdleTimer()
+	e.stopTextChangeTimer()
+	e.state = stateIdle
+}
+
 // handleBackgroundEvent handles async completion and prefetch results.
 func (e *Engine) handleBackgroundEvent(event Event) bool {
 	switch event.Type {
 	case EventCompletionReady:
+		e.requestSucceeded()
 		if e.state != statePendingCompletion {
 			return true
 		}
@@ -359,12 +504,21 @@ func (e *Engine) handleBackgroundEvent(event Event) bool {
 		return true
 
 	case EventCompletionError:
-		if err, ok := event.Data.(error); !ok || !errors.Is(err, context.Canceled) {
+		err, _ := event.Data.(error)
+		if errors.Is(err, context.Canceled) {
+			return true
+		}
+		if e.requestFailed(err) {
+			logger.Debug("completion error while offline: %v", err)
+		} else {
 			logger.Error("completion error: %v", event.Data)
 		}
+		e.finishQuality(quality.OutcomeError)
+		e.statsFailed()
 		return true
 
 	case EventPrefetchReady:
+		e.requestSucceeded()
 		if e.prefetchState != prefetchInFlight &&
 			e.prefetchState != prefetchWaitingForTab &&
 			e.prefetchState != prefetchWaitingForCursorPrediction {
@@ -374,16 +528,64 @@ func (e *Engine) handleBackgroundEvent(event Event) bool {
 		return true
 
 	case EventPrefetchError:
+		err, _ := event.Data.(error)
+		if err != nil && e.requestFailed(err) {
+			logger.Debug("prefetch error while offline: %v", err)
+			err = nil
+		}
 		if e.prefetchState != prefetchInFlight &&
 			e.prefetchState != prefetchWaitingForTab &&
 			e.prefetchState != prefetchWaitingForCursorPrediction {
 			return true
 		}
-		if err, ok := event.Data.(error); ok {
-			e.handlePrefetchError(err)
-		} else {
-			e.handlePrefetchError(nil)
+		e.handlePrefetchError(err)
+		return true
+
+	case EventScanReady:
+		result := event.Data.(scanResult)
+		if result.err == nil {
+			e.requestSucceeded()
+		}
+		e.handleScanResult(result)
+		return true
+
+	case EventTargetPrefetchReady:
+		result := event.Data.(targetResult)
+		if result.err == nil {
+			e.requestSucceeded()
 		}
+		e.handleTargetResult(result)
+		return true
+
+	case EventRenameFilesReady:
+		e.handleRenameFiles(event.Data.(renameResult))
+		return true
+
+	case EventSpeculativeReady:
+		e.requestSucceeded()
+		e.handleSpeculativeReady(event.Data.(speculativeResult))
+		return true
+
+	case EventSpeculativeError:
+		result := event.Data.(speculativeResult)
+		if result.err != nil && e.requestFailed(result.err) {
+			logger.Debug("speculative prefetch error while offline: %v", result.err)
+			result.err = nil
+		}
+		e.handleSpeculativeError(result)
+		return true
+
+	case EventRequestSlotFree:
+		e.sendQueuedRequest()
+		return true
+
+	case EventConnectivityProbe:
+		e.probeConnectivity()
+		return true
+
+	case EventConnectivityChecked:
+		err, _ := event.Data.(error)
+		e.handleConnectivityChecked(err)
 		return true
 	}
 	return false
@@ -392,6 +594,9 @@ func (e *Engine) handleBackgroundEvent(event Event) bool {
 // Action functions for state transitions
 
 func (e *Engine) doRequestCompletion(event Event) {
+	if e.holdPasteRequest() {
+		return
+	}
 	e.requestCompletion(types.CompletionSourceTyping)
 }
 
@@ -401,7 +606,7 @@ func (e *Engine) doManualTrigger(event Event) {
 }
 
 func (e *Engine) doRequestIdleCompletion(event Event) {
-	if e.state == stateIdle {
+	if e.state == stateIdle && !e.offline && !e.holdPasteRequest() {
 		e.requestCompletion(types.CompletionSourceIdle)
 	}
 }
@@ -411,6 +616,13 @@ func (e *Engine) doResetIdleTimer(event Event) {
 	e.resetIdleTimer()
 }
 
+func (e *Engine) doCursorMovedWithCompletion(event Event) {
+	if e.stickCompletion() {
+		return
+	}
+	e.doResetIdleTimer(event)
+}
+
 func (e *Engine) doStopIdleTimer(event Event) {
 	e.stopIdleTimer()
 }
@@ -423,6 +635,62 @@ func (e *Engine) doStartTextChangeTimer(event Event) {
 	e.startTextChangeTimer()
 }
 
+// doDisplayExpired dismisses a completion that outlived the display TTL.
+// The TTL is paused (re-armed) while the cursor sits on the suggestion.
+func (e *Engine) doDisplayExpired(event Event) {
+	if gen, ok := event.Data.(int); !ok || gen != e.displayGen {
+		return
+	}
+	if e.cursorInDisplayedRange() {
+		e.startDisplayTimer()
+		return
+	}
+
+	logger.Debug("completion expired after %v", e.config.DisplayTTL)
+	if e.awaitingOutcome() {
+		e.sendMetric(metrics.EventIgnored)
+	}
+	e.clearState(ClearOptions{CancelCurrent: true, CancelPrefetch: true, ClearStaged: true, ClearCursorTarget: true})
+	e.buffer.ClearUI()
+	e.state = stateIdle
+}
+
+// doScrolled re-renders the jump indicator when scrolling moved its target
+// into or out of the viewport, or shows the stage it points to once in view.
+// Scrolls that keep it on the same side leave the indicator untouched.
+func (e *Engine) doScrolled(event Event) {
+	e.syncBuffer()
+	if e.targetView.line == 0 {
+		return
+	}
+	top, bottom := e.buffer.ViewportBounds()
+	visibility := targetVisibilityOf(e.targetView.line, top, bottom)
+	if visibility == e.targetView.visibility {
+		return
+	}
+	if visibility == targetVisible && e.showScrolledStage() {
+		return
+	}
+	e.renderCursorTarget(e.targetView.line)
+}
+
+// showScrolledStage shows the stage the jump indicator points to, now that the
+// user scrolled it into view, so that it can be accepted without the jump.
+// Returns false when the indicator is not for a stage of this file.
+func (e *Engine) showScrolledStage() bool {
+	if e.cursorTarget == nil || !e.hasMoreStages() || e.isOtherFile(e.cursorTarget) {
+		return false
+	}
+	stage := e.getStage(e.stagedCompletion.CurrentIdx)
+	if stage == nil || stage.BufferStart != int(e.cursorTarget.LineNumber) {
+		return false
+	}
+	logger.Debug("stage on line %d scrolled into view", stage.BufferStart)
+	e.targetView = targetView{}
+	e.showCurrentStage()
+	return true
+}
+
 func (e *Engine) doTextChangePending(event Event) {
 	if e.currentCancel != nil {
 		e.currentCancel()
@@ -437,6 +705,19 @@ func (e *Engine) doReject(event Event) {
 	e.stopIdleTimer()
 }
 
+func (e *Engine) doRejectStage(event Event) {
+	e.rejectStage()
+	e.stopIdleTimer()
+}
+
+func (e *Engine) doNextSuggestion(event Event) {
+	e.cycleSuggestion(1)
+}
+
+func (e *Engine) doPrevSuggestion(event Event) {
+	e.cycleSuggestion(-1)
+}
+
 func (e *Engine) doRejectAndDebounce(event Event) {
 	e.reject()
 	e.startTextChangeTimer()
@@ -455,21 +736,36 @@ func (e *Engine) doAcceptCursorTarget(event Event) {
 	e.acceptCursorTarget()
 }
 
+func (e *Engine) doAcceptInPlace(event Event) {
+	e.acceptInPlace()
+}
+
 func (e *Engine) doTextChangeWithCompletion(event Event) {
 	e.handleTextChangeImpl()
 }
 
-func (e *Engine) doPartialAcceptCompletion(event Event) {
+func (e *Engine) doPartialAcceptWord(event Event) {
 	e.partialAcceptCompletion()
 }
 
-func (e *Engine) doPartialAcceptStreaming(event Event) {
+func (e *Engine) doPartialAcceptLine(event Event) {
+	e.partialAcceptLine()
+}
+
+func (e *Engine) doPartialAcceptWordStreaming(event Event) {
 	if e.streamingState != nil && e.streamingState.FirstStageRendered {
 		e.cancelLineStreamingKeepPartial()
 		e.partialAcceptCompletion()
 	}
 }
 
+func (e *Engine) doPartialAcceptLineStreaming(event Event) {
+	if e.streamingState != nil && e.streamingState.FirstStageRendered {
+		e.cancelLineStreamingKeepPartial()
+		e.partialAcceptLine()
+	}
+}
+
 // Streaming state action functions
 
 func (e *Engine) doRejectStreaming(event Event) {
@@ -488,6 +784,7 @@ func (e *Engine) cancelStreamAndCheckTyping(cancelFn func()) bool {
 	if matches {
 		if hasRemaining {
 			e.state = stateHasCompletion
+			e.consumeTypedText()
 			return true
 		}
 		e.clearAll()
@@ -501,6 +798,10 @@ func (e *Engine) cancelStreamAndCheckTyping(cancelFn func()) bool {
 }
 
 func (e *Engine) doRejectStreamingAndDebounce(event Event) {
+	if e.salvageLineStream() {
+		return
+	}
+
 	if e.tokenStreamingState != nil && len(e.completions) > 0 {
 		e.cancelStreamAndCheckTyping(e.cancelTokenStreamingKeepPartial)
 		return
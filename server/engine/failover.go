@@ -0,0 +1,260 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"cursortab/logger"
+	"cursortab/metrics"
+	"cursortab/types"
+)
+
+// Compile-time checks that FailoverProvider implements the required interfaces
+var _ Provider = (*FailoverProvider)(nil)
+var _ metrics.Sender = (*FailoverProvider)(nil)
+
+const (
+	// FailoverServerErrors is the number of consecutive 5xx responses after
+	// which a provider is taken out of rotation. Timeouts take it out at once.
+	FailoverServerErrors = 3
+
+	// FailoverCooldown is how long a failed provider is skipped before it is
+	// tried again, unless a health check clears it sooner.
+	FailoverCooldown = time.Minute
+
+	// HealthCheckInterval is how often providers with a health check are pinged.
+	HealthCheckInterval = 30 * time.Second
+
+	healthCheckTimeout = 5 * time.Second
+)
+
+// serverErrorPattern matches the status errors returned by provider clients.
+var serverErrorPattern = regexp.MustCompile(`status 5\d\d\b`)
+
+// HealthCheck reports whether a provider's backend is reachable.
+type HealthCheck func(ctx context.Context) error
+
+// FailoverMember is one provider in a failover chain.
+type FailoverMember struct {
+	Name     string
+	Model    string // Empty when the provider has no configured model
+	Provider Provider
+	Check    HealthCheck // nil: judged by request failures only
+}
+
+// FailoverProvider serves each request from the first provider in its chain
+// that is not out of rotation. Providers leave the rotation when they time
+// out or keep returning server errors, and rejoin after FailoverCooldown or
+// once their health check passes. Like RaceProvider, it always runs in batch mode.
+type FailoverProvider struct {
+	members  []FailoverMember
+	clock    Clock
+	onSwitch func(name string)
+
+	mu           sync.Mutex
+	active       int
+	serverErrors []int
+	downUntil    []time.Time
+	servedID     string         // Metrics ID of the last response
+	served       metrics.Sender // Provider that produced servedID (nil if it has no metrics)
+}
+
+// NewFailoverProvider creates a failover chain over the given members, in
+// order of preference. onSwitch (optional) is called with the member name
+// whenever the serving provider changes.
+func NewFailoverProvider(clock Clock, onSwitch func(name string), members ...FailoverMember) *FailoverProvider {
+	return &FailoverProvider{
+		members:      members,
+		clock:        clock,
+		onSwitch:     onSwitch,
+		serverErrors: make([]int, len(members)),
+		downUntil:    make([]time.Time, len(members)),
+	}
+}
+
+// ActiveName returns the name of the provider currently serving completions.
+func (f *FailoverProvider) ActiveName() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.members[f.active].Name
+}
+
+// ActiveModel returns the model of the provider currently serving completions.
+func (f *FailoverProvider) ActiveModel() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.members[f.active].Model
+}
+
+// GetContextLimits implements Provider with the limits of the provider
+// currently serving completions.
+func (f *FailoverProvider) GetContextLimits() ContextLimits {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.members[f.active].Provider.GetContextLimits()
+}
+
+// GetCompletion implements Provider
+func (f *FailoverProvider) GetCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
+	defer logger.Trace("FailoverProvider.GetCompletion")()
+
+	f.mu.Lock()
+	switched := f.selectLocked()
+	index := f.active
+	f.mu.Unlock()
+	f.notify(switched)
+
+	resp, err := f.members[index].Provider.GetCompletion(ctx, req)
+	f.report(index, resp, err)
+	return resp, err
+}
+
+// SendMetric implements metrics.Sender by forwarding events to the provider
+// that produced the completion.
+func (f *FailoverProvider) SendMetric(ctx context.Context, event metrics.Event) {
+	f.mu.Lock()
+	served, servedID := f.served, f.servedID
+	f.mu.Unlock()
+
+	if served == nil || servedID != event.Info.ID {
+		return
+	}
+	served.SendMetric(ctx, event)
+}
+
+// RunHealthChecks pings the members with a health check every
+// HealthCheckInterval until ctx is done.
+func (f *FailoverProvider) RunHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		f.checkHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHealth runs every member's health check once. Failing members leave the
+// rotation, passing ones rejoin it, so the chain fails back to the primary as
+// soon as it recovers.
+func (f *FailoverProvider) checkHealth(ctx context.Context) {
+	healthy := make([]bool, len(f.members))
+	for i, m := range f.members {
+		if m.Check == nil {
+			continue
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		err := m.Check(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Debug("failover: health check for %s failed: %v", m.Name, err)
+		}
+		healthy[i] = err == nil
+	}
+
+	f.mu.Lock()
+	now := f.clock.Now()
+	for i, m := range f.members {
+		if m.Check == nil {
+			continue
+		}
+		if healthy[i] {
+			f.downUntil[i] = time.Time{}
+			f.serverErrors[i] = 0
+		} else {
+			f.downUntil[i] = now.Add(FailoverCooldown)
+		}
+	}
+	switched := f.selectLocked()
+	f.mu.Unlock()
+	f.notify(switched)
+}
+
+// report records the outcome of a request served by member index.
+func (f *FailoverProvider) report(index int, resp *types.CompletionResponse, err error) {
+	f.mu.Lock()
+	name := f.members[index].Name
+
+	switch {
+	case err == nil:
+		f.serverErrors[index] = 0
+		f.served, f.servedID = nil, ""
+		if resp != nil && resp.MetricsInfo != nil {
+			if sender, ok := f.members[index].Provider.(metrics.Sender); ok {
+				f.served, f.servedID = sender, resp.MetricsInfo.ID
+			}
+		}
+		f.mu.Unlock()
+		return
+	case isTimeout(err):
+		logger.Warn("failover: %s timed out, taking it out of rotation", name)
+		f.markDownLocked(index)
+	case serverErrorPattern.MatchString(err.Error()):
+		f.serverErrors[index]++
+		if f.serverErrors[index] < FailoverServerErrors {
+			f.mu.Unlock()
+			return
+		}
+		logger.Warn("failover: %s returned %d server errors in a row, taking it out of rotation", name, f.serverErrors[index])
+		f.markDownLocked(index)
+	default:
+		f.mu.Unlock()
+		return
+	}
+
+	switched := f.selectLocked()
+	f.mu.Unlock()
+	f.notify(switched)
+}
+
+// markDownLocked takes a member out of rotation for FailoverCooldown.
+func (f *FailoverProvider) markDownLocked(index int) {
+	f.downUntil[index] = f.clock.Now().Add(FailoverCooldown)
+	f.serverErrors[index] = 0
+}
+
+// selectLocked makes the first member in rotation active, falling back to the
+// primary when every member is out. Returns the new name if the active member changed.
+func (f *FailoverProvider) selectLocked() string {
+	now := f.clock.Now()
+	next := 0
+	for i := range f.members {
+		if !now.Before(f.downUntil[i]) {
+			next = i
+			break
+		}
+	}
+	if next == f.active {
+		return ""
+	}
+	f.active = next
+	logger.Info("failover: now serving completions from %s", f.members[next].Name)
+	return f.members[next].Name
+}
+
+// notify reports a switch returned by selectLocked. Must be called without f.mu held.
+func (f *FailoverProvider) notify(name string) {
+	if name != "" && f.onSwitch != nil {
+		f.onSwitch(name)
+	}
+}
+
+// isTimeout reports whether err is a request deadline or network timeout.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
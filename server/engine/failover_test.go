@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/metrics"
+	"cursortab/types"
+)
+
+// scriptedProvider returns err when set, otherwise a completion with its line.
+type scriptedProvider struct {
+	line  string
+	err   error
+	calls int
+}
+
+func (p *scriptedProvider) GetContextLimits() ContextLimits {
+	return DefaultContextLimits()
+}
+
+func (p *scriptedProvider) GetCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return completionWith(p.line), nil
+}
+
+// metricsProvider returns completions tagged with its metrics ID and records
+// the metric events it receives.
+type metricsProvider struct {
+	id     string
+	events []metrics.Event
+}
+
+func (p *metricsProvider) GetContextLimits() ContextLimits {
+	return DefaultContextLimits()
+}
+
+func (p *metricsProvider) GetCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
+	resp := completionWith(p.id)
+	resp.MetricsInfo = &types.MetricsInfo{ID: p.id}
+	return resp, nil
+}
+
+func (p *metricsProvider) SendMetric(ctx context.Context, event metrics.Event) {
+	p.events = append(p.events, event)
+}
+
+func newTestFailover(clock Clock, primary, fallback Provider) (*FailoverProvider, *[]string) {
+	var switches []string
+	f := NewFailoverProvider(clock, func(name string) {
+		switches = append(switches, name)
+	},
+		FailoverMember{Name: "primary", Model: "primary-model", Provider: primary},
+		FailoverMember{Name: "fallback", Model: "fallback-model", Provider: fallback},
+	)
+	return f, &switches
+}
+
+func TestFailoverProvider_ServesFromPrimary(t *testing.T) {
+	primary := &scriptedProvider{line: "primary"}
+	fallback := &scriptedProvider{line: "fallback"}
+	f, switches := newTestFailover(newMockClock(), primary, fallback)
+
+	resp, err := f.GetCompletion(context.Background(), &types.CompletionRequest{})
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Equal(t, "primary", resp.Completions[0].Lines[0], "served completion")
+	assert.Equal(t, 0, fallback.calls, "fallback calls")
+	assert.Equal(t, "primary", f.ActiveName(), "active provider")
+	assert.Len(t, 0, *switches, "switches")
+}
+
+func TestFailoverProvider_TimeoutSwitchesImmediately(t *testing.T) {
+	primary := &scriptedProvider{err: fmt.Errorf("failed to send request: %w", context.DeadlineExceeded)}
+	fallback := &scriptedProvider{line: "fallback"}
+	f, switches := newTestFailover(newMockClock(), primary, fallback)
+
+	_, err := f.GetCompletion(context.Background(), &types.CompletionRequest{})
+	assert.Error(t, err, "primary timeout is returned")
+
+	resp, err := f.GetCompletion(context.Background(), &types.CompletionRequest{})
+	assert.NoError(t, err, "GetCompletion after failover")
+	assert.Equal(t, "fallback", resp.Completions[0].Lines[0], "served completion")
+	assert.Equal(t, "fallback", f.ActiveName(), "active provider")
+	assert.Equal(t, "fallback-model", f.ActiveModel(), "active model")
+	assert.Equal(t, []string{"fallback"}, *switches, "switches")
+}
+
+func TestFailoverProvider_RepeatedServerErrorsSwitch(t *testing.T) {
+	primary := &scriptedProvider{err: errors.New("request failed with status 503: unavailable")}
+	fallback := &scriptedProvider{line: "fallback"}
+	f, _ := newTestFailover(newMockClock(), primary, fallback)
+
+	for i := 1; i < FailoverServerErrors; i++ {
+		f.GetCompletion(context.Background(), &types.CompletionRequest{})
+		assert.Equal(t, "primary", f.ActiveName(), fmt.Sprintf("active after %d server errors", i))
+	}
+	f.GetCompletion(context.Background(), &types.CompletionRequest{})
+
+	assert.Equal(t, "fallback", f.ActiveName(), "active after repeated server errors")
+	assert.Equal(t, FailoverServerErrors, primary.calls, "primary calls")
+}
+
+func TestFailoverProvider_ClientErrorsDoNotSwitch(t *testing.T) {
+	primary := &scriptedProvider{err: errors.New("request failed with status 400: bad request")}
+	fallback := &scriptedProvider{line: "fallback"}
+	f, _ := newTestFailover(newMockClock(), primary, fallback)
+
+	for range FailoverServerErrors + 1 {
+		f.GetCompletion(context.Background(), &types.CompletionRequest{})
+	}
+
+	assert.Equal(t, "primary", f.ActiveName(), "active provider")
+	assert.Equal(t, 0, fallback.calls, "fallback calls")
+}
+
+func TestFailoverProvider_CancellationDoesNotSwitch(t *testing.T) {
+	primary := &scriptedProvider{err: context.Canceled}
+	fallback := &scriptedProvider{line: "fallback"}
+	f, _ := newTestFailover(newMockClock(), primary, fallback)
+
+	f.GetCompletion(context.Background(), &types.CompletionRequest{})
+
+	assert.Equal(t, "primary", f.ActiveName(), "active provider")
+}
+
+func TestFailoverProvider_ContextLimitsOfActiveMember(t *testing.T) {
+	primary := &scriptedProvider{err: context.DeadlineExceeded}
+	fallback := newMockProvider()
+	fallback.limits.MaxInputLines = 100
+	f, _ := newTestFailover(newMockClock(), primary, fallback)
+
+	assert.Equal(t, DefaultContextLimits().MaxInputLines, f.GetContextLimits().MaxInputLines, "primary limits")
+	f.GetCompletion(context.Background(), &types.CompletionRequest{})
+
+	assert.Equal(t, 100, f.GetContextLimits().MaxInputLines, "fallback limits")
+}
+
+func TestFailoverProvider_PrimaryRejoinsAfterCooldown(t *testing.T) {
+	clock := newMockClock()
+	primary := &scriptedProvider{err: context.DeadlineExceeded}
+	fallback := &scriptedProvider{line: "fallback"}
+	f, switches := newTestFailover(clock, primary, fallback)
+
+	f.GetCompletion(context.Background(), &types.CompletionRequest{})
+	primary.err = nil
+	primary.line = "primary"
+	clock.Advance(FailoverCooldown)
+
+	resp, err := f.GetCompletion(context.Background(), &types.CompletionRequest{})
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Equal(t, "primary", resp.Completions[0].Lines[0], "served completion")
+	assert.Equal(t, []string{"fallback", "primary"}, *switches, "switches")
+}
+
+func TestFailoverProvider_HealthChecks(t *testing.T) {
+	primaryErr := errors.New("connection refused")
+	var checkErr error = primaryErr
+	f := NewFailoverProvider(newMockClock(), nil,
+		FailoverMember{Name: "primary", Provider: &scriptedProvider{line: "primary"}, Check: func(ctx context.Context) error {
+			return checkErr
+		}},
+		FailoverMember{Name: "fallback", Provider: &scriptedProvider{line: "fallback"}},
+	)
+
+	f.checkHealth(context.Background())
+	assert.Equal(t, "fallback", f.ActiveName(), "active after failed health check")
+
+	checkErr = nil
+	f.checkHealth(context.Background())
+	assert.Equal(t, "primary", f.ActiveName(), "active after passing health check")
+}
+
+func TestFailoverProvider_AllDownUsesPrimary(t *testing.T) {
+	primary := &scriptedProvider{err: context.DeadlineExceeded}
+	fallback := &scriptedProvider{err: context.DeadlineExceeded}
+	f, _ := newTestFailover(newMockClock(), primary, fallback)
+
+	f.GetCompletion(context.Background(), &types.CompletionRequest{})
+	f.GetCompletion(context.Background(), &types.CompletionRequest{})
+
+	assert.Equal(t, "primary", f.ActiveName(), "active when every provider is down")
+}
+
+func TestFailoverProvider_ForwardsMetricsToServingProvider(t *testing.T) {
+	primary := &metricsProvider{id: "p-1"}
+	fallback := &metricsProvider{id: "f-1"}
+	f := NewFailoverProvider(newMockClock(), nil,
+		FailoverMember{Name: "primary", Provider: primary},
+		FailoverMember{Name: "fallback", Provider: fallback},
+	)
+
+	_, err := f.GetCompletion(context.Background(), &types.CompletionRequest{})
+	assert.NoError(t, err, "GetCompletion")
+
+	f.SendMetric(context.Background(), metrics.Event{Type: metrics.EventAccepted, Info: metrics.CompletionInfo{ID: "p-1"}})
+	f.SendMetric(context.Background(), metrics.Event{Type: metrics.EventAccepted, Info: metrics.CompletionInfo{ID: "f-1"}})
+
+	assert.Len(t, 1, primary.events, "primary events")
+	assert.Len(t, 0, fallback.events, "fallback events")
+}
@@ -0,0 +1,28 @@
+package engine
+
+import (
+	"cursortab/text"
+	"cursortab/types"
+)
+
+// fenceLanguage returns the language of the code fence holding row in a
+// markdown document, or "" for other files and outside fences.
+func fenceLanguage(path string, lines []string, row int) string {
+	if !text.IsFencedDocument(path) {
+		return ""
+	}
+	if f := text.FenceAt(text.FindFences(lines), row); f != nil {
+		return f.Language
+	}
+	return ""
+}
+
+// withinFences reports whether completion stays on one side of the code
+// fences of a markdown document, so prose is not written into code blocks
+// nor code into prose. Completions of other files always pass.
+func withinFences(path string, lines []string, completion *types.Completion) bool {
+	if !text.IsFencedDocument(path) {
+		return true
+	}
+	return text.WithinFences(text.FindFences(lines), lines, completion.StartLine, completion.EndLineInc, completion.Lines)
+}
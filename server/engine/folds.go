@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"cursortab/logger"
+	"cursortab/types"
+)
+
+// revealFolds opens the closed folds hiding the remaining stages of the staged
+// completion, when OpenFolds is set. Otherwise such stages are pointed at
+// from their fold's first line until the user jumps to them.
+func (e *Engine) revealFolds() {
+	if !e.config.OpenFolds || e.stagedCompletion == nil {
+		return
+	}
+	for i := e.stagedCompletion.CurrentIdx; i < len(e.stagedCompletion.Stages); i++ {
+		stage := e.getStage(i)
+		e.openFold(stage.BufferStart)
+		e.openFold(stage.BufferEnd)
+	}
+}
+
+// openFold opens the closed folds hiding line, if any.
+func (e *Engine) openFold(line int) {
+	if start, _ := e.buffer.ClosedFold(line); start == 0 {
+		return
+	}
+	if err := e.buffer.OpenFold(line); err != nil {
+		logger.Warn("open fold at line %d: %v", line, err)
+	}
+}
+
+// foldHeader returns the first line of the closed fold hiding line, where
+// anything drawn for line has to go to be seen, or line itself when it is
+// not folded.
+func (e *Engine) foldHeader(line int) int {
+	if start, _ := e.buffer.ClosedFold(line); start > 0 {
+		return start
+	}
+	return line
+}
+
+// showFoldedStage shows a jump indicator on the fold header in place of a
+// stage that would render on folded lines. Returns false when the stage is
+// not folded.
+func (e *Engine) showFoldedStage(line int) bool {
+	if e.foldHeader(line) == line {
+		return false
+	}
+	e.cursorTarget = &types.CursorPredictionTarget{
+		RelativePath:    e.buffer.Path(),
+		LineNumber:      int32(line),
+		ShouldRetrigger: false,
+	}
+	e.state = stateHasCursorTarget
+	e.showCursorTarget(line)
+	return true
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/text"
+	"cursortab/types"
+)
+
+func newFoldedEngine(t *testing.T) (*Engine, *mockBuffer) {
+	t.Helper()
+	buf := newMockBuffer()
+	buf.lines = make([]string, 40)
+	for i := range buf.lines {
+		buf.lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	buf.row = 1
+	buf.folds = []text.LineRange{{Start: 18, End: 25}}
+	return createTestEngine(buf, newMockProvider(), newMockClock()), buf
+}
+
+func TestFolds_IndicatorOnFoldHeader(t *testing.T) {
+	eng, buf := newFoldedEngine(t)
+
+	eng.processCompletion(&types.Completion{StartLine: 20, EndLineInc: 20, Lines: []string{"new 20"}})
+
+	assert.Equal(t, stateHasCursorTarget, eng.state, "state")
+	assert.Equal(t, int32(20), eng.cursorTarget.LineNumber, "target on the stage")
+	assert.Equal(t, 18, buf.showCursorTargetLine, "indicator on the fold header")
+	assert.Equal(t, 0, buf.openFoldCalls, "fold left closed")
+
+	eng.acceptCursorTarget()
+
+	assert.Equal(t, 20, buf.row, "cursor on the stage")
+	assert.Len(t, 0, buf.folds, "fold opened by the jump")
+	assert.Equal(t, stateHasCompletion, eng.state, "stage shown")
+	assert.Equal(t, 20, buf.lastPreparedCompletion.startLine, "stage rendered")
+}
+
+func TestFolds_StageNextToCursorInFold(t *testing.T) {
+	eng, buf := newFoldedEngine(t)
+	buf.row = 18
+	stage := &text.Stage{BufferStart: 20, BufferEnd: 20, Lines: []string{"new 20"},
+		Groups: []*text.Group{{Type: "modification", BufferLine: 20}}}
+	eng.stagedCompletion = &text.StagedCompletion{Stages: []*text.Stage{stage}}
+
+	eng.showCurrentStage()
+
+	assert.Equal(t, stateHasCursorTarget, eng.state, "indicator instead of the stage")
+	assert.Equal(t, 18, buf.showCursorTargetLine, "indicator on the fold header")
+	assert.Equal(t, 0, buf.prepareCompletionCalls, "stage not rendered")
+}
+
+func TestFolds_OpenFolds(t *testing.T) {
+	eng, buf := newFoldedEngine(t)
+	eng.config.OpenFolds = true
+	buf.row = 19
+
+	eng.processCompletion(&types.Completion{StartLine: 20, EndLineInc: 20, Lines: []string{"new 20"}})
+
+	assert.Equal(t, 1, buf.openFoldCalls, "fold opened")
+	assert.Len(t, 0, buf.folds, "no fold left")
+	assert.Equal(t, stateHasCompletion, eng.state, "stage shown")
+	assert.Equal(t, 20, buf.lastPreparedCompletion.startLine, "stage rendered")
+}
+
+func TestFolds_UnfoldedStageUntouched(t *testing.T) {
+	eng, buf := newFoldedEngine(t)
+	eng.config.OpenFolds = true
+	buf.row = 30
+
+	eng.processCompletion(&types.Completion{StartLine: 31, EndLineInc: 31, Lines: []string{"new 31"}})
+
+	assert.Equal(t, 0, buf.openFoldCalls, "no fold opened")
+	assert.Len(t, 1, buf.folds, "fold kept")
+	assert.Equal(t, stateHasCompletion, eng.state, "stage shown")
+}
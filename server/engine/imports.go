@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"time"
+
+	"cursortab/imports"
+	"cursortab/logger"
+	"cursortab/text"
+	"cursortab/types"
+)
+
+const importTimeout = 500 * time.Millisecond // Limit on the language server code action request
+
+// recordImportSpan extends the lines checked for missing imports with the
+// stage just accepted. Stages of an import or rename proposal are not
+// recorded.
+func (e *Engine) recordImportSpan() {
+	if !e.config.AutoImport || e.addingImports || e.propagatingRename || e.stagedCompletion == nil {
+		return
+	}
+	stage := e.getStage(e.stagedCompletion.CurrentIdx)
+	if stage == nil || len(stage.Lines) == 0 {
+		return
+	}
+	span := text.LineRange{Start: stage.BufferStart, End: stage.BufferStart + len(stage.Lines) - 1}
+	if e.importSpan != nil {
+		span.Start = min(span.Start, e.importSpan.Start)
+		span.End = max(span.End, e.importSpan.End)
+	}
+	e.importSpan = &span
+}
+
+// proposeImports shows the imports the accepted completion refers to but the
+// buffer lacks, as a new staged completion. Returns false when none is
+// missing.
+func (e *Engine) proposeImports() bool {
+	span := e.importSpan
+	e.importSpan = nil
+	e.addingImports = false
+	if span == nil {
+		return false
+	}
+
+	lines := e.buffer.Lines()
+	last := min(span.End, len(lines))
+	if span.Start > last {
+		return false
+	}
+	updated, ok := e.missingImports(lines, span.Start, last)
+	if !ok {
+		return false
+	}
+
+	e.cursorTarget = nil
+	e.addingImports = true
+	if !e.processCompletion(&types.Completion{StartLine: 1, EndLineInc: len(lines), Lines: updated}) {
+		e.addingImports = false
+		return false
+	}
+	logger.Debug("imports: proposing the imports lines %d-%d are missing", span.Start, last)
+	return true
+}
+
+// missingImports returns lines with the imports added that lines first to
+// last need: with the edits of the language servers, or else with the
+// heuristics of the imports package, which copy imports from recent files.
+// Language server edits that do more than add lines, like organizing imports
+// removes unused ones, are not used.
+func (e *Engine) missingImports(lines []string, first, last int) ([]string, bool) {
+	if edits, encoding := e.buffer.ImportEdits(first, last, importTimeout); len(edits) > 0 {
+		updated, err := imports.ApplyEdits(lines, edits, encoding)
+		if err == nil && onlyAdds(lines, updated) {
+			return updated, true
+		}
+		logger.Debug("imports: language server edits not used (err: %v)", err)
+	}
+
+	others := make(map[string][]string, len(e.fileStateStore)+len(e.openBuffers))
+	for path, state := range e.fileStateStore {
+		others[path] = state.FirstLines
+	}
+	for path, buf := range e.openBuffers {
+		others[path] = buf.lines
+	}
+	return imports.Add(e.buffer.Path(), lines, first, last, others)
+}
+
+// onlyAdds reports whether updated holds all of lines, in order, and more.
+func onlyAdds(lines, updated []string) bool {
+	if len(updated) <= len(lines) {
+		return false
+	}
+	i := 0
+	for _, line := range updated {
+		if i < len(lines) && line == lines[i] {
+			i++
+		}
+	}
+	return i == len(lines)
+}
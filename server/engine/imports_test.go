@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/imports"
+	"cursortab/types"
+)
+
+func newImportEngine(t *testing.T) (*Engine, *mockBuffer) {
+	t.Helper()
+	buf := newMockBuffer()
+	buf.lines = []string{"package main", "", "func main() {", "}"}
+	buf.row = 3
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), newMockClock())
+	t.Cleanup(cancel)
+	eng.config.AutoImport = true
+	return eng, buf
+}
+
+// acceptPrintln accepts a completion calling fmt.Println in main.
+func acceptPrintln(eng *Engine, buf *mockBuffer) {
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 3, EndLineInc: 4, Lines: []string{"func main() {", "\tfmt.Println()", "}"}},
+	}})
+	buf.lines = []string{"package main", "", "func main() {", "\tfmt.Println()", "}"}
+	eng.acceptCompletion()
+}
+
+func TestAutoImport_ProposesMissingImport(t *testing.T) {
+	eng, buf := newImportEngine(t)
+
+	acceptPrintln(eng, buf)
+
+	assert.True(t, eng.addingImports, "adding imports")
+	assert.NotNil(t, eng.stagedCompletion, "import stage")
+	assert.Equal(t, []string{"import \"fmt\"", ""}, eng.stagedCompletion.Stages[0].Lines[:2], "import added after the package clause")
+
+	buf.lines = []string{"package main", "", "import \"fmt\"", "", "func main() {", "\tfmt.Println()", "}"}
+	calls := buf.prepareCompletionCalls
+	eng.acceptCompletion()
+
+	assert.False(t, eng.addingImports, "proposal finished")
+	assert.Equal(t, calls, buf.prepareCompletionCalls, "accepting the imports proposes nothing more")
+}
+
+func TestAutoImport_UsesLanguageServerEdits(t *testing.T) {
+	eng, buf := newImportEngine(t)
+	buf.importEdits = []imports.TextEdit{{StartLine: 1, EndLine: 1, NewText: "\nimport \"github.com/x/fmt\""}}
+
+	acceptPrintln(eng, buf)
+
+	assert.True(t, eng.addingImports, "adding imports")
+	assert.Equal(t, "import \"github.com/x/fmt\"", eng.stagedCompletion.Stages[0].Lines[0], "language server import")
+}
+
+func TestAutoImport_IgnoresEditsRemovingLines(t *testing.T) {
+	eng, buf := newImportEngine(t)
+	buf.importEdits = []imports.TextEdit{{StartLine: 0, EndLine: 1, NewText: "package other\nimport \"os\"\n"}}
+
+	acceptPrintln(eng, buf)
+
+	assert.True(t, eng.addingImports, "adding imports")
+	assert.Equal(t, []string{"import \"fmt\"", ""}, eng.stagedCompletion.Stages[0].Lines[:2], "heuristic import")
+}
+
+func TestAutoImport_Disabled(t *testing.T) {
+	eng, buf := newImportEngine(t)
+	eng.config.AutoImport = false
+
+	acceptPrintln(eng, buf)
+
+	assert.False(t, eng.addingImports, "not adding imports")
+	assert.Nil(t, eng.stagedCompletion, "nothing proposed")
+}
+
+func TestOnlyAdds(t *testing.T) {
+	assert.True(t, onlyAdds([]string{"a", "c"}, []string{"a", "b", "c"}), "line inserted")
+	assert.False(t, onlyAdds([]string{"a", "c"}, []string{"a", "c"}), "nothing added")
+	assert.False(t, onlyAdds([]string{"a", "c"}, []string{"a", "b", "d"}), "line replaced")
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"cursortab/logger"
+	"cursortab/types"
+)
+
+// InjectorTimeout is the maximum time allowed for all context injectors of a
+// collection to complete. Chunks collected later are dropped.
+const InjectorTimeout = 200 * time.Millisecond
+
+// ContextInjector is a custom context source whose chunk is forwarded to
+// providers as a retrieval chunk. Collect runs off the event loop after every
+// request, must not modify req, and should return promptly once ctx is done.
+type ContextInjector interface {
+	Name() string
+	Collect(ctx context.Context, req *types.CompletionRequest) types.ContextChunk
+}
+
+// RegisterInjector adds injector to the sources of every following request.
+// Its chunks go ahead of the retrieved ones and are trimmed with them by the
+// context budget.
+func (e *Engine) RegisterInjector(injector ContextInjector) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.injectors = append(e.injectors, injector)
+}
+
+// injectedChunks are the chunks of one injector collection.
+type injectedChunks struct {
+	path   string // Buffer the collection ran for
+	chunks []*types.RetrievalChunk
+}
+
+// injectContext returns the chunks of the last collection for the buffer of
+// req and starts a new one for the next request. Injectors never run on the
+// event loop: their chunks come back as EventContextInjected.
+func (e *Engine) injectContext(req *types.CompletionRequest) []*types.RetrievalChunk {
+	if len(e.injectors) == 0 {
+		return nil
+	}
+
+	if !e.injecting {
+		e.injecting = true
+		injectors, mainCtx := slices.Clone(e.injectors), e.mainCtx
+		snapshot := *req
+		snapshot.Lines = slices.Clone(req.Lines)
+		go func() {
+			chunks := collectInjected(mainCtx, injectors, &snapshot)
+			e.post(Event{Type: EventContextInjected, Data: injectedChunks{path: snapshot.FilePath, chunks: chunks}})
+		}()
+	}
+
+	if e.injected.path != req.FilePath {
+		return nil
+	}
+	return slices.Clone(e.injected.chunks)
+}
+
+// handleContextInjected keeps the chunks of a finished collection.
+func (e *Engine) handleContextInjected(injected injectedChunks) {
+	e.injecting = false
+	e.injected = injected
+}
+
+// collectInjected runs injectors in parallel on req and returns their
+// non-empty chunks in registration order.
+func collectInjected(mainCtx context.Context, injectors []ContextInjector, req *types.CompletionRequest) []*types.RetrievalChunk {
+	ctx, cancel := context.WithTimeout(mainCtx, InjectorTimeout)
+	defer cancel()
+
+	type collected struct {
+		index int
+		chunk types.ContextChunk
+	}
+	done := make(chan collected, len(injectors))
+	for i, injector := range injectors {
+		go func() {
+			done <- collected{i, injector.Collect(ctx, req)}
+		}()
+	}
+
+	chunks := make([]*types.ContextChunk, len(injectors))
+	for range injectors {
+		select {
+		case c := <-done:
+			chunks[c.index] = &c.chunk
+		case <-ctx.Done():
+			for i, chunk := range chunks {
+				if chunk == nil {
+					logger.Warn("context injector %s: %v", injectors[i].Name(), ctx.Err())
+				}
+			}
+			return retrievalChunks(injectors, chunks)
+		}
+	}
+	return retrievalChunks(injectors, chunks)
+}
+
+// retrievalChunks converts the collected chunks of injectors, skipping the
+// empty and missing ones.
+func retrievalChunks(injectors []ContextInjector, chunks []*types.ContextChunk) []*types.RetrievalChunk {
+	var result []*types.RetrievalChunk
+	for i, chunk := range chunks {
+		if chunk == nil || len(chunk.Lines) == 0 {
+			continue
+		}
+		title := chunk.Title
+		if title == "" {
+			title = injectors[i].Name()
+		}
+		result = append(result, &types.RetrievalChunk{FilePath: title, StartLine: 1, Lines: chunk.Lines})
+	}
+	return result
+}
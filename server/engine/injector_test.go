@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+type stubInjector struct {
+	name  string
+	chunk types.ContextChunk
+	block bool
+}
+
+func (s *stubInjector) Name() string { return s.name }
+
+func (s *stubInjector) Collect(ctx context.Context, req *types.CompletionRequest) types.ContextChunk {
+	if s.block {
+		<-ctx.Done()
+	}
+	return s.chunk
+}
+
+func TestInjectContext_ChunksInRegistrationOrder(t *testing.T) {
+	eng, cancel := createTestEngineWithContext(newMockBuffer(), newMockProvider(), newMockClock())
+	defer cancel()
+	eng.RegisterInjector(&stubInjector{name: "schema", chunk: types.ContextChunk{Lines: []string{"CREATE TABLE users"}}})
+	eng.RegisterInjector(&stubInjector{name: "empty"})
+	eng.RegisterInjector(&stubInjector{name: "spec", chunk: types.ContextChunk{Title: "api.yaml", Lines: []string{"paths:"}}})
+
+	chunks := collectInjected(eng.mainCtx, eng.injectors, &types.CompletionRequest{})
+
+	assert.Len(t, 2, chunks, "empty chunk skipped")
+	assert.Equal(t, "schema", chunks[0].FilePath, "untitled chunk uses injector name")
+	assert.Equal(t, "api.yaml", chunks[1].FilePath, "title")
+}
+
+func TestInjectContext_DropsSlowInjector(t *testing.T) {
+	eng, cancel := createTestEngineWithContext(newMockBuffer(), newMockProvider(), newMockClock())
+	defer cancel()
+	eng.RegisterInjector(&stubInjector{name: "slow", block: true, chunk: types.ContextChunk{Lines: []string{"late"}}})
+	eng.RegisterInjector(&stubInjector{name: "fast", chunk: types.ContextChunk{Lines: []string{"on time"}}})
+
+	chunks := collectInjected(eng.mainCtx, eng.injectors, &types.CompletionRequest{})
+
+	assert.Len(t, 1, chunks, "chunks")
+	assert.Equal(t, "fast", chunks[0].FilePath, "fast injector kept")
+}
+
+func TestBuildCompletionRequest_InjectedChunksGoFirst(t *testing.T) {
+	buf := newMockBuffer()
+	buf.path = "user.go"
+	buf.lines = []string{"type User struct {", "\tName string", "}"}
+	prov := newMockProvider()
+	prov.limits.MaxRetrievalChunks = 5
+	eng, cancel := createTestEngineWithContext(buf, prov, newMockClock())
+	defer cancel()
+	eng.retrieveChunks(5, eng.buffer.Row())
+	eng.RegisterInjector(&stubInjector{name: "failures", chunk: types.ContextChunk{Lines: []string{"--- FAIL: TestUser"}}})
+
+	buf.path = "main.go"
+	buf.lines = []string{"package main", "", "u := User{}"}
+	buf.row = 3
+	req := eng.buildCompletionRequest(types.CompletionSourceTyping)
+	assert.Len(t, 1, req.RetrievalChunks, "nothing collected yet")
+	eng.handleEvent(waitForEvent(t, eng, EventContextInjected))
+	req = eng.buildCompletionRequest(types.CompletionSourceTyping)
+
+	assert.Len(t, 2, req.RetrievalChunks, "chunks")
+	assert.Equal(t, "failures", req.RetrievalChunks[0].FilePath, "injected first")
+	assert.Equal(t, "user.go", req.RetrievalChunks[1].FilePath, "retrieved after")
+}
+
+func TestInjectContext_CollectsOffTheEventLoop(t *testing.T) {
+	eng, cancel := createTestEngineWithContext(newMockBuffer(), newMockProvider(), newMockClock())
+	defer cancel()
+	eng.RegisterInjector(&stubInjector{name: "slow", block: true, chunk: types.ContextChunk{Lines: []string{"late"}}})
+	eng.RegisterInjector(&stubInjector{name: "fast", chunk: types.ContextChunk{Lines: []string{"on time"}}})
+
+	start := time.Now()
+	assert.Nil(t, eng.injectContext(&types.CompletionRequest{FilePath: "a.go"}), "first request")
+	assert.True(t, time.Since(start) < InjectorTimeout, "request not held up")
+	assert.Nil(t, eng.injectContext(&types.CompletionRequest{FilePath: "a.go"}), "one collection at a time")
+
+	eng.handleEvent(waitForEvent(t, eng, EventContextInjected))
+	chunks := eng.injectContext(&types.CompletionRequest{FilePath: "a.go"})
+	assert.Len(t, 1, chunks, "chunks of the last collection")
+	assert.Nil(t, eng.injectContext(&types.CompletionRequest{FilePath: "b.go"}), "other buffer")
+}
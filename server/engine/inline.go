@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"cursortab/text"
+	"cursortab/types"
+)
+
+// showInlineInsertion shows a completion that only appends text at the
+// cursor, at the end of the cursor line, as ghost text without diffing and
+// staging it. Accepting it inserts the text directly (see insertInline).
+// Returns false when completion is not such an insertion.
+func (e *Engine) showInlineInsertion(completion *types.Completion) bool {
+	if e.propagatingRename || e.addingImports || len(completion.Lines) != 1 ||
+		completion.StartLine != completion.EndLineInc || completion.StartLine != e.buffer.Row() {
+		return false
+	}
+	lines := e.buffer.Lines()
+	if completion.StartLine < 1 || completion.StartLine > len(lines) {
+		return false
+	}
+	oldLine, newLine := lines[completion.StartLine-1], completion.Lines[0]
+	if len(newLine) <= len(oldLine) || !strings.HasPrefix(newLine, oldLine) || e.buffer.Col() < len(oldLine) {
+		return false
+	}
+
+	group := appendCharsGroup(completion.StartLine, oldLine, newLine)
+	e.stagedCompletion = nil
+	e.cursorTarget = nil
+	e.completions = []*types.Completion{completion}
+	e.completionOriginalLines = []string{oldLine}
+	e.currentGroups = []*text.Group{group}
+	e.inlineInsertion = true
+	e.state = stateHasCompletion
+	e.applyBatch = e.buffer.PrepareCompletion(completion.StartLine, completion.StartLine, completion.Lines, e.currentGroups)
+	return true
+}
+
+// appendCharsGroup is the group rendering newLine as text appended to oldLine,
+// the content of buffer line line.
+func appendCharsGroup(line int, oldLine, newLine string) *text.Group {
+	return &text.Group{
+		Type:       "modification",
+		StartLine:  1,
+		EndLine:    1,
+		BufferLine: line,
+		Lines:      []string{newLine},
+		OldLines:   []string{oldLine},
+		RenderHint: "append_chars",
+		ColStart:   len(oldLine),
+		ColEnd:     len(newLine),
+	}
+}
+
+// insertInline accepts an inline insertion by inserting what is left of it
+// after what the user typed since it was shown.
+func (e *Engine) insertInline() error {
+	completion := e.completions[0]
+	lines := e.buffer.Lines()
+	if completion.StartLine < 1 || completion.StartLine > len(lines) {
+		return fmt.Errorf("line %d out of range", completion.StartLine)
+	}
+	current, target := lines[completion.StartLine-1], completion.Lines[0]
+	if !strings.HasPrefix(target, current) {
+		return fmt.Errorf("line %d no longer leads to the insertion", completion.StartLine)
+	}
+	if current == target {
+		return nil
+	}
+	return e.buffer.InsertText(completion.StartLine, len(current), target[len(current):])
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func inlineEngine() (*Engine, *mockBuffer) {
+	buf := newMockBuffer()
+	buf.lines = []string{"package main", "fmt.Pri", ""}
+	buf.row = 2
+	buf.col = 7
+	return createTestEngine(buf, newMockProvider(), newMockClock()), buf
+}
+
+func TestInlineInsertion_ShownWithoutStaging(t *testing.T) {
+	eng, buf := inlineEngine()
+
+	shown := eng.processCompletion(&types.Completion{StartLine: 2, EndLineInc: 2, Lines: []string{"fmt.Println()"}})
+
+	assert.True(t, shown, "shown")
+	assert.True(t, eng.inlineInsertion, "inline insertion")
+	assert.Nil(t, eng.stagedCompletion, "not staged")
+	assert.Equal(t, stateHasCompletion, eng.state, "state")
+	assert.Len(t, 1, eng.currentGroups, "groups")
+	assert.Equal(t, "append_chars", eng.currentGroups[0].RenderHint, "render hint")
+	assert.Equal(t, 7, eng.currentGroups[0].ColStart, "ghost text starts at the cursor")
+	assert.Equal(t, 1, buf.prepareCompletionCalls, "rendered")
+}
+
+func TestInlineInsertion_AcceptInsertsRest(t *testing.T) {
+	eng, buf := inlineEngine()
+	eng.processCompletion(&types.Completion{StartLine: 2, EndLineInc: 2, Lines: []string{"fmt.Println()"}})
+
+	// The user typed part of it
+	buf.lines[1] = "fmt.Print"
+	eng.doAcceptCompletion(Event{Type: EventAccept})
+
+	assert.Equal(t, 2, buf.lastInsertLine, "line")
+	assert.Equal(t, 9, buf.lastInsertCol, "column")
+	assert.Equal(t, "ln()", buf.lastInsertedText, "inserted text")
+	assert.Equal(t, "fmt.Println()", buf.lines[1], "buffer line")
+	assert.False(t, eng.inlineInsertion, "cleared after accept")
+}
+
+func TestInlineInsertion_OtherCompletionsStaged(t *testing.T) {
+	tests := []struct {
+		name       string
+		col        int
+		completion *types.Completion
+	}{
+		{"cursor before end of line", 3, &types.Completion{StartLine: 2, EndLineInc: 2, Lines: []string{"fmt.Println()"}}},
+		{"line rewritten", 7, &types.Completion{StartLine: 2, EndLineInc: 2, Lines: []string{"log.Println()"}}},
+		{"other line", 7, &types.Completion{StartLine: 1, EndLineInc: 1, Lines: []string{"package main // app"}}},
+		{"several lines", 7, &types.Completion{StartLine: 2, EndLineInc: 3, Lines: []string{"fmt.Println()", "x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng, buf := inlineEngine()
+			buf.col = tt.col
+
+			eng.processCompletion(tt.completion)
+
+			assert.False(t, eng.inlineInsertion, "not inline")
+			assert.NotNil(t, eng.stagedCompletion, "staged")
+		})
+	}
+}
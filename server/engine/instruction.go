@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"cursortab/logger"
+	"cursortab/text"
+)
+
+// instructionPattern matches a trailing `cursortab: <instruction>` comment,
+// written with any of the common line or block comment leaders.
+var instructionPattern = regexp.MustCompile(`(//|#|--|;|/\*|<!--)\s*cursortab:\s*(.*?)\s*(\*/|-->)?\s*$`)
+
+// instructionComment is a `cursortab:` comment found on the cursor line of a
+// request, removed from the buffer once the completion it asked for is
+// accepted.
+type instructionComment struct {
+	path    string
+	row     int      // 1-indexed line the comment was on
+	comment string   // The comment, from its leader to the end of the line
+	text    string   // The instruction
+	lines   []string // The buffer when the comment was found, to follow its line
+}
+
+// parseInstruction returns the instruction comment ending line, if any.
+func parseInstruction(line string) (comment, text string, ok bool) {
+	m := instructionPattern.FindStringSubmatchIndex(line)
+	if m == nil {
+		return "", "", false
+	}
+	text = line[m[4]:m[5]]
+	if text == "" {
+		return "", "", false
+	}
+	return strings.TrimRight(line[m[0]:], " \t"), text, true
+}
+
+// instructionAtCursor returns the instruction comment on the cursor line.
+func (e *Engine) instructionAtCursor() *instructionComment {
+	row := e.buffer.Row()
+	lines := e.buffer.Lines()
+	if row < 1 || row > len(lines) {
+		return nil
+	}
+	comment, text, ok := parseInstruction(lines[row-1])
+	if !ok {
+		return nil
+	}
+	return &instructionComment{path: e.buffer.Path(), row: row, comment: comment, text: text, lines: slices.Clone(lines)}
+}
+
+// stripInstruction removes the instruction comment of the accepted completion
+// from the buffer, unless the completion already did. The comment is only
+// looked for on the line it was on, followed through the lines the completion
+// added or removed above it. A line holding only the comment is removed.
+func (e *Engine) stripInstruction() {
+	instruction := e.instruction
+	e.instruction = nil
+	if instruction == nil || instruction.path != e.buffer.Path() {
+		return
+	}
+
+	lines := e.buffer.Lines()
+	row := instructionRow(instruction, lines)
+	if row < 1 || row > len(lines) || !strings.HasSuffix(strings.TrimRight(lines[row-1], " \t"), instruction.comment) {
+		return
+	}
+
+	line := strings.TrimRight(lines[row-1], " \t")
+	stripped := strings.TrimRight(strings.TrimSuffix(line, instruction.comment), " \t")
+	var replacement []string
+	if strings.TrimSpace(stripped) != "" {
+		replacement = []string{stripped}
+	}
+	if err := e.buffer.ApplyInPlace(row, row, replacement); err != nil {
+		logger.Warn("instruction: failed to remove the comment on line %d: %v", row, err)
+		return
+	}
+	e.buffer.CommitPending()
+	e.saveCurrentFileState()
+	e.syncBuffer()
+}
+
+// instructionRow returns the line of lines the comment line moved to, or -1
+// when the completion removed it.
+func instructionRow(instruction *instructionComment, lines []string) int {
+	mapping := text.ComputeDiff(strings.Join(instruction.lines, "\n"), strings.Join(lines, "\n")).LineMapping
+	if mapping == nil || instruction.row > len(mapping.OldToNew) {
+		return -1
+	}
+	return mapping.OldToNew[instruction.row-1]
+}
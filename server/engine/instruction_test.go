@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestParseInstruction(t *testing.T) {
+	tests := []struct {
+		line    string
+		comment string
+		text    string
+	}{
+		{"x := 1 // cursortab: make it a constant", "// cursortab: make it a constant", "make it a constant"},
+		{"x = 1  # cursortab:rename to count  ", "# cursortab:rename to count", "rename to count"},
+		{"local x = 1 -- cursortab: use a table", "-- cursortab: use a table", "use a table"},
+		{"int x; /* cursortab: make it unsigned */", "/* cursortab: make it unsigned */", "make it unsigned"},
+		{"<div> <!-- cursortab: add a class -->", "<!-- cursortab: add a class -->", "add a class"},
+		{"i-- // cursortab: count up", "// cursortab: count up", "count up"},
+	}
+	for _, tt := range tests {
+		comment, text, ok := parseInstruction(tt.line)
+		assert.True(t, ok, tt.line)
+		assert.Equal(t, tt.comment, comment, "comment of "+tt.line)
+		assert.Equal(t, tt.text, text, "text of "+tt.line)
+	}
+
+	for _, line := range []string{"x := 1", "// cursortab:", "x := 1 // todo: cursortab: later", `s := "cursortab: x"`} {
+		_, _, ok := parseInstruction(line)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestBuildCompletionRequest_Instruction(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"package main", "x := 1 // cursortab: make it a constant"}
+	buf.row = 2
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	req := eng.buildCompletionRequest(types.CompletionSourceTyping)
+
+	assert.Equal(t, "make it a constant", req.Instruction, "instruction")
+
+	buf.row = 1
+	req = eng.buildCompletionRequest(types.CompletionSourceTyping)
+
+	assert.Equal(t, "", req.Instruction, "only on the cursor line")
+	assert.Nil(t, eng.instruction, "instruction forgotten")
+}
+
+func TestStripInstruction(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"package main", "", "const x = 1 // cursortab: make it a constant"}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.instruction = &instructionComment{
+		path: "test.go", row: 2, comment: "// cursortab: make it a constant", text: "make it a constant",
+		lines: []string{"package main", "x := 1 // cursortab: make it a constant"},
+	}
+
+	eng.stripInstruction()
+
+	assert.Equal(t, []string{"package main", "", "const x = 1"}, buf.lines, "comment removed from the moved line")
+	assert.Nil(t, eng.instruction, "instruction cleared")
+}
+
+func TestStripInstruction_CommentOnlyLine(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"func f() {", "\t// cursortab: return an error", "\treturn nil, err", "}"}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.instruction = &instructionComment{
+		path: "test.go", row: 2, comment: "// cursortab: return an error", text: "return an error",
+		lines: []string{"func f() {", "\t// cursortab: return an error", "\treturn nil", "}"},
+	}
+
+	eng.stripInstruction()
+
+	assert.Equal(t, []string{"func f() {", "\treturn nil, err", "}"}, buf.lines, "line removed")
+}
+
+func TestStripInstruction_AlreadyRemoved(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"const x = 1"}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.instruction = &instructionComment{
+		path: "test.go", row: 1, comment: "// cursortab: make it a constant", text: "make it a constant",
+		lines: []string{"x := 1 // cursortab: make it a constant"},
+	}
+
+	eng.stripInstruction()
+
+	assert.Equal(t, 0, buf.applyInPlaceCalls, "buffer untouched")
+}
+
+func TestStripInstruction_IgnoresTheSameCommentElsewhere(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"const x = 1", "y := 2 // cursortab: make it a constant"}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.instruction = &instructionComment{
+		path: "test.go", row: 1, comment: "// cursortab: make it a constant", text: "make it a constant",
+		lines: []string{"x := 1 // cursortab: make it a constant", "y := 2 // cursortab: make it a constant"},
+	}
+
+	eng.stripInstruction()
+
+	assert.Equal(t, 0, buf.applyInPlaceCalls, "other line untouched")
+}
@@ -0,0 +1,203 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"cursortab/logger"
+	"cursortab/metrics"
+	"cursortab/text"
+	"cursortab/types"
+)
+
+// splitByFile separates the completions for the current buffer from those
+// targeting other files. A completion without FilePath targets the current buffer.
+func (e *Engine) splitByFile(completions []*types.Completion) (current, others []*types.Completion) {
+	path := e.buffer.Path()
+	for _, c := range completions {
+		if c.FilePath == "" || c.FilePath == path {
+			current = append(current, c)
+		} else {
+			others = append(others, c)
+		}
+	}
+	return current, others
+}
+
+// stageOtherFiles stages completions for files other than the current buffer
+// against their content on disk. Completions for the same file after the first
+// are dropped, as are files that cannot be read or have no changes.
+func (e *Engine) stageOtherFiles(completions []*types.Completion) []*text.FileStages {
+	var files []*text.FileStages
+	seen := make(map[string]bool)
+	for _, c := range completions {
+		if seen[c.FilePath] || !filepath.IsLocal(c.FilePath) {
+			continue
+		}
+		seen[c.FilePath] = true
+		if fs := e.stageFile(c); fs != nil {
+			files = append(files, fs)
+		}
+	}
+	return files
+}
+
+// stageFile reads the completion's target file and splits the completion into stages.
+func (e *Engine) stageFile(completion *types.Completion) *text.FileStages {
+	fileLines, ok := readLines(filepath.Join(e.WorkspacePath, completion.FilePath))
+	if !ok {
+		return nil
+	}
+	return e.stageFileLines(completion, fileLines)
+}
+
+// stageFileLines splits the completion into stages against fileLines, the
+// content of its target file.
+func (e *Engine) stageFileLines(completion *types.Completion, fileLines []string) *text.FileStages {
+	completion, ok := fitToBuffer(completion, fileLines, e.config.EOFPolicy)
+	if !ok || e.oversized(completion, fileLines) {
+		return nil
+	}
+
+	var oldLines []string
+	for i := completion.StartLine; i <= completion.EndLineInc && i-1 < len(fileLines); i++ {
+		oldLines = append(oldLines, fileLines[i-1])
+	}
+
+	result := text.CreateStages(&text.StagingParams{
+		Diff:               text.ComputeDiff(text.JoinLines(oldLines), text.JoinLines(completion.Lines)),
+		CursorRow:          completion.StartLine,
+		BaseLineOffset:     completion.StartLine,
+		ProximityThreshold: e.config.CursorPrediction.ProximityThreshold,
+		MaxLines:           e.stageLineLimit(e.config.MaxVisibleLines),
+		FilePath:           completion.FilePath,
+		NewLines:           completion.Lines,
+		OldLines:           oldLines,
+		Order:              e.config.StageOrder,
+	})
+	if result == nil || len(result.Stages) == 0 {
+		return nil
+	}
+
+	return &text.FileStages{
+		Staged: &text.StagedCompletion{
+			Stages:     result.Stages,
+			SourcePath: completion.FilePath,
+		},
+		OldLines: fileLines,
+	}
+}
+
+// readLines returns the lines of the file at path.
+func readLines(path string) ([]string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Debug("multi-file completion: cannot read %s: %v", path, err)
+		return nil, false
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), true
+}
+
+// showOtherFiles starts a multi-file completion made only of other files and
+// shows the jump indicator for the first one. Returns false when files is empty.
+func (e *Engine) showOtherFiles(files []*text.FileStages) bool {
+	e.multiFile = text.NewMultiFileStagedCompletion(files...)
+	if e.multiFile == nil {
+		return false
+	}
+	e.showFileTarget()
+	return true
+}
+
+// hasMoreFiles reports whether a multi-file completion has files left after the current one.
+func (e *Engine) hasMoreFiles() bool {
+	return e.multiFile != nil && e.multiFile.CurrentFile < len(e.multiFile.Files)-1
+}
+
+// navigateToNextFile shows a jump indicator for the next file of a multi-file
+// completion. Returns false when there is none.
+func (e *Engine) navigateToNextFile() bool {
+	if e.multiFile == nil || !e.multiFile.Advance() {
+		e.multiFile = nil
+		return false
+	}
+	e.showFileTarget()
+	return true
+}
+
+// showFileTarget shows the jump indicator, with the file name, for the first
+// stage of the current multi-file entry.
+func (e *Engine) showFileTarget() {
+	next := e.multiFile.Current()
+	line := next.Staged.Stages[0].BufferStart
+	e.cursorTarget = &types.CursorPredictionTarget{
+		RelativePath:    next.Staged.SourcePath,
+		LineNumber:      int32(line),
+		ShouldRetrigger: false,
+	}
+	e.state = stateHasCursorTarget
+	e.targetView = targetView{}
+	e.buffer.ShowFileTarget(next.Staged.SourcePath, line, e.multiFile.Summary())
+	e.notify(Notification{Event: NotifyCursorTargetShown, FilePath: next.Staged.SourcePath, Line: line})
+}
+
+// isOtherFile reports whether target points into a file other than the buffer's.
+func (e *Engine) isOtherFile(target *types.CursorPredictionTarget) bool {
+	return target.RelativePath != "" && target.RelativePath != e.buffer.Path()
+}
+
+// acceptCrossFileTarget opens the file a provider predicted the next edit in
+// and requests a completion there. Paths leaving the workspace are refused.
+func (e *Engine) acceptCrossFileTarget() {
+	path := e.cursorTarget.RelativePath
+	line := int(e.cursorTarget.LineNumber)
+	if e.currentMetrics.CursorOnly {
+		e.sendMetric(metrics.EventAccepted)
+	}
+	e.clearAll()
+	e.state = stateIdle
+
+	if !filepath.IsLocal(path) {
+		logger.Warn("cross-file jump: refusing %q outside the workspace", path)
+		return
+	}
+	if err := e.buffer.OpenFile(filepath.Join(e.WorkspacePath, path), line); err != nil {
+		logger.Error("acceptCrossFileTarget: open %s failed: %v", path, err)
+		return
+	}
+	e.syncBuffer()
+	if e.buffer.Path() != path {
+		logger.Debug("cross-file jump: %s did not open in the workspace", path)
+		return
+	}
+	e.retriggerCompletion()
+}
+
+// acceptFileTarget opens the file of the current multi-file entry and shows
+// its first stage. The completion is dropped if the file changed since it was staged.
+func (e *Engine) acceptFileTarget() {
+	current := e.multiFile.Current()
+	path := current.Staged.SourcePath
+	line := int(e.cursorTarget.LineNumber)
+
+	if err := e.buffer.OpenFile(filepath.Join(e.WorkspacePath, path), line); err != nil {
+		logger.Error("acceptFileTarget: open %s failed: %v", path, err)
+		e.clearAll()
+		e.state = stateIdle
+		return
+	}
+	e.syncBuffer()
+
+	if e.buffer.Path() != path || !slices.Equal(e.buffer.Lines(), current.OldLines) {
+		logger.Debug("multi-file completion: %s changed since it was staged", path)
+		e.clearAll()
+		e.state = stateIdle
+		return
+	}
+
+	e.cursorTarget = nil
+	e.stagedCompletion = current.Staged
+	e.showCurrentStage()
+}
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+// newMultiFileEngine creates an engine whose workspace holds other.go on disk.
+func newMultiFileEngine(t *testing.T) (*Engine, *mockBuffer) {
+	t.Helper()
+	workspace := t.TempDir()
+	err := os.WriteFile(filepath.Join(workspace, "other.go"), []byte("x\ny\nz\n"), 0o644)
+	assert.NoError(t, err, "write other.go")
+
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b", "c"}
+	buf.files = map[string][]string{"other.go": {"x", "y", "z"}}
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), newMockClock())
+	t.Cleanup(cancel)
+	eng.WorkspacePath = workspace
+	return eng, buf
+}
+
+func otherFileCompletion() *types.Completion {
+	return &types.Completion{FilePath: "other.go", StartLine: 2, EndLineInc: 2, Lines: []string{"y2"}}
+}
+
+func TestMultiFile_NavigatesToOtherFileAfterCurrent(t *testing.T) {
+	eng, buf := newMultiFileEngine(t)
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 1, EndLineInc: 1, Lines: []string{"a2"}},
+		otherFileCompletion(),
+	}})
+
+	assert.Equal(t, stateHasCompletion, eng.state, "current file shown first")
+	assert.Equal(t, []string{"a2"}, buf.lastPreparedCompletion.lines, "current file stage")
+
+	eng.acceptCompletion()
+
+	assert.Equal(t, stateHasCursorTarget, eng.state, "jump to other file")
+	assert.Equal(t, "other.go", buf.showFileTargetPath, "jump target file")
+	assert.Equal(t, 2, buf.showFileTargetLine, "jump target line")
+	assert.Len(t, 2, buf.lastFileSummary.Files, "summary files")
+	assert.Equal(t, 1, buf.lastFileSummary.CurrentFile, "summary current file")
+	assert.Equal(t, "other.go", buf.lastFileSummary.Files[1].Path, "summary path")
+
+	eng.acceptCursorTarget()
+
+	assert.Equal(t, "other.go", buf.path, "other file opened")
+	assert.Equal(t, stateHasCompletion, eng.state, "other file stage shown")
+	assert.Equal(t, 2, buf.lastPreparedCompletion.startLine, "other file stage start")
+	assert.Equal(t, []string{"y2"}, buf.lastPreparedCompletion.lines, "other file stage")
+
+	eng.acceptCompletion()
+
+	assert.Nil(t, eng.multiFile, "multi-file completion finished")
+}
+
+func TestMultiFile_OnlyOtherFiles(t *testing.T) {
+	eng, buf := newMultiFileEngine(t)
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{otherFileCompletion()}})
+
+	assert.Equal(t, stateHasCursorTarget, eng.state, "jump shown from idle")
+	assert.Equal(t, "other.go", buf.showFileTargetPath, "jump target file")
+	assert.Equal(t, 0, buf.prepareCompletionCalls, "nothing rendered in current file")
+}
+
+func TestMultiFile_ChangedFileIsDropped(t *testing.T) {
+	eng, buf := newMultiFileEngine(t)
+	buf.files["other.go"] = []string{"x", "edited", "z"}
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{otherFileCompletion()}})
+	eng.acceptCursorTarget()
+
+	assert.Equal(t, stateIdle, eng.state, "state")
+	assert.Nil(t, eng.multiFile, "multi-file completion dropped")
+	assert.Equal(t, 0, buf.prepareCompletionCalls, "stale stage not shown")
+}
+
+func TestMultiFile_UnreadableFileIgnored(t *testing.T) {
+	eng, buf := newMultiFileEngine(t)
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 1, EndLineInc: 1, Lines: []string{"a2"}},
+		{FilePath: "missing.go", StartLine: 1, EndLineInc: 1, Lines: []string{"m"}},
+	}})
+
+	assert.Equal(t, stateHasCompletion, eng.state, "current file shown")
+	assert.Nil(t, eng.multiFile, "no multi-file completion")
+
+	eng.acceptCompletion()
+
+	assert.Equal(t, "", buf.showFileTargetPath, "no file jump")
+}
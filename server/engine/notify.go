@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"cursortab/metrics"
+	"cursortab/types"
+)
+
+// Events reported in Notification
+const (
+	NotifyCompletionShown    = "completion_shown"    // A completion appeared
+	NotifyCompletionAccepted = "completion_accepted" // The shown completion or jump was accepted
+	NotifyCompletionRejected = "completion_rejected" // The shown completion or jump was rejected
+	NotifyCompletionIgnored  = "completion_ignored"  // The shown completion or jump was dismissed by typing or moving
+	NotifyStageAdvanced      = "stage_advanced"      // The next stage of a staged completion is up
+	NotifyCursorTargetShown  = "cursor_target_shown" // A jump indicator appeared
+	NotifyPrefetchReady      = "prefetch_ready"      // A prefetched completion arrived
+	NotifyProviderDegraded   = "provider_degraded"   // The provider kept failing; automatic requests are paused
+	NotifyProviderRecovered  = "provider_recovered"  // The provider answered again after being degraded
+	NotifyOffline            = "offline"             // The provider is unreachable; idle completions are paused
+	NotifyOnline             = "online"              // The provider is reachable again
+)
+
+// Notification is an engine event reported to subscribers, for statuslines,
+// sounds or animations. Fields that do not apply to the event are zero.
+type Notification struct {
+	Event      string `json:"event"`
+	FilePath   string `json:"file_path,omitempty"`
+	Line       int    `json:"line,omitempty"`   // 1-indexed first line of the stage or target
+	Lines      int    `json:"lines,omitempty"`  // New lines of the stage or prefetched completion
+	Stage      int    `json:"stage,omitempty"`  // 1-indexed
+	Stages     int    `json:"stages,omitempty"` // Stages in the completion
+	CursorOnly bool   `json:"cursor_only,omitempty"`
+	Provider   string `json:"provider,omitempty"`
+	Model      string `json:"model,omitempty"`
+}
+
+// ApplyFailure describes a completion that could not be applied, reported to
+// the editor once the buffer was restored.
+type ApplyFailure struct {
+	TraceID    string `json:"trace_id"` // Logged with the cause
+	Reason     string `json:"reason"`
+	FilePath   string `json:"file_path,omitempty"`
+	StartLine  int    `json:"start_line,omitempty"` // 1-indexed first line the completion replaces
+	EndLine    int    `json:"end_line,omitempty"`   // 1-indexed last line the completion replaces
+	Stage      int    `json:"stage,omitempty"`      // 1-indexed
+	Stages     int    `json:"stages,omitempty"`     // Stages in the completion
+	RolledBack bool   `json:"rolled_back"`          // False when restoring the buffer failed too
+}
+
+// outcomeNotifications maps metric outcomes to their notification.
+var outcomeNotifications = map[metrics.EventType]string{
+	metrics.EventAccepted: NotifyCompletionAccepted,
+	metrics.EventRejected: NotifyCompletionRejected,
+	metrics.EventIgnored:  NotifyCompletionIgnored,
+}
+
+// SetNotificationListener registers fn to be called with every notification.
+// fn runs with the engine locked and must not block.
+func (e *Engine) SetNotificationListener(fn func(Notification)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onNotification = fn
+}
+
+func (e *Engine) notify(n Notification) {
+	if e.onNotification == nil {
+		return
+	}
+	e.onNotification(n)
+}
+
+// notifyStage reports event for the current stage of the staged completion.
+func (e *Engine) notifyStage(event string) {
+	n := Notification{Event: event, FilePath: e.buffer.Path()}
+	if e.annotation != nil {
+		n.Provider, n.Model = e.annotation.Provider, e.annotation.Model
+	}
+	if sc := e.stagedCompletion; sc != nil && sc.CurrentIdx < len(sc.Stages) {
+		stage := sc.Stages[sc.CurrentIdx]
+		n.Line, n.Lines = stage.BufferStart, len(stage.Lines)
+		n.Stage, n.Stages = sc.CurrentIdx+1, len(sc.Stages)
+	}
+	e.notify(n)
+}
+
+// notifyOutcome reports the outcome of the shown completion or jump.
+func (e *Engine) notifyOutcome(eventType metrics.EventType) {
+	event, ok := outcomeNotifications[eventType]
+	if !ok {
+		return
+	}
+	e.notify(Notification{
+		Event:      event,
+		FilePath:   e.buffer.Path(),
+		CursorOnly: e.currentMetrics.CursorOnly,
+		Provider:   e.currentMetrics.Provider,
+		Model:      e.currentMetrics.Model,
+	})
+}
+
+// notifyPrefetchReady reports a prefetched completion.
+func (e *Engine) notifyPrefetchReady(completions []*types.Completion) {
+	n := Notification{Event: NotifyPrefetchReady, FilePath: e.buffer.Path()}
+	if len(completions) > 0 {
+		n.Line, n.Lines = completions[0].StartLine, len(completions[0].Lines)
+	}
+	e.notify(n)
+}
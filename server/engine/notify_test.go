@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/text"
+	"cursortab/types"
+)
+
+func recordNotifications(eng *Engine) *[]Notification {
+	var got []Notification
+	eng.SetNotificationListener(func(n Notification) { got = append(got, n) })
+	return &got
+}
+
+func TestNotify_ShownAndRejected(t *testing.T) {
+	buf := newMockBuffer()
+	buf.path = "main.go"
+	buf.lines = []string{"a := 1", "b := 2"}
+	buf.row = 1
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	got := recordNotifications(eng)
+
+	assert.True(t, eng.processCompletion(&types.Completion{StartLine: 1, EndLineInc: 1, Lines: []string{"a := 10"}}), "shown")
+	eng.recordMetricsShown(nil)
+	eng.handleEvent(Event{Type: EventEsc})
+
+	assert.Equal(t, []Notification{
+		{Event: NotifyCompletionShown, FilePath: "main.go", Line: 1, Lines: 1, Stage: 1, Stages: 1},
+		{Event: NotifyCompletionRejected, FilePath: "main.go"},
+	}, *got, "notifications")
+}
+
+func TestNotify_StageAdvanced(t *testing.T) {
+	buf := newMockBuffer()
+	buf.path = "main.go"
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.stagedCompletion = &text.StagedCompletion{Stages: []*text.Stage{
+		{BufferStart: 2, BufferEnd: 2, Lines: []string{"x"}, Groups: []*text.Group{{Type: "modification"}}},
+		{BufferStart: 9, BufferEnd: 9, Lines: []string{"y", "z"}, Groups: []*text.Group{{Type: "modification"}}},
+	}}
+	got := recordNotifications(eng)
+
+	eng.advanceStagedCompletion()
+
+	assert.Equal(t, []Notification{
+		{Event: NotifyStageAdvanced, FilePath: "main.go", Line: 9, Lines: 2, Stage: 2, Stages: 2},
+	}, *got, "notifications")
+}
+
+func TestNotify_CursorTargetShownOnce(t *testing.T) {
+	buf := newMockBuffer()
+	buf.path = "main.go"
+	buf.lines = make([]string, 30)
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	got := recordNotifications(eng)
+
+	eng.state = stateHasCursorTarget
+	eng.showCursorTarget(20)
+	buf.viewportTop, buf.viewportBottom = 1, 10
+	eng.handleEvent(Event{Type: EventScrolled})
+
+	assert.Equal(t, 2, buf.showCursorTargetCalls, "indicator redrawn after scrolling")
+	assert.Equal(t, []Notification{
+		{Event: NotifyCursorTargetShown, FilePath: "main.go", Line: 20},
+	}, *got, "notifications")
+}
+
+func TestNotify_PrefetchReady(t *testing.T) {
+	buf := newMockBuffer()
+	buf.path = "main.go"
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.prefetchState = prefetchInFlight
+	got := recordNotifications(eng)
+
+	eng.handleEvent(Event{Type: EventPrefetchReady, Data: &types.CompletionResponse{
+		Completions: []*types.Completion{{StartLine: 4, EndLineInc: 4, Lines: []string{"a", "b"}}},
+	}})
+
+	assert.Equal(t, []Notification{
+		{Event: NotifyPrefetchReady, FilePath: "main.go", Line: 4, Lines: 2},
+	}, *got, "notifications")
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"cursortab/logger"
+)
+
+const (
+	// OfflineProbeInterval is how often connectivity is probed while offline.
+	OfflineProbeInterval = 15 * time.Second
+
+	offlineProbeTimeout = 5 * time.Second
+)
+
+// isOffline reports whether err means the provider cannot be reached at all:
+// its name does not resolve or no connection can be made.
+func isOffline(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// SetConnectivityProbe sets the check run while offline to notice that the
+// network is back. Without one, only a request that succeeds ends offline mode.
+func (e *Engine) SetConnectivityProbe(probe HealthCheck) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.connectivityProbe = probe
+}
+
+// requestSucceeded records a response from the provider.
+func (e *Engine) requestSucceeded() {
+	e.setOnline()
+	e.breakerSucceeded()
+}
+
+// requestFailed records a failed provider request. Returns true when it failed
+// because the machine is offline, which the circuit breaker does not count.
+func (e *Engine) requestFailed(err error) bool {
+	if !isOffline(err) {
+		e.breakerFailed(err)
+		return false
+	}
+	if !e.offline {
+		logger.Info("offline: provider unreachable (%v), pausing idle completions", err)
+		e.offline = true
+		e.stopIdleTimer()
+		e.notify(Notification{Event: NotifyOffline, Provider: e.providerName()})
+		e.scheduleConnectivityProbe()
+	}
+	return true
+}
+
+// setOnline leaves offline mode.
+func (e *Engine) setOnline() {
+	if !e.offline {
+		return
+	}
+	logger.Info("offline: provider reachable again, resuming completions")
+	e.offline = false
+	e.stopOfflineTimer()
+	e.notify(Notification{Event: NotifyOnline, Provider: e.providerName()})
+}
+
+func (e *Engine) scheduleConnectivityProbe() {
+	if e.connectivityProbe == nil {
+		return
+	}
+	e.stopOfflineTimer()
+	e.offlineTimer = e.clock.AfterFunc(OfflineProbeInterval, func() {
+		e.post(Event{Type: EventConnectivityProbe})
+	})
+}
+
+func (e *Engine) stopOfflineTimer() {
+	if e.offlineTimer != nil {
+		e.offlineTimer.Stop()
+		e.offlineTimer = nil
+	}
+}
+
+// probeConnectivity runs the connectivity probe off the event loop. Its
+// result comes back as EventConnectivityChecked.
+func (e *Engine) probeConnectivity() {
+	if !e.offline || e.connectivityProbe == nil {
+		return
+	}
+	probe, mainCtx := e.connectivityProbe, e.mainCtx
+	go func() {
+		ctx, cancel := context.WithTimeout(mainCtx, offlineProbeTimeout)
+		defer cancel()
+		e.post(Event{Type: EventConnectivityChecked, Data: probe(ctx)})
+	}()
+}
+
+// handleConnectivityChecked resumes completions when the probe passed, and
+// schedules the next probe otherwise.
+func (e *Engine) handleConnectivityChecked(err error) {
+	if !e.offline {
+		return
+	}
+	if err != nil {
+		logger.Debug("offline: connectivity probe failed: %v", err)
+		e.scheduleConnectivityProbe()
+		return
+	}
+	e.setOnline()
+	if e.state == stateIdle {
+		e.resetIdleTimer()
+	}
+}
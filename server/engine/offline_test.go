@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+)
+
+func TestIsOffline(t *testing.T) {
+	dnsErr := &net.DNSError{Err: "no such host", Name: "api.example.com"}
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: network is unreachable")}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+
+	assert.True(t, isOffline(dnsErr), "dns error")
+	assert.True(t, isOffline(fmt.Errorf("post: %w", dialErr)), "wrapped dial error")
+	assert.False(t, isOffline(readErr), "read error")
+	assert.False(t, isOffline(errors.New("status 503")), "server error")
+	assert.False(t, isOffline(nil), "no error")
+}
+
+func TestOffline_PausesIdleCompletionsUntilProbePasses(t *testing.T) {
+	buf := newMockBuffer()
+	clock := newMockClock()
+	prov := newMockProvider()
+	eng, cancel := createTestEngineWithContext(buf, prov, clock)
+	defer cancel()
+	probeErr := make(chan error, 1)
+	eng.connectivityProbe = func(ctx context.Context) error { return <-probeErr }
+	var events []string
+	eng.onNotification = func(n Notification) { events = append(events, n.Event) }
+
+	offlineErr := &net.DNSError{Err: "no such host", Name: "api.example.com"}
+	for range 10 {
+		eng.handleEvent(Event{Type: EventCompletionError, Data: offlineErr})
+	}
+
+	assert.True(t, eng.Progress().Offline, "offline")
+	assert.False(t, eng.Progress().Degraded, "offline errors do not trip the circuit breaker")
+	assert.Equal(t, []string{NotifyOffline}, events, "offline notified once")
+
+	eng.handleEvent(Event{Type: EventIdleTimeout})
+	assert.Equal(t, stateIdle, eng.state, "idle completion paused")
+
+	probeErr <- errors.New("still offline")
+	clock.Advance(OfflineProbeInterval)
+	eng.handleEvent(waitForEvent(t, eng, EventConnectivityProbe))
+	eng.handleEvent(waitForEvent(t, eng, EventConnectivityChecked))
+	assert.True(t, eng.Progress().Offline, "still offline after failed probe")
+
+	probeErr <- nil
+	clock.Advance(OfflineProbeInterval)
+	eng.handleEvent(waitForEvent(t, eng, EventConnectivityProbe))
+	eng.handleEvent(waitForEvent(t, eng, EventConnectivityChecked))
+
+	assert.False(t, eng.Progress().Offline, "online after probe passes")
+	assert.Equal(t, []string{NotifyOffline, NotifyOnline}, events, "online notified")
+}
+
+func TestOffline_EndsOnSuccessfulRequest(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+
+	eng.requestFailed(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")})
+	assert.True(t, eng.offline, "offline")
+
+	eng.requestSucceeded()
+	assert.False(t, eng.offline, "online")
+}
+
+// waitForEvent reads the next event posted to the engine, failing on any other.
+func waitForEvent(t *testing.T, eng *Engine, want EventType) Event {
+	t.Helper()
+	select {
+	case ev := <-eng.eventChan:
+		assert.Equal(t, want, ev.Type, "event type")
+		return ev
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for %s", want)
+		return Event{}
+	}
+}
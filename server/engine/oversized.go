@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"cursortab/logger"
+	"cursortab/types"
+)
+
+// OversizedPolicy controls completions changing more than MaxCompletionLines lines.
+type OversizedPolicy string
+
+const (
+	OversizedChunk OversizedPolicy = "chunk" // Split into stages of at most MaxCompletionLines lines, however close their changes are (default)
+	OversizedDrop  OversizedPolicy = "drop"  // The completion is discarded
+)
+
+// completionSize is the number of lines a completion changes in bufferLines:
+// the lines it replaces or the lines replacing them, whichever is more, once
+// the lines it leaves as they are at either end are trimmed.
+func completionSize(completion *types.Completion, bufferLines []string) int {
+	old := bufferLines[min(completion.StartLine-1, len(bufferLines)):min(completion.EndLineInc, len(bufferLines))]
+	lines := completion.Lines
+	for len(old) > 0 && len(lines) > 0 && old[0] == lines[0] {
+		old, lines = old[1:], lines[1:]
+	}
+	for len(old) > 0 && len(lines) > 0 && old[len(old)-1] == lines[len(lines)-1] {
+		old, lines = old[:len(old)-1], lines[:len(lines)-1]
+	}
+	return max(len(old), len(lines))
+}
+
+// dropsOversized reports whether completions over MaxCompletionLines are
+// discarded rather than chunked.
+func (e *Engine) dropsOversized() bool {
+	return e.config.OversizedPolicy == OversizedDrop && e.config.MaxCompletionLines > 0
+}
+
+// oversized reports whether completion, fitted to bufferLines, must be
+// discarded for its size.
+func (e *Engine) oversized(completion *types.Completion, bufferLines []string) bool {
+	if !e.dropsOversized() {
+		return false
+	}
+	if size := completionSize(completion, bufferLines); size > e.config.MaxCompletionLines {
+		logger.Debug("completion of %d lines over max_completion_lines %d dropped", size, e.config.MaxCompletionLines)
+		return true
+	}
+	return false
+}
+
+// stageLineLimit returns the most lines a stage may span with maxVisible lines
+// per stage: oversized completions being chunked also caps it at
+// MaxCompletionLines. 0 means no limit.
+func (e *Engine) stageLineLimit(maxVisible int) int {
+	chunk := e.config.MaxCompletionLines
+	if e.config.OversizedPolicy == OversizedDrop || chunk <= 0 {
+		return maxVisible
+	}
+	if maxVisible <= 0 {
+		return chunk
+	}
+	return min(maxVisible, chunk)
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func numberedLines(prefix string, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%s%d", prefix, i+1)
+	}
+	return lines
+}
+
+func TestCompletionSize_CountsChangedLines(t *testing.T) {
+	buffer := []string{"a", "b", "c", "d", "e"}
+	tests := []struct {
+		name       string
+		completion *types.Completion
+		want       int
+	}{
+		{"one line changed in a window", &types.Completion{StartLine: 1, EndLineInc: 5, Lines: []string{"a", "b", "x", "d", "e"}}, 1},
+		{"lines inserted", &types.Completion{StartLine: 2, EndLineInc: 3, Lines: []string{"b", "x", "y", "c"}}, 2},
+		{"lines deleted", &types.Completion{StartLine: 1, EndLineInc: 5, Lines: []string{"a", "e"}}, 3},
+		{"unchanged", &types.Completion{StartLine: 1, EndLineInc: 2, Lines: []string{"a", "b"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, completionSize(tt.completion, buffer), "size")
+		})
+	}
+}
+
+func TestStageLineLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxLines   int
+		policy     OversizedPolicy
+		maxVisible int
+		want       int
+	}{
+		{"no max", 0, OversizedChunk, 12, 12},
+		{"chunk below visible limit", 5, OversizedChunk, 12, 5},
+		{"chunk above visible limit", 50, OversizedChunk, 12, 12},
+		{"chunk without visible limit", 50, OversizedChunk, 0, 50},
+		{"default policy chunks", 50, "", 0, 50},
+		{"drop keeps visible limit", 5, OversizedDrop, 12, 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+			eng.config.MaxCompletionLines = tt.maxLines
+			eng.config.OversizedPolicy = tt.policy
+			assert.Equal(t, tt.want, eng.stageLineLimit(tt.maxVisible), "limit")
+		})
+	}
+}
+
+func TestOversizedCompletion_Dropped(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = numberedLines("old", 40)
+	buf.row = 1
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.config.MaxCompletionLines = 10
+	eng.config.OversizedPolicy = OversizedDrop
+
+	shown := eng.processCompletion(&types.Completion{StartLine: 1, EndLineInc: 40, Lines: numberedLines("new", 40)})
+
+	assert.False(t, shown, "dropped")
+	assert.Nil(t, eng.stagedCompletion, "nothing staged")
+	assert.Equal(t, 0, buf.prepareCompletionCalls, "nothing rendered")
+}
+
+func TestOversizedCompletion_SmallChangeInLargeWindowKept(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = numberedLines("old", 40)
+	buf.row = 1
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.config.MaxCompletionLines = 10
+	eng.config.OversizedPolicy = OversizedDrop
+
+	lines := numberedLines("old", 40)
+	lines[0] = "changed"
+	shown := eng.processCompletion(&types.Completion{StartLine: 1, EndLineInc: 40, Lines: lines})
+
+	assert.True(t, shown, "shown")
+}
+
+func TestOversizedCompletion_Chunked(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = numberedLines("old", 40)
+	buf.row = 1
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.config.MaxVisibleLines = 0
+	eng.config.MaxCompletionLines = 10
+	eng.config.OversizedPolicy = OversizedChunk
+
+	shown := eng.processCompletion(&types.Completion{StartLine: 1, EndLineInc: 40, Lines: numberedLines("new", 40)})
+
+	assert.True(t, shown, "shown")
+	assert.NotNil(t, eng.stagedCompletion, "staged")
+	assert.Len(t, 4, eng.stagedCompletion.Stages, "stages")
+	for _, stage := range eng.stagedCompletion.Stages {
+		assert.True(t, stage.BufferEnd-stage.BufferStart+1 <= 10, "stage within max_completion_lines")
+	}
+}
+
+func TestOversizedStream_Cancelled(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = numberedLines("old", 20)
+	buf.row = 1
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.config.MaxCompletionLines = 5
+	eng.config.OversizedPolicy = OversizedDrop
+
+	startLineStream(eng, buf, numberedLines("new", 20)...)
+
+	assert.Equal(t, stateIdle, eng.state, "state")
+	assert.Nil(t, eng.streamingState, "streaming state cleared")
+	assert.Nil(t, eng.streamLinesChan, "stream cancelled")
+}
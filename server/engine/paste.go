@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"fmt"
+
+	"cursortab/logger"
+	"cursortab/types"
+)
+
+// PastePolicy controls the text change request following a paste.
+type PastePolicy string
+
+const (
+	PasteSkip     PastePolicy = "skip"     // No request until the next edit that is not a paste (default)
+	PasteDelay    PastePolicy = "delay"    // Request once no change was made for PasteDelay
+	PasteCleanUp  PastePolicy = "clean_up" // Ask the provider to fit the pasted code to the code around it
+	PasteComplete PastePolicy = "complete" // Request as for any other text change
+)
+
+// pasteMinLines is the number of lines a single change must add to count as
+// a paste when the editor did not report it as one. Smaller changes come as
+// often from snippets and completion menus.
+const pasteMinLines = 5
+
+// pastedLines is the text of the last paste in the current buffer, awaiting
+// the request the paste policy makes of it.
+type pastedLines struct {
+	path        string
+	first, last int  // 1-indexed, inclusive
+	delayed     bool // Its request waits for PasteDelay
+}
+
+// trackPaste notes a change to the current buffer recorded as action: a paste
+// is kept for the next request, any other edit lets requests go as usual.
+func (e *Engine) trackPaste(change BufferLines, action types.UserActionType) {
+	if e.config.PastePolicy == "" || e.config.PastePolicy == PasteComplete || action == "" {
+		return
+	}
+	added := len(change.Lines) - (change.LastLine - change.FirstLine)
+	large := (action == types.ActionPaste || action == types.ActionInsertSelection) && added >= pasteMinLines
+	if !change.Paste && !large {
+		e.pasted = nil
+		return
+	}
+
+	first, last := change.FirstLine+1, change.FirstLine+len(change.Lines)
+	if p := e.pasted; p != nil && p.path == change.Path {
+		// A paste the editor splits into several changes
+		first, last = min(first, p.first), max(last, p.last)
+	}
+	e.pasted = &pastedLines{path: change.Path, first: first, last: max(first, last)}
+	logger.Debug("paste on lines %d-%d of %s", first, last, change.Path)
+}
+
+// currentPaste returns the paste awaiting a request in the current buffer, if
+// any.
+func (e *Engine) currentPaste() *pastedLines {
+	if e.pasted == nil || e.pasted.path != e.buffer.Path() {
+		return nil
+	}
+	return e.pasted
+}
+
+// holdPasteRequest reports whether the request of a text change or idle time
+// following a paste is held back by the paste policy. A delayed request is
+// sent by the text change timer once PasteDelay passed without changes.
+func (e *Engine) holdPasteRequest() bool {
+	p := e.currentPaste()
+	if p == nil {
+		return false
+	}
+	switch e.config.PastePolicy {
+	case PasteSkip:
+		logger.Debug("no completion after a paste")
+		return true
+	case PasteDelay:
+		if p.delayed {
+			e.pasted = nil
+			return false
+		}
+		p.delayed = true
+		e.armTextChangeTimer(e.config.PasteDelay)
+		return true
+	}
+	return false
+}
+
+// cleanUpPaste turns req into a request to fit the pasted lines to the code
+// around them, with its cursor at the start of the paste.
+func (e *Engine) cleanUpPaste(req *types.CompletionRequest) {
+	p := e.currentPaste()
+	if p == nil || e.config.PastePolicy != PasteCleanUp {
+		return
+	}
+	e.pasted = nil
+	if p.first > len(req.Lines) {
+		return
+	}
+	last := min(p.last, len(req.Lines))
+
+	req.Source = types.CompletionSourcePaste
+	req.Instruction = fmt.Sprintf("Clean up the code pasted on lines %d-%d so it fits the surrounding code: indentation, names, imports and syntax", p.first, last)
+	req.CursorRow = p.first
+	req.CursorCol = 0
+}
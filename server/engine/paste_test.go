@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+// pasteChange adds count lines after the first line of test.go.
+func pasteChange(count int) BufferLines {
+	lines := make([]string, count)
+	for i := range lines {
+		lines[i] = "pasted()"
+	}
+	return BufferLines{Path: "test.go", FirstLine: 1, LastLine: 1, Lines: lines, Tick: 2}
+}
+
+func createPasteTestEngine(t *testing.T, policy PastePolicy) *Engine {
+	eng, cancel := createTestEngineWithContext(newMockBuffer(), newMockProvider(), newMockClock())
+	t.Cleanup(cancel)
+	eng.config.PastePolicy = policy
+	return eng
+}
+
+func TestPaste_SkipHoldsRequestsUntilTyping(t *testing.T) {
+	eng := createPasteTestEngine(t, PasteSkip)
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: pasteChange(pasteMinLines)})
+	assert.NotNil(t, eng.pasted, "large change counts as a paste")
+	assert.Equal(t, 2, eng.pasted.first, "first pasted line")
+	assert.Equal(t, 1+pasteMinLines, eng.pasted.last, "last pasted line")
+
+	eng.handleEvent(Event{Type: EventTextChangeTimeout})
+	assert.Equal(t, stateIdle, eng.state, "text change request skipped")
+	eng.handleEvent(Event{Type: EventIdleTimeout})
+	assert.Equal(t, stateIdle, eng.state, "idle request skipped")
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "test.go", FirstLine: 0, LastLine: 1, Lines: []string{"line 1x"}, Tick: 3}})
+	assert.Nil(t, eng.pasted, "typing after the paste")
+
+	eng.handleEvent(Event{Type: EventTextChangeTimeout})
+	assert.Equal(t, statePendingCompletion, eng.state, "request sent")
+}
+
+func TestPaste_Detection(t *testing.T) {
+	eng := createPasteTestEngine(t, PasteSkip)
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: pasteChange(pasteMinLines - 1)})
+	assert.Nil(t, eng.pasted, "small change")
+
+	change := BufferLines{Path: "test.go", FirstLine: 0, LastLine: 1, Lines: []string{"line 1 pasted"}, Tick: 3, Paste: true}
+	eng.handleEvent(Event{Type: EventBufferLines, Data: change})
+	assert.NotNil(t, eng.pasted, "paste reported by the editor")
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", LastLine: -1, Lines: []string{"a"}}})
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", FirstLine: 0, LastLine: 1, Lines: []string{"a", "b", "c", "d", "e", "f"}}})
+	assert.Equal(t, "test.go", eng.pasted.path, "pastes in other buffers ignored")
+}
+
+func TestPaste_DelayWaitsForQuietTime(t *testing.T) {
+	eng := createPasteTestEngine(t, PasteDelay)
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: pasteChange(pasteMinLines)})
+	eng.handleEvent(Event{Type: EventTextChangeTimeout})
+	assert.Equal(t, stateIdle, eng.state, "request delayed")
+	assert.NotNil(t, eng.textChangeTimer, "delay armed")
+
+	eng.handleEvent(Event{Type: EventTextChangeTimeout})
+	assert.Equal(t, statePendingCompletion, eng.state, "request sent after the delay")
+	assert.Nil(t, eng.pasted, "paste handled")
+}
+
+func TestPaste_CleanUpRequest(t *testing.T) {
+	eng := createPasteTestEngine(t, PasteCleanUp)
+	eng.buffer.(*mockBuffer).lines = []string{"func f() {", "x := 1", "y := 2", "z := 3", "w := 4", "v := 5", "}"}
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: pasteChange(pasteMinLines)})
+	req := eng.buildCompletionRequest(types.CompletionSourceTyping)
+
+	assert.Equal(t, types.CompletionSourcePaste, req.Source, "source")
+	assert.Contains(t, req.Instruction, "lines 2-6", "instruction")
+	assert.Equal(t, 2, req.CursorRow, "cursor at the paste")
+	assert.Nil(t, eng.pasted, "paste handled")
+
+	req = eng.buildCompletionRequest(types.CompletionSourceTyping)
+	assert.Equal(t, types.CompletionSourceTyping, req.Source, "next request as usual")
+}
+
+func TestPaste_CompleteTracksNothing(t *testing.T) {
+	eng := createPasteTestEngine(t, PasteComplete)
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: pasteChange(pasteMinLines)})
+	assert.Nil(t, eng.pasted, "no paste tracked")
+
+	eng.handleEvent(Event{Type: EventTextChangeTimeout})
+	assert.Equal(t, statePendingCompletion, eng.state, "request sent")
+}
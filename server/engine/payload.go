@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"cursortab/logger"
+	"cursortab/metrics"
+	"cursortab/types"
+)
+
+// PayloadMeasurer is implemented by providers that can tell the size of the
+// request body they would send for req. The size of other providers' requests
+// is estimated from the text they carry.
+type PayloadMeasurer interface {
+	PayloadSize(req *types.CompletionRequest) int
+}
+
+// payloadTrimAttempts bounds how often the context is trimmed further when
+// the measured payload still exceeds the cap, before it is dropped entirely.
+const payloadTrimAttempts = 3
+
+// payloadCap fits requests within MaxPayloadBytes before they are sent. It
+// holds what it needs so it can run off the event loop.
+type payloadCap struct {
+	limit    int
+	provider Provider
+	budgeter ContextBudgeter // Shares out what is left for context by weight
+	stats    *payloadStats
+}
+
+func (e *Engine) payloadCap() payloadCap {
+	return payloadCap{
+		limit:    e.config.MaxPayloadBytes,
+		provider: e.provider,
+		budgeter: ContextBudgeter{Weights: e.config.ContextBudget.Weights},
+		stats:    e.payload,
+	}
+}
+
+// apply returns req with its context trimmed until the payload fits the cap.
+// The current file is never cut: returns false when the request is still too
+// large without any context, and should not be sent.
+func (c payloadCap) apply(req *types.CompletionRequest) (*types.CompletionRequest, bool) {
+	size := c.measure(req)
+	if c.limit <= 0 || size <= c.limit {
+		c.stats.record(req, size, false)
+		return req, true
+	}
+
+	logger.Warn("payload: request of %d bytes exceeds the %d byte cap, trimming context (%s)",
+		size, c.limit, formatPayloadSources(payloadSources(req, size)))
+
+	trimmed := req
+	for attempt := 0; size > c.limit; attempt++ {
+		available := 0
+		if attempt < payloadTrimAttempts {
+			available = max(totalContextChars(trimmed)-(size-c.limit), 0)
+		}
+		trimmed = c.budgeter.trim(trimmed, available)
+		size = c.measure(trimmed)
+		if available == 0 {
+			break
+		}
+	}
+
+	if size > c.limit {
+		logger.Warn("payload: request is %d bytes without context, over the %d byte cap; not sending it (%s)",
+			size, c.limit, formatPayloadSources(payloadSources(trimmed, size)))
+		c.stats.skip()
+		return nil, false
+	}
+	c.stats.record(trimmed, size, true)
+	return trimmed, true
+}
+
+// measure returns the size of the payload sent for req.
+func (c payloadCap) measure(req *types.CompletionRequest) int {
+	if m, ok := c.provider.(PayloadMeasurer); ok {
+		return m.PayloadSize(req)
+	}
+	return estimatePayloadBytes(req)
+}
+
+// estimatePayloadBytes adds up the text req carries.
+func estimatePayloadBytes(req *types.CompletionRequest) int {
+	total := 0
+	for _, s := range payloadSources(req, 0) {
+		total += s.bytes
+	}
+	return total
+}
+
+type payloadSource struct {
+	name  string
+	bytes int
+}
+
+// payloadSources breaks the size of req down by source. The part of size
+// not accounted for by any source, such as the prompt template or the
+// request encoding, is reported as "other".
+func payloadSources(req *types.CompletionRequest, size int) []payloadSource {
+	sources := []payloadSource{
+		{"file", linesChars(req.Lines)},
+		{"previous_file", linesChars(req.PreviousLines)},
+		{"user_actions", userActionsChars(req.UserActions)},
+	}
+	for _, src := range contextSources {
+		sources = append(sources, payloadSource{string(src), contextChars(req, src)})
+	}
+
+	counted := 0
+	for _, s := range sources {
+		counted += s.bytes
+	}
+	if size > counted {
+		sources = append(sources, payloadSource{"other", size - counted})
+	}
+	return sources
+}
+
+// formatPayloadSources formats the non-empty sources, e.g. "file=1200 lsp=300".
+func formatPayloadSources(sources []payloadSource) string {
+	var parts []string
+	for _, s := range sources {
+		if s.bytes > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", s.name, s.bytes))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func totalContextChars(req *types.CompletionRequest) int {
+	total := 0
+	for _, src := range contextSources {
+		total += contextChars(req, src)
+	}
+	return total
+}
+
+func userActionsChars(actions []*types.UserAction) int {
+	chars := 0
+	for _, a := range actions {
+		chars += len(a.ActionType) + len(a.FilePath)
+	}
+	return chars
+}
+
+// payloadStats keeps the size of the last request for :CursortabStats.
+// Guarded by its own lock since prefetches are capped off the event loop.
+type payloadStats struct {
+	mu        sync.Mutex
+	lastBytes int
+	sources   map[string]int
+	truncated int
+	skipped   int
+}
+
+func (s *payloadStats) record(req *types.CompletionRequest, size int, truncated bool) {
+	sources := make(map[string]int)
+	for _, src := range payloadSources(req, size) {
+		if src.bytes > 0 {
+			sources[src.name] = src.bytes
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastBytes = size
+	s.sources = sources
+	if truncated {
+		s.truncated++
+	}
+}
+
+func (s *payloadStats) skip() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skipped++
+}
+
+func (s *payloadStats) status() metrics.PayloadStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return metrics.PayloadStatus{
+		LastBytes: s.lastBytes,
+		Sources:   s.sources,
+		Truncated: s.truncated,
+		Skipped:   s.skipped,
+	}
+}
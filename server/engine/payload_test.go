@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestPayloadCap_UnderCap(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+	eng.config.MaxPayloadBytes = 1000
+	req := &types.CompletionRequest{Lines: []string{"package main"}}
+
+	got, ok := eng.payloadCap().apply(req)
+
+	assert.True(t, ok, "sent")
+	assert.True(t, got == req, "request unchanged")
+	payload := eng.Stats().Payload
+	assert.Equal(t, 13, payload.LastBytes, "last bytes")
+	assert.Equal(t, 13, payload.Sources["file"], "file bytes")
+	assert.Equal(t, 0, payload.Truncated, "not truncated")
+}
+
+func TestPayloadCap_TrimsContext(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+	eng.config.MaxPayloadBytes = 300
+	req := &types.CompletionRequest{
+		FilePath: "main.go",
+		Lines:    []string{strings.Repeat("a", 100)},
+		FileDiffHistories: []*types.FileDiffHistory{
+			{FileName: "main.go", DiffHistory: []*types.DiffEntry{{Original: "x := 1", Updated: "x := 2"}}},
+		},
+		AdditionalContext: &types.ContextResult{GitDiff: &types.GitDiffContext{Diff: strings.Repeat("+added line\n", 100)}},
+	}
+
+	got, ok := eng.payloadCap().apply(req)
+
+	assert.True(t, ok, "sent")
+	assert.LessOrEqual(t, estimatePayloadBytes(got), 300, "fits the cap")
+	assert.Equal(t, req.Lines, got.Lines, "current file kept")
+	assert.Len(t, 1, got.FileDiffHistories, "diff history kept")
+	assert.Equal(t, 1200, len(req.AdditionalContext.GitDiff.Diff), "original request untouched")
+	assert.Equal(t, 1, eng.Stats().Payload.Truncated, "truncated count")
+}
+
+func TestPayloadCap_SkipsOversizedFile(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{strings.Repeat("a", 500)}
+	prov := newMockProvider()
+	eng, cancel := createTestEngineWithContext(buf, prov, newMockClock())
+	defer cancel()
+	eng.config.MaxPayloadBytes = 100
+
+	assert.False(t, eng.sendCompletionRequest(eng.buildCompletionRequest(types.CompletionSourceTyping)), "not sent")
+	assert.Equal(t, stateIdle, eng.state, "no request pending")
+	assert.Equal(t, 1, eng.Stats().Payload.Skipped, "skipped count")
+	assert.Equal(t, 100, eng.Stats().Payload.Limit, "limit")
+}
+
+func TestFormatPayloadSources(t *testing.T) {
+	req := &types.CompletionRequest{
+		Lines:             []string{"abcd"},
+		AdditionalContext: &types.ContextResult{GitDiff: &types.GitDiffContext{Diff: "+x\n"}},
+	}
+
+	got := formatPayloadSources(payloadSources(req, 20))
+
+	assert.Equal(t, "file=5 git_diff=3 other=12", got, "breakdown")
+}
@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"cursortab/logger"
+	"cursortab/text"
+)
+
+// recordPlaceholders remembers the placeholders of the stage just accepted.
+// Only the stage accepted last keeps its placeholders, since later stages
+// may move the lines of earlier ones.
+func (e *Engine) recordPlaceholders() {
+	if !e.config.Placeholders || e.addingImports || e.stagedCompletion == nil {
+		return
+	}
+	stage := e.getStage(e.stagedCompletion.CurrentIdx)
+	if stage == nil {
+		return
+	}
+	e.placeholders = nil
+	for _, p := range text.ExtractPlaceholders(&text.DiffResult{Changes: stage.Changes}) {
+		p.Line += stage.BufferStart - 1
+		e.placeholders = append(e.placeholders, p)
+	}
+}
+
+// showPlaceholders hands the placeholders of the accepted completion to the
+// editor, which lets the accept keys cycle the cursor through them while
+// nothing else is shown.
+func (e *Engine) showPlaceholders() {
+	placeholders := e.placeholders
+	e.placeholders = nil
+	if len(placeholders) == 0 {
+		return
+	}
+	if err := e.buffer.ShowPlaceholders(placeholders); err != nil {
+		logger.Warn("placeholders: %v", err)
+	}
+}
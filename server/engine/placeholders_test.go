@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/text"
+	"cursortab/types"
+)
+
+func newPlaceholderEngine(t *testing.T) (*Engine, *mockBuffer) {
+	t.Helper()
+	buf := newMockBuffer()
+	buf.lines = []string{"package main", "", "func main() {", "}"}
+	buf.row = 3
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), newMockClock())
+	t.Cleanup(cancel)
+	eng.config.Placeholders = true
+	return eng, buf
+}
+
+func TestPlaceholders_ShownAfterAccept(t *testing.T) {
+	eng, buf := newPlaceholderEngine(t)
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 3, EndLineInc: 4, Lines: []string{"func main() {", "\tgreet(\"world\", count)", "}"}},
+	}})
+	buf.lines = []string{"package main", "", "func main() {", "\tgreet(\"world\", count)", "}"}
+	eng.acceptCompletion()
+
+	assert.Equal(t, []text.Placeholder{
+		{Line: 4, ColSpan: text.ColSpan{Start: 8, End: 13}},
+		{Line: 4, ColSpan: text.ColSpan{Start: 16, End: 21}},
+	}, buf.placeholders, "placeholders in buffer coordinates")
+	assert.Nil(t, eng.placeholders, "placeholders handed over")
+}
+
+func TestPlaceholders_Disabled(t *testing.T) {
+	eng, buf := newPlaceholderEngine(t)
+	eng.config.Placeholders = false
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 3, EndLineInc: 4, Lines: []string{"func main() {", "\tgreet(\"world\")", "}"}},
+	}})
+	buf.lines = []string{"package main", "", "func main() {", "\tgreet(\"world\")", "}"}
+	eng.acceptCompletion()
+
+	assert.Nil(t, buf.placeholders, "no placeholders")
+}
+
+func TestPlaceholders_NoneWithoutVariableParts(t *testing.T) {
+	eng, buf := newPlaceholderEngine(t)
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 3, EndLineInc: 4, Lines: []string{"func main() {", "\treturn", "}"}},
+	}})
+	buf.lines = []string{"package main", "", "func main() {", "\treturn", "}"}
+	eng.acceptCompletion()
+
+	assert.Nil(t, buf.placeholders, "no placeholders")
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"cursortab/logger"
+	"cursortab/types"
+)
+
+// speculativePrefetch is a completion requested further ahead than the regular
+// prefetch, against the buffer as it will be once every completion before it
+// in the pipeline is accepted.
+type speculativePrefetch struct {
+	lines   []string                  // Buffer content the completion was requested against
+	resp    *types.CompletionResponse // nil while the request is in flight
+	regions []regionHash              // Regions of lines the completions replace
+}
+
+// speculativeResult is the outcome of a speculative prefetch request.
+type speculativeResult struct {
+	entry *speculativePrefetch
+	resp  *types.CompletionResponse
+	err   error
+}
+
+// applyCompletion returns lines with comp applied.
+func applyCompletion(lines []string, comp *types.Completion) []string {
+	start := min(max(comp.StartLine-1, 0), len(lines))
+	end := min(max(comp.EndLineInc, start), len(lines))
+	return slices.Concat(lines[:start], comp.Lines, lines[end:])
+}
+
+// extendSpeculation keeps PrefetchDepth completions in the pipeline: after
+// the last known completion, it requests the next one at the cursor target
+// that completion predicts, or at its last line, against the buffer with that
+// completion applied. One speculative request is in flight at a time.
+func (e *Engine) extendSpeculation() {
+	if len(e.speculative)+1 >= e.config.CursorPrediction.PrefetchDepth {
+		return
+	}
+
+	lines, resp := e.prefetchLines, e.prefetchResp
+	if n := len(e.speculative); n > 0 {
+		lines, resp = e.speculative[n-1].lines, e.speculative[n-1].resp
+	}
+	if resp == nil || len(resp.Completions) == 0 || lines == nil {
+		return
+	}
+
+	comp := resp.Completions[0]
+	next := applyCompletion(lines, comp)
+	row := comp.StartLine + max(len(comp.Lines)-1, 0)
+	if target := resp.CursorTarget; target != nil {
+		if !target.ShouldRetrigger || (target.RelativePath != "" && target.RelativePath != e.buffer.Path()) {
+			return
+		}
+		row = int(target.LineNumber)
+	}
+	row = min(max(row, 1), max(len(next), 1))
+
+	req := &types.CompletionRequest{
+		Source:            types.CompletionSourceTyping,
+		WorkspacePath:     e.WorkspacePath,
+		WorkspaceID:       e.WorkspaceID,
+		ProjectRoot:       e.projectRoot(),
+		FilePath:          e.buffer.Path(),
+		Lines:             next,
+		Version:           e.buffer.Version(),
+		PreviousLines:     lines,
+		FileDiffHistories: e.getAllFileDiffHistories(),
+		CursorRow:         row,
+		FenceLanguage:     fenceLanguage(e.buffer.Path(), next, row),
+		ViewportHeight:    e.getViewportHeightConstraint(),
+		MaxVisibleLines:   e.config.MaxVisibleLines,
+		ProviderOptions:   e.config.ProviderOptions,
+	}
+	req, ok := e.fitToBudget(req)
+	if !ok || !e.breakerAllows() {
+		return
+	}
+	if ok, _ := e.limiter.admit(e.clock.Now()); !ok {
+		logger.Debug("rate limit: skipping speculative prefetch")
+		e.limiter.noteSkippedPrefetch()
+		return
+	}
+	e.budget.record(e.clock.Now(), estimateRequestTokens(req))
+	e.stats.RecordRequest(e.providerName(), estimateRequestTokens(req))
+
+	entry := &speculativePrefetch{lines: next}
+	e.speculative = append(e.speculative, entry)
+	ctx, cancel := e.requestContext()
+	e.speculativeCancel = cancel
+	payload := e.payloadCap()
+
+	go func() {
+		defer cancel()
+
+		event := Event{Type: EventSpeculativeError, Data: speculativeResult{entry: entry}}
+		if req, ok := payload.apply(req); ok {
+			sent, secrets := e.redactRequest(req)
+			result, err := e.provider.GetCompletion(ctx, sent)
+			if err == nil {
+				revealResponse(result, secrets)
+				event = Event{Type: EventSpeculativeReady, Data: speculativeResult{entry: entry, resp: result}}
+			} else {
+				event.Data = speculativeResult{entry: entry, err: err}
+			}
+		}
+
+		select {
+		case e.eventChan <- event:
+		case <-e.mainCtx.Done():
+		}
+	}()
+}
+
+// deliverSpeculation hands the next completion of the pipeline over as the
+// result of the regular prefetch, through the same event as a response.
+func (e *Engine) deliverSpeculation(entry *speculativePrefetch) {
+	ctx, cancel := context.WithCancel(e.mainCtx)
+	e.prefetchCancel = cancel
+	e.prefetchState = prefetchInFlight
+	e.prefetchLines = copyLines(e.buffer.Lines()) // What the re-based completion applies to
+
+	go func() {
+		select {
+		case e.eventChan <- Event{Type: EventPrefetchReady, Data: entry.resp}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// handleSpeculativeReady stores a speculative completion and extends the
+// pipeline after it. Results of requests dropped since are ignored.
+func (e *Engine) handleSpeculativeReady(result speculativeResult) {
+	if !slices.Contains(e.speculative, result.entry) {
+		return
+	}
+	result.entry.resp = result.resp
+	result.entry.regions = hashRegions(result.entry.lines, result.resp.Completions)
+	e.speculativeCancel = nil
+	e.extendSpeculation()
+}
+
+// handleSpeculativeError drops the failed speculative request: the pipeline
+// ends at the last completion that arrived.
+func (e *Engine) handleSpeculativeError(result speculativeResult) {
+	if result.err != nil && !errors.Is(result.err, context.Canceled) {
+		logger.Error("speculative prefetch error: %v", result.err)
+	}
+	if i := slices.Index(e.speculative, result.entry); i >= 0 {
+		e.speculative = e.speculative[:i]
+		e.speculativeCancel = nil
+	}
+}
+
+// takeSpeculation returns the next completion of the pipeline, re-based on
+// the buffer, when the lines it replaces are still as it expected. Otherwise
+// an accepted stage or an edit of the user changed that region, and the whole
+// pipeline is dropped.
+func (e *Engine) takeSpeculation() *speculativePrefetch {
+	if len(e.speculative) == 0 || e.speculative[0].resp == nil {
+		return nil
+	}
+
+	entry := e.speculative[0]
+	comps, _, ok := rebaseCompletions(entry.resp.Completions, entry.regions, e.buffer.Lines())
+	if !ok {
+		logger.Debug("prefetch: buffer changed under the speculative completion, dropping %d", len(e.speculative))
+		e.dropSpeculation()
+		return nil
+	}
+	e.speculative = e.speculative[1:]
+	resp := *entry.resp
+	resp.Completions = comps
+	return &speculativePrefetch{lines: entry.lines, resp: &resp}
+}
+
+// dropSpeculation cancels the pipeline beyond the regular prefetch.
+func (e *Engine) dropSpeculation() {
+	if e.speculativeCancel != nil {
+		e.speculativeCancel()
+		e.speculativeCancel = nil
+	}
+	e.speculative = nil
+}
@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func speculationEngine(t *testing.T, depth int) (*Engine, *mockBuffer, *mockProvider) {
+	t.Helper()
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b", "c", "d"}
+	prov := newMockProvider()
+	eng, cancel := createTestEngineWithContext(buf, prov, newMockClock())
+	t.Cleanup(cancel)
+	eng.config.CursorPrediction.PrefetchDepth = depth
+	eng.prefetchLines = buf.lines
+	return eng, buf, prov
+}
+
+func TestApplyCompletion(t *testing.T) {
+	lines := []string{"a", "b", "c"}
+
+	got := applyCompletion(lines, &types.Completion{StartLine: 2, EndLineInc: 2, Lines: []string{"B", "B2"}})
+
+	assert.Equal(t, []string{"a", "B", "B2", "c"}, got, "lines")
+	assert.Equal(t, []string{"a", "b", "c"}, lines, "input untouched")
+}
+
+func TestPrefetchDepth_RequestsNextAgainstAppliedCompletion(t *testing.T) {
+	eng, _, prov := speculationEngine(t, 2)
+
+	eng.handlePrefetchReady(&types.CompletionResponse{
+		Completions:  []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"A"}}},
+		CursorTarget: &types.CursorPredictionTarget{LineNumber: 3, ShouldRetrigger: true},
+	})
+
+	assert.Len(t, 1, eng.speculative, "speculative request in flight")
+	eng.handleEvent(waitForEvent(t, eng, EventSpeculativeReady))
+
+	assert.Equal(t, []string{"A", "b", "c", "d"}, prov.lastRequest.Lines, "requested with the prefetch applied")
+	assert.Equal(t, 3, prov.lastRequest.CursorRow, "requested at the predicted target")
+	assert.NotNil(t, eng.speculative[0].resp, "speculative completion stored")
+	assert.Equal(t, 1, prov.completionCalls, "depth reached, no further request")
+}
+
+func TestPrefetchDepth_OneOnlyPrefetchesNext(t *testing.T) {
+	eng, _, prov := speculationEngine(t, 1)
+
+	eng.handlePrefetchReady(&types.CompletionResponse{
+		Completions: []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"A"}}},
+	})
+
+	assert.Len(t, 0, eng.speculative, "no speculation")
+	assert.Equal(t, 0, prov.completionCalls, "no request")
+}
+
+func TestPrefetchDepth_StopsWithoutRetrigger(t *testing.T) {
+	eng, _, prov := speculationEngine(t, 3)
+
+	eng.handlePrefetchReady(&types.CompletionResponse{
+		Completions:  []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"A"}}},
+		CursorTarget: &types.CursorPredictionTarget{LineNumber: 3, ShouldRetrigger: false},
+	})
+
+	assert.Len(t, 0, eng.speculative, "no speculation")
+	assert.Equal(t, 0, prov.completionCalls, "no request")
+}
+
+func speculated(lines []string, comp *types.Completion) *speculativePrefetch {
+	comps := []*types.Completion{comp}
+	return &speculativePrefetch{
+		lines:   lines,
+		resp:    &types.CompletionResponse{Completions: comps},
+		regions: hashRegions(lines, comps),
+	}
+}
+
+func TestTakeSpeculation_ValidAfterEditElsewhere(t *testing.T) {
+	eng, buf, _ := speculationEngine(t, 3)
+	entry := speculated([]string{"A", "b", "c", "d"}, &types.Completion{StartLine: 3, EndLineInc: 3, Lines: []string{"C"}})
+	eng.speculative = []*speculativePrefetch{entry}
+	buf.lines = []string{"A!", "b", "c", "d"}
+
+	taken := eng.takeSpeculation()
+
+	assert.NotNil(t, taken, "region untouched")
+	assert.Equal(t, entry.resp.Completions[0], taken.resp.Completions[0], "completion as requested")
+	assert.Len(t, 0, eng.speculative, "taken from the pipeline")
+}
+
+func TestTakeSpeculation_RebasesAfterLinesAddedAbove(t *testing.T) {
+	eng, buf, _ := speculationEngine(t, 3)
+	eng.speculative = []*speculativePrefetch{
+		speculated([]string{"A", "b", "c", "d"}, &types.Completion{StartLine: 3, EndLineInc: 3, Lines: []string{"C"}}),
+	}
+	buf.lines = []string{"new", "A", "b", "c", "d"}
+
+	taken := eng.takeSpeculation()
+
+	assert.NotNil(t, taken, "region moved, not edited")
+	assert.Equal(t, 4, taken.resp.Completions[0].StartLine, "start follows the region")
+	assert.Equal(t, 4, taken.resp.Completions[0].EndLineInc, "end follows the region")
+}
+
+func TestTakeSpeculation_DropsPipelineWhenRegionChanged(t *testing.T) {
+	eng, buf, _ := speculationEngine(t, 3)
+	eng.speculative = []*speculativePrefetch{
+		speculated([]string{"A", "b", "c", "d"}, &types.Completion{StartLine: 3, EndLineInc: 3, Lines: []string{"C"}}),
+		speculated([]string{"A", "b", "C", "d"}, &types.Completion{StartLine: 4, EndLineInc: 4, Lines: []string{"D"}}),
+	}
+	buf.lines = []string{"A", "b", "x", "d"}
+
+	assert.Nil(t, eng.takeSpeculation(), "region changed")
+	assert.Len(t, 0, eng.speculative, "pipeline dropped")
+}
+
+func TestRequestPrefetch_DeliversSpeculation(t *testing.T) {
+	eng, buf, prov := speculationEngine(t, 3)
+	entry := speculated([]string{"A", "b", "c", "d"}, &types.Completion{StartLine: 3, EndLineInc: 3, Lines: []string{"C"}})
+	eng.speculative = []*speculativePrefetch{entry}
+	buf.lines = []string{"A", "b", "c", "d"}
+
+	assert.True(t, eng.requestPrefetch(types.CompletionSourceTyping, 3, 0), "prefetch served")
+
+	ev := waitForEvent(t, eng, EventPrefetchReady)
+	assert.Equal(t, entry.resp, ev.Data, "speculative completion delivered")
+	assert.Equal(t, 0, prov.completionCalls, "no provider request")
+	assert.Equal(t, prefetchInFlight, eng.prefetchState, "prefetch state")
+}
+
+func TestClearState_DropsSpeculation(t *testing.T) {
+	eng, _, _ := speculationEngine(t, 3)
+	eng.speculative = []*speculativePrefetch{{lines: []string{"a"}}}
+
+	eng.reject()
+
+	assert.Len(t, 0, eng.speculative, "pipeline dropped")
+}
+
+func TestRegionHash_Locate(t *testing.T) {
+	base := []string{"a", "b", "c", "d", "e"}
+	region := newRegionHash(base, &types.Completion{StartLine: 3, EndLineInc: 3})
+
+	offset, ok := region.locate(base)
+	assert.True(t, ok && offset == 0, "unchanged")
+
+	offset, ok = region.locate([]string{"x", "y", "a", "b", "c", "d", "e"})
+	assert.True(t, ok, "moved")
+	assert.Equal(t, 2, offset, "offset")
+
+	_, ok = region.locate([]string{"a", "b", "C", "d", "e"})
+	assert.False(t, ok, "replaced line edited")
+
+	_, ok = region.locate([]string{"a", "B", "c", "d", "e"})
+	assert.False(t, ok, "context line edited")
+}
+
+func TestTryShowPrefetchedCompletion_DropsStalePrefetch(t *testing.T) {
+	eng, buf, _ := speculationEngine(t, 1)
+	eng.setPrefetched(&types.CompletionResponse{
+		Completions: []*types.Completion{{StartLine: 2, EndLineInc: 2, Lines: []string{"b", "inserted"}}},
+	}, []string{"a", "b", "c", "d"})
+	eng.prefetchState = prefetchReady
+	buf.lines = []string{"a", "b", "inserted", "c", "d"}
+
+	assert.False(t, eng.tryShowPrefetchedCompletion(), "not shown over the change")
+	assert.Nil(t, eng.prefetchedCompletions, "prefetch dropped")
+	assert.Equal(t, prefetchNone, eng.prefetchState, "prefetch state")
+}
+
+func TestTryShowPrefetchedCompletion_RebasesPrefetch(t *testing.T) {
+	eng, buf, _ := speculationEngine(t, 1)
+	eng.setPrefetched(&types.CompletionResponse{
+		Completions: []*types.Completion{{StartLine: 3, EndLineInc: 3, Lines: []string{"C"}}},
+	}, []string{"a", "b", "c", "d"})
+	eng.prefetchState = prefetchReady
+	buf.lines = []string{"a", "a2", "b", "c", "d"}
+
+	assert.True(t, eng.tryShowPrefetchedCompletion(), "shown")
+	assert.Equal(t, 4, eng.completions[0].StartLine, "shown at the moved line")
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+
+	"cursortab/text"
+)
+
+// PreviewGroup is one rendering group of a pending stage.
+type PreviewGroup struct {
+	Type       string `json:"type"`        // "modification", "addition" or "deletion"
+	BufferLine int    `json:"buffer_line"` // 1-indexed
+	Lines      int    `json:"lines"`       // Lines of new content
+}
+
+// PreviewStage is one stage still to be accepted.
+type PreviewStage struct {
+	FilePath    string         `json:"file_path"`
+	BufferStart int            `json:"buffer_start"` // 1-indexed
+	BufferEnd   int            `json:"buffer_end"`   // 1-indexed, inclusive
+	OldLines    []string       `json:"old_lines"`
+	Lines       []string       `json:"lines"`
+	Groups      []PreviewGroup `json:"groups"`
+	Current     bool           `json:"current"` // Shown in the buffer now
+}
+
+// diffContextLines is the number of unchanged lines around each hunk of PendingDiff
+const diffContextLines = 3
+
+// Preview lists the pending stages of the shown completion, starting with the
+// current one, followed by the stages of the other files of a multi-file
+// completion. It is empty when no completion is shown.
+func (e *Engine) Preview() []PreviewStage {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	stages := []PreviewStage{}
+	if sc := e.stagedCompletion; sc != nil {
+		for i := sc.CurrentIdx; i < len(sc.Stages); i++ {
+			stages = append(stages, previewStage(e.buffer.Path(), e.buffer.Lines(), sc.Stages[i], i == sc.CurrentIdx))
+		}
+	} else if len(e.completions) > 0 {
+		c := e.completions[0]
+		stages = append(stages, previewStage(e.buffer.Path(), e.buffer.Lines(), &text.Stage{
+			BufferStart: c.StartLine,
+			BufferEnd:   c.EndLineInc,
+			Lines:       c.Lines,
+			Groups:      e.currentGroups,
+		}, true))
+	}
+
+	for _, f := range e.pendingFiles() {
+		for _, stage := range f.Staged.Stages {
+			stages = append(stages, previewStage(f.Staged.SourcePath, f.OldLines, stage, false))
+		}
+	}
+	return stages
+}
+
+// previewStage describes stage of the file at path, whose content is lines.
+func previewStage(path string, lines []string, stage *text.Stage, current bool) PreviewStage {
+	p := PreviewStage{
+		FilePath:    path,
+		BufferStart: stage.BufferStart,
+		BufferEnd:   stage.BufferEnd,
+		OldLines:    []string{},
+		Lines:       stage.Lines,
+		Groups:      []PreviewGroup{},
+		Current:     current,
+	}
+	start, end := replacedRange(lines, stage)
+	p.OldLines = append(p.OldLines, lines[start:end]...)
+	for _, g := range stage.Groups {
+		p.Groups = append(p.Groups, PreviewGroup{Type: g.Type, BufferLine: g.BufferLine, Lines: len(g.Lines)})
+	}
+	return p
+}
+
+// PendingDiff renders the pending stages of the shown completion, in this and
+// the other files it edits, as a unified diff against their current content.
+// Returns "" when no completion is shown.
+func (e *Engine) PendingDiff() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var sb strings.Builder
+	var pending []*text.Stage
+	if sc := e.stagedCompletion; sc != nil {
+		pending = sc.Stages[min(sc.CurrentIdx, len(sc.Stages)):]
+	} else if len(e.completions) > 0 {
+		c := e.completions[0]
+		pending = []*text.Stage{{BufferStart: c.StartLine, BufferEnd: c.EndLineInc, Lines: c.Lines}}
+	}
+	if len(pending) > 0 {
+		lines := e.buffer.Lines()
+		sb.WriteString(text.UnifiedDiff(e.buffer.Path(), lines, applyStages(lines, pending), diffContextLines))
+	}
+	for _, f := range e.pendingFiles() {
+		sb.WriteString(text.UnifiedDiff(f.Staged.SourcePath, f.OldLines, applyStages(f.OldLines, f.Staged.Stages), diffContextLines))
+	}
+	return sb.String()
+}
+
+// pendingFiles returns the files of a multi-file completion not opened yet.
+func (e *Engine) pendingFiles() []*text.FileStages {
+	if e.multiFile == nil {
+		return nil
+	}
+	// The current file's stages are those of the buffer once it is open
+	next := e.multiFile.CurrentFile
+	if current := e.multiFile.Current(); current != nil && current.Staged == e.stagedCompletion {
+		next++
+	}
+	return e.multiFile.Files[min(next, len(e.multiFile.Files)):]
+}
+
+// replacedRange returns the 0-indexed half-open range of lines that stage replaces.
+func replacedRange(lines []string, stage *text.Stage) (int, int) {
+	start := min(max(stage.BufferStart-1, 0), len(lines))
+	return start, min(start+replacedLineCount(stage), len(lines))
+}
+
+// applyStages returns lines with stages applied. Stages do not overlap and are
+// in the coordinates of lines, so they are applied from the bottom up.
+func applyStages(lines []string, stages []*text.Stage) []string {
+	sorted := slices.Clone(stages)
+	slices.SortFunc(sorted, func(a, b *text.Stage) int { return b.BufferStart - a.BufferStart })
+	result := slices.Clone(lines)
+	for _, stage := range sorted {
+		start, end := replacedRange(result, stage)
+		result = slices.Concat(result[:start], stage.Lines, result[end:])
+	}
+	return result
+}
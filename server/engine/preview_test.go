@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/text"
+	"cursortab/types"
+)
+
+func TestPreview_NoCompletion(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+
+	assert.Len(t, 0, eng.Preview(), "no stages")
+}
+
+func TestPreview_ListsPendingStages(t *testing.T) {
+	buf := newMockBuffer()
+	buf.path = "main.go"
+	buf.lines = []string{"a := 1", "b := 2", "c := 3", "d := 4", "e := 5", "f := 6"}
+	buf.row = 1
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.config.CursorPrediction.ProximityThreshold = 1
+
+	shown := eng.processCompletion(&types.Completion{
+		StartLine:  1,
+		EndLineInc: 6,
+		Lines:      []string{"a := 10", "b := 2", "c := 3", "d := 4", "e := 5", "f := 60"},
+	})
+	assert.True(t, shown, "completion shown")
+
+	stages := eng.Preview()
+
+	assert.Len(t, 2, stages, "stages")
+	assert.True(t, stages[0].Current, "first stage is current")
+	assert.Equal(t, "main.go", stages[0].FilePath, "file path")
+	assert.Equal(t, 1, stages[0].BufferStart, "first stage start")
+	assert.Equal(t, []string{"a := 1"}, stages[0].OldLines, "first stage old lines")
+	assert.Equal(t, []string{"a := 10"}, stages[0].Lines, "first stage new lines")
+	assert.Len(t, 1, stages[0].Groups, "first stage groups")
+	assert.Equal(t, "modification", stages[0].Groups[0].Type, "group type")
+	assert.False(t, stages[1].Current, "second stage pending")
+	assert.Equal(t, 6, stages[1].BufferStart, "second stage start")
+	assert.Equal(t, []string{"f := 6"}, stages[1].OldLines, "second stage old lines")
+}
+
+func TestPreview_IncludesOtherFiles(t *testing.T) {
+	buf := newMockBuffer()
+	buf.path = "a.go"
+	buf.lines = []string{"x := 1"}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	shown := eng.processCompletion(&types.Completion{StartLine: 1, EndLineInc: 1, Lines: []string{"x := 2"}})
+	assert.True(t, shown, "completion shown")
+	other := &text.FileStages{
+		Staged: &text.StagedCompletion{
+			SourcePath: "b.go",
+			Stages:     []*text.Stage{{BufferStart: 2, BufferEnd: 2, Lines: []string{"y := 2"}}},
+		},
+		OldLines: []string{"package b", "y := 1"},
+	}
+	eng.multiFile = text.NewMultiFileStagedCompletion(&text.FileStages{Staged: eng.stagedCompletion}, other)
+
+	stages := eng.Preview()
+
+	assert.Len(t, 2, stages, "stages")
+	assert.Equal(t, "a.go", stages[0].FilePath, "current file first")
+	assert.Equal(t, "b.go", stages[1].FilePath, "other file")
+	assert.Equal(t, []string{"y := 1"}, stages[1].OldLines, "other file old lines")
+	assert.Equal(t, []string{"y := 2"}, stages[1].Lines, "other file new lines")
+}
+
+func TestPendingDiff_NoCompletion(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+
+	assert.Equal(t, "", eng.PendingDiff(), "no diff")
+}
+
+func TestPendingDiff_AllStages(t *testing.T) {
+	buf := newMockBuffer()
+	buf.path = "main.go"
+	buf.lines = []string{"a := 1", "b := 2", "c := 3", "d := 4", "e := 5", "f := 6", "g := 7", "h := 8", "i := 9"}
+	buf.row = 1
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.config.CursorPrediction.ProximityThreshold = 1
+
+	shown := eng.processCompletion(&types.Completion{
+		StartLine:  1,
+		EndLineInc: 9,
+		Lines:      []string{"a := 10", "b := 2", "c := 3", "d := 4", "e := 5", "f := 6", "g := 7", "h := 8", "i := 90"},
+	})
+	assert.True(t, shown, "completion shown")
+	assert.Len(t, 2, eng.stagedCompletion.Stages, "stages")
+
+	want := "--- a/main.go\n+++ b/main.go\n" +
+		"@@ -1,4 +1,4 @@\n-a := 1\n+a := 10\n b := 2\n c := 3\n d := 4\n" +
+		"@@ -6,4 +6,4 @@\n f := 6\n g := 7\n h := 8\n-i := 9\n+i := 90\n"
+	assert.Equal(t, want, eng.PendingDiff(), "diff")
+}
+
+func TestApplyStages_PureAddition(t *testing.T) {
+	lines := []string{"a", "b"}
+	stages := []*text.Stage{
+		{BufferStart: 1, BufferEnd: 1, Lines: []string{"A"}, Groups: []*text.Group{{Type: "modification"}}},
+		{BufferStart: 2, BufferEnd: 2, Lines: []string{"x", "y"}, Groups: []*text.Group{{Type: "addition"}}},
+	}
+
+	assert.Equal(t, []string{"A", "x", "y", "b"}, applyStages(lines, stages), "applied")
+}
@@ -0,0 +1,78 @@
+package engine
+
+// Actions of the accept key reported in Progress
+const (
+	ProgressAccept = "accept" // Tab applies the shown completion
+	ProgressJump   = "jump"   // Tab moves to the predicted cursor target
+	ProgressNone   = "none"   // Nothing is shown; Tab falls through
+)
+
+// Progress tells a statusline what the accept key will do, how much of a
+// staged completion is left and whether the provider is degraded or offline.
+type Progress struct {
+	Action         string `json:"action"`
+	Stage          int    `json:"stage"`           // Current stage, 1-indexed (0 without a completion)
+	Stages         int    `json:"stages"`          // Stages in the completion (0 without a completion)
+	LinesRemaining int    `json:"lines_remaining"` // Lines in the current and later stages
+	Provider       string `json:"provider"`        // Filled in by the daemon
+	Degraded       bool   `json:"degraded"`        // The provider keeps failing and automatic requests are paused
+	Offline        bool   `json:"offline"`         // The provider is unreachable and idle completions are paused
+}
+
+// SetProgressListener registers fn to be called with the new progress each
+// time it changes. fn runs with the engine locked and must not block.
+func (e *Engine) SetProgressListener(fn func(Progress)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onProgress = fn
+}
+
+// Progress returns the current progress.
+func (e *Engine) Progress() Progress {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.progress()
+}
+
+func (e *Engine) progress() Progress {
+	p := Progress{Action: ProgressNone, Degraded: e.breaker.degraded(), Offline: e.offline}
+	switch {
+	case e.state == stateHasCompletion,
+		e.state == stateStreamingCompletion && len(e.completions) > 0:
+		p.Action = ProgressAccept
+	case e.state == stateHasCursorTarget:
+		p.Action = ProgressJump
+	default:
+		return p
+	}
+
+	if sc := e.stagedCompletion; sc != nil && sc.CurrentIdx < len(sc.Stages) {
+		p.Stage = sc.CurrentIdx + 1
+		p.Stages = len(sc.Stages)
+		for _, stage := range sc.Stages[sc.CurrentIdx:] {
+			p.LinesRemaining += len(stage.Lines)
+		}
+		return p
+	}
+	if len(e.completions) > 0 {
+		p.Stage, p.Stages = 1, 1
+		for _, c := range e.completions {
+			p.LinesRemaining += len(c.Lines)
+		}
+	}
+	return p
+}
+
+// publishProgress notifies the listener when progress changed since the
+// last call. Called after every event the engine handles.
+func (e *Engine) publishProgress() {
+	if e.onProgress == nil {
+		return
+	}
+	p := e.progress()
+	if p == e.lastProgress {
+		return
+	}
+	e.lastProgress = p
+	e.onProgress(p)
+}
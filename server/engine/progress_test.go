@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/text"
+	"cursortab/types"
+)
+
+func TestProgress_StagedCompletion(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+	eng.stagedCompletion = &text.StagedCompletion{
+		Stages: []*text.Stage{
+			{Lines: []string{"a", "b"}},
+			{Lines: []string{"c"}},
+			{Lines: []string{"d", "e", "f"}},
+		},
+		CurrentIdx: 1,
+	}
+	eng.state = stateHasCursorTarget
+
+	p := eng.Progress()
+
+	assert.Equal(t, ProgressJump, p.Action, "action")
+	assert.Equal(t, 2, p.Stage, "stage")
+	assert.Equal(t, 3, p.Stages, "stages")
+	assert.Equal(t, 4, p.LinesRemaining, "lines in current and later stages")
+}
+
+func TestProgress_SingleCompletionAndIdle(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+	eng.completions = []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"x", "y"}}}
+	eng.state = stateHasCompletion
+
+	assert.Equal(t, Progress{Action: ProgressAccept, Stage: 1, Stages: 1, LinesRemaining: 2}, eng.Progress(), "completion")
+
+	eng.state = stateIdle
+	assert.Equal(t, Progress{Action: ProgressNone}, eng.Progress(), "idle")
+}
+
+func TestProgress_ListenerCalledOnChange(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b", "c"}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	var got []Progress
+	eng.SetProgressListener(func(p Progress) { got = append(got, p) })
+	eng.completions = []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"A"}}}
+	eng.state = stateHasCompletion
+
+	eng.handleEvent(Event{Type: EventScrolled})
+	eng.handleEvent(Event{Type: EventEsc})
+	eng.handleEvent(Event{Type: EventEsc})
+
+	assert.Len(t, 2, got, "one call per change")
+	assert.Equal(t, ProgressAccept, got[0].Action, "shown")
+	assert.Equal(t, ProgressNone, got[1].Action, "rejected")
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"cursortab/metrics"
+	"cursortab/quality"
+	"cursortab/types"
+)
+
+// pendingQuality is the quality record of the request in flight, or of the
+// suggestion it produced while that is still shown.
+type pendingQuality struct {
+	record    *quality.Record
+	responded bool
+}
+
+// SetQualityLog enables the quality log.
+func (e *Engine) SetQualityLog(log *quality.Log) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.qualityLog = log
+}
+
+// qualityRequestSent starts the quality record for req. A record still
+// pending is finished first: as cancelled if it never got a response,
+// otherwise as ignored.
+func (e *Engine) qualityRequestSent(req *types.CompletionRequest) {
+	if e.qualityLog == nil {
+		return
+	}
+	if e.quality != nil {
+		if e.quality.responded {
+			e.finishQuality(quality.OutcomeIgnored)
+		} else {
+			e.finishQuality(quality.OutcomeCancelled)
+		}
+	}
+	e.quality = &pendingQuality{record: quality.NewRecord(req, e.providerName(), e.clock.Now())}
+}
+
+// qualityResponse records the response to the pending request. Responses with
+// nothing to show finish the record.
+func (e *Engine) qualityResponse(resp *types.CompletionResponse) {
+	if resp == nil || (len(resp.Completions) == 0 && resp.CursorTarget == nil) {
+		e.qualityResponded(0)
+		e.finishQuality(quality.OutcomeEmpty)
+		return
+	}
+	lines := 0
+	for _, c := range resp.Completions {
+		lines += len(c.Lines)
+	}
+	e.qualityResponded(lines)
+}
+
+// qualityResponded records the latency and result size of the pending request.
+func (e *Engine) qualityResponded(resultLines int) {
+	e.statsResponded()
+	if e.quality == nil || e.quality.responded {
+		return
+	}
+	rec := e.quality.record
+	rec.LatencyMs = e.clock.Now().Sub(rec.Time).Milliseconds()
+	rec.ResultLines = resultLines
+	e.quality.responded = true
+}
+
+// qualityOutcome finishes the pending record with the user's decision on the
+// suggestion it produced.
+func (e *Engine) qualityOutcome(eventType metrics.EventType) {
+	if e.quality == nil || !e.quality.responded {
+		return
+	}
+	switch eventType {
+	case metrics.EventAccepted:
+		e.finishQuality(quality.OutcomeAccepted)
+	case metrics.EventRejected:
+		e.finishQuality(quality.OutcomeRejected)
+	case metrics.EventIgnored:
+		e.finishQuality(quality.OutcomeIgnored)
+	}
+}
+
+// finishQuality queues the pending record with outcome for writing. The log
+// writes records in order, off the event loop.
+func (e *Engine) finishQuality(outcome string) {
+	if e.quality == nil {
+		return
+	}
+	rec := e.quality.record
+	rec.Outcome = outcome
+	e.quality = nil
+
+	e.qualityLog.Append(rec)
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/metrics"
+	"cursortab/quality"
+	"cursortab/types"
+)
+
+func queryQuality(t *testing.T, log *quality.Log) *quality.Report {
+	t.Helper()
+	report, err := log.Query(quality.Query{Limit: 10})
+	assert.NoError(t, err, "query")
+	return report
+}
+
+func TestQualityLog_RecordsOutcomes(t *testing.T) {
+	clock := newMockClock()
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), clock)
+	log := quality.NewLog(filepath.Join(t.TempDir(), "quality.jsonl"))
+	eng.SetProviderName(func() string { return "zeta" })
+	eng.SetQualityLog(log)
+	req := &types.CompletionRequest{FilePath: "main.go", Lines: []string{"a"}}
+
+	eng.qualityRequestSent(req)
+	clock.Advance(120 * time.Millisecond)
+	eng.qualityResponse(completionWith("b"))
+	eng.sendMetric(metrics.EventShown)
+	eng.sendMetric(metrics.EventAccepted)
+
+	eng.qualityRequestSent(req)
+	eng.qualityRequestSent(req)
+	eng.qualityResponse(&types.CompletionResponse{})
+
+	report := queryQuality(t, log)
+	assert.Equal(t, 3, report.Total, "records")
+	assert.Equal(t, quality.OutcomeAccepted, report.Records[0].Outcome, "accepted")
+	assert.Equal(t, int64(120), report.Records[0].LatencyMs, "latency")
+	assert.Equal(t, 1, report.Records[0].ResultLines, "result lines")
+	assert.Equal(t, "zeta", report.Records[0].Provider, "provider")
+	assert.Equal(t, quality.OutcomeCancelled, report.Records[1].Outcome, "replaced before response")
+	assert.Equal(t, quality.OutcomeEmpty, report.Records[2].Outcome, "empty response")
+}
+
+func TestQualityLog_ShownThenReplacedIsIgnored(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+	log := quality.NewLog(filepath.Join(t.TempDir(), "quality.jsonl"))
+	eng.SetQualityLog(log)
+	req := &types.CompletionRequest{FilePath: "main.go", Lines: []string{"a"}}
+
+	eng.qualityRequestSent(req)
+	eng.qualityResponse(completionWith("b"))
+	eng.qualityRequestSent(req)
+
+	report := queryQuality(t, log)
+	assert.Equal(t, 1, report.Total, "records")
+	assert.Equal(t, quality.OutcomeIgnored, report.Records[0].Outcome, "ignored")
+}
+
+func TestQualityLog_DisabledByDefault(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+
+	eng.qualityRequestSent(&types.CompletionRequest{})
+
+	assert.Nil(t, eng.quality, "no pending record")
+}
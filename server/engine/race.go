@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"cursortab/logger"
+	"cursortab/metrics"
+	"cursortab/types"
+)
+
+// Compile-time checks that RaceProvider implements the required interfaces
+var _ Provider = (*RaceProvider)(nil)
+var _ metrics.Sender = (*RaceProvider)(nil)
+
+// RaceProvider sends the same request to several providers concurrently and
+// returns the first non-empty response, cancelling the others. Racing always
+// runs in batch mode, even if the underlying providers support streaming.
+type RaceProvider struct {
+	providers []Provider
+
+	mu       sync.Mutex
+	winnerID string         // Metrics ID of the last winning response
+	winner   metrics.Sender // Provider that produced winnerID (nil if it has no metrics)
+}
+
+type raceResult struct {
+	index int
+	resp  *types.CompletionResponse
+	err   error
+}
+
+// NewRaceProvider creates a provider racing the given providers.
+// The first provider is the primary: its context limits are used for gathering.
+func NewRaceProvider(providers ...Provider) *RaceProvider {
+	return &RaceProvider{providers: providers}
+}
+
+// GetContextLimits implements Provider
+func (r *RaceProvider) GetContextLimits() ContextLimits {
+	return r.providers[0].GetContextLimits()
+}
+
+// GetCompletion implements Provider
+func (r *RaceProvider) GetCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
+	defer logger.Trace("RaceProvider.GetCompletion")()
+
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan raceResult, len(r.providers))
+	for i, p := range r.providers {
+		go func() {
+			resp, err := p.GetCompletion(raceCtx, req)
+			results <- raceResult{index: i, resp: resp, err: err}
+		}()
+	}
+
+	var empty *types.CompletionResponse
+	var errs []error
+	for range r.providers {
+		res := <-results
+		switch {
+		case res.err != nil:
+			if !errors.Is(res.err, context.Canceled) {
+				logger.Debug("race: provider %d failed: %v", res.index, res.err)
+			}
+			errs = append(errs, res.err)
+		case isEmptyResponse(res.resp):
+			empty = res.resp
+		default:
+			logger.Debug("race: provider %d won", res.index)
+			r.setWinner(res.index, res.resp)
+			return res.resp, nil
+		}
+	}
+
+	if empty != nil {
+		return empty, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+// SendMetric implements metrics.Sender by forwarding events to the provider
+// that produced the completion.
+func (r *RaceProvider) SendMetric(ctx context.Context, event metrics.Event) {
+	r.mu.Lock()
+	winner, winnerID := r.winner, r.winnerID
+	r.mu.Unlock()
+
+	if winner == nil || winnerID != event.Info.ID {
+		return
+	}
+	winner.SendMetric(ctx, event)
+}
+
+func (r *RaceProvider) setWinner(index int, resp *types.CompletionResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.winner, r.winnerID = nil, ""
+	if resp.MetricsInfo == nil {
+		return
+	}
+	if sender, ok := r.providers[index].(metrics.Sender); ok {
+		r.winner, r.winnerID = sender, resp.MetricsInfo.ID
+	}
+}
+
+// isEmptyResponse reports whether a response carries neither completions nor a cursor target.
+func isEmptyResponse(resp *types.CompletionResponse) bool {
+	return resp == nil || (len(resp.Completions) == 0 && resp.CursorTarget == nil)
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+// delayedProvider responds after a delay unless its context is cancelled first.
+type delayedProvider struct {
+	delay     time.Duration
+	resp      *types.CompletionResponse
+	err       error
+	cancelled chan struct{}
+}
+
+func newDelayedProvider(delay time.Duration, resp *types.CompletionResponse, err error) *delayedProvider {
+	return &delayedProvider{delay: delay, resp: resp, err: err, cancelled: make(chan struct{}, 1)}
+}
+
+func (p *delayedProvider) GetContextLimits() ContextLimits {
+	return DefaultContextLimits()
+}
+
+func (p *delayedProvider) GetCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
+	select {
+	case <-time.After(p.delay):
+		return p.resp, p.err
+	case <-ctx.Done():
+		p.cancelled <- struct{}{}
+		return nil, ctx.Err()
+	}
+}
+
+func completionWith(line string) *types.CompletionResponse {
+	return &types.CompletionResponse{
+		Completions: []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{line}}},
+	}
+}
+
+func TestRaceProvider_FastestWinsAndCancelsOthers(t *testing.T) {
+	slow := newDelayedProvider(time.Second, completionWith("slow"), nil)
+	fast := newDelayedProvider(time.Millisecond, completionWith("fast"), nil)
+
+	resp, err := NewRaceProvider(slow, fast).GetCompletion(context.Background(), &types.CompletionRequest{})
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Equal(t, "fast", resp.Completions[0].Lines[0], "winning completion")
+
+	select {
+	case <-slow.cancelled:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("slow provider was not cancelled")
+	}
+}
+
+func TestRaceProvider_SkipsEmptyAndFailedResponses(t *testing.T) {
+	empty := newDelayedProvider(time.Millisecond, &types.CompletionResponse{}, nil)
+	failed := newDelayedProvider(time.Millisecond, nil, errors.New("boom"))
+	slow := newDelayedProvider(20*time.Millisecond, completionWith("slow"), nil)
+
+	resp, err := NewRaceProvider(empty, failed, slow).GetCompletion(context.Background(), &types.CompletionRequest{})
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Equal(t, "slow", resp.Completions[0].Lines[0], "first non-empty completion")
+}
+
+func TestRaceProvider_AllEmptyOrFailed(t *testing.T) {
+	empty := newDelayedProvider(time.Millisecond, &types.CompletionResponse{}, nil)
+	failed := newDelayedProvider(time.Millisecond, nil, errors.New("boom"))
+
+	resp, err := NewRaceProvider(empty, failed).GetCompletion(context.Background(), &types.CompletionRequest{})
+	assert.NoError(t, err, "empty response preferred over error")
+	assert.Len(t, 0, resp.Completions, "completions")
+
+	_, err = NewRaceProvider(failed).GetCompletion(context.Background(), &types.CompletionRequest{})
+	assert.Error(t, err, "all providers failed")
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"cursortab/logger"
+	"cursortab/metrics"
+	"cursortab/types"
+)
+
+// rateWindow is the sliding window the request rate limit applies to
+const rateWindow = time.Minute
+
+// rateLimiter caps the provider requests sent per minute and in flight at
+// once. Completion requests over the limit are queued, a newer one replacing
+// the queued one, and sent when a slot frees up; prefetches are skipped.
+type rateLimiter struct {
+	mu                sync.Mutex
+	perMinute         int
+	maxConcurrent     int
+	sent              []time.Time
+	inFlight          int
+	onRelease         func() // Called without the lock when a request leaves flight
+	queued            int
+	coalesced         int
+	skippedPrefetches int
+}
+
+// admit reports whether a request may be sent at now, and counts it as sent
+// when it may. Otherwise wait is how long until the rate allows one more, or
+// 0 when it is the concurrency limit that is reached.
+func (l *rateLimiter) admit(now time.Time) (ok bool, wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxConcurrent > 0 && l.inFlight >= l.maxConcurrent {
+		return false, 0
+	}
+	if l.perMinute > 0 {
+		cutoff := now.Add(-rateWindow)
+		l.sent = slices.DeleteFunc(l.sent, func(t time.Time) bool { return !t.After(cutoff) })
+		if len(l.sent) >= l.perMinute {
+			return false, l.sent[0].Sub(cutoff)
+		}
+	}
+	l.sent = append(l.sent, now)
+	return true, 0
+}
+
+// track counts the request of ctx in flight until ctx ends or the returned
+// cancel func, which also cancels ctx, is called.
+func (l *rateLimiter) track(ctx context.Context, cancel context.CancelFunc) context.CancelFunc {
+	l.mu.Lock()
+	l.inFlight++
+	l.mu.Unlock()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.inFlight--
+			onRelease := l.onRelease
+			l.mu.Unlock()
+			if onRelease != nil {
+				onRelease()
+			}
+		})
+	}
+	context.AfterFunc(ctx, release)
+	return func() {
+		cancel()
+		release()
+	}
+}
+
+// setLimits replaces the limits, keeping the requests already counted.
+// onRelease is only kept while the concurrency is limited.
+func (l *rateLimiter) setLimits(perMinute, maxConcurrent int, onRelease func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.perMinute = perMinute
+	l.maxConcurrent = maxConcurrent
+	l.onRelease = nil
+	if maxConcurrent > 0 {
+		l.onRelease = onRelease
+	}
+}
+
+func (l *rateLimiter) noteQueued(replaced bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queued++
+	if replaced {
+		l.coalesced++
+	}
+}
+
+func (l *rateLimiter) noteSkippedPrefetch() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.skippedPrefetches++
+}
+
+func (l *rateLimiter) status() metrics.RateLimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return metrics.RateLimitStatus{
+		PerMinute:         l.perMinute,
+		MaxConcurrent:     l.maxConcurrent,
+		InFlight:          l.inFlight,
+		Queued:            l.queued,
+		Coalesced:         l.coalesced,
+		SkippedPrefetches: l.skippedPrefetches,
+	}
+}
+
+// requestContext returns the context of a provider request, counted in flight
+// until it ends.
+func (e *Engine) requestContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(e.mainCtx, e.config.CompletionTimeout)
+	return ctx, e.limiter.track(ctx, cancel)
+}
+
+// queuedRequest is a completion request waiting for the rate limiter.
+type queuedRequest struct {
+	req *types.CompletionRequest
+	key uint64 // Cache key of req
+}
+
+// queueRequest holds req back until the rate limiter has a slot for it,
+// replacing a request queued before. Cancelling the current request drops it.
+func (e *Engine) queueRequest(req *types.CompletionRequest, key uint64, wait time.Duration) {
+	e.limiter.noteQueued(e.queued != nil)
+	logger.Debug("rate limit: queueing request")
+	e.queued = &queuedRequest{req: req, key: key}
+	e.state = statePendingCompletion
+	e.currentCancel = e.dropQueuedRequest
+	e.startQueueTimer(wait)
+}
+
+// startQueueTimer retries the queued request after wait. Without a wait, the
+// request is retried when a request in flight ends.
+func (e *Engine) startQueueTimer(wait time.Duration) {
+	if e.queueTimer != nil {
+		e.queueTimer.Stop()
+		e.queueTimer = nil
+	}
+	if wait > 0 {
+		e.queueTimer = e.clock.AfterFunc(wait, func() {
+			e.post(Event{Type: EventRequestSlotFree})
+		})
+	}
+}
+
+// dropQueuedRequest forgets the queued request.
+func (e *Engine) dropQueuedRequest() {
+	e.queued = nil
+	e.startQueueTimer(0)
+}
+
+// sendQueuedRequest sends the queued request, if any, once the rate limiter
+// has a slot for it.
+func (e *Engine) sendQueuedRequest() {
+	q := e.queued
+	if q == nil {
+		return
+	}
+	if ok, wait := e.limiter.admit(e.clock.Now()); !ok {
+		e.startQueueTimer(wait)
+		return
+	}
+	e.dropQueuedRequest()
+	e.currentCancel = nil
+	e.dispatchRequest(q.req, q.key)
+}
@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestRateLimiter_PerMinute(t *testing.T) {
+	now := time.Now()
+	l := &rateLimiter{perMinute: 2}
+
+	ok, _ := l.admit(now)
+	assert.True(t, ok, "first request")
+	ok, _ = l.admit(now.Add(10 * time.Second))
+	assert.True(t, ok, "second request")
+
+	ok, wait := l.admit(now.Add(20 * time.Second))
+	assert.False(t, ok, "third request over the limit")
+	assert.Equal(t, 40*time.Second, wait, "wait until the first request leaves the window")
+
+	ok, _ = l.admit(now.Add(rateWindow + time.Second))
+	assert.True(t, ok, "allowed once the window passes")
+}
+
+func TestRateLimiter_Concurrency(t *testing.T) {
+	released := 0
+	l := &rateLimiter{maxConcurrent: 1, onRelease: func() { released++ }}
+
+	ok, _ := l.admit(time.Now())
+	assert.True(t, ok, "first request")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel = l.track(ctx, cancel)
+	assert.Equal(t, 1, l.status().InFlight, "in flight")
+
+	ok, wait := l.admit(time.Now())
+	assert.False(t, ok, "second request while one is in flight")
+	assert.Equal(t, time.Duration(0), wait, "no wait for the concurrency limit")
+
+	cancel()
+	cancel()
+	assert.Equal(t, 0, l.status().InFlight, "released once")
+	assert.Equal(t, 1, released, "release reported once")
+
+	ok, _ = l.admit(time.Now())
+	assert.True(t, ok, "allowed once the request ends")
+}
+
+func TestRateLimiter_Unlimited(t *testing.T) {
+	l := &rateLimiter{}
+	for range 100 {
+		ok, _ := l.admit(time.Now())
+		assert.True(t, ok, "zero limits never block")
+	}
+}
+
+func TestSendCompletionRequest_QueuesAndCoalesces(t *testing.T) {
+	buf := newMockBuffer()
+	clock := newMockClock()
+	prov := newMockProvider()
+	eng, cancel := createTestEngineWithContext(buf, prov, clock)
+	defer cancel()
+	eng.limiter = &rateLimiter{perMinute: 1}
+	eng.limiter.admit(clock.Now())
+
+	first := &types.CompletionRequest{FilePath: "a.go", Lines: []string{"a"}}
+	second := &types.CompletionRequest{FilePath: "a.go", Lines: []string{"ab"}}
+	eng.sendCompletionRequest(first)
+	eng.sendCompletionRequest(second)
+
+	assert.Equal(t, statePendingCompletion, eng.state, "pending while queued")
+	assert.NotNil(t, eng.queued, "request queued")
+	assert.Equal(t, second, eng.queued.req, "newer request replaces the queued one")
+	status := eng.Stats().RateLimit
+	assert.Equal(t, 2, status.Queued, "queued count")
+	assert.Equal(t, 1, status.Coalesced, "coalesced count")
+
+	clock.Advance(rateWindow)
+	eng.handleEvent(Event{Type: EventRequestSlotFree})
+
+	assert.Nil(t, eng.queued, "queue emptied")
+	assert.NotNil(t, eng.currentCancel, "request in flight")
+}
+
+func TestSendCompletionRequest_WaitsForConcurrencySlot(t *testing.T) {
+	buf := newMockBuffer()
+	clock := newMockClock()
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), clock)
+	defer cancel()
+	eng.limiter = &rateLimiter{maxConcurrent: 1}
+	eng.limiter.admit(clock.Now())
+	ctx, inFlightCancel := context.WithCancel(context.Background())
+	inFlightCancel = eng.limiter.track(ctx, inFlightCancel)
+
+	eng.sendCompletionRequest(&types.CompletionRequest{FilePath: "a.go", Lines: []string{"a"}})
+	eng.handleEvent(Event{Type: EventRequestSlotFree})
+	assert.NotNil(t, eng.queued, "still queued while the slot is taken")
+
+	inFlightCancel()
+	eng.handleEvent(Event{Type: EventRequestSlotFree})
+	assert.Nil(t, eng.queued, "sent once the slot frees up")
+}
+
+func TestQueuedRequest_DroppedOnEsc(t *testing.T) {
+	buf := newMockBuffer()
+	clock := newMockClock()
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), clock)
+	defer cancel()
+	eng.limiter = &rateLimiter{perMinute: 1}
+	eng.limiter.admit(clock.Now())
+
+	eng.sendCompletionRequest(&types.CompletionRequest{FilePath: "a.go", Lines: []string{"a"}})
+	assert.NotNil(t, eng.queued, "request queued")
+
+	eng.handleEvent(Event{Type: EventEsc})
+
+	assert.Nil(t, eng.queued, "queued request dropped")
+	assert.Nil(t, eng.queueTimer, "retry timer stopped")
+}
+
+func TestRequestPrefetch_SkippedOverRateLimit(t *testing.T) {
+	buf := newMockBuffer()
+	clock := newMockClock()
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), clock)
+	defer cancel()
+	eng.limiter = &rateLimiter{perMinute: 1}
+	eng.limiter.admit(clock.Now())
+
+	assert.False(t, eng.requestPrefetch(types.CompletionSourceTyping, 1, 0), "prefetch skipped")
+	assert.Equal(t, 1, eng.Stats().RateLimit.SkippedPrefetches, "skipped count")
+}
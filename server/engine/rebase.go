@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"slices"
+
+	"cursortab/logger"
+	"cursortab/text"
+	"cursortab/types"
+)
+
+// editSpan is an edit to the current buffer: lines [first, last) (0-indexed)
+// were replaced by count lines.
+type editSpan struct {
+	first, last, count int
+}
+
+func (s editSpan) delta() int {
+	return s.count - (s.last - s.first)
+}
+
+// place reports where the edit is relative to the 1-indexed inclusive range
+// [start, end]: above it (the range moves by the delta), below it (the range
+// stays) or overlapping it.
+func (s editSpan) place(start, end int) (above, below bool) {
+	end = max(end, start)
+	return s.last < start, s.first >= end
+}
+
+// rebasePending shifts the shown completion, the remaining stages and the
+// cursor target past an edit to the current buffer that touches none of them,
+// so that edits elsewhere in the file do not discard them. An edit overlapping
+// any of them leaves them in place to be matched against the typed text.
+func (e *Engine) rebasePending(change BufferLines) {
+	e.editedOutside = false
+	if e.state != stateHasCompletion || len(e.completions) == 0 {
+		return
+	}
+	span := editSpan{first: change.FirstLine, last: change.LastLine, count: len(change.Lines)}
+
+	var stages []*text.Stage
+	if e.stagedCompletion != nil {
+		for i := e.stagedCompletion.CurrentIdx; i < len(e.stagedCompletion.Stages); i++ {
+			if stage := e.getStage(i); stage != nil {
+				stages = append(stages, stage)
+			}
+		}
+	}
+
+	// Check every range before moving any, so that nothing is half shifted
+	for _, c := range e.completions {
+		if above, below := span.place(c.StartLine, c.EndLineInc); !above && !below {
+			return
+		}
+	}
+	for _, stage := range stages {
+		if above, below := span.place(stage.BufferStart, stage.BufferEnd); !above && !below {
+			return
+		}
+	}
+
+	delta := span.delta()
+	e.editedOutside = true
+	if delta == 0 {
+		return
+	}
+	logger.Debug("rebase: shifting pending completion by %d lines past edit at %d-%d",
+		delta, span.first, span.last)
+
+	for _, c := range e.completions {
+		if above, _ := span.place(c.StartLine, c.EndLineInc); above {
+			c.StartLine += delta
+			c.EndLineInc += delta
+		}
+	}
+
+	// Stages share groups and targets with the shown completion, so each is
+	// collected once and shifted by position
+	groups := slices.Clone(e.currentGroups)
+	targets := []*types.CursorPredictionTarget{e.cursorTarget}
+	for _, stage := range stages {
+		if above, _ := span.place(stage.BufferStart, stage.BufferEnd); above {
+			stage.BufferStart += delta
+			stage.BufferEnd += delta
+		}
+		for _, g := range stage.Groups {
+			if !slices.Contains(groups, g) {
+				groups = append(groups, g)
+			}
+		}
+		if !slices.Contains(targets, stage.CursorTarget) {
+			targets = append(targets, stage.CursorTarget)
+		}
+	}
+	for _, g := range groups {
+		if g.BufferLine > span.last {
+			g.BufferLine += delta
+		}
+	}
+	for _, t := range targets {
+		if t != nil && int(t.LineNumber) > span.last {
+			t.LineNumber += int32(delta)
+		}
+	}
+}
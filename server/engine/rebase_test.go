@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/text"
+	"cursortab/types"
+)
+
+// rebaseEngine shows a completion of lines 4-5 with a cursor target and a
+// second stage at lines 8-8.
+func rebaseEngine(buf *mockBuffer, prov *mockProvider) *Engine {
+	buf.lines = []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	eng := createTestEngine(buf, prov, newMockClock())
+	eng.state = stateHasCompletion
+	target := &types.CursorPredictionTarget{LineNumber: 8, ShouldRetrigger: true}
+	eng.completions = []*types.Completion{{StartLine: 4, EndLineInc: 5, Lines: []string{"D", "E"}}}
+	eng.completionOriginalLines = []string{"d", "e"}
+	eng.currentGroups = []*text.Group{{Type: "modification", StartLine: 1, EndLine: 2, BufferLine: 4}}
+	eng.cursorTarget = target
+	eng.stagedCompletion = &text.StagedCompletion{
+		CurrentIdx: 0,
+		Stages: []*text.Stage{
+			{BufferStart: 4, BufferEnd: 5, Lines: []string{"D", "E"}, Groups: eng.currentGroups, CursorTarget: target},
+			{BufferStart: 8, BufferEnd: 8, Lines: []string{"H"}, Groups: []*text.Group{{Type: "modification", StartLine: 1, EndLine: 1, BufferLine: 8}}},
+		},
+	}
+	return eng
+}
+
+func TestRebase_EditAboveShiftsCompletion(t *testing.T) {
+	buf := newMockBuffer()
+	prov := newMockProvider()
+	eng := rebaseEngine(buf, prov)
+
+	// Two lines inserted after line 1
+	buf.lines = []string{"a", "x", "y", "b", "c", "d", "e", "f", "g", "h"}
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "test.go", FirstLine: 1, LastLine: 1, Lines: []string{"x", "y"}}})
+	eng.handleEvent(Event{Type: EventTextChanged})
+
+	assert.Equal(t, stateHasCompletion, eng.state, "completion kept")
+	assert.Equal(t, 0, prov.completionCalls, "no new request")
+	assert.Equal(t, 6, eng.completions[0].StartLine, "start shifted")
+	assert.Equal(t, 7, eng.completions[0].EndLineInc, "end shifted")
+	assert.Equal(t, 1, buf.prepareCompletionCalls, "completion re-rendered")
+	assert.Equal(t, int32(10), eng.cursorTarget.LineNumber, "cursor target shifted")
+
+	next := eng.stagedCompletion.Stages[1]
+	assert.Equal(t, 10, next.BufferStart, "next stage start shifted")
+	assert.Equal(t, 10, next.BufferEnd, "next stage end shifted")
+	assert.Equal(t, 10, next.Groups[0].BufferLine, "next stage group shifted")
+}
+
+func TestRebase_EditBetweenStages(t *testing.T) {
+	buf := newMockBuffer()
+	eng := rebaseEngine(buf, newMockProvider())
+
+	// Line 7 deleted
+	buf.lines = []string{"a", "b", "c", "d", "e", "f", "h"}
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "test.go", FirstLine: 6, LastLine: 7}})
+	eng.handleEvent(Event{Type: EventTextChanged})
+
+	assert.Equal(t, stateHasCompletion, eng.state, "completion kept")
+	assert.Equal(t, 4, eng.completions[0].StartLine, "shown completion stays")
+	assert.Equal(t, 4, eng.currentGroups[0].BufferLine, "shown group stays")
+	assert.Equal(t, 7, eng.stagedCompletion.Stages[1].BufferStart, "next stage shifted")
+	assert.Equal(t, int32(7), eng.cursorTarget.LineNumber, "cursor target shifted")
+}
+
+func TestRebase_EditInsideRejects(t *testing.T) {
+	buf := newMockBuffer()
+	prov := newMockProvider()
+	eng := rebaseEngine(buf, prov)
+
+	buf.lines = []string{"a", "b", "c", "dx", "e", "f", "g", "h"}
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "test.go", FirstLine: 3, LastLine: 4, Lines: []string{"dx"}}})
+	assert.False(t, eng.editedOutside, "overlapping edit")
+	assert.Equal(t, 4, eng.completions[0].StartLine, "not shifted")
+
+	eng.handleEvent(Event{Type: EventTextChanged})
+	assert.Equal(t, stateIdle, eng.state, "mismatched typing rejects")
+}
+
+func TestRebase_OtherBufferIgnored(t *testing.T) {
+	buf := newMockBuffer()
+	eng := rebaseEngine(buf, newMockProvider())
+
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "util.go", FirstLine: 0, LastLine: 0, Lines: []string{"x"}}})
+
+	assert.False(t, eng.editedOutside, "not the current buffer")
+	assert.Equal(t, 4, eng.completions[0].StartLine, "not shifted")
+}
+
+func TestRebase_ChangedRegionRejects(t *testing.T) {
+	buf := newMockBuffer()
+	eng := rebaseEngine(buf, newMockProvider())
+
+	// The edit event missed a change to the completion's lines
+	buf.lines = []string{"a", "x", "b", "c", "dd", "e", "f", "g", "h"}
+	eng.handleEvent(Event{Type: EventBufferLines, Data: BufferLines{Path: "test.go", FirstLine: 1, LastLine: 1, Lines: []string{"x"}}})
+	eng.handleEvent(Event{Type: EventTextChanged})
+
+	assert.Equal(t, stateIdle, eng.state, "rejected")
+}
@@ -0,0 +1,219 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cursortab/logger"
+	"cursortab/redact"
+	"cursortab/types"
+)
+
+// SetRedactor enables secret redaction for outgoing requests (nil disables it).
+func (e *Engine) SetRedactor(r *redact.Redactor) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.redactor = r
+}
+
+// redactRequest returns the request to hand to the provider: a copy of req
+// with secrets in the buffer, diff history, recent snapshots, retrieved and
+// injected chunks, diagnostics, treesitter, LSP and git context replaced by
+// placeholders, and its cursor
+// column moved to match the redacted cursor line. req itself is returned when
+// nothing was found.
+func (e *Engine) redactRequest(req *types.CompletionRequest) (*types.CompletionRequest, *redact.Secrets) {
+	if e.redactor == nil {
+		return req, nil
+	}
+
+	secrets := &redact.Secrets{}
+	var found []string
+	counted := secrets.Count()
+	count := func(source string) {
+		if n := secrets.Count() - counted; n > 0 {
+			found = append(found, fmt.Sprintf("%s %d", source, n))
+		}
+		counted = secrets.Count()
+	}
+
+	sent := *req
+	sent.Lines = e.redactor.Lines(req.Lines, secrets)
+	sent.PreviousLines = e.redactor.Lines(req.PreviousLines, secrets)
+	if row := req.CursorRow - 1; row >= 0 && row < len(req.Lines) && row < len(sent.Lines) {
+		sent.CursorCol = secrets.Column(req.Lines[row], sent.Lines[row], req.CursorCol)
+	}
+	count("buffer")
+
+	if len(req.FileDiffHistories) > 0 {
+		sent.FileDiffHistories = make([]*types.FileDiffHistory, len(req.FileDiffHistories))
+		for i, h := range req.FileDiffHistories {
+			entries := make([]*types.DiffEntry, len(h.DiffHistory))
+			for j, d := range h.DiffHistory {
+				entries[j] = &types.DiffEntry{
+					Original: e.redactor.Text(d.Original, secrets),
+					Updated:  e.redactor.Text(d.Updated, secrets),
+					UndoSeq:  d.UndoSeq,
+				}
+			}
+			sent.FileDiffHistories[i] = &types.FileDiffHistory{FileName: h.FileName, DiffHistory: entries}
+		}
+	}
+	count("diff history")
+
+	if len(req.RecentBufferSnapshots) > 0 {
+		sent.RecentBufferSnapshots = make([]*types.RecentBufferSnapshot, len(req.RecentBufferSnapshots))
+		for i, s := range req.RecentBufferSnapshots {
+			snapshot := *s
+			snapshot.Lines = e.redactor.Lines(s.Lines, secrets)
+			sent.RecentBufferSnapshots[i] = &snapshot
+		}
+	}
+	count("snapshots")
+
+	if len(req.RetrievalChunks) > 0 {
+		sent.RetrievalChunks = make([]*types.RetrievalChunk, len(req.RetrievalChunks))
+		for i, c := range req.RetrievalChunks {
+			chunk := *c
+			chunk.Lines = e.redactor.Lines(c.Lines, secrets)
+			sent.RetrievalChunks[i] = &chunk
+		}
+	}
+	count("chunks")
+
+	if ac := req.AdditionalContext; ac != nil {
+		additional := *ac
+		additional.Diagnostics = e.redactDiagnostics(ac.Diagnostics, secrets)
+		count("diagnostics")
+		additional.Treesitter = e.redactTreesitter(ac.Treesitter, secrets)
+		count("treesitter")
+		additional.LSP = e.redactLSP(ac.LSP, secrets)
+		count("lsp")
+		additional.GitHistory = e.redactGitHistory(ac.GitHistory, secrets)
+		count("git history")
+		if ac.GitDiff != nil {
+			additional.GitDiff = &types.GitDiffContext{Diff: e.redactor.Text(ac.GitDiff.Diff, secrets)}
+			count("git diff")
+		}
+		sent.AdditionalContext = &additional
+	}
+
+	if secrets.Count() == 0 {
+		return req, nil
+	}
+	logger.Debug("redacted %d secrets (%s)", secrets.Count(), strings.Join(found, ", "))
+	return &sent, secrets
+}
+
+// redactDiagnostics returns a copy of diags with secrets in the messages and
+// the file contents replaced.
+func (e *Engine) redactDiagnostics(diags *types.LinterErrors, secrets *redact.Secrets) *types.LinterErrors {
+	if diags == nil {
+		return nil
+	}
+	redacted := *diags
+	redacted.FileContents = e.redactor.Text(diags.FileContents, secrets)
+	redacted.Errors = make([]*types.LinterError, len(diags.Errors))
+	for i, d := range diags.Errors {
+		diag := *d
+		diag.Message = e.redactor.Text(d.Message, secrets)
+		redacted.Errors[i] = &diag
+	}
+	return &redacted
+}
+
+// redactLSP returns a copy of lsp with secrets in the hover texts and
+// definitions replaced.
+func (e *Engine) redactLSP(lsp *types.LSPContext, secrets *redact.Secrets) *types.LSPContext {
+	if lsp == nil {
+		return nil
+	}
+	redacted := &types.LSPContext{Symbols: make([]*types.LSPSymbol, len(lsp.Symbols))}
+	for i, sym := range lsp.Symbols {
+		symbol := *sym
+		symbol.Hover = e.redactor.Text(sym.Hover, secrets)
+		symbol.Definition = e.redactor.Lines(sym.Definition, secrets)
+		redacted.Symbols[i] = &symbol
+	}
+	return redacted
+}
+
+// redactGitHistory returns a copy of history with secrets in the commit
+// subjects replaced.
+func (e *Engine) redactGitHistory(history *types.GitHistoryContext, secrets *redact.Secrets) *types.GitHistoryContext {
+	if history == nil {
+		return nil
+	}
+	redacted := &types.GitHistoryContext{
+		Commits: make([]string, len(history.Commits)),
+		Blame:   make([]*types.BlameEntry, len(history.Blame)),
+	}
+	for i, c := range history.Commits {
+		redacted.Commits[i] = e.redactor.Text(c, secrets)
+	}
+	for i, b := range history.Blame {
+		entry := *b
+		entry.Summary = e.redactor.Text(b.Summary, secrets)
+		redacted.Blame[i] = &entry
+	}
+	return redacted
+}
+
+// redactTreesitter returns a copy of ts with secrets in the signatures and
+// imports replaced.
+func (e *Engine) redactTreesitter(ts *types.TreesitterContext, secrets *redact.Secrets) *types.TreesitterContext {
+	if ts == nil {
+		return nil
+	}
+	redacted := *ts
+	redacted.EnclosingSignature = e.redactor.Text(ts.EnclosingSignature, secrets)
+	redacted.Imports = e.redactor.Lines(ts.Imports, secrets)
+	redacted.Siblings = make([]*types.TreesitterSymbol, len(ts.Siblings))
+	for i, sym := range ts.Siblings {
+		symbol := *sym
+		symbol.Signature = e.redactor.Text(sym.Signature, secrets)
+		redacted.Siblings[i] = &symbol
+	}
+	return &redacted
+}
+
+// revealResponse puts the redacted secrets back into the completions of resp.
+func revealResponse(resp *types.CompletionResponse, secrets *redact.Secrets) {
+	if resp == nil || secrets == nil {
+		return
+	}
+	for _, c := range resp.Completions {
+		c.Lines = secrets.RevealLines(c.Lines)
+	}
+}
+
+// revealingStream reveals the secrets in each line of a provider stream, so
+// streamed stages compare against the real buffer content.
+type revealingStream struct {
+	LineStream
+	lines chan string
+}
+
+func revealStream(ctx context.Context, stream LineStream, secrets *redact.Secrets) LineStream {
+	if secrets == nil {
+		return stream
+	}
+	rs := &revealingStream{LineStream: stream, lines: make(chan string)}
+	go func() {
+		defer close(rs.lines)
+		for line := range stream.LinesChan() {
+			select {
+			case rs.lines <- secrets.Reveal(line):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return rs
+}
+
+// LinesChan implements LineStream
+func (s *revealingStream) LinesChan() <-chan string {
+	return s.lines
+}
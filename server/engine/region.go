@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"hash/fnv"
+
+	"cursortab/logger"
+	"cursortab/types"
+)
+
+// regionHash identifies the buffer lines a completion was computed against: the
+// lines it replaces plus one line of context on each side, so that pure
+// insertions are anchored too.
+type regionHash struct {
+	start, end int // 0-indexed half-open range, context included
+	hash       uint64
+}
+
+func hashLines(lines []string) uint64 {
+	h := fnv.New64a()
+	for _, line := range lines {
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum64()
+}
+
+// newRegionHash hashes the region of lines that comp replaces.
+func newRegionHash(lines []string, comp *types.Completion) regionHash {
+	start := min(max(comp.StartLine-2, 0), len(lines))
+	end := min(max(comp.EndLineInc+1, start), len(lines))
+	return regionHash{start: start, end: end, hash: hashLines(lines[start:end])}
+}
+
+// locate returns how many lines the region moved in lines: 0 when it is still
+// in place, otherwise the offset of the nearest identical region. ok is false
+// when the region no longer exists, because its lines were edited.
+func (r regionHash) locate(lines []string) (offset int, ok bool) {
+	size := r.end - r.start
+	matches := func(start int) bool {
+		return start >= 0 && start+size <= len(lines) && hashLines(lines[start:start+size]) == r.hash
+	}
+	if matches(r.start) {
+		return 0, true
+	}
+	for d := 1; d <= len(lines); d++ {
+		if matches(r.start - d) {
+			return -d, true
+		}
+		if matches(r.start + d) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// hashRegions hashes the region of base that each completion replaces.
+func hashRegions(base []string, comps []*types.Completion) []regionHash {
+	if base == nil {
+		return nil
+	}
+	regions := make([]regionHash, len(comps))
+	for i, comp := range comps {
+		regions[i] = newRegionHash(base, comp)
+	}
+	return regions
+}
+
+// rebaseCompletions checks comps against lines using the regions they were
+// computed against. Completions whose region moved, because lines were added or
+// removed above it, are returned shifted to follow it, along with their moved
+// regions. It returns false when a region was edited: the completions would
+// overlap or duplicate what is there now. Without regions the completions are
+// returned as they are.
+func rebaseCompletions(comps []*types.Completion, regions []regionHash, lines []string) ([]*types.Completion, []regionHash, bool) {
+	if len(regions) != len(comps) {
+		return comps, regions, true
+	}
+	rebased := make([]*types.Completion, len(comps))
+	moved := make([]regionHash, len(regions))
+	for i, comp := range comps {
+		offset, ok := regions[i].locate(lines)
+		if !ok {
+			return nil, nil, false
+		}
+		rebased[i], moved[i] = comp, regions[i]
+		if offset != 0 {
+			shifted := *comp
+			shifted.StartLine += offset
+			shifted.EndLineInc += offset
+			rebased[i] = &shifted
+			moved[i].start += offset
+			moved[i].end += offset
+		}
+	}
+	return rebased, moved, true
+}
+
+// setPrefetched stores a prefetched response along with the regions of base,
+// the buffer content it was computed against.
+func (e *Engine) setPrefetched(resp *types.CompletionResponse, base []string) {
+	e.prefetchedCompletions = resp.Completions
+	e.prefetchedCursorTarget = resp.CursorTarget
+	e.prefetchRegions = hashRegions(base, resp.Completions)
+}
+
+// checkPrefetched re-bases the prefetched completions on the current buffer,
+// or drops them when the lines they replace changed since they were computed.
+// Returns false when they were dropped.
+func (e *Engine) checkPrefetched() bool {
+	comps, regions, ok := rebaseCompletions(e.prefetchedCompletions, e.prefetchRegions, e.buffer.Lines())
+	if !ok {
+		logger.Debug("prefetch: buffer changed under the prefetched completion, dropping it")
+		e.prefetchedCompletions = nil
+		e.prefetchedCursorTarget = nil
+		e.prefetchRegions = nil
+		e.prefetchState = prefetchNone
+		return false
+	}
+	e.prefetchedCompletions, e.prefetchRegions = comps, regions
+	return true
+}
@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cursortab/ignore"
+	"cursortab/logger"
+	"cursortab/text"
+	"cursortab/types"
+)
+
+const (
+	renameSearchTimeout = 2 * time.Second // Limit on the ripgrep search for other occurrences
+	renameMaxFiles      = 20              // Other files a rename is propagated to
+)
+
+// recordRename remembers the identifier renamed by the stage just accepted.
+// Stages of a rename proposal are not recorded, so accepting one does not
+// propose again.
+func (e *Engine) recordRename() {
+	if !e.config.RenamePropagation.Enabled || e.propagatingRename || e.stagedCompletion == nil {
+		return
+	}
+	stage := e.getStage(e.stagedCompletion.CurrentIdx)
+	if stage == nil {
+		return
+	}
+	if rename, ok := text.DetectRename(stage.Changes); ok {
+		e.acceptedRename = &rename
+	}
+}
+
+// proposeRename shows the renaming of the other occurrences of the identifier
+// renamed by the completion just accepted as a new staged completion, and,
+// if enabled, starts searching the workspace for files to rename it in.
+// Returns false when the buffer has no other occurrence.
+func (e *Engine) proposeRename() bool {
+	rename := e.acceptedRename
+	e.acceptedRename = nil
+	e.propagatingRename = false
+	if rename == nil {
+		return false
+	}
+	if e.config.RenamePropagation.Workspace {
+		e.searchRenames(rename)
+	}
+
+	lines := e.buffer.Lines()
+	renamed, ok := rename.Apply(lines)
+	if !ok {
+		return false
+	}
+	e.cursorTarget = nil
+	e.propagatingRename = true
+	if !e.processCompletion(&types.Completion{StartLine: 1, EndLineInc: len(lines), Lines: renamed}) {
+		e.propagatingRename = false
+		return false
+	}
+	logger.Debug("rename: proposing %s -> %s", rename.Old, rename.New)
+	return true
+}
+
+// renameFile is the renaming of an identifier in a file other than the buffer.
+type renameFile struct {
+	completion *types.Completion
+	lines      []string // Content of the file on disk
+}
+
+// renameResult is the outcome of a workspace search started by searchRenames.
+type renameResult struct {
+	rename *text.Rename
+	path   string // Buffer the rename was accepted in
+	files  []renameFile
+}
+
+// searchRenames looks for the other files of the workspace containing the
+// renamed identifier off the event loop. The result comes back as
+// EventRenameFilesReady.
+func (e *Engine) searchRenames(rename *text.Rename) {
+	e.renameSearch = rename
+	workspace, path, rules := e.WorkspacePath, e.buffer.Path(), e.ignore
+	go func() {
+		files := workspaceRenames(workspace, path, rules, *rename)
+		e.post(Event{Type: EventRenameFilesReady, Data: renameResult{rename: rename, path: path, files: files}})
+	}()
+}
+
+// handleRenameFiles adds the files found by a workspace search to the rename
+// proposal still shown, or shows them on their own once the proposal for
+// the buffer was accepted. Results of a proposal since dismissed are dropped.
+func (e *Engine) handleRenameFiles(result renameResult) {
+	if result.rename != e.renameSearch || result.path != e.buffer.Path() {
+		return
+	}
+	e.renameSearch = nil
+
+	var files []*text.FileStages
+	for _, f := range result.files {
+		if fs := e.stageFileLines(f.completion, f.lines); fs != nil {
+			files = append(files, fs)
+		}
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	switch {
+	case e.propagatingRename && e.stagedCompletion != nil && e.multiFile == nil:
+		currentFile := &text.FileStages{Staged: e.stagedCompletion}
+		e.multiFile = text.NewMultiFileStagedCompletion(append([]*text.FileStages{currentFile}, files...)...)
+	case e.state == stateIdle && e.stagedCompletion == nil:
+		e.propagatingRename = e.showOtherFiles(files)
+	default:
+		return
+	}
+	logger.Debug("rename: proposing %s -> %s in %d other files", result.rename.Old, result.rename.New, len(files))
+}
+
+// workspaceRenames returns the renamings of the identifier in the files of
+// workspace other than current that contain it.
+func workspaceRenames(workspace, current string, rules *ignore.Rules, rename text.Rename) []renameFile {
+	ctx, cancel := context.WithTimeout(context.Background(), renameSearchTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "rg", "--files-with-matches", "--word-regexp", "--fixed-strings", "--", rename.Old, ".")
+	cmd.Dir = workspace
+	out, err := cmd.Output()
+	if err != nil {
+		logger.Debug("rename: rg failed: %v", err)
+		return nil
+	}
+
+	var files []renameFile
+	for _, path := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		path = filepath.Clean(path)
+		if path == "." || path == current || rules.Match(path) {
+			continue
+		}
+		completion, lines := fileRename(workspace, path, rename)
+		if completion == nil {
+			continue
+		}
+		files = append(files, renameFile{completion: completion, lines: lines})
+		if len(files) == renameMaxFiles {
+			break
+		}
+	}
+	return files
+}
+
+// fileRename returns a completion renaming the identifier in the file at path
+// of workspace, with the file's lines, or nil when it cannot be read or has
+// no whole-word occurrence.
+func fileRename(workspace, path string, rename text.Rename) (*types.Completion, []string) {
+	lines, ok := readLines(filepath.Join(workspace, path))
+	if !ok {
+		return nil, nil
+	}
+	renamed, ok := rename.Apply(lines)
+	if !ok {
+		return nil, nil
+	}
+	return &types.Completion{FilePath: path, StartLine: 1, EndLineInc: len(lines), Lines: renamed}, lines
+}
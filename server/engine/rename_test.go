@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/text"
+	"cursortab/types"
+)
+
+func newRenameEngine(t *testing.T) (*Engine, *mockBuffer) {
+	t.Helper()
+	buf := newMockBuffer()
+	buf.lines = []string{"count := 0", "for range 3 {", "\tcount++", "}", "return count"}
+	buf.row = 1
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), newMockClock())
+	t.Cleanup(cancel)
+	eng.config.RenamePropagation.Enabled = true
+	return eng, buf
+}
+
+func TestRenamePropagation_ProposesOtherOccurrences(t *testing.T) {
+	eng, buf := newRenameEngine(t)
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 1, EndLineInc: 1, Lines: []string{"total := 0"}},
+	}})
+	buf.lines[0] = "total := 0"
+	eng.acceptCompletion()
+
+	assert.Equal(t, stateHasCompletion, eng.state, "rename proposed")
+	assert.True(t, eng.propagatingRename, "propagating")
+	assert.Equal(t, []string{"\ttotal++", "}", "return total"}, buf.lastPreparedCompletion.lines, "renamed occurrences")
+
+	buf.lines = []string{"total := 0", "for range 3 {", "\ttotal++", "}", "return total"}
+	calls := buf.prepareCompletionCalls
+	eng.acceptCompletion()
+
+	assert.False(t, eng.propagatingRename, "propagation finished")
+	assert.Equal(t, calls, buf.prepareCompletionCalls, "accepting the rename proposes nothing more")
+}
+
+func TestRenamePropagation_Disabled(t *testing.T) {
+	eng, buf := newRenameEngine(t)
+	eng.config.RenamePropagation.Enabled = false
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 1, EndLineInc: 1, Lines: []string{"total := 0"}},
+	}})
+	buf.lines[0] = "total := 0"
+	eng.acceptCompletion()
+
+	assert.NotEqual(t, stateHasCompletion, eng.state, "nothing proposed")
+	assert.False(t, eng.propagatingRename, "not propagating")
+}
+
+func TestRenamePropagation_NotARename(t *testing.T) {
+	eng, buf := newRenameEngine(t)
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 1, EndLineInc: 1, Lines: []string{"count := 10"}},
+	}})
+	buf.lines[0] = "count := 10"
+	eng.acceptCompletion()
+
+	assert.NotEqual(t, stateHasCompletion, eng.state, "nothing proposed")
+	assert.Nil(t, eng.acceptedRename, "no rename recorded")
+}
+
+func TestFileRename(t *testing.T) {
+	eng, _ := newRenameEngine(t)
+	eng.WorkspacePath = t.TempDir()
+	err := os.WriteFile(filepath.Join(eng.WorkspacePath, "use.go"), []byte("x := count\ny := discount\n"), 0o644)
+	assert.NoError(t, err, "write use.go")
+
+	completion, lines := fileRename(eng.WorkspacePath, "use.go", text.Rename{Old: "count", New: "total"})
+
+	assert.NotNil(t, completion, "completion")
+	assert.Equal(t, "use.go", completion.FilePath, "file")
+	assert.Equal(t, 2, completion.EndLineInc, "whole file")
+	assert.Equal(t, []string{"x := total", "y := discount"}, completion.Lines, "renamed lines")
+	assert.Equal(t, []string{"x := count", "y := discount"}, lines, "file lines")
+	completion, _ = fileRename(eng.WorkspacePath, "missing.go", text.Rename{Old: "count", New: "total"})
+	assert.Nil(t, completion, "unreadable file")
+}
+
+// acceptWorkspaceRename accepts a rename of count with workspace propagation
+// on, and returns the result its search would post for use.go.
+func acceptWorkspaceRename(t *testing.T, eng *Engine, buf *mockBuffer) renameResult {
+	t.Helper()
+	eng.config.RenamePropagation.Workspace = true
+	eng.WorkspacePath = t.TempDir()
+	err := os.WriteFile(filepath.Join(eng.WorkspacePath, "use.go"), []byte("x := count\n"), 0o644)
+	assert.NoError(t, err, "write use.go")
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 1, EndLineInc: 1, Lines: []string{"total := 0"}},
+	}})
+	buf.lines[0] = "total := 0"
+	eng.acceptCompletion()
+	assert.NotNil(t, eng.renameSearch, "workspace search started")
+
+	completion, lines := fileRename(eng.WorkspacePath, "use.go", *eng.renameSearch)
+	return renameResult{rename: eng.renameSearch, path: buf.path, files: []renameFile{{completion: completion, lines: lines}}}
+}
+
+func TestRenamePropagation_WorkspaceFilesJoinProposal(t *testing.T) {
+	eng, buf := newRenameEngine(t)
+	result := acceptWorkspaceRename(t, eng, buf)
+
+	eng.handleRenameFiles(result)
+
+	assert.Equal(t, stateHasCompletion, eng.state, "buffer proposal still shown")
+	assert.NotNil(t, eng.multiFile, "other files added")
+	assert.Len(t, 2, eng.multiFile.Files, "buffer and use.go")
+	assert.Nil(t, eng.renameSearch, "search finished")
+}
+
+func TestRenamePropagation_WorkspaceFilesAfterDismissDropped(t *testing.T) {
+	eng, buf := newRenameEngine(t)
+	result := acceptWorkspaceRename(t, eng, buf)
+
+	eng.clearAll()
+	eng.state = stateIdle
+	eng.handleRenameFiles(result)
+
+	assert.Nil(t, eng.multiFile, "nothing proposed")
+	assert.Equal(t, stateIdle, eng.state, "idle")
+}
@@ -6,25 +6,42 @@ import (
 
 	"cursortab/ctx"
 	"cursortab/logger"
+	"cursortab/quality"
 	"cursortab/text"
 	"cursortab/types"
 	"cursortab/utils"
 )
 
-// gatherContext delegates to the context gatherer if configured.
-func (e *Engine) gatherContext(filePath string) *types.ContextResult {
-	if e.contextGatherer == nil {
-		return nil
-	}
-	return e.contextGatherer.Gather(e.mainCtx, &ctx.SourceRequest{
+// gatherContext delegates to the context gatherer if configured, for the
+// cursor at row and col.
+func (e *Engine) gatherContext(filePath string, row, col int) *types.ContextResult {
+	return e.gather(e.sourceRequest(filePath, row, col))
+}
+
+// sourceRequest describes the context to gather for the cursor at row and
+// col. Built on the event loop, so that gathering it may run off it.
+func (e *Engine) sourceRequest(filePath string, row, col int) *ctx.SourceRequest {
+	return &ctx.SourceRequest{
 		FilePath:          filePath,
-		CursorRow:         e.buffer.Row(),
-		CursorCol:         e.buffer.Col(),
+		CursorRow:         row,
+		CursorCol:         col,
 		WorkspacePath:     e.WorkspacePath,
+		ProjectRoot:       e.projectRoot(),
 		MaxDiffBytes:      e.contextLimits.MaxDiffBytes,
 		MaxChangedSymbols: e.contextLimits.MaxChangedSymbols,
 		MaxSiblings:       e.contextLimits.MaxSiblings,
-	})
+		MaxLSPSymbols:     e.contextLimits.MaxLSPSymbols,
+		MaxGitCommits:     e.contextLimits.MaxGitCommits,
+		LineCount:         len(e.buffer.Lines()),
+	}
+}
+
+// gather runs the context gatherer, if configured, for src.
+func (e *Engine) gather(src *ctx.SourceRequest) *types.ContextResult {
+	if e.contextGatherer == nil {
+		return nil
+	}
+	return e.contextGatherer.Gather(e.mainCtx, src)
 }
 
 // requestCompletion initiates a completion request.
@@ -32,36 +49,132 @@ func (e *Engine) requestCompletion(source types.CompletionSource) {
 	if e.stopped {
 		return
 	}
+	e.sendCompletionRequest(e.buildCompletionRequest(source))
+}
+
+// retriggerCompletion requests the next completion after auto-advance. The
+// request is downscaled, or skipped, when it would exceed the token budget,
+// and skipped while the provider is degraded or when it cannot be fit within
+// the payload cap. Returns false when it was skipped.
+func (e *Engine) retriggerCompletion() bool {
+	if e.stopped {
+		return false
+	}
+	req, ok := e.fitToBudget(e.buildCompletionRequest(types.CompletionSourceTyping))
+	if !ok {
+		return false
+	}
+	return e.sendCompletionRequest(req)
+}
 
+// buildCompletionRequest gathers the context for a request at the cursor.
+func (e *Engine) buildCompletionRequest(source types.CompletionSource) *types.CompletionRequest {
 	e.syncBuffer()
 
-	req := &types.CompletionRequest{
+	e.instruction = e.instructionAtCursor()
+	instruction := ""
+	if e.instruction != nil {
+		instruction = e.instruction.text
+	}
+
+	req := e.requestAt(source, e.buffer.Row(), e.buffer.Col())
+	req.Instruction = instruction
+	if instruction == "" {
+		e.cleanUpPaste(req)
+	}
+	if req.Source == types.CompletionSourceIdle && instruction == "" && e.config.FixDiagnostics {
+		fixDiagnostic(req)
+	}
+	return e.finishRequest(req)
+}
+
+// requestAt gathers the context for a request with the cursor at row and col
+// of the buffer as last synced.
+func (e *Engine) requestAt(source types.CompletionSource, row, col int) *types.CompletionRequest {
+	e.refreshContextLimits()
+	path, lines := e.buffer.Path(), e.buffer.Lines()
+	return &types.CompletionRequest{
 		Source:                source,
 		WorkspacePath:         e.WorkspacePath,
 		WorkspaceID:           e.WorkspaceID,
-		FilePath:              e.buffer.Path(),
-		Lines:                 e.buffer.Lines(),
+		ProjectRoot:           e.projectRoot(),
+		FilePath:              path,
+		Lines:                 lines,
 		Version:               e.buffer.Version(),
 		PreviousLines:         e.buffer.PreviousLines(),
 		FileDiffHistories:     e.getAllFileDiffHistories(),
-		CursorRow:             e.buffer.Row(),
-		CursorCol:             e.buffer.Col(),
+		CursorRow:             row,
+		CursorCol:             col,
+		FenceLanguage:         fenceLanguage(path, lines, row),
 		ViewportHeight:        e.getViewportHeightConstraint(),
 		MaxVisibleLines:       e.config.MaxVisibleLines,
-		AdditionalContext:     e.gatherContext(e.buffer.Path()),
-		RecentBufferSnapshots: e.getRecentBufferSnapshots(e.buffer.Path(), e.contextLimits.MaxRecentSnapshots),
-		UserActions:           e.getUserActionsForFile(e.buffer.Path()),
+		ProviderOptions:       e.config.ProviderOptions,
+		AdditionalContext:     e.gatherContext(path, row, col),
+		RecentBufferSnapshots: e.getRecentBufferSnapshots(path, e.contextLimits.MaxRecentSnapshots),
+		UserActions:           e.getUserActionsForFile(path),
+		RetrievalChunks:       e.retrieveChunks(e.contextLimits.MaxRetrievalChunks, row),
+	}
+}
+
+// finishRequest adds the injected context to req and trims it to the
+// context budget.
+func (e *Engine) finishRequest(req *types.CompletionRequest) *types.CompletionRequest {
+	if e.buffer.Ineligible() == "" {
+		req.RetrievalChunks = append(e.injectContext(req), req.RetrievalChunks...)
 	}
+	return e.config.ContextBudget.Apply(req)
+}
+
+// sendCompletionRequest sends req to the provider, streaming when supported.
+// A response cached for the same context is served without a request. Returns
+// false when the request was skipped because the provider is degraded, the
+// request exceeds the payload cap or the buffer gets no completions.
+func (e *Engine) sendCompletionRequest(req *types.CompletionRequest) bool {
+	if e.bufferIneligible() {
+		return false
+	}
+	req, ok := e.payloadCap().apply(req)
+	if !ok {
+		return false
+	}
+	e.qualityRequestSent(req)
+	e.scopes = stagingScopes(req.GetTreesitter())
+	key := cacheKey(req)
+	if resp := e.cache.get(key, e.clock.Now(), e.config.CacheTTL); resp != nil {
+		logger.Debug("serving completion from cache")
+		e.statsPending = nil
+		e.state = statePendingCompletion
+		go e.post(Event{Type: EventCompletionReady, Data: resp})
+		return true
+	}
+
+	if !e.breakerAllows() {
+		e.finishQuality(quality.OutcomeCancelled)
+		return false
+	}
+	if ok, wait := e.limiter.admit(e.clock.Now()); !ok {
+		e.queueRequest(req, key, wait)
+		return true
+	}
+	e.dispatchRequest(req, key)
+	return true
+}
+
+// dispatchRequest sends req to the provider, streaming when supported. key is
+// the cache key the response is stored under.
+func (e *Engine) dispatchRequest(req *types.CompletionRequest, key uint64) {
+	e.budget.record(e.clock.Now(), estimateRequestTokens(req))
+	e.statsRequestSent(req)
 
 	// Check if provider supports streaming
 	if streamProvider, ok := e.provider.(LineStreamProvider); ok {
 		switch streamProvider.GetStreamingType() {
 		case StreamingTypeLines:
-			e.requestStreamingCompletion(streamProvider, req)
+			e.requestStreamingCompletion(streamProvider, req, key)
 			return
 		case StreamingTypeTokens:
 			if tokenProvider, ok := e.provider.(TokenStreamProvider); ok {
-				e.requestTokenStreamingCompletion(tokenProvider, req)
+				e.requestTokenStreamingCompletion(tokenProvider, req, key)
 				return
 			}
 		}
@@ -70,13 +183,15 @@ func (e *Engine) requestCompletion(source types.CompletionSource) {
 	// Fallback to batch mode
 	e.state = statePendingCompletion
 
-	ctx, cancel := context.WithTimeout(e.mainCtx, e.config.CompletionTimeout)
+	ctx, cancel := e.requestContext()
 	e.currentCancel = cancel
+	maxCacheEntries := e.config.CacheMaxEntries
 
 	go func() {
 		defer cancel()
 
-		result, err := e.provider.GetCompletion(ctx, req)
+		sent, secrets := e.redactRequest(req)
+		result, err := e.provider.GetCompletion(ctx, sent)
 
 		if err != nil {
 			select {
@@ -85,6 +200,8 @@ func (e *Engine) requestCompletion(source types.CompletionSource) {
 			}
 			return
 		}
+		revealResponse(result, secrets)
+		e.cache.put(key, result, e.clock.Now(), maxCacheEntries)
 
 		select {
 		case e.eventChan <- Event{Type: EventCompletionReady, Data: result}:
@@ -108,10 +225,12 @@ func (e *Engine) getViewportHeightConstraint() int {
 }
 
 // requestPrefetch requests a completion for a specific cursor position without changing the engine state.
-// Used to speculatively request completions ahead of user actions.
-func (e *Engine) requestPrefetch(source types.CompletionSource, overrideRow int, overrideCol int) {
+// Used to speculatively request completions ahead of user actions. Returns false
+// when the prefetch was skipped to stay within the token budget or rate limit,
+// because the provider is degraded or because the buffer gets no completions.
+func (e *Engine) requestPrefetch(source types.CompletionSource, overrideRow int, overrideCol int) bool {
 	if e.stopped {
-		return
+		return false
 	}
 
 	// Cancel existing prefetch if any
@@ -123,36 +242,81 @@ func (e *Engine) requestPrefetch(source types.CompletionSource, overrideRow int,
 
 	// Sync buffer to ensure latest context
 	e.syncBuffer()
+	if e.bufferIneligible() {
+		return false
+	}
 
-	ctx, cancel := context.WithTimeout(e.mainCtx, e.config.CompletionTimeout)
-	e.prefetchCancel = cancel
-	e.prefetchState = prefetchInFlight
+	// The pipeline may already hold the completion for this buffer
+	if entry := e.takeSpeculation(); entry != nil {
+		e.deliverSpeculation(entry)
+		return true
+	}
+	e.dropSpeculation()
 
 	// Snapshot required values to avoid races with buffer mutation
-	lines := append([]string{}, e.buffer.Lines()...)
-	previousLines := append([]string{}, e.buffer.PreviousLines()...)
-	version := e.buffer.Version()
-	filePath := e.buffer.Path()
-	viewportHeight := e.getViewportHeightConstraint()
+	e.refreshContextLimits()
+	full := &types.CompletionRequest{
+		Source:            source,
+		WorkspacePath:     e.WorkspacePath,
+		WorkspaceID:       e.WorkspaceID,
+		ProjectRoot:       e.projectRoot(),
+		FilePath:          e.buffer.Path(),
+		Lines:             append([]string{}, e.buffer.Lines()...),
+		Version:           e.buffer.Version(),
+		PreviousLines:     append([]string{}, e.buffer.PreviousLines()...),
+		FileDiffHistories: e.getAllFileDiffHistories(),
+		CursorRow:         overrideRow,
+		CursorCol:         overrideCol,
+		FenceLanguage:     fenceLanguage(e.buffer.Path(), e.buffer.Lines(), overrideRow),
+		ViewportHeight:    e.getViewportHeightConstraint(),
+		MaxVisibleLines:   e.config.MaxVisibleLines,
+		ProviderOptions:   e.config.ProviderOptions,
+	}
+	req, ok := e.fitToBudget(full)
+	if !ok || !e.breakerAllows() {
+		return false
+	}
+	if ok, _ := e.limiter.admit(e.clock.Now()); !ok {
+		logger.Debug("rate limit: skipping prefetch")
+		e.limiter.noteSkippedPrefetch()
+		return false
+	}
+
+	ctx, cancel := e.requestContext()
+	e.prefetchCancel = cancel
+	e.prefetchState = prefetchInFlight
+	e.prefetchLines = full.Lines
+	budgeter := e.config.ContextBudget
+	payload := e.payloadCap()
+	budget, stats, providerName := e.budget, e.stats, e.providerName()
+	src := e.sourceRequest(full.FilePath, overrideRow, overrideCol)
 
 	go func() {
 		defer cancel()
 
-		result, err := e.provider.GetCompletion(ctx, &types.CompletionRequest{
-			Source:            source,
-			WorkspacePath:     e.WorkspacePath,
-			WorkspaceID:       e.WorkspaceID,
-			FilePath:          filePath,
-			Lines:             lines,
-			Version:           version,
-			PreviousLines:     previousLines,
-			FileDiffHistories: e.getAllFileDiffHistories(),
-			CursorRow:         overrideRow,
-			CursorCol:         overrideCol,
-			ViewportHeight:    viewportHeight,
-			MaxVisibleLines:   e.config.MaxVisibleLines,
-			AdditionalContext: e.gatherContext(filePath),
-		})
+		// A downscaled request goes without the gathered context, and so does
+		// one the gathered context takes over the budget
+		if req == full {
+			req.AdditionalContext = e.gather(src)
+			req = budgeter.Apply(req)
+			if !budget.fits(e.clock.Now(), estimateRequestTokens(req)) {
+				req = downscaleRequest(req)
+				budget.noteDownscaled()
+			}
+		}
+		req, ok := payload.apply(req)
+		if !ok {
+			select {
+			case e.eventChan <- Event{Type: EventPrefetchError}:
+			case <-e.mainCtx.Done():
+			}
+			return
+		}
+		tokens := estimateRequestTokens(req)
+		budget.record(e.clock.Now(), tokens)
+		stats.RecordRequest(providerName, tokens)
+		sent, secrets := e.redactRequest(req)
+		result, err := e.provider.GetCompletion(ctx, sent)
 
 		if err != nil {
 			select {
@@ -161,20 +325,24 @@ func (e *Engine) requestPrefetch(source types.CompletionSource, overrideRow int,
 			}
 			return
 		}
+		revealResponse(result, secrets)
 
 		select {
 		case e.eventChan <- Event{Type: EventPrefetchReady, Data: result}:
 		case <-e.mainCtx.Done():
 		}
 	}()
+	return true
 }
 
 // handlePrefetchReady processes a successful prefetch response
 func (e *Engine) handlePrefetchReady(resp *types.CompletionResponse) {
-	e.prefetchedCompletions = resp.Completions
-	e.prefetchedCursorTarget = resp.CursorTarget
+	e.setPrefetched(resp, e.prefetchLines)
 	previousPrefetchState := e.prefetchState
 	e.prefetchState = prefetchReady
+	e.prefetchResp = resp
+	e.notifyPrefetchReady(resp.Completions)
+	e.extendSpeculation()
 
 	// If we were waiting for prefetch due to tab press, continue with cursor target logic
 	if previousPrefetchState == prefetchWaitingForTab {
@@ -197,7 +365,7 @@ func (e *Engine) handlePrefetchReady(resp *types.CompletionResponse) {
 // If the first changed line is close to the cursor, shows completion directly.
 // Otherwise, shows a cursor prediction indicator pointing to the target line.
 func (e *Engine) handlePrefetchCursorPrediction() {
-	if len(e.prefetchedCompletions) == 0 {
+	if len(e.prefetchedCompletions) == 0 || !e.checkPrefetched() {
 		return
 	}
 
@@ -228,7 +396,7 @@ func (e *Engine) handlePrefetchCursorPrediction() {
 			ShouldRetrigger: false,
 		}
 		e.state = stateHasCursorTarget
-		e.buffer.ShowCursorTarget(targetLine)
+		e.showCursorTarget(targetLine)
 	}
 }
 
@@ -239,6 +407,9 @@ func (e *Engine) tryShowPrefetchedCompletion() bool {
 	}
 
 	e.syncBuffer()
+	if !e.checkPrefetched() {
+		return false
+	}
 
 	comp := e.prefetchedCompletions[0]
 
@@ -246,6 +417,7 @@ func (e *Engine) tryShowPrefetchedCompletion() bool {
 	e.prefetchedCursorTarget = nil
 	e.prefetchState = prefetchNone
 
+	e.showAnnotation(e.untimedAnnotation())
 	return e.processCompletion(comp)
 }
 
@@ -270,11 +442,11 @@ func (e *Engine) handleDeferredCursorTarget() {
 		return
 	}
 
-	// Check if we now have prefetched completions
-	if len(e.prefetchedCompletions) > 0 {
-		// Sync buffer to get updated cursor position
-		e.syncBuffer()
+	// Sync buffer to get updated cursor position
+	e.syncBuffer()
 
+	// Check if we now have prefetched completions that still apply
+	if len(e.prefetchedCompletions) > 0 && e.checkPrefetched() {
 		comp := e.prefetchedCompletions[0]
 
 		// Clear prefetch state before processing
@@ -282,6 +454,7 @@ func (e *Engine) handleDeferredCursorTarget() {
 		e.prefetchedCursorTarget = nil
 		e.prefetchState = prefetchNone
 
+		e.showAnnotation(e.untimedAnnotation())
 		if e.processCompletion(comp) {
 			return
 		}
@@ -293,10 +466,7 @@ func (e *Engine) handleDeferredCursorTarget() {
 
 	// Fall back to original behavior - trigger new completion if needed
 	if e.cursorTarget.ShouldRetrigger {
-		e.requestCompletion(types.CompletionSourceTyping)
-		e.state = stateIdle
-		e.cursorTarget = nil
-		return
+		e.retriggerCompletion()
 	}
 
 	e.state = stateIdle
@@ -321,8 +491,9 @@ func (e *Engine) prefetchAtNMinusOne() {
 	}
 
 	overrideRow := max(1, lastStage.BufferStart)
-	e.requestPrefetch(types.CompletionSourceTyping, overrideRow, 0)
-	e.prefetchState = prefetchWaitingForCursorPrediction
+	if e.requestPrefetch(types.CompletionSourceTyping, overrideRow, 0) {
+		e.prefetchState = prefetchWaitingForCursorPrediction
+	}
 }
 
 // prefetchAtCursorTarget triggers prefetch after accepting to cursor target position.
@@ -338,6 +509,7 @@ func (e *Engine) prefetchAtCursorTarget() {
 	}
 
 	overrideRow := max(1, int(e.cursorTarget.LineNumber))
-	e.requestPrefetch(types.CompletionSourceTyping, overrideRow, 0)
-	e.prefetchState = prefetchWaitingForCursorPrediction
+	if e.requestPrefetch(types.CompletionSourceTyping, overrideRow, 0) {
+		e.prefetchState = prefetchWaitingForCursorPrediction
+	}
 }
@@ -254,7 +254,7 @@ func TestPartialAccept_FinishTriggersPrefetch_ShouldRetrigger(t *testing.T) {
 
 	initialSyncCalls := buf.syncCalls
 
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	assert.True(t, buf.syncCalls > initialSyncCalls, "buffer should be synced after finish")
 	assert.Equal(t, prefetchWaitingForCursorPrediction, eng.prefetchState, "prefetch should be waiting for cursor prediction")
@@ -315,7 +315,7 @@ func TestPartialAccept_FinishTriggersPrefetch_N1Stage(t *testing.T) {
 		},
 	}
 
-	eng.doPartialAcceptCompletion(Event{Type: EventPartialAccept})
+	eng.doPartialAcceptWord(Event{Type: EventPartialAcceptWord})
 
 	assert.NotNil(t, eng.stagedCompletion, "stagedCompletion should not be nil")
 	assert.Equal(t, 1, eng.stagedCompletion.CurrentIdx, "should be at stage 1")
@@ -586,3 +586,32 @@ func TestAcceptLastStage_WaitsForInflightPrefetch(t *testing.T) {
 	assert.Equal(t, prefetchWaitingForTab, eng.prefetchState, "should be waiting for prefetch")
 	assert.Equal(t, stateIdle, eng.state, "should clear UI while waiting")
 }
+
+func TestBuildCompletionRequest_PassesProviderOptions(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"hello"}
+	buf.row = 1
+	eng, cancel := createTestEngineWithContext(buf, newMockProvider(), newMockClock())
+	defer cancel()
+	eng.config.ProviderOptions = types.ProviderOptions{"top_p": 0.9}
+
+	req := eng.buildCompletionRequest(types.CompletionSourceTyping)
+
+	topP, ok := req.ProviderOptions.TopP()
+	assert.True(t, ok, "top_p set")
+	assert.Equal(t, 0.9, topP, "top_p")
+}
+
+func TestBuildCompletionRequest_FollowsProviderContextLimits(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"hello"}
+	buf.row = 1
+	prov := newMockProvider()
+	eng, cancel := createTestEngineWithContext(buf, prov, newMockClock())
+	defer cancel()
+
+	prov.limits.MaxInputLines = 7
+	eng.buildCompletionRequest(types.CompletionSourceTyping)
+
+	assert.Equal(t, 7, eng.contextLimits.MaxInputLines, "limits of the serving provider")
+}
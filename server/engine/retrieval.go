@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"cursortab/types"
+)
+
+// retrievalQueryLines is how many lines above and below the cursor make up
+// the retrieval query.
+const retrievalQueryLines = 10
+
+// indexCurrentBuffer adds the buffer to the retrieval index, so that its
+// chunks can be retrieved once the user works in another file.
+func (e *Engine) indexCurrentBuffer() {
+	path := e.buffer.Path()
+	if path == "" || e.ignore.Match(path) {
+		return
+	}
+	e.retrieval.Update(path, e.buffer.Version(), e.buffer.Lines())
+}
+
+// retrieveChunks returns up to limit chunks of other visited files ranked by
+// their overlap with the lines around the cursor.
+func (e *Engine) retrieveChunks(limit, row int) []*types.RetrievalChunk {
+	if limit <= 0 {
+		return nil
+	}
+	e.indexCurrentBuffer()
+
+	lines := e.buffer.Lines()
+	start := max(row-1-retrievalQueryLines, 0)
+	end := min(row+retrievalQueryLines, len(lines))
+	if start >= end {
+		return nil
+	}
+
+	var chunks []*types.RetrievalChunk
+	for _, c := range e.retrieval.Search(lines[start:end], e.buffer.Path(), limit) {
+		if e.ignore.Match(c.Path) {
+			continue
+		}
+		chunks = append(chunks, &types.RetrievalChunk{FilePath: c.Path, StartLine: c.StartLine, Lines: c.Lines})
+	}
+	return chunks
+}
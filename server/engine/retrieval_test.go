@@ -0,0 +1,25 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestRetrieveChunks_FromPreviouslyVisitedFile(t *testing.T) {
+	buf := newMockBuffer()
+	buf.path = "user.go"
+	buf.lines = []string{"type User struct {", "\tName string", "}"}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.retrieveChunks(5, eng.buffer.Row())
+
+	buf.path = "main.go"
+	buf.lines = []string{"package main", "", "u := User{}"}
+	buf.row = 3
+	chunks := eng.retrieveChunks(5, eng.buffer.Row())
+
+	assert.Len(t, 1, chunks, "chunks")
+	assert.Equal(t, "user.go", chunks[0].FilePath, "visited file")
+	assert.Equal(t, 1, chunks[0].StartLine, "start line")
+	assert.Len(t, 0, eng.retrieveChunks(-1, eng.buffer.Row()), "disabled")
+}
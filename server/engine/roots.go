@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+)
+
+// DefaultRootMarkers are the files and directories whose presence marks the
+// root of a project when no markers are configured.
+var DefaultRootMarkers = []string{".git", "go.mod", "package.json"}
+
+// rootFinder resolves the project root of a directory: the nearest ancestor
+// holding one of the markers. Results are cached per directory, so buffers
+// from several projects each keep their own root within a session.
+type rootFinder struct {
+	markers []string
+	roots   map[string]string // Directory -> root ("" when no marker was found)
+}
+
+func newRootFinder(markers []string) *rootFinder {
+	if markers == nil {
+		markers = DefaultRootMarkers
+	}
+	return &rootFinder{markers: markers, roots: make(map[string]string)}
+}
+
+// find returns the project root of dir, or "" when no ancestor holds a marker.
+func (f *rootFinder) find(dir string) string {
+	if root, ok := f.roots[dir]; ok {
+		return root
+	}
+
+	root := ""
+	for _, marker := range f.markers {
+		if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+			root = dir
+			break
+		}
+	}
+	if parent := filepath.Dir(dir); root == "" && parent != dir {
+		root = f.find(parent)
+	}
+
+	f.roots[dir] = root
+	return root
+}
+
+// projectRoot returns the root of the project the current buffer belongs to,
+// falling back to the workspace for unnamed buffers and files outside any
+// project.
+func (e *Engine) projectRoot() string {
+	if e.buffer.Path() == "" {
+		return e.WorkspacePath
+	}
+	return e.rootOf(cmp.Or(e.buffer.AbsolutePath(), e.buffer.Path()))
+}
+
+// rootOf returns the root of the project holding a file given by its absolute
+// or workspace-relative path, or the workspace when it is in no project.
+func (e *Engine) rootOf(path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(e.WorkspacePath, path)
+	}
+	return cmp.Or(e.roots.find(filepath.Dir(path)), e.WorkspacePath)
+}
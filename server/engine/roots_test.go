@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func makeDirs(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, f := range files {
+		path := filepath.Join(root, f)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755), "mkdir")
+		assert.NoError(t, os.WriteFile(path, nil, 0644), "write")
+	}
+}
+
+func TestRootFinder_NearestMarker(t *testing.T) {
+	ws := t.TempDir()
+	makeDirs(t, ws, ".git/HEAD", "api/go.mod", "api/handlers/h.go", "web/src/app.ts", "web/package.json")
+	f := newRootFinder(nil)
+
+	assert.Equal(t, filepath.Join(ws, "api"), f.find(filepath.Join(ws, "api", "handlers")), "go.mod root")
+	assert.Equal(t, filepath.Join(ws, "web"), f.find(filepath.Join(ws, "web", "src")), "package.json root")
+	assert.Equal(t, ws, f.find(ws), "git root")
+}
+
+func TestRootFinder_ConfiguredMarkers(t *testing.T) {
+	ws := t.TempDir()
+	makeDirs(t, ws, ".git/HEAD", "api/go.mod", "api/x.go")
+	f := newRootFinder([]string{".git"})
+
+	assert.Equal(t, ws, f.find(filepath.Join(ws, "api")), "only configured markers count")
+}
+
+func TestProjectRoot_PerBufferWithFallback(t *testing.T) {
+	ws := t.TempDir()
+	other := t.TempDir()
+	makeDirs(t, ws, "api/go.mod", "api/main.go")
+	buf := newMockBuffer()
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.WorkspacePath = ws
+
+	buf.absPath = filepath.Join(ws, "api", "main.go")
+	assert.Equal(t, filepath.Join(ws, "api"), eng.projectRoot(), "root of the buffer's project")
+
+	buf.absPath = filepath.Join(other, "notes.txt")
+	assert.Equal(t, ws, eng.projectRoot(), "workspace outside any project")
+
+	buf.absPath = ""
+	assert.Equal(t, ws, eng.projectRoot(), "workspace for unnamed buffers")
+}
+
+func monorepoEngine(t *testing.T) (*Engine, *mockBuffer) {
+	t.Helper()
+	ws := t.TempDir()
+	makeDirs(t, ws, ".git/HEAD", "api/go.mod", "web/package.json")
+	buf := newMockBuffer()
+	buf.path = "api/main.go"
+	buf.absPath = filepath.Join(ws, "api", "main.go")
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.WorkspacePath = ws
+	return eng, buf
+}
+
+func TestRecentBufferSnapshots_OnlyCurrentProject(t *testing.T) {
+	eng, _ := monorepoEngine(t)
+	eng.fileStateStore["api/util.go"] = &FileState{FirstLines: []string{"package api"}, LastAccessNs: 1}
+	eng.fileStateStore["web/app.ts"] = &FileState{FirstLines: []string{"export {}"}, LastAccessNs: 2}
+
+	snapshots := eng.getRecentBufferSnapshots("api/main.go", 10)
+
+	assert.Len(t, 1, snapshots, "snapshots")
+	assert.Equal(t, "api/util.go", snapshots[0].FilePath, "file of the same project")
+}
+
+func TestTrimFileStateStore_PerProject(t *testing.T) {
+	eng, _ := monorepoEngine(t)
+	eng.fileStateStore["api/a.go"] = &FileState{LastAccessNs: 1}
+	eng.fileStateStore["web/a.ts"] = &FileState{LastAccessNs: 2}
+	eng.fileStateStore["web/b.ts"] = &FileState{LastAccessNs: 3}
+	eng.fileStateStore["web/c.ts"] = &FileState{LastAccessNs: 4}
+
+	eng.trimFileStateStore(2)
+
+	assert.NotNil(t, eng.fileStateStore["api/a.go"], "other project's file kept")
+	assert.NotNil(t, eng.fileStateStore["web/c.ts"], "most recent web file kept")
+	assert.NotNil(t, eng.fileStateStore["web/b.ts"], "second most recent web file kept")
+	assert.Nil(t, eng.fileStateStore["web/a.ts"], "oldest web file dropped")
+}
+
+func TestUserActions_RingPerProject(t *testing.T) {
+	eng, _ := monorepoEngine(t)
+	eng.contextLimits.MaxUserActions = 2
+
+	eng.recordUserAction(&types.UserAction{FilePath: "api/main.go", LineNumber: 1})
+	for i := range 3 {
+		eng.recordUserAction(&types.UserAction{FilePath: "web/app.ts", LineNumber: i})
+	}
+
+	assert.Len(t, 1, eng.getUserActionsForFile("api/main.go"), "not evicted by another project")
+	assert.Len(t, 2, eng.getUserActionsForFile("web/app.ts"), "capped per project")
+}
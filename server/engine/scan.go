@@ -0,0 +1,254 @@
+package engine
+
+import (
+	"slices"
+
+	"cursortab/logger"
+	"cursortab/types"
+	"cursortab/utils"
+)
+
+const (
+	maxScanLocations = 3  // Locations requested by one idle scan
+	scanSpacing      = 10 // Min lines between scanned locations, and from the cursor
+)
+
+// idleScan is a round of requests at the locations of the current file
+// likely to need an edit, sent once the cursor rests for ScanDelay.
+type idleScan struct {
+	version     int      // Buffer version the requests were built against
+	lines       []string // Buffer content the requests were built against
+	pending     int      // Requests still in flight
+	completions []*types.Completion
+}
+
+// scanResult is the outcome of one request of an idle scan.
+type scanResult struct {
+	scan *idleScan
+	resp *types.CompletionResponse
+	err  error
+}
+
+// startScanTimer arms the idle scan, unless it is disabled.
+func (e *Engine) startScanTimer() {
+	if e.config.ScanDelay <= 0 {
+		return
+	}
+	e.scanTimer = e.clock.AfterFunc(e.config.ScanDelay, func() {
+		e.mu.RLock()
+		stopped := e.stopped
+		mainCtx := e.mainCtx
+		e.mu.RUnlock()
+
+		if stopped || mainCtx == nil {
+			return
+		}
+
+		select {
+		case e.eventChan <- Event{Type: EventScanTimeout}:
+		case <-mainCtx.Done():
+		}
+	})
+}
+
+// stopScan disarms the idle scan and drops the requests of one in flight.
+func (e *Engine) stopScan() {
+	if e.scanTimer != nil {
+		e.scanTimer.Stop()
+		e.scanTimer = nil
+	}
+	if e.scanCancel != nil {
+		e.scanCancel()
+		e.scanCancel = nil
+	}
+	e.scan = nil
+}
+
+// scanLocations returns the lines worth a request besides the cursor: those
+// with an LSP error, nearest first, then those edited recently, newest first.
+// Locations close to the cursor or to one already picked are skipped.
+func scanLocations(diags *types.LinterErrors, actions []*types.UserAction, cursorRow, lineCount int) []int {
+	var candidates []int
+	if diags != nil {
+		var errorLines []int
+		for _, d := range diags.Errors {
+			if d.Severity == errorSeverity && d.Range != nil {
+				errorLines = append(errorLines, d.Range.StartLine)
+			}
+		}
+		slices.SortStableFunc(errorLines, func(a, b int) int {
+			return utils.Abs(a-cursorRow) - utils.Abs(b-cursorRow)
+		})
+		candidates = append(candidates, errorLines...)
+	}
+	for _, a := range slices.Backward(actions) {
+		if a.ActionType != types.ActionCursorMovement {
+			candidates = append(candidates, a.LineNumber)
+		}
+	}
+
+	picked := []int{cursorRow}
+	for _, line := range candidates {
+		if line < 1 || line > lineCount {
+			continue
+		}
+		if slices.ContainsFunc(picked, func(p int) bool { return utils.Abs(p-line) < scanSpacing }) {
+			continue
+		}
+		picked = append(picked, line)
+		if len(picked) > maxScanLocations {
+			break
+		}
+	}
+	return picked[1:]
+}
+
+// doScan requests completions at the locations of the current file likely
+// to need an edit. Their results are shown together once all have arrived.
+func (e *Engine) doScan(event Event) {
+	e.scanTimer = nil
+	if e.stopped || e.offline || !e.breakerAllows() {
+		return
+	}
+
+	e.syncBuffer()
+	if e.bufferIneligible() {
+		return
+	}
+	e.refreshContextLimits()
+	path := e.buffer.Path()
+	var diags *types.LinterErrors
+	if gathered := e.gatherContext(path, e.buffer.Row(), e.buffer.Col()); gathered != nil {
+		diags = gathered.Diagnostics
+	}
+	lines := copyLines(e.buffer.Lines())
+	rows := scanLocations(diags, e.getUserActionsForFile(path), e.buffer.Row(), len(lines))
+	if len(rows) == 0 {
+		return
+	}
+
+	scan := &idleScan{version: e.buffer.Version(), lines: lines}
+	ctx, cancel := e.requestContext()
+	payload := e.payloadCap()
+	for _, row := range rows {
+		req, ok := e.fitToBudget(&types.CompletionRequest{
+			Source:            types.CompletionSourceIdle,
+			WorkspacePath:     e.WorkspacePath,
+			WorkspaceID:       e.WorkspaceID,
+			ProjectRoot:       e.projectRoot(),
+			FilePath:          path,
+			Lines:             lines,
+			Version:           scan.version,
+			PreviousLines:     e.buffer.PreviousLines(),
+			FileDiffHistories: e.getAllFileDiffHistories(),
+			CursorRow:         row,
+			FenceLanguage:     fenceLanguage(path, lines, row),
+			MaxVisibleLines:   e.config.MaxVisibleLines,
+			ProviderOptions:   e.config.ProviderOptions,
+			AdditionalContext: &types.ContextResult{Diagnostics: diags},
+		})
+		if !ok {
+			continue
+		}
+		req, ok = payload.apply(e.config.ContextBudget.Apply(req))
+		if !ok {
+			continue
+		}
+		if ok, _ := e.limiter.admit(e.clock.Now()); !ok {
+			logger.Debug("rate limit: skipping idle scan of line %d", row)
+			break
+		}
+		e.budget.record(e.clock.Now(), estimateRequestTokens(req))
+		e.stats.RecordRequest(e.providerName(), estimateRequestTokens(req))
+		scan.pending++
+
+		go func() {
+			sent, secrets := e.redactRequest(req)
+			resp, err := e.provider.GetCompletion(ctx, sent)
+			if err == nil {
+				revealResponse(resp, secrets)
+			}
+			select {
+			case e.eventChan <- Event{Type: EventScanReady, Data: scanResult{scan: scan, resp: resp, err: err}}:
+			case <-e.mainCtx.Done():
+			}
+		}()
+	}
+	if scan.pending == 0 {
+		cancel()
+		return
+	}
+	logger.Debug("idle scan: requesting %d locations", scan.pending)
+	e.scan = scan
+	e.scanCancel = cancel
+}
+
+// handleScanResult collects a result of the idle scan in flight, and shows
+// the edits found once the last one has arrived, if the buffer and the
+// engine are still as the scan left them.
+func (e *Engine) handleScanResult(result scanResult) {
+	scan := result.scan
+	if scan != e.scan {
+		return
+	}
+	if result.err != nil {
+		logger.Debug("idle scan: %v", result.err)
+	} else {
+		current, _ := e.splitByFile(result.resp.Completions)
+		if len(current) > 0 {
+			scan.completions = append(scan.completions, current[0])
+		}
+	}
+	scan.pending--
+	if scan.pending > 0 {
+		return
+	}
+
+	e.scanCancel()
+	e.scan, e.scanCancel = nil, nil
+	e.syncBuffer()
+	if e.state != stateIdle || !e.isModeEnabled() || e.buffer.Version() != scan.version {
+		return
+	}
+	merged := mergeCompletions(scan.completions, scan.lines, e.config.EOFPolicy)
+	if merged == nil {
+		return
+	}
+	logger.Debug("idle scan: showing edits on lines %d-%d", merged.StartLine, merged.EndLineInc)
+	e.processCompletion(merged)
+}
+
+// mergeCompletions combines completions for different parts of lines into
+// one spanning them all, the lines between them unchanged, so that staging
+// turns each into stages the cursor jumps between. Completions without
+// changes or overlapping one before them are left out. Returns nil when none
+// is left.
+func mergeCompletions(completions []*types.Completion, lines []string, policy EOFPolicy) *types.Completion {
+	var kept []*types.Completion
+	for _, c := range completions {
+		c, ok := fitToBuffer(c, lines, policy)
+		if !ok || c.StartLine < 1 || c.StartLine > len(lines)+1 {
+			continue
+		}
+		if end := min(c.EndLineInc, len(lines)); end >= c.StartLine && slices.Equal(c.Lines, lines[c.StartLine-1:end]) {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	slices.SortStableFunc(kept, func(a, b *types.Completion) int { return a.StartLine - b.StartLine })
+
+	var merged *types.Completion
+	for _, c := range kept {
+		if merged == nil {
+			merged = &types.Completion{StartLine: c.StartLine, EndLineInc: c.EndLineInc, Lines: slices.Clone(c.Lines)}
+			continue
+		}
+		if c.StartLine <= merged.EndLineInc {
+			continue
+		}
+		merged.Lines = append(merged.Lines, lines[merged.EndLineInc:c.StartLine-1]...)
+		merged.Lines = append(merged.Lines, c.Lines...)
+		merged.EndLineInc = c.EndLineInc
+	}
+	return merged
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestScanLocations_ErrorsThenRecentEdits(t *testing.T) {
+	diags := &types.LinterErrors{Errors: []*types.LinterError{
+		diagnostic(errorSeverity, 80, 0, "far error"),
+		diagnostic("DIAGNOSTIC_SEVERITY_WARNING", 40, 0, "warning"),
+		diagnostic(errorSeverity, 30, 0, "near error"),
+		diagnostic(errorSeverity, 12, 0, "error next to the cursor"),
+	}}
+	actions := []*types.UserAction{
+		{ActionType: types.ActionInsertChar, LineNumber: 60},
+		{ActionType: types.ActionCursorMovement, LineNumber: 50},
+		{ActionType: types.ActionDeleteChar, LineNumber: 33},
+	}
+
+	rows := scanLocations(diags, actions, 5, 100)
+
+	assert.Equal(t, []int{30, 80, 60}, rows, "errors nearest first, then edits newest first, spaced out")
+}
+
+func TestScanLocations_Limit(t *testing.T) {
+	var actions []*types.UserAction
+	for line := 20; line <= 100; line += 20 {
+		actions = append(actions, &types.UserAction{ActionType: types.ActionInsertChar, LineNumber: line})
+	}
+
+	rows := scanLocations(nil, actions, 1, 100)
+
+	assert.Len(t, maxScanLocations, rows, "rows")
+}
+
+func TestMergeCompletions(t *testing.T) {
+	lines := []string{"a", "b", "c", "d", "e", "f"}
+
+	merged := mergeCompletions([]*types.Completion{
+		{StartLine: 5, EndLineInc: 5, Lines: []string{"E"}},
+		{StartLine: 2, EndLineInc: 2, Lines: []string{"B", "B2"}},
+		{StartLine: 3, EndLineInc: 3, Lines: []string{"c"}},
+		{StartLine: 5, EndLineInc: 6, Lines: []string{"overlap"}},
+	}, lines, EOFClamp)
+
+	assert.Equal(t, 2, merged.StartLine, "start")
+	assert.Equal(t, 5, merged.EndLineInc, "end")
+	assert.Equal(t, []string{"B", "B2", "c", "d", "E"}, merged.Lines, "lines between kept")
+	assert.Nil(t, mergeCompletions([]*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"a"}}}, lines, EOFClamp), "no changes")
+}
+
+func TestScan_ShowsEditAwayFromCursorAsTarget(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = nil
+	for i := 1; i <= 40; i++ {
+		buf.lines = append(buf.lines, fmt.Sprintf("line %d", i))
+	}
+	prov := newMockProvider()
+	prov.completionResp = &types.CompletionResponse{Completions: []*types.Completion{{StartLine: 30, EndLineInc: 30, Lines: []string{"line 30 fixed"}}}}
+	eng, cancel := createTestEngineWithContext(buf, prov, newMockClock())
+	defer cancel()
+	eng.userActions[eng.rootOf(buf.path)] = []*types.UserAction{{ActionType: types.ActionInsertChar, FilePath: buf.path, LineNumber: 30}}
+
+	eng.doScan(Event{Type: EventScanTimeout})
+	select {
+	case event := <-eng.eventChan:
+		eng.handleEvent(event)
+	case <-time.After(time.Second):
+		t.Fatal("no scan result")
+	}
+
+	assert.Equal(t, 30, prov.lastRequest.CursorRow, "requested at the recent edit")
+	assert.Equal(t, stateHasCursorTarget, eng.state, "state")
+	assert.Equal(t, int32(30), eng.cursorTarget.LineNumber, "jump to the edit")
+}
+
+func TestScan_DroppedWhenBufferChanged(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = nil
+	for i := 1; i <= 40; i++ {
+		buf.lines = append(buf.lines, fmt.Sprintf("line %d", i))
+	}
+	prov := newMockProvider()
+	prov.completionResp = &types.CompletionResponse{Completions: []*types.Completion{{StartLine: 30, EndLineInc: 30, Lines: []string{"line 30 fixed"}}}}
+	eng, cancel := createTestEngineWithContext(buf, prov, newMockClock())
+	defer cancel()
+	eng.userActions[eng.rootOf(buf.path)] = []*types.UserAction{{ActionType: types.ActionInsertChar, FilePath: buf.path, LineNumber: 30}}
+
+	eng.doScan(Event{Type: EventScanTimeout})
+	buf.version++
+	select {
+	case event := <-eng.eventChan:
+		eng.handleEvent(event)
+	case <-time.After(time.Second):
+		t.Fatal("no scan result")
+	}
+
+	assert.Equal(t, stateIdle, eng.state, "nothing shown")
+}
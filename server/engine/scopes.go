@@ -0,0 +1,24 @@
+package engine
+
+import (
+	"cursortab/text"
+	"cursortab/types"
+)
+
+// stagingScopes returns the treesitter scopes of ts that stages should not be
+// split inside: the scope enclosing the cursor and its sibling declarations.
+func stagingScopes(ts *types.TreesitterContext) []text.LineRange {
+	if ts == nil {
+		return nil
+	}
+	var scopes []text.LineRange
+	if ts.EnclosingStart > 0 && ts.EnclosingEnd >= ts.EnclosingStart {
+		scopes = append(scopes, text.LineRange{Start: ts.EnclosingStart, End: ts.EnclosingEnd})
+	}
+	for _, sib := range ts.Siblings {
+		if sib.Line > 0 && sib.EndLine >= sib.Line {
+			scopes = append(scopes, text.LineRange{Start: sib.Line, End: sib.EndLine})
+		}
+	}
+	return scopes
+}
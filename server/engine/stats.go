@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"time"
+
+	"cursortab/types"
+)
+
+// pendingStats is the provider and send time of the request in flight.
+type pendingStats struct {
+	provider string
+	sentAt   time.Time
+}
+
+// SetProviderName registers fn to name the provider serving each request in
+// the stats and the quality log.
+func (e *Engine) SetProviderName(fn func() string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.providerNameFn = fn
+}
+
+// SetModelName registers fn to name the model serving each request in the
+// completion annotation and the per-model stats.
+func (e *Engine) SetModelName(fn func() string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.modelNameFn = fn
+}
+
+func (e *Engine) providerName() string {
+	if e.providerNameFn == nil {
+		return ""
+	}
+	return e.providerNameFn()
+}
+
+func (e *Engine) modelName() string {
+	if e.modelNameFn == nil {
+		return ""
+	}
+	return e.modelNameFn()
+}
+
+// untimedAnnotation describes the provider and model currently serving requests.
+func (e *Engine) untimedAnnotation() *types.Annotation {
+	return &types.Annotation{Provider: e.providerName(), Model: e.modelName()}
+}
+
+// responseAnnotation describes the response to the request in flight, timed
+// from when it was sent. Cached responses have no request in flight.
+func (e *Engine) responseAnnotation() *types.Annotation {
+	a := e.untimedAnnotation()
+	if e.statsPending != nil {
+		a.Provider = e.statsPending.provider
+		a.Latency = e.clock.Now().Sub(e.statsPending.sentAt)
+	}
+	return a
+}
+
+// showAnnotation passes the annotation of the completion about to be shown to the buffer.
+func (e *Engine) showAnnotation(a *types.Annotation) {
+	e.annotation = a
+	e.buffer.SetAnnotation(a)
+}
+
+// statsRequestSent counts req and starts timing its response.
+func (e *Engine) statsRequestSent(req *types.CompletionRequest) {
+	provider := e.providerName()
+	e.stats.RecordRequest(provider, estimateRequestTokens(req))
+	e.statsPending = &pendingStats{provider: provider, sentAt: e.clock.Now()}
+	e.annotation = nil
+}
+
+// statsResponded records the latency of the request in flight.
+func (e *Engine) statsResponded() {
+	if e.statsPending == nil {
+		return
+	}
+	e.stats.RecordLatency(e.statsPending.provider, e.clock.Now().Sub(e.statsPending.sentAt))
+	e.statsPending = nil
+}
+
+// statsFailed counts a failure of the request in flight.
+func (e *Engine) statsFailed() {
+	if e.statsPending == nil {
+		return
+	}
+	e.stats.RecordError(e.statsPending.provider)
+	e.statsPending = nil
+}
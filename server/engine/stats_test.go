@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/metrics"
+	"cursortab/types"
+)
+
+func TestStats_CountsCompletionsWithoutMetricsID(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+
+	eng.recordMetricsShown(nil)
+	eng.sendMetric(metrics.EventAccepted)
+
+	stats := eng.Stats()
+	assert.Equal(t, 1, stats.Shown, "shown")
+	assert.Equal(t, 1, stats.Accepted, "accepted")
+}
+
+func TestStats_RecordsProviderLatencyAndErrors(t *testing.T) {
+	clock := newMockClock()
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), clock)
+	eng.SetProviderName(func() string { return "zeta" })
+	req := &types.CompletionRequest{FilePath: "main.go", Lines: []string{"package main"}}
+
+	eng.statsRequestSent(req)
+	clock.Advance(80 * time.Millisecond)
+	eng.qualityResponse(completionWith("b"))
+
+	eng.statsRequestSent(req)
+	eng.handleEvent(Event{Type: EventCompletionError, Data: errors.New("boom")})
+
+	zeta := eng.Stats().Providers["zeta"]
+	assert.Equal(t, 2, zeta.Requests, "requests")
+	assert.Equal(t, 1, zeta.Errors, "errors")
+	assert.Equal(t, 2*estimateRequestTokens(req), zeta.TokensSent, "tokens sent")
+	assert.Equal(t, int64(80), zeta.LatencyP50Ms, "latency")
+}
+
+func TestStats_AnnotatesCompletionsWithProviderModelAndLatency(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"x := 1"}
+	clock := newMockClock()
+	eng := createTestEngine(buf, newMockProvider(), clock)
+	eng.SetProviderName(func() string { return "sweep" })
+	eng.SetModelName(func() string { return "sweep-next-edit" })
+
+	eng.statsRequestSent(&types.CompletionRequest{FilePath: "main.go", Lines: buf.lines})
+	clock.Advance(230 * time.Millisecond)
+	resp := &types.CompletionResponse{Completions: []*types.Completion{
+		{StartLine: 1, EndLineInc: 1, Lines: []string{"x := 10"}},
+	}}
+	eng.handleCompletionReadyImpl(resp)
+
+	want := &types.Annotation{Provider: "sweep", Model: "sweep-next-edit", Latency: 230 * time.Millisecond}
+	assert.Equal(t, want, resp.Annotation, "response annotation")
+	assert.Equal(t, want, buf.annotation, "annotation sent to the buffer")
+
+	eng.handleEvent(Event{Type: EventEsc})
+	model := eng.Stats().Models["sweep/sweep-next-edit"]
+	assert.Equal(t, metrics.ModelStats{Shown: 1, Rejected: 1}, model, "per-model stats")
+}
@@ -0,0 +1,38 @@
+package engine
+
+import "cursortab/logger"
+
+// stickCompletion keeps the shown completion when the cursor moves in normal
+// mode to within StickyLines of it, instead of rejecting it. The completion is
+// dimmed while the cursor is off its lines and shown as before once the
+// cursor is back. Returns false when the completion should be rejected.
+func (e *Engine) stickCompletion() bool {
+	if e.config.StickyLines <= 0 || e.inInsertMode || len(e.completions) == 0 {
+		return false
+	}
+	e.syncBuffer()
+	if len(e.completions) == 0 {
+		return false
+	}
+
+	c := e.completions[0]
+	end := max(c.EndLineInc, c.StartLine+len(c.Lines)-1)
+	row := e.buffer.Row()
+	distance := 0
+	if row < c.StartLine {
+		distance = c.StartLine - row
+	} else if row > end {
+		distance = row - end
+	}
+	if distance > e.config.StickyLines {
+		return false
+	}
+
+	if dimmed := distance > 0; dimmed != e.completionDimmed {
+		e.completionDimmed = dimmed
+		if err := e.buffer.DimCompletion(dimmed); err != nil {
+			logger.Warn("sticky completion: %v", err)
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"cursortab/assert"
+	"cursortab/types"
+	"testing"
+)
+
+func stickyEngine(buf *mockBuffer, prov *mockProvider) *Engine {
+	eng := createTestEngine(buf, prov, newMockClock())
+	eng.config.StickyLines = 3
+	eng.state = stateHasCompletion
+	eng.completions = []*types.Completion{{StartLine: 5, EndLineInc: 6, Lines: []string{"a", "b"}}}
+	return eng
+}
+
+func TestStickyCompletion_DimmedNearbyAndRestoredOnReturn(t *testing.T) {
+	buf := newMockBuffer()
+	buf.row = 5
+	prov := newMockProvider()
+	eng := stickyEngine(buf, prov)
+
+	buf.row = 9
+	eng.handleEvent(Event{Type: EventCursorMoved})
+	assert.Equal(t, stateHasCompletion, eng.state, "completion kept within sticky lines")
+	assert.True(t, buf.dimmed, "dimmed while cursor is off it")
+	assert.Equal(t, 0, buf.clearUICalls, "UI kept")
+
+	buf.row = 6
+	eng.handleEvent(Event{Type: EventCursorMoved})
+	assert.Equal(t, stateHasCompletion, eng.state, "completion kept on return")
+	assert.False(t, buf.dimmed, "restored on return")
+	assert.Equal(t, 0, prov.completionCalls, "no refetch")
+}
+
+func TestStickyCompletion_RejectedBeyondStickyLines(t *testing.T) {
+	buf := newMockBuffer()
+	eng := stickyEngine(buf, newMockProvider())
+
+	buf.row = 1
+	eng.handleEvent(Event{Type: EventCursorMoved})
+	assert.Equal(t, stateIdle, eng.state, "rejected past sticky lines")
+	assert.False(t, eng.completionDimmed, "dim state cleared")
+}
+
+func TestStickyCompletion_InsertModeRejects(t *testing.T) {
+	buf := newMockBuffer()
+	eng := stickyEngine(buf, newMockProvider())
+	eng.inInsertMode = true
+
+	buf.row = 7
+	eng.handleEvent(Event{Type: EventCursorMoved})
+	assert.Equal(t, stateIdle, eng.state, "insert mode cursor moves reject")
+}
+
+func TestStickyCompletion_DisabledRejects(t *testing.T) {
+	buf := newMockBuffer()
+	eng := stickyEngine(buf, newMockProvider())
+	eng.config.StickyLines = 0
+
+	buf.row = 6
+	eng.handleEvent(Event{Type: EventCursorMoved})
+	assert.Equal(t, stateIdle, eng.state, "cursor moves reject without sticky lines")
+}
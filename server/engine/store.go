@@ -0,0 +1,283 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"cursortab/logger"
+	"cursortab/types"
+)
+
+const (
+	// CacheStoreMaxAge is how old a persisted entry may be before it is dropped.
+	CacheStoreMaxAge = 7 * 24 * time.Hour
+
+	// CacheStoreMaxBytes caps the size of a persisted cache file. The oldest
+	// entries are dropped first when it is exceeded.
+	CacheStoreMaxBytes = 4 << 20
+)
+
+// CacheStore persists the response cache, per-file edit state and recent user
+// actions between sessions, so a restart in the same workspace starts warm.
+type CacheStore interface {
+	Load() (*CacheSnapshot, error)
+	Save(snapshot *CacheSnapshot) error
+}
+
+// CacheSnapshot is the engine state kept by a CacheStore.
+type CacheSnapshot struct {
+	Responses   []CachedResponse      // Oldest first
+	Files       map[string]*FileState // Keyed by workspace-relative path
+	UserActions []*types.UserAction   // Oldest first
+}
+
+// CachedResponse is one persisted response cache entry.
+type CachedResponse struct {
+	Key      uint64
+	Response *types.CompletionResponse
+	StoredAt time.Time
+}
+
+// cacheRecord is one line of a JSONLCacheStore file.
+type cacheRecord struct {
+	Response *CachedResponse   `json:"response,omitempty"`
+	Path     string            `json:"path,omitempty"`
+	File     *FileState        `json:"file,omitempty"`
+	Action   *types.UserAction `json:"action,omitempty"`
+}
+
+// time returns when the record was last written to by the engine.
+func (r *cacheRecord) time() time.Time {
+	switch {
+	case r.Response != nil:
+		return r.Response.StoredAt
+	case r.Action != nil:
+		return time.UnixMilli(r.Action.TimestampMs)
+	}
+	return time.Unix(0, r.File.LastAccessNs)
+}
+
+// JSONLCacheStore keeps a CacheSnapshot in a JSON-lines file, one record per
+// cached response, file or user action. Records older than maxAge are dropped on load, and
+// the oldest records are dropped on save once the file would exceed maxBytes.
+type JSONLCacheStore struct {
+	path     string
+	maxAge   time.Duration
+	maxBytes int
+	clock    Clock
+}
+
+// NewJSONLCacheStore creates a store backed by the file at path.
+func NewJSONLCacheStore(path string, maxAge time.Duration, maxBytes int, clock Clock) *JSONLCacheStore {
+	return &JSONLCacheStore{path: path, maxAge: maxAge, maxBytes: maxBytes, clock: clock}
+}
+
+// CacheStorePath returns the cache file for a workspace under dir.
+func CacheStorePath(dir, workspacePath string) string {
+	h := fnv.New64a()
+	h.Write([]byte(workspacePath))
+	return filepath.Join(dir, fmt.Sprintf("%s-%016x.jsonl", filepath.Base(workspacePath), h.Sum64()))
+}
+
+// Load implements CacheStore. A missing file yields an empty snapshot, and
+// unreadable records are skipped.
+func (s *JSONLCacheStore) Load() (*CacheSnapshot, error) {
+	snapshot := &CacheSnapshot{Files: make(map[string]*FileState)}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return snapshot, nil
+		}
+		return nil, err
+	}
+
+	cutoff := s.clock.Now().Add(-s.maxAge)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, s.maxBytes+1)
+	for scanner.Scan() {
+		var rec cacheRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			logger.Debug("cache store: skipping bad record: %v", err)
+			continue
+		}
+		if (rec.Response == nil && rec.File == nil && rec.Action == nil) || rec.time().Before(cutoff) {
+			continue
+		}
+		switch {
+		case rec.Response != nil:
+			snapshot.Responses = append(snapshot.Responses, *rec.Response)
+		case rec.Action != nil:
+			snapshot.UserActions = append(snapshot.UserActions, rec.Action)
+		default:
+			snapshot.Files[rec.Path] = rec.File
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(snapshot.Responses, func(i, j int) bool {
+		return snapshot.Responses[i].StoredAt.Before(snapshot.Responses[j].StoredAt)
+	})
+	sort.SliceStable(snapshot.UserActions, func(i, j int) bool {
+		return snapshot.UserActions[i].TimestampMs < snapshot.UserActions[j].TimestampMs
+	})
+	return snapshot, nil
+}
+
+// Save implements CacheStore. The file is replaced atomically.
+func (s *JSONLCacheStore) Save(snapshot *CacheSnapshot) error {
+	var records []cacheRecord
+	for i := range snapshot.Responses {
+		records = append(records, cacheRecord{Response: &snapshot.Responses[i]})
+	}
+	for path, state := range snapshot.Files {
+		records = append(records, cacheRecord{Path: path, File: state})
+	}
+	for _, action := range snapshot.UserActions {
+		records = append(records, cacheRecord{Action: action})
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].time().After(records[j].time())
+	})
+
+	var buf bytes.Buffer
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if buf.Len()+len(line)+1 > s.maxBytes {
+			break
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// SetCacheStore restores the session from store, and saves it back there
+// when the engine stops.
+func (e *Engine) SetCacheStore(store CacheStore) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.store = store
+	e.loadSession()
+}
+
+// LoadSession restores the response cache, per-file edit state, recent
+// buffer snapshots and user actions saved by the last session in this
+// workspace. It does nothing without a CacheStore.
+func (e *Engine) LoadSession() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.loadSession()
+}
+
+// SaveSession writes the session to the CacheStore, so a restart picks up
+// where the editor left off. It does nothing without a CacheStore.
+func (e *Engine) SaveSession() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.saveSession()
+}
+
+func (e *Engine) loadSession() {
+	if e.store == nil {
+		return
+	}
+	snapshot, err := e.store.Load()
+	if err != nil {
+		logger.Warn("cache store: load failed: %v", err)
+		return
+	}
+
+	e.cache.restore(snapshot.Responses, e.config.CacheMaxEntries)
+	for path, state := range snapshot.Files {
+		if _, ok := e.fileStateStore[path]; !ok && !e.ignore.Match(path) {
+			e.fileStateStore[path] = state
+		}
+	}
+	e.trimFileStateStore(3)
+	e.restoreUserActions(snapshot.UserActions)
+	logger.Info("cache store: restored %d responses, %d files and %d user actions",
+		len(snapshot.Responses), len(snapshot.Files), len(snapshot.UserActions))
+}
+
+// restoreUserActions puts saved actions before the ones recorded since the
+// engine started, keeping the most recent MaxUserActions of each project.
+func (e *Engine) restoreUserActions(saved []*types.UserAction) {
+	if e.contextLimits.MaxUserActions < 0 {
+		return
+	}
+	restored := make(map[string][]*types.UserAction)
+	for _, a := range saved {
+		if !e.ignore.Match(a.FilePath) {
+			root := e.rootOf(a.FilePath)
+			restored[root] = append(restored[root], a)
+		}
+	}
+	for root, actions := range restored {
+		actions = append(actions, e.userActions[root]...)
+		if len(actions) > e.contextLimits.MaxUserActions {
+			actions = actions[len(actions)-e.contextLimits.MaxUserActions:]
+		}
+		e.userActions[root] = actions
+	}
+}
+
+// saveSession writes the response cache, per-file edit state and user actions
+// to the store. Open buffers without edit state are saved by their first
+// lines, so they are still offered as recent buffer snapshots after a restart.
+func (e *Engine) saveSession() error {
+	if e.store == nil {
+		return nil
+	}
+	e.saveCurrentFileState()
+
+	files := make(map[string]*FileState, len(e.fileStateStore)+len(e.openBuffers))
+	for path, buf := range e.openBuffers {
+		files[path] = &FileState{
+			FirstLines:   copyFirstN(buf.lines, e.contextLimits.FileChunkLines),
+			LastAccessNs: buf.accessNs,
+		}
+	}
+	maps.Copy(files, e.fileStateStore)
+
+	var actions []*types.UserAction
+	for _, projectActions := range e.userActions {
+		actions = append(actions, projectActions...)
+	}
+	slices.SortStableFunc(actions, func(a, b *types.UserAction) int {
+		return cmp.Compare(a.TimestampMs, b.TimestampMs)
+	})
+
+	return e.store.Save(&CacheSnapshot{
+		Responses:   e.cache.snapshot(),
+		Files:       files,
+		UserActions: actions,
+	})
+}
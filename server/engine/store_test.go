@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+type memoryCacheStore struct {
+	loaded *CacheSnapshot
+	saved  *CacheSnapshot
+}
+
+func (s *memoryCacheStore) Load() (*CacheSnapshot, error) { return s.loaded, nil }
+
+func (s *memoryCacheStore) Save(snapshot *CacheSnapshot) error {
+	s.saved = snapshot
+	return nil
+}
+
+func TestJSONLCacheStore_RoundTrip(t *testing.T) {
+	clock := newMockClock()
+	path := filepath.Join(t.TempDir(), "cache", "ws.jsonl")
+	store := NewJSONLCacheStore(path, time.Hour, 1<<20, clock)
+
+	now := clock.Now()
+	err := store.Save(&CacheSnapshot{
+		Responses: []CachedResponse{
+			{Key: 1, Response: completionWith("one"), StoredAt: now.Add(-2 * time.Minute)},
+			{Key: 2, Response: completionWith("two"), StoredAt: now.Add(-time.Minute)},
+		},
+		Files: map[string]*FileState{
+			"main.go": {
+				OriginalLines: []string{"a"},
+				DiffHistories: []*types.DiffEntry{{Original: "a", Updated: "b"}},
+				LastAccessNs:  now.UnixNano(),
+			},
+		},
+	})
+	assert.NoError(t, err, "Save")
+
+	snapshot, err := store.Load()
+	assert.NoError(t, err, "Load")
+	assert.Len(t, 2, snapshot.Responses, "responses")
+	assert.Equal(t, uint64(1), snapshot.Responses[0].Key, "oldest response first")
+	assert.Equal(t, "two", snapshot.Responses[1].Response.Completions[0].Lines[0], "response content")
+	assert.NotNil(t, snapshot.Files["main.go"], "file state")
+	assert.Equal(t, "b", snapshot.Files["main.go"].DiffHistories[0].Updated, "diff history")
+}
+
+func TestJSONLCacheStore_MissingFile(t *testing.T) {
+	store := NewJSONLCacheStore(filepath.Join(t.TempDir(), "none.jsonl"), time.Hour, 1<<20, newMockClock())
+
+	snapshot, err := store.Load()
+
+	assert.NoError(t, err, "Load")
+	assert.Len(t, 0, snapshot.Responses, "responses")
+	assert.Len(t, 0, snapshot.Files, "files")
+}
+
+func TestJSONLCacheStore_DropsOldEntries(t *testing.T) {
+	clock := newMockClock()
+	store := NewJSONLCacheStore(filepath.Join(t.TempDir(), "ws.jsonl"), time.Hour, 1<<20, clock)
+	now := clock.Now()
+
+	store.Save(&CacheSnapshot{
+		Responses: []CachedResponse{
+			{Key: 1, Response: completionWith("old"), StoredAt: now.Add(-2 * time.Hour)},
+			{Key: 2, Response: completionWith("new"), StoredAt: now},
+		},
+		Files: map[string]*FileState{
+			"old.go": {LastAccessNs: now.Add(-2 * time.Hour).UnixNano()},
+		},
+	})
+
+	snapshot, err := store.Load()
+
+	assert.NoError(t, err, "Load")
+	assert.Len(t, 1, snapshot.Responses, "responses")
+	assert.Equal(t, uint64(2), snapshot.Responses[0].Key, "recent response kept")
+	assert.Len(t, 0, snapshot.Files, "old file dropped")
+}
+
+func TestJSONLCacheStore_SizeCapKeepsNewest(t *testing.T) {
+	clock := newMockClock()
+	path := filepath.Join(t.TempDir(), "ws.jsonl")
+	store := NewJSONLCacheStore(path, time.Hour, 300, clock)
+	now := clock.Now()
+
+	var responses []CachedResponse
+	for i := range 10 {
+		responses = append(responses, CachedResponse{
+			Key:      uint64(i),
+			Response: completionWith("response"),
+			StoredAt: now.Add(time.Duration(i) * time.Second),
+		})
+	}
+	assert.NoError(t, store.Save(&CacheSnapshot{Responses: responses}), "Save")
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err, "stat")
+	assert.LessOrEqual(t, int(info.Size()), 300, "file size")
+
+	snapshot, _ := store.Load()
+	assert.Greater(t, len(snapshot.Responses), 0, "some responses kept")
+	assert.Equal(t, uint64(9), snapshot.Responses[len(snapshot.Responses)-1].Key, "newest response kept")
+}
+
+func TestSetCacheStore_RestoresAndSavesOnStop(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b"}
+	clock := newMockClock()
+	eng := createTestEngine(buf, newMockProvider(), clock)
+	eng.config.CacheTTL = time.Second
+	eng.config.CacheMaxEntries = 4
+
+	resp := completionWith("restored")
+	resp.MetricsInfo = &types.MetricsInfo{ID: "old-session"}
+	store := &memoryCacheStore{loaded: &CacheSnapshot{
+		Responses: []CachedResponse{{Key: 7, Response: resp, StoredAt: clock.Now().Add(-time.Hour)}},
+		Files: map[string]*FileState{
+			"other.go": {OriginalLines: []string{"x"}, LastAccessNs: clock.Now().UnixNano()},
+		},
+	}}
+
+	eng.SetCacheStore(store)
+
+	assert.Equal(t, resp, eng.cache.get(7, clock.Now(), eng.config.CacheTTL), "restored response ignores ttl")
+	assert.NotNil(t, eng.fileStateStore["other.go"], "restored file state")
+
+	eng.Stop()
+
+	assert.NotNil(t, store.saved, "saved on stop")
+	assert.Len(t, 1, store.saved.Responses, "saved responses")
+	assert.Nil(t, store.saved.Responses[0].Response.MetricsInfo, "metrics id dropped")
+	assert.NotNil(t, store.saved.Files["test.go"], "current buffer state saved")
+	assert.NotNil(t, store.saved.Files["other.go"], "restored file state saved")
+}
+
+func TestJSONLCacheStore_RoundTripsUserActions(t *testing.T) {
+	clock := newMockClock()
+	store := NewJSONLCacheStore(filepath.Join(t.TempDir(), "ws.jsonl"), time.Hour, 1<<20, clock)
+	now := clock.Now().UnixMilli()
+
+	err := store.Save(&CacheSnapshot{UserActions: []*types.UserAction{
+		{ActionType: types.ActionInsertChar, FilePath: "a.go", LineNumber: 3, TimestampMs: now - 1000},
+		{ActionType: types.ActionCursorMovement, FilePath: "b.go", LineNumber: 8, TimestampMs: now},
+		{ActionType: types.ActionInsertChar, FilePath: "a.go", TimestampMs: now - 2*time.Hour.Milliseconds()},
+	}})
+	assert.NoError(t, err, "Save")
+
+	snapshot, err := store.Load()
+	assert.NoError(t, err, "Load")
+	assert.Len(t, 2, snapshot.UserActions, "expired action dropped")
+	assert.Equal(t, "a.go", snapshot.UserActions[0].FilePath, "oldest action first")
+	assert.Equal(t, 8, snapshot.UserActions[1].LineNumber, "action content")
+}
+
+func TestSaveSession_IncludesUserActionsAndOpenBuffers(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b"}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	store := &memoryCacheStore{loaded: &CacheSnapshot{}}
+	eng.SetCacheStore(store)
+
+	eng.recordUserAction(&types.UserAction{ActionType: types.ActionInsertChar, FilePath: "test.go"})
+	eng.applyBufferLines(BufferLines{Path: "open.go", LastLine: -1, Lines: []string{"package open"}})
+
+	assert.NoError(t, eng.SaveSession(), "SaveSession")
+
+	assert.Len(t, 1, store.saved.UserActions, "user actions saved")
+	assert.NotNil(t, store.saved.Files["open.go"], "open buffer saved")
+	assert.Equal(t, "package open", store.saved.Files["open.go"].FirstLines[0], "open buffer snapshot")
+	assert.NotNil(t, store.saved.Files["test.go"], "current buffer state saved")
+}
+
+func TestLoadSession_KeepsNewerUserActions(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+	eng.contextLimits.MaxUserActions = 2
+	eng.recordUserAction(&types.UserAction{FilePath: "new.go"})
+	eng.store = &memoryCacheStore{loaded: &CacheSnapshot{UserActions: []*types.UserAction{
+		{FilePath: "old1.go"},
+		{FilePath: "old2.go"},
+	}}}
+
+	eng.LoadSession()
+
+	actions := eng.userActions[eng.rootOf("new.go")]
+	assert.Len(t, 2, actions, "capped at MaxUserActions")
+	assert.Equal(t, "old2.go", actions[0].FilePath, "most recent saved action kept")
+	assert.Equal(t, "new.go", actions[1].FilePath, "action from this session kept last")
+}
@@ -1,27 +1,34 @@
 package engine
 
 import (
-	"context"
+	"slices"
+	"strings"
 
+	"cursortab/logger"
+	"cursortab/quality"
 	"cursortab/text"
 	"cursortab/types"
 	"cursortab/utils"
 )
 
-// requestStreamingCompletion handles line-by-line streaming completions
-func (e *Engine) requestStreamingCompletion(provider LineStreamProvider, req *types.CompletionRequest) {
+// requestStreamingCompletion handles line-by-line streaming completions. key
+// is the cache key the final response is stored under.
+func (e *Engine) requestStreamingCompletion(provider LineStreamProvider, req *types.CompletionRequest, key uint64) {
 	e.state = stateStreamingCompletion
 
-	ctx, cancel := context.WithTimeout(e.mainCtx, e.config.CompletionTimeout)
+	ctx, cancel := e.requestContext()
 	e.streamingCancel = cancel
 
 	// Prepare the stream
-	stream, providerCtx, err := provider.PrepareLineStream(ctx, req)
+	sent, secrets := e.redactRequest(req)
+	stream, providerCtx, err := provider.PrepareLineStream(ctx, sent)
 	if err != nil {
 		cancel()
+		e.requestFailed(err)
 		e.state = stateIdle
 		return
 	}
+	stream = revealStream(ctx, stream, secrets)
 
 	// Get old lines for incremental diff building.
 	// Extract trim info from provider context if available.
@@ -30,7 +37,7 @@ func (e *Engine) requestStreamingCompletion(provider LineStreamProvider, req *ty
 	if tc, ok := providerCtx.(TrimmedContext); ok && len(tc.GetTrimmedLines()) > 0 {
 		// Provider trimmed the content - use trimmed lines and offset
 		windowStart = tc.GetWindowStart()
-		oldLines = tc.GetTrimmedLines()
+		oldLines = secrets.RevealLines(tc.GetTrimmedLines())
 	} else {
 		// No trimming - use full buffer
 		oldLines = req.Lines
@@ -38,21 +45,27 @@ func (e *Engine) requestStreamingCompletion(provider LineStreamProvider, req *ty
 
 	viewportTop, viewportBottom := e.buffer.ViewportBounds()
 
+	stageBuilder := text.NewIncrementalStageBuilder(
+		oldLines,
+		windowStart+1, // baseLineOffset (1-indexed)
+		e.config.CursorPrediction.ProximityThreshold,
+		e.stageLineLimit(e.config.MaxVisibleLines),
+		viewportTop,
+		viewportBottom,
+		e.buffer.Row(),
+		e.buffer.Col(),
+		req.FilePath,
+	)
+	stageBuilder.Scopes = e.scopes
+	stageBuilder.Order = e.config.StageOrder
+
 	// Initialize streaming state
 	e.streamingState = &StreamingState{
-		StageBuilder: text.NewIncrementalStageBuilder(
-			oldLines,
-			windowStart+1, // baseLineOffset (1-indexed)
-			e.config.CursorPrediction.ProximityThreshold,
-			e.config.MaxVisibleLines,
-			viewportTop,
-			viewportBottom,
-			e.buffer.Row(),
-			e.buffer.Col(),
-			req.FilePath,
-		),
+		StageBuilder:    stageBuilder,
 		ProviderContext: providerCtx,
+		Secrets:         secrets,
 		Request:         req,
+		CacheKey:        key,
 	}
 
 	// Set stream channel directly - event loop will select on it
@@ -60,20 +73,24 @@ func (e *Engine) requestStreamingCompletion(provider LineStreamProvider, req *ty
 	e.streamLineNum = 0
 }
 
-// requestTokenStreamingCompletion handles token-by-token streaming completions (inline)
-func (e *Engine) requestTokenStreamingCompletion(provider TokenStreamProvider, req *types.CompletionRequest) {
+// requestTokenStreamingCompletion handles token-by-token streaming completions
+// (inline). key is the cache key the final response is stored under.
+func (e *Engine) requestTokenStreamingCompletion(provider TokenStreamProvider, req *types.CompletionRequest, key uint64) {
 	e.state = stateStreamingCompletion
 
-	ctx, cancel := context.WithTimeout(e.mainCtx, e.config.CompletionTimeout)
+	ctx, cancel := e.requestContext()
 	e.streamingCancel = cancel
 
 	// Prepare the stream
-	stream, providerCtx, err := provider.PrepareTokenStream(ctx, req)
+	sent, secrets := e.redactRequest(req)
+	stream, providerCtx, err := provider.PrepareTokenStream(ctx, sent)
 	if err != nil {
 		cancel()
+		e.requestFailed(err)
 		e.state = stateIdle
 		return
 	}
+	stream = revealStream(ctx, stream, secrets)
 
 	// Get line prefix (text before cursor on current line)
 	linePrefix := ""
@@ -87,7 +104,9 @@ func (e *Engine) requestTokenStreamingCompletion(provider TokenStreamProvider, r
 	e.tokenStreamingState = &TokenStreamingState{
 		AccumulatedText: "",
 		ProviderContext: providerCtx,
+		Secrets:         secrets,
 		Request:         req,
+		CacheKey:        key,
 		LinePrefix:      linePrefix,
 		LineNum:         req.CursorRow,
 	}
@@ -159,7 +178,7 @@ func (e *Engine) handleStreamLine(line string) {
 	// First line validation
 	if !ss.Validated {
 		if sp, ok := e.provider.(LineStreamProvider); ok {
-			if err := sp.ValidateFirstLine(ss.ProviderContext, line); err != nil {
+			if err := sp.ValidateFirstLine(ss.ProviderContext, ss.Secrets.Hide(line)); err != nil {
 				e.cancelStreaming()
 				e.state = stateIdle
 				return
@@ -176,22 +195,12 @@ func (e *Engine) handleStreamLine(line string) {
 
 	// Process pending line through stage builder (if any)
 	if ss.HasPendingLine {
-		finalized := ss.StageBuilder.AddLine(ss.PendingLine)
-		if finalized != nil && !ss.FirstStageRendered {
-			// Check if this stage is close enough to render immediately
-			viewportTop, viewportBottom := e.buffer.ViewportBounds()
-			needsNav := text.StageNeedsNavigation(
-				finalized,
-				e.buffer.Row(),
-				viewportTop, viewportBottom,
-				e.config.CursorPrediction.ProximityThreshold,
-			)
-			if !needsNav {
-				// Stage is close to cursor - render it immediately
-				e.renderStreamedStage(finalized)
-				ss.FirstStageRendered = true
-			}
-			// If needsNav, don't render - let Finalize() handle it with cursor prediction
+		e.addStreamedLine(ss, ss.PendingLine)
+		if e.dropsOversized() && ss.StageBuilder.ChangedLines() > e.config.MaxCompletionLines {
+			logger.Debug("stream over max_completion_lines %d dropped", e.config.MaxCompletionLines)
+			e.cancelStreaming()
+			e.reject()
+			return
 		}
 	}
 
@@ -200,12 +209,121 @@ func (e *Engine) handleStreamLine(line string) {
 	ss.HasPendingLine = true
 }
 
+// addStreamedLine passes a line to the stage builder, renders the first
+// finalized stage if it is close to the cursor and pushes every finalized
+// stage to the editor, so the rest of the completion can be previewed while
+// the model is still generating it.
+func (e *Engine) addStreamedLine(ss *StreamingState, line string) {
+	finalized := ss.StageBuilder.AddLine(line)
+	if finalized == nil {
+		return
+	}
+	ss.StagesStreamed++
+	shown := !ss.FirstStageRendered && e.renderIfClose(ss, finalized)
+	if err := e.buffer.StreamStage(finalized, ss.StagesStreamed, shown); err != nil {
+		logger.Warn("streamed stage: %v", err)
+	}
+}
+
+// renderIfClose renders the first finalized stage if it is close to the
+// cursor, and reports whether it did.
+func (e *Engine) renderIfClose(ss *StreamingState, finalized *text.Stage) bool {
+	// Check if this stage is close enough to render immediately
+	viewportTop, viewportBottom := e.buffer.ViewportBounds()
+	needsNav := text.StageNeedsNavigation(
+		finalized,
+		e.buffer.Row(),
+		viewportTop, viewportBottom,
+		e.config.CursorPrediction.ProximityThreshold,
+	)
+	if needsNav {
+		// Let Finalize() handle it with cursor prediction
+		return false
+	}
+	// Stage is close to cursor - render it immediately
+	e.renderStreamedStage(finalized)
+	ss.FirstStageRendered = true
+	return true
+}
+
+// salvageLineStream keeps a line stream alive after the user typed text it
+// had already streamed. The stage builder is re-anchored on the current
+// buffer and the streamed lines are replayed through it, so the stages only
+// hold what is left to type. Returns false, leaving the stream untouched, when
+// the buffer no longer matches the streamed lines or its line count changed.
+func (e *Engine) salvageLineStream() bool {
+	ss := e.streamingState
+	if ss == nil || ss.StageBuilder == nil || ss.Request == nil || ss.AccumulatedText.Len() == 0 || e.acceptedDuringStreaming {
+		return false
+	}
+
+	e.syncBuffer()
+	bufferLines := e.buffer.Lines()
+	sb := ss.StageBuilder
+	start := sb.BaseLineOffset - 1
+	if len(bufferLines) != len(ss.Request.Lines) || start < 0 || start+len(sb.OldLines) > len(bufferLines) {
+		return false
+	}
+	window := bufferLines[start : start+len(sb.OldLines)]
+
+	streamed := strings.Split(strings.TrimSuffix(ss.AccumulatedText.String(), "\n"), "\n")
+	typed := false
+	for i, old := range sb.OldLines {
+		if window[i] == old {
+			continue
+		}
+		if i >= len(streamed) || !strings.HasPrefix(streamed[i], window[i]) {
+			return false
+		}
+		typed = true
+	}
+	if !typed {
+		return false
+	}
+
+	if ss.FirstStageRendered {
+		e.buffer.ClearUI()
+		e.completions = nil
+		e.completionOriginalLines = nil
+		e.currentGroups = nil
+		e.cursorTarget = nil
+		ss.FirstStageRendered = false
+	}
+
+	viewportTop, viewportBottom := e.buffer.ViewportBounds()
+	rebuilt := text.NewIncrementalStageBuilder(
+		slices.Clone(window),
+		sb.BaseLineOffset,
+		sb.ProximityThreshold,
+		sb.MaxVisibleLines,
+		viewportTop,
+		viewportBottom,
+		e.buffer.Row(),
+		e.buffer.Col(),
+		sb.FilePath,
+	)
+	rebuilt.Scopes = sb.Scopes
+	rebuilt.Order = sb.Order
+	ss.StageBuilder = rebuilt
+
+	// The pending line is still buffered and is added with the next one
+	replayed := streamed
+	if ss.HasPendingLine {
+		replayed = streamed[:len(streamed)-1]
+	}
+	for _, line := range replayed {
+		e.addStreamedLine(ss, line)
+	}
+	return true
+}
+
 // handleStreamCompleteSimple processes stream completion when lines channel closes.
 // Called directly from event loop.
 func (e *Engine) handleStreamCompleteSimple() {
 	// Clear stream channel first
 	e.streamLinesChan = nil
 	e.streamLineNum = 0
+	e.requestSucceeded()
 
 	if e.streamingState == nil {
 		return
@@ -219,7 +337,10 @@ func (e *Engine) handleStreamCompleteSimple() {
 		e.acceptedDuringStreaming = false
 		e.handleStreamCompleteAfterAccept(ss)
 		e.streamingState = nil
-		e.streamingCancel = nil
+		if e.streamingCancel != nil {
+			e.streamingCancel()
+			e.streamingCancel = nil
+		}
 		return
 	}
 
@@ -232,10 +353,16 @@ func (e *Engine) handleStreamCompleteSimple() {
 	}
 
 	// Log response via provider postprocessing (this also runs postprocessors)
+	var resp *types.CompletionResponse
 	sp, ok := e.provider.(LineStreamProvider)
 	if ok {
 		accumulatedText := ss.AccumulatedText.String()
-		_, _ = sp.FinishLineStream(ss.ProviderContext, accumulatedText, "stop", false)
+		var err error
+		resp, err = sp.FinishLineStream(ss.ProviderContext, ss.Secrets.Hide(accumulatedText), "stop", false)
+		revealResponse(resp, ss.Secrets)
+		if err == nil && resp != nil {
+			e.cache.put(ss.CacheKey, resp, e.clock.Now(), e.config.CacheMaxEntries)
+		}
 	}
 
 	// Finalize remaining stages
@@ -243,13 +370,46 @@ func (e *Engine) handleStreamCompleteSimple() {
 
 	// Clear streaming state
 	e.streamingState = nil
-	e.streamingCancel = nil
+	if e.streamingCancel != nil {
+		e.streamingCancel()
+		e.streamingCancel = nil
+	}
 
 	if stagingResult == nil || len(stagingResult.Stages) == 0 {
 		e.state = stateIdle
+		// Postprocessing can answer what the streamed lines did not show,
+		// such as the deletion of the window for an empty rewrite
+		if resp != nil && len(resp.Completions) > 0 {
+			e.handleCompletionReadyImpl(resp)
+			return
+		}
+		if resp == nil || !e.showCursorOnlyPrediction(resp) {
+			e.qualityResponse(nil)
+		} else {
+			e.qualityResponded(0)
+		}
 		return
 	}
 
+	resultLines := 0
+	for _, stage := range stagingResult.Stages {
+		resultLines += len(stage.Lines)
+	}
+	e.qualityResponded(resultLines)
+
+	sb := ss.StageBuilder
+	e.lastStaging = &stagingInput{
+		oldLines:       sb.OldLines,
+		newLines:       strings.Split(strings.TrimSuffix(ss.AccumulatedText.String(), "\n"), "\n"),
+		baseLineOffset: sb.BaseLineOffset,
+		cursorRow:      sb.CursorRow,
+		cursorCol:      sb.CursorCol,
+		viewportTop:    sb.ViewportTop,
+		viewportBottom: sb.ViewportBottom,
+		filePath:       sb.FilePath,
+		scopes:         sb.Scopes,
+		order:          sb.Order,
+	}
 	e.stagedCompletion = &text.StagedCompletion{
 		Stages:     stagingResult.Stages,
 		CurrentIdx: 0,
@@ -277,7 +437,7 @@ func (e *Engine) handleStreamCompleteSimple() {
 			ShouldRetrigger: false,
 		}
 		e.state = stateHasCursorTarget
-		e.buffer.ShowCursorTarget(firstStage.BufferStart)
+		e.showCursorTarget(firstStage.BufferStart)
 	} else {
 		e.showCurrentStage()
 	}
@@ -294,10 +454,11 @@ func (e *Engine) handleStreamCompleteAfterAccept(ss *StreamingState) {
 
 	// Run postprocessing to get completions from accumulated text
 	accumulatedText := ss.AccumulatedText.String()
-	resp, err := sp.FinishLineStream(ss.ProviderContext, accumulatedText, "stop", false)
+	resp, err := sp.FinishLineStream(ss.ProviderContext, ss.Secrets.Hide(accumulatedText), "stop", false)
 	if err != nil {
 		return
 	}
+	revealResponse(resp, ss.Secrets)
 
 	if resp == nil || len(resp.Completions) == 0 {
 		return
@@ -327,8 +488,7 @@ func (e *Engine) handleStreamCompleteAfterAccept(ss *StreamingState) {
 
 	if distance <= e.config.CursorPrediction.ProximityThreshold {
 		// Close enough - show completion
-		e.prefetchedCompletions = resp.Completions
-		e.prefetchedCursorTarget = resp.CursorTarget
+		e.setPrefetched(resp, e.buffer.Lines())
 		e.prefetchState = prefetchReady
 		e.tryShowPrefetchedCompletion()
 	} else {
@@ -339,11 +499,10 @@ func (e *Engine) handleStreamCompleteAfterAccept(ss *StreamingState) {
 			ShouldRetrigger: false,
 		}
 		// Store the completions for when user jumps to target
-		e.prefetchedCompletions = resp.Completions
-		e.prefetchedCursorTarget = resp.CursorTarget
+		e.setPrefetched(resp, e.buffer.Lines())
 		e.prefetchState = prefetchReady
 		e.state = stateHasCursorTarget
-		e.buffer.ShowCursorTarget(targetLine)
+		e.showCursorTarget(targetLine)
 	}
 }
 
@@ -353,6 +512,10 @@ func (e *Engine) renderStreamedStage(stage *text.Stage) {
 		return
 	}
 
+	if e.annotation == nil {
+		e.showAnnotation(e.responseAnnotation())
+	}
+
 	// Prepare completion for this stage and render it
 	e.applyBatch = e.buffer.PrepareCompletion(
 		stage.BufferStart,
@@ -403,16 +566,11 @@ func (e *Engine) handleTokenChunk(accumulatedText string) {
 	}
 
 	// Create a group with append_chars render hint
-	group := &text.Group{
-		Type:       "modification",
-		StartLine:  1,
-		EndLine:    1,
-		BufferLine: lineNum,
-		Lines:      []string{fullLineText},
-		OldLines:   []string{oldLine},
-		RenderHint: "append_chars",
-		ColStart:   colStart,
-		ColEnd:     len(fullLineText),
+	group := appendCharsGroup(lineNum, oldLine, fullLineText)
+	group.ColStart = colStart
+
+	if e.annotation == nil {
+		e.showAnnotation(e.responseAnnotation())
 	}
 
 	// Call PrepareCompletion to render the ghost text
@@ -435,6 +593,7 @@ func (e *Engine) handleTokenChunk(accumulatedText string) {
 func (e *Engine) handleTokenStreamComplete() {
 	// Clear token stream channel first
 	e.tokenStreamChan = nil
+	e.requestSucceeded()
 
 	if e.tokenStreamingState == nil {
 		e.state = stateIdle
@@ -448,10 +607,14 @@ func (e *Engine) handleTokenStreamComplete() {
 
 	// Clear token streaming state
 	e.tokenStreamingState = nil
-	e.streamingCancel = nil
+	if e.streamingCancel != nil {
+		e.streamingCancel()
+		e.streamingCancel = nil
+	}
 
 	// If empty, go idle
 	if finalText == "" {
+		e.qualityResponse(nil)
 		e.buffer.ClearUI()
 		e.state = stateIdle
 		return
@@ -465,12 +628,17 @@ func (e *Engine) handleTokenStreamComplete() {
 		return
 	}
 
-	resp, err := tokenProvider.FinishTokenStream(providerCtx, finalText)
+	resp, err := tokenProvider.FinishTokenStream(providerCtx, ts.Secrets.Hide(finalText))
 	if err != nil {
 		e.buffer.ClearUI()
 		e.state = stateIdle
 		return
 	}
+	revealResponse(resp, ts.Secrets)
+	if resp != nil {
+		e.cache.put(ts.CacheKey, resp, e.clock.Now(), e.config.CacheMaxEntries)
+	}
+	e.qualityResponse(resp)
 
 	// Process the response like a normal completion
 	if resp == nil || len(resp.Completions) == 0 {
@@ -493,6 +661,7 @@ func (e *Engine) handleTokenStreamComplete() {
 	if e.processCompletion(completion) {
 		e.state = stateHasCompletion
 	} else {
+		e.finishQuality(quality.OutcomeEmpty)
 		e.buffer.ClearUI()
 		e.state = stateIdle
 	}
@@ -1,9 +1,13 @@
 package engine
 
 import (
+	"context"
+	"testing"
+	"time"
+
 	"cursortab/assert"
+	"cursortab/text"
 	"cursortab/types"
-	"testing"
 )
 
 func TestTokenStreamingKeepPartial_TypingMatchesPartial(t *testing.T) {
@@ -159,3 +163,211 @@ func TestCancelTokenStreamingKeepPartial(t *testing.T) {
 	// And completionOriginalLines should be preserved
 	assert.NotNil(t, eng.completionOriginalLines, "completionOriginalLines after cancel")
 }
+
+// startLineStream sets up a line stream over the buffer and feeds it lines.
+func startLineStream(eng *Engine, buf *mockBuffer, lines ...string) {
+	oldLines := append([]string(nil), buf.lines...)
+	eng.state = stateStreamingCompletion
+	eng.streamingState = &StreamingState{
+		StageBuilder: text.NewIncrementalStageBuilder(oldLines, 1, 3, 0, buf.viewportTop, buf.viewportBottom, buf.row, buf.col, buf.path),
+		Request:      &types.CompletionRequest{Lines: oldLines},
+	}
+	eng.streamLinesChan = make(chan string)
+	for _, line := range lines {
+		eng.handleStreamLine(line)
+	}
+}
+
+func TestLineStreamingSalvage_TypingStreamedPrefixKeepsStream(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b", "c"}
+	buf.row = 2
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	startLineStream(eng, buf, "a", "bar baz", "c")
+
+	buf.lines = []string{"a", "bar", "c"}
+	eng.doRejectStreamingAndDebounce(Event{Type: EventTextChanged})
+
+	assert.Equal(t, stateStreamingCompletion, eng.state, "state after typing streamed text")
+	assert.True(t, eng.streamLinesChan != nil, "stream kept alive")
+	assert.Equal(t, "bar", eng.streamingState.StageBuilder.OldLines[1], "builder re-anchored on typed line")
+
+	eng.handleStreamCompleteSimple()
+
+	assert.Equal(t, stateHasCompletion, eng.state, "state after stream completes")
+	assert.NotNil(t, eng.stagedCompletion, "staged completion")
+	stage := eng.stagedCompletion.Stages[0]
+	assert.Equal(t, 2, stage.BufferStart, "stage start")
+	assert.Equal(t, "bar baz", stage.Lines[0], "stage line")
+}
+
+func TestLineStreamingSalvage_RerendersFirstStage(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b", "c", "d", "e", "f", "g", "h", "i"}
+	buf.row = 2
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	startLineStream(eng, buf, "a", "bar", "c", "d", "e", "f", "g", "hh", "i")
+	assert.True(t, eng.streamingState.FirstStageRendered, "first stage rendered before typing")
+
+	buf.lines = []string{"a", "ba", "c", "d", "e", "f", "g", "h", "i"}
+	eng.doRejectStreamingAndDebounce(Event{Type: EventTextChanged})
+
+	assert.Equal(t, stateStreamingCompletion, eng.state, "state after typing streamed text")
+	assert.True(t, eng.streamingState.FirstStageRendered, "first stage rendered again")
+	assert.Equal(t, []string{"ba"}, eng.completionOriginalLines, "stage diffed against typed text")
+	assert.Greater(t, buf.clearUICalls, 0, "stale stage cleared")
+}
+
+func TestLineStreamingSalvage_MismatchCancels(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b", "c"}
+	buf.row = 2
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	startLineStream(eng, buf, "a", "bar baz", "c")
+
+	buf.lines = []string{"a", "bx", "c"}
+	eng.doRejectStreamingAndDebounce(Event{Type: EventTextChanged})
+
+	assert.Equal(t, stateIdle, eng.state, "state after typing other text")
+	assert.True(t, eng.streamLinesChan == nil, "stream cancelled")
+}
+
+func TestLineStreamingSalvage_LineCountChangeCancels(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b", "c"}
+	buf.row = 2
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	startLineStream(eng, buf, "a", "bar baz", "c")
+
+	buf.lines = []string{"a", "bar", "", "c"}
+	eng.doRejectStreamingAndDebounce(Event{Type: EventTextChanged})
+
+	assert.Equal(t, stateIdle, eng.state, "state after inserting a line")
+	assert.True(t, eng.streamLinesChan == nil, "stream cancelled")
+}
+
+func TestLineStreaming_PushesFinalizedStages(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n"}
+	buf.row = 2
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	startLineStream(eng, buf, "a", "bar", "c", "d", "e", "f", "g", "hh", "i", "j", "k", "l", "m", "n")
+
+	assert.Len(t, 2, buf.streamedStages, "stages pushed while streaming")
+	assert.Equal(t, 1, buf.streamedStages[0].index, "first index")
+	assert.True(t, buf.streamedStages[0].shown, "first stage shown")
+	assert.Equal(t, 2, buf.streamedStages[0].stage.BufferStart, "first stage start")
+	assert.Equal(t, 2, buf.streamedStages[1].index, "second index")
+	assert.False(t, buf.streamedStages[1].shown, "second stage only pushed")
+	assert.Equal(t, 8, buf.streamedStages[1].stage.BufferStart, "second stage start")
+	assert.Equal(t, 1, buf.prepareCompletionCalls, "only the first stage rendered")
+}
+
+// lineStreamProvider is a line streaming provider whose postprocessing
+// returns finish.
+type lineStreamProvider struct {
+	*mockProvider
+	finish *types.CompletionResponse
+}
+
+func (p *lineStreamProvider) GetStreamingType() int { return 1 }
+
+func (p *lineStreamProvider) PrepareLineStream(ctx context.Context, req *types.CompletionRequest) (LineStream, any, error) {
+	return &chanStream{lines: make(chan string)}, nil, nil
+}
+
+func (p *lineStreamProvider) ValidateFirstLine(providerCtx any, firstLine string) error { return nil }
+
+func (p *lineStreamProvider) FinishLineStream(providerCtx any, text string, finishReason string, stoppedEarly bool) (*types.CompletionResponse, error) {
+	return p.finish, nil
+}
+
+func TestLineStreaming_EmptyRewriteShowsDeletion(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b", "c"}
+	buf.row = 2
+	prov := &lineStreamProvider{
+		mockProvider: newMockProvider(),
+		finish: &types.CompletionResponse{Completions: []*types.Completion{{
+			StartLine:  1,
+			EndLineInc: 3,
+			Lines:      []string{},
+		}}},
+	}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.provider = prov
+	startLineStream(eng, buf)
+
+	eng.handleStreamCompleteSimple()
+
+	assert.Equal(t, stateHasCompletion, eng.state, "deletion shown")
+	assert.NotNil(t, eng.stagedCompletion, "staged completion")
+	assert.Len(t, 0, eng.stagedCompletion.Stages[0].Lines, "stage deletes the lines")
+}
+
+func TestLineStreaming_EmptyResponseGoesIdle(t *testing.T) {
+	buf := newMockBuffer()
+	prov := &lineStreamProvider{mockProvider: newMockProvider(), finish: &types.CompletionResponse{}}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.provider = prov
+	startLineStream(eng, buf, buf.lines...)
+
+	eng.handleStreamCompleteSimple()
+
+	assert.Equal(t, stateIdle, eng.state, "nothing shown")
+	assert.Nil(t, eng.stagedCompletion, "no staged completion")
+}
+
+// tokenStreamProvider is a token streaming provider whose postprocessing
+// returns finish.
+type tokenStreamProvider struct {
+	*mockProvider
+	finish *types.CompletionResponse
+}
+
+func (p *tokenStreamProvider) GetStreamingType() int { return 2 }
+
+func (p *tokenStreamProvider) PrepareTokenStream(ctx context.Context, req *types.CompletionRequest) (LineStream, any, error) {
+	return &chanStream{lines: make(chan string)}, nil, nil
+}
+
+func (p *tokenStreamProvider) FinishTokenStream(providerCtx any, text string) (*types.CompletionResponse, error) {
+	return p.finish, nil
+}
+
+func TestLineStreaming_CachesFinalResponse(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a", "b", "c"}
+	buf.row = 2
+	finish := &types.CompletionResponse{Completions: []*types.Completion{{StartLine: 1, EndLineInc: 3, Lines: []string{"a", "bar", "c"}}}}
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.provider = &lineStreamProvider{mockProvider: newMockProvider(), finish: finish}
+	eng.config.CacheTTL, eng.config.CacheMaxEntries = time.Minute, 8
+	startLineStream(eng, buf, "a", "bar", "c")
+	eng.streamingState.CacheKey = 42
+
+	eng.handleStreamCompleteSimple()
+
+	assert.True(t, eng.cache.get(42, eng.clock.Now(), eng.config.CacheTTL) == finish, "response cached")
+}
+
+func TestTokenStreaming_CachesFinalResponse(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"hello "}
+	finish := completionWith("hello world")
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+	eng.provider = &tokenStreamProvider{mockProvider: newMockProvider(), finish: finish}
+	eng.config.CacheTTL, eng.config.CacheMaxEntries = time.Minute, 8
+	eng.state = stateStreamingCompletion
+	eng.tokenStreamingState = &TokenStreamingState{
+		AccumulatedText: "world",
+		LinePrefix:      "hello ",
+		LineNum:         1,
+		Request:         &types.CompletionRequest{Lines: buf.lines},
+		CacheKey:        42,
+	}
+
+	eng.handleTokenStreamComplete()
+
+	assert.True(t, eng.cache.get(42, eng.clock.Now(), eng.config.CacheTTL) == finish, "response cached")
+}
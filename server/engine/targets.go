@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"context"
+	"slices"
+
+	"cursortab/logger"
+	"cursortab/metrics"
+	"cursortab/types"
+	"cursortab/utils"
+)
+
+// maxTargetPrefetch is how many of the predicted next-edit locations get a
+// completion requested ahead of the jump.
+const maxTargetPrefetch = 2
+
+// queuedTarget is a next-edit location predicted by the provider, waiting for
+// the user to Tab to it.
+type queuedTarget struct {
+	target     *types.CursorPredictionTarget
+	anchor     regionHash         // The target line and its neighbours, to follow edits above it
+	cancel     context.CancelFunc // Set once a completion was requested at the target
+	completion *types.Completion  // Prefetched at the target, nil until it arrives
+	region     regionHash         // Region of the buffer the prefetched completion replaces
+}
+
+// targetResult is the outcome of a completion request at a queued target.
+type targetResult struct {
+	queued *queuedTarget
+	lines  []string // Buffer content the request was built against
+	key    uint64   // Cache key of the request
+	resp   *types.CompletionResponse
+	err    error
+}
+
+// queueTargets replaces the queued locations with the targets in the current
+// file, in order, and prefetches the first maxTargetPrefetch of them.
+func (e *Engine) queueTargets(targets []*types.CursorPredictionTarget) {
+	e.dropTargets()
+	lines := e.buffer.Lines()
+	for _, target := range targets {
+		line := int(target.LineNumber)
+		if e.isOtherFile(target) || line < 1 || line > len(lines) {
+			continue
+		}
+		e.targetQueue = append(e.targetQueue, &queuedTarget{
+			target: target,
+			anchor: newRegionHash(lines, &types.Completion{StartLine: line, EndLineInc: line}),
+		})
+	}
+	e.prefetchTargets()
+}
+
+// dropTargets empties the queue and cancels its prefetches.
+func (e *Engine) dropTargets() {
+	for len(e.targetQueue) > 0 {
+		e.popTarget()
+	}
+}
+
+// popTarget takes the first location off the queue, cancelling its prefetch.
+func (e *Engine) popTarget() *queuedTarget {
+	queued := e.targetQueue[0]
+	e.targetQueue = e.targetQueue[1:]
+	if queued.cancel != nil {
+		queued.cancel()
+	}
+	return queued
+}
+
+// prefetchTargets requests completions at those of the first
+// maxTargetPrefetch queued locations not requested yet, against the buffer as
+// it is now. A response cached for the same context is used without a request.
+func (e *Engine) prefetchTargets() {
+	if e.stopped || e.bufferIneligible() {
+		return
+	}
+
+	lines := copyLines(e.buffer.Lines())
+	payload := e.payloadCap()
+	for _, queued := range e.targetQueue[:min(len(e.targetQueue), maxTargetPrefetch)] {
+		if queued.cancel != nil {
+			continue
+		}
+		row := int(queued.target.LineNumber)
+		req, ok := e.fitToBudget(e.finishRequest(e.requestAt(types.CompletionSourceTyping, row, 0)))
+		if !ok {
+			continue
+		}
+		req, ok = payload.apply(req)
+		if !ok {
+			continue
+		}
+		key := cacheKey(req)
+		if resp := e.cache.get(key, e.clock.Now(), e.config.CacheTTL); resp != nil {
+			logger.Debug("target prefetch: serving line %d from cache", row)
+			queued.cancel = func() {}
+			e.handleTargetResult(targetResult{queued: queued, lines: lines, key: key, resp: resp})
+			continue
+		}
+		if e.offline || !e.breakerAllows() {
+			return
+		}
+		if ok, _ := e.limiter.admit(e.clock.Now()); !ok {
+			logger.Debug("rate limit: skipping prefetch at target line %d", row)
+			break
+		}
+		e.budget.record(e.clock.Now(), estimateRequestTokens(req))
+		e.stats.RecordRequest(e.providerName(), estimateRequestTokens(req))
+		logger.Debug("target prefetch: requesting line %d", row)
+
+		ctx, cancel := e.requestContext()
+		queued.cancel = cancel
+		go func() {
+			defer cancel()
+
+			redacted, secrets := e.redactRequest(req)
+			resp, err := e.provider.GetCompletion(ctx, redacted)
+			if err == nil {
+				revealResponse(resp, secrets)
+			}
+			select {
+			case e.eventChan <- Event{Type: EventTargetPrefetchReady, Data: targetResult{queued: queued, lines: lines, key: key, resp: resp, err: err}}:
+			case <-e.mainCtx.Done():
+			}
+		}()
+	}
+}
+
+// handleTargetResult caches the response of a target prefetch and keeps its
+// completion if the target is still queued.
+func (e *Engine) handleTargetResult(result targetResult) {
+	if result.err != nil {
+		logger.Debug("target prefetch: %v", result.err)
+		return
+	}
+	e.cache.put(result.key, result.resp, e.clock.Now(), e.config.CacheMaxEntries)
+	queued := result.queued
+	if !slices.Contains(e.targetQueue, queued) {
+		return
+	}
+	current, _ := e.splitByFile(result.resp.Completions)
+	if len(current) == 0 {
+		return
+	}
+	queued.completion = current[0]
+	queued.region = newRegionHash(result.lines, queued.completion)
+}
+
+// showTargetCompletion shows the completion prefetched at the cursor target
+// just jumped to, taking it off the queue. Returns false when there is none,
+// or the lines it replaces were edited since it was requested.
+func (e *Engine) showTargetCompletion() bool {
+	if len(e.targetQueue) == 0 || e.targetQueue[0].target != e.cursorTarget {
+		return false
+	}
+	queued := e.popTarget()
+	if queued.completion == nil {
+		return false
+	}
+	comps, _, ok := rebaseCompletions([]*types.Completion{queued.completion}, []regionHash{queued.region}, e.buffer.Lines())
+	if !ok {
+		logger.Debug("target prefetch: buffer changed under the prefetched completion, dropping it")
+		return false
+	}
+	e.showAnnotation(e.untimedAnnotation())
+	return e.processCompletion(comps[0])
+}
+
+// skipTarget drops the predicted location the jump indicator points to and
+// shows the next one. Returns false when the indicator is not for a queued
+// location, or none is left.
+func (e *Engine) skipTarget() bool {
+	if e.state != stateHasCursorTarget || len(e.targetQueue) == 0 || e.targetQueue[0].target != e.cursorTarget {
+		return false
+	}
+	e.popTarget()
+	if e.awaitingOutcome() {
+		e.sendMetric(metrics.EventRejected)
+	}
+	e.buffer.ClearUI()
+	e.cursorTarget = nil
+	return e.showNextTarget()
+}
+
+// showNextTarget shows the jump indicator for the next queued location, once
+// the user is done with the previous one. Locations whose line was edited or
+// that are now next to the cursor are skipped. Returns false when the queue
+// is exhausted.
+func (e *Engine) showNextTarget() bool {
+	if !e.config.CursorPrediction.Enabled {
+		e.dropTargets()
+		return false
+	}
+	lines := e.buffer.Lines()
+	for len(e.targetQueue) > 0 {
+		queued := e.targetQueue[0]
+		offset, ok := queued.anchor.locate(lines)
+		line := int(queued.target.LineNumber) + offset
+		if !ok || line < 1 || line > len(lines) || utils.Abs(line-e.buffer.Row()) <= e.config.CursorPrediction.ProximityThreshold {
+			e.popTarget()
+			continue
+		}
+		queued.target.LineNumber = int32(line)
+		queued.anchor.start += offset
+		queued.anchor.end += offset
+		e.cursorTarget = queued.target
+		e.state = stateHasCursorTarget
+		e.showCursorTarget(line)
+		e.prefetchTargets()
+		return true
+	}
+	return false
+}
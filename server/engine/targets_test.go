@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func newTargetsEngine(t *testing.T, resp *types.CompletionResponse) (*Engine, *mockBuffer, *mockProvider) {
+	t.Helper()
+	buf := newMockBuffer()
+	buf.lines = make([]string, 30)
+	for i := range buf.lines {
+		buf.lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	buf.row = 1
+	prov := newMockProvider()
+	prov.completionResp = resp
+	eng, cancel := createTestEngineWithContext(buf, prov, newMockClock())
+	t.Cleanup(cancel)
+	eng.config.CursorPrediction.CursorOnly = true
+	return eng, buf, prov
+}
+
+// awaitTargetResults handles the results of n target prefetches.
+func awaitTargetResults(t *testing.T, eng *Engine, n int) {
+	t.Helper()
+	for range n {
+		select {
+		case event := <-eng.eventChan:
+			assert.Equal(t, EventTargetPrefetchReady, event.Type, "event type")
+			eng.handleEvent(event)
+		case <-time.After(time.Second):
+			t.Fatal("target prefetch did not complete")
+		}
+	}
+}
+
+func targetsResponse() *types.CompletionResponse {
+	return &types.CompletionResponse{
+		CursorTarget: &types.CursorPredictionTarget{LineNumber: 8},
+		NextTargets: []*types.CursorPredictionTarget{
+			{LineNumber: 15},
+			{LineNumber: 50},
+			{LineNumber: 12, RelativePath: "other.go"},
+			{LineNumber: 25},
+		},
+	}
+}
+
+func TestCompletionResponseTargets(t *testing.T) {
+	assert.Nil(t, (&types.CompletionResponse{}).Targets(), "no target")
+
+	resp := targetsResponse()
+	targets := resp.Targets()
+	assert.Len(t, 5, targets, "targets")
+	assert.Equal(t, resp.CursorTarget, targets[0], "cursor target first")
+	assert.Equal(t, int32(15), targets[1].LineNumber, "next targets in order")
+}
+
+func TestNextTargets_TabThroughLocations(t *testing.T) {
+	eng, buf, _ := newTargetsEngine(t, &types.CompletionResponse{})
+
+	eng.handleCompletionReadyImpl(targetsResponse())
+	awaitTargetResults(t, eng, 2)
+
+	assert.Len(t, 3, eng.targetQueue, "targets in this file and range queued")
+	assert.Equal(t, 8, buf.showCursorTargetLine, "first target shown")
+
+	eng.acceptCursorTarget()
+	assert.Equal(t, 8, buf.row, "cursor on first target")
+	assert.Equal(t, stateHasCursorTarget, eng.state, "next target pending")
+	assert.Equal(t, 15, buf.showCursorTargetLine, "second target shown")
+	awaitTargetResults(t, eng, 1)
+
+	eng.acceptCursorTarget()
+	assert.Equal(t, 15, buf.row, "cursor on second target")
+	assert.Equal(t, 25, buf.showCursorTargetLine, "third target shown")
+
+	eng.acceptCursorTarget()
+	assert.Equal(t, 25, buf.row, "cursor on third target")
+	assert.Equal(t, stateIdle, eng.state, "idle once all targets are visited")
+	assert.Len(t, 0, eng.targetQueue, "queue exhausted")
+}
+
+func TestNextTargets_PrefetchesTopTwo(t *testing.T) {
+	eng, _, prov := newTargetsEngine(t, &types.CompletionResponse{})
+
+	eng.handleCompletionReadyImpl(targetsResponse())
+	awaitTargetResults(t, eng, 2)
+
+	assert.Equal(t, 2, prov.completionCalls, "requests")
+	assert.True(t, eng.targetQueue[2].cancel == nil, "third target not requested")
+}
+
+func TestNextTargets_PrefetchedCompletionShownOnJump(t *testing.T) {
+	eng, buf, prov := newTargetsEngine(t, &types.CompletionResponse{
+		Completions: []*types.Completion{{StartLine: 8, EndLineInc: 8, Lines: []string{"line 8 changed"}}},
+	})
+
+	eng.handleCompletionReadyImpl(targetsResponse())
+	awaitTargetResults(t, eng, 2)
+	eng.acceptCursorTarget()
+
+	assert.Equal(t, stateHasCompletion, eng.state, "prefetched completion shown")
+	assert.Equal(t, 8, buf.lastPreparedCompletion.startLine, "completion at the target")
+	assert.Equal(t, 2, prov.completionCalls, "no request on the jump")
+	assert.Equal(t, 15, int(eng.targetQueue[0].target.LineNumber), "second target next")
+}
+
+func TestNextTargets_PrefetchDroppedWhenRegionEdited(t *testing.T) {
+	eng, buf, _ := newTargetsEngine(t, &types.CompletionResponse{
+		Completions: []*types.Completion{{StartLine: 8, EndLineInc: 8, Lines: []string{"line 8 changed"}}},
+	})
+
+	eng.handleCompletionReadyImpl(targetsResponse())
+	awaitTargetResults(t, eng, 2)
+	buf.lines[7] = "line 8 edited"
+	eng.acceptCursorTarget()
+
+	assert.Equal(t, 0, buf.prepareCompletionCalls, "stale completion not shown")
+	assert.Equal(t, 15, buf.showCursorTargetLine, "second target shown")
+}
+
+func TestNextTargets_RejectStageSkipsToNext(t *testing.T) {
+	eng, buf, _ := newTargetsEngine(t, &types.CompletionResponse{})
+
+	eng.handleCompletionReadyImpl(targetsResponse())
+	awaitTargetResults(t, eng, 2)
+	buf.lines = append([]string{"inserted"}, buf.lines...)
+	eng.rejectStage()
+
+	assert.Equal(t, 1, buf.row, "cursor not moved")
+	assert.Equal(t, stateHasCursorTarget, eng.state, "state")
+	assert.Equal(t, 16, buf.showCursorTargetLine, "next target follows the inserted line")
+	assert.Equal(t, 1, eng.Stats().Jumps.Rejected, "skipped jump rejected")
+}
+
+func TestNextTargets_EscDropsQueue(t *testing.T) {
+	eng, _, _ := newTargetsEngine(t, &types.CompletionResponse{})
+
+	eng.handleCompletionReadyImpl(targetsResponse())
+	eng.reject()
+
+	assert.Equal(t, stateIdle, eng.state, "state")
+	assert.Len(t, 0, eng.targetQueue, "queue dropped")
+}
+
+func TestNextTargets_PrefetchCarriesRequestContext(t *testing.T) {
+	eng, buf, prov := newTargetsEngine(t, &types.CompletionResponse{})
+	eng.RegisterInjector(&stubInjector{name: "failures"})
+	eng.injected = injectedChunks{path: buf.path, chunks: []*types.RetrievalChunk{{FilePath: "failures", Lines: []string{"FAIL TestX"}}}}
+	eng.injecting = true
+
+	eng.handleCompletionReadyImpl(targetsResponse())
+	awaitTargetResults(t, eng, 2)
+
+	assert.Len(t, 1, prov.lastRequest.RetrievalChunks, "injected context")
+}
+
+func TestNextTargets_PrefetchServedFromCache(t *testing.T) {
+	eng, _, prov := newTargetsEngine(t, &types.CompletionResponse{
+		Completions: []*types.Completion{{StartLine: 8, EndLineInc: 8, Lines: []string{"line 8 changed"}}},
+	})
+	eng.config.CacheTTL = time.Minute
+	eng.config.CacheMaxEntries = 4
+
+	eng.handleCompletionReadyImpl(targetsResponse())
+	awaitTargetResults(t, eng, 2)
+	eng.reject()
+	eng.handleCompletionReadyImpl(targetsResponse())
+
+	assert.Equal(t, 2, prov.completionCalls, "no new requests")
+	assert.NotNil(t, eng.targetQueue[0].completion, "cached completion kept")
+}
+
+func TestNextTargets_IneligibleBufferNotPrefetched(t *testing.T) {
+	eng, buf, prov := newTargetsEngine(t, &types.CompletionResponse{})
+	buf.ineligible = "too large"
+
+	eng.handleCompletionReadyImpl(targetsResponse())
+
+	assert.Equal(t, 0, prov.completionCalls, "no requests")
+}
+
+func TestNextTargets_QueuedAfterCompletion(t *testing.T) {
+	eng, buf, _ := newTargetsEngine(t, &types.CompletionResponse{})
+
+	eng.handleCompletionReadyImpl(&types.CompletionResponse{
+		Completions: []*types.Completion{{StartLine: 1, EndLineInc: 1, Lines: []string{"line 1 changed"}}},
+		NextTargets: []*types.CursorPredictionTarget{{LineNumber: 20}},
+	})
+	awaitTargetResults(t, eng, 1)
+	assert.Equal(t, stateHasCompletion, eng.state, "completion shown")
+	assert.Len(t, 1, eng.targetQueue, "next location queued")
+
+	buf.lines[0] = "line 1 changed"
+	eng.acceptCompletion()
+
+	assert.Equal(t, stateHasCursorTarget, eng.state, "next location offered")
+	assert.Equal(t, 20, buf.showCursorTargetLine, "jump to the next location")
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"errors"
+
+	"cursortab/text"
+)
+
+// ErrNoShownCompletion is returned by TuneStaging before any completion was shown.
+var ErrNoShownCompletion = errors.New("no completion has been shown yet")
+
+// stagingInput records what the last shown completion was staged from,
+// so it can be re-staged with alternative settings.
+type stagingInput struct {
+	oldLines       []string
+	newLines       []string
+	baseLineOffset int
+	cursorRow      int
+	cursorCol      int
+	viewportTop    int
+	viewportBottom int
+	filePath       string
+	scopes         []text.LineRange
+	order          text.StageOrder
+}
+
+// TuningOption is an alternative set of staging settings to preview.
+type TuningOption struct {
+	ProximityThreshold int     `json:"proximity_threshold"`
+	MaxVisibleLines    int     `json:"max_visible_lines"` // 0 to disable
+	Similarity         float64 `json:"similarity"`        // 0 uses text.SimilarityThreshold
+}
+
+// StageSpan summarizes one stage of a layout.
+type StageSpan struct {
+	BufferStart int `json:"buffer_start"`
+	BufferEnd   int `json:"buffer_end"`
+	Changes     int `json:"changes"`
+	Groups      int `json:"groups"`
+}
+
+// StageLayout is how the last shown completion stages under one option.
+type StageLayout struct {
+	Option               TuningOption `json:"option"`
+	Stages               []StageSpan  `json:"stages"`
+	FirstNeedsNavigation bool         `json:"first_needs_navigation"`
+}
+
+// TuneStaging re-runs diffing and staging of the last shown completion once per
+// option and returns the resulting layouts. Nothing is shown or changed.
+func (e *Engine) TuneStaging(options []TuningOption) ([]StageLayout, error) {
+	e.mu.RLock()
+	in := e.lastStaging
+	e.mu.RUnlock()
+
+	if in == nil {
+		return nil, ErrNoShownCompletion
+	}
+
+	layouts := make([]StageLayout, 0, len(options))
+	for _, opt := range options {
+		layouts = append(layouts, in.layout(opt))
+	}
+	return layouts, nil
+}
+
+// layout stages the recorded completion with the given option.
+func (in *stagingInput) layout(opt TuningOption) StageLayout {
+	similarity := opt.Similarity
+	if similarity <= 0 {
+		similarity = text.SimilarityThreshold
+	}
+
+	diff := text.ComputeDiffWithSimilarity(text.JoinLines(in.oldLines), text.JoinLines(in.newLines), similarity)
+	result := text.CreateStages(&text.StagingParams{
+		Diff:               diff,
+		CursorRow:          in.cursorRow,
+		CursorCol:          in.cursorCol,
+		ViewportTop:        in.viewportTop,
+		ViewportBottom:     in.viewportBottom,
+		BaseLineOffset:     in.baseLineOffset,
+		ProximityThreshold: opt.ProximityThreshold,
+		MaxLines:           opt.MaxVisibleLines,
+		FilePath:           in.filePath,
+		NewLines:           in.newLines,
+		OldLines:           in.oldLines,
+		Scopes:             in.scopes,
+		Order:              in.order,
+	})
+
+	layout := StageLayout{Option: opt, Stages: []StageSpan{}}
+	if result == nil {
+		return layout
+	}
+	layout.FirstNeedsNavigation = result.FirstNeedsNavigation
+	for _, stage := range result.Stages {
+		layout.Stages = append(layout.Stages, StageSpan{
+			BufferStart: stage.BufferStart,
+			BufferEnd:   stage.BufferEnd,
+			Changes:     len(stage.Changes),
+			Groups:      len(stage.Groups),
+		})
+	}
+	return layout
+}
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestTuneStaging_NoShownCompletion(t *testing.T) {
+	eng := createTestEngine(newMockBuffer(), newMockProvider(), newMockClock())
+
+	_, err := eng.TuneStaging([]TuningOption{{ProximityThreshold: 3}})
+
+	assert.Error(t, err, "no completion shown")
+}
+
+func TestTuneStaging_ProximityChangesLayout(t *testing.T) {
+	buf := newMockBuffer()
+	buf.lines = []string{"a := 1", "b := 2", "c := 3", "d := 4", "e := 5", "f := 6"}
+	buf.row = 1
+	eng := createTestEngine(buf, newMockProvider(), newMockClock())
+
+	shown := eng.processCompletion(&types.Completion{
+		StartLine:  1,
+		EndLineInc: 6,
+		Lines:      []string{"a := 10", "b := 2", "c := 3", "d := 4", "e := 5", "f := 60"},
+	})
+	assert.True(t, shown, "completion shown")
+	staged := eng.stagedCompletion
+
+	layouts, err := eng.TuneStaging([]TuningOption{
+		{ProximityThreshold: 1},
+		{ProximityThreshold: 10},
+	})
+
+	assert.NoError(t, err, "TuneStaging")
+	assert.Len(t, 2, layouts, "layouts")
+	assert.Len(t, 2, layouts[0].Stages, "tight threshold splits")
+	assert.Equal(t, 1, layouts[0].Stages[0].BufferStart, "nearest stage first")
+	assert.Equal(t, 6, layouts[0].Stages[1].BufferStart, "far stage second")
+	assert.Len(t, 1, layouts[1].Stages, "loose threshold merges")
+	assert.Equal(t, 1, layouts[1].Stages[0].BufferStart, "merged start")
+	assert.Equal(t, 6, layouts[1].Stages[0].BufferEnd, "merged end")
+	assert.Equal(t, staged, eng.stagedCompletion, "shown completion untouched")
+}
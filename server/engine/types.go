@@ -2,11 +2,15 @@ package engine
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"time"
 
 	"cursortab/buffer"
+	"cursortab/imports"
+	"cursortab/redact"
 	"cursortab/text"
+	"cursortab/tokenizer"
 	"cursortab/types"
 )
 
@@ -18,24 +22,45 @@ type Buffer interface {
 	Row() int
 	Col() int
 	Path() string
+	AbsolutePath() string // Empty for unnamed buffers
 	Version() int
 	ViewportBounds() (top, bottom int)
 	PreviousLines() []string
 	OriginalLines() []string
 	DiffHistories() []*types.DiffEntry
+	Ineligible() string                                        // Why the buffer of the last sync gets no completions, empty when it does
+	ApplyLines(first, last int, lines []string, tick int) bool // Apply a change reported by nvim_buf_attach to the lines, false when skipped
+	DetachLines()                                              // Read the lines in full on the next sync
 	SetFileContext(prev, orig []string, diffs []*types.DiffEntry)
 	HasChanges(startLine, endLineInc int, lines []string) bool
 	PrepareCompletion(startLine, endLineInc int, lines []string, groups []*text.Group) buffer.Batch
+	SetAnnotation(a *types.Annotation) // Annotates the completions prepared after it
 	CommitPending()
 	CommitUserEdits() bool // Returns true if changes were committed
+	VerifyPending() error  // Error when the buffer does not hold the applied pending edit
+	Rollback() error       // Restore the content of the last sync and drop the pending edit
+	NotifyApplyFailed(failureJSON string)
 	ShowCursorTarget(line int) error
+	ShowFileTarget(path string, line int, summary *text.MultiFileSummary) error // Jump indicator for a stage in another file
+	ShowPlaceholders(placeholders []text.Placeholder) error                     // Positions the accept keys cycle through after an accept
+	DimCompletion(dimmed bool) error                                            // Dim or restore the shown completion
+	StreamStage(stage *text.Stage, index int, shown bool) error                 // Push a stage finalized while the completion streams
+	// ImportEdits asks the language servers for the edits adding the imports
+	// lines first to last need, with the position encoding of their columns.
+	ImportEdits(first, last int, timeout time.Duration) ([]imports.TextEdit, string)
+	OpenFile(path string, line int) error // Open the file at path with the cursor on line
 	ClearUI() error
-	MoveCursor(line int, center, mark bool) error
+	MoveCursor(line, col int, center, mark bool) error // Move to a 0-indexed byte col, or the first non-blank character when col < 0
+	ClosedFold(line int) (start, end int)              // Closed fold hiding line in the current window, 0, 0 when none
+	OpenFold(line int) error                           // Open the closed folds hiding line
 	RegisterEventHandler(handler func(event string)) error
 	// Partial accept operations
 	InsertText(line, col int, text string) error // Insert text at position (1-indexed line, 0-indexed col)
 	ReplaceLine(line int, content string) error  // Replace a single line (1-indexed)
 	InsertLine(line int, content string) error   // Insert a new line at position (1-indexed)
+	// ApplyInPlace replaces lines startLine..endLineInc with lines, keeping the
+	// cursor and viewport on the same text. The edit is pending until CommitPending.
+	ApplyInPlace(startLine, endLineInc int, lines []string) error
 }
 
 // Provider defines the interface that all AI providers must implement.
@@ -54,8 +79,20 @@ type ContextLimits struct {
 	MaxDiffBytes       int // Git diff byte threshold before switching to symbols (default: 4096)
 	MaxChangedSymbols  int // Max symbols extracted from large diffs (default: 50)
 	MaxSiblings        int // Max treesitter sibling nodes (default: 50)
+	MaxLSPSymbols      int // Max identifiers looked up with LSP hover and definition (default: -1 = disabled)
+	MaxGitCommits      int // Max commits of the current file, sent with the blame of the cursor region (default: -1 = disabled)
+	MaxRetrievalChunks int // Max chunks of visited files ranked against the cursor context (default: -1 = disabled)
 	MaxInputLines      int // Input line limit for hosted APIs (default: 50000)
 	MaxInputBytes      int // Input byte limit for hosted APIs (default: 10_000_000)
+	MaxOutputTokens    int // Tokens a completion may generate (default: 0 = provider.max_tokens)
+}
+
+// MinContextLimits are the smallest input and output limits a request is
+// still worth sending with. Configured overrides below them are rejected.
+var MinContextLimits = ContextLimits{
+	MaxInputLines:   20,
+	MaxInputBytes:   1024,
+	MaxOutputTokens: 16,
 }
 
 // DefaultContextLimits returns the default context limits.
@@ -67,6 +104,9 @@ func DefaultContextLimits() ContextLimits {
 		MaxDiffBytes:       4096,
 		MaxChangedSymbols:  50,
 		MaxSiblings:        50,
+		MaxLSPSymbols:      -1,
+		MaxGitCommits:      -1,
+		MaxRetrievalChunks: -1,
 		MaxInputLines:      50_000,
 		MaxInputBytes:      10_000_000,
 	}
@@ -93,6 +133,15 @@ func (cl ContextLimits) WithDefaults() ContextLimits {
 	if cl.MaxSiblings == 0 {
 		cl.MaxSiblings = d.MaxSiblings
 	}
+	if cl.MaxLSPSymbols == 0 {
+		cl.MaxLSPSymbols = d.MaxLSPSymbols
+	}
+	if cl.MaxGitCommits == 0 {
+		cl.MaxGitCommits = d.MaxGitCommits
+	}
+	if cl.MaxRetrievalChunks == 0 {
+		cl.MaxRetrievalChunks = d.MaxRetrievalChunks
+	}
 	if cl.MaxInputLines == 0 {
 		cl.MaxInputLines = d.MaxInputLines
 	}
@@ -102,6 +151,28 @@ func (cl ContextLimits) WithDefaults() ContextLimits {
 	return cl
 }
 
+// Override returns a copy with the input and output limits replaced by those
+// set in o. Zero fields of o keep the provider's limits.
+func (cl ContextLimits) Override(o ContextLimits) ContextLimits {
+	if o.MaxInputLines > 0 {
+		cl.MaxInputLines = o.MaxInputLines
+	}
+	if o.MaxInputBytes > 0 {
+		cl.MaxInputBytes = o.MaxInputBytes
+	}
+	if o.MaxOutputTokens > 0 {
+		cl.MaxOutputTokens = o.MaxOutputTokens
+	}
+	return cl
+}
+
+// String lists the limits for logging.
+func (cl ContextLimits) String() string {
+	return fmt.Sprintf("user_actions=%d file_chunk_lines=%d snapshots=%d diff_bytes=%d changed_symbols=%d siblings=%d lsp_symbols=%d git_commits=%d retrieval_chunks=%d input_lines=%d input_bytes=%d output_tokens=%d",
+		cl.MaxUserActions, cl.FileChunkLines, cl.MaxRecentSnapshots, cl.MaxDiffBytes, cl.MaxChangedSymbols, cl.MaxSiblings,
+		cl.MaxLSPSymbols, cl.MaxGitCommits, cl.MaxRetrievalChunks, cl.MaxInputLines, cl.MaxInputBytes, cl.MaxOutputTokens)
+}
+
 // LineStreamProvider extends Provider with line-by-line streaming capabilities.
 // For providers like sweep, zeta, fim that stream by lines.
 type LineStreamProvider interface {
@@ -165,12 +236,20 @@ type StreamingState struct {
 	ProviderContext any
 	Validated       bool
 
+	// Secrets redacted from the request; stream lines arrive revealed
+	Secrets *redact.Secrets
+
 	// Request data needed for finalization
 	Request *types.CompletionRequest
+	// Key the final response is cached under
+	CacheKey uint64
 
 	// Track if we've rendered the first stage during streaming
 	// Only render one stage during streaming; rest handled at completion
 	FirstStageRendered bool
+
+	// Stages finalized so far, each pushed to the editor as it is finalized
+	StagesStreamed int
 }
 
 // TokenStreamingState holds state during token-by-token streaming
@@ -181,8 +260,13 @@ type TokenStreamingState struct {
 	// Provider context for postprocessing
 	ProviderContext any
 
+	// Secrets redacted from the request; accumulated text is revealed
+	Secrets *redact.Secrets
+
 	// Request data needed for finalization
 	Request *types.CompletionRequest
+	// Key the final response is cached under
+	CacheKey uint64
 
 	// Line prefix: text before cursor on current line (for rendering full line)
 	LinePrefix string
@@ -236,6 +320,22 @@ type CursorPredictionConfig struct {
 	Enabled            bool // Show jump indicators (default: true)
 	AutoAdvance        bool // On no-op, jump to last line + retrigger (default: true)
 	ProximityThreshold int  // Lines apart to trigger staging (default: 3)
+	CursorOnly         bool // Show jumps from responses with a cursor target but no edit (default: true)
+	PrefetchDepth      int  // Completions requested ahead along the predicted cursor targets (default: 1, only the next)
+}
+
+// CircuitBreakerConfig holds the settings of the circuit breaker that pauses
+// automatic requests to a failing provider
+type CircuitBreakerConfig struct {
+	Failures int           // Consecutive failed requests that open the circuit (0 = never)
+	Cooldown time.Duration // How long requests are skipped before a probe is sent
+}
+
+// RenamePropagationConfig holds settings for following up an accepted rename
+// with the other occurrences of the renamed identifier
+type RenamePropagationConfig struct {
+	Enabled   bool // Offer to rename the other occurrences in the buffer (default: true)
+	Workspace bool // Also rename them in other workspace files found with ripgrep (default: false)
 }
 
 // FileState holds per-file context that persists across file switches
@@ -250,13 +350,61 @@ type FileState struct {
 
 // EngineConfig holds engine configuration
 type EngineConfig struct {
-	NsID                int
-	CompletionTimeout   time.Duration
-	IdleCompletionDelay time.Duration
-	TextChangeDebounce  time.Duration
-	CursorPrediction    CursorPredictionConfig
-	MaxDiffTokens       int  // Maximum tokens for diff history per file (0 = no limit)
-	MaxVisibleLines     int  // Maximum lines per stage (0 = no limit)
-	CompleteInInsert    bool // Show completions in insert mode
-	CompleteInNormal    bool // Show completions in normal mode
+	NsID                  int
+	CompletionTimeout     time.Duration
+	IdleCompletionDelay   time.Duration
+	ScanDelay             time.Duration // Idle time before requesting completions at errors and recent edits away from the cursor (0 = disabled)
+	TextChangeDebounce    time.Duration
+	TriggerPolicy         TriggerPolicy // Which events start a completion request
+	CursorPrediction      CursorPredictionConfig
+	StageOrder            text.StageOrder // Order in which the stages of a completion are shown
+	RenamePropagation     RenamePropagationConfig
+	Placeholders          bool                // Let the accept keys cycle through the variable parts of an accepted completion
+	AutoImport            bool                // Offer the imports an accepted completion is missing as an extra stage
+	FixDiagnostics        bool                // Ask idle requests on a line with an LSP error to fix it
+	OpenFolds             bool                // Open closed folds hiding a stage, instead of pointing at their first line
+	MaxDiffTokens         int                 // Maximum tokens for diff history per file (0 = no limit)
+	Tokenizer             tokenizer.Tokenizer // Counts tokens against MaxDiffTokens (nil = heuristic)
+	MaxVisibleLines       int                 // Maximum lines per stage (0 = no limit)
+	MaxCompletionLines    int                 // Completions changing more lines are chunked or dropped (0 = no limit)
+	OversizedPolicy       OversizedPolicy     // Handling of completions over MaxCompletionLines
+	PastePolicy           PastePolicy         // Handling of the text change request following a paste
+	PasteDelay            time.Duration       // Quiet time before the request following a paste, under the PasteDelay policy
+	RootMarkers           []string            // Files marking a project root (nil = DefaultRootMarkers)
+	StickyLines           int                 // Keep a completion while the cursor moves this many lines away in normal mode (0 = reject on move)
+	CompleteInInsert      bool                // Show completions in insert mode
+	CompleteInNormal      bool                // Show completions in normal mode
+	DisplayTTL            time.Duration       // Auto-dismiss a shown completion after this long (0 = never)
+	EOFPolicy             EOFPolicy           // Handling of completions extending past the last buffer line
+	TokenBudget           int                 // Estimated tokens per minute allowed before retriggers are held back (0 = unlimited)
+	MaxRequestsPerMinute  int                 // Provider requests sent per minute before completions queue and prefetches are skipped (0 = unlimited)
+	MaxConcurrentRequests int                 // Provider requests in flight at once (0 = unlimited)
+	CircuitBreaker        CircuitBreakerConfig
+	ContextBudget         ContextBudgeter       // Token budget shared by the context sources of each request
+	MaxPayloadBytes       int                   // Cap on the serialized request; context is trimmed to fit (0 = no cap)
+	ContextLimits         ContextLimits         // Input and output limits replacing the provider's (zero fields keep them)
+	ProviderOptions       types.ProviderOptions // Generation parameters passed through with each request (nil = none)
+	CacheTTL              time.Duration         // How long provider responses are reused for an identical context (0 = no cache)
+	CacheMaxEntries       int                   // Maximum cached responses (0 = no cache)
+	DisableTelemetry      bool                  // Never send metrics events to the provider backend
 }
+
+// TriggerPolicy controls which events start a completion request. Explicit
+// triggers (EventManualTrigger) always do.
+type TriggerPolicy string
+
+const (
+	TriggerInsertChange  TriggerPolicy = "insert_change"   // Text changes and idle time in the enabled modes (default)
+	TriggerManual        TriggerPolicy = "manual"          // Only explicit triggers
+	TriggerIdleOnly      TriggerPolicy = "idle_only"       // Only idle time in normal mode, not text changes
+	TriggerNormalModeToo TriggerPolicy = "normal_mode_too" // As insert_change, with normal mode enabled regardless of CompleteInNormal
+)
+
+// EOFPolicy controls completions whose range ends past the last buffer line.
+type EOFPolicy string
+
+const (
+	EOFExtend EOFPolicy = "extend" // Lines past the end are appended to the buffer (default)
+	EOFClamp  EOFPolicy = "clamp"  // Lines mapped past the end are dropped
+	EOFReject EOFPolicy = "reject" // The completion is discarded
+)
@@ -9,4 +9,10 @@ require (
 
 require github.com/andybalholm/brotli v1.2.0
 
-require github.com/google/uuid v1.6.0 // indirect
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/google/uuid v1.6.0
+)
+
+require golang.org/x/sys v0.13.0 // indirect
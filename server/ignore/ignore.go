@@ -0,0 +1,214 @@
+// Package ignore decides which workspace files must never be used as context:
+// files matched by .gitignore (including nested ones and .git/info/exclude),
+// by a .cursortabignore file at the workspace root, or by configured patterns.
+// Patterns follow gitignore syntax.
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// IgnoreFile is the workspace file listing extra paths to keep out of context.
+const IgnoreFile = ".cursortabignore"
+
+type rule struct {
+	base     string   // Directory of the file the rule came from, relative to the root ("" for the root)
+	segments []string // Pattern split on "/"
+	negate   bool     // "!pattern" re-includes a path
+	dirOnly  bool     // "pattern/" only matches directories
+	anchored bool     // Patterns with a "/" match from base; others match any name
+}
+
+// Rules matches workspace-relative paths against ignore patterns.
+type Rules struct {
+	root      string
+	gitignore bool
+	rules     []rule // From the root: .gitignore, .git/info/exclude, .cursortabignore, configured patterns
+
+	mu     sync.Mutex
+	nested map[string][]rule // .gitignore rules of subdirectories, loaded on first use
+}
+
+// Load reads the ignore files of the workspace at root. patterns are added
+// after them, so they take precedence. With gitignore false, only
+// .cursortabignore and patterns are used.
+func Load(root string, patterns []string, gitignore bool) *Rules {
+	r := &Rules{root: root, gitignore: gitignore, nested: make(map[string][]rule)}
+	if gitignore {
+		r.rules = append(r.rules, readRules(filepath.Join(root, ".gitignore"), "")...)
+		r.rules = append(r.rules, readRules(filepath.Join(root, ".git", "info", "exclude"), "")...)
+	}
+	r.rules = append(r.rules, readRules(filepath.Join(root, IgnoreFile), "")...)
+	for _, p := range patterns {
+		if rl, ok := parseRule(p, ""); ok {
+			r.rules = append(r.rules, rl)
+		}
+	}
+	return r
+}
+
+// Match reports whether the file at relPath (relative to the workspace root,
+// with "/" or the OS separator) is ignored. A file inside an ignored directory
+// is ignored, as with git. Paths outside the workspace only match patterns
+// without a "/".
+func (r *Rules) Match(relPath string) bool {
+	if r == nil || relPath == "" {
+		return false
+	}
+	p := filepath.ToSlash(filepath.Clean(relPath))
+	if filepath.IsAbs(relPath) {
+		return r.matchRules(r.rules, path.Base(p), false)
+	}
+
+	parts := strings.Split(p, "/")
+	for i := 1; i < len(parts); i++ {
+		if r.matchPath(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return r.matchPath(p, false)
+}
+
+// matchPath applies the root rules, then the .gitignore of each directory on
+// the way to p. The last matching rule decides.
+func (r *Rules) matchPath(p string, isDir bool) bool {
+	ignored := false
+	apply := func(rules []rule) {
+		for _, rl := range rules {
+			if rl.matches(p, isDir) {
+				ignored = !rl.negate
+			}
+		}
+	}
+	apply(r.rules)
+
+	if r.gitignore {
+		dir := ""
+		for _, part := range strings.Split(path.Dir(p), "/") {
+			if part == "." {
+				break
+			}
+			dir = path.Join(dir, part)
+			apply(r.nestedRules(dir))
+		}
+	}
+	return ignored
+}
+
+func (r *Rules) matchRules(rules []rule, p string, isDir bool) bool {
+	ignored := false
+	for _, rl := range rules {
+		if !rl.anchored && rl.matches(p, isDir) {
+			ignored = !rl.negate
+		}
+	}
+	return ignored
+}
+
+func (r *Rules) nestedRules(dir string) []rule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rules, ok := r.nested[dir]
+	if !ok {
+		rules = readRules(filepath.Join(r.root, filepath.FromSlash(dir), ".gitignore"), dir)
+		r.nested[dir] = rules
+	}
+	return rules
+}
+
+// matches reports whether p (relative to the root) matches the rule.
+func (rl rule) matches(p string, isDir bool) bool {
+	if rl.dirOnly && !isDir {
+		return false
+	}
+	if rl.base != "" {
+		rest, ok := strings.CutPrefix(p, rl.base+"/")
+		if !ok {
+			return false
+		}
+		p = rest
+	}
+	if !rl.anchored {
+		return matchSegment(rl.segments[0], path.Base(p))
+	}
+	return matchSegments(rl.segments, strings.Split(p, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where "**"
+// spans any number of segments.
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 || !matchSegment(pattern[0], parts[0]) {
+		return false
+	}
+	return matchSegments(pattern[1:], parts[1:])
+}
+
+func matchSegment(pattern, name string) bool {
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+// parseRule parses one gitignore line for an ignore file in base.
+func parseRule(line, base string) (rule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+
+	rl := rule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rl.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rl.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule{}, false
+	}
+
+	rl.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	rl.segments = strings.Split(line, "/")
+	if !rl.anchored && line == "**" {
+		rl.anchored = true
+	}
+	return rl, true
+}
+
+// readRules parses the ignore file at file. A missing file has no rules.
+func readRules(file, base string) []rule {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []rule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rl, ok := parseRule(scanner.Text(), base); ok {
+			rules = append(rules, rl)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,84 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cursortab/assert"
+)
+
+func writeFile(t *testing.T, root, name, content string) {
+	t.Helper()
+	p := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatch_Gitignore(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, ".gitignore", "# secrets\n.env\n*.log\n!keep.log\nvendor/\n/build\ndocs/**/*.pdf\n")
+
+	r := Load(root, nil, true)
+
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{".env", true},
+		{"config/.env", true},
+		{"app.log", true},
+		{"keep.log", false},
+		{"vendor/lib/x.go", true},
+		{"vendor", false},
+		{"build/out.js", true},
+		{"src/build/out.js", false},
+		{"docs/a/b/c.pdf", true},
+		{"docs/c.pdf", true},
+		{"main.go", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, r.Match(c.path), c.path)
+	}
+}
+
+func TestMatch_NestedGitignore(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "pkg/.gitignore", "generated.go\n/local\n")
+
+	r := Load(root, nil, true)
+
+	assert.True(t, r.Match("pkg/generated.go"), "nested rule")
+	assert.True(t, r.Match("pkg/sub/generated.go"), "nested rule in subdirectory")
+	assert.True(t, r.Match("pkg/local/x.go"), "anchored to nested directory")
+	assert.False(t, r.Match("generated.go"), "outside nested directory")
+	assert.False(t, r.Match("other/local/x.go"), "anchored elsewhere")
+}
+
+func TestMatch_CursortabIgnoreAndPatterns(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, ".gitignore", "*.log\n")
+	writeFile(t, root, IgnoreFile, "secrets/\n")
+
+	r := Load(root, []string{"*.pem"}, false)
+
+	assert.True(t, r.Match("secrets/prod.yaml"), ".cursortabignore")
+	assert.True(t, r.Match("certs/server.pem"), "configured pattern")
+	assert.False(t, r.Match("app.log"), "gitignore disabled")
+}
+
+func TestMatch_AbsolutePathOutsideWorkspace(t *testing.T) {
+	r := Load(t.TempDir(), []string{".env", "/config"}, false)
+
+	assert.True(t, r.Match("/home/user/other/.env"), "name pattern")
+	assert.False(t, r.Match("/config"), "anchored pattern")
+}
+
+func TestMatch_NilRules(t *testing.T) {
+	var r *Rules
+	assert.False(t, r.Match(".env"), "nil rules ignore nothing")
+}
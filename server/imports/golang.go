@@ -0,0 +1,198 @@
+package imports
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// golangStdlib maps the names of commonly used standard library packages to
+// their import paths.
+var golangStdlib = map[string]string{
+	"bufio": "bufio", "bytes": "bytes", "context": "context", "errors": "errors",
+	"fmt": "fmt", "io": "io", "log": "log", "maps": "maps", "math": "math",
+	"os": "os", "reflect": "reflect", "regexp": "regexp", "slices": "slices",
+	"sort": "sort", "strconv": "strconv", "strings": "strings", "sync": "sync",
+	"time": "time", "unicode": "unicode", "atomic": "sync/atomic",
+	"filepath": "path/filepath", "path": "path", "exec": "os/exec",
+	"signal": "os/signal", "json": "encoding/json", "base64": "encoding/base64",
+	"hex": "encoding/hex", "http": "net/http", "url": "net/url", "net": "net",
+	"rand": "math/rand", "big": "math/big", "utf8": "unicode/utf8",
+	"fs": "io/fs", "slog": "log/slog", "sha256": "crypto/sha256",
+	"testing": "testing", "runtime": "runtime", "heap": "container/heap",
+	"list": "container/list", "template": "text/template", "tabwriter": "text/tabwriter",
+	"iter": "iter", "cmp": "cmp", "embed": "embed", "flag": "flag",
+}
+
+// golangImportPattern matches an import spec: an optional name and a path.
+var golangImportPattern = regexp.MustCompile(`^\s*(?:import\s+)?([\w.]+\s+)?"([^"]+)"`)
+
+var golangVersionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+type golang struct{}
+
+func (golang) handles(p string) bool {
+	return path.Ext(p) == ".go"
+}
+
+// golangImportRanges returns the first and last line (0-indexed, inclusive)
+// of each import declaration.
+func golangImportRanges(lines []string) [][2]int {
+	var ranges [][2]int
+	for i := 0; i < len(lines); i++ {
+		rest, ok := strings.CutPrefix(lines[i], "import")
+		if !ok || rest != "" && rest[0] != ' ' && rest[0] != '\t' && rest[0] != '(' {
+			continue
+		}
+		if !strings.HasPrefix(strings.TrimSpace(rest), "(") {
+			if golangImportPattern.MatchString(lines[i]) {
+				ranges = append(ranges, [2]int{i, i})
+			}
+			continue
+		}
+		start := i
+		for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), ")") {
+			i++
+		}
+		ranges = append(ranges, [2]int{start, min(i, len(lines)-1)})
+	}
+	return ranges
+}
+
+func (golang) imports(_, _ string, lines []string) []imported {
+	var result []imported
+	for _, r := range golangImportRanges(lines) {
+		for _, line := range lines[r[0] : r[1]+1] {
+			m := golangImportPattern.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			alias, importPath := strings.TrimSpace(m[1]), m[2]
+			name := alias
+			if name == "" {
+				name = golangPackageName(importPath)
+			}
+			if name == "_" || name == "." {
+				continue
+			}
+			spec := fmt.Sprintf("%q", importPath)
+			if alias != "" {
+				spec = alias + " " + spec
+			}
+			result = append(result, imported{name: name, module: importPath, line: spec})
+		}
+	}
+	return result
+}
+
+// golangPackageName guesses the name of the package at an import path: its
+// last element, skipping a major version suffix.
+func golangPackageName(importPath string) string {
+	parts := strings.Split(importPath, "/")
+	name := parts[len(parts)-1]
+	if len(parts) > 1 && golangVersionSuffix.MatchString(name) {
+		name = parts[len(parts)-2]
+	}
+	return strings.ReplaceAll(strings.TrimPrefix(name, "go-"), "-", "")
+}
+
+func (golang) references(edit []string) []string {
+	return qualifiers(edit)
+}
+
+// declared reports whether name is used other than as a package qualifier
+// outside the import declarations, as a variable or parameter would be.
+func (golang) declared(name string, lines []string) bool {
+	return !onlyQualifier(name, golangCode(lines))
+}
+
+// golangCode returns lines without the import declarations.
+func golangCode(lines []string) []string {
+	code := slices.Clone(lines)
+	for _, r := range golangImportRanges(lines) {
+		for i := r[0]; i <= r[1]; i++ {
+			code[i] = ""
+		}
+	}
+	return code
+}
+
+func (golang) resolve(name string, _ []string, known []imported) (imported, bool) {
+	for _, imp := range known {
+		if imp.name == name {
+			return imp, true
+		}
+	}
+	if importPath, ok := golangStdlib[name]; ok {
+		return imported{name: name, module: importPath, line: fmt.Sprintf("%q", importPath)}, true
+	}
+	return imported{}, false
+}
+
+// golangIsStdlib reports whether an import path belongs to the standard
+// library, whose first element has no dot.
+func golangIsStdlib(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+// insert adds the specs to the first import block, standard library packages
+// to its first group and others to its last, each in sorted position. Without
+// a block, single-line imports are added after the last import declaration,
+// or after the package clause.
+func (golang) insert(lines []string, missing []imported) []string {
+	ranges := golangImportRanges(lines)
+	blockIdx := slices.IndexFunc(ranges, func(r [2]int) bool { return r[1] > r[0] })
+	if blockIdx < 0 {
+		var decls []string
+		for _, imp := range missing {
+			decls = append(decls, "import "+imp.line)
+		}
+		if len(ranges) > 0 {
+			at := ranges[len(ranges)-1][1] + 1
+			return slices.Insert(slices.Clone(lines), at, decls...)
+		}
+		at := slices.IndexFunc(lines, func(l string) bool { return strings.HasPrefix(l, "package ") }) + 1
+		return slices.Insert(slices.Clone(lines), at, append([]string{""}, decls...)...)
+	}
+
+	block := ranges[blockIdx]
+	result := slices.Clone(lines)
+	for _, imp := range missing {
+		// Groups of the block, as [first, end) line indexes
+		var groups [][2]int
+		start := block[0] + 1
+		for i := start; i <= block[1]; i++ {
+			if i == block[1] || strings.TrimSpace(result[i]) == "" {
+				if i > start {
+					groups = append(groups, [2]int{start, i})
+				}
+				start = i + 1
+			}
+		}
+
+		spec := "\t" + imp.line
+		if len(groups) == 0 {
+			result = slices.Insert(result, block[1], spec)
+			block[1]++
+			continue
+		}
+		group := groups[len(groups)-1]
+		if golangIsStdlib(imp.module) {
+			group = groups[0]
+		}
+		at := group[1]
+		for i := group[0]; i < group[1]; i++ {
+			m := golangImportPattern.FindStringSubmatch(result[i])
+			if m != nil && m[2] > imp.module {
+				at = i
+				break
+			}
+		}
+		result = slices.Insert(result, at, spec)
+		block[1]++
+	}
+	return result
+}
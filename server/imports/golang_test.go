@@ -0,0 +1,74 @@
+package imports
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestAdd_GoStdlibIntoBlock(t *testing.T) {
+	lines := []string{
+		"package main",
+		"",
+		"import (",
+		"\t\"fmt\"",
+		"\t\"strings\"",
+		"",
+		"\t\"example.com/lib\"",
+		")",
+		"",
+		"func main() {",
+		"\tfmt.Println(os.Args, strings.ToUpper(\"x\"), lib.X)",
+		"}",
+	}
+
+	got, ok := Add("main.go", lines, 11, 11, nil)
+
+	assert.True(t, ok, "added")
+	assert.Equal(t, []string{"\t\"fmt\"", "\t\"os\"", "\t\"strings\"", ""}, got[3:7], "os sorted into the standard library group")
+}
+
+func TestAdd_GoFromOtherFiles(t *testing.T) {
+	lines := []string{"package main", "", "import \"fmt\"", "", "func main() {", "\tfmt.Println(assert.X)", "}"}
+	others := map[string][]string{
+		"other.go": {"package main", "", "import (", "\t\"cursortab/assert\"", ")"},
+	}
+
+	got, ok := Add("main.go", lines, 6, 6, others)
+
+	assert.True(t, ok, "added")
+	assert.Equal(t, []string{"package main", "", "import \"fmt\"", "import \"cursortab/assert\"", ""}, got[:5], "declaration added after the last one")
+}
+
+func TestAdd_GoWithoutImports(t *testing.T) {
+	lines := []string{"package main", "", "func main() {", "\tfmt.Println()", "}"}
+
+	got, ok := Add("main.go", lines, 4, 4, nil)
+
+	assert.True(t, ok, "added")
+	assert.Equal(t, []string{"package main", "", "import \"fmt\"", "", "func main() {"}, got[:5], "declaration after the package clause")
+}
+
+func TestAdd_GoSkipsVariablesAndImported(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{"already imported", []string{"package main", "import \"fmt\"", "func f() { fmt.Println() }"}},
+		{"local variable", []string{"package main", "func f(time T) {", "\t_ = time.Now", "}"}},
+		{"unknown package", []string{"package main", "func f() { foo.Bar() }"}},
+		{"field of a value", []string{"package main", "func f() { x.fmt.Println() }"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := Add("main.go", tt.lines, 2, len(tt.lines), nil)
+			assert.False(t, ok, "nothing added")
+		})
+	}
+}
+
+func TestGolangPackageName(t *testing.T) {
+	assert.Equal(t, "json", golangPackageName("encoding/json"), "last element")
+	assert.Equal(t, "chi", golangPackageName("github.com/go-chi/chi/v5"), "version suffix skipped")
+	assert.Equal(t, "yaml", golangPackageName("github.com/goccy/go-yaml"), "go- prefix dropped")
+}
@@ -0,0 +1,270 @@
+// Package imports adds the imports a file is missing after an edit: from the
+// edits of a language server code action, or with heuristics for Go, Python
+// and TypeScript/JavaScript that take imports from the standard library and
+// from the other files of the workspace.
+package imports
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// TextEdit is a language server edit replacing the text between two
+// positions. Columns are in the units of the server's position encoding.
+type TextEdit struct {
+	StartLine int // 0-indexed
+	StartCol  int
+	EndLine   int // 0-indexed
+	EndCol    int
+	NewText   string
+}
+
+// ApplyEdits returns lines with edits applied. encoding is the position
+// encoding of the columns: "utf-8", "utf-16" (the default) or "utf-32".
+// Edits must not overlap.
+func ApplyEdits(lines []string, edits []TextEdit, encoding string) ([]string, error) {
+	type replacement struct {
+		start, end int
+		text       string
+	}
+	replacements := make([]replacement, 0, len(edits))
+	for _, e := range edits {
+		start, err := offset(lines, e.StartLine, e.StartCol, encoding)
+		if err != nil {
+			return nil, err
+		}
+		end, err := offset(lines, e.EndLine, e.EndCol, encoding)
+		if err != nil {
+			return nil, err
+		}
+		if end < start {
+			return nil, fmt.Errorf("edit ends before it starts at line %d", e.StartLine)
+		}
+		replacements = append(replacements, replacement{start: start, end: end, text: e.NewText})
+	}
+	sort.SliceStable(replacements, func(i, j int) bool { return replacements[i].start < replacements[j].start })
+
+	content := strings.Join(lines, "\n")
+	var b strings.Builder
+	pos := 0
+	for _, r := range replacements {
+		if r.start < pos {
+			return nil, fmt.Errorf("overlapping edits")
+		}
+		b.WriteString(content[pos:r.start])
+		b.WriteString(r.text)
+		pos = r.end
+	}
+	b.WriteString(content[pos:])
+	return strings.Split(b.String(), "\n"), nil
+}
+
+// offset returns the byte offset in the joined lines of a position.
+func offset(lines []string, line, col int, encoding string) (int, error) {
+	if line == len(lines) && col == 0 {
+		return len(strings.Join(lines, "\n")), nil
+	}
+	if line < 0 || line >= len(lines) {
+		return 0, fmt.Errorf("line %d out of range", line)
+	}
+	off := 0
+	for _, l := range lines[:line] {
+		off += len(l) + 1
+	}
+	return off + byteCol(lines[line], col, encoding), nil
+}
+
+// byteCol converts a column in the given encoding to a byte column of line.
+func byteCol(line string, col int, encoding string) int {
+	if encoding == "utf-8" {
+		return min(col, len(line))
+	}
+	units := 0
+	for i, r := range line {
+		if units >= col {
+			return i
+		}
+		switch {
+		case encoding == "utf-32", r < 0x10000:
+			units++
+		default:
+			units += 2
+		}
+	}
+	return len(line)
+}
+
+// Add returns lines with the imports added that lines first to last
+// (1-indexed, inclusive) need but the file lacks. others holds the content,
+// or the first lines, of other files by workspace-relative path; their
+// imports are copied when they provide a missing name. Returns false when
+// nothing is missing or the language of path is not supported.
+func Add(filePath string, lines []string, first, last int, others map[string][]string) ([]string, bool) {
+	if first < 1 || last > len(lines) || first > last {
+		return nil, false
+	}
+	i := slices.IndexFunc(languages, func(l language) bool { return l.handles(filePath) })
+	if i < 0 {
+		return nil, false
+	}
+	lang := languages[i]
+
+	var known []imported
+	for _, otherPath := range slices.Sorted(maps.Keys(others)) {
+		if otherPath == filePath || !lang.handles(otherPath) {
+			continue
+		}
+		known = append(known, lang.imports(filePath, otherPath, others[otherPath])...)
+	}
+
+	file := lang.imports(filePath, filePath, lines)
+	have := make(map[string]bool, len(file))
+	for _, imp := range file {
+		have[imp.name] = true
+	}
+
+	edit := lines[first-1 : last]
+	var missing []imported
+	seen := make(map[string]bool)
+	for _, name := range lang.references(edit) {
+		if have[name] || seen[name] || lang.declared(name, lines) {
+			continue
+		}
+		imp, ok := lang.resolve(name, lines, known)
+		if !ok {
+			continue
+		}
+		seen[name] = true
+		missing = append(missing, imp)
+	}
+	if len(missing) == 0 {
+		return nil, false
+	}
+	return lang.insert(lines, missing), true
+}
+
+// imported is a name brought into a file by an import.
+type imported struct {
+	name   string // Name the file refers to
+	module string // Module, package path or specifier it comes from
+	line   string // Import statement for the name alone
+	member string // Part of a statement listing several names of the module, "" when the name has its own
+}
+
+var languages = []language{golang{}, python{}, javascript{}}
+
+// language is what Add needs to know about the imports of a language.
+type language interface {
+	// handles reports whether the file at path is written in the language
+	handles(path string) bool
+	// imports returns the imports of the file at otherPath, rewritten to be
+	// valid in the file at filePath
+	imports(filePath, otherPath string, lines []string) []imported
+	// references returns the names the edited lines refer to that may need
+	// an import, in order of first use
+	references(edit []string) []string
+	// declared reports whether the file itself declares name
+	declared(name string, lines []string) bool
+	// resolve finds the import providing name
+	resolve(name string, lines []string, known []imported) (imported, bool)
+	// insert adds the import statements of missing to lines
+	insert(lines []string, missing []imported) []string
+}
+
+var identifierPattern = regexp.MustCompile(`[A-Za-z_$][A-Za-z0-9_$]*`)
+
+// qualifierPattern matches a lowercase name followed by a selector, as in
+// pkg.Name or module.attr, not itself preceded by a selector.
+var qualifierPattern = regexp.MustCompile(`(^|[^.\w$])([a-z_][a-z0-9_]*)\.[A-Za-z_]`)
+
+// qualifiers returns the names used as qualifiers in lines, in order of first use.
+func qualifiers(lines []string) []string {
+	var names []string
+	for _, line := range lines {
+		for _, m := range qualifierPattern.FindAllStringSubmatch(stripStrings(line), -1) {
+			if !slices.Contains(names, m[2]) {
+				names = append(names, m[2])
+			}
+		}
+	}
+	return names
+}
+
+// onlyQualifier reports whether every occurrence of name in lines outside
+// string literals is followed by a selector, so it is not a local variable
+// holding a value with fields.
+func onlyQualifier(name string, lines []string) bool {
+	pattern := regexp.MustCompile(`(^|[^\w$.])` + regexp.QuoteMeta(name) + `\b(.?)`)
+	for _, line := range lines {
+		for _, m := range pattern.FindAllStringSubmatch(stripStrings(line), -1) {
+			if m[2] != "." {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// stringPattern matches string literals on one line.
+var stringPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|` + "`[^`]*`")
+
+// stripStrings blanks out the string literals of line.
+func stripStrings(line string) string {
+	return stringPattern.ReplaceAllStringFunc(line, func(s string) string {
+		return strings.Repeat(" ", len(s))
+	})
+}
+
+// statementsFor returns the import statements of missing. Names with a member
+// share the statement of the first name of their module, extended by join.
+func statementsFor(missing []imported, join func(stmt, member string) string) []string {
+	var stmts []string
+	shared := make(map[string]int)
+	for _, imp := range missing {
+		if imp.member == "" {
+			stmts = append(stmts, imp.line)
+			continue
+		}
+		if i, ok := shared[imp.module]; ok {
+			stmts[i] = join(stmts[i], imp.member)
+			continue
+		}
+		shared[imp.module] = len(stmts)
+		stmts = append(stmts, imp.line)
+	}
+	return stmts
+}
+
+// relativeTo rewrites a relative module specifier used by the file at
+// otherPath so it points to the same file from filePath. ok is false for
+// specifiers that leave the workspace.
+func relativeTo(filePath, otherPath, spec string) (string, bool) {
+	target := path.Join(path.Dir(otherPath), spec)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return "", false
+	}
+	from := strings.Split(path.Dir(filePath), "/")
+	to := strings.Split(target, "/")
+	if from[0] == "." {
+		from = nil
+	}
+	common := 0
+	for common < len(from) && common < len(to)-1 && from[common] == to[common] {
+		common++
+	}
+	parts := make([]string, 0, len(from)-common+len(to)-common)
+	for range from[common:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, to[common:]...)
+	rel := strings.Join(parts, "/")
+	if !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel, true
+}
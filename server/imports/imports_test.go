@@ -0,0 +1,75 @@
+package imports
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestApplyEdits(t *testing.T) {
+	lines := []string{"package main", "", "func main() {}"}
+	edits := []TextEdit{{StartLine: 1, StartCol: 0, EndLine: 1, EndCol: 0, NewText: "import \"fmt\"\n"}}
+
+	got, err := ApplyEdits(lines, edits, "utf-16")
+
+	assert.NoError(t, err, "apply")
+	assert.Equal(t, []string{"package main", "import \"fmt\"", "", "func main() {}"}, got, "lines")
+}
+
+func TestApplyEdits_Encodings(t *testing.T) {
+	lines := []string{"s := \"😀\" + x"}
+	tests := []struct {
+		encoding string
+		col      int
+	}{
+		{"utf-8", 14},
+		{"utf-16", 12},
+		{"utf-32", 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			edits := []TextEdit{{StartLine: 0, StartCol: tt.col, EndLine: 0, EndCol: tt.col + 1, NewText: "y"}}
+			got, err := ApplyEdits(lines, edits, tt.encoding)
+			assert.NoError(t, err, "apply")
+			assert.Equal(t, []string{"s := \"😀\" + y"}, got, "lines")
+		})
+	}
+}
+
+func TestApplyEdits_Errors(t *testing.T) {
+	lines := []string{"a", "b"}
+
+	_, err := ApplyEdits(lines, []TextEdit{{StartLine: 5, EndLine: 5}}, "utf-16")
+	assert.Error(t, err, "line out of range")
+
+	_, err = ApplyEdits(lines, []TextEdit{
+		{StartLine: 0, StartCol: 0, EndLine: 1, EndCol: 1},
+		{StartLine: 0, StartCol: 1, EndLine: 0, EndCol: 1, NewText: "x"},
+	}, "utf-16")
+	assert.Error(t, err, "overlapping edits")
+}
+
+func TestAdd_UnsupportedLanguage(t *testing.T) {
+	_, ok := Add("notes.txt", []string{"fmt.Println()"}, 1, 1, nil)
+
+	assert.False(t, ok, "nothing added")
+}
+
+func TestRelativeTo(t *testing.T) {
+	tests := []struct {
+		file, other, spec string
+		want              string
+		ok                bool
+	}{
+		{"src/a.ts", "src/b.ts", "./c", "./c", true},
+		{"src/ui/a.ts", "src/b.ts", "./c", "../c", true},
+		{"src/a.ts", "src/ui/b.ts", "../lib/c", "./lib/c", true},
+		{"a.ts", "src/b.ts", "./c", "./src/c", true},
+		{"src/a.ts", "b.ts", "../outside", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := relativeTo(tt.file, tt.other, tt.spec)
+		assert.Equal(t, tt.ok, ok, tt.file+" from "+tt.other)
+		assert.Equal(t, tt.want, got, tt.file+" from "+tt.other)
+	}
+}
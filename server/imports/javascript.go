@@ -0,0 +1,182 @@
+package imports
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// jsImportPattern matches an import statement with a from clause.
+	jsImportPattern = regexp.MustCompile(`^import\s+(type\s+)?(.*?)\s*from\s*(['"])([^'"]+)['"]\s*(;?)`)
+	// jsCompletePattern matches an import statement that is complete: one
+	// with a from clause or a side-effect import.
+	jsCompletePattern = regexp.MustCompile(`from\s*['"][^'"]*['"]|^import\s*['"]`)
+	jsCommentPattern  = regexp.MustCompile(`//.*$`)
+)
+
+type javascript struct{}
+
+func (javascript) handles(p string) bool {
+	switch path.Ext(p) {
+	case ".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs", ".mts", ".cts":
+		return true
+	}
+	return false
+}
+
+// jsStatements returns the top-level import statements of lines, each on one
+// line, with the index of the line each ends on.
+func jsStatements(lines []string) ([]string, []int) {
+	var stmts []string
+	var ends []int
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "import ") && !strings.HasPrefix(lines[i], "import{") {
+			continue
+		}
+		stmt := strings.TrimSpace(lines[i])
+		for !jsCompletePattern.MatchString(stmt) && i+1 < len(lines) {
+			i++
+			stmt += " " + strings.TrimSpace(lines[i])
+		}
+		stmts = append(stmts, stmt)
+		ends = append(ends, i)
+	}
+	return stmts, ends
+}
+
+func (javascript) imports(filePath, otherPath string, lines []string) []imported {
+	stmts, _ := jsStatements(lines)
+	var result []imported
+	for _, stmt := range stmts {
+		m := jsImportPattern.FindStringSubmatch(stmt)
+		if m == nil {
+			continue
+		}
+		typePrefix, clause, quote, spec, semi := m[1], m[2], m[3], m[4], m[5]
+		if strings.HasPrefix(spec, ".") {
+			var ok bool
+			if spec, ok = relativeTo(filePath, otherPath, spec); !ok {
+				continue
+			}
+		}
+		from := " from " + quote + spec + quote + semi
+
+		// A default import comes first, then a namespace or named imports
+		if !strings.HasPrefix(clause, "{") && !strings.HasPrefix(clause, "*") {
+			name, rest, _ := strings.Cut(clause, ",")
+			name = strings.TrimSpace(name)
+			result = append(result, imported{name: name, module: spec, line: "import " + typePrefix + name + from})
+			clause = strings.TrimSpace(rest)
+		}
+		if ns, ok := strings.CutPrefix(clause, "*"); ok {
+			if name, ok := strings.CutPrefix(strings.TrimSpace(ns), "as "); ok {
+				name = strings.TrimSpace(name)
+				result = append(result, imported{name: name, module: spec, line: "import " + typePrefix + "* as " + name + from})
+			}
+			continue
+		}
+		named := strings.Trim(clause, "{} ")
+		for _, member := range strings.Split(named, ",") {
+			member = strings.Join(strings.Fields(member), " ")
+			if member == "" {
+				continue
+			}
+			fields := strings.Fields(member)
+			name := fields[len(fields)-1]
+			result = append(result, imported{
+				name:   name,
+				module: typePrefix + spec,
+				line:   "import " + typePrefix + "{ " + member + " }" + from,
+				member: member,
+			})
+		}
+	}
+	return result
+}
+
+// jsCode strips the strings and line comment of a line.
+func jsCode(line string) string {
+	return jsCommentPattern.ReplaceAllString(stripStrings(line), "")
+}
+
+// references returns the names in edit not preceded by a selector.
+func (javascript) references(edit []string) []string {
+	var names []string
+	for _, line := range edit {
+		code := jsCode(line)
+		for _, m := range identifierPattern.FindAllStringIndex(code, -1) {
+			name := code[m[0]:m[1]]
+			if m[0] > 0 && code[m[0]-1] == '.' || slices.Contains(names, name) {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// declared reports whether the file declares name as a function, class,
+// variable, type or arrow function parameter.
+func (javascript) declared(name string, lines []string) bool {
+	q := regexp.QuoteMeta(name)
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(`(?:^|[^\w$])(?:function\*?|class|const|let|var|interface|type|enum|namespace)\s+` + q + `(?:[^\w$]|$)`),
+		regexp.MustCompile(`(?:^|[^\w$])` + q + `\s*=>`),
+	}
+	for _, line := range lines {
+		code := jsCode(line)
+		for _, p := range patterns {
+			if p.MatchString(code) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (javascript) resolve(name string, _ []string, known []imported) (imported, bool) {
+	for _, imp := range known {
+		if imp.name == name {
+			return imp, true
+		}
+	}
+	return imported{}, false
+}
+
+// insert adds the statements after the last top-level import, or else after
+// the leading comments and directives. Named imports from the same module
+// share a statement.
+func (javascript) insert(lines []string, missing []imported) []string {
+	stmts := statementsFor(missing, func(stmt, member string) string {
+		return strings.Replace(stmt, " } from ", ", "+member+" } from ", 1)
+	})
+
+	if _, ends := jsStatements(lines); len(ends) > 0 {
+		return slices.Insert(slices.Clone(lines), ends[len(ends)-1]+1, stmts...)
+	}
+
+	at := 0
+	inComment := false
+	for at < len(lines) {
+		trimmed := strings.TrimSpace(lines[at])
+		switch {
+		case inComment:
+			inComment = !strings.Contains(trimmed, "*/")
+		case strings.HasPrefix(trimmed, "/*"):
+			inComment = !strings.Contains(trimmed, "*/")
+		case strings.HasPrefix(trimmed, "//"), strings.HasPrefix(trimmed, `"use `), strings.HasPrefix(trimmed, "'use "):
+		default:
+			if at > 0 {
+				stmts = append([]string{""}, stmts...)
+			}
+			if trimmed != "" {
+				stmts = append(stmts, "")
+			}
+			return slices.Insert(slices.Clone(lines), at, stmts...)
+		}
+		at++
+	}
+	return append(slices.Clone(lines), stmts...)
+}
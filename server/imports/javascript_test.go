@@ -0,0 +1,65 @@
+package imports
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestAdd_JSFromOtherFiles(t *testing.T) {
+	lines := []string{
+		"import React from 'react';",
+		"",
+		"export function App() {",
+		"  const [x, setX] = useState(0);",
+		"  return <Button onClick={() => setX(x + 1)} />;",
+		"}",
+	}
+	others := map[string][]string{
+		"src/components/Form.tsx": {
+			"import { useState, useEffect } from 'react';",
+			"import { Button } from '../ui/Button';",
+		},
+	}
+
+	got, ok := Add("src/App.tsx", lines, 4, 5, others)
+
+	assert.True(t, ok, "added")
+	assert.Equal(t, []string{
+		"import React from 'react';",
+		"import { useState } from 'react';",
+		"import { Button } from './ui/Button';",
+		"",
+	}, got[:4], "imports with specifiers relative to the file")
+}
+
+func TestAdd_JSSharesStatement(t *testing.T) {
+	lines := []string{"const a = map(filter(xs));"}
+	others := map[string][]string{
+		"b.js": {"import {", "  filter,", "  map,", "} from \"lodash\""},
+	}
+
+	got, ok := Add("a.js", lines, 1, 1, others)
+
+	assert.True(t, ok, "added")
+	assert.Equal(t, []string{"import { map, filter } from \"lodash\"", "", "const a = map(filter(xs));"}, got, "one statement")
+}
+
+func TestAdd_JSAfterDirective(t *testing.T) {
+	lines := []string{"'use client';", "export const a = clsx('x');"}
+	others := map[string][]string{"b.ts": {"import clsx from 'clsx';"}}
+
+	got, ok := Add("a.ts", lines, 2, 2, others)
+
+	assert.True(t, ok, "added")
+	assert.Equal(t, []string{"'use client';", "", "import clsx from 'clsx';", "", "export const a = clsx('x');"}, got, "lines")
+}
+
+func TestAdd_JSSkipsDeclared(t *testing.T) {
+	lines := []string{"function Button() {}", "const b = Button();"}
+	others := map[string][]string{"b.ts": {"import { Button } from './Button';"}}
+
+	_, ok := Add("a.ts", lines, 2, 2, others)
+
+	assert.False(t, ok, "declared in the file")
+}
@@ -0,0 +1,183 @@
+package imports
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// pythonStdlib lists commonly used standard library modules.
+var pythonStdlib = map[string]bool{
+	"abc": true, "argparse": true, "asyncio": true, "base64": true, "bisect": true,
+	"collections": true, "contextlib": true, "copy": true, "csv": true, "dataclasses": true,
+	"datetime": true, "decimal": true, "enum": true, "functools": true, "glob": true,
+	"hashlib": true, "heapq": true, "inspect": true, "io": true, "itertools": true,
+	"json": true, "logging": true, "math": true, "operator": true, "os": true,
+	"pathlib": true, "pickle": true, "platform": true, "random": true, "re": true,
+	"shutil": true, "signal": true, "socket": true, "statistics": true, "string": true,
+	"struct": true, "subprocess": true, "sys": true, "tempfile": true, "textwrap": true,
+	"threading": true, "time": true, "traceback": true, "typing": true, "unittest": true,
+	"urllib": true, "uuid": true,
+}
+
+var (
+	pythonImportPattern = regexp.MustCompile(`^import\s+(.+)$`)
+	pythonFromPattern   = regexp.MustCompile(`^from\s+(\S+)\s+import\s+\(?([^)]*)\)?`)
+)
+
+type python struct{}
+
+func (python) handles(p string) bool {
+	return path.Ext(p) == ".py"
+}
+
+// pythonStatements returns the top-level import statements of lines, each
+// on one line, with the index of the line each ends on.
+func pythonStatements(lines []string) ([]string, []int) {
+	var stmts []string
+	var ends []int
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "import ") && !strings.HasPrefix(lines[i], "from ") {
+			continue
+		}
+		stmt := strings.TrimSuffix(strings.TrimSpace(lines[i]), "\\")
+		for (strings.Contains(stmt, "(") && !strings.Contains(stmt, ")") || strings.HasSuffix(strings.TrimSpace(lines[i]), "\\")) && i+1 < len(lines) {
+			i++
+			stmt += " " + strings.TrimSuffix(strings.TrimSpace(lines[i]), "\\")
+		}
+		stmts = append(stmts, stmt)
+		ends = append(ends, i)
+	}
+	return stmts, ends
+}
+
+func (python) imports(filePath, otherPath string, lines []string) []imported {
+	stmts, _ := pythonStatements(lines)
+	var result []imported
+	for _, stmt := range stmts {
+		if m := pythonFromPattern.FindStringSubmatch(stmt); m != nil {
+			module := m[1]
+			if strings.HasPrefix(module, ".") && path.Dir(filePath) != path.Dir(otherPath) {
+				continue
+			}
+			for _, part := range strings.Split(m[2], ",") {
+				fields := strings.Fields(part)
+				switch {
+				case len(fields) == 1 && fields[0] != "*":
+					result = append(result, pythonFrom(fields[0], module, fields[0]))
+				case len(fields) == 3 && fields[1] == "as":
+					result = append(result, pythonFrom(fields[2], module, strings.Join(fields, " ")))
+				}
+			}
+			continue
+		}
+		if m := pythonImportPattern.FindStringSubmatch(stmt); m != nil {
+			for _, part := range strings.Split(m[1], ",") {
+				fields := strings.Fields(part)
+				switch {
+				case len(fields) == 1:
+					name, _, _ := strings.Cut(fields[0], ".")
+					result = append(result, imported{name: name, module: fields[0], line: "import " + fields[0]})
+				case len(fields) == 3 && fields[1] == "as":
+					result = append(result, imported{name: fields[2], module: fields[0], line: "import " + strings.Join(fields, " ")})
+				}
+			}
+		}
+	}
+	return result
+}
+
+func pythonFrom(name, module, member string) imported {
+	return imported{name: name, module: module, line: "from " + module + " import " + member, member: member}
+}
+
+// pythonCode strips the strings and comment of a line.
+func pythonCode(line string) string {
+	line = stripStrings(line)
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	return line
+}
+
+// references returns the names in edit not preceded by a selector.
+func (python) references(edit []string) []string {
+	var names []string
+	for _, line := range edit {
+		code := pythonCode(line)
+		for _, m := range identifierPattern.FindAllStringIndex(code, -1) {
+			name := code[m[0]:m[1]]
+			if m[0] > 0 && code[m[0]-1] == '.' || strings.Contains(name, "$") || slices.Contains(names, name) {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// declared reports whether the file binds name: as a function, class,
+// parameter, loop or with target, or by assignment.
+func (python) declared(name string, lines []string) bool {
+	q := regexp.QuoteMeta(name)
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(`\b(?:def|class|as|for|lambda|global|nonlocal)\s+` + q + `\b`),
+		regexp.MustCompile(`^\s*` + q + `\s*(?::[^=]*)?=[^=]`),
+		regexp.MustCompile(`^\s*(?:async\s+)?def\s+\w+\s*\(.*\b` + q + `\b`),
+	}
+	for _, line := range lines {
+		code := pythonCode(line)
+		for _, p := range patterns {
+			if p.MatchString(code) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (python) resolve(name string, lines []string, known []imported) (imported, bool) {
+	for _, imp := range known {
+		if imp.name == name {
+			return imp, true
+		}
+	}
+	if pythonStdlib[name] && onlyQualifier(name, lines) {
+		return imported{name: name, module: name, line: "import " + name}, true
+	}
+	return imported{}, false
+}
+
+// insert adds the statements after the last top-level import, or else after
+// the leading comments and module docstring. Names imported from the same
+// module share a statement.
+func (python) insert(lines []string, missing []imported) []string {
+	stmts := statementsFor(missing, func(stmt, member string) string { return stmt + ", " + member })
+
+	if _, ends := pythonStatements(lines); len(ends) > 0 {
+		return slices.Insert(slices.Clone(lines), ends[len(ends)-1]+1, stmts...)
+	}
+
+	at := 0
+	for at < len(lines) && strings.HasPrefix(lines[at], "#") {
+		at++
+	}
+	if at < len(lines) {
+		if quote := lines[at][:min(3, len(lines[at]))]; quote == `"""` || quote == "'''" {
+			end := at
+			if !strings.Contains(lines[at][3:], quote) {
+				for end+1 < len(lines) && !strings.Contains(lines[end+1], quote) {
+					end++
+				}
+				end++
+			}
+			at = min(end+1, len(lines))
+			stmts = append([]string{""}, stmts...)
+		}
+	}
+	if at < len(lines) && strings.TrimSpace(lines[at]) != "" {
+		stmts = append(stmts, "")
+	}
+	return slices.Insert(slices.Clone(lines), at, stmts...)
+}
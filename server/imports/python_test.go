@@ -0,0 +1,57 @@
+package imports
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestAdd_PythonStdlib(t *testing.T) {
+	lines := []string{"import sys", "", "def main():", "    print(os.getcwd(), sys.argv)"}
+
+	got, ok := Add("main.py", lines, 4, 4, nil)
+
+	assert.True(t, ok, "added")
+	assert.Equal(t, []string{"import sys", "import os", "", "def main():"}, got[:4], "added after the last import")
+}
+
+func TestAdd_PythonFromOtherFiles(t *testing.T) {
+	lines := []string{"import os", "", "x = Path(os.getcwd()) / Config.name"}
+	others := map[string][]string{
+		"app/util.py": {"from pathlib import Path", "from .settings import Config"},
+	}
+
+	got, ok := Add("main.py", lines, 3, 3, others)
+
+	assert.True(t, ok, "added")
+	assert.Equal(t, []string{"import os", "from pathlib import Path", ""}, got[:3], "relative import from another directory skipped")
+}
+
+func TestAdd_PythonSharesStatement(t *testing.T) {
+	lines := []string{"x: List[int] = cast(Any, y)"}
+	others := map[string][]string{
+		"a.py": {"from typing import (", "    Any,", "    List,", "    cast,", ")"},
+	}
+
+	got, ok := Add("main.py", lines, 1, 1, others)
+
+	assert.True(t, ok, "added")
+	assert.Equal(t, []string{"from typing import List, cast, Any", "", "x: List[int] = cast(Any, y)"}, got, "one statement")
+}
+
+func TestAdd_PythonAfterDocstring(t *testing.T) {
+	lines := []string{"#!/usr/bin/env python", `"""Tool."""`, "print(json.dumps({}))"}
+
+	got, ok := Add("tool.py", lines, 3, 3, nil)
+
+	assert.True(t, ok, "added")
+	assert.Equal(t, []string{"#!/usr/bin/env python", `"""Tool."""`, "", "import json", "", "print(json.dumps({}))"}, got, "lines")
+}
+
+func TestAdd_PythonSkipsDeclared(t *testing.T) {
+	lines := []string{"def f(os):", "    return os.sep"}
+
+	_, ok := Add("main.py", lines, 2, 2, nil)
+
+	assert.False(t, ok, "parameter shadows the module")
+}
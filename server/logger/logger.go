@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -36,8 +38,19 @@ var defaultLogger = &LimitedLogger{
 }
 
 // MaxLogLines defines the maximum number of lines to keep in the log file
+// when size-based rotation is disabled
 const MaxLogLines = 5000
 
+// cleanupInterval is how often rotated files are checked against MaxAge
+const cleanupInterval = time.Hour
+
+// RotationConfig bounds the log file and the rotated copies kept beside it.
+type RotationConfig struct {
+	MaxSize  int64         // Bytes before the file is rotated (0 trims to MaxLogLines instead)
+	MaxFiles int           // Rotated files kept as <path>.1 (newest) to <path>.N
+	MaxAge   time.Duration // Rotated files older than this are removed (0 keeps them)
+}
+
 // LogLevel represents the logging level
 type LogLevel int
 
@@ -91,23 +104,47 @@ type LimitedLogger struct {
 	lineCount int
 	level     LogLevel
 	mutex     sync.Mutex
+
+	// Size-based rotation (path is empty unless opened with NewRotatingLogger)
+	path     string
+	size     int64
+	rotation RotationConfig
+	stop     chan struct{}
 }
 
 // Global logger instance (atomic for safe concurrent access)
 var globalLoggerPtr atomic.Pointer[LimitedLogger]
 
-// NewLimitedLogger creates a new LimitedLogger
-func NewLimitedLogger(file *os.File, level LogLevel) *LimitedLogger {
-	ll := &LimitedLogger{
-		file:      file,
-		lineCount: 0,
-		level:     level,
+// NewRotatingLogger opens the log file at path and rotates it by size as
+// configured, or trims it to MaxLogLines without a MaxSize. Rotated files past MaxAge are removed at startup and hourly.
+func NewRotatingLogger(path string, level LogLevel, rotation RotationConfig) (*LimitedLogger, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
 	}
 
-	// Count existing lines in the file
-	ll.countExistingLines()
+	ll := &LimitedLogger{
+		file:     f,
+		level:    level,
+		path:     path,
+		size:     info.Size(),
+		rotation: rotation,
+		stop:     make(chan struct{}),
+	}
+	if rotation.MaxSize <= 0 {
+		ll.countExistingLines()
+	}
+	if rotation.MaxAge > 0 {
+		ll.removeExpired(time.Now())
+		go ll.cleanupLoop()
+	}
 	globalLoggerPtr.Store(ll)
-	return ll
+	return ll, nil
 }
 
 // shouldLog returns true if the given level should be logged
@@ -197,6 +234,14 @@ func (ll *LimitedLogger) Write(p []byte) (n int, err error) {
 		return n, err
 	}
 
+	if ll.path != "" && ll.rotation.MaxSize > 0 {
+		ll.size += int64(n)
+		if ll.size > ll.rotation.MaxSize {
+			ll.rotateBySize()
+		}
+		return n, err
+	}
+
 	// Count newlines in the written data
 	newlines := strings.Count(string(p), "\n")
 	ll.lineCount += newlines
@@ -209,6 +254,74 @@ func (ll *LimitedLogger) Write(p []byte) (n int, err error) {
 	return n, err
 }
 
+// rotateBySize moves the log file to <path>.1, shifting older rotated files
+// up and dropping those past MaxFiles, then starts a new file. Without
+// rotated files the log is truncated instead. Caller must hold ll.mutex.
+func (ll *LimitedLogger) rotateBySize() {
+	if ll.rotation.MaxFiles <= 0 {
+		if ll.file.Truncate(0) == nil {
+			ll.file.Seek(0, io.SeekStart)
+			ll.size = 0
+		}
+		return
+	}
+
+	ll.closeFile()
+	os.Remove(rotatedPath(ll.path, ll.rotation.MaxFiles))
+	for i := ll.rotation.MaxFiles - 1; i >= 1; i-- {
+		os.Rename(rotatedPath(ll.path, i), rotatedPath(ll.path, i+1))
+	}
+	os.Rename(ll.path, rotatedPath(ll.path, 1))
+
+	f, err := os.OpenFile(ll.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		// Keep logging somewhere rather than failing every write; the next
+		// rotation tries the file again
+		ll.file = os.Stderr
+		ll.size = 0
+		return
+	}
+	ll.file = f
+	ll.size = 0
+}
+
+func rotatedPath(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
+
+// cleanupLoop removes expired rotated files until the logger is closed.
+func (ll *LimitedLogger) cleanupLoop() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			ll.removeExpired(now)
+		case <-ll.stop:
+			return
+		}
+	}
+}
+
+// removeExpired deletes rotated files last written before now - MaxAge.
+func (ll *LimitedLogger) removeExpired(now time.Time) {
+	ll.mutex.Lock()
+	defer ll.mutex.Unlock()
+
+	matches, err := filepath.Glob(ll.path + ".*")
+	if err != nil {
+		return
+	}
+	for _, match := range matches {
+		if _, err := strconv.Atoi(strings.TrimPrefix(match, ll.path+".")); err != nil {
+			continue
+		}
+		if info, err := os.Stat(match); err == nil && now.Sub(info.ModTime()) > ll.rotation.MaxAge {
+			os.Remove(match)
+		}
+	}
+}
+
 // rotateLogFile trims the log file to keep only the last MaxLogLines/2 lines.
 // Scans bytes from the end to find the cut point, avoiding loading all lines into memory.
 func (ll *LimitedLogger) rotateLogFile() {
@@ -260,7 +373,21 @@ found:
 	ll.lineCount = keepLines
 }
 
-// Close closes the underlying file
+// Close stops the cleanup of rotated files and closes the underlying file
 func (ll *LimitedLogger) Close() error {
+	if ll.stop != nil {
+		close(ll.stop)
+	}
+	ll.mutex.Lock()
+	defer ll.mutex.Unlock()
+	return ll.closeFile()
+}
+
+// closeFile closes the log file. Stderr, the fallback when the file cannot be
+// opened, is left open. Caller must hold ll.mutex.
+func (ll *LimitedLogger) closeFile() error {
+	if ll.file == os.Stderr {
+		return nil
+	}
 	return ll.file.Close()
 }
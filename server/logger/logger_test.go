@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+)
+
+func TestRotatingLogger_RotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursortab.log")
+	ll, err := NewRotatingLogger(path, LogLevelInfo, RotationConfig{MaxSize: 10, MaxFiles: 2})
+	assert.NoError(t, err, "open")
+	defer ll.Close()
+
+	for _, line := range []string{"first line\n", "second line\n", "third line\n", "fourth\n"} {
+		_, err := ll.Write([]byte(line))
+		assert.NoError(t, err, "write")
+	}
+
+	current, _ := os.ReadFile(path)
+	newest, _ := os.ReadFile(path + ".1")
+	oldest, _ := os.ReadFile(path + ".2")
+	assert.Equal(t, "fourth\n", string(current), "current file")
+	assert.Equal(t, "third line\n", string(newest), "newest rotated")
+	assert.Equal(t, "second line\n", string(oldest), "oldest rotated")
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "files past MaxFiles dropped")
+}
+
+func TestRotatingLogger_TruncatesWithoutRotatedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursortab.log")
+	ll, err := NewRotatingLogger(path, LogLevelInfo, RotationConfig{MaxSize: 10})
+	assert.NoError(t, err, "open")
+	defer ll.Close()
+
+	ll.Write([]byte(strings.Repeat("x", 20) + "\n"))
+	ll.Write([]byte("kept\n"))
+
+	current, _ := os.ReadFile(path)
+	assert.Equal(t, "kept\n", string(current), "truncated")
+}
+
+func TestRotatingLogger_RemovesExpiredFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cursortab.log")
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"cursortab.log.1", "cursortab.log.2", "cursortab.log.bak"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644), "write "+name)
+	}
+	os.Chtimes(filepath.Join(dir, "cursortab.log.2"), old, old)
+	os.Chtimes(filepath.Join(dir, "cursortab.log.bak"), old, old)
+
+	ll, err := NewRotatingLogger(path, LogLevelInfo, RotationConfig{MaxSize: 1 << 20, MaxFiles: 2, MaxAge: 24 * time.Hour})
+	assert.NoError(t, err, "open")
+	defer ll.Close()
+
+	_, err = os.Stat(path + ".1")
+	assert.NoError(t, err, "recent rotated file kept")
+	_, err = os.Stat(path + ".2")
+	assert.True(t, os.IsNotExist(err), "expired rotated file removed")
+	_, err = os.Stat(path + ".bak")
+	assert.NoError(t, err, "unrelated file kept")
+}
+
+func TestRotatingLogger_StderrFallbackNeverClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursortab.log")
+	ll, err := NewRotatingLogger(path, LogLevelInfo, RotationConfig{MaxSize: 10, MaxFiles: 1})
+	assert.NoError(t, err, "open")
+
+	// As after a rotation that could not reopen the file
+	ll.file.Close()
+	ll.file = os.Stderr
+	ll.size = 0
+
+	ll.Write([]byte("to stderr, then rotated\n"))
+	ll.Write([]byte("back\n"))
+	assert.NoError(t, ll.Close(), "close")
+
+	current, _ := os.ReadFile(path)
+	assert.Equal(t, "back\n", string(current), "file reopened by the next rotation")
+	_, err = os.Stderr.Stat()
+	assert.NoError(t, err, "stderr still open")
+}
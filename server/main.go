@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cursortab/engine"
 	"cursortab/logger"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 // CursorPredictionConfig holds cursor prediction settings
@@ -18,16 +20,67 @@ type CursorPredictionConfig struct {
 	Enabled            bool `json:"enabled"`
 	AutoAdvance        bool `json:"auto_advance"`
 	ProximityThreshold int  `json:"proximity_threshold"`
+	CursorOnly         bool `json:"cursor_only"`
+	PrefetchDepth      int  `json:"prefetch_depth"`
+}
+
+// StagingConfig holds settings for splitting completions into stages
+type StagingConfig struct {
+	Order string `json:"order"` // "cursor", "top_down", "dependency"
+}
+
+// RenamePropagationConfig holds settings for renaming the other occurrences
+// of an identifier renamed by an accepted completion
+type RenamePropagationConfig struct {
+	Enabled   bool `json:"enabled"`
+	Workspace bool `json:"workspace"` // also rename in other workspace files (needs ripgrep)
+}
+
+// TestFailuresConfig holds settings for passing the failing tests of the
+// latest test run to the provider
+type TestFailuresConfig struct {
+	File    string `json:"file"`    // test run output, relative to the project root ("" to disable)
+	Command string `json:"command"` // prints the test run output, read instead of file
 }
 
 // BehaviorConfig holds timing and behavior settings
 type BehaviorConfig struct {
-	IdleCompletionDelay int                    `json:"idle_completion_delay"` // in milliseconds
-	TextChangeDebounce  int                    `json:"text_change_debounce"`  // in milliseconds
-	MaxVisibleLines     int                    `json:"max_visible_lines"`     // max visible lines per completion (0 to disable)
-	CursorPrediction    CursorPredictionConfig `json:"cursor_prediction"`
-	CompleteInInsert    bool                   `json:"complete_in_insert"`
-	CompleteInNormal    bool                   `json:"complete_in_normal"`
+	IdleCompletionDelay int                     `json:"idle_completion_delay"` // in milliseconds
+	TextChangeDebounce  int                     `json:"text_change_debounce"`  // in milliseconds
+	ScanDelay           int                     `json:"scan_delay"`            // in milliseconds, idle time before requesting completions away from the cursor (0 to disable)
+	TriggerPolicy       string                  `json:"trigger_policy"`        // "insert_change", "manual", "idle_only", "normal_mode_too"
+	MaxVisibleLines     int                     `json:"max_visible_lines"`     // max visible lines per completion (0 to disable)
+	MaxCompletionLines  int                     `json:"max_completion_lines"`  // completions larger than this are chunked or dropped (0 to disable)
+	OversizedCompletion string                  `json:"oversized_completion"`  // "chunk", "drop"
+	PasteCompletion     string                  `json:"paste_completion"`      // "skip", "delay", "clean_up", "complete"
+	PasteDelay          int                     `json:"paste_delay"`           // in milliseconds, quiet time before the request following a paste under "delay"
+	StickyLines         int                     `json:"sticky_lines"`          // keep completions while the cursor moves this many lines away in normal mode (0 to disable)
+	MaxBufferSize       int                     `json:"max_buffer_size"`       // in kilobytes, larger buffers get no completions (0 to disable)
+	DisplayTTL          int                     `json:"display_ttl"`           // in milliseconds, auto-dismiss shown completions (0 to disable)
+	CacheTTL            int                     `json:"cache_ttl"`             // in milliseconds, reuse responses for an identical context (0 to disable)
+	CacheMaxEntries     int                     `json:"cache_max_entries"`     // max cached responses (0 to disable)
+	PersistentCache     bool                    `json:"persistent_cache"`      // keep cached responses and edit history across restarts
+	QualityLog          bool                    `json:"quality_log"`           // log requests and their outcomes locally
+	Telemetry           bool                    `json:"telemetry"`             // send shown/accepted/rejected events to the provider backend
+	MetricsLog          bool                    `json:"metrics_log"`           // append metrics events to a local JSON-lines file
+	CursorPrediction    CursorPredictionConfig  `json:"cursor_prediction"`
+	Staging             StagingConfig           `json:"staging"`
+	RenamePropagation   RenamePropagationConfig `json:"rename_propagation"`
+	TestFailures        TestFailuresConfig      `json:"test_failures"`
+	Placeholders        bool                    `json:"placeholders"`      // cycle the accept keys through the variable parts of an accepted completion
+	AutoImport          bool                    `json:"auto_import"`       // offer the imports an accepted completion is missing
+	FixDiagnostics      bool                    `json:"fix_diagnostics"`   // ask idle requests on a line with an LSP error to fix it
+	OpenFolds           bool                    `json:"open_folds"`        // open closed folds hiding a stage instead of pointing at their first line
+	IgnorePaths         []string                `json:"ignore_paths"`      // gitignore-style patterns for files kept out of context
+	IgnoreGitignored    bool                    `json:"ignore_gitignored"` // also keep files matched by .gitignore out of context
+	RootMarkers         []string                `json:"root_markers"`      // files marking a project root, searched upward from each buffer
+	RedactSecrets       bool                    `json:"redact_secrets"`    // replace credentials with placeholders before requests are sent
+	RedactPatterns      []string                `json:"redact_patterns"`   // extra regular expressions for redact_secrets
+	WordDiff            bool                    `json:"word_diff"`         // highlight the changed words of modified lines
+	InlineDiff          bool                    `json:"inline_diff"`       // show word edits of modified lines in place instead of beside them
+	ColumnUnit          string                  `json:"column_unit"`       // "byte", "char", "cell": unit of columns sent to the editor
+	CompleteInInsert    bool                    `json:"complete_in_insert"`
+	CompleteInNormal    bool                    `json:"complete_in_normal"`
 }
 
 // FIMTokensConfig holds FIM token settings
@@ -39,18 +92,54 @@ type FIMTokensConfig struct {
 
 // ProviderConfig holds provider-specific settings
 type ProviderConfig struct {
-	Type                 string          `json:"type"` // "inline", "fim", "sweep", "sweepapi", "zeta", "copilot", "mercuryapi"
-	URL                  string          `json:"url"`
-	ApiKeyEnv            string          `json:"api_key_env"` // Environment variable name for API key
-	Model                string          `json:"model"`
-	Temperature          float64         `json:"temperature"`
-	MaxTokens            int             `json:"max_tokens"` // Max tokens to generate (also drives input trimming)
-	TopK                 int             `json:"top_k"`
-	CompletionTimeout    int             `json:"completion_timeout"` // in milliseconds
-	MaxDiffHistoryTokens int             `json:"max_diff_history_tokens"`
-	CompletionPath       string          `json:"completion_path"`
-	FIMTokens            FIMTokensConfig `json:"fim_tokens"`
-	PrivacyMode          bool            `json:"privacy_mode"`
+	Type                 string               `json:"type"` // "inline", "fim", "sweep", "sweepapi", "zeta", "copilot", "mercuryapi", "ollama", "chat", "gemini", "anthropic"
+	URL                  string               `json:"url"`
+	Transport            string               `json:"transport"`   // "http", "grpc" (sweepapi only) or "websocket"
+	ApiKeyEnv            string               `json:"api_key_env"` // Environment variable name for API key
+	Model                string               `json:"model"`
+	Temperature          float64              `json:"temperature"`
+	MaxTokens            int                  `json:"max_tokens"` // Max tokens to generate (also drives input trimming)
+	TopK                 int                  `json:"top_k"`
+	Seed                 int                  `json:"seed"`               // Sampling seed for local providers (0 = server default, -1 = random per request)
+	CompletionTimeout    int                  `json:"completion_timeout"` // in milliseconds
+	MaxDiffHistoryTokens int                  `json:"max_diff_history_tokens"`
+	CompletionPath       string               `json:"completion_path"`
+	FIMTokens            FIMTokensConfig      `json:"fim_tokens"`
+	SystemPrompt         string               `json:"system_prompt"`  // System prompt for chat providers ({prefix}/{suffix}/{middle} expand to fim_tokens)
+	StopSequences        []string             `json:"stop_sequences"` // Extra stop sequences for chat providers
+	PrivacyMode          bool                 `json:"privacy_mode"`
+	EOFPolicy            string               `json:"eof_policy"`              // "extend", "clamp", "reject": completions extending past the last line
+	TokenBudget          int                  `json:"token_budget"`            // Estimated tokens per minute before retriggers are held back (0 = unlimited)
+	MaxRequestsPerMinute int                  `json:"max_requests_per_minute"` // Requests per minute before completions queue (0 = unlimited)
+	MaxConcurrent        int                  `json:"max_concurrent_requests"` // Requests in flight at once (0 = unlimited)
+	CircuitBreaker       CircuitBreakerConfig `json:"circuit_breaker"`
+	ContextBudget        ContextBudgetConfig  `json:"context_budget"`
+	MaxPayloadBytes      int                  `json:"max_payload_bytes"` // Cap on the serialized request; context is trimmed to fit (0 = no cap)
+	ContextLimits        ContextLimitsConfig  `json:"context_limits"`
+	TokenizerVocab       string               `json:"tokenizer_vocab"` // tiktoken-format vocabulary counting the tokens context is trimmed to ("" = heuristic)
+	Options              map[string]any       `json:"options"`         // Generation parameters passed through with each request: "temperature", "top_p", "model", "headers"
+	Race                 []ProviderConfig     `json:"race"`            // Additional providers raced against this one (fastest non-empty wins)
+	Fallback             []ProviderConfig     `json:"fallback"`        // Providers to fail over to, in order, when this one times out or keeps failing
+}
+
+// ContextBudgetConfig shares a per-request token budget across context sources
+type ContextBudgetConfig struct {
+	MaxTokens int                `json:"max_tokens"` // Tokens for the current file and its context (0 = no budget)
+	Weights   map[string]float64 `json:"weights"`    // Share of the budget per source: "diff_history", "snapshots", "diagnostics", "git_diff", "lsp", "retrieval"
+}
+
+// ContextLimitsConfig overrides the input and output limits of a provider
+type ContextLimitsConfig struct {
+	MaxInputLines   int `json:"max_input_lines"`   // Lines of the current file sent (0 = provider default)
+	MaxInputBytes   int `json:"max_input_bytes"`   // Bytes of the current file and its context sent (0 = provider default)
+	MaxOutputTokens int `json:"max_output_tokens"` // Tokens to generate, leaving max_tokens to size the input (0 = max_tokens)
+}
+
+// CircuitBreakerConfig holds the settings of the circuit breaker that pauses
+// automatic requests to a failing provider
+type CircuitBreakerConfig struct {
+	Failures int `json:"failures"` // Consecutive failed requests that open the circuit (0 = never)
+	Cooldown int `json:"cooldown"` // ms requests are skipped before a probe is sent
 }
 
 // DebugConfig holds debug settings
@@ -58,16 +147,24 @@ type DebugConfig struct {
 	ImmediateShutdown bool `json:"immediate_shutdown"`
 }
 
+// LogRotationConfig bounds the size of the log directory
+type LogRotationConfig struct {
+	MaxSizeMB  int `json:"max_size_mb"`  // Rotate the log past this size (0 = keep the last lines instead)
+	MaxFiles   int `json:"max_files"`    // Rotated log files kept
+	MaxAgeDays int `json:"max_age_days"` // Remove rotated files older than this (0 = never)
+}
+
 // Config is the main configuration structure
 type Config struct {
-	NsID          int            `json:"ns_id"`
-	LogLevel      string         `json:"log_level"`
-	StateDir      string         `json:"state_dir"`
-	EditorVersion string         `json:"editor_version"`
-	EditorOS      string         `json:"editor_os"`
-	Behavior      BehaviorConfig `json:"behavior"`
-	Provider      ProviderConfig `json:"provider"`
-	Debug         DebugConfig    `json:"debug"`
+	NsID          int               `json:"ns_id"`
+	LogLevel      string            `json:"log_level"`
+	LogRotation   LogRotationConfig `json:"log_rotation"`
+	StateDir      string            `json:"state_dir"`
+	EditorVersion string            `json:"editor_version"`
+	EditorOS      string            `json:"editor_os"`
+	Behavior      BehaviorConfig    `json:"behavior"`
+	Provider      ProviderConfig    `json:"provider"`
+	Debug         DebugConfig       `json:"debug"`
 }
 
 // validateEnum checks that value is one of the valid options for the named field.
@@ -81,52 +178,222 @@ func validateEnum(value, field string, valid []string) error {
 // Validate checks that the config has valid values.
 // All config must come from the Lua client - no defaults are applied here.
 func (c *Config) Validate() error {
-	if err := validateEnum(c.Provider.Type, "provider.type", []string{"inline", "fim", "sweep", "sweepapi", "zeta", "copilot", "mercuryapi"}); err != nil {
+	if err := c.Provider.validate("provider"); err != nil {
+		return err
+	}
+	for i, race := range c.Provider.Race {
+		if len(race.Race) > 0 {
+			return fmt.Errorf("invalid provider.race[%d].race: racing providers cannot be nested", i+1)
+		}
+		if race.EOFPolicy != "" {
+			return fmt.Errorf("invalid provider.race[%d].eof_policy: racing providers use provider.eof_policy", i+1)
+		}
+		if err := race.validate(fmt.Sprintf("provider.race[%d]", i+1)); err != nil {
+			return err
+		}
+	}
+	for i, fallback := range c.Provider.Fallback {
+		if len(fallback.Race) > 0 || len(fallback.Fallback) > 0 {
+			return fmt.Errorf("invalid provider.fallback[%d]: fallback providers cannot race or fall back", i+1)
+		}
+		if fallback.EOFPolicy != "" {
+			return fmt.Errorf("invalid provider.fallback[%d].eof_policy: fallback providers use provider.eof_policy", i+1)
+		}
+		if err := fallback.validate(fmt.Sprintf("provider.fallback[%d]", i+1)); err != nil {
+			return err
+		}
+	}
+	if err := validateEnum(c.Behavior.ColumnUnit, "behavior.column_unit", []string{"byte", "char", "cell"}); err != nil {
+		return err
+	}
+	if err := validateEnum(c.Behavior.TriggerPolicy, "behavior.trigger_policy", []string{"insert_change", "manual", "idle_only", "normal_mode_too"}); err != nil {
+		return err
+	}
+	if err := validateEnum(c.Behavior.Staging.Order, "behavior.staging.order", []string{"cursor", "top_down", "dependency"}); err != nil {
 		return err
 	}
 	if err := validateEnum(c.LogLevel, "log_level", []string{"trace", "debug", "info", "warn", "error"}); err != nil {
 		return err
 	}
+	if c.LogRotation.MaxSizeMB < 0 || c.LogRotation.MaxFiles < 0 || c.LogRotation.MaxAgeDays < 0 {
+		return fmt.Errorf("invalid log_rotation: max_size_mb, max_files and max_age_days must be >= 0")
+	}
 
 	// Validate numeric ranges
 	if c.Behavior.IdleCompletionDelay < -1 {
 		return fmt.Errorf("invalid behavior.idle_completion_delay %d: must be >= -1", c.Behavior.IdleCompletionDelay)
 	}
+	if c.Behavior.ScanDelay < 0 {
+		return fmt.Errorf("invalid behavior.scan_delay %d: must be >= 0", c.Behavior.ScanDelay)
+	}
 	if c.Behavior.TextChangeDebounce < -1 {
 		return fmt.Errorf("invalid behavior.text_change_debounce %d: must be >= -1", c.Behavior.TextChangeDebounce)
 	}
 	if c.Behavior.MaxVisibleLines < 0 {
 		return fmt.Errorf("invalid behavior.max_visible_lines %d: must be >= 0", c.Behavior.MaxVisibleLines)
 	}
-	if c.Provider.MaxTokens < 0 {
-		return fmt.Errorf("invalid provider.max_tokens %d: must be >= 0", c.Provider.MaxTokens)
+	if c.Behavior.MaxCompletionLines < 0 {
+		return fmt.Errorf("invalid behavior.max_completion_lines %d: must be >= 0", c.Behavior.MaxCompletionLines)
+	}
+	if err := validateEnum(c.Behavior.OversizedCompletion, "behavior.oversized_completion", []string{"chunk", "drop"}); err != nil {
+		return err
+	}
+	if err := validateEnum(c.Behavior.PasteCompletion, "behavior.paste_completion", []string{"skip", "delay", "clean_up", "complete"}); err != nil {
+		return err
+	}
+	if c.Behavior.PasteDelay < 0 {
+		return fmt.Errorf("invalid behavior.paste_delay %d: must be >= 0", c.Behavior.PasteDelay)
+	}
+	if c.Behavior.CursorPrediction.PrefetchDepth < 1 {
+		return fmt.Errorf("invalid behavior.cursor_prediction.prefetch_depth %d: must be >= 1", c.Behavior.CursorPrediction.PrefetchDepth)
+	}
+	if c.Behavior.StickyLines < 0 {
+		return fmt.Errorf("invalid behavior.sticky_lines %d: must be >= 0", c.Behavior.StickyLines)
+	}
+	if c.Behavior.MaxBufferSize < 0 {
+		return fmt.Errorf("invalid behavior.max_buffer_size %d: must be >= 0", c.Behavior.MaxBufferSize)
+	}
+	if c.Behavior.DisplayTTL < 0 {
+		return fmt.Errorf("invalid behavior.display_ttl %d: must be >= 0", c.Behavior.DisplayTTL)
+	}
+	if c.Behavior.CacheTTL < 0 {
+		return fmt.Errorf("invalid behavior.cache_ttl %d: must be >= 0", c.Behavior.CacheTTL)
+	}
+	if c.Behavior.CacheMaxEntries < 0 {
+		return fmt.Errorf("invalid behavior.cache_max_entries %d: must be >= 0", c.Behavior.CacheMaxEntries)
+	}
+
+	return nil
+}
+
+// validate checks the provider settings, reporting errors under the given field prefix.
+func (p *ProviderConfig) validate(field string) error {
+	if err := validateEnum(p.Type, field+".type", []string{"inline", "fim", "sweep", "sweepapi", "zeta", "copilot", "mercuryapi", "ollama", "chat", "gemini", "anthropic"}); err != nil {
+		return err
+	}
+	if err := validateEnum(p.Transport, field+".transport", []string{"http", "grpc", "websocket"}); err != nil {
+		return err
+	}
+	if p.Transport == "grpc" && p.Type != "sweepapi" {
+		return fmt.Errorf("invalid %s.transport %q: only the sweepapi provider supports grpc", field, p.Transport)
+	}
+	if p.Transport == "websocket" && !slices.Contains([]string{"inline", "fim", "sweep", "zeta"}, p.Type) {
+		return fmt.Errorf("invalid %s.transport %q: only the inline, fim, sweep and zeta providers support websocket", field, p.Transport)
+	}
+	if err := validateEnum(p.EOFPolicy, field+".eof_policy", []string{"extend", "clamp", "reject"}); err != nil {
+		return err
+	}
+	if p.MaxTokens < 0 {
+		return fmt.Errorf("invalid %s.max_tokens %d: must be >= 0", field, p.MaxTokens)
+	}
+	if p.CompletionTimeout < 0 {
+		return fmt.Errorf("invalid %s.completion_timeout %d: must be >= 0", field, p.CompletionTimeout)
+	}
+	if p.MaxDiffHistoryTokens < 0 {
+		return fmt.Errorf("invalid %s.max_diff_history_tokens %d: must be >= 0", field, p.MaxDiffHistoryTokens)
+	}
+	if p.TokenBudget < 0 {
+		return fmt.Errorf("invalid %s.token_budget %d: must be >= 0", field, p.TokenBudget)
+	}
+	if p.MaxRequestsPerMinute < 0 {
+		return fmt.Errorf("invalid %s.max_requests_per_minute %d: must be >= 0", field, p.MaxRequestsPerMinute)
+	}
+	if p.MaxConcurrent < 0 {
+		return fmt.Errorf("invalid %s.max_concurrent_requests %d: must be >= 0", field, p.MaxConcurrent)
+	}
+	if p.CircuitBreaker.Failures < 0 {
+		return fmt.Errorf("invalid %s.circuit_breaker.failures %d: must be >= 0", field, p.CircuitBreaker.Failures)
+	}
+	if p.CircuitBreaker.Cooldown < 0 {
+		return fmt.Errorf("invalid %s.circuit_breaker.cooldown %d: must be >= 0", field, p.CircuitBreaker.Cooldown)
+	}
+	if p.ContextBudget.MaxTokens < 0 {
+		return fmt.Errorf("invalid %s.context_budget.max_tokens %d: must be >= 0", field, p.ContextBudget.MaxTokens)
+	}
+	for source, weight := range p.ContextBudget.Weights {
+		if err := validateEnum(source, field+".context_budget.weights key", []string{"diff_history", "snapshots", "diagnostics", "git_diff", "git_history", "lsp", "retrieval"}); err != nil {
+			return err
+		}
+		if weight < 0 {
+			return fmt.Errorf("invalid %s.context_budget.weights.%s %g: must be >= 0", field, source, weight)
+		}
 	}
-	if c.Provider.CompletionTimeout < 0 {
-		return fmt.Errorf("invalid provider.completion_timeout %d: must be >= 0", c.Provider.CompletionTimeout)
+	if p.MaxPayloadBytes < 0 {
+		return fmt.Errorf("invalid %s.max_payload_bytes %d: must be >= 0", field, p.MaxPayloadBytes)
 	}
-	if c.Provider.MaxDiffHistoryTokens < 0 {
-		return fmt.Errorf("invalid provider.max_diff_history_tokens %d: must be >= 0", c.Provider.MaxDiffHistoryTokens)
+	if err := p.ContextLimits.validate(field + ".context_limits"); err != nil {
+		return err
+	}
+	if err := validateProviderOptions(p.Options, field+".options"); err != nil {
+		return err
 	}
 
 	// Validate completion_path starts with /
-	if !strings.HasPrefix(c.Provider.CompletionPath, "/") {
-		return fmt.Errorf("invalid provider.completion_path %q: must start with /", c.Provider.CompletionPath)
+	if !strings.HasPrefix(p.CompletionPath, "/") {
+		return fmt.Errorf("invalid %s.completion_path %q: must start with /", field, p.CompletionPath)
 	}
 
 	// Validate fim_tokens fields are all non-empty
-	if c.Provider.FIMTokens.Prefix == "" {
-		return fmt.Errorf("invalid provider.fim_tokens.prefix: must be non-empty")
+	if p.FIMTokens.Prefix == "" {
+		return fmt.Errorf("invalid %s.fim_tokens.prefix: must be non-empty", field)
 	}
-	if c.Provider.FIMTokens.Suffix == "" {
-		return fmt.Errorf("invalid provider.fim_tokens.suffix: must be non-empty")
+	if p.FIMTokens.Suffix == "" {
+		return fmt.Errorf("invalid %s.fim_tokens.suffix: must be non-empty", field)
 	}
-	if c.Provider.FIMTokens.Middle == "" {
-		return fmt.Errorf("invalid provider.fim_tokens.middle: must be non-empty")
+	if p.FIMTokens.Middle == "" {
+		return fmt.Errorf("invalid %s.fim_tokens.middle: must be non-empty", field)
 	}
 
 	return nil
 }
 
+// validate checks that each limit set is at least the provider minimum.
+func (c ContextLimitsConfig) validate(field string) error {
+	limits := []struct {
+		name       string
+		value, min int
+	}{
+		{"max_input_lines", c.MaxInputLines, engine.MinContextLimits.MaxInputLines},
+		{"max_input_bytes", c.MaxInputBytes, engine.MinContextLimits.MaxInputBytes},
+		{"max_output_tokens", c.MaxOutputTokens, engine.MinContextLimits.MaxOutputTokens},
+	}
+	for _, l := range limits {
+		if l.value != 0 && l.value < l.min {
+			return fmt.Errorf("invalid %s.%s %d: must be 0 or >= %d", field, l.name, l.value, l.min)
+		}
+	}
+	return nil
+}
+
+// validateProviderOptions checks the types of the provider options the
+// providers map. Other keys are passed through untouched.
+func validateProviderOptions(options map[string]any, field string) error {
+	for _, key := range []string{"temperature", "top_p"} {
+		if v, ok := options[key]; ok {
+			if n, isNumber := v.(float64); !isNumber || n < 0 {
+				return fmt.Errorf("invalid %s.%s %v: must be a number >= 0", field, key, v)
+			}
+		}
+	}
+	if v, ok := options["model"]; ok {
+		if _, isString := v.(string); !isString {
+			return fmt.Errorf("invalid %s.model %v: must be a string", field, v)
+		}
+	}
+	if v, ok := options["headers"]; ok {
+		headers, isMap := v.(map[string]any)
+		if !isMap {
+			return fmt.Errorf("invalid %s.headers %v: must be a table of strings", field, v)
+		}
+		for name, value := range headers {
+			if _, isString := value.(string); !isString {
+				return fmt.Errorf("invalid %s.headers.%s %v: must be a string", field, name, value)
+			}
+		}
+	}
+	return nil
+}
+
 type ServerMode string
 
 const (
@@ -143,17 +410,19 @@ func ensureStateDir(stateDir string) {
 
 // Setup logger to log to a file in the state directory
 // Caller must defer logger.Close()
-func setupLogger(stateDir, logLevel string) *logger.LimitedLogger {
+func setupLogger(stateDir, logLevel string, rotation LogRotationConfig) *logger.LimitedLogger {
 	ensureStateDir(stateDir)
 	logPath := filepath.Join(stateDir, "cursortab.log")
 
-	f, err := os.OpenFile(logPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	ll, err := logger.NewRotatingLogger(logPath, logger.ParseLogLevel(logLevel), logger.RotationConfig{
+		MaxSize:  int64(rotation.MaxSizeMB) << 20,
+		MaxFiles: rotation.MaxFiles,
+		MaxAge:   time.Duration(rotation.MaxAgeDays) * 24 * time.Hour,
+	})
 	if err != nil {
 		logger.Fatal("error opening file: %v", err)
 	}
-
-	level := logger.ParseLogLevel(logLevel)
-	return logger.NewLimitedLogger(f, level)
+	return ll
 }
 
 func getSocketPath(stateDir string) string {
@@ -164,6 +433,15 @@ func getPidPath(stateDir string) string {
 	return filepath.Join(stateDir, "cursortab.pid")
 }
 
+func getConfigPath(stateDir string) string {
+	return filepath.Join(stateDir, "cursortab.config.json")
+}
+
+// getKillSwitchPath returns the sentinel file whose presence disables completions.
+func getKillSwitchPath(stateDir string) string {
+	return filepath.Join(stateDir, "cursortab.disabled")
+}
+
 func isDaemonRunning(stateDir string) (bool, int) {
 	pidPath := getPidPath(stateDir)
 	data, err := os.ReadFile(pidPath)
@@ -207,7 +485,7 @@ func runDaemon() {
 	config := loadConfig()
 
 	// Setup logger with state_dir from config
-	ll := setupLogger(config.StateDir, config.LogLevel)
+	ll := setupLogger(config.StateDir, config.LogLevel, config.LogRotation)
 	defer ll.Close()
 
 	daemon, err := NewDaemon(config)
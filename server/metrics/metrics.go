@@ -18,10 +18,17 @@ const (
 
 // CompletionInfo holds metadata about a completion for metrics tracking
 type CompletionInfo struct {
-	ID        string    // Provider-specific completion ID
-	Additions int       // Number of lines added
-	Deletions int       // Number of lines deleted
-	ShownAt   time.Time // When the completion was shown (for lifespan tracking)
+	ID           string    // Provider-specific completion ID
+	Additions    int       // Number of lines added
+	Deletions    int       // Number of lines deleted
+	AddedBytes   int       // Number of bytes added
+	DeletedBytes int       // Number of bytes deleted
+	ShownAt      time.Time // When the completion was shown (for lifespan tracking)
+	CursorOnly   bool      // A cursor jump prediction without an edit
+	Provider     string    // Provider that produced the completion
+	Model        string    // Model that produced the completion (empty if not configured)
+
+	PartiallyAccepted bool // Part of the completion was accepted before its outcome
 }
 
 // Event represents a metrics event with type and completion info
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"testing"
+	"time"
 
 	"cursortab/assert"
 )
@@ -39,3 +40,89 @@ func TestEvent(t *testing.T) {
 	assert.Equal(t, EventAccepted, event.Type, "Type")
 	assert.Equal(t, "event-id", event.Info.ID, "Info.ID")
 }
+
+func TestStatsRecord(t *testing.T) {
+	stats := NewStats()
+	info := CompletionInfo{ID: "a", Additions: 2, Deletions: 1, AddedBytes: 10, DeletedBytes: 4}
+
+	stats.Record(Event{Type: EventShown, Info: info})
+	stats.Record(Event{Type: EventAccepted, Info: info})
+	stats.Record(Event{Type: EventShown, Info: info})
+	stats.Record(Event{Type: EventRejected, Info: info})
+	stats.Record(Event{Type: EventIgnored, Info: info})
+
+	summary := stats.Summary()
+	assert.Equal(t, 2, summary.Shown, "Shown")
+	assert.Equal(t, 1, summary.Accepted, "Accepted")
+	assert.Equal(t, 1, summary.Rejected, "Rejected")
+	assert.Equal(t, 1, summary.Ignored, "Ignored")
+	assert.Equal(t, 2, summary.AddedLines, "AddedLines only counts accepted")
+	assert.Equal(t, 1, summary.DeletedLines, "DeletedLines only counts accepted")
+	assert.Equal(t, 10, summary.AddedBytes, "AddedBytes only counts accepted")
+	assert.Equal(t, 4, summary.DeletedBytes, "DeletedBytes only counts accepted")
+}
+
+func TestStatsRecordCursorOnly(t *testing.T) {
+	stats := NewStats()
+	jump := CompletionInfo{ID: "j", CursorOnly: true}
+
+	stats.Record(Event{Type: EventShown, Info: jump})
+	stats.Record(Event{Type: EventAccepted, Info: jump})
+	stats.Record(Event{Type: EventShown, Info: jump})
+	stats.Record(Event{Type: EventIgnored, Info: jump})
+
+	summary := stats.Summary()
+	assert.Equal(t, JumpStats{Shown: 2, Accepted: 1, Ignored: 1}, summary.Jumps, "Jumps")
+	assert.Equal(t, 0, summary.Shown, "completion Shown untouched")
+	assert.Equal(t, 0, summary.Accepted, "completion Accepted untouched")
+}
+
+func TestStatsRecordPartiallyAccepted(t *testing.T) {
+	stats := NewStats()
+
+	stats.Record(Event{Type: EventShown, Info: CompletionInfo{}})
+	stats.Record(Event{Type: EventRejected, Info: CompletionInfo{PartiallyAccepted: true}})
+
+	summary := stats.Summary()
+	assert.Equal(t, 1, summary.PartiallyAccepted, "PartiallyAccepted")
+	assert.Equal(t, 0, summary.Rejected, "not counted as rejected")
+}
+
+func TestStatsModels(t *testing.T) {
+	stats := NewStats()
+	zeta := CompletionInfo{Provider: "zeta", Model: "zeta-7b"}
+	inline := CompletionInfo{Provider: "inline"}
+
+	stats.Record(Event{Type: EventShown, Info: zeta})
+	stats.Record(Event{Type: EventAccepted, Info: zeta})
+	stats.Record(Event{Type: EventShown, Info: inline})
+	stats.Record(Event{Type: EventIgnored, Info: inline})
+	stats.Record(Event{Type: EventShown, Info: CompletionInfo{}})
+
+	summary := stats.Summary()
+	assert.Equal(t, 3, summary.Shown, "Shown")
+	assert.Len(t, 2, summary.Models, "models")
+	assert.Equal(t, ModelStats{Shown: 1, Accepted: 1}, summary.Models["zeta/zeta-7b"], "zeta")
+	assert.Equal(t, ModelStats{Shown: 1, Ignored: 1}, summary.Models["inline"], "inline without a model")
+}
+
+func TestStatsProviders(t *testing.T) {
+	stats := NewStats()
+	for i := 1; i <= 100; i++ {
+		stats.RecordRequest("zeta", 10)
+		stats.RecordLatency("zeta", time.Duration(i)*time.Millisecond)
+	}
+	stats.RecordRequest("sweep", 5)
+	stats.RecordError("sweep")
+
+	summary := stats.Summary()
+	assert.Equal(t, 1005, summary.TokensSent, "TokensSent")
+	assert.Equal(t, ProviderStats{
+		Requests:     100,
+		TokensSent:   1000,
+		LatencyP50Ms: 50,
+		LatencyP90Ms: 90,
+		LatencyP99Ms: 99,
+	}, summary.Providers["zeta"], "zeta")
+	assert.Equal(t, ProviderStats{Requests: 1, Errors: 1, TokensSent: 5}, summary.Providers["sweep"], "sweep")
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cursortab/logger"
+)
+
+// Compile-time check that FileSink implements Sender
+var _ Sender = (*FileSink)(nil)
+
+// FileRecord is one event written by a FileSink.
+type FileRecord struct {
+	Time         time.Time `json:"time"`
+	Type         EventType `json:"type"`
+	ID           string    `json:"id"`
+	Additions    int       `json:"additions"`
+	Deletions    int       `json:"deletions"`
+	AddedBytes   int       `json:"added_bytes"`
+	DeletedBytes int       `json:"deleted_bytes"`
+	LifespanMs   int64     `json:"lifespan_ms,omitempty"` // Time shown before the outcome (outcome events only)
+	CursorOnly   bool      `json:"cursor_only,omitempty"`
+	Provider     string    `json:"provider,omitempty"`
+	Model        string    `json:"model,omitempty"`
+
+	PartiallyAccepted bool `json:"partially_accepted,omitempty"`
+}
+
+// FileSink appends metrics events to a local JSON-lines file instead of
+// sending them to a provider backend.
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileSink creates a sink appending to path. The file and its directory
+// are created on the first event.
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+// SendMetric implements Sender
+func (s *FileSink) SendMetric(ctx context.Context, event Event) {
+	now := time.Now()
+	rec := FileRecord{
+		Time:         now,
+		Type:         event.Type,
+		ID:           event.Info.ID,
+		Additions:    event.Info.Additions,
+		Deletions:    event.Info.Deletions,
+		AddedBytes:   event.Info.AddedBytes,
+		DeletedBytes: event.Info.DeletedBytes,
+		CursorOnly:   event.Info.CursorOnly,
+		Provider:     event.Info.Provider,
+		Model:        event.Info.Model,
+
+		PartiallyAccepted: event.Info.PartiallyAccepted,
+	}
+	if event.Type != EventShown && !event.Info.ShownAt.IsZero() {
+		rec.LifespanMs = now.Sub(event.Info.ShownAt).Milliseconds()
+	}
+	if err := s.append(rec); err != nil {
+		logger.Warn("metrics: writing %s: %v", s.path, err)
+	}
+}
+
+func (s *FileSink) append(rec FileRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
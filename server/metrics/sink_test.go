@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+)
+
+func TestFileSink_AppendsEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "metrics.jsonl")
+	sink := NewFileSink(path)
+	shownAt := time.Now().Add(-time.Second)
+
+	sink.SendMetric(context.Background(), Event{Type: EventShown, Info: CompletionInfo{ID: "a", Additions: 2, AddedBytes: 10, ShownAt: shownAt}})
+	sink.SendMetric(context.Background(), Event{Type: EventAccepted, Info: CompletionInfo{ID: "a", Additions: 2, AddedBytes: 10, ShownAt: shownAt}})
+	sink.SendMetric(context.Background(), Event{Type: EventShown, Info: CompletionInfo{ID: "b"}})
+	sink.SendMetric(context.Background(), Event{Type: EventRejected, Info: CompletionInfo{ID: "b"}})
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err, "read")
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, 4, lines, "one line per event")
+	assert.Contains(t, lines[1], `"lifespan_ms":`, "outcome records lifespan")
+
+	assert.Contains(t, lines[0], `"id":"a"`, "event recorded")
+}
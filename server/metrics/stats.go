@@ -0,0 +1,254 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencySamples is how many recent latencies are kept per provider for percentiles.
+const latencySamples = 512
+
+// Summary is a point-in-time copy of the aggregated completion statistics.
+// Line and byte totals only include accepted completions.
+type Summary struct {
+	Shown             int                      `json:"shown"`
+	Accepted          int                      `json:"accepted"`
+	PartiallyAccepted int                      `json:"partially_accepted"` // Accepted in part, then rejected or dismissed
+	Rejected          int                      `json:"rejected"`
+	Ignored           int                      `json:"ignored"`
+	AddedLines        int                      `json:"added_lines"`
+	DeletedLines      int                      `json:"deleted_lines"`
+	AddedBytes        int                      `json:"added_bytes"`
+	DeletedBytes      int                      `json:"deleted_bytes"`
+	TokensSent        int                      `json:"tokens_sent"` // Estimated prompt tokens across all requests
+	Providers         map[string]ProviderStats `json:"providers"`
+	Models            map[string]ModelStats    `json:"models"` // Keyed by "provider/model", or the provider alone without a model
+	Jumps             JumpStats                `json:"jumps"`
+	Budget            BudgetStatus             `json:"budget"`
+	RateLimit         RateLimitStatus          `json:"rate_limit"`
+	Payload           PayloadStatus            `json:"payload"`
+}
+
+// ProviderStats counts the requests sent to one provider and how long its
+// responses took.
+type ProviderStats struct {
+	Requests     int   `json:"requests"`
+	Errors       int   `json:"errors"`
+	TokensSent   int   `json:"tokens_sent"`
+	LatencyP50Ms int64 `json:"latency_p50_ms"` // Over the most recent responses
+	LatencyP90Ms int64 `json:"latency_p90_ms"`
+	LatencyP99Ms int64 `json:"latency_p99_ms"`
+}
+
+// ModelStats counts the outcomes of the completions one model produced.
+type ModelStats struct {
+	Shown             int `json:"shown"`
+	Accepted          int `json:"accepted"`
+	PartiallyAccepted int `json:"partially_accepted"`
+	Rejected          int `json:"rejected"`
+	Ignored           int `json:"ignored"`
+}
+
+// JumpStats counts outcomes of cursor-only predictions, which carry no edit
+// and are kept out of the completion counts.
+type JumpStats struct {
+	Shown    int `json:"shown"`
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+	Ignored  int `json:"ignored"`
+}
+
+// BudgetStatus reports the per-minute token budget that gates retriggered requests.
+type BudgetStatus struct {
+	Limit      int `json:"limit"`      // Tokens per minute (0 = unlimited)
+	Used       int `json:"used"`       // Estimated tokens sent in the last minute
+	Skipped    int `json:"skipped"`    // Retriggers skipped to stay within the budget
+	Downscaled int `json:"downscaled"` // Retriggers sent with reduced context
+}
+
+// RateLimitStatus reports the limits on provider requests per minute and in flight.
+type RateLimitStatus struct {
+	PerMinute         int `json:"per_minute"`         // Requests per minute (0 = unlimited)
+	MaxConcurrent     int `json:"max_concurrent"`     // Requests in flight at once (0 = unlimited)
+	InFlight          int `json:"in_flight"`          // Requests in flight now
+	Queued            int `json:"queued"`             // Requests held back until a slot freed up
+	Coalesced         int `json:"coalesced"`          // Queued requests replaced by a newer one before being sent
+	SkippedPrefetches int `json:"skipped_prefetches"` // Prefetches not sent because no slot was free
+}
+
+// PayloadStatus reports the size of the last request sent against the cap on
+// request payloads.
+type PayloadStatus struct {
+	Limit     int            `json:"limit"`      // Bytes per request (0 = no cap)
+	LastBytes int            `json:"last_bytes"` // Size of the last request
+	Sources   map[string]int `json:"sources"`    // Bytes of the last request per source ("file", "diff_history", ...)
+	Truncated int            `json:"truncated"`  // Requests sent with context trimmed to fit the cap
+	Skipped   int            `json:"skipped"`    // Requests not sent because the current file alone exceeded the cap
+}
+
+// Stats aggregates completion outcomes locally, independent of any provider backend.
+type Stats struct {
+	mu        sync.Mutex
+	summary   Summary
+	latencies map[string][]time.Duration // Ring of recent latencies per provider
+	next      map[string]int             // Next ring slot per provider
+}
+
+// NewStats creates an empty Stats aggregator.
+func NewStats() *Stats {
+	return &Stats{
+		latencies: make(map[string][]time.Duration),
+		next:      make(map[string]int),
+	}
+}
+
+// Record adds an event to the aggregate.
+func (s *Stats) Record(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.Info.CursorOnly {
+		s.recordJump(event.Type)
+		return
+	}
+	if event.Info.Provider != "" {
+		s.recordModel(event)
+	}
+
+	switch event.Type {
+	case EventShown:
+		s.summary.Shown++
+	case EventAccepted:
+		s.summary.Accepted++
+		s.summary.AddedLines += event.Info.Additions
+		s.summary.DeletedLines += event.Info.Deletions
+		s.summary.AddedBytes += event.Info.AddedBytes
+		s.summary.DeletedBytes += event.Info.DeletedBytes
+	case EventRejected, EventIgnored:
+		switch {
+		case event.Info.PartiallyAccepted:
+			s.summary.PartiallyAccepted++
+		case event.Type == EventRejected:
+			s.summary.Rejected++
+		default:
+			s.summary.Ignored++
+		}
+	}
+}
+
+// recordModel adds a completion outcome to the stats of the model that
+// produced it. Caller must hold s.mu.
+func (s *Stats) recordModel(event Event) {
+	if s.summary.Models == nil {
+		s.summary.Models = make(map[string]ModelStats)
+	}
+	key := event.Info.Provider
+	if event.Info.Model != "" {
+		key += "/" + event.Info.Model
+	}
+
+	m := s.summary.Models[key]
+	switch {
+	case event.Type == EventShown:
+		m.Shown++
+	case event.Type == EventAccepted:
+		m.Accepted++
+	case event.Info.PartiallyAccepted:
+		m.PartiallyAccepted++
+	case event.Type == EventRejected:
+		m.Rejected++
+	case event.Type == EventIgnored:
+		m.Ignored++
+	}
+	s.summary.Models[key] = m
+}
+
+// recordJump adds a cursor-only prediction outcome. Caller must hold s.mu.
+func (s *Stats) recordJump(eventType EventType) {
+	switch eventType {
+	case EventShown:
+		s.summary.Jumps.Shown++
+	case EventAccepted:
+		s.summary.Jumps.Accepted++
+	case EventRejected:
+		s.summary.Jumps.Rejected++
+	case EventIgnored:
+		s.summary.Jumps.Ignored++
+	}
+}
+
+// RecordRequest counts a request of an estimated number of tokens sent to provider.
+func (s *Stats) RecordRequest(provider string, tokens int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.summary.TokensSent += tokens
+	p := s.provider(provider)
+	p.Requests++
+	p.TokensSent += tokens
+	s.summary.Providers[provider] = p
+}
+
+// RecordLatency adds the time provider took to respond.
+func (s *Stats) RecordLatency(provider string, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ring := s.latencies[provider]
+	if len(ring) < latencySamples {
+		s.latencies[provider] = append(ring, latency)
+		return
+	}
+	ring[s.next[provider]] = latency
+	s.next[provider] = (s.next[provider] + 1) % latencySamples
+}
+
+// RecordError counts a failed request to provider.
+func (s *Stats) RecordError(provider string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.provider(provider)
+	p.Errors++
+	s.summary.Providers[provider] = p
+}
+
+// provider returns the stats of a provider. Caller must hold s.mu.
+func (s *Stats) provider(name string) ProviderStats {
+	if s.summary.Providers == nil {
+		s.summary.Providers = make(map[string]ProviderStats)
+	}
+	return s.summary.Providers[name]
+}
+
+// Summary returns a copy of the current aggregate.
+func (s *Stats) Summary() Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := s.summary
+	summary.Providers = make(map[string]ProviderStats, len(s.summary.Providers))
+	for name, p := range s.summary.Providers {
+		sorted := append([]time.Duration(nil), s.latencies[name]...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		p.LatencyP50Ms = percentile(sorted, 50).Milliseconds()
+		p.LatencyP90Ms = percentile(sorted, 90).Milliseconds()
+		p.LatencyP99Ms = percentile(sorted, 99).Milliseconds()
+		summary.Providers[name] = p
+	}
+	summary.Models = make(map[string]ModelStats, len(s.summary.Models))
+	for key, m := range s.summary.Models {
+		summary.Models[key] = m
+	}
+	return summary
+}
+
+// percentile returns the nearest-rank percentile of sorted (0 if empty).
+func percentile(sorted []time.Duration, pct int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (pct*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,209 @@
+// Package anthropic implements a next-edit provider backed by the Anthropic
+// Messages API.
+//
+// The prompt is ordered from most to least stable so that the prompt cache can
+// be reused across keystrokes. The recently viewed files and the snapshot of
+// the current file from before the editing session each end a cached prefix
+// (cache_control); only the trailing block, holding the recent edits and the
+// lines around the cursor, changes between requests in the same buffer.
+package anthropic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"cursortab/client/anthropic"
+	"cursortab/engine"
+	"cursortab/logger"
+	"cursortab/provider/region"
+	"cursortab/types"
+)
+
+// maxSnapshotLines caps the file snapshot sent in the cached prefix
+const maxSnapshotLines = 2000
+
+const systemPrompt = "You are a code editing assistant that predicts the developer's next edit. " +
+	"You receive recently viewed files, a snapshot of the current file from before the developer started editing it, " +
+	"the edits made since, and an excerpt of the current file as it is now. " +
+	"The excerpt contains a region between " + region.EditableStart + " and " + region.EditableEnd + " with the cursor marked by " + region.CursorTag + ". " +
+	"Rewrite that region to complete or continue the edit in progress. " +
+	"Reply with only the rewritten region, without the markers, without the cursor tag, without explanations and without markdown fences. " +
+	"If no change is needed, reply with the region unchanged."
+
+// Provider implements the Anthropic provider
+type Provider struct {
+	config *types.ProviderConfig
+	client *anthropic.Client
+	model  string
+}
+
+var _ engine.Provider = (*Provider)(nil)
+
+// NewProvider creates a new Anthropic provider
+func NewProvider(config *types.ProviderConfig) (*Provider, error) {
+	return newProvider(config, anthropic.BaseURL)
+}
+
+// newProvider creates the provider against baseURL
+func newProvider(config *types.ProviderConfig, baseURL string) (*Provider, error) {
+	if config.APIKey == "" {
+		return nil, errors.New("anthropic: api_key_env is required")
+	}
+
+	model := config.ProviderModel
+	if model == "" {
+		model = anthropic.DefaultModel
+	}
+
+	return &Provider{
+		config: config,
+		client: anthropic.NewClient(baseURL, config.APIKey, config.CompletionTimeout),
+		model:  model,
+	}, nil
+}
+
+// GetContextLimits implements engine.Provider
+func (p *Provider) GetContextLimits() engine.ContextLimits {
+	limits := engine.DefaultContextLimits()
+	limits.MaxGitCommits = 5
+	return limits
+}
+
+// GetCompletion implements engine.Provider
+func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
+	defer logger.Trace("anthropic.GetCompletion")()
+
+	if len(req.Lines) == 0 {
+		return &types.CompletionResponse{}, nil
+	}
+
+	w := region.NewWindow(req, p.config.ProviderMaxTokens, p.config.Tokenizer)
+	maxTokens := p.config.OutputTokens()
+	if maxTokens <= 0 {
+		maxTokens = 1024
+	}
+
+	apiReq := &anthropic.Request{
+		Model:         p.model,
+		MaxTokens:     maxTokens,
+		System:        []anthropic.ContentBlock{anthropic.TextBlock(systemPrompt)},
+		Messages:      []anthropic.Message{{Role: "user", Content: buildContent(req, w)}},
+		Temperature:   p.config.ProviderTemperature,
+		TopK:          p.config.ProviderTopK,
+		StopSequences: p.config.StopSequences,
+		Headers:       req.ProviderOptions.Headers(),
+	}
+	if v, ok := req.ProviderOptions.Temperature(); ok {
+		apiReq.Temperature = v
+	}
+	if v, ok := req.ProviderOptions.TopP(); ok {
+		apiReq.TopP = v
+	}
+	if v, ok := req.ProviderOptions.Model(); ok {
+		apiReq.Model = v
+	}
+
+	logger.Debug("anthropic request:\n  URL: %s\n  Model: %s\n  Editable: [%d:%d]\n  Blocks: %d",
+		p.client.URL, apiReq.Model, w.EditableStart, w.EditableEnd, len(apiReq.Messages[0].Content))
+
+	apiResp, err := p.client.CreateMessage(ctx, apiReq)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic: %w", err)
+	}
+
+	completionText := apiResp.Text()
+	logger.Debug("anthropic response:\n  ID: %s\n  StopReason: %s\n  Usage: input=%d cache_read=%d cache_write=%d output=%d\n  Text:\n%s",
+		apiResp.ID, apiResp.StopReason,
+		apiResp.Usage.InputTokens, apiResp.Usage.CacheReadInputTokens, apiResp.Usage.CacheCreationInputTokens, apiResp.Usage.OutputTokens,
+		completionText)
+
+	return region.Response(req, w, completionText, apiResp.ID), nil
+}
+
+// buildContent returns the user message blocks, stable blocks first. Each
+// stable block carries cache_control so the prefix up to it is cached.
+func buildContent(req *types.CompletionRequest, w region.Window) []anthropic.ContentBlock {
+	var blocks []anthropic.ContentBlock
+
+	if snapshots := formatRecentFiles(req.RecentBufferSnapshots, req.FilePath); snapshots != "" {
+		blocks = append(blocks, anthropic.CachedTextBlock(snapshots))
+	}
+
+	if len(req.PreviousLines) > 0 {
+		snapshot := req.PreviousLines[:min(len(req.PreviousLines), maxSnapshotLines)]
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "<original_file path=%q>\n", req.FilePath)
+		for _, line := range snapshot {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+		sb.WriteString("</original_file>\n")
+		blocks = append(blocks, anthropic.CachedTextBlock(sb.String()))
+	}
+
+	return append(blocks, anthropic.TextBlock(buildCurrent(req, w)))
+}
+
+// formatRecentFiles renders the recently viewed files in path order, so the
+// block stays identical when only access times change.
+func formatRecentFiles(snapshots []*types.RecentBufferSnapshot, currentPath string) string {
+	sorted := slices.Clone(snapshots)
+	slices.SortFunc(sorted, func(a, b *types.RecentBufferSnapshot) int {
+		return strings.Compare(a.FilePath, b.FilePath)
+	})
+
+	var sb strings.Builder
+	for _, s := range sorted {
+		if s.FilePath == currentPath || len(s.Lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "<recent_file path=%q>\n", s.FilePath)
+		for _, line := range s.Lines {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+		sb.WriteString("</recent_file>\n")
+	}
+	return sb.String()
+}
+
+// buildCurrent renders the per-request part of the prompt: recent edits,
+// diagnostics and the file excerpt around the cursor
+func buildCurrent(req *types.CompletionRequest, w region.Window) string {
+	var sb strings.Builder
+
+	if edits := region.FormatDiffHistories(req.FileDiffHistories); edits != "" {
+		sb.WriteString("<recent_edits>\n")
+		sb.WriteString(edits)
+		sb.WriteString("</recent_edits>\n")
+	}
+
+	if diags := req.GetDiagnostics(); diags != nil && len(diags.Errors) > 0 {
+		sb.WriteString("<diagnostics>\n")
+		sb.WriteString(region.FormatDiagnostics(diags))
+		sb.WriteString("</diagnostics>\n")
+	}
+
+	if h := req.GetGitHistory(); h != nil {
+		sb.WriteString("<git_history>\n")
+		sb.WriteString(region.FormatGitHistory(h))
+		sb.WriteString("</git_history>\n")
+	}
+
+	if req.Instruction != "" {
+		fmt.Fprintf(&sb, "<instruction>\n%s\n</instruction>\n", req.Instruction)
+	}
+
+	if req.FenceLanguage != "" {
+		fmt.Fprintf(&sb, "<current_file path=%q code_block_language=%q>\n", req.FilePath, req.FenceLanguage)
+	} else {
+		fmt.Fprintf(&sb, "<current_file path=%q>\n", req.FilePath)
+	}
+	region.WriteExcerpt(&sb, req, w)
+	sb.WriteString("</current_file>\n")
+
+	return sb.String()
+}
@@ -0,0 +1,175 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/client/anthropic"
+	"cursortab/provider/region"
+	"cursortab/types"
+)
+
+func newTestProvider(t *testing.T, reply string, got *anthropic.Request) *Provider {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(got)
+		data, _ := json.Marshal(reply)
+		fmt.Fprintf(w, `{"id":"msg_1","content":[{"type":"text","text":%s}],"stop_reason":"end_turn"}`, data)
+	}))
+	t.Cleanup(server.Close)
+
+	p, err := newProvider(&types.ProviderConfig{
+		APIKey:            "secret",
+		ProviderMaxTokens: 256,
+	}, server.URL)
+	assert.NoError(t, err, "newProvider")
+	return p
+}
+
+func TestGetCompletion(t *testing.T) {
+	var got anthropic.Request
+	p := newTestProvider(t, "func add(a, b int) int {\n\treturn a + b\n}\n", &got)
+
+	resp, err := p.GetCompletion(context.Background(), &types.CompletionRequest{
+		FilePath:      "math.go",
+		Lines:         []string{"func add(a, b int) int {", "\tret", "}"},
+		PreviousLines: []string{"func add(a, b int) int {", "}"},
+		CursorRow:     2,
+		CursorCol:     4,
+		RecentBufferSnapshots: []*types.RecentBufferSnapshot{
+			{FilePath: "util.go", Lines: []string{"package main"}},
+		},
+	})
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Len(t, 1, resp.Completions, "completions")
+	c := resp.Completions[0]
+	assert.Equal(t, 1, c.StartLine, "start line")
+	assert.Equal(t, 3, c.EndLineInc, "end line")
+	assert.Equal(t, []string{"func add(a, b int) int {", "\treturn a + b", "}"}, c.Lines, "lines")
+	assert.Equal(t, "msg_1", resp.MetricsInfo.ID, "metrics id")
+
+	blocks := got.Messages[0].Content
+	assert.Len(t, 3, blocks, "recent files, snapshot, current")
+	assert.NotNil(t, blocks[0].CacheControl, "recent files cached")
+	assert.NotNil(t, blocks[1].CacheControl, "snapshot cached")
+	assert.Nil(t, blocks[2].CacheControl, "current excerpt not cached")
+	assert.Contains(t, blocks[2].Text, "\tret"+region.CursorTag, "cursor marker")
+	assert.Equal(t, 256, got.MaxTokens, "max tokens")
+}
+
+func TestBuildContent_StablePrefixAcrossKeystrokes(t *testing.T) {
+	base := &types.CompletionRequest{
+		FilePath:      "main.go",
+		Lines:         []string{"package main", "", "func main() {", "}"},
+		PreviousLines: []string{"package main", "", "func main() {", "}"},
+		CursorRow:     3,
+		RecentBufferSnapshots: []*types.RecentBufferSnapshot{
+			{FilePath: "b.go", Lines: []string{"package b"}, TimestampMs: 1},
+			{FilePath: "a.go", Lines: []string{"package a"}, TimestampMs: 2},
+		},
+	}
+	next := *base
+	next.Lines = []string{"package main", "", "func main() {", "\tfmt.", "}"}
+	next.CursorRow = 4
+	next.CursorCol = 5
+	next.RecentBufferSnapshots = []*types.RecentBufferSnapshot{
+		{FilePath: "a.go", Lines: []string{"package a"}, TimestampMs: 3},
+		{FilePath: "b.go", Lines: []string{"package b"}, TimestampMs: 4},
+	}
+
+	first := buildContent(base, region.NewWindow(base, 0, nil))
+	second := buildContent(&next, region.NewWindow(&next, 0, nil))
+
+	assert.Equal(t, first[0], second[0], "recent files block unchanged")
+	assert.Equal(t, first[1], second[1], "snapshot block unchanged")
+	assert.NotEqual(t, first[2].Text, second[2].Text, "current block changes")
+}
+
+func TestBuildContent_NoSnapshot(t *testing.T) {
+	req := &types.CompletionRequest{Lines: []string{"x"}, CursorRow: 1}
+
+	blocks := buildContent(req, region.NewWindow(req, 0, nil))
+
+	assert.Len(t, 1, blocks, "only current block")
+	assert.Nil(t, blocks[0].CacheControl, "nothing cached")
+}
+
+func TestBuildContent_FenceLanguage(t *testing.T) {
+	req := &types.CompletionRequest{
+		FilePath:      "README.md",
+		Lines:         []string{"```python", "x = 1", "```"},
+		CursorRow:     2,
+		FenceLanguage: "python",
+	}
+
+	blocks := buildContent(req, region.NewWindow(req, 0, nil))
+
+	assert.Contains(t, blocks[0].Text, `<current_file path="README.md" code_block_language="python">`, "fence language")
+}
+
+func TestBuildContent_Instruction(t *testing.T) {
+	req := &types.CompletionRequest{
+		FilePath:    "main.go",
+		Lines:       []string{"x := 1 // cursortab: make it a constant"},
+		CursorRow:   1,
+		Instruction: "make it a constant",
+	}
+
+	blocks := buildContent(req, region.NewWindow(req, 0, nil))
+
+	assert.Contains(t, blocks[0].Text, "<instruction>\nmake it a constant\n</instruction>\n<current_file", "instruction before the file")
+}
+
+func TestGetCompletion_UnchangedRegion(t *testing.T) {
+	var got anthropic.Request
+	p := newTestProvider(t, "```\na\nb\n```", &got)
+
+	resp, err := p.GetCompletion(context.Background(), &types.CompletionRequest{
+		Lines:     []string{"a", "b"},
+		CursorRow: 1,
+	})
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Len(t, 0, resp.Completions, "no completion for unchanged region")
+}
+
+func TestGetCompletion_EmptyRegionDeletesIt(t *testing.T) {
+	var got anthropic.Request
+	p := newTestProvider(t, "```\n```", &got)
+
+	resp, err := p.GetCompletion(context.Background(), &types.CompletionRequest{
+		Lines:     []string{"a", "b"},
+		CursorRow: 1,
+	})
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Len(t, 1, resp.Completions, "completions")
+	c := resp.Completions[0]
+	assert.Equal(t, 1, c.StartLine, "start line")
+	assert.Equal(t, 2, c.EndLineInc, "end line")
+	assert.Len(t, 0, c.Lines, "no replacement lines")
+}
+
+func TestGetCompletion_EmptyReplyIsNoSuggestion(t *testing.T) {
+	var got anthropic.Request
+	p := newTestProvider(t, "", &got)
+
+	resp, err := p.GetCompletion(context.Background(), &types.CompletionRequest{
+		Lines:     []string{"a", "b"},
+		CursorRow: 1,
+	})
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Len(t, 0, resp.Completions, "no completion for empty reply")
+}
+
+func TestNewProvider_RequiresAPIKey(t *testing.T) {
+	_, err := NewProvider(&types.ProviderConfig{})
+
+	assert.Error(t, err, "missing api key")
+}
@@ -0,0 +1,116 @@
+// Package chat implements a fill-in-the-middle provider for OpenAI-compatible
+// Chat Completions endpoints (vLLM, llama.cpp server, LM Studio, Groq, ...).
+//
+// The request is the FIM prompt wrapped in a chat conversation:
+//
+//	{
+//	  "model":    "qwen2.5-coder-7b-instruct",
+//	  "messages": [
+//	    {"role": "system", "content": "...system_prompt with {prefix}/{suffix}/{middle} expanded..."},
+//	    {"role": "user",   "content": "<|fim_prefix|>...<|fim_suffix|>...<|fim_middle|>"}
+//	  ],
+//	  "stop":     [...stop_sequences...],
+//	  "stream":   true
+//	}
+//
+// The assistant reply is inserted at the cursor, exactly as with the fim provider.
+// Markdown fences wrapping the reply are dropped, from the streamed lines too.
+package chat
+
+import (
+	"context"
+	"strings"
+
+	"cursortab/client/openai"
+	"cursortab/engine"
+	"cursortab/provider"
+	"cursortab/provider/fim"
+	"cursortab/types"
+)
+
+// NewProvider creates a new chat-completions provider
+func NewProvider(config *types.ProviderConfig) *provider.Provider {
+	path := config.CompletionPath
+	if path == "" || path == openai.DefaultCompletionPath {
+		path = openai.DefaultChatCompletionPath
+	}
+
+	p := fim.NewProvider(config)
+	p.Name = "chat"
+	p.Client = openai.NewChatClient(config.ProviderURL, path, config.APIKey, systemPrompt(config))
+	p.StopTokens = config.StopSequences
+	p.PromptBuilder = buildPrompt(p.PromptBuilder)
+	p.Postprocessors = append([]provider.Postprocessor{stripFences}, p.Postprocessors...)
+	p.StreamFilter = stripFenceLines
+	return p
+}
+
+// systemPrompt expands the FIM marker placeholders in the configured system prompt
+func systemPrompt(config *types.ProviderConfig) string {
+	return strings.NewReplacer(
+		"{prefix}", config.FIMTokens.Prefix,
+		"{suffix}", config.FIMTokens.Suffix,
+		"{middle}", config.FIMTokens.Middle,
+	).Replace(config.SystemPrompt)
+}
+
+func buildPrompt(fimPrompt provider.PromptBuilder) provider.PromptBuilder {
+	return func(p *provider.Provider, ctx *provider.Context) *openai.CompletionRequest {
+		req := fimPrompt(p, ctx)
+		req.Stop = p.Config.StopSequences
+		return req
+	}
+}
+
+// stripFences removes the markdown fence lines around a fenced reply
+func stripFences(p *provider.Provider, ctx *provider.Context) (*types.CompletionResponse, bool) {
+	lines := strings.Split(strings.TrimRight(ctx.Result.Text, " \t\n"), "\n")
+	if !provider.IsFence(lines[0]) {
+		return nil, false
+	}
+	lines = lines[1:]
+	if len(lines) > 0 && provider.IsFence(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+	ctx.Result.Text = strings.Join(lines, "\n")
+	return nil, false
+}
+
+// fenceStream is a line stream without the fence lines of a fenced reply
+type fenceStream struct {
+	engine.LineStream
+	lines chan string
+}
+
+// stripFenceLines drops an opening fence on the first line, and the closing
+// fence with anything after it, as the lines arrive
+func stripFenceLines(ctx context.Context, stream engine.LineStream) engine.LineStream {
+	fs := &fenceStream{LineStream: stream, lines: make(chan string)}
+	go func() {
+		defer close(fs.lines)
+		first, fenced, closed := true, false, false
+		for line := range stream.LinesChan() {
+			switch {
+			case closed:
+				continue
+			case first && provider.IsFence(line):
+				fenced = true
+			case fenced && provider.IsFence(line):
+				closed = true
+			default:
+				select {
+				case fs.lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			first = false
+		}
+	}()
+	return fs
+}
+
+// LinesChan implements engine.LineStream
+func (s *fenceStream) LinesChan() <-chan string {
+	return s.lines
+}
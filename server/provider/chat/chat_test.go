@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/client/openai"
+	"cursortab/types"
+)
+
+func newTestConfig(url string) *types.ProviderConfig {
+	return &types.ProviderConfig{
+		ProviderURL:       url,
+		ProviderModel:     "test-model",
+		ProviderMaxTokens: 256,
+		CompletionPath:    openai.DefaultCompletionPath,
+		FIMTokens: types.FIMTokenConfig{
+			Prefix: "<PRE>",
+			Suffix: "<SUF>",
+			Middle: "<MID>",
+		},
+		SystemPrompt:  "Fill in {middle} between {prefix} and {suffix}.",
+		StopSequences: []string{"<END>"},
+	}
+}
+
+func TestGetCompletion_SendsTemplatedChatRequest(t *testing.T) {
+	var gotPath string
+	var got openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"Println()"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	req := &types.CompletionRequest{
+		Lines:     []string{"fmt.", "}"},
+		CursorRow: 1,
+		CursorCol: 4,
+	}
+
+	resp, err := NewProvider(newTestConfig(server.URL)).GetCompletion(context.Background(), req)
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Equal(t, openai.DefaultChatCompletionPath, gotPath, "default path switches to chat completions")
+	assert.Len(t, 2, got.Messages, "messages")
+	assert.Equal(t, "Fill in <MID> between <PRE> and <SUF>.", got.Messages[0].Content, "system prompt placeholders expanded")
+	assert.Equal(t, "<PRE>fmt.<SUF>\n}<MID>", got.Messages[1].Content, "user message is the FIM prompt")
+	assert.Equal(t, []string{"<END>"}, got.Stop, "stop sequences")
+	assert.Len(t, 1, resp.Completions, "completions")
+	assert.Equal(t, []string{"fmt.Println()"}, resp.Completions[0].Lines, "lines")
+}
+
+func TestGetCompletion_StripsMarkdownFences(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"` + "```go\\nbar()\\n```\\n" + `"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	req := &types.CompletionRequest{
+		Lines:     []string{"x := foo"},
+		CursorRow: 1,
+		CursorCol: 8,
+	}
+
+	resp, err := NewProvider(newTestConfig(server.URL)).GetCompletion(context.Background(), req)
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Len(t, 1, resp.Completions, "completions")
+	assert.Equal(t, []string{"x := foobar()"}, resp.Completions[0].Lines, "lines")
+}
+
+func TestNewProvider_CustomPath(t *testing.T) {
+	config := newTestConfig("http://localhost:1234")
+	config.CompletionPath = "/openai/v1/chat/completions"
+
+	p := NewProvider(config)
+
+	client, ok := p.Client.(*openai.Client)
+	assert.True(t, ok, "client type")
+	assert.Equal(t, "/openai/v1/chat/completions", client.CompletionPath, "custom path kept")
+	assert.Equal(t, "chat", p.Name, "name")
+}
+
+type sliceStream struct {
+	lines chan string
+}
+
+func newSliceStream(lines ...string) *sliceStream {
+	s := &sliceStream{lines: make(chan string, len(lines))}
+	for _, line := range lines {
+		s.lines <- line
+	}
+	close(s.lines)
+	return s
+}
+
+func (s *sliceStream) LinesChan() <-chan string { return s.lines }
+func (s *sliceStream) Cancel()                  {}
+
+func TestStripFenceLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{"fenced reply", []string{"```go", "bar()", "baz()", "```", "trailing"}, []string{"bar()", "baz()"}},
+		{"unfenced reply", []string{"bar()", "```"}, []string{"bar()", "```"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := stripFenceLines(context.Background(), newSliceStream(tt.lines...))
+
+			got := []string{}
+			for line := range stream.LinesChan() {
+				got = append(got, line)
+			}
+			assert.Equal(t, tt.want, got, "streamed lines")
+		})
+	}
+}
@@ -19,6 +19,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
@@ -109,6 +111,9 @@ func (p *Provider) GetContextLimits() engine.ContextLimits {
 		MaxDiffBytes:       -1,
 		MaxChangedSymbols:  -1,
 		MaxSiblings:        -1,
+		MaxLSPSymbols:      -1,
+		MaxGitCommits:      -1,
+		MaxRetrievalChunks: -1,
 		MaxInputLines:      -1,
 		MaxInputBytes:      -1,
 	}
@@ -135,12 +140,7 @@ func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionReque
 		return p.emptyResponse(), nil
 	}
 
-	// Build URI from file path
-	uri := "file://" + req.FilePath
-	if !strings.HasPrefix(req.FilePath, "/") {
-		// Relative path - prepend workspace
-		uri = "file://" + req.WorkspacePath + "/" + req.FilePath
-	}
+	uri := documentURI(req)
 
 	// Generate unique request ID
 	reqID := atomic.AddInt64(&p.reqIDCounter, 1)
@@ -273,8 +273,20 @@ func (p *Provider) logResponse(edits []CopilotEdit) {
 	logger.Debug("copilot response: %d edits\n%s", len(edits), sb.String())
 }
 
+// documentURI returns the file URI of the buffer of req.
+func documentURI(req *types.CompletionRequest) string {
+	if strings.HasPrefix(req.FilePath, "/") {
+		return "file://" + req.FilePath
+	}
+	// Relative path - prepend workspace
+	return "file://" + req.WorkspacePath + "/" + req.FilePath
+}
+
 // convertEdits transforms Copilot LSP edits to cursortab's CompletionResponse format.
-// Processes all edits and returns multiple completions for staging to handle.
+// Processes all edits and returns multiple completions for staging to handle,
+// with the locations of the later ones as next targets.
+// An edit in another file of the workspace becomes a cursor target there,
+// used when the buffer itself gets no completion.
 func (p *Provider) convertEdits(edits []CopilotEdit, req *types.CompletionRequest) (*types.CompletionResponse, error) {
 	if len(edits) == 0 {
 		return p.emptyResponse(), nil
@@ -283,6 +295,8 @@ func (p *Provider) convertEdits(edits []CopilotEdit, req *types.CompletionReques
 	// Collect commands for telemetry on accept
 	var commands []*CopilotCmd
 	var completions []*types.Completion
+	var target *types.CursorPredictionTarget
+	uri := documentURI(req)
 
 	for i, edit := range edits {
 		// Store command for telemetry
@@ -290,6 +304,13 @@ func (p *Provider) convertEdits(edits []CopilotEdit, req *types.CompletionReques
 			commands = append(commands, edit.Command)
 		}
 
+		if edit.TextDoc.URI != "" && edit.TextDoc.URI != uri {
+			if target == nil {
+				target = otherFileTarget(edit, req.WorkspacePath)
+			}
+			continue
+		}
+
 		// Validate version matches (avoid stale edits)
 		// Version 0 means Copilot didn't include version info - allow it
 		if edit.TextDoc.Version != 0 && edit.TextDoc.Version != req.Version {
@@ -309,6 +330,10 @@ func (p *Provider) convertEdits(edits []CopilotEdit, req *types.CompletionReques
 	p.mu.Unlock()
 
 	if len(completions) == 0 {
+		if target != nil {
+			logger.Debug("copilot: next edit in %s:%d", target.RelativePath, target.LineNumber)
+			return &types.CompletionResponse{Completions: []*types.Completion{}, CursorTarget: target}, nil
+		}
 		return p.emptyResponse(), nil
 	}
 
@@ -316,9 +341,43 @@ func (p *Provider) convertEdits(edits []CopilotEdit, req *types.CompletionReques
 
 	return &types.CompletionResponse{
 		Completions: completions,
+		NextTargets: nextTargets(completions),
 	}, nil
 }
 
+// nextTargets returns the locations of the edits after the first that start
+// below its lines, as the places to visit once it is accepted.
+func nextTargets(completions []*types.Completion) []*types.CursorPredictionTarget {
+	var targets []*types.CursorPredictionTarget
+	last := completions[0].EndLineInc
+	for _, c := range completions[1:] {
+		if c.StartLine <= last {
+			continue
+		}
+		targets = append(targets, &types.CursorPredictionTarget{LineNumber: int32(c.StartLine), ShouldRetrigger: true})
+		last = c.EndLineInc
+	}
+	return targets
+}
+
+// otherFileTarget returns a cursor target at the start of edit, which is in
+// another document, or nil when that document is outside workspace.
+func otherFileTarget(edit CopilotEdit, workspace string) *types.CursorPredictionTarget {
+	u, err := url.Parse(edit.TextDoc.URI)
+	if err != nil || u.Scheme != "file" || workspace == "" {
+		return nil
+	}
+	rel, err := filepath.Rel(workspace, u.Path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return nil
+	}
+	return &types.CursorPredictionTarget{
+		RelativePath:    rel,
+		LineNumber:      int32(edit.Range.Start.Line + 1),
+		ShouldRetrigger: true,
+	}
+}
+
 // convertSingleEdit converts a single Copilot edit to a Completion
 func (p *Provider) convertSingleEdit(edit CopilotEdit, req *types.CompletionRequest, editIdx int) *types.Completion {
 	// Convert 0-indexed LSP range to 1-indexed buffer lines
@@ -257,6 +257,36 @@ func TestConvertEdits_SingleLineEdit(t *testing.T) {
 	assert.Equal(t, "hello world", resp.Completions[0].Lines[0], "content")
 }
 
+func TestConvertEdits_OtherFileEdit(t *testing.T) {
+	p := &Provider{
+		pendingResult: make(chan *CopilotResult, 1),
+	}
+	req := &types.CompletionRequest{
+		WorkspacePath: "/work",
+		FilePath:      "main.go",
+		Lines:         []string{"hello"},
+		Version:       1,
+	}
+	edit := func(uri string) CopilotEdit {
+		return CopilotEdit{
+			Text:    "renamed",
+			Range:   CopilotRange{Start: CopilotPos{Line: 4}, End: CopilotPos{Line: 4, Character: 3}},
+			TextDoc: CopilotDoc{URI: uri, Version: 7},
+		}
+	}
+
+	resp, err := p.convertEdits([]CopilotEdit{edit("file:///work/pkg/util%20a.go")}, req)
+
+	assert.NoError(t, err, "no error")
+	assert.Len(t, 0, resp.Completions, "not applied to the buffer")
+	assert.NotNil(t, resp.CursorTarget, "target in the other file")
+	assert.Equal(t, "pkg/util a.go", resp.CursorTarget.RelativePath, "relative path")
+	assert.Equal(t, int32(5), resp.CursorTarget.LineNumber, "1-indexed line")
+
+	resp, _ = p.convertEdits([]CopilotEdit{edit("file:///etc/passwd")}, req)
+	assert.Nil(t, resp.CursorTarget, "file outside the workspace")
+}
+
 func TestConvertEdits_MultiLineEdit(t *testing.T) {
 	p := &Provider{
 		pendingResult: make(chan *CopilotResult, 1),
@@ -414,6 +444,8 @@ func TestConvertEdits_MultipleEdits(t *testing.T) {
 	assert.Equal(t, 1, resp.Completions[0].StartLine, "first edit start line")
 	assert.Equal(t, 3, resp.Completions[1].StartLine, "second edit start line")
 	assert.Len(t, 2, p.lastCommands, "two commands stored")
+	assert.Len(t, 1, resp.NextTargets, "second edit as next target")
+	assert.Equal(t, int32(3), resp.NextTargets[0].LineNumber, "next target line")
 }
 
 func TestHandleNESResponse_ValidResponse(t *testing.T) {
@@ -24,7 +24,7 @@ func NewProvider(config *types.ProviderConfig) *provider.Provider {
 	return &provider.Provider{
 		Name:          "fim",
 		Config:        config,
-		Client:        openai.NewClient(config.ProviderURL, config.CompletionPath, config.APIKey),
+		Client:        provider.NewClient(config),
 		StreamingType: provider.StreamingLines,
 		Preprocessors: []provider.Preprocessor{
 			provider.TrimContent(),
@@ -74,7 +74,7 @@ func buildPrompt(p *provider.Provider, ctx *provider.Context) *openai.Completion
 		Model:       p.Config.ProviderModel,
 		Prompt:      prompt,
 		Temperature: p.Config.ProviderTemperature,
-		MaxTokens:   p.Config.ProviderMaxTokens,
+		MaxTokens:   p.Config.OutputTokens(),
 		TopK:        p.Config.ProviderTopK,
 		N:           1,
 		Echo:        false,
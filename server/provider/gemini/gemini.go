@@ -0,0 +1,191 @@
+// Package gemini implements a next-edit provider backed by the Gemini
+// generateContent API.
+//
+// Authentication:
+//   - API key (api_key_env set): Gemini Developer API.
+//   - Otherwise, the service account key named by GOOGLE_APPLICATION_CREDENTIALS:
+//     Vertex AI, in GOOGLE_CLOUD_PROJECT (default: the key's project) and
+//     GOOGLE_CLOUD_LOCATION (default: us-central1).
+//
+// The prompt holds the recent edits, diagnostics and treesitter scope, followed
+// by a window of the file with an editable region around the cursor. The model
+// replies with the rewritten editable region, which becomes the completion.
+package gemini
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"cursortab/client/gemini"
+	"cursortab/engine"
+	"cursortab/logger"
+	"cursortab/provider/region"
+	"cursortab/types"
+)
+
+const systemInstruction = "You are a code editing assistant that predicts the developer's next edit. " +
+	"You receive recent edits, diagnostics, scope information and an excerpt of the current file. " +
+	"The excerpt contains a region between " + region.EditableStart + " and " + region.EditableEnd + " with the cursor marked by " + region.CursorTag + ". " +
+	"Rewrite that region to complete or continue the edit in progress. " +
+	"Reply with only the rewritten region, without the markers, without the cursor tag, without explanations and without markdown fences. " +
+	"If no change is needed, reply with the region unchanged."
+
+// Provider implements the Gemini provider
+type Provider struct {
+	config *types.ProviderConfig
+	client *gemini.Client
+}
+
+var _ engine.Provider = (*Provider)(nil)
+
+// NewProvider creates a new Gemini provider, resolving credentials from the environment
+// when no API key is configured.
+func NewProvider(config *types.ProviderConfig) (*Provider, error) {
+	return newProvider(config, "")
+}
+
+// newProvider creates the provider against baseURL, or the Google endpoint when empty
+func newProvider(config *types.ProviderConfig, baseURL string) (*Provider, error) {
+	model := config.ProviderModel
+	if model == "" {
+		model = gemini.DefaultModel
+	}
+
+	if config.APIKey != "" {
+		baseURL = cmp.Or(baseURL, gemini.DeveloperURL)
+		return &Provider{
+			config: config,
+			client: gemini.NewDeveloperClient(baseURL, model, config.APIKey, config.CompletionTimeout),
+		}, nil
+	}
+
+	keyPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if keyPath == "" {
+		return nil, errors.New("gemini: set api_key_env or GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	account, err := gemini.LoadServiceAccount(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+	tokens, err := gemini.NewServiceAccountTokens(account)
+	if err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+
+	project := cmp.Or(os.Getenv("GOOGLE_CLOUD_PROJECT"), account.ProjectID)
+	location := cmp.Or(os.Getenv("GOOGLE_CLOUD_LOCATION"), "us-central1")
+	baseURL = cmp.Or(baseURL, gemini.VertexURL(location))
+
+	return &Provider{
+		config: config,
+		client: gemini.NewVertexClient(baseURL, project, location, model, tokens, config.CompletionTimeout),
+	}, nil
+}
+
+// GetContextLimits implements engine.Provider
+func (p *Provider) GetContextLimits() engine.ContextLimits {
+	limits := engine.DefaultContextLimits()
+	limits.MaxGitCommits = 5
+	return limits
+}
+
+// GetCompletion implements engine.Provider
+func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
+	defer logger.Trace("gemini.GetCompletion")()
+
+	if len(req.Lines) == 0 {
+		return &types.CompletionResponse{}, nil
+	}
+
+	w := region.NewWindow(req, p.config.ProviderMaxTokens, p.config.Tokenizer)
+	apiReq := &gemini.Request{
+		SystemInstruction: &gemini.Content{Parts: []gemini.Part{{Text: systemInstruction}}},
+		Contents: []gemini.Content{{
+			Role:  "user",
+			Parts: []gemini.Part{{Text: buildPrompt(req, w)}},
+		}},
+		GenerationConfig: gemini.GenerationConfig{
+			Temperature:     p.config.ProviderTemperature,
+			TopK:            p.config.ProviderTopK,
+			MaxOutputTokens: p.config.OutputTokens(),
+			StopSequences:   p.config.StopSequences,
+		},
+		Headers: req.ProviderOptions.Headers(),
+	}
+	if v, ok := req.ProviderOptions.Temperature(); ok {
+		apiReq.GenerationConfig.Temperature = v
+	}
+	if v, ok := req.ProviderOptions.TopP(); ok {
+		apiReq.GenerationConfig.TopP = v
+	}
+
+	logger.Debug("gemini request:\n  URL: %s\n  Editable: [%d:%d]\n  Prompt:\n%s",
+		p.client.URL, w.EditableStart, w.EditableEnd, apiReq.Contents[0].Parts[0].Text)
+
+	apiResp, err := p.client.GenerateContent(ctx, apiReq)
+	if err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+
+	completionText := apiResp.Text()
+	logger.Debug("gemini response:\n  ID: %s\n  FinishReason: %s\n  Text:\n%s",
+		apiResp.ResponseID, apiResp.FinishReason(), completionText)
+
+	return region.Response(req, w, completionText, apiResp.ResponseID), nil
+}
+
+// buildPrompt renders the request context and the file window
+func buildPrompt(req *types.CompletionRequest, w region.Window) string {
+	var sb strings.Builder
+
+	if edits := region.FormatDiffHistories(req.FileDiffHistories); edits != "" {
+		sb.WriteString("<recent_edits>\n")
+		sb.WriteString(edits)
+		sb.WriteString("</recent_edits>\n\n")
+	}
+
+	if diags := req.GetDiagnostics(); diags != nil && len(diags.Errors) > 0 {
+		sb.WriteString("<diagnostics>\n")
+		sb.WriteString(region.FormatDiagnostics(diags))
+		sb.WriteString("</diagnostics>\n\n")
+	}
+
+	if ts := req.GetTreesitter(); ts != nil {
+		sb.WriteString("<scope>\n")
+		for _, imp := range ts.Imports {
+			sb.WriteString(imp)
+			sb.WriteString("\n")
+		}
+		if ts.EnclosingSignature != "" {
+			fmt.Fprintf(&sb, "enclosing: %s\n", ts.EnclosingSignature)
+		}
+		for _, sib := range ts.Siblings {
+			fmt.Fprintf(&sb, "line %d: %s\n", sib.Line, sib.Signature)
+		}
+		sb.WriteString("</scope>\n\n")
+	}
+
+	if h := req.GetGitHistory(); h != nil {
+		sb.WriteString("<git_history>\n")
+		sb.WriteString(region.FormatGitHistory(h))
+		sb.WriteString("</git_history>\n\n")
+	}
+
+	if req.Instruction != "" {
+		fmt.Fprintf(&sb, "<instruction>\n%s\n</instruction>\n\n", req.Instruction)
+	}
+
+	if req.FenceLanguage != "" {
+		fmt.Fprintf(&sb, "<file path=%q code_block_language=%q>\n", req.FilePath, req.FenceLanguage)
+	} else {
+		fmt.Fprintf(&sb, "<file path=%q>\n", req.FilePath)
+	}
+	region.WriteExcerpt(&sb, req, w)
+	sb.WriteString("</file>\n")
+
+	return sb.String()
+}
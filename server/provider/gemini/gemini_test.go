@@ -0,0 +1,110 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/client/gemini"
+	"cursortab/provider/region"
+	"cursortab/types"
+)
+
+func newTestProvider(t *testing.T, reply string, got *gemini.Request) *Provider {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(got)
+		data, _ := json.Marshal(reply)
+		fmt.Fprintf(w, `{"responseId":"r1","candidates":[{"content":{"parts":[{"text":%s}]},"finishReason":"STOP"}]}`, data)
+	}))
+	t.Cleanup(server.Close)
+
+	p, err := newProvider(&types.ProviderConfig{
+		APIKey:            "secret",
+		ProviderMaxTokens: 256,
+	}, server.URL)
+	assert.NoError(t, err, "newProvider")
+	return p
+}
+
+func TestGetCompletion(t *testing.T) {
+	var got gemini.Request
+	p := newTestProvider(t, "```go\nfunc add(a, b int) int {\n\treturn a + b\n}\n```\n", &got)
+
+	resp, err := p.GetCompletion(context.Background(), &types.CompletionRequest{
+		FilePath:  "math.go",
+		Lines:     []string{"func add(a, b int) int {", "\tret", "}"},
+		CursorRow: 2,
+		CursorCol: 4,
+		FileDiffHistories: []*types.FileDiffHistory{{
+			FileName:    "math.go",
+			DiffHistory: []*types.DiffEntry{{Original: "func add() {", Updated: "func add(a, b int) int {"}},
+		}},
+		AdditionalContext: &types.ContextResult{
+			Diagnostics: &types.LinterErrors{Errors: []*types.LinterError{{
+				Message:  "undefined: ret",
+				Severity: "error",
+				Range:    &types.CursorRange{StartLine: 2},
+			}}},
+			Treesitter: &types.TreesitterContext{EnclosingSignature: "func add(a, b int) int"},
+		},
+	})
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Len(t, 1, resp.Completions, "completions")
+	c := resp.Completions[0]
+	assert.Equal(t, 1, c.StartLine, "start line")
+	assert.Equal(t, 3, c.EndLineInc, "end line")
+	assert.Equal(t, []string{"func add(a, b int) int {", "\treturn a + b", "}"}, c.Lines, "lines without fences")
+	assert.Equal(t, "r1", resp.MetricsInfo.ID, "metrics id")
+
+	prompt := got.Contents[0].Parts[0].Text
+	assert.Contains(t, prompt, "-func add() {", "diff history")
+	assert.Contains(t, prompt, "line 2: error: undefined: ret", "diagnostics")
+	assert.Contains(t, prompt, "enclosing: func add(a, b int) int", "treesitter")
+	assert.Contains(t, prompt, "\tret"+region.CursorTag, "cursor marker")
+	assert.NotNil(t, got.SystemInstruction, "system instruction")
+	assert.Equal(t, 256, got.GenerationConfig.MaxOutputTokens, "max output tokens")
+}
+
+func TestGetCompletion_UnchangedRegion(t *testing.T) {
+	var got gemini.Request
+	p := newTestProvider(t, "a\nb\n", &got)
+
+	resp, err := p.GetCompletion(context.Background(), &types.CompletionRequest{
+		Lines:     []string{"a", "b"},
+		CursorRow: 1,
+	})
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Len(t, 0, resp.Completions, "no completion for unchanged region")
+}
+
+func TestGetCompletion_EmptyRegionDeletesIt(t *testing.T) {
+	var got gemini.Request
+	p := newTestProvider(t, region.EditableStart+"\n"+region.EditableEnd+"\n", &got)
+
+	resp, err := p.GetCompletion(context.Background(), &types.CompletionRequest{
+		Lines:     []string{"a", "b"},
+		CursorRow: 1,
+	})
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Len(t, 1, resp.Completions, "completions")
+	c := resp.Completions[0]
+	assert.Equal(t, 1, c.StartLine, "start line")
+	assert.Equal(t, 2, c.EndLineInc, "end line")
+	assert.Len(t, 0, c.Lines, "no replacement lines")
+	assert.Equal(t, 2, resp.MetricsInfo.Deletions, "deleted lines")
+}
+
+func TestNewProvider_RequiresCredentials(t *testing.T) {
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+
+	_, err := NewProvider(&types.ProviderConfig{})
+
+	assert.Error(t, err, "no api key or service account")
+}
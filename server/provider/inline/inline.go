@@ -24,7 +24,7 @@ func NewProvider(config *types.ProviderConfig) *provider.Provider {
 	return &provider.Provider{
 		Name:          "inline",
 		Config:        config,
-		Client:        openai.NewClient(config.ProviderURL, config.CompletionPath, config.APIKey),
+		Client:        provider.NewClient(config),
 		StreamingType: provider.StreamingTokens, // Token-by-token streaming for ghost text
 		Preprocessors: []provider.Preprocessor{
 			provider.SkipIfTextAfterCursor(),
@@ -48,7 +48,7 @@ func buildPrompt(p *provider.Provider, ctx *provider.Context) *openai.Completion
 			Model:       p.Config.ProviderModel,
 			Prompt:      "",
 			Temperature: p.Config.ProviderTemperature,
-			MaxTokens:   p.Config.ProviderMaxTokens,
+			MaxTokens:   p.Config.OutputTokens(),
 			TopK:        p.Config.ProviderTopK,
 			Stop:        []string{"\n"},
 			N:           1,
@@ -75,7 +75,7 @@ func buildPrompt(p *provider.Provider, ctx *provider.Context) *openai.Completion
 		Model:       p.Config.ProviderModel,
 		Prompt:      promptBuilder.String(),
 		Temperature: p.Config.ProviderTemperature,
-		MaxTokens:   p.Config.ProviderMaxTokens,
+		MaxTokens:   p.Config.OutputTokens(),
 		TopK:        p.Config.ProviderTopK,
 		Stop:        []string{"\n"},
 		N:           1,
@@ -2,6 +2,7 @@ package mercuryapi
 
 import (
 	"context"
+	"fmt"
 	"slices"
 	"strings"
 
@@ -9,6 +10,7 @@ import (
 	"cursortab/engine"
 	"cursortab/logger"
 	"cursortab/metrics"
+	"cursortab/text"
 	"cursortab/types"
 )
 
@@ -51,7 +53,9 @@ func NewProvider(config *types.ProviderConfig) *Provider {
 
 // GetContextLimits implements engine.Provider
 func (p *Provider) GetContextLimits() engine.ContextLimits {
-	return engine.DefaultContextLimits()
+	limits := engine.DefaultContextLimits()
+	limits.MaxLSPSymbols = 5
+	return limits
 }
 
 // SendMetric implements metrics.Sender
@@ -90,10 +94,25 @@ func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionReque
 		return &types.CompletionResponse{}, nil
 	}
 
-	// Calculate editable and context regions
+	apiReq, editableStart, editableEnd := p.buildRequest(req)
+
+	apiResp, err := p.client.DoCompletion(ctx, apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	completionText := mercuryapi.ExtractCompletion(apiResp)
+
+	p.logResponse(apiResp, completionText)
+
+	return buildResponse(req, editableStart, editableEnd, completionText, apiResp.ID), nil
+}
+
+// buildRequest computes the editable and context regions and builds the API request.
+// Returns the request and the 1-indexed editable region bounds.
+func (p *Provider) buildRequest(req *types.CompletionRequest) (*mercuryapi.Request, int, int) {
 	editableStart, editableEnd, contextStart, contextEnd := computeRegions(req.Lines, req.CursorRow)
 
-	// Build the prompt
 	prompt := buildPrompt(
 		req.FilePath,
 		req.Lines,
@@ -101,10 +120,9 @@ func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionReque
 		contextStart, contextEnd,
 		req.CursorRow, req.CursorCol,
 		req.FileDiffHistories,
-		req.RecentBufferSnapshots,
+		slices.Concat(req.RecentBufferSnapshots, lspSnippets(req.GetLSP())),
 	)
 
-	// Build API request
 	apiReq := &mercuryapi.Request{
 		Model: mercuryapi.Model,
 		Messages: []mercuryapi.Message{
@@ -115,28 +133,25 @@ func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionReque
 
 	p.logRequest(apiReq, editableStart, editableEnd, contextStart, contextEnd)
 
-	apiResp, err := p.client.DoCompletion(ctx, apiReq)
-	if err != nil {
-		return nil, err
-	}
-
-	completionText := mercuryapi.ExtractCompletion(apiResp)
-
-	p.logResponse(apiResp, completionText)
+	return apiReq, editableStart, editableEnd
+}
 
+// buildResponse turns the rewritten editable region into a completion.
+// Returns an empty response when there is no prediction or nothing changed.
+func buildResponse(req *types.CompletionRequest, editableStart, editableEnd int, completionText, id string) *types.CompletionResponse {
 	if completionText == "" {
-		return &types.CompletionResponse{}, nil
+		return &types.CompletionResponse{}
 	}
 
 	newLines := strings.Split(completionText, "\n")
 
 	originalEditable := req.Lines[editableStart-1 : editableEnd]
 	if slices.Equal(newLines, originalEditable) {
-		return &types.CompletionResponse{}, nil
+		return &types.CompletionResponse{}
 	}
 
 	// Calculate metrics info for the engine
-	additions, deletions := countChanges(editableEnd-editableStart+1, len(newLines))
+	stats := text.ComputeDiffStats(originalEditable, newLines)
 
 	return &types.CompletionResponse{
 		Completions: []*types.Completion{{
@@ -145,11 +160,77 @@ func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionReque
 			Lines:      newLines,
 		}},
 		MetricsInfo: &types.MetricsInfo{
-			ID:        apiResp.ID,
-			Additions: additions,
-			Deletions: deletions,
+			ID:           id,
+			Additions:    stats.AddedLines,
+			Deletions:    stats.DeletedLines,
+			AddedBytes:   stats.AddedBytes,
+			DeletedBytes: stats.DeletedBytes,
 		},
-	}, nil
+	}
+}
+
+// Compile-time check that Provider implements LineStreamProvider
+var _ engine.LineStreamProvider = (*Provider)(nil)
+
+// streamContext carries state through the streaming pipeline
+type streamContext struct {
+	request       *types.CompletionRequest
+	editableStart int // 1-indexed
+	editableEnd   int // 1-indexed, inclusive
+	stream        *mercuryapi.LineStream
+}
+
+// GetWindowStart implements engine.TrimmedContext
+func (c *streamContext) GetWindowStart() int { return c.editableStart - 1 }
+
+// GetTrimmedLines implements engine.TrimmedContext
+func (c *streamContext) GetTrimmedLines() []string {
+	return c.request.Lines[c.editableStart-1 : c.editableEnd]
+}
+
+// GetStreamingType implements engine.LineStreamProvider
+func (p *Provider) GetStreamingType() int { return engine.StreamingTypeLines }
+
+// PrepareLineStream implements engine.LineStreamProvider.
+// The streamed lines rewrite the editable region, which is exposed as the
+// trimmed window so stages are diffed against it.
+func (p *Provider) PrepareLineStream(ctx context.Context, req *types.CompletionRequest) (engine.LineStream, any, error) {
+	defer logger.Trace("mercuryapi.PrepareLineStream")()
+
+	if len(req.Lines) == 0 {
+		return nil, nil, fmt.Errorf("mercuryapi: empty buffer")
+	}
+
+	apiReq, editableStart, editableEnd := p.buildRequest(req)
+	stream := p.client.DoCompletionStream(ctx, apiReq)
+
+	sctx := &streamContext{
+		request:       req,
+		editableStart: editableStart,
+		editableEnd:   editableEnd,
+		stream:        stream,
+	}
+
+	return stream, sctx, nil
+}
+
+// ValidateFirstLine implements engine.LineStreamProvider
+func (p *Provider) ValidateFirstLine(providerCtx any, firstLine string) error {
+	return nil
+}
+
+// FinishLineStream implements engine.LineStreamProvider
+func (p *Provider) FinishLineStream(providerCtx any, text string, finishReason string, stoppedEarly bool) (*types.CompletionResponse, error) {
+	sctx, ok := providerCtx.(*streamContext)
+	if !ok {
+		return &types.CompletionResponse{}, fmt.Errorf("invalid provider context type")
+	}
+
+	logger.Debug("mercuryapi: stream finished, %d chars, reason=%s, stoppedEarly=%v\n  Text:\n%s",
+		len(text), finishReason, stoppedEarly, text)
+
+	completionText := strings.TrimSuffix(text, "\n")
+	return buildResponse(sctx.request, sctx.editableStart, sctx.editableEnd, completionText, sctx.stream.ID), nil
 }
 
 func (p *Provider) logRequest(req *mercuryapi.Request, editableStart, editableEnd, contextStart, contextEnd int) {
@@ -178,11 +259,6 @@ func (p *Provider) logResponse(resp *mercuryapi.Response, completionText string)
 		completionText)
 }
 
-// countChanges calculates additions and deletions based on line counts.
-func countChanges(oldLineCount, newLineCount int) (additions, deletions int) {
-	return max(newLineCount, 1), max(oldLineCount, 1)
-}
-
 // computeRegions calculates the editable and context regions around the cursor.
 // Returns 1-indexed line numbers: editableStart, editableEnd, contextStart, contextEnd
 func computeRegions(lines []string, cursorRow int) (int, int, int, int) {
@@ -375,6 +451,22 @@ func buildPrompt(
 	return sb.String()
 }
 
+// lspSnippets turns the definitions of identifiers near the cursor into
+// recently viewed snippets, so the model sees types from other files.
+func lspSnippets(lsp *types.LSPContext) []*types.RecentBufferSnapshot {
+	if lsp == nil {
+		return nil
+	}
+	var snippets []*types.RecentBufferSnapshot
+	for _, s := range lsp.Symbols {
+		if len(s.Definition) == 0 {
+			continue
+		}
+		snippets = append(snippets, &types.RecentBufferSnapshot{FilePath: s.DefinitionPath, Lines: s.Definition})
+	}
+	return snippets
+}
+
 // formatDiffHistories formats diff histories in unified diff format.
 func formatDiffHistories(histories []*types.FileDiffHistory) string {
 	if len(histories) == 0 {
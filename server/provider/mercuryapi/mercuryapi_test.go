@@ -139,6 +139,17 @@ func TestBuildPromptWithSnapshots(t *testing.T) {
 	assert.Contains(t, prompt, "func helper() {}", "snippet content")
 }
 
+func TestLSPSnippets(t *testing.T) {
+	snippets := lspSnippets(&types.LSPContext{Symbols: []*types.LSPSymbol{
+		{Name: "User", DefinitionPath: "model/user.go", DefinitionLine: 12, Definition: []string{"type User struct {}"}},
+		{Name: "fmt", Hover: "package fmt"},
+	}})
+
+	assert.Len(t, 1, snippets, "definitions only")
+	assert.Equal(t, "model/user.go", snippets[0].FilePath, "snippet path")
+	assert.Equal(t, []string{"type User struct {}"}, snippets[0].Lines, "snippet lines")
+}
+
 func TestBuildPromptWithDiffHistory(t *testing.T) {
 	lines := []string{"code"}
 	histories := []*types.FileDiffHistory{
@@ -257,6 +268,11 @@ func TestProviderGetCompletion(t *testing.T) {
 	assert.Equal(t, 1, resp.Completions[0].StartLine, "start line")
 	assert.Equal(t, 1, resp.Completions[0].EndLineInc, "end line")
 	assert.Equal(t, []string{"func updated() {}"}, resp.Completions[0].Lines, "lines")
+	assert.NotNil(t, resp.MetricsInfo, "metrics info")
+	assert.Equal(t, 1, resp.MetricsInfo.Additions, "additions")
+	assert.Equal(t, 1, resp.MetricsInfo.Deletions, "deletions")
+	assert.Greater(t, resp.MetricsInfo.AddedBytes, 0, "added bytes")
+	assert.Greater(t, resp.MetricsInfo.DeletedBytes, 0, "deleted bytes")
 }
 
 func TestProviderGetCompletionEmpty(t *testing.T) {
@@ -433,3 +449,54 @@ func TestMultilineCompletion(t *testing.T) {
 	assert.Equal(t, "line2", resp.Completions[0].Lines[1], "second line")
 	assert.Equal(t, "line3", resp.Completions[0].Lines[2], "third line")
 }
+
+func TestProviderLineStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for _, delta := range []string{"```\nfunc a() {\n\tret", "urn 1\n}\n```"} {
+			data, _ := json.Marshal(mercuryapi.StreamChunk{
+				ID:      "resp-456",
+				Choices: []mercuryapi.StreamDelta{{Delta: mercuryapi.MessageContent{Content: delta}}},
+			})
+			w.Write([]byte("data: " + string(data) + "\n\n"))
+			flusher.Flush()
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+		flusher.Flush()
+	}))
+	defer server.Close()
+
+	provider := NewProvider(&types.ProviderConfig{
+		ProviderURL:       server.URL,
+		CompletionTimeout: 30000,
+	})
+
+	req := &types.CompletionRequest{
+		FilePath:  "test.go",
+		Lines:     []string{"func a() {", "\tret", "}"},
+		CursorRow: 2,
+		CursorCol: 4,
+	}
+
+	stream, providerCtx, err := provider.PrepareLineStream(context.Background(), req)
+	assert.NoError(t, err, "PrepareLineStream")
+
+	trimmed := providerCtx.(*streamContext)
+	assert.Equal(t, 0, trimmed.GetWindowStart(), "window start")
+	assert.Equal(t, req.Lines, trimmed.GetTrimmedLines(), "editable region")
+
+	var text string
+	var lines []string
+	for line := range stream.LinesChan() {
+		lines = append(lines, line)
+		text += line + "\n"
+	}
+	assert.Equal(t, []string{"func a() {", "\treturn 1", "}"}, lines, "streamed lines")
+
+	resp, err := provider.FinishLineStream(providerCtx, text, "stop", false)
+	assert.NoError(t, err, "FinishLineStream")
+	assert.Equal(t, 1, len(resp.Completions), "completions count")
+	assert.Equal(t, lines, resp.Completions[0].Lines, "lines")
+	assert.Equal(t, "resp-456", resp.MetricsInfo.ID, "metrics ID")
+}
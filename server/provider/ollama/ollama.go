@@ -0,0 +1,357 @@
+// Package ollama implements a provider for a local Ollama server.
+//
+// With the default completion_path ("/api/generate") the text around the cursor
+// is sent as a fill-in-the-middle request, and Ollama wraps it in the model's own
+// FIM template (codellama, qwen2.5-coder, starcoder2, ...):
+//
+//	{
+//	  "model":   "qwen2.5-coder:1.5b",
+//	  "prompt":  "...text before cursor...",
+//	  "suffix":  "...text after cursor...",
+//	  "stream":  true,
+//	  "options": {"temperature": 0, "top_k": 50, "num_predict": 512}
+//	}
+//
+// With completion_path "/api/chat" the window is sent to an instruct model with a
+// cursor marker, and the model replies with the text to insert.
+//
+// Both endpoints produce text inserted at the cursor. Streaming emits the trimmed
+// window with the insertion applied, line by line, so the engine can diff it
+// incrementally against the buffer.
+package ollama
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"cursortab/client/ollama"
+	"cursortab/engine"
+	"cursortab/logger"
+	"cursortab/provider"
+	"cursortab/types"
+	"cursortab/utils"
+)
+
+// cursorMarker marks the insertion point in chat prompts
+const cursorMarker = "<|cursor|>"
+
+const chatSystemPrompt = "You are a code completion engine. The user sends a file excerpt containing " + cursorMarker +
+	". Reply with only the code to insert at " + cursorMarker + ", without explanations, without repeating the surrounding code, and without markdown fences."
+
+// Compile-time checks that Provider implements the required interfaces
+var _ engine.Provider = (*Provider)(nil)
+var _ engine.LineStreamProvider = (*Provider)(nil)
+
+// Provider implements the Ollama provider
+type Provider struct {
+	config *types.ProviderConfig
+	client *ollama.Client
+	chat   bool
+}
+
+// NewProvider creates a new Ollama provider
+func NewProvider(config *types.ProviderConfig) *Provider {
+	return &Provider{
+		config: config,
+		client: ollama.NewClient(config.ProviderURL),
+		chat:   config.CompletionPath == ollama.ChatPath,
+	}
+}
+
+// window is the trimmed region of the buffer sent to the model
+type window struct {
+	lines      []string
+	start      int // 0-indexed offset of lines in the buffer
+	cursorLine int // 0-indexed within lines
+	cursorCol  int
+}
+
+func (w *window) before() string {
+	if w.cursorLine >= len(w.lines) {
+		return ""
+	}
+	line := w.lines[w.cursorLine]
+	return line[:min(w.cursorCol, len(line))]
+}
+
+func (w *window) after() string {
+	if w.cursorLine >= len(w.lines) {
+		return ""
+	}
+	line := w.lines[w.cursorLine]
+	return line[min(w.cursorCol, len(line)):]
+}
+
+// prefix returns all window text before the cursor
+func (w *window) prefix() string {
+	var b strings.Builder
+	for i := 0; i < w.cursorLine && i < len(w.lines); i++ {
+		b.WriteString(w.lines[i])
+		b.WriteString("\n")
+	}
+	b.WriteString(w.before())
+	return b.String()
+}
+
+// suffix returns all window text after the cursor
+func (w *window) suffix() string {
+	var b strings.Builder
+	b.WriteString(w.after())
+	for i := w.cursorLine + 1; i < len(w.lines); i++ {
+		b.WriteString("\n")
+		b.WriteString(w.lines[i])
+	}
+	return b.String()
+}
+
+func (p *Provider) trimWindow(req *types.CompletionRequest) *window {
+	lines, cursorLine, cursorCol, start, _ := utils.TrimContentAroundCursor(
+		req.Lines,
+		req.CursorRow-1,
+		req.CursorCol,
+		p.config.ProviderMaxTokens,
+		p.config.Tokenizer,
+	)
+	return &window{lines: lines, start: start, cursorLine: cursorLine, cursorCol: cursorCol}
+}
+
+// options returns the sampling options, with those set for req in the
+// provider options applied.
+func (p *Provider) options(req *types.CompletionRequest) ollama.Options {
+	options := ollama.Options{
+		Temperature: p.config.ProviderTemperature,
+		TopK:        p.config.ProviderTopK,
+		Seed:        p.config.RequestSeed(),
+		NumPredict:  p.config.OutputTokens(),
+	}
+	if v, ok := req.ProviderOptions.Temperature(); ok {
+		options.Temperature = v
+	}
+	if v, ok := req.ProviderOptions.TopP(); ok {
+		options.TopP = v
+	}
+	return options
+}
+
+// model returns the model to request, the provider options' one if set.
+func (p *Provider) model(req *types.CompletionRequest) string {
+	if v, ok := req.ProviderOptions.Model(); ok {
+		return v
+	}
+	return p.config.ProviderModel
+}
+
+// generate sends the window to the configured endpoint. onText, if set,
+// receives the generated text as it streams in.
+func (p *Provider) generate(ctx context.Context, req *types.CompletionRequest, w *window, onText func(string)) (*ollama.Result, error) {
+	if p.chat {
+		chatReq := &ollama.ChatRequest{
+			Model: p.model(req),
+			Messages: []ollama.Message{
+				{Role: "system", Content: chatSystemPrompt},
+				{Role: "user", Content: fmt.Sprintf("File: %s\n\n%s%s%s", req.FilePath, w.prefix(), cursorMarker, w.suffix())},
+			},
+			Options: p.options(req),
+			Headers: req.ProviderOptions.Headers(),
+		}
+		logger.Debug("ollama chat request:\n  URL: %s%s\n  Model: %s\n  Seed: %d\n  Prompt:\n%s",
+			p.config.ProviderURL, ollama.ChatPath, chatReq.Model, chatReq.Options.Seed, chatReq.Messages[1].Content)
+		return p.client.Chat(ctx, chatReq, onText)
+	}
+
+	genReq := &ollama.GenerateRequest{
+		Model:   p.model(req),
+		Prompt:  w.prefix(),
+		Suffix:  w.suffix(),
+		Options: p.options(req),
+		Headers: req.ProviderOptions.Headers(),
+	}
+	logger.Debug("ollama generate request:\n  URL: %s%s\n  Model: %s\n  Seed: %d\n  Prompt length: %d chars\n  Suffix length: %d chars",
+		p.config.ProviderURL, ollama.GeneratePath, genReq.Model, genReq.Options.Seed, len(genReq.Prompt), len(genReq.Suffix))
+	return p.client.Generate(ctx, genReq, onText)
+}
+
+// GetContextLimits implements engine.Provider
+func (p *Provider) GetContextLimits() engine.ContextLimits {
+	return engine.ContextLimits{}.WithDefaults()
+}
+
+// GetCompletion implements engine.Provider
+func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
+	defer logger.Trace("ollama.GetCompletion")()
+	empty := &types.CompletionResponse{Completions: []*types.Completion{}}
+
+	w := p.trimWindow(req)
+	result, err := p.generate(ctx, req, w, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: %w", err)
+	}
+	logger.Debug("ollama response:\n  DoneReason: %s\n  Text:\n%s", result.DoneReason, result.Text)
+
+	if strings.TrimSpace(result.Text) == "" {
+		return empty, nil
+	}
+
+	var lines []string
+	s := &splice{before: w.before(), after: w.after(), chat: p.chat, emit: func(line string) {
+		lines = append(lines, line)
+	}}
+	s.write(result.Text)
+	s.close()
+
+	if len(lines) == 1 && w.cursorLine < len(w.lines) && lines[0] == w.lines[w.cursorLine] {
+		return empty, nil
+	}
+
+	return &types.CompletionResponse{
+		Completions: []*types.Completion{{
+			StartLine:  req.CursorRow,
+			EndLineInc: req.CursorRow,
+			Lines:      lines,
+		}},
+	}, nil
+}
+
+// streamContext carries state through the streaming pipeline
+type streamContext struct {
+	window   *window
+	complete atomic.Bool // Set once every window line has been emitted
+}
+
+// GetWindowStart implements engine.TrimmedContext
+func (c *streamContext) GetWindowStart() int { return c.window.start }
+
+// GetTrimmedLines implements engine.TrimmedContext
+func (c *streamContext) GetTrimmedLines() []string { return c.window.lines }
+
+// lineStream implements engine.LineStream
+type lineStream struct {
+	lines  chan string
+	cancel context.CancelFunc
+}
+
+// LinesChan implements engine.LineStream
+func (s *lineStream) LinesChan() <-chan string { return s.lines }
+
+// Cancel implements engine.LineStream
+func (s *lineStream) Cancel() { s.cancel() }
+
+// GetStreamingType implements engine.LineStreamProvider
+func (p *Provider) GetStreamingType() int { return engine.StreamingTypeLines }
+
+// PrepareLineStream implements engine.LineStreamProvider.
+// The stream emits the window lines before the cursor, then the cursor line and
+// generated lines as they complete, then the rest of the window.
+func (p *Provider) PrepareLineStream(ctx context.Context, req *types.CompletionRequest) (engine.LineStream, any, error) {
+	defer logger.Trace("ollama.PrepareLineStream")()
+
+	w := p.trimWindow(req)
+	sctx := &streamContext{window: w}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stream := &lineStream{lines: make(chan string, 100), cancel: cancel}
+
+	go func() {
+		defer close(stream.lines)
+
+		emit := func(line string) {
+			select {
+			case stream.lines <- line:
+			case <-ctx.Done():
+			}
+		}
+
+		for i := 0; i < w.cursorLine && i < len(w.lines); i++ {
+			emit(w.lines[i])
+		}
+
+		s := &splice{before: w.before(), after: w.after(), chat: p.chat, emit: emit}
+		result, err := p.generate(ctx, req, w, s.write)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Warn("ollama: stream error: %v", err)
+			}
+			return
+		}
+		logger.Debug("ollama: stream finished, reason=%s", result.DoneReason)
+
+		s.close()
+		for i := w.cursorLine + 1; i < len(w.lines); i++ {
+			emit(w.lines[i])
+		}
+		if ctx.Err() == nil {
+			sctx.complete.Store(true)
+		}
+	}()
+
+	return stream, sctx, nil
+}
+
+// ValidateFirstLine implements engine.LineStreamProvider
+func (p *Provider) ValidateFirstLine(_ any, _ string) error {
+	return nil
+}
+
+// FinishLineStream implements engine.LineStreamProvider.
+// A complete stream replaces the whole window with the accumulated lines.
+func (p *Provider) FinishLineStream(providerCtx any, text string, finishReason string, stoppedEarly bool) (*types.CompletionResponse, error) {
+	empty := &types.CompletionResponse{Completions: []*types.Completion{}}
+	sctx, ok := providerCtx.(*streamContext)
+	if !ok || !sctx.complete.Load() || len(sctx.window.lines) == 0 {
+		return empty, nil
+	}
+
+	return &types.CompletionResponse{
+		Completions: []*types.Completion{{
+			StartLine:  sctx.window.start + 1,
+			EndLineInc: sctx.window.start + len(sctx.window.lines),
+			Lines:      strings.Split(strings.TrimSuffix(text, "\n"), "\n"),
+		}},
+	}, nil
+}
+
+// splice turns generated text into buffer lines, joining the first generated
+// line to the text before the cursor and the last one to the text after it.
+// In chat mode, markdown fence lines are dropped.
+type splice struct {
+	before  string
+	after   string
+	chat    bool
+	emit    func(line string)
+	pending strings.Builder
+	started bool
+}
+
+func (s *splice) write(text string) {
+	for _, ch := range text {
+		if ch != '\n' {
+			s.pending.WriteRune(ch)
+			continue
+		}
+		generated := s.pending.String()
+		s.pending.Reset()
+		if s.chat && provider.IsFence(generated) {
+			continue
+		}
+		s.emitLine(generated)
+	}
+}
+
+func (s *splice) close() {
+	generated := s.pending.String()
+	s.pending.Reset()
+	if s.chat && provider.IsFence(generated) {
+		generated = ""
+	}
+	s.emitLine(generated + s.after)
+}
+
+func (s *splice) emitLine(line string) {
+	if !s.started {
+		line = s.before + line
+		s.started = true
+	}
+	s.emit(line)
+}
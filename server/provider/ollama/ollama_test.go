@@ -0,0 +1,135 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/client/ollama"
+	"cursortab/types"
+)
+
+// newTestServer replies to both endpoints with the given text, streamed in chunks of one rune.
+func newTestServer(text string, onRequest func(path string, body map[string]any)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if onRequest != nil {
+			onRequest(r.URL.Path, body)
+		}
+
+		for _, ch := range text {
+			var chunk ollama.Chunk
+			if r.URL.Path == ollama.ChatPath {
+				chunk.Message = &ollama.Message{Role: "assistant", Content: string(ch)}
+			} else {
+				chunk.Response = string(ch)
+			}
+			data, _ := json.Marshal(chunk)
+			fmt.Fprintln(w, string(data))
+		}
+		fmt.Fprintln(w, `{"done":true,"done_reason":"stop"}`)
+	}))
+}
+
+func newTestProvider(url, path string) *Provider {
+	return NewProvider(&types.ProviderConfig{
+		ProviderURL:       url,
+		ProviderModel:     "qwen2.5-coder",
+		ProviderMaxTokens: 512,
+		CompletionPath:    path,
+	})
+}
+
+func TestGetCompletion_FIM(t *testing.T) {
+	var gotPath string
+	var gotBody map[string]any
+	server := newTestServer("Println(\"hi\")\n\treturn", func(path string, body map[string]any) {
+		gotPath, gotBody = path, body
+	})
+	defer server.Close()
+
+	req := &types.CompletionRequest{
+		FilePath:  "main.go",
+		Lines:     []string{"func main() {", "\tfmt.", "}"},
+		CursorRow: 2,
+		CursorCol: 5,
+	}
+
+	resp, err := newTestProvider(server.URL, ollama.GeneratePath).GetCompletion(context.Background(), req)
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Equal(t, ollama.GeneratePath, gotPath, "endpoint")
+	assert.Equal(t, "func main() {\n\tfmt.", gotBody["prompt"], "prompt is text before cursor")
+	assert.Equal(t, "\n}", gotBody["suffix"], "suffix is text after cursor")
+	assert.Len(t, 1, resp.Completions, "completions")
+	assert.Equal(t, 2, resp.Completions[0].StartLine, "StartLine")
+	assert.Equal(t, 2, resp.Completions[0].EndLineInc, "EndLineInc")
+	assert.Equal(t, []string{"\tfmt.Println(\"hi\")", "\treturn"}, resp.Completions[0].Lines, "lines")
+}
+
+func TestGetCompletion_ChatStripsFences(t *testing.T) {
+	var gotPath string
+	server := newTestServer("```go\nbar()\n```", func(path string, body map[string]any) {
+		gotPath = path
+	})
+	defer server.Close()
+
+	req := &types.CompletionRequest{
+		Lines:     []string{"x := foo"},
+		CursorRow: 1,
+		CursorCol: 8,
+	}
+
+	resp, err := newTestProvider(server.URL, ollama.ChatPath).GetCompletion(context.Background(), req)
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Equal(t, ollama.ChatPath, gotPath, "endpoint")
+	assert.Len(t, 1, resp.Completions, "completions")
+	assert.Equal(t, []string{"x := foobar()", ""}, resp.Completions[0].Lines, "lines")
+}
+
+func TestGetCompletion_EmptyResponse(t *testing.T) {
+	server := newTestServer("  ", nil)
+	defer server.Close()
+
+	req := &types.CompletionRequest{Lines: []string{"hello"}, CursorRow: 1, CursorCol: 5}
+	resp, err := newTestProvider(server.URL, ollama.GeneratePath).GetCompletion(context.Background(), req)
+
+	assert.NoError(t, err, "GetCompletion")
+	assert.Len(t, 0, resp.Completions, "completions")
+}
+
+func TestLineStream_EmitsWindowWithInsertion(t *testing.T) {
+	server := newTestServer("b()\n\tc()", nil)
+	defer server.Close()
+
+	p := newTestProvider(server.URL, ollama.GeneratePath)
+	req := &types.CompletionRequest{
+		Lines:     []string{"func f() {", "\ta", "}"},
+		CursorRow: 2,
+		CursorCol: 2,
+	}
+
+	stream, providerCtx, err := p.PrepareLineStream(context.Background(), req)
+	assert.NoError(t, err, "PrepareLineStream")
+
+	var lines []string
+	for line := range stream.LinesChan() {
+		lines = append(lines, line)
+	}
+	assert.Equal(t, []string{"func f() {", "\tab()", "\tc()", "}"}, lines, "streamed lines")
+
+	text := strings.Join(lines, "\n") + "\n"
+	resp, err := p.FinishLineStream(providerCtx, text, "stop", false)
+	assert.NoError(t, err, "FinishLineStream")
+	assert.Len(t, 1, resp.Completions, "completions")
+	assert.Equal(t, 1, resp.Completions[0].StartLine, "StartLine")
+	assert.Equal(t, 3, resp.Completions[0].EndLineInc, "EndLineInc")
+	assert.Equal(t, lines, resp.Completions[0].Lines, "window lines")
+}
@@ -168,6 +168,7 @@ func TrimContent() Preprocessor {
 			cursorLine,
 			ctx.Request.CursorCol,
 			p.Config.ProviderMaxTokens,
+			p.Config.Tokenizer,
 		)
 		ctx.TrimmedLines = trimmedLines
 		ctx.CursorLine = newCursorLine
@@ -214,6 +215,21 @@ func RejectEmpty() Postprocessor {
 	}
 }
 
+// DeleteWindowIfEmpty returns a postprocessor for models that rewrite the whole
+// window: an empty rewrite deletes the window. Truncated empty results are rejected.
+func DeleteWindowIfEmpty() Postprocessor {
+	return func(p *Provider, ctx *Context) (*types.CompletionResponse, bool) {
+		if strings.TrimSpace(ctx.Result.Text) != "" {
+			return nil, false
+		}
+		if ctx.Result.FinishReason == "length" || ctx.Result.StoppedEarly {
+			logger.Debug("%s: rejected, empty and truncated", p.Name)
+			return p.EmptyResponse(), true
+		}
+		return p.BuildWindowDeletion(ctx)
+	}
+}
+
 // RejectTruncated returns a postprocessor that rejects truncated completions
 func RejectTruncated() Postprocessor {
 	return func(p *Provider, ctx *Context) (*types.CompletionResponse, bool) {
@@ -427,3 +443,8 @@ func IsNoOpReplacement(newLines, oldLines []string) bool {
 	oldText := strings.TrimRight(strings.Join(oldLines, "\n"), " \t\n\r")
 	return newText == oldText
 }
+
+// IsFence reports whether the line opens or closes a markdown code fence.
+func IsFence(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "```")
+}
@@ -273,6 +273,41 @@ func TestRejectEmpty(t *testing.T) {
 	}
 }
 
+func TestDeleteWindowIfEmpty(t *testing.T) {
+	prov := &Provider{Name: "test"}
+
+	tests := []struct {
+		name            string
+		lines           []string
+		result          *openai.StreamResult
+		wantDone        bool
+		wantCompletions int
+	}{
+		{"has content", []string{"a", "b"}, &openai.StreamResult{Text: "a"}, false, 0},
+		{"empty deletes window", []string{"a", "b"}, &openai.StreamResult{Text: "", FinishReason: "stop"}, true, 1},
+		{"empty truncated", []string{"a", "b"}, &openai.StreamResult{Text: "", FinishReason: "length"}, true, 0},
+		{"blank window", []string{"", "  "}, &openai.StreamResult{Text: "\n", FinishReason: "stop"}, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &Context{
+				Request:     &types.CompletionRequest{Lines: tt.lines},
+				Result:      tt.result,
+				WindowStart: 0,
+				WindowEnd:   len(tt.lines),
+			}
+
+			resp, done := DeleteWindowIfEmpty()(prov, ctx)
+
+			assert.Equal(t, tt.wantDone, done, "DeleteWindowIfEmpty done status")
+			if done {
+				assert.Len(t, tt.wantCompletions, resp.Completions, "completions")
+			}
+		})
+	}
+}
+
 func TestRejectTruncated(t *testing.T) {
 	prov := &Provider{Name: "test"}
 
@@ -675,3 +710,9 @@ func TestValidateFirstLineAnchor_SmallFile(t *testing.T) {
 	// Should not error for small files
 	assert.NoError(t, err, "ValidateFirstLineAnchor for small files")
 }
+
+func TestIsFence(t *testing.T) {
+	assert.True(t, IsFence("```go"), "opening fence")
+	assert.True(t, IsFence("  ```"), "indented closing fence")
+	assert.False(t, IsFence("x := \"```\""), "fence inside a line")
+}
@@ -3,9 +3,11 @@ package provider
 import (
 	"context"
 	"cursortab/client/openai"
+	"cursortab/client/websocket"
 	"cursortab/engine"
 	"cursortab/logger"
 	"cursortab/types"
+	"encoding/json"
 	"errors"
 	"fmt"
 )
@@ -26,6 +28,7 @@ const (
 var _ engine.Provider = (*Provider)(nil)
 var _ engine.LineStreamProvider = (*Provider)(nil)
 var _ engine.TokenStreamProvider = (*Provider)(nil)
+var _ engine.PayloadMeasurer = (*Provider)(nil)
 
 // Client interface for API calls (enables mocking in tests)
 type Client interface {
@@ -34,6 +37,18 @@ type Client interface {
 	DoTokenStream(ctx context.Context, req *openai.CompletionRequest, maxChars int, stopTokens []string) *openai.LineStream
 }
 
+// NewClient returns the client for config's transport: the OpenAI-compatible
+// HTTP API, or a gateway streaming tokens over a WebSocket.
+func NewClient(config *types.ProviderConfig) Client {
+	if config.Transport == types.TransportWebSocket {
+		return websocket.NewClient(config.ProviderURL+config.CompletionPath, config.APIKey)
+	}
+	return openai.NewClient(config.ProviderURL, config.CompletionPath, config.APIKey)
+}
+
+// StreamFilter rewrites the lines of a stream before the engine renders them
+type StreamFilter func(ctx context.Context, stream engine.LineStream) engine.LineStream
+
 // Validator validates streaming content (e.g., first line anchor validation)
 // Called after receiving the first line. Return error to cancel the stream.
 type Validator func(p *Provider, ctx *Context, firstLine string) error
@@ -78,6 +93,7 @@ type Provider struct {
 	PromptBuilder  PromptBuilder
 	Postprocessors []Postprocessor
 	Validators     []Validator        // Validators run on first line during streaming
+	StreamFilter   StreamFilter       // Rewrites the streamed lines (nil streams them as received)
 	StopTokens     []string           // Stop tokens for streaming (provider-specific)
 	DiffBuilder    DiffHistoryBuilder // Processes diff history for the prompt
 	ContextLimits  engine.ContextLimits
@@ -102,7 +118,7 @@ func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionReque
 		}
 	}
 
-	completionReq := p.PromptBuilder(p, pctx)
+	completionReq := p.buildRequest(pctx)
 	p.logRequest(completionReq, pctx.MaxLines)
 
 	resp, err := p.Client.DoCompletion(ctx, completionReq)
@@ -127,6 +143,21 @@ func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionReque
 	return p.EmptyResponse(), nil
 }
 
+// PayloadSize implements engine.PayloadMeasurer
+func (p *Provider) PayloadSize(req *types.CompletionRequest) int {
+	pctx := &Context{Request: req}
+	for _, pre := range p.Preprocessors {
+		if err := pre(p, pctx); err != nil {
+			return 0
+		}
+	}
+	body, err := json.Marshal(p.buildRequest(pctx))
+	if err != nil {
+		return 0
+	}
+	return len(body)
+}
+
 // EmptyResponse returns an empty completion response
 func (p *Provider) EmptyResponse() *types.CompletionResponse {
 	return &types.CompletionResponse{
@@ -155,13 +186,50 @@ func (p *Provider) BuildCompletion(ctx *Context, startLine, endLineInc int, line
 	}, true
 }
 
+// BuildWindowDeletion creates a completion that deletes the whole window,
+// returning empty if the window is empty or only whitespace.
+func (p *Provider) BuildWindowDeletion(ctx *Context) (*types.CompletionResponse, bool) {
+	windowStart := max(ctx.WindowStart, 0)
+	windowEnd := min(ctx.WindowEnd, len(ctx.Request.Lines))
+	if windowStart >= windowEnd {
+		return p.EmptyResponse(), true
+	}
+
+	logger.Debug("%s: empty rewrite, deleting lines %d-%d", p.Name, windowStart+1, windowEnd)
+	return p.BuildCompletion(ctx, windowStart+1, windowEnd, []string{})
+}
+
+// buildRequest runs the prompt builder and stamps the sampling seed and the
+// provider options of the request
+func (p *Provider) buildRequest(pctx *Context) *openai.CompletionRequest {
+	req := p.PromptBuilder(p, pctx)
+	req.Seed = p.Config.RequestSeed()
+	applyOptions(req, pctx.Request.ProviderOptions)
+	return req
+}
+
+// applyOptions maps the provider options onto req
+func applyOptions(req *openai.CompletionRequest, options types.ProviderOptions) {
+	if v, ok := options.Temperature(); ok {
+		req.Temperature = v
+	}
+	if v, ok := options.TopP(); ok {
+		req.TopP = v
+	}
+	if v, ok := options.Model(); ok {
+		req.Model = v
+	}
+	req.Headers = options.Headers()
+}
+
 func (p *Provider) logRequest(req *openai.CompletionRequest, maxLines int) {
-	logger.Debug("%s provider request:\n  URL: %s%s\n  Model: %s\n  Temperature: %.2f\n  MaxTokens: %d\n  MaxLines: %d\n  Prompt length: %d chars\n  Prompt:\n%s",
+	logger.Debug("%s provider request:\n  URL: %s%s\n  Model: %s\n  Temperature: %.2f\n  Seed: %d\n  MaxTokens: %d\n  MaxLines: %d\n  Prompt length: %d chars\n  Prompt:\n%s",
 		p.Name,
 		p.Config.ProviderURL,
 		p.Config.CompletionPath,
 		req.Model,
 		req.Temperature,
+		req.Seed,
 		req.MaxTokens,
 		maxLines,
 		len(req.Prompt),
@@ -198,11 +266,14 @@ func (p *Provider) PrepareLineStream(ctx context.Context, req *types.CompletionR
 		}
 	}
 
-	completionReq := p.PromptBuilder(p, pctx)
+	completionReq := p.buildRequest(pctx)
 	pctx.CompletionRequest = completionReq
 	p.logRequest(completionReq, pctx.MaxLines)
 
-	stream := p.Client.DoLineStream(ctx, completionReq, pctx.MaxLines, p.StopTokens)
+	var stream engine.LineStream = p.Client.DoLineStream(ctx, completionReq, pctx.MaxLines, p.StopTokens)
+	if p.StreamFilter != nil {
+		stream = p.StreamFilter(ctx, stream)
+	}
 	return stream, pctx, nil
 }
 
@@ -260,7 +331,7 @@ func (p *Provider) PrepareTokenStream(ctx context.Context, req *types.Completion
 		}
 	}
 
-	completionReq := p.PromptBuilder(p, pctx)
+	completionReq := p.buildRequest(pctx)
 	pctx.CompletionRequest = completionReq
 	p.logRequest(completionReq, 0) // maxLines=0 for token streaming
 
@@ -1,7 +1,11 @@
 package provider
 
 import (
+	"context"
 	"cursortab/assert"
+	"cursortab/client/openai"
+	"cursortab/client/websocket"
+	"cursortab/types"
 	"testing"
 )
 
@@ -34,3 +38,84 @@ func TestContext_EmptyTrimmedLines(t *testing.T) {
 	lines := ctx.GetTrimmedLines()
 	assert.Nil(t, lines, "GetTrimmedLines should be nil")
 }
+
+type seedClient struct {
+	req *openai.CompletionRequest
+}
+
+func (c *seedClient) DoCompletion(ctx context.Context, req *openai.CompletionRequest) (*openai.CompletionResponse, error) {
+	c.req = req
+	return &openai.CompletionResponse{}, nil
+}
+
+func (c *seedClient) DoLineStream(ctx context.Context, req *openai.CompletionRequest, maxLines int, stopTokens []string) *openai.LineStream {
+	return nil
+}
+
+func (c *seedClient) DoTokenStream(ctx context.Context, req *openai.CompletionRequest, maxChars int, stopTokens []string) *openai.LineStream {
+	return nil
+}
+
+func TestNewClient_Transport(t *testing.T) {
+	config := &types.ProviderConfig{ProviderURL: "ws://gateway:8080", CompletionPath: "/v1/completions"}
+
+	_, isHTTP := NewClient(config).(*openai.Client)
+	assert.True(t, isHTTP, "http transport by default")
+
+	config.Transport = types.TransportWebSocket
+	client, isWebSocket := NewClient(config).(*websocket.Client)
+	assert.True(t, isWebSocket, "websocket transport")
+	assert.Equal(t, "ws://gateway:8080/v1/completions", client.URL, "websocket URL")
+}
+
+func TestGetCompletion_SendsSeed(t *testing.T) {
+	client := &seedClient{}
+	p := &Provider{
+		Name:   "test",
+		Config: &types.ProviderConfig{ProviderSeed: 42},
+		Client: client,
+		PromptBuilder: func(p *Provider, ctx *Context) *openai.CompletionRequest {
+			return &openai.CompletionRequest{Prompt: "x"}
+		},
+	}
+
+	_, err := p.GetCompletion(context.Background(), &types.CompletionRequest{})
+	assert.NoError(t, err, "GetCompletion")
+	assert.Equal(t, 42, client.req.Seed, "fixed seed")
+
+	p.Config.ProviderSeed = -1
+	_, err = p.GetCompletion(context.Background(), &types.CompletionRequest{})
+	assert.NoError(t, err, "GetCompletion")
+	assert.Greater(t, client.req.Seed, 0, "random seed")
+
+	p.Config.ProviderSeed = 0
+	_, err = p.GetCompletion(context.Background(), &types.CompletionRequest{})
+	assert.NoError(t, err, "GetCompletion")
+	assert.Equal(t, 0, client.req.Seed, "server default")
+}
+
+func TestGetCompletion_AppliesProviderOptions(t *testing.T) {
+	client := &seedClient{}
+	p := &Provider{
+		Name:   "test",
+		Config: &types.ProviderConfig{},
+		Client: client,
+		PromptBuilder: func(p *Provider, ctx *Context) *openai.CompletionRequest {
+			return &openai.CompletionRequest{Model: "base", Prompt: "x", Temperature: 0.5}
+		},
+	}
+
+	_, err := p.GetCompletion(context.Background(), &types.CompletionRequest{
+		ProviderOptions: types.ProviderOptions{
+			"top_p":   0.9,
+			"model":   "base-fast",
+			"headers": map[string]any{"X-Team": "editor"},
+			"unknown": true,
+		},
+	})
+	assert.NoError(t, err, "GetCompletion")
+	assert.Equal(t, 0.9, client.req.TopP, "top_p")
+	assert.Equal(t, "base-fast", client.req.Model, "model variant")
+	assert.Equal(t, 0.5, client.req.Temperature, "temperature kept")
+	assert.Equal(t, "editor", client.req.Headers["X-Team"], "header")
+}
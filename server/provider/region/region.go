@@ -0,0 +1,178 @@
+// Package region holds the prompt pieces shared by the providers that ask a
+// chat model to rewrite an editable region around the cursor (anthropic,
+// gemini).
+//
+// The file excerpt sent to the model marks the region with EditableStart and
+// EditableEnd and the cursor with CursorTag. The model replies with the
+// rewritten region, which replaces it.
+package region
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"cursortab/text"
+	"cursortab/tokenizer"
+	"cursortab/types"
+	"cursortab/utils"
+)
+
+// Radius is the number of lines above and below the cursor the model may rewrite
+const Radius = 5
+
+// Prompt markers
+const (
+	EditableStart = "<|editable_region_start|>"
+	EditableEnd   = "<|editable_region_end|>"
+	CursorTag     = "<|cursor|>"
+)
+
+// Window is the excerpt of the file sent to the model (1-indexed, inclusive)
+type Window struct {
+	Start, End                 int
+	EditableStart, EditableEnd int
+}
+
+// NewWindow trims the file to maxTokens around the cursor and places the
+// editable region within it
+func NewWindow(req *types.CompletionRequest, maxTokens int, tok tokenizer.Tokenizer) Window {
+	lines, _, _, offset, _ := utils.TrimContentAroundCursor(req.Lines, req.CursorRow-1, req.CursorCol, maxTokens, tok)
+	w := Window{Start: offset + 1, End: offset + len(lines)}
+	cursorRow := min(max(req.CursorRow, w.Start), w.End)
+	w.EditableStart = max(cursorRow-Radius, w.Start)
+	w.EditableEnd = min(cursorRow+Radius, w.End)
+	return w
+}
+
+// WriteExcerpt writes the window lines with the region markers and the cursor tag
+func WriteExcerpt(sb *strings.Builder, req *types.CompletionRequest, w Window) {
+	for i := w.Start; i <= w.End; i++ {
+		if i == w.EditableStart {
+			sb.WriteString(EditableStart)
+			sb.WriteString("\n")
+		}
+		line := req.Lines[i-1]
+		if i == req.CursorRow {
+			col := min(req.CursorCol, len(line))
+			line = line[:col] + CursorTag + line[col:]
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+		if i == w.EditableEnd {
+			sb.WriteString(EditableEnd)
+			sb.WriteString("\n")
+		}
+	}
+}
+
+// ParseCompletion turns the reply into the rewritten editable lines.
+// Returns nil for an empty reply, and no lines for a reply with only
+// fences or markers, which deletes the editable region.
+func ParseCompletion(reply string) []string {
+	if strings.TrimSpace(reply) == "" {
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimRight(reply, "\n"), "\n")
+	if strings.HasPrefix(strings.TrimSpace(lines[0]), "```") {
+		lines = lines[1:]
+		if len(lines) > 0 && strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), "```") {
+			lines = lines[:len(lines)-1]
+		}
+	}
+
+	result := []string{}
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == EditableStart || trimmed == EditableEnd {
+			continue
+		}
+		result = append(result, strings.ReplaceAll(line, CursorTag, ""))
+	}
+	return result
+}
+
+// Response builds the completion replacing the editable region with the reply.
+// An empty or unchanged reply is no suggestion.
+func Response(req *types.CompletionRequest, w Window, reply, id string) *types.CompletionResponse {
+	newLines := ParseCompletion(reply)
+	if newLines == nil {
+		return &types.CompletionResponse{}
+	}
+
+	originalEditable := req.Lines[w.EditableStart-1 : w.EditableEnd]
+	if slices.Equal(newLines, originalEditable) {
+		return &types.CompletionResponse{}
+	}
+
+	stats := text.ComputeDiffStats(originalEditable, newLines)
+
+	return &types.CompletionResponse{
+		Completions: []*types.Completion{{
+			StartLine:  w.EditableStart,
+			EndLineInc: w.EditableEnd,
+			Lines:      newLines,
+		}},
+		MetricsInfo: &types.MetricsInfo{
+			ID:           id,
+			Additions:    stats.AddedLines,
+			Deletions:    stats.DeletedLines,
+			AddedBytes:   stats.AddedBytes,
+			DeletedBytes: stats.DeletedBytes,
+		},
+	}
+}
+
+// FormatDiffHistories renders the edit history as unified diff hunks
+func FormatDiffHistories(histories []*types.FileDiffHistory) string {
+	var sb strings.Builder
+	for _, h := range histories {
+		for _, entry := range h.DiffHistory {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", h.FileName, h.FileName)
+			for line := range strings.SplitSeq(entry.Original, "\n") {
+				if line != "" {
+					sb.WriteString("-" + line + "\n")
+				}
+			}
+			for line := range strings.SplitSeq(entry.Updated, "\n") {
+				if line != "" {
+					sb.WriteString("+" + line + "\n")
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+// FormatDiagnostics renders one line per error, with the line it starts on
+// and the source that reported it
+func FormatDiagnostics(diags *types.LinterErrors) string {
+	var sb strings.Builder
+	for _, d := range diags.Errors {
+		line := 0
+		if d.Range != nil {
+			line = d.Range.StartLine
+		}
+		fmt.Fprintf(&sb, "line %d: %s: %s", line, d.Severity, d.Message)
+		if d.Source != "" {
+			fmt.Fprintf(&sb, " (%s)", d.Source)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// FormatGitHistory renders the latest commits of the current file, then the
+// commits that last changed the lines around the cursor
+func FormatGitHistory(h *types.GitHistoryContext) string {
+	var sb strings.Builder
+	for _, commit := range h.Commits {
+		sb.WriteString(commit)
+		sb.WriteString("\n")
+	}
+	for _, b := range h.Blame {
+		fmt.Fprintf(&sb, "lines %d-%d: %s %s: %s\n", b.StartLine, b.EndLine, b.Commit, b.Author, b.Summary)
+	}
+	return sb.String()
+}
@@ -0,0 +1,71 @@
+package region
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func TestNewWindow_EditableRegionAroundCursor(t *testing.T) {
+	lines := make([]string, 40)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+
+	w := NewWindow(&types.CompletionRequest{Lines: lines, CursorRow: 20}, 0, nil)
+
+	assert.Equal(t, 1, w.Start, "window start")
+	assert.Equal(t, 40, w.End, "window end")
+	assert.Equal(t, 15, w.EditableStart, "editable start")
+	assert.Equal(t, 25, w.EditableEnd, "editable end")
+}
+
+func TestWriteExcerpt(t *testing.T) {
+	req := &types.CompletionRequest{Lines: []string{"a", "bc", "d"}, CursorRow: 2, CursorCol: 1}
+
+	var sb strings.Builder
+	WriteExcerpt(&sb, req, Window{Start: 1, End: 3, EditableStart: 2, EditableEnd: 2})
+
+	assert.Equal(t, "a\n"+EditableStart+"\nb"+CursorTag+"c\n"+EditableEnd+"\nd\n", sb.String(), "excerpt")
+}
+
+func TestParseCompletion(t *testing.T) {
+	assert.Nil(t, ParseCompletion("  \n"), "empty reply")
+	assert.Equal(t, []string{}, ParseCompletion("```\n```\n"), "empty fenced reply")
+	assert.Equal(t, []string{"x := 1"}, ParseCompletion(EditableStart+"\nx := 1"+CursorTag+"\n"+EditableEnd+"\n"), "markers stripped")
+}
+
+func TestResponse(t *testing.T) {
+	req := &types.CompletionRequest{Lines: []string{"a", "b", "c"}}
+	w := Window{Start: 1, End: 3, EditableStart: 2, EditableEnd: 2}
+
+	assert.Len(t, 0, Response(req, w, "", "id").Completions, "empty reply")
+	assert.Len(t, 0, Response(req, w, "b\n", "id").Completions, "unchanged region")
+
+	resp := Response(req, w, "b2\n", "id")
+	assert.Len(t, 1, resp.Completions, "completions")
+	assert.Equal(t, 2, resp.Completions[0].StartLine, "start line")
+	assert.Equal(t, []string{"b2"}, resp.Completions[0].Lines, "lines")
+	assert.Equal(t, "id", resp.MetricsInfo.ID, "metrics id")
+}
+
+func TestFormatDiffHistories(t *testing.T) {
+	histories := []*types.FileDiffHistory{{
+		FileName:    "main.go",
+		DiffHistory: []*types.DiffEntry{{Original: "a\n", Updated: "b\nc\n"}},
+	}}
+
+	assert.Equal(t, "--- main.go\n+++ main.go\n-a\n+b\n+c\n", FormatDiffHistories(histories), "hunk")
+}
+
+func TestFormatDiagnostics(t *testing.T) {
+	diags := &types.LinterErrors{Errors: []*types.LinterError{
+		{Message: "undefined: x", Severity: "error", Source: "gopls", Range: &types.CursorRange{StartLine: 3}},
+		{Message: "unused", Severity: "warning"},
+	}}
+
+	assert.Equal(t, "line 3: error: undefined: x (gopls)\nline 0: warning: unused\n", FormatDiagnostics(diags), "diagnostics")
+}
@@ -29,6 +29,9 @@
 //	<|file_sep|>updated/file.go       (model completes from here)
 //
 // Stop tokens: <|file_sep|>, </s>
+//
+// Responses are requested with stream: true and consumed line by line over SSE,
+// so the engine can build stages incrementally while tokens arrive.
 package sweep
 
 import (
@@ -45,7 +48,7 @@ func NewProvider(config *types.ProviderConfig) *provider.Provider {
 	return &provider.Provider{
 		Name:          "sweep",
 		Config:        config,
-		Client:        openai.NewClient(config.ProviderURL, config.CompletionPath, config.APIKey),
+		Client:        provider.NewClient(config),
 		StreamingType: provider.StreamingLines,
 		Preprocessors: []provider.Preprocessor{
 			provider.TrimContent(),
@@ -53,7 +56,7 @@ func NewProvider(config *types.ProviderConfig) *provider.Provider {
 		DiffBuilder:   provider.FormatDiffHistoryOriginalUpdated("<|file_sep|>%s.diff\n"),
 		PromptBuilder: buildPrompt,
 		Postprocessors: []provider.Postprocessor{
-			provider.RejectEmpty(),
+			provider.DeleteWindowIfEmpty(),
 			provider.ValidateAnchorPosition(0.25),
 			provider.AnchorTruncation(0.75),
 			parseCompletion,
@@ -84,7 +87,7 @@ func buildPrompt(p *provider.Provider, ctx *provider.Context) *openai.Completion
 			Model:       p.Config.ProviderModel,
 			Prompt:      promptBuilder.String(),
 			Temperature: p.Config.ProviderTemperature,
-			MaxTokens:   p.Config.ProviderMaxTokens,
+			MaxTokens:   p.Config.OutputTokens(),
 			TopK:        p.Config.ProviderTopK,
 			Stop:        []string{"<|file_sep|>", "</s>"},
 			N:           1,
@@ -110,6 +113,12 @@ func buildPrompt(p *provider.Provider, ctx *provider.Context) *openai.Completion
 		promptBuilder.WriteString(gd)
 	}
 
+	if req.Instruction != "" {
+		promptBuilder.WriteString("<|file_sep|>context/instruction\n")
+		promptBuilder.WriteString(req.Instruction)
+		promptBuilder.WriteString("\n")
+	}
+
 	promptBuilder.WriteString("<|file_sep|>original/")
 	promptBuilder.WriteString(req.FilePath)
 	promptBuilder.WriteString("\n")
@@ -130,7 +139,7 @@ func buildPrompt(p *provider.Provider, ctx *provider.Context) *openai.Completion
 		Model:       p.Config.ProviderModel,
 		Prompt:      promptBuilder.String(),
 		Temperature: p.Config.ProviderTemperature,
-		MaxTokens:   p.Config.ProviderMaxTokens,
+		MaxTokens:   p.Config.OutputTokens(),
 		TopK:        p.Config.ProviderTopK,
 		Stop:        []string{"<|file_sep|>", "</s>"},
 		N:           1,
@@ -196,6 +205,9 @@ func parseCompletion(p *provider.Provider, ctx *provider.Context) (*types.Comple
 	completionText = strings.TrimSuffix(completionText, "<|file_sep|>")
 	completionText = strings.TrimSuffix(completionText, "</s>")
 	completionText = strings.TrimRight(completionText, " \t\n\r")
+	if completionText == "" {
+		return p.BuildWindowDeletion(ctx)
+	}
 
 	windowStart := ctx.WindowStart
 	windowEnd := ctx.WindowEnd
@@ -1,10 +1,15 @@
 package sweep
 
 import (
+	"context"
 	"cursortab/assert"
 	"cursortab/client/openai"
+	"cursortab/engine"
 	"cursortab/provider"
 	"cursortab/types"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 )
@@ -51,6 +56,25 @@ func TestBuildPrompt_WithContent(t *testing.T) {
 	assert.True(t, strings.Contains(req.Prompt, "line 1\nline 2"), "should contain file content")
 }
 
+func TestBuildPrompt_WithInstruction(t *testing.T) {
+	p := NewProvider(&types.ProviderConfig{ProviderModel: "test-model"})
+
+	ctx := &provider.Context{
+		Request: &types.CompletionRequest{
+			FilePath:    "main.go",
+			Lines:       []string{"x := 1 // cursortab: make it a constant"},
+			Instruction: "make it a constant",
+		},
+		TrimmedLines: []string{"x := 1 // cursortab: make it a constant"},
+		WindowStart:  0,
+		WindowEnd:    1,
+	}
+
+	req := p.PromptBuilder(p, ctx)
+
+	assert.True(t, strings.Contains(req.Prompt, "<|file_sep|>context/instruction\nmake it a constant\n<|file_sep|>original/main.go"), "should contain instruction section")
+}
+
 func TestBuildPrompt_WithDiffHistory(t *testing.T) {
 	config := &types.ProviderConfig{
 		ProviderModel: "test-model",
@@ -238,3 +262,110 @@ func TestParseCompletion_InvalidWindow(t *testing.T) {
 	assert.True(t, ok, "should succeed but return empty")
 	assert.Nil(t, resp.Completions, "should have no completions for invalid window")
 }
+
+func TestLineStream_StreamsSSEIncrementally(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for _, chunk := range []string{"func f() {\n\tre", "turn 1\n", "}\n"} {
+			data, _ := json.Marshal(map[string]any{"choices": []map[string]any{{"text": chunk}}})
+			w.Write([]byte("data: " + string(data) + "\n\n"))
+			flusher.Flush()
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+		flusher.Flush()
+	}))
+	defer server.Close()
+
+	p := NewProvider(&types.ProviderConfig{
+		ProviderURL:       server.URL,
+		ProviderModel:     "test-model",
+		ProviderMaxTokens: 512,
+		CompletionPath:    "/v1/completions",
+	})
+	var _ engine.LineStreamProvider = p
+	req := &types.CompletionRequest{
+		Lines:     []string{"func f() {", "\tre", "}"},
+		CursorRow: 2,
+		CursorCol: 3,
+	}
+
+	stream, providerCtx, err := p.PrepareLineStream(context.Background(), req)
+	assert.NoError(t, err, "PrepareLineStream")
+
+	var lines []string
+	for line := range stream.LinesChan() {
+		lines = append(lines, line)
+	}
+	assert.Equal(t, true, body["stream"], "request streams")
+	assert.Equal(t, []string{"func f() {", "\treturn 1", "}"}, lines, "streamed lines")
+
+	resp, err := p.FinishLineStream(providerCtx, strings.Join(lines, "\n")+"\n", "stop", false)
+	assert.NoError(t, err, "FinishLineStream")
+	assert.Len(t, 1, resp.Completions, "completions")
+	assert.Equal(t, "\treturn 1", resp.Completions[0].Lines[1], "completed line")
+}
+
+func TestParseCompletion_EmptyRewriteDeletesWindow(t *testing.T) {
+	p := NewProvider(&types.ProviderConfig{ProviderModel: "test-model"})
+
+	ctx := &provider.Context{
+		Request: &types.CompletionRequest{
+			Lines: []string{"keep", "drop 1", "drop 2"},
+		},
+		Result: &openai.StreamResult{
+			Text:         "<|file_sep|>",
+			FinishReason: "stop",
+		},
+		WindowStart: 1,
+		WindowEnd:   3,
+	}
+
+	resp, ok := parseCompletion(p, ctx)
+
+	assert.True(t, ok, "should succeed")
+	assert.Len(t, 1, resp.Completions, "completions")
+	c := resp.Completions[0]
+	assert.Equal(t, 2, c.StartLine, "start line")
+	assert.Equal(t, 3, c.EndLineInc, "end line")
+	assert.Len(t, 0, c.Lines, "no replacement lines")
+}
+
+func TestPostprocessors_EmptyResult(t *testing.T) {
+	lines := []string{"keep", "drop 1", "drop 2"}
+	tests := []struct {
+		name            string
+		result          *openai.StreamResult
+		wantCompletions int
+	}{
+		{"stop deletes window", &openai.StreamResult{Text: "", FinishReason: "stop"}, 1},
+		{"whitespace deletes window", &openai.StreamResult{Text: "\n  \n", FinishReason: "stop"}, 1},
+		{"truncated rejected", &openai.StreamResult{Text: "", FinishReason: "length"}, 0},
+		{"stopped early rejected", &openai.StreamResult{Text: "", StoppedEarly: true}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProvider(&types.ProviderConfig{ProviderModel: "test-model"})
+			ctx := &provider.Context{
+				Request:     &types.CompletionRequest{Lines: lines},
+				Result:      tt.result,
+				WindowStart: 0,
+				WindowEnd:   3,
+			}
+
+			var resp *types.CompletionResponse
+			for _, post := range p.Postprocessors {
+				if r, done := post(p, ctx); done {
+					resp = r
+					break
+				}
+			}
+
+			assert.NotNil(t, resp, "response")
+			assert.Len(t, tt.wantCompletions, resp.Completions, "completions")
+		})
+	}
+}
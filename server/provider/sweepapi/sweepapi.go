@@ -13,7 +13,10 @@
 //	  "retrieval_chunks": [
 //	    {"file_path": "diagnostics",         "content": "Line 10: [gopls] undefined: foo\n", ...},
 //	    {"file_path": "treesitter_context",  "content": "Language: go\nEnclosing scope: ...\n", ...},
-//	    {"file_path": "staged_git_diff",     "content": "<full diff or +/-symbol lines>", ...}
+//	    {"file_path": "staged_git_diff",     "content": "<full diff or +/-symbol lines>", ...},
+//	    {"file_path": "lib/user.go",         "content": "<definition of an identifier near the cursor>", ...},
+//	    {"file_path": "lsp_hover/name",      "content": "<hover text when the definition is unknown>", ...},
+//	    {"file_path": "lib/util.go",         "content": "<chunk of a visited file sharing identifiers with the cursor>", ...}
 //	  ]
 //	}
 //
@@ -23,20 +26,27 @@ package sweepapi
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"cursortab/client/grpc"
 	"cursortab/client/sweepapi"
 	"cursortab/engine"
 	"cursortab/logger"
 	"cursortab/metrics"
+	"cursortab/text"
 	"cursortab/types"
 )
 
-func (p *Provider) truncateContext(lines []string, cursorRow, cursorCol int) ([]string, int, int, int) {
+// truncateContext cuts lines to a window around the cursor within the input
+// limits. With treesitter scopes, the window holds the whole enclosing
+// function when it fits and its edges avoid cutting other functions in half.
+func (p *Provider) truncateContext(lines []string, cursorRow, cursorCol int, ts *types.TreesitterContext) ([]string, int, int, int) {
 	maxLines := p.limits.MaxInputLines
 	maxBytes := p.limits.MaxInputBytes
 
@@ -69,6 +79,7 @@ func (p *Provider) truncateContext(lines []string, cursorRow, cursorCol int) ([]
 	if endLine == len(lines) {
 		startLine = max(0, endLine-effectiveMax)
 	}
+	startLine, endLine = snapToScopes(startLine, endLine, cursorIdx, effectiveMax, len(lines), ts)
 
 	result := lines[startLine:endLine]
 
@@ -85,6 +96,39 @@ func (p *Provider) truncateContext(lines []string, cursorRow, cursorCol int) ([]
 	return result, newCursorRow, cursorCol, startLine
 }
 
+// snapToScopes moves the edges of the window [start, end) of 0-indexed lines
+// to function boundaries: the window shifts to hold the function enclosing
+// the cursor when it fits in size lines, then functions cut by an edge are
+// left out, keeping the cursor line. The window is unchanged without scopes.
+func snapToScopes(start, end, cursorIdx, size, lineCount int, ts *types.TreesitterContext) (int, int) {
+	if ts == nil {
+		return start, end
+	}
+
+	if ts.EnclosingStart > 0 && ts.EnclosingEnd >= ts.EnclosingStart && ts.EnclosingEnd-ts.EnclosingStart+1 <= size {
+		encStart, encEnd := ts.EnclosingStart-1, min(ts.EnclosingEnd, lineCount)
+		if start > encStart {
+			start, end = encStart, min(encStart+size, lineCount)
+		} else if end < encEnd {
+			start, end = max(encEnd-size, 0), encEnd
+		}
+	}
+
+	for _, s := range ts.Siblings {
+		if s.Line <= 0 || s.EndLine < s.Line {
+			continue
+		}
+		first, last := s.Line-1, s.EndLine-1
+		if first < start && start <= last && last < cursorIdx {
+			start = last + 1
+		}
+		if first < end && end <= last && first > cursorIdx {
+			end = first
+		}
+	}
+	return start, end
+}
+
 func (p *Provider) trimByBytes(lines []string, cursorIdxInWindow, baseOffset int) ([]string, int) {
 	maxBytes := p.limits.MaxInputBytes
 
@@ -199,25 +243,53 @@ func (p *Provider) truncateDiffHistories(histories []*types.FileDiffHistory) []*
 	return result
 }
 
+// client sends requests to the Sweep API, over HTTP+ndjson or gRPC.
+type client interface {
+	DoCompletion(ctx context.Context, req *sweepapi.AutocompleteRequest) ([]*sweepapi.AutocompleteResponse, error)
+	DoCompletionStream(ctx context.Context, req *sweepapi.AutocompleteRequest, fileContents string) *sweepapi.LineStream
+	TrackMetrics(ctx context.Context, req *sweepapi.MetricsRequest) error
+}
+
 // Provider implements the Sweep hosted API provider
 type Provider struct {
 	config *types.ProviderConfig
-	client *sweepapi.Client
+	client client
+	url    string // Where requests are sent, for logging
 	limits engine.ContextLimits
 }
 
-// NewProvider creates a new Sweep API provider
+// NewProvider creates a new Sweep API provider. With the "grpc" transport,
+// requests go to a self-hosted gateway at the configured URL.
 func NewProvider(config *types.ProviderConfig) *Provider {
-	client := sweepapi.NewClient(config.ProviderURL, config.APIKey, config.CompletionTimeout)
-	client.UserAgent = fmt.Sprintf("Neovim v%s - OS: %s - cursortab.nvim v%s", config.EditorVersion, config.EditorOS, config.Version)
+	userAgent := fmt.Sprintf("Neovim v%s - OS: %s - cursortab.nvim v%s", config.EditorVersion, config.EditorOS, config.Version)
+
+	var c client
+	var url string
+	if config.Transport == types.TransportGRPC {
+		grpcClient := grpc.NewClient(config.ProviderURL, config.APIKey, config.CompletionTimeout)
+		grpcClient.UserAgent = userAgent
+		c, url = grpcClient, grpcClient.URL
+	} else {
+		httpClient := sweepapi.NewClient(config.ProviderURL, config.APIKey, config.CompletionTimeout)
+		httpClient.UserAgent = userAgent
+		c, url = httpClient, httpClient.URL
+	}
 
 	return &Provider{
 		config: config,
-		client: client,
+		client: c,
+		url:    url,
 		limits: engine.ContextLimits{
-			MaxInputLines: 50_000,
-			MaxInputBytes: 10_000_000,
-		},
+			MaxLSPSymbols:      5,
+			MaxGitCommits:      5,
+			MaxRetrievalChunks: 5,
+			MaxInputLines:      50_000,
+			MaxInputBytes:      10_000_000,
+		}.Override(engine.ContextLimits{
+			MaxInputLines:   config.MaxInputLines,
+			MaxInputBytes:   config.MaxInputBytes,
+			MaxOutputTokens: config.MaxOutputTokens,
+		}),
 	}
 }
 
@@ -258,8 +330,9 @@ func (p *Provider) SendMetric(ctx context.Context, event metrics.Event) {
 	}
 }
 
-// Compile-time check that Provider implements LineStreamProvider
+// Compile-time checks that Provider implements LineStreamProvider and PayloadMeasurer
 var _ engine.LineStreamProvider = (*Provider)(nil)
+var _ engine.PayloadMeasurer = (*Provider)(nil)
 
 // streamContext carries state through the streaming pipeline
 type streamContext struct {
@@ -274,28 +347,34 @@ func (c *streamContext) GetWindowStart() int { return c.trimOffset }
 // GetTrimmedLines implements engine.TrimmedContext
 func (c *streamContext) GetTrimmedLines() []string { return c.trimmedLines }
 
-// GetStreamingType implements engine.LineStreamProvider
-func (p *Provider) GetStreamingType() int { return engine.StreamingTypeLines }
-
-// PrepareLineStream implements engine.LineStreamProvider
-func (p *Provider) PrepareLineStream(ctx context.Context, req *types.CompletionRequest) (engine.LineStream, any, error) {
-	defer logger.Trace("sweepapi.PrepareLineStream")()
-
-	lines, cursorRow, cursorCol, trimOffset := p.truncateContext(req.Lines, req.CursorRow, req.CursorCol)
+// buildRequest builds the API request for req. Returns it with the lines of
+// the file it carries and how many lines were trimmed from the start.
+func (p *Provider) buildRequest(req *types.CompletionRequest) (*sweepapi.AutocompleteRequest, []string, int) {
+	lines, cursorRow, cursorCol, trimOffset := p.truncateContext(req.Lines, req.CursorRow, req.CursorCol, req.GetTreesitter())
 	if trimOffset > 0 {
 		logger.Debug("sweepapi: truncated context, removed %d lines from start", trimOffset)
 	}
 
+	// Build file contents from lines
 	fileContents := strings.Join(lines, "\n")
+
+	// Convert cursor to byte offset
 	cursorPosition := sweepapi.CursorToByteOffset(lines, cursorRow, cursorCol)
 
+	// Truncate and format recent changes from diff histories
 	diffHistories := p.truncateDiffHistories(req.FileDiffHistories)
 	recentChanges := formatRecentChanges(diffHistories)
 
+	// Format diagnostics, treesitter, and git diff as retrieval chunks
 	retrievalChunks := p.formatDiagnostics(req.GetDiagnostics())
 	retrievalChunks = append(retrievalChunks, formatTreesitterChunk(req.GetTreesitter())...)
 	retrievalChunks = append(retrievalChunks, formatGitDiffChunk(req.GetGitDiff())...)
+	retrievalChunks = append(retrievalChunks, formatGitHistoryChunk(req.GetGitHistory())...)
+	retrievalChunks = append(retrievalChunks, formatLSPChunks(req.GetLSP())...)
+	retrievalChunks = append(retrievalChunks, formatRetrievalChunks(req.RetrievalChunks)...)
+	retrievalChunks = append(retrievalChunks, formatInstructionChunk(req.Instruction)...)
 
+	// Extract repo name from workspace path
 	repoName := filepath.Base(req.WorkspacePath)
 	if repoName == "" || repoName == "." {
 		repoName = "untitled"
@@ -316,7 +395,29 @@ func (p *Provider) PrepareLineStream(ctx context.Context, req *types.CompletionR
 		RecentUserActions:    convertUserActions(req.UserActions),
 		RetrievalChunks:      retrievalChunks,
 	}
+	return apiReq, lines, trimOffset
+}
+
+// PayloadSize implements engine.PayloadMeasurer. The size is that of the JSON
+// before compression.
+func (p *Provider) PayloadSize(req *types.CompletionRequest) int {
+	apiReq, _, _ := p.buildRequest(req)
+	body, err := json.Marshal(apiReq)
+	if err != nil {
+		return 0
+	}
+	return len(body)
+}
+
+// GetStreamingType implements engine.LineStreamProvider
+func (p *Provider) GetStreamingType() int { return engine.StreamingTypeLines }
 
+// PrepareLineStream implements engine.LineStreamProvider
+func (p *Provider) PrepareLineStream(ctx context.Context, req *types.CompletionRequest) (engine.LineStream, any, error) {
+	defer logger.Trace("sweepapi.PrepareLineStream")()
+
+	apiReq, lines, trimOffset := p.buildRequest(req)
+	fileContents := apiReq.FileContents
 	p.logRequest(apiReq)
 
 	stream := p.client.DoCompletionStream(ctx, apiReq, fileContents)
@@ -370,50 +471,8 @@ func (p *Provider) GetContextLimits() engine.ContextLimits {
 func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionRequest) (*types.CompletionResponse, error) {
 	defer logger.Trace("sweepapi.GetCompletion")()
 
-	// Apply context limits
-	lines, cursorRow, cursorCol, trimOffset := p.truncateContext(req.Lines, req.CursorRow, req.CursorCol)
-	if trimOffset > 0 {
-		logger.Debug("sweepapi: truncated context, removed %d lines from start", trimOffset)
-	}
-
-	// Build file contents from lines
-	fileContents := strings.Join(lines, "\n")
-
-	// Convert cursor to byte offset
-	cursorPosition := sweepapi.CursorToByteOffset(lines, cursorRow, cursorCol)
-
-	// Truncate and format recent changes from diff histories
-	diffHistories := p.truncateDiffHistories(req.FileDiffHistories)
-	recentChanges := formatRecentChanges(diffHistories)
-
-	// Format diagnostics, treesitter, and git diff as retrieval chunks
-	retrievalChunks := p.formatDiagnostics(req.GetDiagnostics())
-	retrievalChunks = append(retrievalChunks, formatTreesitterChunk(req.GetTreesitter())...)
-	retrievalChunks = append(retrievalChunks, formatGitDiffChunk(req.GetGitDiff())...)
-
-	// Extract repo name from workspace path
-	repoName := filepath.Base(req.WorkspacePath)
-	if repoName == "" || repoName == "." {
-		repoName = "untitled"
-	}
-
-	// Build API request
-	apiReq := &sweepapi.AutocompleteRequest{
-		RepoName:             repoName,
-		FilePath:             req.FilePath,
-		FileContents:         fileContents,
-		OriginalFileContents: fileContents,
-		CursorPosition:       cursorPosition,
-		RecentChanges:        recentChanges,
-		ChangesAboveCursor:   true,
-		MultipleSuggestions:  true,
-		UseBytes:             true,
-		PrivacyModeEnabled:   p.config.PrivacyMode,
-		FileChunks:           p.buildFileChunks(req.RecentBufferSnapshots),
-		RecentUserActions:    convertUserActions(req.UserActions),
-		RetrievalChunks:      retrievalChunks,
-	}
-
+	apiReq, _, trimOffset := p.buildRequest(req)
+	fileContents := apiReq.FileContents
 	p.logRequest(apiReq)
 
 	responses, err := p.client.DoCompletion(ctx, apiReq)
@@ -471,7 +530,7 @@ func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionReque
 	logger.Debug("sweepapi: %d edits merged -> lines [%d:%d] (orig end %d)",
 		len(edits), startLine, startLine+len(newLines)-1, origEndLine)
 
-	additions, deletions := countChanges(origEndLine-startLine+1, len(newLines))
+	stats := text.ComputeDiffStats(origLines[firstDiff:origEnd+1], newLines)
 
 	return &types.CompletionResponse{
 		Completions: []*types.Completion{{
@@ -480,16 +539,18 @@ func (p *Provider) GetCompletion(ctx context.Context, req *types.CompletionReque
 			Lines:      newLines,
 		}},
 		MetricsInfo: &types.MetricsInfo{
-			ID:        autocompleteID,
-			Additions: additions,
-			Deletions: deletions,
+			ID:           autocompleteID,
+			Additions:    stats.AddedLines,
+			Deletions:    stats.DeletedLines,
+			AddedBytes:   stats.AddedBytes,
+			DeletedBytes: stats.DeletedBytes,
 		},
 	}, nil
 }
 
 func (p *Provider) logRequest(req *sweepapi.AutocompleteRequest) {
 	logger.Debug("sweepapi request:\n  URL: %s\n  RepoName: %s\n  FilePath: %s\n  CursorPosition: %d\n  FileContents length: %d chars\n  RecentChanges length: %d chars\n  FileChunks: %d\n  RetrievalChunks: %d\n  UserActions: %d\n  FileContents:\n%s",
-		p.client.URL,
+		p.url,
 		req.RepoName,
 		req.FilePath,
 		req.CursorPosition,
@@ -510,11 +571,6 @@ func (p *Provider) logResponse(edits []*sweepapi.AutocompleteResponse) {
 	logger.Debug("sweepapi response: %d edits\n%s", len(edits), sb.String())
 }
 
-// countChanges calculates additions and deletions based on line counts.
-func countChanges(oldLineCount, newLineCount int) (additions, deletions int) {
-	return max(newLineCount, 1), max(oldLineCount, 1)
-}
-
 // formatRecentChanges converts FileDiffHistories to a string for the API
 // Format: "File: path:\n{diff}\n"
 func formatRecentChanges(histories []*types.FileDiffHistory) string {
@@ -689,6 +745,86 @@ func formatGitDiffChunk(gd *types.GitDiffContext) []sweepapi.FileChunk {
 	}}
 }
 
+// formatGitHistoryChunk converts the commits of the current file and the
+// blame of the cursor region to a FileChunk for the API
+func formatGitHistoryChunk(h *types.GitHistoryContext) []sweepapi.FileChunk {
+	if h == nil {
+		return nil
+	}
+
+	lines := slices.Clone(h.Commits)
+	for _, b := range h.Blame {
+		lines = append(lines, fmt.Sprintf("lines %d-%d: %s %s: %s", b.StartLine, b.EndLine, b.Commit, b.Author, b.Summary))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return []sweepapi.FileChunk{{
+		FilePath:  "git_history",
+		Content:   strings.Join(lines, "\n") + "\n",
+		StartLine: 1,
+		EndLine:   len(lines),
+	}}
+}
+
+// formatInstructionChunk converts the instruction comment on the cursor line
+// to a FileChunk for the API
+func formatInstructionChunk(instruction string) []sweepapi.FileChunk {
+	if instruction == "" {
+		return nil
+	}
+
+	return []sweepapi.FileChunk{{
+		FilePath:  "user_instruction",
+		Content:   instruction,
+		StartLine: 1,
+		EndLine:   1,
+	}}
+}
+
+// formatLSPChunks converts the identifiers near the cursor to FileChunks for
+// the API: the lines of their definition in another file, or else their hover text
+func formatLSPChunks(lsp *types.LSPContext) []sweepapi.FileChunk {
+	if lsp == nil {
+		return nil
+	}
+
+	chunks := make([]sweepapi.FileChunk, 0, len(lsp.Symbols))
+	for _, s := range lsp.Symbols {
+		if len(s.Definition) > 0 {
+			chunks = append(chunks, sweepapi.FileChunk{
+				FilePath:  s.DefinitionPath,
+				Content:   strings.Join(s.Definition, "\n") + "\n",
+				StartLine: s.DefinitionLine,
+				EndLine:   s.DefinitionLine + len(s.Definition) - 1,
+			})
+			continue
+		}
+		chunks = append(chunks, sweepapi.FileChunk{
+			FilePath:  "lsp_hover/" + s.Name,
+			Content:   s.Hover + "\n",
+			StartLine: 1,
+			EndLine:   strings.Count(s.Hover, "\n") + 1,
+		})
+	}
+	return chunks
+}
+
+// formatRetrievalChunks converts chunks of visited files to FileChunks for the API
+func formatRetrievalChunks(chunks []*types.RetrievalChunk) []sweepapi.FileChunk {
+	result := make([]sweepapi.FileChunk, 0, len(chunks))
+	for _, c := range chunks {
+		result = append(result, sweepapi.FileChunk{
+			FilePath:  c.FilePath,
+			Content:   strings.Join(c.Lines, "\n") + "\n",
+			StartLine: c.StartLine,
+			EndLine:   c.StartLine + len(c.Lines) - 1,
+		})
+	}
+	return result
+}
+
 // convertUserActions converts types.UserAction to sweepapi.UserAction.
 // Since actions are small fixed-size records, we just convert them all
 // (the engine already limits to MaxUserActions=16).
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -119,6 +120,58 @@ func TestFormatDiagnostics(t *testing.T) {
 	}
 }
 
+func TestFormatLSPChunks(t *testing.T) {
+	chunks := formatLSPChunks(&types.LSPContext{Symbols: []*types.LSPSymbol{
+		{Name: "User", Hover: "type User struct", DefinitionPath: "model/user.go", DefinitionLine: 12, Definition: []string{"type User struct {", "\tName string", "}"}},
+		{Name: "fmt", Hover: "package fmt"},
+	}})
+
+	assert.Len(t, 2, chunks, "one chunk per symbol")
+	assert.Equal(t, "model/user.go", chunks[0].FilePath, "definition file")
+	assert.Equal(t, 12, chunks[0].StartLine, "definition start")
+	assert.Equal(t, 14, chunks[0].EndLine, "definition end")
+	assert.Equal(t, "type User struct {\n\tName string\n}\n", chunks[0].Content, "definition lines")
+	assert.Equal(t, "lsp_hover/fmt", chunks[1].FilePath, "hover only")
+	assert.Equal(t, "package fmt\n", chunks[1].Content, "hover text")
+	assert.Len(t, 0, formatLSPChunks(nil), "no lsp context")
+}
+
+func TestFormatRetrievalChunks(t *testing.T) {
+	chunks := formatRetrievalChunks([]*types.RetrievalChunk{
+		{FilePath: "util.go", StartLine: 21, Lines: []string{"func helper() {", "}"}},
+	})
+
+	assert.Len(t, 1, chunks, "chunks")
+	assert.Equal(t, "util.go", chunks[0].FilePath, "path")
+	assert.Equal(t, 21, chunks[0].StartLine, "start line")
+	assert.Equal(t, 22, chunks[0].EndLine, "end line")
+	assert.Equal(t, "func helper() {\n}\n", chunks[0].Content, "content")
+}
+
+func TestFormatGitHistoryChunk(t *testing.T) {
+	assert.Nil(t, formatGitHistoryChunk(nil), "no git history")
+
+	chunks := formatGitHistoryChunk(&types.GitHistoryContext{
+		Commits: []string{"a1b2c3d Rename fetch to load"},
+		Blame:   []*types.BlameEntry{{StartLine: 4, EndLine: 6, Commit: "a1b2c3d", Author: "Ada", Summary: "Rename fetch to load"}},
+	})
+
+	assert.Len(t, 1, chunks, "chunks")
+	assert.Equal(t, "git_history", chunks[0].FilePath, "path")
+	assert.Equal(t, "a1b2c3d Rename fetch to load\nlines 4-6: a1b2c3d Ada: Rename fetch to load\n", chunks[0].Content, "content")
+	assert.Equal(t, 2, chunks[0].EndLine, "end line")
+}
+
+func TestFormatInstructionChunk(t *testing.T) {
+	assert.Nil(t, formatInstructionChunk(""), "no instruction")
+
+	chunks := formatInstructionChunk("add error handling")
+
+	assert.Len(t, 1, chunks, "chunks")
+	assert.Equal(t, "user_instruction", chunks[0].FilePath, "path")
+	assert.Equal(t, "add error handling", chunks[0].Content, "content")
+}
+
 func TestProviderGetCompletion(t *testing.T) {
 	// Create a test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -274,8 +327,10 @@ func TestGetCompletionReturnsMetricsInfo(t *testing.T) {
 	// Verify MetricsInfo is returned
 	assert.NotNil(t, resp.MetricsInfo, "MetricsInfo should be set")
 	assert.Equal(t, "test-completion-id", resp.MetricsInfo.ID, "MetricsInfo.ID")
-	assert.True(t, resp.MetricsInfo.Additions > 0, "MetricsInfo.Additions should be positive")
-	assert.True(t, resp.MetricsInfo.Deletions > 0, "MetricsInfo.Deletions should be positive")
+	assert.Equal(t, 1, resp.MetricsInfo.Additions, "MetricsInfo.Additions")
+	assert.Equal(t, 1, resp.MetricsInfo.Deletions, "MetricsInfo.Deletions")
+	assert.Equal(t, len(" world"), resp.MetricsInfo.AddedBytes, "MetricsInfo.AddedBytes")
+	assert.Equal(t, 0, resp.MetricsInfo.DeletedBytes, "MetricsInfo.DeletedBytes")
 }
 
 func TestGetCompletionIncludesFileChunks(t *testing.T) {
@@ -466,3 +521,69 @@ func TestGetCompletionWithEmptyContextFields(t *testing.T) {
 	assert.True(t, ok, "UserActions should be an array in JSON")
 	assert.Equal(t, 0, len(userActions), "UserActions should be empty")
 }
+
+func TestPayloadSize(t *testing.T) {
+	provider := NewProvider(&types.ProviderConfig{ProviderURL: "http://localhost"})
+	req := &types.CompletionRequest{
+		FilePath:  "main.go",
+		Lines:     []string{"package main"},
+		CursorRow: 1,
+	}
+
+	small := provider.PayloadSize(req)
+	req.RecentBufferSnapshots = []*types.RecentBufferSnapshot{{FilePath: "util.go", Lines: []string{strings.Repeat("x", 1000)}}}
+	large := provider.PayloadSize(req)
+
+	assert.Greater(t, small, len("package main"), "includes the file")
+	assert.GreaterOrEqual(t, large-small, 1000, "includes file chunks")
+}
+
+func TestContextLimitOverrides(t *testing.T) {
+	limits := NewProvider(&types.ProviderConfig{MaxInputLines: 300}).GetContextLimits()
+
+	assert.Equal(t, 300, limits.MaxInputLines, "overridden input lines")
+	assert.Equal(t, 10_000_000, limits.MaxInputBytes, "default input bytes")
+	assert.Equal(t, 5, limits.MaxRetrievalChunks, "provider limits kept")
+}
+
+func TestTruncateContext_KeepsEnclosingFunction(t *testing.T) {
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	p := NewProvider(&types.ProviderConfig{MaxInputLines: 20})
+	ts := &types.TreesitterContext{EnclosingStart: 30, EnclosingEnd: 48}
+
+	window, cursorRow, _, offset := p.truncateContext(lines, 46, 0, ts)
+
+	assert.Equal(t, 29, offset, "window starts at the function")
+	assert.Equal(t, "line 30", window[0], "first line")
+	assert.Equal(t, "line 49", window[len(window)-1], "function end included")
+	assert.Equal(t, 17, cursorRow, "cursor row in window")
+
+	_, _, _, offset = p.truncateContext(lines, 46, 0, nil)
+	assert.Equal(t, 35, offset, "symmetric window without scopes")
+}
+
+func TestSnapToScopes_LeavesOutCutFunctions(t *testing.T) {
+	ts := &types.TreesitterContext{Siblings: []*types.TreesitterSymbol{
+		{Name: "before", Line: 5, EndLine: 15},
+		{Name: "after", Line: 25, EndLine: 40},
+	}}
+
+	start, end := snapToScopes(9, 29, 19, 20, 100, ts)
+
+	assert.Equal(t, 15, start, "starts after the cut function")
+	assert.Equal(t, 24, end, "ends before the cut function")
+}
+
+func TestSnapToScopes_KeepsCursorFunction(t *testing.T) {
+	ts := &types.TreesitterContext{Siblings: []*types.TreesitterSymbol{
+		{Name: "current", Line: 5, EndLine: 40},
+	}}
+
+	start, end := snapToScopes(9, 29, 19, 20, 100, ts)
+
+	assert.Equal(t, 9, start, "start kept")
+	assert.Equal(t, 29, end, "end kept")
+}
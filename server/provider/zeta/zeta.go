@@ -61,7 +61,7 @@ func NewProvider(config *types.ProviderConfig) *provider.Provider {
 	return &provider.Provider{
 		Name:          "zeta",
 		Config:        config,
-		Client:        openai.NewClient(config.ProviderURL, config.CompletionPath, config.APIKey),
+		Client:        provider.NewClient(config),
 		StreamingType: provider.StreamingLines,
 		Preprocessors: []provider.Preprocessor{
 			provider.TrimContent(),
@@ -97,13 +97,13 @@ func buildPrompt(p *provider.Provider, ctx *provider.Context) *openai.Completion
 	diagnosticsText := formatDiagnosticsForPrompt(req)
 	treesitterText := formatTreesitterForPrompt(req)
 	gitDiffText := formatGitDiffForPrompt(req)
-	prompt := buildInstructionPrompt(userEdits, diagnosticsText, treesitterText, gitDiffText, userExcerpt)
+	prompt := buildInstructionPrompt(userEdits, diagnosticsText, treesitterText, gitDiffText, req.Instruction, userExcerpt)
 
 	return &openai.CompletionRequest{
 		Model:       p.Config.ProviderModel,
 		Prompt:      prompt,
 		Temperature: p.Config.ProviderTemperature,
-		MaxTokens:   p.Config.ProviderMaxTokens,
+		MaxTokens:   p.Config.OutputTokens(),
 		TopK:        p.Config.ProviderTopK,
 		Stop:        []string{"\n<|editable_region_end|>"},
 		N:           1,
@@ -255,7 +255,7 @@ func formatGitDiffForPrompt(req *types.CompletionRequest) string {
 	return gd.Diff
 }
 
-func buildInstructionPrompt(userEdits, diagnostics, treesitterCtx, gitDiffCtx, userExcerpt string) string {
+func buildInstructionPrompt(userEdits, diagnostics, treesitterCtx, gitDiffCtx, userInstruction, userExcerpt string) string {
 	var promptBuilder strings.Builder
 
 	promptBuilder.WriteString("### Instruction:\n")
@@ -283,6 +283,12 @@ func buildInstructionPrompt(userEdits, diagnostics, treesitterCtx, gitDiffCtx, u
 		promptBuilder.WriteString("\n\n")
 	}
 
+	if userInstruction != "" {
+		promptBuilder.WriteString("### User Instruction:\n\n")
+		promptBuilder.WriteString(userInstruction)
+		promptBuilder.WriteString("\n\n")
+	}
+
 	promptBuilder.WriteString("### User Excerpt:\n\n")
 	promptBuilder.WriteString(userExcerpt)
 	promptBuilder.WriteString("\n\n")
@@ -308,11 +314,20 @@ func parseCompletion(p *provider.Provider, ctx *provider.Context) (*types.Comple
 
 	content = content[startIdx:]
 
+	// An empty editable region deletes it. The stop token swallows the end
+	// marker, leaving only the start marker.
+	truncated := ctx.Result.FinishReason == "length" || ctx.Result.StoppedEarly
 	newlineIdx := strings.Index(content, "\n")
 	if newlineIdx == -1 {
-		return p.EmptyResponse(), true
+		if truncated || strings.TrimSpace(content[len(startMarker):]) != "" {
+			return p.EmptyResponse(), true
+		}
+		return p.BuildWindowDeletion(ctx)
 	}
 	content = content[newlineIdx+1:]
+	if strings.HasPrefix(content, endMarker) {
+		return p.BuildWindowDeletion(ctx)
+	}
 
 	endIdx := strings.Index(content, "\n"+endMarker)
 	var newText string
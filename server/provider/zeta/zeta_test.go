@@ -100,7 +100,7 @@ func TestFormatDiagnosticsForPrompt_WithErrors(t *testing.T) {
 }
 
 func TestBuildInstructionPrompt(t *testing.T) {
-	result := buildInstructionPrompt("user edits", "diagnostics", "treesitter ctx", "git diff", "user excerpt")
+	result := buildInstructionPrompt("user edits", "diagnostics", "treesitter ctx", "git diff", "add logging", "user excerpt")
 
 	assert.True(t, strings.Contains(result, "### Instruction:"), "should have instruction")
 	assert.True(t, strings.Contains(result, "### User Edits:"), "should have edits section")
@@ -108,16 +108,18 @@ func TestBuildInstructionPrompt(t *testing.T) {
 	assert.True(t, strings.Contains(result, "### Diagnostics:"), "should have diagnostics section")
 	assert.True(t, strings.Contains(result, "### Code Context:"), "should have code context section")
 	assert.True(t, strings.Contains(result, "### Staged Changes:"), "should have staged changes section")
+	assert.True(t, strings.Contains(result, "### User Instruction:\n\nadd logging"), "should have user instruction section")
 	assert.True(t, strings.Contains(result, "### User Excerpt:"), "should have excerpt section")
 	assert.True(t, strings.Contains(result, "### Response:"), "should have response marker")
 }
 
 func TestBuildInstructionPrompt_NoDiagnostics(t *testing.T) {
-	result := buildInstructionPrompt("user edits", "", "", "", "user excerpt")
+	result := buildInstructionPrompt("user edits", "", "", "", "", "user excerpt")
 
 	assert.False(t, strings.Contains(result, "### Diagnostics:"), "should not have diagnostics section")
 	assert.False(t, strings.Contains(result, "### Code Context:"), "should not have code context section")
 	assert.False(t, strings.Contains(result, "### Staged Changes:"), "should not have staged changes section")
+	assert.False(t, strings.Contains(result, "### User Instruction:"), "should not have user instruction section")
 }
 
 func TestParseCompletion_WithEditableRegion(t *testing.T) {
@@ -267,3 +269,49 @@ func TestParseSimpleCompletion_MultiLine(t *testing.T) {
 	assert.Len(t, 1, resp.Completions, "completions count")
 	assert.Equal(t, 2, len(resp.Completions[0].Lines), "should have 2 lines")
 }
+
+func TestParseCompletion_EmptyRegionDeletesWindow(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *openai.StreamResult
+	}{
+		{"end marker swallowed by stop token", &openai.StreamResult{Text: "<|editable_region_start|>", FinishReason: "stop"}},
+		{"end marker present", &openai.StreamResult{Text: "<|editable_region_start|>\n<|editable_region_end|>", FinishReason: "stop"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProvider(&types.ProviderConfig{ProviderModel: "test-model"})
+			ctx := &provider.Context{
+				Request:     &types.CompletionRequest{Lines: []string{"keep", "drop 1", "drop 2"}},
+				Result:      tt.result,
+				WindowStart: 1,
+				WindowEnd:   3,
+			}
+
+			resp, ok := parseCompletion(p, ctx)
+
+			assert.True(t, ok, "should succeed")
+			assert.Len(t, 1, resp.Completions, "completions")
+			c := resp.Completions[0]
+			assert.Equal(t, 2, c.StartLine, "start line")
+			assert.Equal(t, 3, c.EndLineInc, "end line")
+			assert.Len(t, 0, c.Lines, "no replacement lines")
+		})
+	}
+}
+
+func TestParseCompletion_TruncatedEmptyRegionRejected(t *testing.T) {
+	p := NewProvider(&types.ProviderConfig{ProviderModel: "test-model"})
+	ctx := &provider.Context{
+		Request:     &types.CompletionRequest{Lines: []string{"line 1"}},
+		Result:      &openai.StreamResult{Text: "<|editable_region_start|>", FinishReason: "length"},
+		WindowStart: 0,
+		WindowEnd:   1,
+	}
+
+	resp, ok := parseCompletion(p, ctx)
+
+	assert.True(t, ok, "should succeed")
+	assert.Len(t, 0, resp.Completions, "no completion for truncated reply")
+}
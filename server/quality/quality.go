@@ -0,0 +1,382 @@
+// Package quality keeps an opt-in local log of completion requests and their
+// outcomes, for reviewing which context configurations lead to accepted
+// suggestions. Prompts and file contents are never stored: a request is
+// identified by a hash of its context.
+//
+// Records are kept as JSON lines rather than in SQLite: they are only ever
+// appended and reports aggregate them in a full scan, which a size-capped
+// file serves as well without cgo or a database dependency.
+package quality
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cursortab/logger"
+	"cursortab/types"
+)
+
+// Outcomes of a logged request
+const (
+	OutcomeAccepted  = "accepted"  // The suggestion was accepted
+	OutcomeRejected  = "rejected"  // The suggestion was rejected
+	OutcomeIgnored   = "ignored"   // The suggestion was dismissed without action
+	OutcomeEmpty     = "empty"     // The provider had nothing to suggest
+	OutcomeCancelled = "cancelled" // A newer request replaced it before a response arrived
+	OutcomeError     = "error"     // The provider request failed
+)
+
+// Context describes which context sources a request carried.
+type Context struct {
+	Lines           int  `json:"lines"`
+	DiffEntries     int  `json:"diff_entries"`
+	RecentSnapshots int  `json:"recent_snapshots"`
+	UserActions     int  `json:"user_actions"`
+	Diagnostics     bool `json:"diagnostics"`
+	Treesitter      bool `json:"treesitter"`
+	GitDiff         bool `json:"git_diff"`
+	GitHistory      bool `json:"git_history"`
+	LSPSymbols      int  `json:"lsp_symbols"`
+	RetrievalChunks int  `json:"retrieval_chunks"`
+}
+
+// Record is one logged request.
+type Record struct {
+	Time        time.Time `json:"time"`
+	Provider    string    `json:"provider"`
+	FileType    string    `json:"file_type"`   // File extension, without the path
+	PromptHash  string    `json:"prompt_hash"` // Hash of the request context
+	Context     Context   `json:"context"`
+	LatencyMs   int64     `json:"latency_ms"`   // Until the provider response was complete
+	ResultLines int       `json:"result_lines"` // Lines proposed by the response
+	Outcome     string    `json:"outcome"`
+}
+
+// NewRecord starts a record for req, sent at now.
+func NewRecord(req *types.CompletionRequest, provider string, now time.Time) *Record {
+	return &Record{
+		Time:       now,
+		Provider:   provider,
+		FileType:   strings.TrimPrefix(filepath.Ext(req.FilePath), "."),
+		PromptHash: HashRequest(req),
+		Context:    contextOf(req),
+	}
+}
+
+func contextOf(req *types.CompletionRequest) Context {
+	c := Context{
+		Lines:           len(req.Lines),
+		RecentSnapshots: len(req.RecentBufferSnapshots),
+		UserActions:     len(req.UserActions),
+		RetrievalChunks: len(req.RetrievalChunks),
+	}
+	for _, fh := range req.FileDiffHistories {
+		c.DiffEntries += len(fh.DiffHistory)
+	}
+	if diags := req.GetDiagnostics(); diags != nil && len(diags.Errors) > 0 {
+		c.Diagnostics = true
+	}
+	c.Treesitter = req.GetTreesitter() != nil
+	c.GitDiff = req.GetGitDiff() != nil
+	c.GitHistory = req.GetGitHistory() != nil
+	if l := req.GetLSP(); l != nil {
+		c.LSPSymbols = len(l.Symbols)
+	}
+	return c
+}
+
+// HashRequest returns a hash identifying the context sent for req: the file,
+// the cursor position, its lines and its edit history.
+func HashRequest(req *types.CompletionRequest) string {
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	write(req.FilePath)
+	write(strings.Join(req.Lines, "\n"))
+	for _, fh := range req.FileDiffHistories {
+		write(fh.FileName)
+		for _, d := range fh.DiffHistory {
+			write(d.Original)
+			write(d.Updated)
+		}
+	}
+	h.Write([]byte{byte(req.CursorRow >> 8), byte(req.CursorRow), byte(req.CursorCol >> 8), byte(req.CursorCol)})
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// Signature names the context sources present, e.g. "diff_history+diagnostics".
+func (c Context) Signature() string {
+	var parts []string
+	if c.DiffEntries > 0 {
+		parts = append(parts, "diff_history")
+	}
+	if c.RecentSnapshots > 0 {
+		parts = append(parts, "recent_files")
+	}
+	if c.UserActions > 0 {
+		parts = append(parts, "user_actions")
+	}
+	if c.Diagnostics {
+		parts = append(parts, "diagnostics")
+	}
+	if c.Treesitter {
+		parts = append(parts, "treesitter")
+	}
+	if c.GitDiff {
+		parts = append(parts, "git_diff")
+	}
+	if c.GitHistory {
+		parts = append(parts, "git_history")
+	}
+	if c.LSPSymbols > 0 {
+		parts = append(parts, "lsp")
+	}
+	if c.RetrievalChunks > 0 {
+		parts = append(parts, "retrieval")
+	}
+	if len(parts) == 0 {
+		return "buffer_only"
+	}
+	return strings.Join(parts, "+")
+}
+
+const (
+	maxLogBytes   = 8 << 20 // Size of the log before it is rotated
+	appendQueue   = 64      // Records waiting to be written before new ones are dropped
+	rotatedSuffix = ".1"    // Suffix of the previous log, the only rotated one kept
+)
+
+// Log appends records to a JSON-lines file from a background writer. Once
+// the file exceeds maxLogBytes it replaces the previous rotated log, so at
+// most twice that is kept.
+type Log struct {
+	mu   sync.Mutex // Held while writing or rotating, not while scanning
+	path string
+	size int64 // Bytes in the file at path, -1 before the first write
+
+	records chan *Record
+	pending sync.WaitGroup // Records queued but not written yet
+}
+
+// NewLog creates a log backed by the file at path and starts its writer.
+func NewLog(path string) *Log {
+	l := &Log{path: path, size: -1, records: make(chan *Record, appendQueue)}
+	go l.writer()
+	return l
+}
+
+// Append queues rec to be written at the end of the log. Records are
+// dropped while the queue is full.
+func (l *Log) Append(rec *Record) {
+	l.pending.Add(1)
+	select {
+	case l.records <- rec:
+	default:
+		l.pending.Done()
+		logger.Warn("quality log: queue full, dropping record")
+	}
+}
+
+func (l *Log) writer() {
+	for rec := range l.records {
+		if err := l.write(rec); err != nil {
+			logger.Warn("quality log: %v", err)
+		}
+		l.pending.Done()
+	}
+}
+
+func (l *Log) write(rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	if l.size < 0 {
+		l.size = 0
+		if info, err := os.Stat(l.path); err == nil {
+			l.size = info.Size()
+		}
+	}
+	if l.size > 0 && l.size+int64(len(data)) > maxLogBytes {
+		if err := os.Rename(l.path, l.path+rotatedSuffix); err != nil {
+			return err
+		}
+		l.size = 0
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := f.Write(data)
+	l.size += int64(n)
+	return err
+}
+
+// Query selects records for a Report. Zero values match everything.
+type Query struct {
+	Since    time.Time `json:"since"`
+	Provider string    `json:"provider"`
+	Limit    int       `json:"limit"` // Most recent records included in the report (0 = none)
+}
+
+// Group aggregates the records sharing a provider and context signature.
+type Group struct {
+	Provider     string  `json:"provider"`
+	Context      string  `json:"context"`
+	Requests     int     `json:"requests"`
+	Accepted     int     `json:"accepted"`
+	Rejected     int     `json:"rejected"`
+	Ignored      int     `json:"ignored"`
+	Empty        int     `json:"empty"`
+	Cancelled    int     `json:"cancelled"`
+	Errors       int     `json:"errors"`
+	AcceptRate   float64 `json:"accept_rate"` // Accepted over suggestions shown
+	AvgLatencyMs int64   `json:"avg_latency_ms"`
+}
+
+// Report summarizes the records matching a Query.
+type Report struct {
+	Total   int      `json:"total"`
+	Groups  []Group  `json:"groups"` // Most requests first
+	Records []Record `json:"records"`
+}
+
+// Query reads the log, the rotated one first, and summarizes the matching
+// records. The records appended before are included. A missing log yields
+// an empty report, and unreadable lines are skipped.
+func (l *Log) Query(q Query) (*Report, error) {
+	l.pending.Wait()
+	files, err := l.open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	var matched []Record
+	for _, f := range files {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec Record
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				logger.Debug("quality log: skipping bad record: %v", err)
+				continue
+			}
+			if rec.Time.Before(q.Since) || (q.Provider != "" && rec.Provider != q.Provider) {
+				continue
+			}
+			matched = append(matched, rec)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &Report{Total: len(matched), Groups: summarize(matched), Records: []Record{}}
+	if q.Limit > 0 {
+		report.Records = matched[max(len(matched)-q.Limit, 0):]
+	}
+	return report, nil
+}
+
+// open opens the rotated log and the log that exist, oldest first. The lock
+// is only held while opening, so a rotation cannot move a file in between
+// and writes go on while the files are scanned.
+func (l *Log) open() ([]*os.File, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var files []*os.File
+	for _, path := range []string{l.path + rotatedSuffix, l.path} {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func summarize(records []Record) []Group {
+	type groupKey struct{ provider, context string }
+	groups := make(map[groupKey]*Group)
+	latency := make(map[groupKey]int64)
+	responded := make(map[groupKey]int64)
+
+	for _, rec := range records {
+		key := groupKey{rec.Provider, rec.Context.Signature()}
+		g, ok := groups[key]
+		if !ok {
+			g = &Group{Provider: key.provider, Context: key.context}
+			groups[key] = g
+		}
+		g.Requests++
+		switch rec.Outcome {
+		case OutcomeAccepted:
+			g.Accepted++
+		case OutcomeRejected:
+			g.Rejected++
+		case OutcomeIgnored:
+			g.Ignored++
+		case OutcomeEmpty:
+			g.Empty++
+		case OutcomeCancelled:
+			g.Cancelled++
+		case OutcomeError:
+			g.Errors++
+		}
+		if rec.Outcome != OutcomeCancelled && rec.Outcome != OutcomeError {
+			latency[key] += rec.LatencyMs
+			responded[key]++
+		}
+	}
+
+	result := make([]Group, 0, len(groups))
+	for key, g := range groups {
+		if shown := g.Accepted + g.Rejected + g.Ignored; shown > 0 {
+			g.AcceptRate = float64(g.Accepted) / float64(shown)
+		}
+		if responded[key] > 0 {
+			g.AvgLatencyMs = latency[key] / responded[key]
+		}
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Requests != result[j].Requests {
+			return result[i].Requests > result[j].Requests
+		}
+		return result[i].Provider+result[i].Context < result[j].Provider+result[j].Context
+	})
+	return result
+}
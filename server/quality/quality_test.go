@@ -0,0 +1,127 @@
+package quality
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+	"cursortab/types"
+)
+
+func record(provider string, ctx Context, outcome string, latency int64, at time.Time) *Record {
+	return &Record{Time: at, Provider: provider, Context: ctx, Outcome: outcome, LatencyMs: latency}
+}
+
+func TestLog_AppendAndQuery(t *testing.T) {
+	log := NewLog(filepath.Join(t.TempDir(), "state", "quality.jsonl"))
+	now := time.Now()
+	withDiffs := Context{DiffEntries: 2}
+
+	log.Append(record("zeta", withDiffs, OutcomeAccepted, 100, now))
+	log.Append(record("zeta", withDiffs, OutcomeRejected, 300, now))
+	log.Append(record("zeta", withDiffs, OutcomeCancelled, 0, now))
+	log.Append(record("zeta", Context{}, OutcomeEmpty, 50, now))
+
+	report, err := log.Query(Query{Limit: 2})
+
+	assert.NoError(t, err, "query")
+	assert.Equal(t, 4, report.Total, "total")
+	assert.Len(t, 2, report.Groups, "groups")
+	assert.Len(t, 2, report.Records, "limited records")
+	assert.Equal(t, OutcomeEmpty, report.Records[1].Outcome, "most recent record last")
+
+	g := report.Groups[0]
+	assert.Equal(t, "diff_history", g.Context, "largest group first")
+	assert.Equal(t, 3, g.Requests, "requests")
+	assert.Equal(t, 1, g.Accepted, "accepted")
+	assert.Equal(t, 1, g.Cancelled, "cancelled")
+	assert.Equal(t, 0.5, g.AcceptRate, "accept rate over shown")
+	assert.Equal(t, int64(200), g.AvgLatencyMs, "latency excludes cancelled")
+
+	assert.Equal(t, "buffer_only", report.Groups[1].Context, "buffer only group")
+}
+
+func TestLog_QueryFilters(t *testing.T) {
+	log := NewLog(filepath.Join(t.TempDir(), "quality.jsonl"))
+	now := time.Now()
+
+	log.Append(record("zeta", Context{}, OutcomeAccepted, 0, now.Add(-48*time.Hour)))
+	log.Append(record("zeta", Context{}, OutcomeAccepted, 0, now))
+	log.Append(record("sweep", Context{}, OutcomeAccepted, 0, now))
+
+	report, err := log.Query(Query{Since: now.Add(-time.Hour), Provider: "zeta"})
+
+	assert.NoError(t, err, "query")
+	assert.Equal(t, 1, report.Total, "total")
+	assert.Len(t, 0, report.Records, "no records without limit")
+}
+
+func TestLog_QueryMissingFile(t *testing.T) {
+	log := NewLog(filepath.Join(t.TempDir(), "none.jsonl"))
+
+	report, err := log.Query(Query{})
+
+	assert.NoError(t, err, "query")
+	assert.Equal(t, 0, report.Total, "total")
+	assert.Len(t, 0, report.Groups, "groups")
+}
+
+func TestLog_SkipsBadLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quality.jsonl")
+	os.WriteFile(path, []byte("not json\n"), 0600)
+	log := NewLog(path)
+	log.Append(record("zeta", Context{}, OutcomeIgnored, 0, time.Now()))
+
+	report, err := log.Query(Query{})
+
+	assert.NoError(t, err, "query")
+	assert.Equal(t, 1, report.Total, "total")
+}
+
+func TestLog_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quality.jsonl")
+	line, err := json.Marshal(record("zeta", Context{}, OutcomeRejected, 0, time.Now()))
+	assert.NoError(t, err, "marshal")
+	full := bytes.Repeat(append(line, '\n'), maxLogBytes/(len(line)+1))
+	assert.NoError(t, os.WriteFile(path, full, 0600), "fill log")
+	log := NewLog(path)
+
+	log.Append(record("zeta", Context{}, OutcomeAccepted, 0, time.Now()))
+	report, err := log.Query(Query{Limit: 1})
+
+	assert.NoError(t, err, "query")
+	assert.Equal(t, maxLogBytes/(len(line)+1)+1, report.Total, "rotated records included")
+	assert.Equal(t, OutcomeAccepted, report.Records[0].Outcome, "most recent record last")
+	rotated, err := os.ReadFile(path + rotatedSuffix)
+	assert.NoError(t, err, "rotated log kept")
+	assert.Equal(t, len(full), len(rotated), "rotated log")
+	current, err := os.ReadFile(path)
+	assert.NoError(t, err, "new log")
+	assert.Equal(t, 1, bytes.Count(current, []byte("\n")), "new log holds the record only")
+}
+
+func TestNewRecord(t *testing.T) {
+	req := &types.CompletionRequest{
+		FilePath:  "pkg/main.go",
+		Lines:     []string{"package main", "func main() {}"},
+		CursorRow: 2,
+		FileDiffHistories: []*types.FileDiffHistory{
+			{FileName: "main.go", DiffHistory: []*types.DiffEntry{{Original: "a", Updated: "b"}}},
+		},
+	}
+
+	rec := NewRecord(req, "zeta", time.Now())
+
+	assert.Equal(t, "go", rec.FileType, "file type")
+	assert.Equal(t, 2, rec.Context.Lines, "lines")
+	assert.Equal(t, 1, rec.Context.DiffEntries, "diff entries")
+	assert.Equal(t, "diff_history", rec.Context.Signature(), "signature")
+	assert.Equal(t, 32, len(rec.PromptHash), "hash length")
+
+	req.CursorRow = 1
+	assert.NotEqual(t, rec.PromptHash, HashRequest(req), "hash depends on cursor")
+}
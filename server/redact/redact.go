@@ -0,0 +1,234 @@
+// Package redact replaces credentials in request content with placeholders
+// before it is sent to a provider, and puts them back into the completions
+// that come back so accepting a suggestion never writes a placeholder.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cursortab/logger"
+)
+
+// DefaultPatterns match common credentials. When a pattern has a capture
+// group, only the first group is redacted.
+var DefaultPatterns = []string{
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	`\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+	`\bgithub_pat_[A-Za-z0-9_]{22,}\b`,
+	`\bglpat-[A-Za-z0-9_-]{20,}\b`,
+	`\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}\b`,
+	`\b[rs]k_(?:live|test)_[A-Za-z0-9]{16,}\b`,
+	`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`,
+	`\bAIza[0-9A-Za-z_-]{35}\b`,
+	`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\b`,
+	`[a-z][a-z0-9+.-]*://[^/\s:@]+:([^/\s@]+)@`,
+	`(?i)(?:api[_-]?key|secret|token|passw(?:or)?d|credentials?)[A-Za-z0-9_-]*["']?\s*[:=]\s*["']([^"'\s]{8,})["']`,
+}
+
+const placeholderPrefix = "REDACTED_SECRET_"
+
+// Redactor finds secrets in text. A nil Redactor redacts nothing.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// New compiles DefaultPatterns followed by extra. Extra patterns that fail
+// to compile are logged and skipped.
+func New(extra []string) *Redactor {
+	r := &Redactor{}
+	for _, p := range DefaultPatterns {
+		r.patterns = append(r.patterns, regexp.MustCompile(p))
+	}
+	for _, p := range extra {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			logger.Warn("redact: skipping invalid pattern %q: %v", p, err)
+			continue
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r
+}
+
+// Text returns s with every secret replaced by a placeholder recorded in
+// secrets. Secrets spanning several lines get one placeholder per line, so
+// the line count of s is preserved.
+func (r *Redactor) Text(s string, secrets *Secrets) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, re := range r.patterns {
+		s = replaceMatches(re, s, secrets)
+	}
+	return s
+}
+
+// Lines redacts lines as one text so secrets spanning lines are found.
+// The input is returned unchanged when nothing was redacted.
+func (r *Redactor) Lines(lines []string, secrets *Secrets) []string {
+	if r == nil || len(lines) == 0 {
+		return lines
+	}
+	joined := strings.Join(lines, "\n")
+	redacted := r.Text(joined, secrets)
+	if redacted == joined {
+		return lines
+	}
+	return strings.Split(redacted, "\n")
+}
+
+func replaceMatches(re *regexp.Regexp, s string, secrets *Secrets) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		// Skip empty groups and values already redacted by an earlier pattern
+		if start == end || strings.Contains(s[start:end], placeholderPrefix) {
+			continue
+		}
+		b.WriteString(s[last:start])
+		for i, segment := range strings.Split(s[start:end], "\n") {
+			if i > 0 {
+				b.WriteByte('\n')
+			}
+			if segment != "" {
+				b.WriteString(secrets.placeholder(segment))
+			}
+		}
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// Secrets maps the placeholders of one request to the values they replaced.
+// The zero value is ready to use; a nil *Secrets hides and reveals nothing.
+type Secrets struct {
+	values       map[string]string // Placeholder -> secret
+	placeholders map[string]string // Secret -> placeholder
+	count        int               // Redacted occurrences, including repeats
+}
+
+func (s *Secrets) placeholder(value string) string {
+	s.count++
+	if p, ok := s.placeholders[value]; ok {
+		return p
+	}
+	if s.values == nil {
+		s.values = make(map[string]string)
+		s.placeholders = make(map[string]string)
+	}
+	p := fmt.Sprintf("%s%d", placeholderPrefix, len(s.values)+1)
+	s.values[p] = value
+	s.placeholders[value] = p
+	return p
+}
+
+// Count returns the number of redacted occurrences.
+func (s *Secrets) Count() int {
+	if s == nil {
+		return 0
+	}
+	return s.count
+}
+
+// Reveal replaces the placeholders in text with the secrets they stand for.
+func (s *Secrets) Reveal(text string) string {
+	if s == nil || len(s.values) == 0 || !strings.Contains(text, placeholderPrefix) {
+		return text
+	}
+	return replacer(s.values).Replace(text)
+}
+
+// RevealLines returns lines with the placeholders revealed. lines itself is
+// returned when there is nothing to reveal.
+func (s *Secrets) RevealLines(lines []string) []string {
+	if s == nil || len(s.values) == 0 {
+		return lines
+	}
+	revealed := make([]string, len(lines))
+	for i, line := range lines {
+		revealed[i] = s.Reveal(line)
+	}
+	return revealed
+}
+
+// Column returns the byte column of redacted, the line original with its
+// secrets replaced, that col of original maps to. A column inside a secret
+// maps to the end of its placeholder, so text cut at it never splits one.
+func (s *Secrets) Column(original, redacted string, col int) int {
+	if s == nil || len(s.values) == 0 || original == redacted {
+		return col
+	}
+	i, j := 0, 0
+	for i < len(redacted) && j < len(original) && j < col {
+		if p, value := s.placeholderAt(redacted[i:]); p != "" && strings.HasPrefix(original[j:], value) {
+			i += len(p)
+			j += len(value)
+			continue
+		}
+		i++
+		j++
+	}
+	return i + max(col-j, 0)
+}
+
+// placeholderAt returns the placeholder text starts with and the secret it
+// stands for, or empty strings if it starts with none.
+func (s *Secrets) placeholderAt(text string) (placeholder, value string) {
+	if !strings.HasPrefix(text, placeholderPrefix) {
+		return "", ""
+	}
+	digits := len(placeholderPrefix)
+	for digits < len(text) && text[digits] >= '0' && text[digits] <= '9' {
+		digits++
+	}
+	// The longest number first, so REDACTED_SECRET_12 is not read as _1
+	for end := digits; end > len(placeholderPrefix); end-- {
+		if value, ok := s.values[text[:end]]; ok {
+			return text[:end], value
+		}
+	}
+	return "", ""
+}
+
+// Hide replaces the secrets recorded so far with their placeholders, so
+// revealed text can be handed back to code that saw the redacted request.
+func (s *Secrets) Hide(text string) string {
+	if s == nil || len(s.placeholders) == 0 {
+		return text
+	}
+	return replacer(s.placeholders).Replace(text)
+}
+
+// replacer replaces the keys of m, longest first so a key never shadows a
+// longer one it is a prefix of.
+func replacer(m map[string]string) *strings.Replacer {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	pairs := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k, m[k])
+	}
+	return strings.NewReplacer(pairs...)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"cursortab/logger"
+	"cursortab/watcher"
+
+	"github.com/BurntSushi/toml"
+)
+
+// projectConfigName is the per-project override file looked up in the workspace root.
+const projectConfigName = ".cursortab.toml"
+
+// CursorPredictionOverrides holds optional cursor prediction overrides
+type CursorPredictionOverrides struct {
+	Enabled            *bool `toml:"enabled"`
+	AutoAdvance        *bool `toml:"auto_advance"`
+	ProximityThreshold *int  `toml:"proximity_threshold"`
+	CursorOnly         *bool `toml:"cursor_only"`
+	PrefetchDepth      *int  `toml:"prefetch_depth"`
+}
+
+// BehaviorOverrides holds optional behavior overrides
+type BehaviorOverrides struct {
+	IdleCompletionDelay *int                      `toml:"idle_completion_delay"`
+	TextChangeDebounce  *int                      `toml:"text_change_debounce"`
+	ScanDelay           *int                      `toml:"scan_delay"`
+	TriggerPolicy       *string                   `toml:"trigger_policy"`
+	MaxVisibleLines     *int                      `toml:"max_visible_lines"`
+	MaxCompletionLines  *int                      `toml:"max_completion_lines"`
+	OversizedCompletion *string                   `toml:"oversized_completion"`
+	PasteCompletion     *string                   `toml:"paste_completion"`
+	PasteDelay          *int                      `toml:"paste_delay"`
+	DisplayTTL          *int                      `toml:"display_ttl"`
+	CacheTTL            *int                      `toml:"cache_ttl"`
+	CacheMaxEntries     *int                      `toml:"cache_max_entries"`
+	CompleteInInsert    *bool                     `toml:"complete_in_insert"`
+	CompleteInNormal    *bool                     `toml:"complete_in_normal"`
+	CursorPrediction    CursorPredictionOverrides `toml:"cursor_prediction"`
+}
+
+// ProjectConfig is the schema of a project's .cursortab.toml.
+// Unset fields keep the value from the editor config.
+type ProjectConfig struct {
+	Enabled  *bool             `toml:"enabled"`
+	Behavior BehaviorOverrides `toml:"behavior"`
+}
+
+// Apply overlays the project overrides onto config.
+func (p *ProjectConfig) Apply(config *Config) {
+	b := &config.Behavior
+	setIfPresent(&b.IdleCompletionDelay, p.Behavior.IdleCompletionDelay)
+	setIfPresent(&b.TextChangeDebounce, p.Behavior.TextChangeDebounce)
+	setIfPresent(&b.ScanDelay, p.Behavior.ScanDelay)
+	setIfPresent(&b.TriggerPolicy, p.Behavior.TriggerPolicy)
+	setIfPresent(&b.MaxVisibleLines, p.Behavior.MaxVisibleLines)
+	setIfPresent(&b.MaxCompletionLines, p.Behavior.MaxCompletionLines)
+	setIfPresent(&b.OversizedCompletion, p.Behavior.OversizedCompletion)
+	setIfPresent(&b.PasteCompletion, p.Behavior.PasteCompletion)
+	setIfPresent(&b.PasteDelay, p.Behavior.PasteDelay)
+	setIfPresent(&b.DisplayTTL, p.Behavior.DisplayTTL)
+	setIfPresent(&b.CacheTTL, p.Behavior.CacheTTL)
+	setIfPresent(&b.CacheMaxEntries, p.Behavior.CacheMaxEntries)
+	setIfPresent(&b.CompleteInInsert, p.Behavior.CompleteInInsert)
+	setIfPresent(&b.CompleteInNormal, p.Behavior.CompleteInNormal)
+	setIfPresent(&b.CursorPrediction.Enabled, p.Behavior.CursorPrediction.Enabled)
+	setIfPresent(&b.CursorPrediction.AutoAdvance, p.Behavior.CursorPrediction.AutoAdvance)
+	setIfPresent(&b.CursorPrediction.ProximityThreshold, p.Behavior.CursorPrediction.ProximityThreshold)
+	setIfPresent(&b.CursorPrediction.CursorOnly, p.Behavior.CursorPrediction.CursorOnly)
+	setIfPresent(&b.CursorPrediction.PrefetchDepth, p.Behavior.CursorPrediction.PrefetchDepth)
+}
+
+func setIfPresent[T any](dst *T, src *T) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+// loadProjectConfig reads a project override file. A missing file yields an empty config.
+func loadProjectConfig(path string) (*ProjectConfig, error) {
+	var project ProjectConfig
+	if _, err := toml.DecodeFile(path, &project); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &ProjectConfig{}, nil
+		}
+		return nil, err
+	}
+	return &project, nil
+}
+
+// readConfigFile reads the config JSON written by the Lua client.
+func readConfigFile(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, err
+	}
+	return config, config.Validate()
+}
+
+// startWatcher watches the config file, the project override file and the
+// kill-switch sentinel, and applies their current state once at startup.
+func (d *Daemon) startWatcher() {
+	w, err := watcher.New(watcher.DefaultDebounce, func(path string) {
+		logger.Info("watcher: %s changed, reloading", path)
+		d.reload()
+	})
+	if err != nil {
+		logger.Warn("watcher: disabled: %v", err)
+		d.reload()
+		return
+	}
+
+	for _, path := range d.watchedPaths() {
+		if err := w.Add(path); err != nil {
+			logger.Warn("watcher: cannot watch %s: %v", path, err)
+		}
+	}
+
+	d.watcher = w
+	go w.Run(d.ctx)
+	d.reload()
+}
+
+func (d *Daemon) stopWatcher() {
+	if d.watcher != nil {
+		d.watcher.Close()
+	}
+}
+
+func (d *Daemon) watchedPaths() []string {
+	return []string{
+		getConfigPath(d.config.StateDir),
+		getKillSwitchPath(d.config.StateDir),
+		filepath.Join(d.engine.WorkspacePath, projectConfigName),
+	}
+}
+
+// reload recomputes the effective configuration from all watched sources and
+// hands it to the engine. Invalid files are logged and ignored.
+func (d *Daemon) reload() {
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+
+	config := d.config
+	if fileConfig, err := readConfigFile(getConfigPath(d.config.StateDir)); err == nil {
+		if !reflect.DeepEqual(fileConfig.Provider, d.config.Provider) {
+			logger.Warn("watcher: provider settings changed, restart the daemon to apply them")
+		}
+		fileConfig.Provider = d.config.Provider
+		config = fileConfig
+	} else if !errors.Is(err, os.ErrNotExist) {
+		logger.Warn("watcher: ignoring invalid config file: %v", err)
+	}
+
+	enabled := true
+	project, err := loadProjectConfig(filepath.Join(d.engine.WorkspacePath, projectConfigName))
+	if err != nil {
+		logger.Warn("watcher: ignoring invalid %s: %v", projectConfigName, err)
+	} else {
+		candidate := config
+		project.Apply(&candidate)
+		if err := candidate.Validate(); err != nil {
+			logger.Warn("watcher: ignoring invalid %s: %v", projectConfigName, err)
+		} else {
+			config = candidate
+		}
+		if project.Enabled != nil {
+			enabled = *project.Enabled
+		}
+	}
+
+	_, statErr := os.Stat(getKillSwitchPath(d.config.StateDir))
+	killSwitch := statErr == nil
+
+	d.engine.Reload(engineConfig(config))
+	d.engine.SetDisabled(killSwitch || !enabled)
+}
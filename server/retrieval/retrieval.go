@@ -0,0 +1,211 @@
+// Package retrieval ranks chunks of the files visited in a session by their
+// lexical overlap with the code around the cursor, using BM25 over
+// identifiers instead of embeddings.
+package retrieval
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	ChunkLines = 20 // Lines per indexed chunk
+	MaxFiles   = 32 // Files kept in the index, least recently updated dropped first
+
+	k1 = 1.2  // BM25 term frequency saturation
+	b  = 0.75 // BM25 length normalization
+)
+
+// Chunk is a range of lines of an indexed file.
+type Chunk struct {
+	Path      string
+	StartLine int // 1-indexed
+	Lines     []string
+}
+
+type indexedChunk struct {
+	Chunk
+	terms  map[string]int // Term frequencies
+	length int            // Number of terms
+}
+
+type indexedFile struct {
+	version int
+	chunks  []*indexedChunk
+}
+
+// Index holds the chunks of recently visited files. It is safe for concurrent use.
+type Index struct {
+	mu          sync.Mutex
+	files       map[string]*indexedFile
+	order       []string       // Paths, least recently updated first
+	docFreq     map[string]int // Chunks containing each term
+	chunkCount  int
+	totalLength int
+}
+
+// NewIndex creates an empty index.
+func NewIndex() *Index {
+	return &Index{
+		files:   make(map[string]*indexedFile),
+		docFreq: make(map[string]int),
+	}
+}
+
+// Update indexes the lines of the file at path, replacing what was indexed
+// for it unless version is unchanged.
+func (x *Index) Update(path string, version int, lines []string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if f, ok := x.files[path]; ok && f.version == version {
+		x.touch(path)
+		return
+	}
+	x.remove(path)
+
+	f := &indexedFile{version: version}
+	for start := 0; start < len(lines); start += ChunkLines {
+		end := min(start+ChunkLines, len(lines))
+		terms := make(map[string]int)
+		length := 0
+		for _, line := range lines[start:end] {
+			for _, term := range Terms(line) {
+				terms[term]++
+				length++
+			}
+		}
+		if length == 0 {
+			continue
+		}
+		for term := range terms {
+			x.docFreq[term]++
+		}
+		x.chunkCount++
+		x.totalLength += length
+		f.chunks = append(f.chunks, &indexedChunk{
+			Chunk:  Chunk{Path: path, StartLine: start + 1, Lines: slices.Clone(lines[start:end])},
+			terms:  terms,
+			length: length,
+		})
+	}
+	x.files[path] = f
+	x.order = append(x.order, path)
+
+	for len(x.order) > MaxFiles {
+		x.remove(x.order[0])
+	}
+}
+
+// Remove drops the file at path from the index.
+func (x *Index) Remove(path string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(path)
+}
+
+func (x *Index) remove(path string) {
+	f, ok := x.files[path]
+	if !ok {
+		return
+	}
+	for _, c := range f.chunks {
+		for term := range c.terms {
+			if x.docFreq[term]--; x.docFreq[term] == 0 {
+				delete(x.docFreq, term)
+			}
+		}
+		x.chunkCount--
+		x.totalLength -= c.length
+	}
+	delete(x.files, path)
+	x.order = slices.DeleteFunc(x.order, func(p string) bool { return p == path })
+}
+
+func (x *Index) touch(path string) {
+	x.order = slices.DeleteFunc(x.order, func(p string) bool { return p == path })
+	x.order = append(x.order, path)
+}
+
+// Search returns up to limit chunks of files other than exclude, best first,
+// ranked by their BM25 score against the terms of query. Chunks sharing no
+// term with the query are never returned.
+func (x *Index) Search(query []string, exclude string, limit int) []Chunk {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if limit <= 0 || x.chunkCount == 0 {
+		return nil
+	}
+
+	queryTerms := make(map[string]bool)
+	for _, line := range query {
+		for _, term := range Terms(line) {
+			queryTerms[term] = true
+		}
+	}
+
+	type scored struct {
+		chunk *indexedChunk
+		score float64
+	}
+	var results []scored
+	avgLength := float64(x.totalLength) / float64(x.chunkCount)
+	for path, f := range x.files {
+		if path == exclude {
+			continue
+		}
+		for _, c := range f.chunks {
+			score := 0.0
+			for term := range queryTerms {
+				tf := float64(c.terms[term])
+				if tf == 0 {
+					continue
+				}
+				df := float64(x.docFreq[term])
+				idf := math.Log(1 + (float64(x.chunkCount)-df+0.5)/(df+0.5))
+				score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(c.length)/avgLength))
+			}
+			if score > 0 {
+				results = append(results, scored{c, score})
+			}
+		}
+	}
+
+	slices.SortFunc(results, func(a, b scored) int {
+		if a.score != b.score {
+			if a.score > b.score {
+				return -1
+			}
+			return 1
+		}
+		if c := strings.Compare(a.chunk.Path, b.chunk.Path); c != 0 {
+			return c
+		}
+		return a.chunk.StartLine - b.chunk.StartLine
+	})
+
+	chunks := make([]Chunk, 0, min(limit, len(results)))
+	for _, r := range results[:min(limit, len(results))] {
+		chunks = append(chunks, r.chunk.Chunk)
+	}
+	return chunks
+}
+
+// Terms returns the lowercased identifiers of line, skipping those shorter
+// than two characters and numbers.
+func Terms(line string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(line, func(r rune) bool {
+		return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(word) < 2 || unicode.IsDigit([]rune(word)[0]) {
+			continue
+		}
+		terms = append(terms, strings.ToLower(word))
+	}
+	return terms
+}
@@ -0,0 +1,67 @@
+package retrieval
+
+import (
+	"fmt"
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestTerms(t *testing.T) {
+	assert.Equal(t, []string{"user", "getname", "user_id"}, Terms("user.GetName(user_id, 42, x)"), "terms")
+}
+
+func TestSearch_RanksSharedIdentifiers(t *testing.T) {
+	x := NewIndex()
+	x.Update("user.go", 1, []string{"type User struct {", "\tName string", "}", "func (u *User) Greeting() string {", "\treturn u.Name", "}"})
+	x.Update("math.go", 1, []string{"func Add(a, b int) int {", "\treturn a + b", "}"})
+	x.Update("main.go", 1, []string{"u := User{Name: name}"})
+
+	chunks := x.Search([]string{"fmt.Println(u.Greeting())"}, "main.go", 5)
+
+	assert.Len(t, 1, chunks, "only chunks sharing a term")
+	assert.Equal(t, "user.go", chunks[0].Path, "path")
+	assert.Equal(t, 1, chunks[0].StartLine, "start line")
+}
+
+func TestSearch_RareTermsWeighMore(t *testing.T) {
+	x := NewIndex()
+	x.Update("a.go", 1, []string{"return value"})
+	x.Update("b.go", 1, []string{"return parseHeader(value)"})
+	x.Update("c.go", 1, []string{"return value"})
+
+	chunks := x.Search([]string{"h := parseHeader(raw)", "return value"}, "", 2)
+
+	assert.Equal(t, "b.go", chunks[0].Path, "chunk with the rare term first")
+}
+
+func TestUpdate_ChunksAndReplaces(t *testing.T) {
+	x := NewIndex()
+	lines := make([]string, ChunkLines+5)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line%d", i)
+	}
+	lines[ChunkLines+2] = "needle"
+	x.Update("f.go", 1, lines)
+
+	chunks := x.Search([]string{"needle"}, "", 5)
+	assert.Len(t, 1, chunks, "chunks")
+	assert.Equal(t, ChunkLines+1, chunks[0].StartLine, "second chunk")
+	assert.Len(t, 5, chunks[0].Lines, "chunk lines")
+
+	x.Update("f.go", 2, []string{"haystack"})
+	assert.Len(t, 0, x.Search([]string{"needle"}, "", 5), "replaced on new version")
+}
+
+func TestUpdate_EvictsLeastRecentlyUpdated(t *testing.T) {
+	x := NewIndex()
+	x.Update("first.go", 1, []string{"needle"})
+	for i := range MaxFiles {
+		x.Update(fmt.Sprintf("f%d.go", i), 1, []string{"hay"})
+	}
+
+	assert.Len(t, 0, x.Search([]string{"needle"}, "", 5), "oldest file evicted")
+
+	x.Remove("f0.go")
+	assert.Len(t, MaxFiles-1, x.Search([]string{"hay"}, "", MaxFiles), "removed file")
+}
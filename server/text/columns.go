@@ -0,0 +1,82 @@
+package text
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// ColumnUnit selects how columns sent to the editor are counted. Columns are
+// computed in bytes and converted just before they leave the daemon.
+type ColumnUnit string
+
+const (
+	ColumnBytes ColumnUnit = "byte" // UTF-8 bytes, as Neovim extmarks expect
+	ColumnChars ColumnUnit = "char" // Unicode code points
+	ColumnCells ColumnUnit = "cell" // Display cells: wide characters take two, combining marks none
+)
+
+// ConvertColumn converts the 0-based byte column col of line to unit. A
+// column inside a multibyte character counts from that character's start,
+// and columns past the end of line extend it one unit per byte.
+func ConvertColumn(line string, col int, unit ColumnUnit) int {
+	if unit != ColumnChars && unit != ColumnCells || col <= 0 {
+		return col
+	}
+	converted := 0
+	pos := 0
+	for pos < len(line) {
+		r, size := utf8.DecodeRuneInString(line[pos:])
+		if pos+size > col {
+			return converted
+		}
+		if unit == ColumnCells {
+			converted += RuneWidth(r)
+		} else {
+			converted++
+		}
+		pos += size
+	}
+	return converted + col - pos
+}
+
+// RuneWidth returns the number of display cells r takes: 0 for combining
+// marks and zero-width characters, 2 for East Asian wide and fullwidth
+// characters and emoji, 1 otherwise. Tabs count as one cell.
+func RuneWidth(r rune) int {
+	switch {
+	case r == 0x200D || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case isWide(r):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// wideRanges are the East Asian wide and fullwidth blocks and the emoji
+// blocks Neovim renders in two cells.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F},   // Hangul Jamo
+	{0x2E80, 0x303E},   // CJK radicals, Kangxi, CJK symbols and punctuation
+	{0x3041, 0x33FF},   // Hiragana, Katakana, Bopomofo, CJK compatibility
+	{0x3400, 0x4DBF},   // CJK extension A
+	{0x4E00, 0x9FFF},   // CJK unified ideographs
+	{0xA000, 0xA4CF},   // Yi
+	{0xAC00, 0xD7A3},   // Hangul syllables
+	{0xF900, 0xFAFF},   // CJK compatibility ideographs
+	{0xFE30, 0xFE4F},   // CJK compatibility forms
+	{0xFF00, 0xFF60},   // Fullwidth forms
+	{0xFFE0, 0xFFE6},   // Fullwidth signs
+	{0x1F300, 0x1F64F}, // Pictographs and emoticons
+	{0x1F900, 0x1F9FF}, // Supplemental symbols and pictographs
+	{0x20000, 0x3FFFD}, // CJK extensions B and later
+}
+
+func isWide(r rune) bool {
+	for _, wr := range wideRanges {
+		if r >= wr[0] && r <= wr[1] {
+			return true
+		}
+	}
+	return false
+}
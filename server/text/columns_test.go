@@ -0,0 +1,36 @@
+package text
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestConvertColumn(t *testing.T) {
+	line := "é日x"
+	tests := []struct {
+		name string
+		col  int
+		unit ColumnUnit
+		want int
+	}{
+		{"bytes unchanged", 5, ColumnBytes, 5},
+		{"chars after two-byte rune", 2, ColumnChars, 1},
+		{"chars after wide rune", 5, ColumnChars, 2},
+		{"cells count wide rune twice", 5, ColumnCells, 3},
+		{"inside a rune counts from its start", 3, ColumnChars, 1},
+		{"past the end extends by bytes", 8, ColumnChars, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ConvertColumn(line, tt.col, tt.unit), "column")
+		})
+	}
+}
+
+func TestRuneWidth(t *testing.T) {
+	assert.Equal(t, 1, RuneWidth('a'), "ascii")
+	assert.Equal(t, 2, RuneWidth('日'), "CJK")
+	assert.Equal(t, 2, RuneWidth('😀'), "emoji")
+	assert.Equal(t, 0, RuneWidth('́'), "combining accent")
+}
@@ -12,6 +12,14 @@ const (
 	// Must be >= SimilarityThreshold.
 	ExpectedPositionSimilarityThreshold = 0.35
 
+	// MatchSlack is how many lines past the difference in line count a
+	// deleted line is compared with inserted lines when pairing modifications.
+	MatchSlack = 8
+
+	// MaxMatchCandidates caps the inserted lines each deleted line is compared
+	// with when pairing modifications, bounding the cost of large blocks.
+	MaxMatchCandidates = 64
+
 	// ComplexModWordCountThreshold is the maximum word count (per side) for a
 	// modification to be considered simple enough for character-level diffing.
 	ComplexModWordCountThreshold = 2
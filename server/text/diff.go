@@ -4,6 +4,7 @@ import (
 	"cursortab/logger"
 	"cursortab/utils"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
@@ -94,6 +95,29 @@ type LineChange struct {
 	OldContent string // For modifications to compare changes
 	ColStart   int    // Start column (0-based) for character-level changes
 	ColEnd     int    // End column (0-based) for character-level changes
+
+	// Disjoint edits of a modification making several changes to the line
+	// (nil for a single one), one span per edit in each version of the line
+	OldSpans []ColSpan // In OldContent
+	Spans    []ColSpan // In Content
+}
+
+// editSpans returns the column ranges of the disjoint word edits turning
+// oldLine into newLine, in oldLine and in newLine, or nil when there are
+// fewer than two.
+func editSpans(oldLine, newLine string) (oldSpans, newSpans []ColSpan) {
+	edits := WordEdits(oldLine, newLine)
+	if len(edits) < 2 {
+		return nil, nil
+	}
+	shift := 0
+	for _, e := range edits {
+		start := e.OldStart + shift
+		oldSpans = append(oldSpans, ColSpan{Start: e.OldStart, End: e.OldEnd})
+		newSpans = append(newSpans, ColSpan{Start: start, End: start + len(e.Text)})
+		shift += len(e.Text) - (e.OldEnd - e.OldStart)
+	}
+	return oldSpans, newSpans
 }
 
 // LineMapping tracks correspondence between new and old line coordinates.
@@ -184,7 +208,7 @@ func (r *DiffResult) addChange(oldLineNum, newLineNum int, oldContent, newConten
 		}
 	}
 
-	r.Changes[mapKey] = LineChange{
+	change := LineChange{
 		Type:       changeType,
 		OldLineNum: oldLineNum,
 		NewLineNum: newLineNum,
@@ -193,6 +217,10 @@ func (r *DiffResult) addChange(oldLineNum, newLineNum int, oldContent, newConten
 		ColStart:   colStart,
 		ColEnd:     colEnd,
 	}
+	if changeType == ChangeModification {
+		change.OldSpans, change.Spans = editSpans(oldContent, newContent)
+	}
+	r.Changes[mapKey] = change
 	return true
 }
 
@@ -238,6 +266,12 @@ func (r *DiffResult) addModification(oldLineNum, newLineNum int, oldContent, new
 
 // ComputeDiff computes and categorizes line-level changes between two texts
 func ComputeDiff(text1, text2 string) *DiffResult {
+	return ComputeDiffWithSimilarity(text1, text2, SimilarityThreshold)
+}
+
+// ComputeDiffWithSimilarity is ComputeDiff with a custom minimum similarity for
+// pairing deleted and inserted lines as modifications.
+func ComputeDiffWithSimilarity(text1, text2 string, similarity float64) *DiffResult {
 	defer logger.Trace("text.ComputeDiff")()
 	// Count lines in both texts
 	oldLines := splitLines(text1)
@@ -251,17 +285,50 @@ func ComputeDiff(text1, text2 string) *DiffResult {
 		NewLineCount: newLineCount,
 	}
 
+	// Only the lines between the common prefix and suffix are diffed, so an
+	// edit costs the size of the edit rather than of the buffer
+	prefix, suffix := commonEdges(text1, text2, oldLines, newLines)
+	var lineDiffs []diffmatchpatch.Diff
+	if prefix > 0 {
+		lineDiffs = append(lineDiffs, diffmatchpatch.Diff{Type: diffmatchpatch.DiffEqual, Text: text1[:prefix]})
+	}
 	dmp := diffmatchpatch.New()
-	chars1, chars2, lineArray := dmp.DiffLinesToChars(text1, text2)
+	chars1, chars2, lineArray := dmp.DiffLinesToChars(text1[prefix:len(text1)-suffix], text2[prefix:len(text2)-suffix])
 	diffs := dmp.DiffMain(chars1, chars2, false)
-	lineDiffs := dmp.DiffCharsToLines(diffs, lineArray)
+	lineDiffs = append(lineDiffs, dmp.DiffCharsToLines(diffs, lineArray)...)
+	if suffix > 0 {
+		lineDiffs = append(lineDiffs, diffmatchpatch.Diff{Type: diffmatchpatch.DiffEqual, Text: text1[len(text1)-suffix:]})
+	}
 
 	// Build line mapping and process diffs
-	result.LineMapping = processLineDiffsWithMapping(lineDiffs, result, oldLineCount, newLineCount)
+	result.LineMapping = processLineDiffsWithMapping(lineDiffs, result, oldLineCount, newLineCount, similarity)
 
 	return result
 }
 
+// commonEdges returns the length in bytes of the leading and trailing lines
+// text1 and text2 have in common. A line only counts when it is newline
+// terminated in both texts, or both texts end without one, so the lines left
+// in between diff exactly as they would within the whole texts.
+func commonEdges(text1, text2 string, oldLines, newLines []string) (prefix, suffix int) {
+	shorter := min(len(oldLines), len(newLines))
+	p := 0
+	for p < shorter-1 && oldLines[p] == newLines[p] {
+		prefix += len(oldLines[p]) + 1
+		p++
+	}
+	if strings.HasSuffix(text1, "\n") != strings.HasSuffix(text2, "\n") {
+		return prefix, 0
+	}
+	if !strings.HasSuffix(text1, "\n") {
+		suffix = -1
+	}
+	for s := 0; s < shorter-p && oldLines[len(oldLines)-1-s] == newLines[len(newLines)-1-s]; s++ {
+		suffix += len(oldLines[len(oldLines)-1-s]) + 1
+	}
+	return prefix, max(suffix, 0)
+}
+
 // LineSimilarity computes a similarity score between two lines (0.0 to 1.0)
 // using Levenshtein ratio: 1 - (levenshtein_distance / max_length)
 // Higher score means more similar. Empty lines have 0 similarity with non-empty lines.
@@ -287,30 +354,35 @@ func LineSimilarity(line1, line2 string) float64 {
 	return 1.0 - float64(levenshteinDist)/float64(maxLen)
 }
 
-// findBestMatch finds the best matching line in insertedLines for the given deletedLine
-// Returns the index of the best match and its similarity score
-func findBestMatch(deletedLine string, insertedLines []string, usedInserts map[int]bool) (int, float64) {
-	bestIdx := -1
-	bestSimilarity := 0.0
-
-	for i, insertedLine := range insertedLines {
-		if usedInserts[i] {
-			continue
-		}
+// similarityMemo caches LineSimilarity for the pairs of lines compared while
+// matching one block, where the same lines (closing braces, blank-ish lines)
+// come up again and again.
+type similarityMemo map[[2]string]float64
 
-		similarity := LineSimilarity(deletedLine, insertedLine)
-		if similarity > bestSimilarity {
-			bestSimilarity = similarity
-			bestIdx = i
-		}
+func (m similarityMemo) get(line1, line2 string) float64 {
+	key := [2]string{line1, line2}
+	if s, ok := m[key]; ok {
+		return s
 	}
+	s := LineSimilarity(line1, line2)
+	m[key] = s
+	return s
+}
 
-	return bestIdx, bestSimilarity
+// maxSimilarity is an upper bound of LineSimilarity: the edit distance, in
+// runes, is at least the difference in rune count.
+func maxSimilarity(line1, line2 string) float64 {
+	longer := max(len(line1), len(line2))
+	if longer == 0 {
+		return 1.0
+	}
+	runes := utils.Abs(utf8.RuneCountInString(line1) - utf8.RuneCountInString(line2))
+	return 1.0 - float64(runes)/float64(longer)
 }
 
 // processLineDiffsWithMapping processes line-level diffs and builds the coordinate mapping.
 // Returns the LineMapping that tracks correspondence between old and new line numbers.
-func processLineDiffsWithMapping(lineDiffs []diffmatchpatch.Diff, result *DiffResult, oldLineCount, newLineCount int) *LineMapping {
+func processLineDiffsWithMapping(lineDiffs []diffmatchpatch.Diff, result *DiffResult, oldLineCount, newLineCount int, similarity float64) *LineMapping {
 	// Initialize mapping arrays with -1 (unmapped)
 	newToOld := make([]int, newLineCount)
 	oldToNew := make([]int, oldLineCount)
@@ -352,7 +424,7 @@ func processLineDiffsWithMapping(lineDiffs []diffmatchpatch.Diff, result *DiffRe
 
 				// Build mapping for the modification region
 				handleModificationsWithMapping(lines, insertLines, oldLineNum, newLineNum,
-					oldLineCount, newLineCount, newToOld, oldToNew, result)
+					oldLineCount, newLineCount, newToOld, oldToNew, result, similarity)
 
 				oldLineNum += len(lines)
 				newLineNum += len(insertLines)
@@ -402,7 +474,7 @@ func handleModificationsWithMapping(deletedLines, insertedLines []string,
 	oldLineStart, newLineStart int,
 	oldLineCount, newLineCount int,
 	newToOld, oldToNew []int,
-	result *DiffResult) {
+	result *DiffResult, similarity float64) {
 
 	// If we have equal number of lines, treat each pair as a modification with 1:1 mapping
 	if len(deletedLines) == len(insertedLines) {
@@ -436,19 +508,11 @@ func handleModificationsWithMapping(deletedLines, insertedLines []string,
 	usedInserts := make(map[int]bool)
 	usedDeletes := make(map[int]bool)
 
-	// First pass: Match similar non-empty lines with similarity threshold
-	matches := make(map[int]int) // maps deleted index to inserted index
-
-	for i, deletedLine := range deletedLines {
-		if deletedLine == "" {
-			continue
-		}
-		bestIdx, bestSimilarity := findBestMatch(deletedLine, insertedLines, usedInserts)
-		if bestIdx != -1 && bestSimilarity >= SimilarityThreshold {
-			matches[i] = bestIdx
-			usedInserts[bestIdx] = true
-			usedDeletes[i] = true
-		}
+	// First pass: Match similar non-empty lines, keeping their order
+	matches := matchLines(deletedLines, insertedLines, similarity)
+	for delIdx, insIdx := range matches {
+		usedInserts[insIdx] = true
+		usedDeletes[delIdx] = true
 	}
 
 	// Second pass: Process matched pairs as modifications and update mapping
@@ -619,10 +683,19 @@ func isComplexModification(deletedText, insertedText string) bool {
 		return true
 	}
 
+	deletedBlank := strings.TrimSpace(deletedText) == ""
+	insertedBlank := strings.TrimSpace(insertedText) == ""
+
+	// Whitespace swaps (tabs vs spaces, non-breaking spaces) stay simple
+	if deletedBlank && insertedBlank {
+		return false
+	}
+
 	deletedLen := len(deletedText)
 	insertedLen := len(insertedText)
 
-	if deletedLen == 0 {
+	// Replacing only whitespace (e.g. stripped trailing spaces) is an insertion
+	if deletedBlank {
 		return insertedLen > MinLengthForEmptyDeletion
 	}
 
@@ -656,3 +729,66 @@ func FindFirstChangedLine(oldLines, newLines []string, baseLineOffset int) int {
 	// No differences found
 	return 0
 }
+
+// FirstChangedColumn returns the 0-indexed byte column of oldLine where
+// newLine starts to differ from it, at the start of the differing character.
+// Returns len(oldLine) when newLine only appends to it, and -1 when the lines
+// are equal.
+func FirstChangedColumn(oldLine, newLine string) int {
+	if oldLine == newLine {
+		return -1
+	}
+	col := 0
+	for col < len(oldLine) && col < len(newLine) && oldLine[col] == newLine[col] {
+		col++
+	}
+	for col > 0 && col < len(oldLine) && !utf8.RuneStart(oldLine[col]) {
+		col--
+	}
+	return col
+}
+
+// DiffStats summarizes the size of a diff in lines and bytes.
+type DiffStats struct {
+	AddedLines   int
+	DeletedLines int
+	AddedBytes   int
+	DeletedBytes int
+}
+
+// Stats counts the lines and bytes added and deleted by the diff.
+// A modified line counts as one deleted and one added line, but only the
+// bytes that actually changed within it are counted.
+func (r *DiffResult) Stats() DiffStats {
+	var stats DiffStats
+	dmp := diffmatchpatch.New()
+
+	for _, change := range r.Changes {
+		switch change.Type {
+		case ChangeAddition:
+			stats.AddedLines++
+			stats.AddedBytes += len(change.Content)
+		case ChangeDeletion:
+			stats.DeletedLines++
+			stats.DeletedBytes += len(change.Content)
+		default:
+			stats.AddedLines++
+			stats.DeletedLines++
+			for _, d := range dmp.DiffMain(change.OldContent, change.Content, false) {
+				switch d.Type {
+				case diffmatchpatch.DiffInsert:
+					stats.AddedBytes += len(d.Text)
+				case diffmatchpatch.DiffDelete:
+					stats.DeletedBytes += len(d.Text)
+				}
+			}
+		}
+	}
+
+	return stats
+}
+
+// ComputeDiffStats diffs two line slices and returns their DiffStats.
+func ComputeDiffStats(oldLines, newLines []string) DiffStats {
+	return ComputeDiff(JoinLines(oldLines), JoinLines(newLines)).Stats()
+}
@@ -3,7 +3,11 @@ package text
 import (
 	"cursortab/assert"
 	"fmt"
+	"strings"
 	"testing"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
 // assertChangesEqual compares two changes maps
@@ -194,6 +198,19 @@ func TestChangeModificationAndAddition(t *testing.T) {
 	assertChangesEqual(t, expected, actual.Changes)
 }
 
+func TestComputeDiffWithSimilarity(t *testing.T) {
+	text1 := "total := price * qty"
+	text2 := "// compute\ntotal := price * quantity"
+
+	loose := ComputeDiffWithSimilarity(text1, text2, SimilarityThreshold)
+	strict := ComputeDiffWithSimilarity(text1, text2, 0.99)
+
+	assert.Equal(t, ChangeReplaceChars, loose.Changes[2].Type, "similar line paired at default threshold")
+	assert.Equal(t, ChangeAddition, loose.Changes[1].Type, "comment added")
+	assert.Equal(t, ChangeAddition, strict.Changes[2].Type, "similar line left unpaired at strict threshold")
+	assert.Equal(t, ChangeModification, strict.Changes[1].Type, "leftovers paired by position")
+}
+
 func TestMultipleDeletions(t *testing.T) {
 	text1 := "line 1\nline 2\nline 3\nline 4\nline 5"
 	text2 := "line 1\nline 3\nline 5"
@@ -1232,3 +1249,274 @@ func TestDiffWithTabs(t *testing.T) {
 	_, exists := actual.Changes[2]
 	assert.True(t, exists, "change at line 2")
 }
+
+func TestDiffStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		oldLines []string
+		newLines []string
+		expected DiffStats
+	}{
+		{
+			name:     "no changes",
+			oldLines: []string{"a", "b"},
+			newLines: []string{"a", "b"},
+			expected: DiffStats{},
+		},
+		{
+			name:     "pure addition",
+			oldLines: []string{"a"},
+			newLines: []string{"a", "hello"},
+			expected: DiffStats{AddedLines: 1, AddedBytes: 5},
+		},
+		{
+			name:     "pure deletion",
+			oldLines: []string{"a", "gone", "b"},
+			newLines: []string{"a", "b"},
+			expected: DiffStats{DeletedLines: 1, DeletedBytes: 4},
+		},
+		{
+			name:     "append within line counts only new bytes",
+			oldLines: []string{"foo("},
+			newLines: []string{"foo(bar)"},
+			expected: DiffStats{AddedLines: 1, DeletedLines: 1, AddedBytes: 4},
+		},
+		{
+			name:     "replacement counts both sides",
+			oldLines: []string{"x := 1"},
+			newLines: []string{"x := 42"},
+			expected: DiffStats{AddedLines: 1, DeletedLines: 1, AddedBytes: 2, DeletedBytes: 1},
+		},
+		{
+			name:     "multibyte characters counted in bytes",
+			oldLines: []string{"a"},
+			newLines: []string{"a", "世界"},
+			expected: DiffStats{AddedLines: 1, AddedBytes: 6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ComputeDiffStats(tt.oldLines, tt.newLines), "stats")
+		})
+	}
+}
+
+// whitespaceCases covers lines whose changes involve tabs, non-breaking spaces,
+// trailing whitespace and zero-width characters. Columns are byte offsets into
+// the new line, except for delete_chars where they index the old line.
+var whitespaceCases = []struct {
+	name     string
+	oldLine  string
+	newLine  string
+	want     ChangeType
+	colStart int
+	colEnd   int
+}{
+	// Tabs
+	{"append after tab indent", "\tfoo", "\tfoo()", ChangeAppendChars, 4, 6},
+	{"replace after tab indent", "\tfoo := 1", "\tfoo := 2", ChangeReplaceChars, 8, 9},
+	{"insert after two tabs", "\t\tx", "\t\tyx", ChangeReplaceChars, 2, 3},
+	{"indent with tab", "foo", "\tfoo", ChangeReplaceChars, 0, 1},
+	{"tab to spaces", "\tif x {", "    if x {", ChangeReplaceChars, 0, 4},
+	{"spaces to tab", "    foo", "\tfoo", ChangeReplaceChars, 0, 1},
+	{"two spaces to tab between words", "a  b", "a\tb", ChangeReplaceChars, 1, 2},
+	{"extra tab between words", "a\tb", "a\t\tb", ChangeReplaceChars, 2, 3},
+	{"collapse tabs between words", "a\t\tb", "a\tb", ChangeDeleteChars, 2, 3},
+	{"append after mixed indent", "\t \tfoo", "\t \tfoo bar", ChangeAppendChars, 6, 10},
+	{"append after trailing tab", "foo\t", "foo\tbar", ChangeAppendChars, 4, 7},
+
+	// Trailing whitespace
+	{"strip trailing space", "\tx := 1 ", "\tx := 1", ChangeDeleteChars, 7, 8},
+	{"strip trailing spaces", "foo  ", "foo", ChangeDeleteChars, 3, 5},
+	{"add trailing spaces", "foo", "foo  ", ChangeAppendChars, 3, 5},
+	{"add trailing tab", "foo()", "foo()\t", ChangeAppendChars, 5, 6},
+	{"append after trailing space", "return ", "return nil", ChangeAppendChars, 7, 10},
+	{"replace trailing spaces with text", "return  ", "return nil", ChangeReplaceChars, 7, 10},
+	{"replace trailing spaces with call", "foo(  ", "foo(x)", ChangeReplaceChars, 4, 6},
+	{"fill whitespace-only line", "\t", "\tx", ChangeAppendChars, 1, 2},
+	{"append to trailing comment", "\tx := 1", "\tx := 1 // c", ChangeAppendChars, 7, 12},
+
+	// Non-breaking spaces (2 bytes each)
+	{"append after nbsp", "a\u00a0b", "a\u00a0bc", ChangeAppendChars, 4, 5},
+	{"nbsp to space", "a\u00a0b", "a b", ChangeReplaceChars, 1, 2},
+	{"space to nbsp", "a b", "a\u00a0b", ChangeReplaceChars, 1, 3},
+	{"replace after nbsp indent", "\u00a0\u00a0foo", "\u00a0\u00a0bar", ChangeReplaceChars, 4, 7},
+	{"leading nbsp to space", "\u00a0x", " x", ChangeReplaceChars, 0, 1},
+	{"nbsp before brace", "func f() {}", "func f()\u00a0{}", ChangeReplaceChars, 8, 10},
+
+	// Zero-width characters (3 bytes each)
+	{"append after zero-width space", "x\u200b", "x\u200by", ChangeAppendChars, 4, 5},
+	{"remove zero-width space", "x\u200by", "xy", ChangeDeleteChars, 1, 4},
+	{"insert zero-width space", "xy", "x\u200by", ChangeReplaceChars, 1, 4},
+	{"remove byte order mark", "\ufeffpackage main", "package main", ChangeDeleteChars, 0, 3},
+
+	// Multi-byte content and carriage returns
+	{"replace after accented char", "é = 1", "é = 2", ChangeReplaceChars, 5, 6},
+	{"insert before carriage return", "x\r", "xy\r", ChangeReplaceChars, 1, 2},
+}
+
+func TestCategorizeLineChange_Whitespace(t *testing.T) {
+	for _, tc := range whitespaceCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, colStart, colEnd := categorizeLineChangeWithColumns(tc.oldLine, tc.newLine)
+
+			assert.Equal(t, tc.want, got, "change type")
+			assert.Equal(t, tc.colStart, colStart, "col start")
+			assert.Equal(t, tc.colEnd, colEnd, "col end")
+
+			// Columns must land on rune boundaries of the line they index
+			line := tc.newLine
+			if got == ChangeDeleteChars {
+				line = tc.oldLine
+			}
+			assert.LessOrEqual(t, colEnd, len(line), "col end within line")
+			assert.True(t, utf8.ValidString(line[:colStart]), "col start on rune boundary")
+			assert.True(t, utf8.ValidString(line[colStart:colEnd]), "col end on rune boundary")
+		})
+	}
+}
+
+// benchmarkBuffer returns a buffer of n distinct lines of Go-like code.
+func benchmarkBuffer(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		switch i % 4 {
+		case 0:
+			lines[i] = fmt.Sprintf("func handler%d(ctx context.Context) error {", i)
+		case 1:
+			lines[i] = fmt.Sprintf("\tvalue%d := compute(ctx, %d)", i, i)
+		case 2:
+			lines[i] = fmt.Sprintf("\treturn store(value%d)", i-1)
+		default:
+			lines[i] = "}"
+		}
+	}
+	return lines
+}
+
+func BenchmarkComputeDiff_SmallEditLargeBuffer(b *testing.B) {
+	oldLines := benchmarkBuffer(10000)
+	newLines := append([]string(nil), oldLines...)
+	newLines[5000] = newLines[5000] + " // checked"
+	oldText, newText := JoinLines(oldLines), JoinLines(newLines)
+
+	for b.Loop() {
+		ComputeDiff(oldText, newText)
+	}
+}
+
+func BenchmarkComputeDiff_LargeCompletion(b *testing.B) {
+	oldLines := benchmarkBuffer(10000)
+	var newLines []string
+	newLines = append(newLines, oldLines[:5000]...)
+	for i := 5000; i < 5100; i++ {
+		newLines = append(newLines, oldLines[i]+" // rewritten", fmt.Sprintf("\tlog.Printf(\"step %d\")", i))
+	}
+	newLines = append(newLines, oldLines[5100:]...)
+	oldText, newText := JoinLines(oldLines), JoinLines(newLines)
+
+	for b.Loop() {
+		ComputeDiff(oldText, newText)
+	}
+}
+
+func TestComputeDiff_WindowMatchesFullDiff(t *testing.T) {
+	oldLines := benchmarkBuffer(40)
+	tests := []struct {
+		name string
+		edit func([]string) []string
+	}{
+		{"modification", func(l []string) []string { l[20] += " // x"; return l }},
+		{"insertion", func(l []string) []string { return append(l[:10], append([]string{"new"}, l[10:]...)...) }},
+		{"deletion", func(l []string) []string { return append(l[:10], l[13:]...) }},
+		{"first line", func(l []string) []string { l[0] = "package main"; return l }},
+		{"last line", func(l []string) []string { l[len(l)-1] = "} // end"; return l }},
+		{"appended", func(l []string) []string { return append(l, "extra") }},
+		{"unequal block", func(l []string) []string {
+			return append(l[:5], append([]string{l[5] + " // a", "x", l[6] + " // b"}, l[8:]...)...)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newLines := tt.edit(append([]string(nil), oldLines...))
+			for _, trailing := range []string{"", "\n"} {
+				oldText := strings.Join(oldLines, "\n") + trailing
+				newText := strings.Join(newLines, "\n") + trailing
+
+				got := ComputeDiff(oldText, newText)
+				want := computeFullDiff(oldText, newText, SimilarityThreshold)
+
+				assertChangesEqual(t, want.Changes, got.Changes)
+				assert.Equal(t, want.LineMapping, got.LineMapping, "line mapping")
+			}
+		})
+	}
+}
+
+// computeFullDiff diffs the whole texts, without narrowing to the lines that
+// differ, as a reference for ComputeDiff.
+func computeFullDiff(text1, text2 string, similarity float64) *DiffResult {
+	result := &DiffResult{
+		Changes:      make(map[int]LineChange),
+		OldLineCount: len(splitLines(text1)),
+		NewLineCount: len(splitLines(text2)),
+	}
+	dmp := diffmatchpatch.New()
+	chars1, chars2, lineArray := dmp.DiffLinesToChars(text1, text2)
+	lineDiffs := dmp.DiffCharsToLines(dmp.DiffMain(chars1, chars2, false), lineArray)
+	result.LineMapping = processLineDiffsWithMapping(lineDiffs, result, result.OldLineCount, result.NewLineCount, similarity)
+	return result
+}
+
+func TestMaxSimilarity_BoundsLineSimilarity(t *testing.T) {
+	pairs := [][2]string{
+		{"", ""},
+		{"abc", ""},
+		{"日本", "a"},
+		{"é = 1", "e = 12"},
+		{"return x", "return x + y"},
+		{"}", "\t}"},
+	}
+	for _, p := range pairs {
+		assert.True(t, maxSimilarity(p[0], p[1]) >= LineSimilarity(p[0], p[1]), p[0]+" / "+p[1])
+	}
+}
+
+func TestComputeDiff_DisjointEditsCarrySpans(t *testing.T) {
+	diff := ComputeDiff("call(alpha, middle, gamma)\n", "call(one, middle, three)\n")
+
+	change := diff.Changes[1]
+	assert.Equal(t, ChangeModification, change.Type, "type")
+	assert.Equal(t, []ColSpan{{Start: 5, End: 10}, {Start: 20, End: 25}}, change.OldSpans, "old spans")
+	assert.Equal(t, []ColSpan{{Start: 5, End: 8}, {Start: 18, End: 23}}, change.Spans, "new spans")
+}
+
+func TestComputeDiff_SingleEditHasNoSpans(t *testing.T) {
+	diff := ComputeDiff("x := old\n", "x := brand new\n")
+
+	assert.Nil(t, diff.Changes[1].Spans, "spans")
+}
+
+func TestFirstChangedColumn(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     int
+	}{
+		{"equal", "foo(a)", "foo(a)", -1},
+		{"changed in the middle", "foo(a, b)", "foo(x, b)", 4},
+		{"appended", "foo(", "foo(a)", 4},
+		{"deleted tail", "foo(a)", "foo", 3},
+		{"changed first byte", "bar", "baz", 2},
+		{"new line", "", "x", 0},
+		{"multibyte character", "s := \"é\"", "s := \"è\"", 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, FirstChangedColumn(tt.old, tt.new), "column")
+		})
+	}
+}
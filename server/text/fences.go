@@ -0,0 +1,197 @@
+package text
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Fence is a fenced code block of a markdown document.
+type Fence struct {
+	Start    int // 1-indexed line of the opening marker
+	End      int // 1-indexed line of the closing marker (0 = unclosed, runs to the end of the document)
+	Language string
+}
+
+// Contains reports whether line is inside the fence, between its markers.
+func (f Fence) Contains(line int) bool {
+	return line > f.Start && (f.End == 0 || line < f.End)
+}
+
+// fencedExtensions are the document types whose code fences are tracked.
+var fencedExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".mdx":      true,
+	".qmd":      true,
+	".rmd":      true,
+}
+
+// IsFencedDocument reports whether the file at path is a markdown or quarto document.
+func IsFencedDocument(path string) bool {
+	return fencedExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// parseMarker returns the marker character and length of a fence marker line,
+// and its info string. Markers are at least three backticks or tildes,
+// indented by at most three spaces.
+func parseMarker(line string) (char byte, length int, info string, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 {
+		return 0, 0, "", false
+	}
+	char = trimmed[0]
+	if char != '`' && char != '~' {
+		return 0, 0, "", false
+	}
+	for length < len(trimmed) && trimmed[length] == char {
+		length++
+	}
+	if length < 3 {
+		return 0, 0, "", false
+	}
+	info = strings.TrimSpace(trimmed[length:])
+	if char == '`' && strings.Contains(info, "`") {
+		return 0, 0, "", false
+	}
+	return char, length, info, true
+}
+
+// fenceLanguage extracts the language of an info string, either plain
+// ("python title=x") or in quarto braces ("{python}", "{r echo=FALSE}").
+func fenceLanguage(info string) string {
+	fields := strings.FieldsFunc(info, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '{' || r == '}' || r == ','
+	})
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(fields[0], ".")
+}
+
+// FindFences returns the fenced code blocks of lines, in document order.
+func FindFences(lines []string) []Fence {
+	var fences []Fence
+	var open *Fence
+	var openChar byte
+	var openLength int
+	for i, line := range lines {
+		char, length, info, ok := parseMarker(line)
+		if !ok {
+			continue
+		}
+		if open == nil {
+			fences = append(fences, Fence{Start: i + 1, Language: fenceLanguage(info)})
+			open = &fences[len(fences)-1]
+			openChar, openLength = char, length
+			continue
+		}
+		if char == openChar && length >= openLength && info == "" {
+			open.End = i + 1
+			open = nil
+		}
+	}
+	return fences
+}
+
+// FenceAt returns the fence containing line, or nil when line is prose or a
+// fence marker.
+func FenceAt(fences []Fence, line int) *Fence {
+	for i := range fences {
+		if fences[i].Contains(line) {
+			return &fences[i]
+		}
+	}
+	return nil
+}
+
+// fenceRegion identifies the part of a document a line belongs to.
+type fenceRegion struct {
+	fence  int  // Index of the enclosing fence, or of the next fence for prose
+	code   bool // Inside a fence
+	marker bool // A fence marker line
+}
+
+func regionOf(fences []Fence, line int) fenceRegion {
+	for i, f := range fences {
+		switch {
+		case line < f.Start:
+			return fenceRegion{fence: i}
+		case line == f.Start || line == f.End:
+			return fenceRegion{fence: i, marker: true}
+		case f.Contains(line):
+			return fenceRegion{fence: i, code: true}
+		}
+	}
+	return fenceRegion{fence: len(fences)}
+}
+
+// WithinFences reports whether replacing lines startLine..endLineInc (1-indexed)
+// of a document with newLines keeps the edit on one side of its code fences:
+// the changed lines all lie in one fence, or all in the prose between two
+// fences, and the new text opens or closes no fence. Only a lone marker line
+// may be rewritten on its own, and prose may gain complete fenced blocks.
+func WithinFences(fences []Fence, lines []string, startLine, endLineInc int, newLines []string) bool {
+	if len(fences) == 0 {
+		return true
+	}
+
+	var oldLines []string
+	for i := startLine; i <= endLineInc && i-1 < len(lines); i++ {
+		oldLines = append(oldLines, lines[i-1])
+	}
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+	first := startLine + prefix
+	last := startLine + len(oldLines) - 1 - suffix
+	inserted := newLines[prefix : len(newLines)-suffix]
+
+	var region fenceRegion
+	if first > last {
+		// Pure insertion between lines last and first
+		region = fenceRegion{fence: len(fences)}
+		for i, f := range fences {
+			if last < f.Start {
+				region = fenceRegion{fence: i}
+				break
+			}
+			if f.End == 0 || first <= f.End {
+				region = fenceRegion{fence: i, code: true}
+				break
+			}
+		}
+	} else {
+		region = regionOf(fences, first)
+		for line := first + 1; line <= last; line++ {
+			if regionOf(fences, line) != region {
+				return false
+			}
+		}
+		if region.marker {
+			if first != last || len(inserted) != 1 {
+				return false
+			}
+			_, _, _, ok := parseMarker(inserted[0])
+			return ok
+		}
+	}
+
+	markers := 0
+	for _, line := range inserted {
+		if _, _, _, ok := parseMarker(line); ok {
+			markers++
+		}
+	}
+	if region.code {
+		// An unclosed fence may be closed by the new text
+		unclosed := fences[region.fence].End == 0
+		return markers == 0 || (unclosed && markers == 1)
+	}
+	return markers%2 == 0
+}
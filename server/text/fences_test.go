@@ -0,0 +1,110 @@
+package text
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+var fencedDoc = []string{
+	"# Title",         // 1
+	"",                // 2
+	"```python",       // 3
+	"x = 1",           // 4
+	"y = 2",           // 5
+	"```",             // 6
+	"Some prose.",     // 7
+	"~~~~ {r echo=F}", // 8
+	"summary(x)",      // 9
+	"```",             // 10 not a closing marker: different character
+	"~~~~",            // 11
+	"More prose.",     // 12
+	"```",             // 13
+	"unclosed",        // 14
+}
+
+func TestFindFences(t *testing.T) {
+	fences := FindFences(fencedDoc)
+	assert.Equal(t, []Fence{
+		{Start: 3, End: 6, Language: "python"},
+		{Start: 8, End: 11, Language: "r"},
+		{Start: 13, End: 0, Language: ""},
+	}, fences, "fences")
+}
+
+func TestFindFences_Markers(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []Fence
+	}{
+		{"indented three spaces", []string{"   ```go", "x", "   ```"}, []Fence{{Start: 1, End: 3, Language: "go"}}},
+		{"indented four spaces", []string{"    ```go", "x", "    ```"}, nil},
+		{"two backticks", []string{"``go", "x", "``"}, nil},
+		{"shorter closing marker", []string{"````", "```", "````"}, []Fence{{Start: 1, End: 3}}},
+		{"closing marker with info", []string{"```", "```go", "```"}, []Fence{{Start: 1, End: 3}}},
+		{"quarto chunk", []string{"```{python}", "x", "```"}, []Fence{{Start: 1, End: 3, Language: "python"}}},
+		{"pandoc class", []string{"``` {.haskell .numberLines}", "x", "```"}, []Fence{{Start: 1, End: 3, Language: "haskell"}}},
+		{"inline code", []string{"```a` b```"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, FindFences(tt.lines), "fences")
+		})
+	}
+}
+
+func TestFenceAt(t *testing.T) {
+	fences := FindFences(fencedDoc)
+	assert.Nil(t, FenceAt(fences, 1), "prose")
+	assert.Nil(t, FenceAt(fences, 3), "opening marker")
+	assert.Equal(t, "python", FenceAt(fences, 4).Language, "inside first fence")
+	assert.Nil(t, FenceAt(fences, 6), "closing marker")
+	assert.Equal(t, "r", FenceAt(fences, 10).Language, "inside second fence")
+	assert.Equal(t, 13, FenceAt(fences, 14).Start, "inside unclosed fence")
+}
+
+func TestIsFencedDocument(t *testing.T) {
+	assert.True(t, IsFencedDocument("README.md"), "markdown")
+	assert.True(t, IsFencedDocument("notes/analysis.QMD"), "quarto")
+	assert.True(t, IsFencedDocument("report.Rmd"), "r markdown")
+	assert.False(t, IsFencedDocument("main.go"), "go")
+}
+
+func TestWithinFences(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    int
+		endInc   int
+		newLines []string
+		want     bool
+	}{
+		{"edit inside fence", 4, 5, []string{"x = 10", "y = 20"}, true},
+		{"append inside fence", 5, 5, []string{"y = 2", "z = 3"}, true},
+		{"insert after opening marker", 3, 3, []string{"```python", "import os"}, true},
+		{"unchanged context around edit", 2, 7, []string{"", "```python", "x = 1", "y = 3", "```", "Some prose."}, true},
+		{"edit prose", 7, 7, []string{"Some better prose."}, true},
+		{"append prose after closing marker", 6, 6, []string{"```", "New paragraph."}, true},
+		{"prose gains a complete block", 7, 7, []string{"Some prose.", "```go", "x := 1", "```"}, true},
+		{"change fence language", 3, 3, []string{"```py"}, true},
+		{"edit spans closing marker", 5, 7, []string{"y = 3", "```", "Other prose."}, false},
+		{"edit spans two regions", 5, 7, []string{"y = 3", "```", "Some prose"}, false},
+		{"closes fence early", 4, 4, []string{"x = 1", "```", "prose"}, false},
+		{"opens fence in prose", 7, 7, []string{"Some prose.", "```go"}, false},
+		{"marker replaced by text", 6, 6, []string{"done"}, false},
+		{"closes unclosed fence", 14, 14, []string{"unclosed", "```"}, true},
+	}
+
+	fences := FindFences(fencedDoc)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, WithinFences(fences, fencedDoc, tt.start, tt.endInc, tt.newLines), "within fences")
+		})
+	}
+}
+
+func TestWithinFences_NoFences(t *testing.T) {
+	lines := []string{"a", "b"}
+	assert.True(t, WithinFences(nil, lines, 1, 2, []string{"```", "c"}), "no fences")
+}
@@ -5,10 +5,10 @@ import "sort"
 // Group represents consecutive changes of the same type for rendering
 type Group struct {
 	Type      string   // "modification", "addition", "deletion"
-	StartLine int      // 1-indexed, relative to stage content
+	StartLine int      // 1-indexed, relative to stage content (to the stage's buffer range for deletions)
 	EndLine   int      // 1-indexed, inclusive
 	Lines     []string // New content
-	OldLines  []string // Old content (modifications only)
+	OldLines  []string // Old content (modifications and deletions)
 
 	// BufferLine is the 1-indexed absolute buffer position for rendering.
 	// Computed by staging/grouping using LineMapping.GetBufferLine for correct coordinate mapping.
@@ -18,10 +18,31 @@ type Group struct {
 	RenderHint string // "", "append_chars", "replace_chars", "delete_chars"
 	ColStart   int    // For character-level changes
 	ColEnd     int    // For character-level changes
+
+	// Word diff spans per line of a modification, set by AddWordSpans
+	OldSpans [][]ColSpan // Removed from OldLines[i]
+	Spans    [][]ColSpan // Inserted into Lines[i]
+
+	// In-place word edits per line of a modification, set by AddWordEdits
+	Edits [][]WordEdit // Turning OldLines[i] into Lines[i]
+
+	// Virtual text already shown on BufferLine (diagnostics, inlay hints),
+	// set by the buffer before rendering so the overlay can make room for it
+	Collisions []VirtText
+}
+
+// VirtText is virtual text another namespace shows on a buffer line
+type VirtText struct {
+	Col   int    // 0-indexed byte column it is anchored at
+	Pos   string // Where it is drawn: "eol", "overlay", "inline" or "right_align"
+	Width int    // Display width
 }
 
 // GroupChanges groups consecutive same-type changes for efficient rendering.
-// Returns groups sorted by StartLine. Deletions are not grouped (they don't render as content).
+// Modification groups with a line making several disjoint edits get the spans
+// of each edit, the other lines spanning whole.
+// Returns groups sorted by StartLine. Deletions are not grouped here: FinalizeStageGroups
+// adds them from the stage's deleted buffer lines.
 // Group content is populated from change.Content and change.OldContent fields.
 func GroupChanges(changes map[int]LineChange) []*Group {
 	if len(changes) == 0 {
@@ -44,6 +65,7 @@ func GroupChanges(changes map[int]LineChange) []*Group {
 
 	var groups []*Group
 	var currentGroup *Group
+	multiSpan := make(map[*Group]bool)
 
 	for _, lineNum := range lineNums {
 		change := changes[lineNum]
@@ -86,6 +108,17 @@ func GroupChanges(changes map[int]LineChange) []*Group {
 				currentGroup.OldLines = append(currentGroup.OldLines, change.OldContent)
 			}
 		}
+		if groupType == "modification" {
+			oldSpans, spans := change.OldSpans, change.Spans
+			if spans == nil {
+				oldSpans = []ColSpan{{Start: 0, End: len(change.OldContent)}}
+				spans = []ColSpan{{Start: 0, End: len(change.Content)}}
+			} else {
+				multiSpan[currentGroup] = true
+			}
+			currentGroup.OldSpans = append(currentGroup.OldSpans, oldSpans)
+			currentGroup.Spans = append(currentGroup.Spans, spans)
+		}
 	}
 
 	// Flush final group
@@ -93,6 +126,12 @@ func GroupChanges(changes map[int]LineChange) []*Group {
 		groups = append(groups, currentGroup)
 	}
 
+	for _, g := range groups {
+		if !multiSpan[g] {
+			g.OldSpans, g.Spans = nil, nil
+		}
+	}
+
 	return groups
 }
 
@@ -133,14 +172,43 @@ func ValidateRenderHintsForCursor(groups []*Group, cursorRow, cursorCol int) {
 
 // StageContext provides context for finalizing groups within a stage
 type StageContext struct {
-	BufferStart         int         // Stage's buffer start line (1-indexed)
-	CursorRow           int         // Current cursor row (1-indexed)
-	CursorCol           int         // Current cursor col (0-indexed)
-	LineNumToBufferLine map[int]int // Pre-computed relative line -> buffer line
+	BufferStart         int            // Stage's buffer start line (1-indexed)
+	CursorRow           int            // Current cursor row (1-indexed)
+	CursorCol           int            // Current cursor col (0-indexed)
+	LineNumToBufferLine map[int]int    // Pre-computed relative line -> buffer line
+	DeletedLines        map[int]string // Buffer line -> content of each line the stage deletes
+}
+
+// deletionGroups groups deleted lines at consecutive buffer lines into
+// deletion groups anchored at their first buffer line.
+func deletionGroups(deleted map[int]string, bufferStart int) []*Group {
+	bufferLines := make([]int, 0, len(deleted))
+	for line := range deleted {
+		bufferLines = append(bufferLines, line)
+	}
+	sort.Ints(bufferLines)
+
+	var groups []*Group
+	for _, line := range bufferLines {
+		if n := len(groups); n > 0 && groups[n-1].BufferLine+len(groups[n-1].OldLines) == line {
+			groups[n-1].EndLine++
+			groups[n-1].OldLines = append(groups[n-1].OldLines, deleted[line])
+			continue
+		}
+		groups = append(groups, &Group{
+			Type:       "deletion",
+			StartLine:  line - bufferStart + 1,
+			EndLine:    line - bufferStart + 1,
+			OldLines:   []string{deleted[line]},
+			BufferLine: line,
+		})
+	}
+	return groups
 }
 
 // FinalizeStageGroups creates groups, populates BufferLine for each group,
-// validates render hints, and computes cursor position.
+// validates render hints, and computes cursor position. Groups for the lines
+// the stage deletes follow the others, ordered by buffer line.
 // Returns (groups, cursorLine, cursorCol).
 func FinalizeStageGroups(changes map[int]LineChange, newLines []string, ctx *StageContext) ([]*Group, int, int) {
 	groups := GroupChanges(changes)
@@ -180,6 +248,7 @@ func FinalizeStageGroups(changes map[int]LineChange, newLines []string, ctx *Sta
 			g.BufferLine = ctx.BufferStart + g.StartLine - 1
 		}
 	}
+	groups = append(groups, deletionGroups(ctx.DeletedLines, ctx.BufferStart)...)
 
 	ValidateRenderHintsForCursor(groups, ctx.CursorRow, ctx.CursorCol)
 	cursorLine, cursorCol := CalculateCursorPosition(changes, newLines)
@@ -126,6 +126,29 @@ func TestGroupChanges_OnlyDeletions(t *testing.T) {
 	assert.True(t, len(groups) == 0, "no groups for pure deletions")
 }
 
+func TestFinalizeStageGroups_DeletedLines(t *testing.T) {
+	changes := map[int]LineChange{
+		1: {Type: ChangeModification, Content: "new", OldContent: "old"},
+	}
+	ctx := &StageContext{
+		BufferStart:         4,
+		LineNumToBufferLine: map[int]int{1: 4},
+		DeletedLines:        map[int]string{5: "x", 6: "y", 9: "z"},
+	}
+
+	groups, _, _ := FinalizeStageGroups(changes, []string{"new"}, ctx)
+
+	assert.Len(t, 3, groups, "groups")
+	assert.Equal(t, "modification", groups[0].Type, "changes first")
+	assert.Equal(t, "deletion", groups[1].Type, "deletion type")
+	assert.Equal(t, 5, groups[1].BufferLine, "deletion buffer line")
+	assert.Equal(t, 2, groups[1].StartLine, "start relative to the stage range")
+	assert.Equal(t, 3, groups[1].EndLine, "end relative to the stage range")
+	assert.Equal(t, []string{"x", "y"}, groups[1].OldLines, "consecutive lines grouped")
+	assert.Equal(t, 9, groups[2].BufferLine, "separate deletion buffer line")
+	assert.Equal(t, []string{"z"}, groups[2].OldLines, "separate deletion lines")
+}
+
 func TestGroupChanges_Empty(t *testing.T) {
 	groups := GroupChanges(nil)
 	assert.True(t, len(groups) == 0, "no groups for empty changes")
@@ -601,3 +624,49 @@ func TestValidateRenderHintsForCursor_AppendVsReplaceAtExactPosition(t *testing.
 	assert.Equal(t, "append_chars", appendGroup.RenderHint, "append_chars at exact cursor position should keep hint")
 	assert.Equal(t, "replace_chars", replaceGroup.RenderHint, "replace_chars at exact cursor position should keep hint")
 }
+
+func TestGroupChanges_WhitespaceColumns(t *testing.T) {
+	for _, tc := range whitespaceCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldText := "before\n" + tc.oldLine + "\nafter"
+			newText := "before\n" + tc.newLine + "\nafter"
+
+			groups := GroupChanges(ComputeDiff(oldText, newText).Changes)
+
+			assert.Len(t, 1, groups, "groups")
+			g := groups[0]
+			assert.Equal(t, "modification", g.Type, "group type")
+			assert.Equal(t, 2, g.StartLine, "start line")
+			assert.Equal(t, tc.want.RenderHint(), g.RenderHint, "render hint")
+			assert.Equal(t, tc.colStart, g.ColStart, "col start")
+			assert.Equal(t, tc.colEnd, g.ColEnd, "col end")
+			assert.Equal(t, []string{tc.newLine}, g.Lines, "lines")
+			assert.Equal(t, []string{tc.oldLine}, g.OldLines, "old lines")
+		})
+	}
+}
+
+func TestGroupChanges_MultiSpanModification(t *testing.T) {
+	changes := map[int]LineChange{
+		1: {Type: ChangeModification, OldContent: "foo(a, b)", Content: "foo(x, y)",
+			OldSpans: []ColSpan{{Start: 4, End: 5}, {Start: 7, End: 8}}, Spans: []ColSpan{{Start: 4, End: 5}, {Start: 7, End: 8}}},
+		2: {Type: ChangeModification, OldContent: "old", Content: "new line"},
+	}
+
+	groups := GroupChanges(changes)
+
+	assert.Len(t, 1, groups, "groups")
+	assert.Equal(t, [][]ColSpan{{{Start: 4, End: 5}, {Start: 7, End: 8}}, {{Start: 0, End: 3}}}, groups[0].OldSpans, "old spans")
+	assert.Equal(t, [][]ColSpan{{{Start: 4, End: 5}, {Start: 7, End: 8}}, {{Start: 0, End: 8}}}, groups[0].Spans, "spans")
+}
+
+func TestGroupChanges_SingleSpanModificationHasNoSpans(t *testing.T) {
+	changes := map[int]LineChange{
+		1: {Type: ChangeModification, OldContent: "old", Content: "new line"},
+	}
+
+	groups := GroupChanges(changes)
+
+	assert.Nil(t, groups[0].Spans, "spans")
+	assert.Nil(t, groups[0].OldSpans, "old spans")
+}
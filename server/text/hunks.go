@@ -0,0 +1,71 @@
+package text
+
+// Hunk is a changed region of a text together with up to the requested
+// number of unchanged lines around it.
+type Hunk struct {
+	OldStart int // 1-indexed first line of OldLines in the old text
+	NewStart int // 1-indexed first line of NewLines in the new text
+	OldLines []string
+	NewLines []string
+}
+
+// DiffHunks splits the changes from oldLines to newLines into hunks with up
+// to contextLines unchanged lines on each side. Hunks whose context would
+// touch are merged. Returns nil when the lines are equal.
+func DiffHunks(oldLines, newLines []string, contextLines int) []Hunk {
+	unchanged := unchangedLines(oldLines, newLines)
+
+	// Changed regions as half-open ranges of old and new lines (0-indexed)
+	type region struct{ oldStart, oldEnd, newStart, newEnd int }
+	var regions []region
+	o, n := 0, 0
+	for o < len(oldLines) || n < len(newLines) {
+		if o < len(oldLines) && unchanged[o] == n+1 {
+			o++
+			n++
+			continue
+		}
+		r := region{oldStart: o, newStart: n}
+		for o < len(oldLines) && unchanged[o] == 0 {
+			o++
+		}
+		if o < len(oldLines) {
+			n = unchanged[o] - 1
+		} else {
+			n = len(newLines)
+		}
+		r.oldEnd, r.newEnd = o, n
+		regions = append(regions, r)
+	}
+
+	var hunks []Hunk
+	for i := 0; i < len(regions); {
+		first := regions[i]
+		last := first
+		for i++; i < len(regions) && regions[i].oldStart-last.oldEnd <= 2*contextLines; i++ {
+			last = regions[i]
+		}
+		before := min(contextLines, first.oldStart)
+		after := min(contextLines, len(oldLines)-last.oldEnd)
+		hunks = append(hunks, Hunk{
+			OldStart: first.oldStart - before + 1,
+			NewStart: first.newStart - before + 1,
+			OldLines: oldLines[first.oldStart-before : last.oldEnd+after],
+			NewLines: newLines[first.newStart-before : last.newEnd+after],
+		})
+	}
+	return hunks
+}
+
+// unchangedLines returns, for each old line, the 1-indexed new line it is
+// kept as, or 0 when it was changed or deleted.
+func unchangedLines(oldLines, newLines []string) []int {
+	mapping := ComputeDiff(JoinLines(oldLines), JoinLines(newLines)).LineMapping
+	unchanged := make([]int, len(oldLines))
+	for i, n := range mapping.OldToNew {
+		if n > 0 && oldLines[i] == newLines[n-1] {
+			unchanged[i] = n
+		}
+	}
+	return unchanged
+}
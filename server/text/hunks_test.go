@@ -0,0 +1,63 @@
+package text
+
+import (
+	"cursortab/assert"
+	"fmt"
+	"testing"
+)
+
+func numberedLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	return lines
+}
+
+func TestDiffHunks_Equal(t *testing.T) {
+	assert.Nil(t, DiffHunks(numberedLines(5), numberedLines(5), 2), "no hunks")
+}
+
+func TestDiffHunks_KeepsContextAroundChanges(t *testing.T) {
+	oldLines := numberedLines(20)
+	newLines := numberedLines(20)
+	newLines[4] = "changed 5"
+	newLines[15] = "changed 16"
+
+	hunks := DiffHunks(oldLines, newLines, 2)
+
+	assert.Len(t, 2, hunks, "hunks")
+	assert.Equal(t, Hunk{
+		OldStart: 3,
+		NewStart: 3,
+		OldLines: []string{"line 3", "line 4", "line 5", "line 6", "line 7"},
+		NewLines: []string{"line 3", "line 4", "changed 5", "line 6", "line 7"},
+	}, hunks[0], "first hunk")
+	assert.Equal(t, 14, hunks[1].OldStart, "second hunk start")
+	assert.Equal(t, []string{"line 14", "line 15", "changed 16", "line 17", "line 18"}, hunks[1].NewLines, "second hunk")
+}
+
+func TestDiffHunks_MergesCloseChanges(t *testing.T) {
+	oldLines := numberedLines(10)
+	newLines := numberedLines(10)
+	newLines[2] = "changed 3"
+	newLines[6] = "changed 7"
+
+	hunks := DiffHunks(oldLines, newLines, 2)
+
+	assert.Len(t, 1, hunks, "merged")
+	assert.Equal(t, 1, hunks[0].OldStart, "clamped to the first line")
+	assert.Len(t, 9, hunks[0].OldLines, "lines 1 to 9")
+}
+
+func TestDiffHunks_InsertionAndDeletion(t *testing.T) {
+	oldLines := []string{"a", "b", "c", "d"}
+	newLines := []string{"a", "x", "b", "c"}
+
+	hunks := DiffHunks(oldLines, newLines, 0)
+
+	assert.Equal(t, []Hunk{
+		{OldStart: 2, NewStart: 2, OldLines: []string{}, NewLines: []string{"x"}},
+		{OldStart: 4, NewStart: 5, OldLines: []string{"d"}, NewLines: []string{}},
+	}, hunks, "hunks")
+}
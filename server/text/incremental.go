@@ -3,7 +3,6 @@ package text
 import (
 	"cursortab/logger"
 	"cursortab/types"
-	"sort"
 	"strings"
 )
 
@@ -87,6 +86,9 @@ func (b *IncrementalDiffBuilder) AddLine(line string) *LineChange {
 		ColStart:   colStart,
 		ColEnd:     colEnd,
 	}
+	if changeType == ChangeModification {
+		change.OldSpans, change.Spans = editSpans(oldContent, line)
+	}
 	b.Changes[newLineNum] = change
 
 	// Advance oldLineIdx past matched lines
@@ -212,6 +214,8 @@ type IncrementalStageBuilder struct {
 	CursorRow          int
 	CursorCol          int // Current cursor column (0-indexed)
 	FilePath           string
+	Scopes             []LineRange // Syntax scopes a stage is not split inside (buffer coordinates)
+	Order              StageOrder  // Order of the stages ("" sorts by cursor distance)
 
 	// State
 	diffBuilder            *IncrementalDiffBuilder
@@ -261,7 +265,7 @@ func (b *IncrementalStageBuilder) AddLine(line string) *Stage {
 			currentBufferLine := b.computeCurrentBufferLine(lineNum)
 			if currentBufferLine > 0 {
 				bufferGap := currentBufferLine - b.lastChangeBufferLine
-				if bufferGap > b.ProximityThreshold {
+				if bufferGap > b.ProximityThreshold && !sameScope(b.Scopes, b.lastChangeBufferLine, currentBufferLine) {
 					return b.finalizeCurrentStage()
 				}
 			}
@@ -293,6 +297,12 @@ func (b *IncrementalStageBuilder) AddLine(line string) *Stage {
 	return nil
 }
 
+// ChangedLines returns the number of lines streamed so far that differ from
+// the old lines.
+func (b *IncrementalStageBuilder) ChangedLines() int {
+	return len(b.diffBuilder.Changes)
+}
+
 // shouldStartNewStage determines if we need to start a new stage based on
 // BUFFER LINE gaps (not new line numbers), MaxVisibleLines limit, and viewport boundaries.
 // This ensures stages split when changes map to far-apart positions in the original file.
@@ -315,7 +325,7 @@ func (b *IncrementalStageBuilder) shouldStartNewStage(bufferLine int, isInViewpo
 		if bufferGap < 0 {
 			bufferGap = -bufferGap // Handle out-of-order matches
 		}
-		if bufferGap > b.ProximityThreshold {
+		if bufferGap > b.ProximityThreshold && !sameScope(b.Scopes, b.lastChangeBufferLine, bufferLine) {
 			return true
 		}
 	}
@@ -442,8 +452,9 @@ func (b *IncrementalStageBuilder) computeOldLineRange(stage *Stage, newStartLine
 
 // remapChanges builds changes using the LineMapping from streaming for line correspondence,
 // categorizing each pair individually. This preserves ordered prefix matching from
-// incremental diff while getting accurate change types.
-func (b *IncrementalStageBuilder) remapChanges(stageNewLines []string, newStartLine, newEndLine, minOld int) map[int]LineChange {
+// incremental diff while getting accurate change types. It also returns the old
+// lines the stage's new lines correspond to.
+func (b *IncrementalStageBuilder) remapChanges(stageNewLines []string, newStartLine, newEndLine, minOld int) (map[int]LineChange, map[int]bool) {
 	// Build a set of old lines that are already matched (to avoid double-use)
 	usedOldLines := make(map[int]bool)
 	for j := newStartLine; j <= newEndLine; j++ {
@@ -456,6 +467,7 @@ func (b *IncrementalStageBuilder) remapChanges(stageNewLines []string, newStartL
 	}
 
 	remappedChanges := make(map[int]LineChange)
+	matched := make(map[int]bool)
 	for i, newLine := range stageNewLines {
 		relativeLine := i + 1
 		absoluteNewLine := newStartLine + i
@@ -474,6 +486,7 @@ func (b *IncrementalStageBuilder) remapChanges(stageNewLines []string, newStartL
 		}
 		if oldLine > 0 && oldLine <= len(b.OldLines) {
 			oldContent = b.OldLines[oldLine-1]
+			matched[oldLine] = true
 		}
 
 		var change LineChange
@@ -497,11 +510,14 @@ func (b *IncrementalStageBuilder) remapChanges(stageNewLines []string, newStartL
 				ColStart:   colStart,
 				ColEnd:     colEnd,
 			}
+			if changeType == ChangeModification {
+				change.OldSpans, change.Spans = editSpans(oldContent, newLine)
+			}
 		}
 		remappedChanges[relativeLine] = change
 	}
 
-	return remappedChanges
+	return remappedChanges, matched
 }
 
 // finalizeCurrentStage finalizes and returns the current stage
@@ -520,7 +536,7 @@ func (b *IncrementalStageBuilder) finalizeCurrentStage() *Stage {
 		bufferStart = olr.minOld + b.BaseLineOffset - 1
 	}
 
-	remappedChanges := b.remapChanges(stageNewLines, newStartLine, newEndLine, olr.minOld)
+	remappedChanges, matched := b.remapChanges(stageNewLines, newStartLine, newEndLine, olr.minOld)
 
 	// Check if this is a pure additions stage using the remapped changes.
 	// Streaming may classify low-similarity modifications as additions, but
@@ -542,6 +558,16 @@ func (b *IncrementalStageBuilder) finalizeCurrentStage() *Stage {
 	stage.BufferStart = bufferStart
 	stage.BufferEnd = max(bufferStart+len(olr.stageOldLines)-1, bufferStart)
 
+	// Old lines in the replaced range no new line corresponds to are deleted
+	deletedLines := make(map[int]string)
+	if !hasPureAdditionsOnly {
+		for i, line := range olr.stageOldLines {
+			if !matched[olr.minOld+i] {
+				deletedLines[bufferStart+i] = line
+			}
+		}
+	}
+
 	// Build mapping from relative line to buffer line for modifications.
 	relativeToBufferLine := make(map[int]int)
 	for relativeLine, change := range remappedChanges {
@@ -557,6 +583,7 @@ func (b *IncrementalStageBuilder) finalizeCurrentStage() *Stage {
 		CursorRow:           b.CursorRow,
 		CursorCol:           b.CursorCol,
 		LineNumToBufferLine: relativeToBufferLine,
+		DeletedLines:        deletedLines,
 	}
 	groups, cursorLine, cursorCol := FinalizeStageGroups(remappedChanges, stageNewLines, ctx)
 
@@ -613,16 +640,8 @@ func (b *IncrementalStageBuilder) Finalize() *StagingResult {
 		return nil
 	}
 
-	// Sort stages by cursor distance
 	stages := b.finalizedStages
-	sort.SliceStable(stages, func(i, j int) bool {
-		distI := stageDistanceFromCursor(stages[i], b.CursorRow)
-		distJ := stageDistanceFromCursor(stages[j], b.CursorRow)
-		if distI != distJ {
-			return distI < distJ
-		}
-		return stages[i].startLine < stages[j].startLine
-	})
+	sortStages(stages, b.CursorRow, b.Order, b.OldLines)
 
 	// Set cursor targets and IsLastStage
 	for i, stage := range stages {
@@ -2204,3 +2204,18 @@ func TestIncrementalStageBuilder_InsertedLineIsAddition(t *testing.T) {
 	assert.Equal(t, "addition", group.Type, "group type")
 	assert.Equal(t, []string{""}, group.Lines, "group lines")
 }
+
+func TestIncrementalStageBuilder_KeepsChangesWithinScope(t *testing.T) {
+	oldLines := []string{"func a() {", "a := 1", "b := 2", "c := 3", "d := 4", "e := 5", "}"}
+	newLines := []string{"func a() {", "a := 10", "b := 2", "c := 3", "d := 4", "e := 50", "}"}
+	builder := NewIncrementalStageBuilder(oldLines, 1, 2, 0, 0, 0, 2, 0, "test.go")
+	builder.Scopes = []LineRange{{Start: 1, End: 7}}
+
+	for _, line := range newLines {
+		assert.Nil(t, builder.AddLine(line), "no stage finalized mid-scope")
+	}
+
+	result := builder.Finalize()
+	assert.NotNil(t, result, "staging result")
+	assert.Len(t, 1, result.Stages, "stage count")
+}
@@ -0,0 +1,91 @@
+package text
+
+import "cmp"
+
+// matchCandidate is a deleted line similar enough to an inserted line to be
+// paired with it as a modification.
+type matchCandidate struct {
+	del, ins int
+	score    float64
+	prev     int // Candidate matched before this one in the best chain ending here, -1 if none
+}
+
+// matchLines pairs the deleted lines of a block with the inserted lines that
+// replace them. Pairs keep the order of the lines on both sides, and among the
+// orderings the one with the highest total similarity wins, so a line is not
+// paired with a similar one further down at the cost of the lines in between.
+// Each deleted line is only compared with the inserted lines it can have moved
+// to, give or take MatchSlack, and at most MaxMatchCandidates of them.
+// Returns the index of the inserted line paired with each matched deleted line.
+func matchLines(deletedLines, insertedLines []string, similarity float64) map[int]int {
+	n, m := len(deletedLines), len(insertedLines)
+	memo := similarityMemo{}
+
+	var candidates []matchCandidate
+	for i, deletedLine := range deletedLines {
+		if deletedLine == "" {
+			continue
+		}
+		lo, hi := matchBand(i, n, m)
+		// Descending, so two inserted lines of the same deleted line never chain
+		for j := hi; j >= lo; j-- {
+			if maxSimilarity(deletedLine, insertedLines[j]) < similarity {
+				continue
+			}
+			if s := memo.get(deletedLine, insertedLines[j]); s >= similarity {
+				candidates = append(candidates, matchCandidate{del: i, ins: j, score: s})
+			}
+		}
+	}
+
+	// Best chain of candidates with increasing inserted index, per prefix of
+	// inserted lines, in a Fenwick tree of candidate indices
+	tree := make([]int, m+1)
+	for k := range tree {
+		tree[k] = -1
+	}
+	better := func(a, b int) bool {
+		return b == -1 || (a != -1 && cmp.Compare(candidates[a].score, candidates[b].score) > 0)
+	}
+	best := func(j int) int {
+		found := -1
+		for ; j > 0; j -= j & -j {
+			if better(tree[j], found) {
+				found = tree[j]
+			}
+		}
+		return found
+	}
+	for k := range candidates {
+		c := &candidates[k]
+		c.prev = best(c.ins)
+		if c.prev != -1 {
+			c.score += candidates[c.prev].score
+		}
+		for j := c.ins + 1; j <= m; j += j & -j {
+			if better(k, tree[j]) {
+				tree[j] = k
+			}
+		}
+	}
+
+	matches := make(map[int]int)
+	for k := best(m); k != -1; k = candidates[k].prev {
+		matches[candidates[k].del] = candidates[k].ins
+	}
+	return matches
+}
+
+// matchBand returns the inserted lines deleted line i of n can be paired with,
+// when m lines replace them: as far as the difference in line count lets it
+// move, plus MatchSlack, capped at MaxMatchCandidates lines around its
+// proportional position.
+func matchBand(i, n, m int) (lo, hi int) {
+	lo = i - max(n-m, 0) - MatchSlack
+	hi = i + max(m-n, 0) + MatchSlack
+	if hi-lo+1 > MaxMatchCandidates {
+		lo = i*m/n - MaxMatchCandidates/2
+		hi = lo + MaxMatchCandidates - 1
+	}
+	return max(lo, 0), min(hi, m-1)
+}
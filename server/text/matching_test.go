@@ -0,0 +1,75 @@
+package text
+
+import (
+	"fmt"
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestMatchLines_KeepsOrder(t *testing.T) {
+	deleted := []string{"a := compute(1)", "b := compute(2)"}
+	inserted := []string{"b := compute(2) + a", "log()", "a := compute(1) + 0", "b := compute(2) + 1"}
+
+	matches := matchLines(deleted, inserted, SimilarityThreshold)
+
+	assert.Equal(t, map[int]int{0: 2, 1: 3}, matches, "matches")
+}
+
+func TestMatchLines_CrossingPairsKeepMostSimilar(t *testing.T) {
+	deleted := []string{"value := load(key)", "return value, nil"}
+	inserted := []string{"return value, err", "value := load(key, opts)"}
+
+	matches := matchLines(deleted, inserted, SimilarityThreshold)
+
+	assert.Equal(t, map[int]int{1: 0}, matches, "the more similar of two crossing pairs")
+}
+
+func TestMatchLines_SkipsEmptyAndDissimilar(t *testing.T) {
+	deleted := []string{"", "completely different", "x := 1"}
+	inserted := []string{"", "x := 2", "y"}
+
+	matches := matchLines(deleted, inserted, SimilarityThreshold)
+
+	assert.Equal(t, map[int]int{2: 1}, matches, "matches")
+}
+
+func TestMatchLines_NeverCross(t *testing.T) {
+	var deleted, inserted []string
+	for i := range 40 {
+		deleted = append(deleted, fmt.Sprintf("item%d := get(%d)", i, i))
+	}
+	for i := 39; i >= 0; i -= 3 {
+		inserted = append(inserted, fmt.Sprintf("item%d := get(%d, true)", i, i))
+	}
+
+	matches := matchLines(deleted, inserted, SimilarityThreshold)
+
+	last := -1
+	for i := range deleted {
+		if j, ok := matches[i]; ok {
+			assert.Greater(t, j, last, fmt.Sprintf("match of line %d", i))
+			last = j
+		}
+	}
+}
+
+func TestMatchBand(t *testing.T) {
+	tests := []struct {
+		name    string
+		i, n, m int
+		lo, hi  int
+	}{
+		{"insertions", 2, 4, 10, 0, 9},
+		{"deletions", 20, 30, 5, 0, 4},
+		{"clipped to slack", 40, 100, 100, 32, 48},
+		{"capped", 50, 100, 1000, 468, 531},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lo, hi := matchBand(tt.i, tt.n, tt.m)
+			assert.Equal(t, tt.lo, lo, "lo")
+			assert.Equal(t, tt.hi, hi, "hi")
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package text
+
+// FileStages holds the staged completion for one file of a multi-file prediction
+type FileStages struct {
+	Staged   *StagedCompletion // SourcePath identifies the file
+	OldLines []string          // File content the stages were computed against
+}
+
+// MultiFileStagedCompletion groups the stages of a prediction that edits
+// several files. Files are visited in order; the stages of each file are
+// applied while that file is the current buffer.
+type MultiFileStagedCompletion struct {
+	Files       []*FileStages
+	CurrentFile int
+}
+
+// FileSummary describes one file of a multi-file completion for the UI
+type FileSummary struct {
+	Path      string
+	Stages    int
+	Additions int // Lines added across all stages
+	Deletions int // Lines deleted or replaced across all stages
+}
+
+// MultiFileSummary describes a multi-file completion for the UI
+type MultiFileSummary struct {
+	Files       []FileSummary
+	CurrentFile int // 0-indexed into Files
+}
+
+// NewMultiFileStagedCompletion creates a multi-file completion from per-file
+// stages, skipping files without stages. Returns nil when no file has stages.
+func NewMultiFileStagedCompletion(files ...*FileStages) *MultiFileStagedCompletion {
+	var withStages []*FileStages
+	for _, f := range files {
+		if f != nil && f.Staged != nil && len(f.Staged.Stages) > 0 {
+			withStages = append(withStages, f)
+		}
+	}
+	if len(withStages) == 0 {
+		return nil
+	}
+	return &MultiFileStagedCompletion{Files: withStages}
+}
+
+// Current returns the file whose stages are being applied
+func (m *MultiFileStagedCompletion) Current() *FileStages {
+	if m.CurrentFile >= len(m.Files) {
+		return nil
+	}
+	return m.Files[m.CurrentFile]
+}
+
+// Advance moves to the next file. Returns false when there are no more files.
+func (m *MultiFileStagedCompletion) Advance() bool {
+	if m.CurrentFile < len(m.Files) {
+		m.CurrentFile++
+	}
+	return m.CurrentFile < len(m.Files)
+}
+
+// Summary returns the per-file overview shown alongside cross-file jumps
+func (m *MultiFileStagedCompletion) Summary() *MultiFileSummary {
+	summary := &MultiFileSummary{CurrentFile: m.CurrentFile}
+	for _, f := range m.Files {
+		fs := FileSummary{Path: f.Staged.SourcePath, Stages: len(f.Staged.Stages)}
+		for _, stage := range f.Staged.Stages {
+			for _, change := range stage.Changes {
+				switch change.Type {
+				case ChangeAddition:
+					fs.Additions++
+				case ChangeDeletion:
+					fs.Deletions++
+				default:
+					fs.Additions++
+					fs.Deletions++
+				}
+			}
+		}
+		summary.Files = append(summary.Files, fs)
+	}
+	return summary
+}
@@ -0,0 +1,58 @@
+package text
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func stagedFile(path string, changes ...map[int]LineChange) *FileStages {
+	staged := &StagedCompletion{SourcePath: path}
+	for _, c := range changes {
+		staged.Stages = append(staged.Stages, &Stage{Changes: c})
+	}
+	return &FileStages{Staged: staged}
+}
+
+func TestNewMultiFileStagedCompletion_SkipsFilesWithoutStages(t *testing.T) {
+	m := NewMultiFileStagedCompletion(
+		stagedFile("a.go", map[int]LineChange{1: {Type: ChangeModification}}),
+		stagedFile("empty.go"),
+		nil,
+		stagedFile("b.go", map[int]LineChange{1: {Type: ChangeAddition}}),
+	)
+
+	assert.Len(t, 2, m.Files, "files")
+	assert.Equal(t, "a.go", m.Current().Staged.SourcePath, "current file")
+	assert.Nil(t, NewMultiFileStagedCompletion(stagedFile("empty.go")), "no stages")
+}
+
+func TestMultiFileStagedCompletion_Advance(t *testing.T) {
+	m := NewMultiFileStagedCompletion(
+		stagedFile("a.go", map[int]LineChange{1: {Type: ChangeModification}}),
+		stagedFile("b.go", map[int]LineChange{1: {Type: ChangeAddition}}),
+	)
+
+	assert.True(t, m.Advance(), "advance to b.go")
+	assert.Equal(t, "b.go", m.Current().Staged.SourcePath, "current file")
+	assert.False(t, m.Advance(), "no file after b.go")
+	assert.Nil(t, m.Current(), "current after last file")
+	assert.False(t, m.Advance(), "advance stays past the end")
+}
+
+func TestMultiFileStagedCompletion_Summary(t *testing.T) {
+	m := NewMultiFileStagedCompletion(
+		stagedFile("a.go",
+			map[int]LineChange{1: {Type: ChangeModification}, 2: {Type: ChangeAddition}},
+			map[int]LineChange{5: {Type: ChangeDeletion}},
+		),
+		stagedFile("b.go", map[int]LineChange{1: {Type: ChangeAppendChars}}),
+	)
+	m.Advance()
+
+	summary := m.Summary()
+
+	assert.Equal(t, 1, summary.CurrentFile, "current file")
+	assert.Equal(t, FileSummary{Path: "a.go", Stages: 2, Additions: 2, Deletions: 2}, summary.Files[0], "a.go")
+	assert.Equal(t, FileSummary{Path: "b.go", Stages: 1, Additions: 1, Deletions: 1}, summary.Files[1], "b.go")
+}
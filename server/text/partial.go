@@ -26,3 +26,41 @@ func FindNextWordBoundary(text string) int {
 	// No boundary found - return full length
 	return len(text)
 }
+
+// AcceptNextWord returns current with the next word of target accepted: the
+// text up to the word's end comes from target, followed by the longest tail
+// current shares with the rest of target. Repeated calls converge on target.
+func AcceptNextWord(current, target string) string {
+	prefix := 0
+	for prefix < len(current) && prefix < len(target) && current[prefix] == target[prefix] {
+		prefix++
+	}
+	for prefix > 0 && prefix < len(target) && !utf8.RuneStart(target[prefix]) {
+		prefix--
+	}
+
+	accepted := prefix + FindNextWordBoundary(target[prefix:])
+	rest := target[accepted:]
+	tail := current[prefix:]
+	suffix := 0
+	for suffix < len(tail) && suffix < len(rest) && tail[len(tail)-1-suffix] == rest[len(rest)-1-suffix] {
+		suffix++
+	}
+	for suffix > 0 && !utf8.RuneStart(tail[len(tail)-suffix]) {
+		suffix--
+	}
+
+	return target[:accepted] + tail[len(tail)-suffix:]
+}
+
+// AcceptNextSpan returns current with the first of the disjoint edits turning
+// it into target applied, when it takes several, and falls back to
+// AcceptNextWord for a single edit.
+func AcceptNextSpan(current, target string) string {
+	edits := WordEdits(current, target)
+	if len(edits) < 2 {
+		return AcceptNextWord(current, target)
+	}
+	e := edits[0]
+	return current[:e.OldStart] + e.Text + current[e.OldEnd:]
+}
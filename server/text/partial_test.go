@@ -59,3 +59,52 @@ func TestFindNextWordBoundary(t *testing.T) {
 		})
 	}
 }
+
+func TestAcceptNextWord(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		target  string
+		want    string
+	}{
+		{"replace first word", "foo(a, b)", "foo(x, y)", "foo(x,)"},
+		{"keeps shared tail", "return a + b", "return total + b", "return total + b"},
+		{"word at a time", "x := 1", "x := compute(1, 2)", "x := compute("},
+		{"deletion", "call(a, b)", "call(a)", "call(a)"},
+		{"equal", "same", "same", "same"},
+		{"multibyte", "s := \"héllo\"", "s := \"hélp me\"", "s := \"hélp \""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, AcceptNextWord(tt.current, tt.target), "accepted line")
+		})
+	}
+}
+
+func TestAcceptNextWord_Converges(t *testing.T) {
+	current, target := "if err != nil { return err }", "if res, err := run(ctx); err != nil {"
+	for i := 0; i < len(target) && current != target; i++ {
+		current = AcceptNextWord(current, target)
+	}
+	assert.Equal(t, target, current, "reaches target")
+}
+
+func TestAcceptNextSpan(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		target  string
+		want    string
+	}{
+		{"first of two edits", "foo(a, b)", "foo(x, y)", "foo(x, b)"},
+		{"second edit", "foo(x, b)", "foo(x, y)", "foo(x, y)"},
+		{"single edit goes by word", "return a + b", "return total + b", "return total + b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, AcceptNextSpan(tt.current, tt.target), "accepted line")
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package text
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Placeholder is a part of accepted text the user is likely to replace, like
+// a snippet tabstop.
+type Placeholder struct {
+	Line int // 1-indexed line in the new text
+	ColSpan
+}
+
+var (
+	// stringLiteralPattern matches double-quoted, single-quoted and backtick
+	// string literals on one line.
+	stringLiteralPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|` + "`[^`]*`")
+
+	todoPattern = regexp.MustCompile(`\b(?:TODO|FIXME|XXX)\b`)
+
+	// commentEndPattern matches the end of a line after a TODO marker: a block
+	// comment closer and trailing whitespace.
+	commentEndPattern = regexp.MustCompile(`\s*(?:\*/|-->)?\s*$`)
+)
+
+// ExtractPlaceholders returns the placeholders in the text the diff inserts,
+// in line and column order: the contents of string literals, TODO markers with
+// their text, and the parameters or arguments of function declarations and
+// calls. Only parts overlapping inserted text are placeholders, and a part
+// overlapping one found before it is skipped, so a literal wins over the
+// argument holding it.
+func ExtractPlaceholders(diff *DiffResult) []Placeholder {
+	if diff == nil {
+		return nil
+	}
+	var placeholders []Placeholder
+	for _, change := range diff.Changes {
+		if change.Type == ChangeDeletion || change.NewLineNum <= 0 {
+			continue
+		}
+		inserted := []ColSpan{{Start: 0, End: len(change.Content)}}
+		if change.OldLineNum > 0 && change.Type != ChangeAddition {
+			_, inserted = WordDiff(change.OldContent, change.Content)
+		}
+		for _, span := range linePlaceholders(change.Content, inserted) {
+			placeholders = append(placeholders, Placeholder{Line: change.NewLineNum, ColSpan: span})
+		}
+	}
+	sort.Slice(placeholders, func(i, j int) bool {
+		if placeholders[i].Line != placeholders[j].Line {
+			return placeholders[i].Line < placeholders[j].Line
+		}
+		return placeholders[i].Start < placeholders[j].Start
+	})
+	return placeholders
+}
+
+// linePlaceholders returns the placeholder spans of line overlapping the
+// inserted spans.
+func linePlaceholders(line string, inserted []ColSpan) []ColSpan {
+	var spans []ColSpan
+	add := func(span ColSpan) {
+		if !slices.ContainsFunc(inserted, span.overlaps) || slices.ContainsFunc(spans, span.overlaps) {
+			return
+		}
+		spans = append(spans, span)
+	}
+
+	for _, m := range stringLiteralPattern.FindAllStringIndex(line, -1) {
+		add(ColSpan{Start: m[0] + 1, End: m[1] - 1})
+	}
+	if m := todoPattern.FindStringIndex(line); m != nil {
+		end := m[0] + commentEndPattern.FindStringIndex(line[m[0]:])[0]
+		add(ColSpan{Start: m[0], End: end})
+	}
+	for _, item := range parenItems(line) {
+		add(item)
+	}
+	return spans
+}
+
+// overlaps reports whether two spans share a column. An empty span overlaps
+// the spans it is inside or at an edge of.
+func (s ColSpan) overlaps(other ColSpan) bool {
+	if s.Start == s.End {
+		return other.Start <= s.Start && s.Start <= other.End
+	}
+	if other.Start == other.End {
+		return s.Start <= other.Start && other.Start <= s.End
+	}
+	return s.Start < other.End && other.Start < s.End
+}
+
+// parenItems returns the trimmed, comma-separated items of the argument and
+// parameter lists closed on line, outer lists first: those whose opening
+// parenthesis directly follows a name. String literals are skipped over.
+func parenItems(line string) []ColSpan {
+	masked := []byte(line)
+	for _, m := range stringLiteralPattern.FindAllStringIndex(line, -1) {
+		for i := m[0]; i < m[1]; i++ {
+			masked[i] = 'x'
+		}
+	}
+
+	type list struct {
+		depth int
+		items []ColSpan
+	}
+	var open []int
+	var lists []list
+	for i, c := range masked {
+		switch c {
+		case '(':
+			open = append(open, i)
+		case ')':
+			if len(open) == 0 {
+				continue
+			}
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			if start > 0 && tokenClass(rune(masked[start-1])) == tokenWord {
+				lists = append(lists, list{depth: len(open), items: splitItems(line, masked, start+1, i)})
+			}
+		}
+	}
+	sort.SliceStable(lists, func(i, j int) bool { return lists[i].depth < lists[j].depth })
+
+	var items []ColSpan
+	for _, l := range lists {
+		items = append(items, l.items...)
+	}
+	return items
+}
+
+// splitItems splits line[start:end] at the commas outside nested brackets and
+// trims each item. Empty items are dropped.
+func splitItems(line string, masked []byte, start, end int) []ColSpan {
+	var items []ColSpan
+	addItem := func(from, to int) {
+		item := line[from:to]
+		trimmed := strings.TrimLeft(item, " \t")
+		from += len(item) - len(trimmed)
+		to = from + len(strings.TrimRight(trimmed, " \t"))
+		if from < to {
+			items = append(items, ColSpan{Start: from, End: to})
+		}
+	}
+
+	depth := 0
+	from := start
+	for i := start; i < end; i++ {
+		switch masked[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				addItem(from, i)
+				from = i + 1
+			}
+		}
+	}
+	addItem(from, end)
+	return items
+}
@@ -0,0 +1,57 @@
+package text
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func placeholderTexts(t *testing.T, newText string, placeholders []Placeholder) []string {
+	t.Helper()
+	lines := splitLines(newText)
+	var texts []string
+	for _, p := range placeholders {
+		texts = append(texts, lines[p.Line-1][p.Start:p.End])
+	}
+	return texts
+}
+
+func TestExtractPlaceholders(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    []string
+	}{
+		{"added parameter", "func f(a int) {", "func f(a int, b string) {", []string{"b string"}},
+		{"new call arguments", "x := 1", "x := 1\nlog(x, y)", []string{"x", "y"}},
+		{"string literal wins over its argument", "x := 1", "x := 1\nfmt.Println(\"hello\", n)", []string{"hello", "n"}},
+		{"empty string literal", "x := 1", "x := 1\nname := \"\"", []string{""}},
+		{"TODO marker", "x := 1", "x := 1\n// TODO: handle errors", []string{"TODO: handle errors"}},
+		{"TODO in a block comment", "x := 1", "x := 1\n/* FIXME later */", []string{"FIXME later"}},
+		{"unchanged literal is skipped", "a := \"x\"", "a := \"x\" + b", nil},
+		{"condition is not an argument list", "x := 1", "x := 1\nif (x > 0) {", nil},
+		{"no variable parts", "x := 1", "x := 2", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			placeholders := ExtractPlaceholders(ComputeDiff(tt.oldText, tt.newText))
+			assert.Equal(t, tt.want, placeholderTexts(t, tt.newText, placeholders), "placeholders")
+		})
+	}
+}
+
+func TestExtractPlaceholders_LineOrder(t *testing.T) {
+	newText := "f(\"a\")\nx := 1\ng(b)"
+
+	placeholders := ExtractPlaceholders(ComputeDiff("x := 1", newText))
+
+	assert.Len(t, 2, placeholders, "placeholders")
+	assert.Equal(t, Placeholder{Line: 1, ColSpan: ColSpan{Start: 3, End: 4}}, placeholders[0], "first")
+	assert.Equal(t, Placeholder{Line: 3, ColSpan: ColSpan{Start: 2, End: 3}}, placeholders[1], "second")
+}
+
+func TestExtractPlaceholders_NilDiff(t *testing.T) {
+	assert.Nil(t, ExtractPlaceholders(nil), "placeholders")
+}
@@ -0,0 +1,79 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rename is an identifier replaced by another one.
+type Rename struct {
+	Old string
+	New string
+}
+
+// DetectRename reports whether changes do nothing but replace one identifier
+// with another. Every changed line must be a modification whose tokens differ
+// only where the old identifier became the new one.
+func DetectRename(changes map[int]LineChange) (Rename, bool) {
+	var rename Rename
+	for _, change := range changes {
+		if change.OldLineNum <= 0 || change.NewLineNum <= 0 {
+			return Rename{}, false
+		}
+		r, ok := lineRename(change.OldContent, change.Content)
+		if !ok || (rename.Old != "" && r != rename) {
+			return Rename{}, false
+		}
+		rename = r
+	}
+	return rename, rename.Old != ""
+}
+
+// lineRename returns the single identifier replacement turning oldLine into newLine.
+func lineRename(oldLine, newLine string) (Rename, bool) {
+	oldTokens, newTokens := tokenize(oldLine), tokenize(newLine)
+	if len(oldTokens) != len(newTokens) {
+		return Rename{}, false
+	}
+	var rename Rename
+	for i := range oldTokens {
+		if oldTokens[i] == newTokens[i] {
+			continue
+		}
+		r := Rename{Old: oldTokens[i], New: newTokens[i]}
+		if !isIdentifier(r.Old) || !isIdentifier(r.New) || (rename.Old != "" && r != rename) {
+			return Rename{}, false
+		}
+		rename = r
+	}
+	return rename, rename.Old != ""
+}
+
+// isIdentifier reports whether token is a word token not starting with a digit.
+func isIdentifier(token string) bool {
+	r, _ := utf8.DecodeRuneInString(token)
+	return tokenClass(r) == tokenWord && !unicode.IsDigit(r)
+}
+
+// Apply replaces the whole-word occurrences of the old identifier in lines.
+// Returns the renamed lines and whether any line changed.
+func (r Rename) Apply(lines []string) ([]string, bool) {
+	renamed := make([]string, len(lines))
+	changed := false
+	for i, line := range lines {
+		renamed[i] = line
+		if !strings.Contains(line, r.Old) {
+			continue
+		}
+		tokens := tokenize(line)
+		for j, token := range tokens {
+			if token == r.Old {
+				tokens[j] = r.New
+				changed = true
+			}
+		}
+		renamed[i] = strings.Join(tokens, "")
+	}
+	return renamed, changed
+}
@@ -0,0 +1,59 @@
+package text
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func modification(oldLine, newLine string) LineChange {
+	return LineChange{Type: ChangeModification, OldLineNum: 1, NewLineNum: 1, OldContent: oldLine, Content: newLine}
+}
+
+func TestDetectRename(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes map[int]LineChange
+		want    Rename
+		ok      bool
+	}{
+		{"single identifier", map[int]LineChange{1: modification("count := 0", "total := 0")}, Rename{Old: "count", New: "total"}, true},
+		{"same rename twice on a line", map[int]LineChange{1: modification("x = x + 1", "y = y + 1")}, Rename{Old: "x", New: "y"}, true},
+		{"same rename on two lines", map[int]LineChange{
+			1: modification("func f(a int) {", "func f(b int) {"),
+			2: modification("\treturn a", "\treturn b"),
+		}, Rename{Old: "a", New: "b"}, true},
+		{"two different renames", map[int]LineChange{1: modification("f(a, b)", "f(c, d)")}, Rename{}, false},
+		{"number changed", map[int]LineChange{1: modification("x := 1", "x := 2")}, Rename{}, false},
+		{"punctuation changed", map[int]LineChange{1: modification("f(a)", "f[a]")}, Rename{}, false},
+		{"token added", map[int]LineChange{1: modification("f(a)", "f(a, b)")}, Rename{}, false},
+		{"addition", map[int]LineChange{1: {Type: ChangeAddition, OldLineNum: -1, NewLineNum: 1, Content: "total"}}, Rename{}, false},
+		{"no changes", map[int]LineChange{}, Rename{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := DetectRename(tt.changes)
+			assert.Equal(t, tt.ok, ok, "detected")
+			assert.Equal(t, tt.want, got, "rename")
+		})
+	}
+}
+
+func TestRenameApply_WholeWordsOnly(t *testing.T) {
+	r := Rename{Old: "count", New: "total"}
+
+	renamed, changed := r.Apply([]string{"count++", "counter := count", "discount"})
+
+	assert.True(t, changed, "changed")
+	assert.Equal(t, []string{"total++", "counter := total", "discount"}, renamed, "renamed lines")
+}
+
+func TestRenameApply_NoOccurrence(t *testing.T) {
+	lines := []string{"counter", "discount"}
+
+	renamed, changed := Rename{Old: "count", New: "total"}.Apply(lines)
+
+	assert.False(t, changed, "changed")
+	assert.Equal(t, lines, renamed, "lines kept")
+}
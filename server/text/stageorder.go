@@ -0,0 +1,169 @@
+package text
+
+import (
+	"slices"
+	"sort"
+)
+
+// StageOrder is the order in which the stages of a completion are shown.
+type StageOrder string
+
+const (
+	StageOrderCursor     StageOrder = "cursor"     // Nearest to the cursor first
+	StageOrderTopDown    StageOrder = "top_down"   // File order
+	StageOrderDependency StageOrder = "dependency" // Stages defining identifiers before stages using them
+)
+
+// declKeywords precede the identifier they declare.
+var declKeywords = map[string]bool{
+	"func": true, "def": true, "fn": true, "function": true, "class": true,
+	"struct": true, "interface": true, "type": true, "enum": true,
+	"var": true, "let": true, "const": true, "local": true,
+}
+
+// sortStages orders stages in place. The cursor order breaks ties of the
+// other orders; an unknown order sorts by cursor distance.
+func sortStages(stages []*Stage, cursorRow int, order StageOrder, oldLines []string) {
+	sort.SliceStable(stages, func(i, j int) bool {
+		distI := stageDistanceFromCursor(stages[i], cursorRow)
+		distJ := stageDistanceFromCursor(stages[j], cursorRow)
+		if distI != distJ {
+			return distI < distJ
+		}
+		return stages[i].startLine < stages[j].startLine
+	})
+
+	switch order {
+	case StageOrderTopDown:
+		sort.SliceStable(stages, func(i, j int) bool {
+			return stages[i].BufferStart < stages[j].BufferStart
+		})
+	case StageOrderDependency:
+		copy(stages, dependencyOrder(stages, oldLines))
+	}
+}
+
+// dependencyOrder returns stages with each stage after the stages defining
+// identifiers it uses, keeping the given order otherwise. Identifiers already
+// present in oldLines create no dependency. Cycles are broken in the given order.
+func dependencyOrder(stages []*Stage, oldLines []string) []*Stage {
+	existing := make(map[string]bool)
+	for _, line := range oldLines {
+		for _, word := range identifiers(line) {
+			existing[word] = true
+		}
+	}
+
+	defines := make([]map[string]bool, len(stages))
+	uses := make([]map[string]bool, len(stages))
+	for i, stage := range stages {
+		defines[i], uses[i] = stageIdentifiers(stage, existing)
+	}
+
+	// deps[i] holds the stages i depends on
+	deps := make([][]int, len(stages))
+	for i := range stages {
+		for j := range stages {
+			if i == j {
+				continue
+			}
+			for word := range uses[i] {
+				if defines[j][word] && !defines[i][word] {
+					deps[i] = append(deps[i], j)
+					break
+				}
+			}
+		}
+	}
+
+	placed := make([]bool, len(stages))
+	ordered := make([]*Stage, 0, len(stages))
+	for len(ordered) < len(stages) {
+		next := -1
+		for i := range stages {
+			if placed[i] {
+				continue
+			}
+			if !slices.ContainsFunc(deps[i], func(j int) bool { return !placed[j] }) {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			next = slices.Index(placed, false)
+		}
+		placed[next] = true
+		ordered = append(ordered, stages[next])
+	}
+	return ordered
+}
+
+// stageIdentifiers returns the new identifiers a stage declares and the new
+// identifiers it references, leaving out the existing ones.
+func stageIdentifiers(stage *Stage, existing map[string]bool) (defines, uses map[string]bool) {
+	defines = make(map[string]bool)
+	uses = make(map[string]bool)
+	for _, change := range stage.rawChanges {
+		if change.Type == ChangeDeletion {
+			continue
+		}
+		tokens := tokenize(change.Content)
+		for i, tok := range tokens {
+			if tokenClass([]rune(tok)[0]) != tokenWord || existing[tok] || isDigits(tok) {
+				continue
+			}
+			uses[tok] = true
+			if isDeclaration(tokens, i) {
+				defines[tok] = true
+			}
+		}
+	}
+	return defines, uses
+}
+
+// isDeclaration reports whether tokens[i] follows a declaration keyword or is
+// the target of an assignment.
+func isDeclaration(tokens []string, i int) bool {
+	if prev := adjacentToken(tokens, i, -1); prev >= 0 && declKeywords[tokens[prev]] {
+		return true
+	}
+	next := adjacentToken(tokens, i, 1)
+	if next < 0 {
+		return false
+	}
+	if tokens[next] == ":" && next+1 < len(tokens) && tokens[next+1] == "=" {
+		return true
+	}
+	return tokens[next] == "=" && (next+1 >= len(tokens) || tokens[next+1] != "=")
+}
+
+// adjacentToken returns the index of the nearest non-space token from i in
+// direction step, or -1.
+func adjacentToken(tokens []string, i, step int) int {
+	for j := i + step; j >= 0 && j < len(tokens); j += step {
+		if tokenClass([]rune(tokens[j])[0]) != tokenSpace {
+			return j
+		}
+	}
+	return -1
+}
+
+// identifiers returns the word tokens of line.
+func identifiers(line string) []string {
+	var words []string
+	for _, tok := range tokenize(line) {
+		if tokenClass([]rune(tok)[0]) == tokenWord {
+			words = append(words, tok)
+		}
+	}
+	return words
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package text
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func orderedStarts(t *testing.T, order StageOrder, cursorRow int, oldLines, newLines []string) []int {
+	t.Helper()
+	result := CreateStages(&StagingParams{
+		Diff:               ComputeDiff(JoinLines(oldLines), JoinLines(newLines)),
+		CursorRow:          cursorRow,
+		BaseLineOffset:     1,
+		ProximityThreshold: 1,
+		FilePath:           "test.go",
+		NewLines:           newLines,
+		OldLines:           oldLines,
+		Order:              order,
+	})
+	assert.NotNil(t, result, "staging result")
+	var starts []int
+	for _, stage := range result.Stages {
+		starts = append(starts, stage.BufferStart)
+	}
+	return starts
+}
+
+func TestStageOrder_CursorAndTopDown(t *testing.T) {
+	oldLines := []string{"a := 1", "b := 2", "c := 3", "d := 4", "e := 5", "f := 6", "g := 7", "h := 8", "i := 9"}
+	newLines := []string{"a := 10", "b := 2", "c := 3", "d := 4", "e := 50", "f := 6", "g := 7", "h := 8", "i := 90"}
+
+	assert.Equal(t, []int{9, 5, 1}, orderedStarts(t, StageOrderCursor, 9, oldLines, newLines), "cursor order")
+	assert.Equal(t, []int{1, 5, 9}, orderedStarts(t, StageOrderTopDown, 9, oldLines, newLines), "top-down order")
+	assert.Equal(t, []int{9, 5, 1}, orderedStarts(t, "", 9, oldLines, newLines), "default order")
+}
+
+func TestStageOrder_DependencyFirst(t *testing.T) {
+	oldLines := []string{"func main() {", "\trun()", "}", "", "", "", "func run() {", "}"}
+	newLines := []string{"func main() {", "\trun(limit)", "}", "", "", "", "func run() {", "\tlimit := 10", "}"}
+
+	assert.Equal(t, []int{2, 8}, orderedStarts(t, StageOrderCursor, 1, oldLines, newLines), "cursor order")
+	assert.Equal(t, []int{8, 2}, orderedStarts(t, StageOrderDependency, 1, oldLines, newLines), "dependency order")
+}
+
+func TestStageIdentifiers(t *testing.T) {
+	stage := &Stage{rawChanges: map[int]LineChange{
+		1: {Type: ChangeAddition, Content: "func helper(n int) int {"},
+		2: {Type: ChangeAddition, Content: "\ttotal = n == 2"},
+		3: {Type: ChangeDeletion, Content: "removed := 1"},
+	}}
+
+	defines, uses := stageIdentifiers(stage, map[string]bool{"int": true})
+
+	assert.True(t, defines["helper"], "declared function")
+	assert.True(t, defines["total"], "assigned variable")
+	assert.False(t, defines["n"], "parameter use")
+	assert.True(t, uses["n"], "used identifier")
+	assert.False(t, uses["int"], "existing identifier")
+	assert.False(t, uses["2"], "number")
+	assert.False(t, uses["removed"], "deleted line")
+}
@@ -49,8 +49,37 @@ type StagingParams struct {
 	ProximityThreshold int // Max gap between changes to be in same stage
 	MaxLines           int // Max lines per stage (0 to disable)
 	FilePath           string
-	NewLines           []string // New content lines for extracting stage content
-	OldLines           []string // Old content lines for extracting old content in groups
+	NewLines           []string    // New content lines for extracting stage content
+	OldLines           []string    // Old content lines for extracting old content in groups
+	Scopes             []LineRange // Syntax scopes a stage is not split inside (buffer coordinates)
+	Order              StageOrder  // Order of the stages ("" sorts by cursor distance)
+}
+
+// LineRange is an inclusive range of 1-indexed buffer lines.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// innermostScope returns the smallest scope containing line, or nil.
+func innermostScope(scopes []LineRange, line int) *LineRange {
+	var best *LineRange
+	for i := range scopes {
+		s := &scopes[i]
+		if line < s.Start || line > s.End {
+			continue
+		}
+		if best == nil || s.End-s.Start < best.End-best.Start {
+			best = s
+		}
+	}
+	return best
+}
+
+// sameScope reports whether buffer lines a and b share the same innermost scope.
+func sameScope(scopes []LineRange, a, b int) bool {
+	sa := innermostScope(scopes, a)
+	return sa != nil && sa == innermostScope(scopes, b)
 }
 
 // CreateStages is the main entry point for creating stages from a diff result.
@@ -80,23 +109,16 @@ func CreateStages(p *StagingParams) *StagingResult {
 	sort.Ints(outViewChanges)
 
 	// Step 2: Group changes into partial stages
-	inViewStages := groupChangesIntoStages(diff, inViewChanges, p.ProximityThreshold, p.MaxLines, p.BaseLineOffset)
-	outViewStages := groupChangesIntoStages(diff, outViewChanges, p.ProximityThreshold, p.MaxLines, p.BaseLineOffset)
+	inViewStages := groupChangesIntoStages(diff, inViewChanges, p.ProximityThreshold, p.MaxLines, p.BaseLineOffset, p.Scopes)
+	outViewStages := groupChangesIntoStages(diff, outViewChanges, p.ProximityThreshold, p.MaxLines, p.BaseLineOffset, p.Scopes)
 	allStages := append(inViewStages, outViewStages...)
 
 	if len(allStages) == 0 {
 		return nil
 	}
 
-	// Step 3: Sort stages by cursor distance
-	sort.SliceStable(allStages, func(i, j int) bool {
-		distI := stageDistanceFromCursor(allStages[i], p.CursorRow)
-		distJ := stageDistanceFromCursor(allStages[j], p.CursorRow)
-		if distI != distJ {
-			return distI < distJ
-		}
-		return allStages[i].startLine < allStages[j].startLine
-	})
+	// Step 3: Order stages
+	sortStages(allStages, p.CursorRow, p.Order, p.OldLines)
 
 	// Step 4: Finalize stages (content, cursor targets)
 	finalizeStages(allStages, p.NewLines, p.FilePath, p.BaseLineOffset, diff, p.CursorRow, p.CursorCol)
@@ -113,9 +135,10 @@ func CreateStages(p *StagingParams) *StagingResult {
 }
 
 // groupChangesIntoStages groups sorted line numbers into partial Stage structs based on proximity
-// and stage line limits. The returned stages have rawChanges, startLine, endLine, BufferStart, and BufferEnd
+// and stage line limits. Changes inside the same scope stay together regardless of their gap.
+// The returned stages have rawChanges, startLine, endLine, BufferStart, and BufferEnd
 // populated. Other fields are left as zero values to be filled by finalizeStages.
-func groupChangesIntoStages(diff *DiffResult, lineNumbers []int, proximityThreshold int, maxLines int, baseLineOffset int) []*Stage {
+func groupChangesIntoStages(diff *DiffResult, lineNumbers []int, proximityThreshold int, maxLines int, baseLineOffset int, scopes []LineRange) []*Stage {
 	if len(lineNumbers) == 0 {
 		return nil
 	}
@@ -139,7 +162,13 @@ func groupChangesIntoStages(diff *DiffResult, lineNumbers []int, proximityThresh
 			// Check both proximity threshold and stage line limit
 			stageLineCount := currentStage.endLine - currentStage.startLine + 1
 			exceedsMaxLines := maxLines > 0 && stageLineCount >= maxLines
-			if gap <= proximityThreshold && !exceedsMaxLines {
+			near := gap <= proximityThreshold
+			if !near && len(scopes) > 0 {
+				prevLine := diff.LineMapping.GetBufferLine(diff.Changes[currentStage.endLine], currentStage.endLine, baseLineOffset)
+				bufferLine := diff.LineMapping.GetBufferLine(change, lineNum, baseLineOffset)
+				near = sameScope(scopes, prevLine, bufferLine)
+			}
+			if near && !exceedsMaxLines {
 				currentStage.rawChanges[lineNum] = change
 				if endLine > currentStage.endLine {
 					currentStage.endLine = endLine
@@ -342,7 +371,11 @@ func finalizeStages(stages []*Stage, newLines []string, filePath string, baseLin
 		stageOldLines := make([]string, len(stageLines))
 		remappedChanges := make(map[int]LineChange)
 		relativeToBufferLine := make(map[int]int)
+		deletedLines := make(map[int]string)
 		for lineNum, change := range stage.rawChanges {
+			if change.Type == ChangeDeletion {
+				deletedLines[lineNumToBufferLine[lineNum]] = change.Content
+			}
 			newLineNum := lineNum
 			if change.NewLineNum > 0 {
 				newLineNum = change.NewLineNum
@@ -370,6 +403,7 @@ func finalizeStages(stages []*Stage, newLines []string, filePath string, baseLin
 			CursorRow:           cursorRow,
 			CursorCol:           cursorCol,
 			LineNumToBufferLine: relativeToBufferLine,
+			DeletedLines:        deletedLines,
 		}
 		groups, targetCursorLine, targetCursorCol := FinalizeStageGroups(remappedChanges, stageLines, ctx)
 
@@ -521,7 +521,7 @@ func TestGroupChangesIntoStages(t *testing.T) {
 	}
 
 	lineNumbers := []int{5, 6, 7, 20, 21}
-	stages := groupChangesIntoStages(diff, lineNumbers, 3, 0, 1)
+	stages := groupChangesIntoStages(diff, lineNumbers, 3, 0, 1, nil)
 
 	assert.Len(t, 2, stages, "stages")
 
@@ -537,7 +537,7 @@ func TestGroupChangesIntoStages(t *testing.T) {
 
 func TestGroupChangesIntoStages_EmptyInput(t *testing.T) {
 	diff := &DiffResult{Changes: map[int]LineChange{}}
-	stages := groupChangesIntoStages(diff, []int{}, 3, 0, 1)
+	stages := groupChangesIntoStages(diff, []int{}, 3, 0, 1, nil)
 
 	assert.Nil(t, stages, "stages for empty input")
 }
@@ -2533,20 +2533,20 @@ func TestCreateStages_MaxVisibleLines(t *testing.T) {
 // based on its relative position in the new content.
 func TestModificationBufferLineWithPrecedingAdditions(t *testing.T) {
 	// Scenario: Buffer lines 5-6 contain whitespace, completion replaces with 4 lines
-	// where the first 2 are additions and line 3 is a modification of original line 6.
+	// where lines 2-3 are additions and line 4 is a modification of original line 6.
 	//
 	// Old (buffer lines 5-6):
 	//   Line 5: "    " (whitespace)
 	//   Line 6: "         " (whitespace that gets modified)
 	//
 	// New (4 lines):
-	//   Line 1: "    Parameters" (addition)
+	//   Line 1: "    Parameters" (modification of old line 5)
 	//   Line 2: "    ----------" (addition)
-	//   Line 3: "    rA : array" (modification of old line 6)
-	//   Line 4: "        coord" (addition)
+	//   Line 3: "    rA : array" (addition)
+	//   Line 4: "        coord" (modification of old line 6)
 	//
-	// The modification at relative line 3 should have BufferLine=6 (where the
-	// original "         " was), NOT BufferLine=7 (which would be wrong).
+	// The modification at relative line 4 should have BufferLine=6 (where the
+	// original "         " was), NOT BufferLine=8 (which would be wrong).
 
 	oldLines := []string{
 		"    ",      // buffer line 5 (will be deleted/replaced)
@@ -2584,10 +2584,10 @@ func TestModificationBufferLineWithPrecedingAdditions(t *testing.T) {
 
 	stage := result.Stages[0]
 
-	// Find the modification group
+	// Find the modification group of old line 6
 	var modificationGroup *Group
 	for _, g := range stage.Groups {
-		if g.Type == "modification" {
+		if g.Type == "modification" && len(g.OldLines) == 1 && g.OldLines[0] == oldLines[1] {
 			modificationGroup = g
 			break
 		}
@@ -2596,7 +2596,7 @@ func TestModificationBufferLineWithPrecedingAdditions(t *testing.T) {
 	assert.NotNil(t, modificationGroup, "should have a modification group")
 
 	// The modification transforms old line 6 ("         ") to new content.
-	// Its BufferLine should be 6 (the original buffer position), not 7.
+	// Its BufferLine should be 6 (the original buffer position), not 8.
 	assert.Equal(t, 6, modificationGroup.BufferLine,
 		"modification BufferLine should be 6 (original line position), not offset by preceding additions")
 }
@@ -2850,3 +2850,92 @@ func TestCreateStages_TrailingWhitespaceModification(t *testing.T) {
 	assert.NotNil(t, addGroup, "should have an addition group")
 	assert.Equal(t, 3, addGroup.BufferLine, "addition BufferLine")
 }
+
+func TestCreateStages_DeletionOnlyStage(t *testing.T) {
+	oldLines := []string{"b", "c"}
+	diff := ComputeDiff(JoinLines(oldLines), JoinLines(nil))
+
+	result := CreateStages(&StagingParams{
+		Diff:               diff,
+		CursorRow:          2,
+		BaseLineOffset:     2,
+		ProximityThreshold: 3,
+		FilePath:           "test.go",
+		NewLines:           []string{},
+		OldLines:           oldLines,
+	})
+
+	assert.NotNil(t, result, "result")
+	assert.Len(t, 1, result.Stages, "stages")
+	stage := result.Stages[0]
+	assert.Equal(t, 2, stage.BufferStart, "BufferStart")
+	assert.Equal(t, 3, stage.BufferEnd, "BufferEnd")
+	assert.Len(t, 0, stage.Lines, "stage lines")
+	assert.Len(t, 1, stage.Groups, "groups")
+	g := stage.Groups[0]
+	assert.Equal(t, "deletion", g.Type, "group type")
+	assert.Equal(t, 2, g.BufferLine, "group buffer line")
+	assert.Equal(t, 1, g.StartLine, "group start")
+	assert.Equal(t, 2, g.EndLine, "group end")
+	assert.Equal(t, []string{"b", "c"}, g.OldLines, "deleted lines")
+}
+
+func TestCreateStages_DeletionGroupAlongsideChanges(t *testing.T) {
+	oldLines := []string{"line a", "line b", "line c", "line d", "line e"}
+	newLines := []string{"line a", "line b changed", "line d", "line e"}
+	diff := ComputeDiff(JoinLines(oldLines), JoinLines(newLines))
+
+	result := CreateStages(&StagingParams{
+		Diff:               diff,
+		CursorRow:          1,
+		BaseLineOffset:     1,
+		ProximityThreshold: 3,
+		FilePath:           "test.go",
+		NewLines:           newLines,
+		OldLines:           oldLines,
+	})
+
+	assert.NotNil(t, result, "result")
+	assert.Len(t, 1, result.Stages, "stages")
+	groups := result.Stages[0].Groups
+	last := groups[len(groups)-1]
+	assert.Equal(t, "deletion", last.Type, "deletion group")
+	assert.Equal(t, 3, last.BufferLine, "deletion buffer line")
+	assert.Equal(t, []string{"line c"}, last.OldLines, "deleted lines")
+	assert.Equal(t, "modification", groups[0].Type, "modification group kept")
+}
+
+func TestCreateStages_KeepsChangesWithinScope(t *testing.T) {
+	oldLines := []string{"func a() {", "a := 1", "b := 2", "c := 3", "d := 4", "e := 5", "}", "func b() {", "f := 6", "}"}
+	newLines := []string{"func a() {", "a := 10", "b := 2", "c := 3", "d := 4", "e := 50", "}", "func b() {", "f := 60", "}"}
+	params := func(scopes []LineRange) *StagingParams {
+		return &StagingParams{
+			Diff:               ComputeDiff(JoinLines(oldLines), JoinLines(newLines)),
+			CursorRow:          2,
+			BaseLineOffset:     1,
+			ProximityThreshold: 2,
+			FilePath:           "test.go",
+			NewLines:           newLines,
+			OldLines:           oldLines,
+			Scopes:             scopes,
+		}
+	}
+
+	unscoped := CreateStages(params(nil))
+	assert.Len(t, 3, unscoped.Stages, "stages without scopes")
+
+	scoped := CreateStages(params([]LineRange{{Start: 1, End: 7}, {Start: 8, End: 10}}))
+	assert.Len(t, 2, scoped.Stages, "stages with scopes")
+	assert.Equal(t, 2, scoped.Stages[0].BufferStart, "first stage start")
+	assert.Equal(t, 6, scoped.Stages[0].BufferEnd, "first stage end")
+	assert.Equal(t, 9, scoped.Stages[1].BufferStart, "second stage start")
+}
+
+func TestSameScope_UsesInnermostScope(t *testing.T) {
+	scopes := []LineRange{{Start: 1, End: 20}, {Start: 2, End: 8}, {Start: 10, End: 18}}
+
+	assert.True(t, sameScope(scopes, 3, 7), "same method")
+	assert.False(t, sameScope(scopes, 3, 12), "sibling methods of one class")
+	assert.True(t, sameScope(scopes, 1, 19), "class body outside methods")
+	assert.False(t, sameScope(nil, 1, 2), "no scopes")
+}
@@ -0,0 +1,58 @@
+package text
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnifiedDiff renders the changes from oldLines to newLines of the file at
+// path as a unified diff with contextLines unchanged lines around each hunk,
+// in the a/ and b/ form accepted by git apply. Returns "" when the lines are
+// equal.
+func UnifiedDiff(path string, oldLines, newLines []string, contextLines int) string {
+	hunks := DiffHunks(oldLines, newLines, contextLines)
+	if len(hunks) == 0 {
+		return ""
+	}
+	unchanged := unchangedLines(oldLines, newLines)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", path, path)
+	for _, h := range hunks {
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(h.OldStart, len(h.OldLines)), hunkRange(h.NewStart, len(h.NewLines)))
+		o, n := h.OldStart-1, h.NewStart-1
+		oldEnd, newEnd := o+len(h.OldLines), n+len(h.NewLines)
+		for o < oldEnd || n < newEnd {
+			if o < oldEnd && unchanged[o] == n+1 {
+				sb.WriteString(" " + oldLines[o] + "\n")
+				o++
+				n++
+				continue
+			}
+			for o < oldEnd && unchanged[o] == 0 {
+				sb.WriteString("-" + oldLines[o] + "\n")
+				o++
+			}
+			next := newEnd
+			if o < oldEnd {
+				next = unchanged[o] - 1
+			}
+			for ; n < next; n++ {
+				sb.WriteString("+" + newLines[n] + "\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// hunkRange formats the start and length of one side of a hunk header. An
+// empty side names the line before it, as diff and git do.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		start--
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
@@ -0,0 +1,37 @@
+package text
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	oldLines := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	newLines := []string{"a", "B", "c", "d", "e", "f", "g", "h", "i"}
+
+	got := UnifiedDiff("main.go", oldLines, newLines, 1)
+
+	want := "--- a/main.go\n+++ b/main.go\n" +
+		"@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n" +
+		"@@ -8 +8,2 @@\n h\n+i\n"
+	assert.Equal(t, want, got, "diff")
+}
+
+func TestUnifiedDiff_Equal(t *testing.T) {
+	assert.Equal(t, "", UnifiedDiff("main.go", []string{"a"}, []string{"a"}, 3), "no diff")
+}
+
+func TestUnifiedDiff_EmptySides(t *testing.T) {
+	assert.Equal(t, "--- a/f\n+++ b/f\n@@ -0,0 +1,2 @@\n+a\n+b\n", UnifiedDiff("f", nil, []string{"a", "b"}, 3), "created")
+	assert.Equal(t, "--- a/f\n+++ b/f\n@@ -1,2 +0,0 @@\n-a\n-b\n", UnifiedDiff("f", []string{"a", "b"}, nil, 3), "emptied")
+}
+
+func TestUnifiedDiff_Deletion(t *testing.T) {
+	oldLines := []string{"keep", "drop", "keep too"}
+	newLines := []string{"keep", "keep too"}
+
+	got := UnifiedDiff("f", oldLines, newLines, 0)
+
+	assert.Equal(t, "--- a/f\n+++ b/f\n@@ -2 +1,0 @@\n-drop\n", got, "diff")
+}
@@ -0,0 +1,219 @@
+package text
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ColSpan is a column range within a line: 0-based byte columns, End exclusive.
+type ColSpan struct {
+	Start int
+	End   int
+}
+
+// tokenRuneBase maps word diff tokens into the private use area so each
+// token diffs as a single rune.
+const tokenRuneBase = 0xE000
+
+// WordDiff diffs two versions of a line token by token (identifiers and
+// numbers, whitespace runs, single punctuation characters) and returns the
+// spans removed from oldLine and the spans inserted into newLine. Adjacent
+// changed tokens share one span.
+func WordDiff(oldLine, newLine string) (oldSpans, newSpans []ColSpan) {
+	oldTokens, newTokens, diffs := tokenDiff(oldLine, newLine)
+
+	oldIdx, newIdx := 0, 0
+	oldCol, newCol := 0, 0
+	for _, d := range diffs {
+		count := utf8.RuneCountInString(d.Text)
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			for range count {
+				oldCol += len(oldTokens[oldIdx])
+				newCol += len(newTokens[newIdx])
+				oldIdx++
+				newIdx++
+			}
+		case diffmatchpatch.DiffDelete:
+			start := oldCol
+			for range count {
+				oldCol += len(oldTokens[oldIdx])
+				oldIdx++
+			}
+			oldSpans = appendSpan(oldSpans, start, oldCol)
+		case diffmatchpatch.DiffInsert:
+			start := newCol
+			for range count {
+				newCol += len(newTokens[newIdx])
+				newIdx++
+			}
+			newSpans = appendSpan(newSpans, start, newCol)
+		}
+	}
+	return oldSpans, newSpans
+}
+
+// WordEdit replaces the columns OldStart..OldEnd (0-based bytes, End
+// exclusive) of an old line with Text. An empty range inserts Text.
+type WordEdit struct {
+	OldStart int
+	OldEnd   int
+	Text     string
+}
+
+// WordEdits diffs two versions of a line token by token, as WordDiff does,
+// and returns the edits turning oldLine into newLine in column order. Tokens
+// removed and inserted at the same place make a single edit.
+func WordEdits(oldLine, newLine string) []WordEdit {
+	oldTokens, newTokens, diffs := tokenDiff(oldLine, newLine)
+
+	var edits []WordEdit
+	// last returns the edit ending at col, to extend, or nil
+	last := func(col int) *WordEdit {
+		if n := len(edits); n > 0 && edits[n-1].OldEnd == col {
+			return &edits[n-1]
+		}
+		return nil
+	}
+	oldIdx, newIdx := 0, 0
+	oldCol := 0
+	for _, d := range diffs {
+		count := utf8.RuneCountInString(d.Text)
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			for range count {
+				oldCol += len(oldTokens[oldIdx])
+				oldIdx++
+				newIdx++
+			}
+		case diffmatchpatch.DiffDelete:
+			start := oldCol
+			for range count {
+				oldCol += len(oldTokens[oldIdx])
+				oldIdx++
+			}
+			if e := last(start); e != nil {
+				e.OldEnd = oldCol
+			} else {
+				edits = append(edits, WordEdit{OldStart: start, OldEnd: oldCol})
+			}
+		case diffmatchpatch.DiffInsert:
+			var inserted string
+			for range count {
+				inserted += newTokens[newIdx]
+				newIdx++
+			}
+			if e := last(oldCol); e != nil {
+				e.Text += inserted
+			} else {
+				edits = append(edits, WordEdit{OldStart: oldCol, OldEnd: oldCol, Text: inserted})
+			}
+		}
+	}
+	return edits
+}
+
+// tokenDiff tokenizes both lines and diffs them with each token as a single
+// rune.
+func tokenDiff(oldLine, newLine string) (oldTokens, newTokens []string, diffs []diffmatchpatch.Diff) {
+	oldTokens = tokenize(oldLine)
+	newTokens = tokenize(newLine)
+
+	ids := make(map[string]rune)
+	encode := func(tokens []string) []rune {
+		runes := make([]rune, len(tokens))
+		for i, tok := range tokens {
+			id, ok := ids[tok]
+			if !ok {
+				id = tokenRuneBase + rune(len(ids))
+				ids[tok] = id
+			}
+			runes[i] = id
+		}
+		return runes
+	}
+
+	dmp := diffmatchpatch.New()
+	diffs = dmp.DiffMainRunes(encode(oldTokens), encode(newTokens), false)
+	return oldTokens, newTokens, diffs
+}
+
+// appendSpan adds start..end to spans, extending the last span when they touch.
+func appendSpan(spans []ColSpan, start, end int) []ColSpan {
+	if n := len(spans); n > 0 && spans[n-1].End == start {
+		spans[n-1].End = end
+		return spans
+	}
+	return append(spans, ColSpan{Start: start, End: end})
+}
+
+// tokenize splits line into word diff tokens.
+func tokenize(line string) []string {
+	var tokens []string
+	start := 0
+	for start < len(line) {
+		r, size := utf8.DecodeRuneInString(line[start:])
+		end := start + size
+		class := tokenClass(r)
+		if class != tokenPunct {
+			for end < len(line) {
+				next, nextSize := utf8.DecodeRuneInString(line[end:])
+				if tokenClass(next) != class {
+					break
+				}
+				end += nextSize
+			}
+		}
+		tokens = append(tokens, line[start:end])
+		start = end
+	}
+	return tokens
+}
+
+const (
+	tokenWord = iota
+	tokenSpace
+	tokenPunct
+)
+
+func tokenClass(r rune) int {
+	switch {
+	case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return tokenWord
+	case unicode.IsSpace(r):
+		return tokenSpace
+	default:
+		return tokenPunct
+	}
+}
+
+// AddWordSpans fills the word diff spans of each line of the modification
+// groups.
+func AddWordSpans(groups []*Group) {
+	for _, g := range groups {
+		if g.Type != "modification" || len(g.OldLines) != len(g.Lines) {
+			continue
+		}
+		g.OldSpans = make([][]ColSpan, len(g.Lines))
+		g.Spans = make([][]ColSpan, len(g.Lines))
+		for i := range g.Lines {
+			g.OldSpans[i], g.Spans[i] = WordDiff(g.OldLines[i], g.Lines[i])
+		}
+	}
+}
+
+// AddWordEdits fills the in-place word edits of each line of the
+// modification groups.
+func AddWordEdits(groups []*Group) {
+	for _, g := range groups {
+		if g.Type != "modification" || len(g.OldLines) != len(g.Lines) {
+			continue
+		}
+		g.Edits = make([][]WordEdit, len(g.Lines))
+		for i := range g.Lines {
+			g.Edits[i] = WordEdits(g.OldLines[i], g.Lines[i])
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package text
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestWordDiff_ChangedArgument(t *testing.T) {
+	oldSpans, newSpans := WordDiff("foo(a, b)", "foo(a, count)")
+
+	assert.Equal(t, []ColSpan{{Start: 7, End: 8}}, oldSpans, "old spans")
+	assert.Equal(t, []ColSpan{{Start: 7, End: 12}}, newSpans, "new spans")
+}
+
+func TestWordDiff_SeveralSpans(t *testing.T) {
+	_, newSpans := WordDiff("call(x, y, z)", "call(first, y, last)")
+
+	assert.Equal(t, []ColSpan{{Start: 5, End: 10}, {Start: 15, End: 19}}, newSpans, "one span per changed word")
+}
+
+func TestWordDiff_MultibyteColumnsAreBytes(t *testing.T) {
+	_, newSpans := WordDiff("café = 1", "café = 2")
+
+	assert.Equal(t, []ColSpan{{Start: 8, End: 9}}, newSpans, "byte columns")
+}
+
+func TestWordDiff_Identical(t *testing.T) {
+	oldSpans, newSpans := WordDiff("same", "same")
+
+	assert.Len(t, 0, oldSpans, "old spans")
+	assert.Len(t, 0, newSpans, "new spans")
+}
+
+func TestAddWordSpans_ModificationGroupsOnly(t *testing.T) {
+	groups := []*Group{
+		{Type: "modification", Lines: []string{"x := 2"}, OldLines: []string{"x := 1"}},
+		{Type: "addition", Lines: []string{"y := 3"}},
+	}
+
+	AddWordSpans(groups)
+
+	assert.Equal(t, [][]ColSpan{{{Start: 5, End: 6}}}, groups[0].Spans, "modification spans")
+	assert.Equal(t, [][]ColSpan{{{Start: 5, End: 6}}}, groups[0].OldSpans, "modification old spans")
+	assert.Nil(t, groups[1].Spans, "addition untouched")
+}
+
+func TestWordEdits_ReplacedWord(t *testing.T) {
+	edits := WordEdits("foo(a, b)", "foo(a, count)")
+
+	assert.Equal(t, []WordEdit{{OldStart: 7, OldEnd: 8, Text: "count"}}, edits, "edits")
+}
+
+func TestWordEdits_InsertionAndDeletion(t *testing.T) {
+	edits := WordEdits("call(x, y)", "call(x, y, z)")
+	assert.Equal(t, []WordEdit{{OldStart: 9, OldEnd: 9, Text: ", z"}}, edits, "insertion")
+
+	edits = WordEdits("call(x, y)", "call(y)")
+	assert.Equal(t, []WordEdit{{OldStart: 5, OldEnd: 8}}, edits, "deletion")
+}
+
+func TestWordEdits_ApplyToOldLine(t *testing.T) {
+	oldLine, newLine := "if err != nil { return err }", "if e := run(); e != nil { return fmt.Errorf(e) }"
+
+	applied, col := "", 0
+	for _, e := range WordEdits(oldLine, newLine) {
+		applied += oldLine[col:e.OldStart] + e.Text
+		col = e.OldEnd
+	}
+	applied += oldLine[col:]
+
+	assert.Equal(t, newLine, applied, "edits turn the old line into the new one")
+}
+
+func TestAddWordEdits_ModificationGroupsOnly(t *testing.T) {
+	groups := []*Group{
+		{Type: "modification", Lines: []string{"x := 2"}, OldLines: []string{"x := 1"}},
+		{Type: "addition", Lines: []string{"y := 3"}},
+	}
+
+	AddWordEdits(groups)
+
+	assert.Equal(t, [][]WordEdit{{{OldStart: 5, OldEnd: 6, Text: "2"}}}, groups[0].Edits, "modification edits")
+	assert.Nil(t, groups[1].Edits, "addition has none")
+}
@@ -0,0 +1,123 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxCachedPieces bounds the piece counts a BPE tokenizer remembers.
+const maxCachedPieces = 10_000
+
+// pieces splits text the way cl100k-style vocabularies pre-tokenize it,
+// without the lookahead RE2 lacks, so trailing whitespace may split slightly
+// differently.
+var pieces = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// BPE counts tokens by byte-pair encoding with the merge ranks of a
+// tiktoken-style vocabulary.
+type BPE struct {
+	ranks map[string]int
+
+	mu    sync.Mutex
+	cache map[string]int // Token count per piece
+}
+
+// NewBPE returns a tokenizer merging byte sequences by ranks, lowest first.
+func NewBPE(ranks map[string]int) *BPE {
+	return &BPE{ranks: ranks, cache: make(map[string]int)}
+}
+
+// LoadBPE reads a vocabulary in the tiktoken format: a base64 encoded token
+// and its rank per line.
+func LoadBPE(path string) (*BPE, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected a token and a rank", path, n)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		r, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		ranks[string(decoded)] = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("%s: empty vocabulary", path)
+	}
+	return NewBPE(ranks), nil
+}
+
+func (b *BPE) Count(text string) int {
+	count := 0
+	for _, piece := range pieces.FindAllString(text, -1) {
+		count += b.pieceCount(piece)
+	}
+	return count
+}
+
+// pieceCount returns the tokens of a pre-tokenized piece, remembering it.
+func (b *BPE) pieceCount(piece string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n, ok := b.cache[piece]; ok {
+		return n
+	}
+	n := b.merge(piece)
+	if len(b.cache) >= maxCachedPieces {
+		clear(b.cache)
+	}
+	b.cache[piece] = n
+	return n
+}
+
+// merge byte-pair encodes piece, repeatedly joining the adjacent parts whose
+// concatenation has the lowest rank, and returns the parts left.
+func (b *BPE) merge(piece string) int {
+	if _, ok := b.ranks[piece]; ok {
+		return 1
+	}
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := b.ranks[piece[bounds[i]:bounds[i+2]]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = slices.Delete(bounds, best+1, best+2)
+	}
+	return len(bounds) - 1
+}
@@ -0,0 +1,62 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cursortab/assert"
+)
+
+func testRanks() map[string]int {
+	return map[string]int{
+		"h": 0, "e": 1, "l": 2, "o": 3, " ": 4, "w": 5, "r": 6, "d": 7,
+		"he": 8, "ll": 9, "hell": 10, "hello": 11, " w": 12, " wor": 13, "or": 14,
+	}
+}
+
+func TestBPE_Count(t *testing.T) {
+	bpe := NewBPE(testRanks())
+
+	assert.Equal(t, 1, bpe.Count("hello"), "whole word in the vocabulary")
+	assert.Equal(t, 4, bpe.Count("hello world"), "hello, then ' wor', l and d")
+	assert.Equal(t, 2, bpe.Count("lo"), "no merge for lo")
+	assert.Equal(t, 0, bpe.Count(""), "empty")
+}
+
+func TestBPE_CountsUnknownBytes(t *testing.T) {
+	bpe := NewBPE(testRanks())
+
+	assert.Equal(t, len("好"), bpe.Count("好"), "a token per byte without merges")
+}
+
+func TestBPE_CachesPieces(t *testing.T) {
+	bpe := NewBPE(testRanks())
+	bpe.Count("hello hello")
+
+	assert.Equal(t, 1, bpe.cache["hello"], "piece cached")
+}
+
+func TestLoadBPE(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vocab.tiktoken")
+	content := base64.StdEncoding.EncodeToString([]byte("he")) + " 0\n" +
+		base64.StdEncoding.EncodeToString([]byte("hell")) + " 1\n\n"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644), "write vocab")
+
+	bpe, err := LoadBPE(path)
+	assert.NoError(t, err, "LoadBPE")
+	assert.Equal(t, 0, bpe.ranks["he"], "he rank")
+	assert.Equal(t, 1, bpe.ranks["hell"], "hell rank")
+}
+
+func TestLoadBPE_Malformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vocab.tiktoken")
+	assert.NoError(t, os.WriteFile(path, []byte("aGU=\n"), 0o644), "write vocab")
+
+	_, err := LoadBPE(path)
+	assert.Error(t, err, "missing rank")
+
+	_, err = LoadBPE(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err, "missing file")
+}
@@ -0,0 +1,39 @@
+// Package tokenizer counts the tokens a provider's model sees in a text, so
+// that context is trimmed to a token budget rather than a character estimate.
+package tokenizer
+
+import "unicode/utf8"
+
+// AvgCharsPerToken is the ASCII characters per token assumed without a
+// vocabulary. Conservative for mixed content (code + JSON).
+const AvgCharsPerToken = 2
+
+// Tokenizer counts the tokens of a text.
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// Heuristic estimates token counts without a vocabulary: AvgCharsPerToken
+// ASCII characters per token, and a token per other character, as CJK text
+// and symbols rarely share one.
+type Heuristic struct{}
+
+func (Heuristic) Count(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+AvgCharsPerToken-1)/AvgCharsPerToken + other
+}
+
+// Or returns t, or the heuristic when t is nil.
+func Or(t Tokenizer) Tokenizer {
+	if t == nil {
+		return Heuristic{}
+	}
+	return t
+}
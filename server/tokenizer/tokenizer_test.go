@@ -0,0 +1,22 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"cursortab/assert"
+)
+
+func TestHeuristic_Count(t *testing.T) {
+	assert.Equal(t, 0, Heuristic{}.Count(""), "empty")
+	assert.Equal(t, 3, Heuristic{}.Count("hello"), "ascii rounds up")
+	assert.Equal(t, 4, Heuristic{}.Count("你好世界"), "a token per CJK character")
+	assert.Equal(t, 3, Heuristic{}.Count("ab你好"), "mixed")
+}
+
+func TestOr(t *testing.T) {
+	_, isHeuristic := Or(nil).(Heuristic)
+	assert.True(t, isHeuristic, "nil falls back to the heuristic")
+
+	bpe := NewBPE(map[string]int{"a": 0})
+	assert.True(t, Or(bpe) == Tokenizer(bpe), "set tokenizer kept")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"cursortab/logger"
+
+	"github.com/neovim/go-client/nvim"
+)
+
+// Workspace trust states reported to the editor
+const (
+	trustNotRequired = "not_required" // Only local providers are configured
+	trustTrusted     = "trusted"
+	trustUntrusted   = "untrusted"
+)
+
+// hostedProviderTypes always send buffer content to a third-party service.
+var hostedProviderTypes = []string{"sweepapi", "copilot", "mercuryapi", "gemini", "anthropic"}
+
+// getTrustPath returns the file listing workspaces trusted with hosted providers.
+func getTrustPath(stateDir string) string {
+	return filepath.Join(stateDir, "trusted_workspaces.json")
+}
+
+// hosted reports whether the provider, or any provider raced against it or
+// used as its fallback, can send buffer content off this machine.
+func (p *ProviderConfig) hosted() bool {
+	if slices.Contains(hostedProviderTypes, p.Type) || !isLoopbackURL(p.URL) {
+		return true
+	}
+	for i := range p.Race {
+		if p.Race[i].hosted() {
+			return true
+		}
+	}
+	for i := range p.Fallback {
+		if p.Fallback[i].hosted() {
+			return true
+		}
+	}
+	return false
+}
+
+func isLoopbackURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// loadTrustedWorkspaces reads the trusted workspace paths. A missing file yields none.
+func loadTrustedWorkspaces(stateDir string) ([]string, error) {
+	data, err := os.ReadFile(getTrustPath(stateDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var workspaces []string
+	if err := json.Unmarshal(data, &workspaces); err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// saveTrustedWorkspaces writes the trusted workspace paths atomically.
+func saveTrustedWorkspaces(stateDir string, workspaces []string) error {
+	data, err := json.MarshalIndent(workspaces, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := getTrustPath(stateDir)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// trustStatus reports whether the workspace may use the configured provider.
+func (d *Daemon) trustStatus() string {
+	if !d.config.Provider.hosted() {
+		return trustNotRequired
+	}
+	workspaces, err := loadTrustedWorkspaces(d.config.StateDir)
+	if err != nil {
+		logger.Warn("trust: ignoring unreadable trust file: %v", err)
+	}
+	if slices.Contains(workspaces, d.engine.WorkspacePath) {
+		return trustTrusted
+	}
+	return trustUntrusted
+}
+
+// applyTrust blocks the engine while the workspace is untrusted.
+func (d *Daemon) applyTrust() {
+	status := d.trustStatus()
+	if status == trustUntrusted {
+		logger.Info("trust: workspace %s is untrusted, hosted provider disabled", d.engine.WorkspacePath)
+	}
+	d.engine.SetTrusted(status != trustUntrusted)
+}
+
+// trustWorkspace persists trust for the current workspace and unblocks the engine.
+func (d *Daemon) trustWorkspace() (string, error) {
+	d.trustMu.Lock()
+	defer d.trustMu.Unlock()
+
+	if status := d.trustStatus(); status != trustUntrusted {
+		return status, nil
+	}
+
+	workspaces, err := loadTrustedWorkspaces(d.config.StateDir)
+	if err != nil {
+		return "", err
+	}
+	if err := saveTrustedWorkspaces(d.config.StateDir, append(workspaces, d.engine.WorkspacePath)); err != nil {
+		return "", err
+	}
+
+	logger.Info("trust: workspace %s trusted", d.engine.WorkspacePath)
+	d.engine.SetTrusted(true)
+	return trustTrusted, nil
+}
+
+// registerTrustHandlers exposes the trust RPCs and prompts the editor when the
+// workspace still needs to be trusted.
+func (d *Daemon) registerTrustHandlers(n *nvim.Nvim) {
+	if err := n.RegisterHandler("cursortab_trust_status", func(_ *nvim.Nvim) (string, error) {
+		return d.trustStatus(), nil
+	}); err != nil {
+		logger.Error("error registering trust status handler: %v", err)
+	}
+	if err := n.RegisterHandler("cursortab_trust", func(_ *nvim.Nvim) (string, error) {
+		return d.trustWorkspace()
+	}); err != nil {
+		logger.Error("error registering trust handler: %v", err)
+	}
+
+	if d.trustStatus() == trustUntrusted {
+		// Runs once the connection is being served, since it waits for a reply
+		go d.buffer.NotifyUntrusted(d.engine.WorkspacePath)
+	}
+}
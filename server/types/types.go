@@ -1,10 +1,18 @@
 package types
 
+import (
+	"math/rand/v2"
+	"time"
+
+	"cursortab/tokenizer"
+)
+
 // Completion represents a code completion with line range and content
 type Completion struct {
 	StartLine  int // 1-indexed
 	EndLineInc int // 1-indexed, inclusive
 	Lines      []string
+	FilePath   string // Workspace-relative file the completion edits (empty = current buffer)
 }
 
 type CompletionSource int
@@ -12,6 +20,8 @@ type CompletionSource int
 const (
 	CompletionSourceTyping CompletionSource = iota
 	CompletionSourceIdle
+	CompletionSourceDiagnostics // Idle request asking for a fix of the LSP error on the cursor line
+	CompletionSourcePaste       // Request asking to fit pasted code to the code around it
 )
 
 // CursorPredictionTarget represents the target for cursor jump with additional metadata
@@ -27,6 +37,9 @@ type CompletionRequest struct {
 	Source        CompletionSource
 	WorkspacePath string
 	WorkspaceID   string
+	// ProjectRoot is the root of the project holding the file (the nearest
+	// directory with a root marker such as .git), or WorkspacePath if none
+	ProjectRoot string
 	// File context
 	FilePath string
 	Lines    []string
@@ -38,6 +51,10 @@ type CompletionRequest struct {
 	// Cursor position
 	CursorRow int // 1-indexed
 	CursorCol int // 0-indexed
+	// FenceLanguage is the language of the markdown code fence holding the cursor ("" outside one)
+	FenceLanguage string
+	// Instruction is the text of a `cursortab: <instruction>` comment on the cursor line ("" without one)
+	Instruction string
 	// Viewport constraint: only set when staging is disabled (0 = no limit)
 	ViewportHeight int
 	// MaxVisibleLines limits max visible lines per completion (0 = no limit)
@@ -48,20 +65,83 @@ type CompletionRequest struct {
 	RecentBufferSnapshots []*RecentBufferSnapshot
 	// UserActions contains recent user edit actions for the current file
 	UserActions []*UserAction
+	// RetrievalChunks holds chunks of other files sharing identifiers with the code around the cursor, best first
+	RetrievalChunks []*RetrievalChunk
+	// ProviderOptions are generation parameters from the config for the provider's wire request (nil = none)
+	ProviderOptions ProviderOptions
+}
+
+// ProviderOptions are generation parameters set in the config and passed
+// through to the provider's wire request, as decoded from JSON. Providers map
+// the keys they support and ignore the rest: "temperature" and "top_p"
+// (numbers), "model" (string) and "headers" (extra HTTP headers).
+type ProviderOptions map[string]any
+
+// Temperature returns the sampling temperature, if set.
+func (o ProviderOptions) Temperature() (float64, bool) {
+	v, ok := o["temperature"].(float64)
+	return v, ok
+}
+
+// TopP returns the nucleus sampling threshold, if set.
+func (o ProviderOptions) TopP() (float64, bool) {
+	v, ok := o["top_p"].(float64)
+	return v, ok
+}
+
+// Model returns the model replacing the configured one, if set.
+func (o ProviderOptions) Model() (string, bool) {
+	v, ok := o["model"].(string)
+	return v, ok && v != ""
+}
+
+// Headers returns the extra HTTP headers to send (nil for none).
+func (o ProviderOptions) Headers() map[string]string {
+	raw, ok := o["headers"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	headers := make(map[string]string, len(raw))
+	for name, value := range raw {
+		if s, ok := value.(string); ok {
+			headers[name] = s
+		}
+	}
+	return headers
 }
 
 // CompletionResponse contains both completions and cursor prediction target
 type CompletionResponse struct {
 	Completions  []*Completion
-	CursorTarget *CursorPredictionTarget // Optional, from cursor_prediction_target
-	MetricsInfo  *MetricsInfo            // Optional, for providers that track metrics
+	CursorTarget *CursorPredictionTarget   // Optional, from cursor_prediction_target
+	NextTargets  []*CursorPredictionTarget // Optional, further edit locations after CursorTarget, most likely first
+	MetricsInfo  *MetricsInfo              // Optional, for providers that track metrics
+	Annotation   *Annotation               // Set by the engine when the response arrives
+}
+
+// Targets returns the predicted next-edit locations in order: CursorTarget
+// followed by NextTargets.
+func (r *CompletionResponse) Targets() []*CursorPredictionTarget {
+	if r.CursorTarget == nil {
+		return nil
+	}
+	return append([]*CursorPredictionTarget{r.CursorTarget}, r.NextTargets...)
+}
+
+// Annotation identifies the provider and model that produced a response.
+type Annotation struct {
+	Provider string
+	Model    string        // Empty when the provider has no configured model
+	Latency  time.Duration // Zero for cached and prefetched responses
 }
 
 // MetricsInfo holds metadata for metrics tracking
 type MetricsInfo struct {
-	ID        string // Provider-specific completion ID
-	Additions int    // Number of lines added
-	Deletions int    // Number of lines deleted
+	ID           string // Provider-specific completion ID
+	Additions    int    // Number of lines added
+	Deletions    int    // Number of lines deleted
+	AddedBytes   int    // Number of bytes added
+	DeletedBytes int    // Number of bytes deleted
 }
 
 // LinterErrors represents linter error information for the current file
@@ -82,6 +162,8 @@ type LinterError struct {
 // TreesitterContext holds treesitter-derived scope information around the cursor
 type TreesitterContext struct {
 	EnclosingSignature string
+	EnclosingStart     int // 1-indexed first line of the enclosing scope (<= 0 if none)
+	EnclosingEnd       int // 1-indexed last line of the enclosing scope (<= 0 if none)
 	Siblings           []*TreesitterSymbol
 	Imports            []string
 }
@@ -91,6 +173,23 @@ type TreesitterSymbol struct {
 	Name      string
 	Signature string
 	Line      int // 1-indexed
+	EndLine   int // 1-indexed last line of the symbol (<= 0 if unknown)
+}
+
+// LSPContext holds what the language servers attached to the buffer report
+// about identifiers near the cursor
+type LSPContext struct {
+	Symbols []*LSPSymbol
+}
+
+// LSPSymbol is an identifier near the cursor with its hover text and the
+// lines of its definition in another file
+type LSPSymbol struct {
+	Name           string
+	Hover          string   // Hover text without markdown fences ("" if none)
+	DefinitionPath string   // File of the definition, relative to the workspace ("" if none)
+	DefinitionLine int      // 1-indexed first line of Definition
+	Definition     []string // Lines of the definition
 }
 
 // GitDiffContext holds staged git diff information for commit message editing.
@@ -99,11 +198,30 @@ type GitDiffContext struct {
 	Diff string // Full unified diff or symbol summary in git diff format
 }
 
+// GitHistoryContext holds why the current file was changed recently: the
+// commits touching it and the ones that last changed the lines around the
+// cursor.
+type GitHistoryContext struct {
+	Commits []string      // "<hash> <subject>" of the latest commits of the file, newest first
+	Blame   []*BlameEntry // Runs of lines around the cursor, in line order
+}
+
+// BlameEntry is a run of lines last changed by the same commit
+type BlameEntry struct {
+	StartLine int // 1-indexed
+	EndLine   int // 1-indexed, inclusive
+	Commit    string
+	Author    string
+	Summary   string // Subject of the commit
+}
+
 // ContextResult holds gathered context from context sources
 type ContextResult struct {
 	Diagnostics *LinterErrors      // LSP diagnostics (nil if unavailable)
 	Treesitter  *TreesitterContext // Treesitter scope context (nil if unavailable)
 	GitDiff     *GitDiffContext    // Staged git diff (nil if not COMMIT_EDITMSG)
+	GitHistory  *GitHistoryContext // Commits and blame of the current file (nil if unavailable)
+	LSP         *LSPContext        // Hover and definitions of nearby identifiers (nil if unavailable)
 }
 
 // GetDiagnostics returns diagnostics from AdditionalContext, or nil if unavailable
@@ -130,6 +248,22 @@ func (r *CompletionRequest) GetGitDiff() *GitDiffContext {
 	return r.AdditionalContext.GitDiff
 }
 
+// GetGitHistory returns git history context from AdditionalContext, or nil if unavailable
+func (r *CompletionRequest) GetGitHistory() *GitHistoryContext {
+	if r.AdditionalContext == nil {
+		return nil
+	}
+	return r.AdditionalContext.GitHistory
+}
+
+// GetLSP returns LSP context from AdditionalContext, or nil if unavailable
+func (r *CompletionRequest) GetLSP() *LSPContext {
+	if r.AdditionalContext == nil {
+		return nil
+	}
+	return r.AdditionalContext.LSP
+}
+
 // FileDiffHistory represents cumulative diffs for a specific file in the workspace
 type FileDiffHistory struct {
 	FileName    string
@@ -143,6 +277,9 @@ type DiffEntry struct {
 	Original string
 	// Updated is the content after the change (the new text)
 	Updated string
+	// UndoSeq is the editor's undo sequence number once the change was made
+	// (0 if unknown). Undoing past it reverts the change.
+	UndoSeq int
 }
 
 // GetOriginal returns the original content (implements utils.DiffEntry interface)
@@ -166,6 +303,21 @@ type RecentBufferSnapshot struct {
 	TimestampMs int64    // Unix epoch milliseconds when file was last accessed
 }
 
+// RetrievalChunk is a range of lines of another file retrieved for its
+// relevance to the code around the cursor
+type RetrievalChunk struct {
+	FilePath  string
+	StartLine int // 1-indexed
+	Lines     []string
+}
+
+// ContextChunk is context a custom source adds to a request, such as a
+// database schema or the output of failing tests
+type ContextChunk struct {
+	Title string   // What the lines are, sent in place of a file path (empty uses the source name)
+	Lines []string // Empty when the source has nothing to add
+}
+
 // UserActionType represents the type of user action
 type UserActionType string
 
@@ -174,6 +326,8 @@ const (
 	ActionInsertSelection UserActionType = "INSERT_SELECTION"
 	ActionDeleteChar      UserActionType = "DELETE_CHAR"
 	ActionDeleteSelection UserActionType = "DELETE_SELECTION"
+	ActionPaste           UserActionType = "PASTE"   // Several characters inserted at once
+	ActionNewline         UserActionType = "NEWLINE" // A line break, with the indentation of the new line
 	ActionCursorMovement  UserActionType = "CURSOR_MOVEMENT"
 )
 
@@ -197,6 +351,17 @@ const (
 	ProviderTypeZeta       ProviderType = "zeta"
 	ProviderTypeCopilot    ProviderType = "copilot"
 	ProviderTypeMercuryAPI ProviderType = "mercuryapi"
+	ProviderTypeOllama     ProviderType = "ollama"
+	ProviderTypeChat       ProviderType = "chat"
+	ProviderTypeGemini     ProviderType = "gemini"
+	ProviderTypeAnthropic  ProviderType = "anthropic"
+)
+
+// Transports between a provider and its server
+const (
+	TransportHTTP      = "http"      // HTTP, the provider's native API
+	TransportGRPC      = "grpc"      // gRPC, for self-hosted sweepapi gateways
+	TransportWebSocket = "websocket" // WebSocket token streams, for self-hosted OpenAI-compatible gateways
 )
 
 // FIMTokenConfig holds FIM (Fill-in-the-Middle) token configuration
@@ -208,19 +373,44 @@ type FIMTokenConfig struct {
 
 // ProviderConfig holds configuration for providers
 type ProviderConfig struct {
-	ProviderURL         string         // URL of the provider server (e.g., "http://localhost:8000")
-	APIKey              string         // Resolved API key for authenticated requests
-	ProviderModel       string         // Model name
-	ProviderTemperature float64        // Sampling temperature
-	ProviderMaxTokens   int            // Max tokens to generate (also drives input trimming)
-	ProviderTopK        int            // Top-k sampling (used by some providers)
-	CompletionPath      string         // API endpoint path (e.g., "/v1/completions")
-	FIMTokens           FIMTokenConfig // FIM tokens configuration
-	CompletionTimeout   int            // Timeout for completion requests in milliseconds
-	PrivacyMode         bool           // Don't send telemetry to provider
-	Version             string         // Plugin version for metrics/telemetry
-	EditorVersion       string         // Editor version (e.g., "0.10.0")
-	EditorOS            string         // Operating system name (e.g., "Darwin")
-	StateDir            string         // State directory for persistent data (device_id, etc.)
-	DeviceID            string         // Persistent device identifier
+	ProviderURL         string              // URL of the provider server (e.g., "http://localhost:8000")
+	APIKey              string              // Resolved API key for authenticated requests
+	ProviderModel       string              // Model name
+	ProviderTemperature float64             // Sampling temperature
+	ProviderMaxTokens   int                 // Max tokens to generate (also drives input trimming)
+	MaxOutputTokens     int                 // Tokens to generate instead of ProviderMaxTokens (0 = ProviderMaxTokens)
+	MaxInputLines       int                 // Input line limit replacing the provider's (0 = provider default)
+	MaxInputBytes       int                 // Input byte limit replacing the provider's (0 = provider default)
+	Tokenizer           tokenizer.Tokenizer // Counts the tokens input is trimmed to (nil = heuristic)
+	ProviderTopK        int                 // Top-k sampling (used by some providers)
+	ProviderSeed        int                 // Sampling seed (0 = server default, -1 = random per request)
+	CompletionPath      string              // API endpoint path (e.g., "/v1/completions")
+	FIMTokens           FIMTokenConfig      // FIM tokens configuration
+	SystemPrompt        string              // System prompt template for chat providers
+	StopSequences       []string            // Extra stop sequences sent with the request
+	CompletionTimeout   int                 // Timeout for completion requests in milliseconds
+	Transport           string              // TransportHTTP, TransportGRPC or TransportWebSocket
+	PrivacyMode         bool                // Don't send telemetry to provider
+	Version             string              // Plugin version for metrics/telemetry
+	EditorVersion       string              // Editor version (e.g., "0.10.0")
+	EditorOS            string              // Operating system name (e.g., "Darwin")
+	StateDir            string              // State directory for persistent data (device_id, etc.)
+	DeviceID            string              // Persistent device identifier
+}
+
+// OutputTokens returns the max tokens a completion may generate.
+func (c *ProviderConfig) OutputTokens() int {
+	if c.MaxOutputTokens > 0 {
+		return c.MaxOutputTokens
+	}
+	return c.ProviderMaxTokens
+}
+
+// RequestSeed returns the seed to send with the next request. A negative
+// ProviderSeed draws a fresh one so it can be logged and replayed.
+func (c *ProviderConfig) RequestSeed() int {
+	if c.ProviderSeed < 0 {
+		return rand.IntN(1<<31-1) + 1
+	}
+	return c.ProviderSeed
 }
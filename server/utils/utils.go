@@ -1,5 +1,7 @@
 package utils
 
+import "cursortab/tokenizer"
+
 // Abs returns the absolute value of an integer
 func Abs(x int) int {
 	if x < 0 {
@@ -8,20 +10,21 @@ func Abs(x int) int {
 	return x
 }
 
-// Token estimation constants
-const (
-	AvgCharsPerToken = 2 // Conservative estimate for mixed content (code + JSON)
-)
-
 // EstimateCharsFromTokens estimates the number of characters for a given token count
 func EstimateCharsFromTokens(tokens int) int {
-	return tokens * AvgCharsPerToken
+	return tokens * tokenizer.AvgCharsPerToken
 }
 
-// TrimContentAroundCursor trims the content to fit within maxTokens while preserving
-// context around the cursor position. Returns the trimmed lines, adjusted cursor position,
-// trim offset, and whether trimming occurred.
-func TrimContentAroundCursor(lines []string, cursorRow, cursorCol, maxTokens int) ([]string, int, int, int, bool) {
+// EstimateTokensFromChars estimates the number of tokens for a given character count
+func EstimateTokensFromChars(chars int) int {
+	return (chars + tokenizer.AvgCharsPerToken - 1) / tokenizer.AvgCharsPerToken
+}
+
+// TrimContentAroundCursor trims the content to fit within maxTokens, as counted by
+// tok (nil for the heuristic), while preserving context around the cursor position.
+// Returns the trimmed lines, adjusted cursor position, trim offset, and whether
+// trimming occurred.
+func TrimContentAroundCursor(lines []string, cursorRow, cursorCol, maxTokens int, tok tokenizer.Tokenizer) ([]string, int, int, int, bool) {
 	// Handle empty file
 	if len(lines) == 0 {
 		return lines, 0, cursorCol, 0, false
@@ -39,61 +42,57 @@ func TrimContentAroundCursor(lines []string, cursorRow, cursorCol, maxTokens int
 		return lines, cursorRow, cursorCol, 0, false
 	}
 
-	maxChars := EstimateCharsFromTokens(maxTokens)
-
-	// Calculate total content size
-	totalChars := 0
-	for _, line := range lines {
-		totalChars += len(line) + 1 // +1 for newline
+	tok = tokenizer.Or(tok)
+	costs := make([]int, len(lines))
+	total := 0
+	for i, line := range lines {
+		costs[i] = tok.Count(line + "\n")
+		total += costs[i]
 	}
 
 	// If content is already within limits, return as-is
-	if totalChars <= maxChars {
+	if total <= maxTokens {
 		return lines, cursorRow, cursorCol, 0, false
 	}
 
 	// Balanced approach: allocate half budget before cursor, half after
 	// This ensures we see context both above AND below the cursor
-	cursorLineChars := len(lines[cursorRow]) + 1
-	remainingBudget := maxChars - cursorLineChars
+	remainingBudget := maxTokens - costs[cursorRow]
 	halfBudget := remainingBudget / 2
 
 	// Expand BEFORE cursor (up to half budget)
 	startLine := cursorRow
-	charsBefore := 0
-	for startLine > 0 && charsBefore < halfBudget {
-		newChars := len(lines[startLine-1]) + 1
-		if charsBefore+newChars <= halfBudget {
+	tokensBefore := 0
+	for startLine > 0 && tokensBefore < halfBudget {
+		if tokensBefore+costs[startLine-1] <= halfBudget {
 			startLine--
-			charsBefore += newChars
+			tokensBefore += costs[startLine]
 		} else {
 			break
 		}
 	}
 
 	// Expand AFTER cursor (up to half budget + any unused from before)
-	unusedBefore := halfBudget - charsBefore
+	unusedBefore := halfBudget - tokensBefore
 	budgetAfter := halfBudget + unusedBefore
 	endLine := cursorRow
-	charsAfter := 0
-	for endLine < len(lines)-1 && charsAfter < budgetAfter {
-		newChars := len(lines[endLine+1]) + 1
-		if charsAfter+newChars <= budgetAfter {
+	tokensAfter := 0
+	for endLine < len(lines)-1 && tokensAfter < budgetAfter {
+		if tokensAfter+costs[endLine+1] <= budgetAfter {
 			endLine++
-			charsAfter += newChars
+			tokensAfter += costs[endLine]
 		} else {
 			break
 		}
 	}
 
 	// If we have unused budget after expanding down, try expanding up more
-	unusedAfter := budgetAfter - charsAfter
+	unusedAfter := budgetAfter - tokensAfter
 	if unusedAfter > 0 {
 		for startLine > 0 {
-			newChars := len(lines[startLine-1]) + 1
-			if charsBefore+newChars <= halfBudget+unusedAfter {
+			if tokensBefore+costs[startLine-1] <= halfBudget+unusedAfter {
 				startLine--
-				charsBefore += newChars
+				tokensBefore += costs[startLine]
 			} else {
 				break
 			}
@@ -119,26 +118,27 @@ type DiffEntry interface {
 	GetUpdated() string
 }
 
-// TrimDiffEntries trims diff entries to fit within maxTokens.
-// Keeps the most recent entries and removes older ones if over limit.
-func TrimDiffEntries[T DiffEntry](diffs []T, maxTokens int) []T {
+// TrimDiffEntries trims diff entries to fit within maxTokens, as counted by tok
+// (nil for the heuristic). Keeps the most recent entries and removes older ones
+// if over limit.
+func TrimDiffEntries[T DiffEntry](diffs []T, maxTokens int, tok tokenizer.Tokenizer) []T {
 	if len(diffs) == 0 || maxTokens <= 0 {
 		return diffs
 	}
 
-	maxChars := EstimateCharsFromTokens(maxTokens)
+	tok = tokenizer.Or(tok)
 
 	// Iterate from newest (end) to oldest (start), keeping entries within limit
-	totalChars := 0
+	totalTokens := 0
 	cutoffIndex := 0
 
 	for i := len(diffs) - 1; i >= 0; i-- {
-		entryChars := len(diffs[i].GetOriginal()) + len(diffs[i].GetUpdated())
-		if totalChars+entryChars > maxChars && i < len(diffs)-1 {
+		entryTokens := tok.Count(diffs[i].GetOriginal()) + tok.Count(diffs[i].GetUpdated())
+		if totalTokens+entryTokens > maxTokens && i < len(diffs)-1 {
 			cutoffIndex = i + 1
 			break
 		}
-		totalChars += entryChars
+		totalTokens += entryTokens
 	}
 
 	if cutoffIndex > 0 {
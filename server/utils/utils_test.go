@@ -2,12 +2,13 @@ package utils
 
 import (
 	"cursortab/assert"
+	"strings"
 	"testing"
 )
 
 func TestTrimContentAroundCursor_EmptyFile(t *testing.T) {
 	lines := []string{}
-	trimmed, cursorRow, cursorCol, offset, didTrim := TrimContentAroundCursor(lines, 0, 0, 100)
+	trimmed, cursorRow, cursorCol, offset, didTrim := TrimContentAroundCursor(lines, 0, 0, 100, nil)
 
 	assert.Equal(t, 0, len(trimmed), "trimmed length")
 	assert.Equal(t, 0, cursorRow, "cursorRow")
@@ -18,7 +19,7 @@ func TestTrimContentAroundCursor_EmptyFile(t *testing.T) {
 
 func TestTrimContentAroundCursor_SmallFile(t *testing.T) {
 	lines := []string{"line 1", "line 2", "line 3"}
-	trimmed, cursorRow, cursorCol, offset, didTrim := TrimContentAroundCursor(lines, 1, 5, 1000)
+	trimmed, cursorRow, cursorCol, offset, didTrim := TrimContentAroundCursor(lines, 1, 5, 1000, nil)
 
 	// Small file should not be trimmed
 	assert.Equal(t, 3, len(trimmed), "trimmed length")
@@ -36,7 +37,7 @@ func TestTrimContentAroundCursor_LargeFileTrims(t *testing.T) {
 	}
 
 	// Very small token limit forces trimming
-	trimmed, cursorRow, _, _, didTrim := TrimContentAroundCursor(lines, 50, 0, 20)
+	trimmed, cursorRow, _, _, didTrim := TrimContentAroundCursor(lines, 50, 0, 20, nil)
 
 	assert.True(t, didTrim, "didTrim should be true")
 
@@ -50,17 +51,17 @@ func TestTrimContentAroundCursor_CursorClamping(t *testing.T) {
 	lines := []string{"line 1", "line 2", "line 3"}
 
 	// Test cursor beyond file
-	_, cursorRow, _, _, _ := TrimContentAroundCursor(lines, 100, 0, 1000)
+	_, cursorRow, _, _, _ := TrimContentAroundCursor(lines, 100, 0, 1000, nil)
 	assert.Equal(t, 2, cursorRow, "cursorRow clamped to last line")
 
 	// Test negative cursor
-	_, cursorRow, _, _, _ = TrimContentAroundCursor(lines, -5, 0, 1000)
+	_, cursorRow, _, _, _ = TrimContentAroundCursor(lines, -5, 0, 1000, nil)
 	assert.Equal(t, 0, cursorRow, "cursorRow clamped to first line")
 }
 
 func TestTrimContentAroundCursor_ZeroMaxTokens(t *testing.T) {
 	lines := []string{"line 1", "line 2", "line 3"}
-	trimmed, _, _, _, didTrim := TrimContentAroundCursor(lines, 1, 0, 0)
+	trimmed, _, _, _, didTrim := TrimContentAroundCursor(lines, 1, 0, 0, nil)
 
 	// maxTokens <= 0 should return content as-is
 	assert.Equal(t, 3, len(trimmed), "trimmed length")
@@ -76,7 +77,7 @@ func TestTrimContentAroundCursor_BalancedTrimming(t *testing.T) {
 
 	// Cursor at line 25 (middle), budget for ~10 lines
 	// Each line is 2 chars, so 20 tokens = 40 chars = ~20 lines
-	_, _, _, _, didTrim := TrimContentAroundCursor(lines, 25, 0, 20)
+	_, _, _, _, didTrim := TrimContentAroundCursor(lines, 25, 0, 20, nil)
 
 	assert.True(t, didTrim, "didTrim should be true")
 }
@@ -92,7 +93,7 @@ func (m *mockDiffEntry) GetUpdated() string  { return m.updated }
 
 func TestTrimDiffEntries_EmptySlice(t *testing.T) {
 	var diffs []*mockDiffEntry
-	result := TrimDiffEntries(diffs, 100)
+	result := TrimDiffEntries(diffs, 100, nil)
 
 	assert.Equal(t, 0, len(result), "result length")
 }
@@ -101,7 +102,7 @@ func TestTrimDiffEntries_ZeroMaxTokens(t *testing.T) {
 	diffs := []*mockDiffEntry{
 		{original: "old", updated: "new"},
 	}
-	result := TrimDiffEntries(diffs, 0)
+	result := TrimDiffEntries(diffs, 0, nil)
 
 	// Should return as-is when maxTokens <= 0
 	assert.Equal(t, 1, len(result), "result length")
@@ -114,7 +115,7 @@ func TestTrimDiffEntries_FitsWithinLimit(t *testing.T) {
 	}
 
 	// Each entry is ~2 chars, total ~4 chars = ~2 tokens
-	result := TrimDiffEntries(diffs, 100)
+	result := TrimDiffEntries(diffs, 100, nil)
 
 	assert.Equal(t, 2, len(result), "result length")
 }
@@ -128,7 +129,7 @@ func TestTrimDiffEntries_ExceedsLimit(t *testing.T) {
 	}
 
 	// Very small limit - should keep only most recent
-	result := TrimDiffEntries(diffs, 5)
+	result := TrimDiffEntries(diffs, 5, nil)
 
 	// Should keep only the most recent entries that fit
 	assert.Less(t, len(result), 4, "result length")
@@ -147,7 +148,7 @@ func TestTrimDiffEntries_KeepsMostRecent(t *testing.T) {
 	}
 
 	// Limit that allows only one or two entries
-	result := TrimDiffEntries(diffs, 10)
+	result := TrimDiffEntries(diffs, 10, nil)
 
 	// Check that newest is included
 	found := false
@@ -161,3 +162,44 @@ func TestTrimDiffEntries_KeepsMostRecent(t *testing.T) {
 		assert.True(t, found, "newest entry should be included when space allows")
 	}
 }
+
+// wordTokenizer counts a token per space-separated word
+type wordTokenizer struct{}
+
+func (wordTokenizer) Count(text string) int { return len(strings.Fields(text)) }
+
+func TestTrimContentAroundCursor_CountsWithTokenizer(t *testing.T) {
+	lines := make([]string, 10)
+	for i := range lines {
+		lines[i] = "a very long line of several words"
+	}
+
+	trimmed, _, _, _, didTrim := TrimContentAroundCursor(lines, 5, 0, 14, wordTokenizer{})
+
+	assert.True(t, didTrim, "trimmed")
+	assert.Len(t, 2, trimmed, "seven words per line")
+}
+
+func TestTrimContentAroundCursor_CJKHeuristic(t *testing.T) {
+	lines := make([]string, 10)
+	for i := range lines {
+		lines[i] = "你好世界你好世界"
+	}
+
+	trimmed, _, _, _, didTrim := TrimContentAroundCursor(lines, 5, 0, 30, nil)
+
+	assert.True(t, didTrim, "trimmed")
+	assert.Len(t, 3, trimmed, "nine tokens per line")
+}
+
+func TestTrimDiffEntries_CountsWithTokenizer(t *testing.T) {
+	diffs := []*mockDiffEntry{
+		{original: "one two", updated: "one two three"},
+		{original: "four", updated: "four five"},
+	}
+
+	result := TrimDiffEntries(diffs, 4, wordTokenizer{})
+
+	assert.Len(t, 1, result, "only the newest fits")
+	assert.Equal(t, "four", result[0].original, "newest kept")
+}
@@ -0,0 +1,119 @@
+package watcher
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cursortab/logger"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce coalesces bursts of filesystem events (editors often write,
+// rename and chmod in quick succession) into a single notification.
+const DefaultDebounce = 200 * time.Millisecond
+
+// Watcher delivers debounced change notifications for a fixed set of files.
+//
+// Parent directories are watched rather than the files themselves so that
+// files which do not exist yet (e.g. a kill-switch sentinel) and atomic
+// rename-on-save writes are both observed on every platform.
+type Watcher struct {
+	fs       *fsnotify.Watcher
+	debounce time.Duration
+	onChange func(path string)
+
+	mu     sync.Mutex
+	files  map[string]struct{}
+	dirs   map[string]struct{}
+	timers map[string]*time.Timer
+}
+
+// New creates a Watcher that calls onChange with the cleaned path of a watched
+// file once no further events arrived for it within debounce.
+func New(debounce time.Duration, onChange func(path string)) (*Watcher, error) {
+	fs, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{
+		fs:       fs,
+		debounce: debounce,
+		onChange: onChange,
+		files:    make(map[string]struct{}),
+		dirs:     make(map[string]struct{}),
+		timers:   make(map[string]*time.Timer),
+	}, nil
+}
+
+// Add starts watching path. The parent directory must exist.
+func (w *Watcher) Add(path string) error {
+	path = filepath.Clean(path)
+	dir := filepath.Dir(path)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.dirs[dir]; !ok {
+		if err := w.fs.Add(dir); err != nil {
+			return err
+		}
+		w.dirs[dir] = struct{}{}
+	}
+	w.files[path] = struct{}{}
+	return nil
+}
+
+// Run processes filesystem events until ctx is done or the watcher is closed.
+func (w *Watcher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn("watcher: %v", err)
+		}
+	}
+}
+
+// handle schedules a debounced notification if the event concerns a watched file.
+func (w *Watcher) handle(event fsnotify.Event) {
+	path := filepath.Clean(event.Name)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.files[path]; !ok {
+		return
+	}
+	if t, ok := w.timers[path]; ok {
+		t.Stop()
+	}
+	w.timers[path] = time.AfterFunc(w.debounce, func() {
+		w.mu.Lock()
+		delete(w.timers, path)
+		w.mu.Unlock()
+		w.onChange(path)
+	})
+}
+
+// Close stops pending notifications and releases the underlying watcher.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	for path, t := range w.timers {
+		t.Stop()
+		delete(w.timers, path)
+	}
+	w.mu.Unlock()
+	return w.fs.Close()
+}
@@ -0,0 +1,105 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"cursortab/assert"
+)
+
+func newTestWatcher(t *testing.T) (*Watcher, chan string) {
+	t.Helper()
+	changes := make(chan string, 10)
+	w, err := New(20*time.Millisecond, func(path string) { changes <- path })
+	assert.NoError(t, err, "New")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go w.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		w.Close()
+	})
+	return w, changes
+}
+
+func waitForChange(t *testing.T, changes chan string) string {
+	t.Helper()
+	select {
+	case path := <-changes:
+		return path
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for change notification")
+		return ""
+	}
+}
+
+func TestWatcher_NotifiesOnCreate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sentinel")
+
+	w, changes := newTestWatcher(t)
+	assert.NoError(t, w.Add(path), "Add")
+
+	assert.NoError(t, os.WriteFile(path, nil, 0644), "create sentinel")
+	assert.Equal(t, path, waitForChange(t, changes), "changed path")
+}
+
+func TestWatcher_NotifiesOnRemove(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sentinel")
+	assert.NoError(t, os.WriteFile(path, nil, 0644), "create sentinel")
+
+	w, changes := newTestWatcher(t)
+	assert.NoError(t, w.Add(path), "Add")
+
+	assert.NoError(t, os.Remove(path), "remove sentinel")
+	assert.Equal(t, path, waitForChange(t, changes), "changed path")
+}
+
+func TestWatcher_DebouncesBursts(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+
+	var mu sync.Mutex
+	count := 0
+	w, err := New(100*time.Millisecond, func(string) {
+		mu.Lock()
+		count++
+		mu.Unlock()
+	})
+	assert.NoError(t, err, "New")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer w.Close()
+	go w.Run(ctx)
+	assert.NoError(t, w.Add(path), "Add")
+
+	for i := range 5 {
+		assert.NoError(t, os.WriteFile(path, []byte{byte('a' + i)}, 0644), "write")
+	}
+	time.Sleep(400 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, count, "notifications after burst")
+}
+
+func TestWatcher_IgnoresUnwatchedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "watched")
+
+	w, changes := newTestWatcher(t)
+	assert.NoError(t, w.Add(path), "Add")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "other"), nil, 0644), "write other")
+
+	select {
+	case p := <-changes:
+		t.Fatalf("unexpected notification for %s", p)
+	case <-time.After(150 * time.Millisecond):
+	}
+}